@@ -0,0 +1,237 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "path"
+    "sort"
+    "strings"
+
+)
+
+// API diff output formats
+const (
+    APIDiffMarkdown = "markdown"
+    APIDiffJSON     = "json"
+)
+
+// APIChange is a function whose signature or doc comment changed
+type APIChange struct {
+    Function         string `json:"function"`
+    Before           string `json:"before"`
+    After            string `json:"after"`
+    SignatureChanged bool   `json:"signature_changed"`
+    CommentChanged   bool   `json:"comment_changed"`
+}
+
+// APIDiff is the changelog of a repository's exported functions between
+// two refs
+type APIDiff struct {
+    Repository string      `json:"repository"`
+    From       string      `json:"from"`
+    To         string      `json:"to"`
+    Added      []string    `json:"added"`
+    Removed    []string    `json:"removed"`
+    Changed    []APIChange `json:"changed"`
+}
+
+// Empty reports whether the refs have the same API
+func (d APIDiff) Empty() bool {
+    return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// RunAPIDiff implements the api-diff subcommand: it extracts the functions
+// of one repository at two refs and writes the changes between them. The
+// clone and checkouts stop once ctx is cancelled.
+func RunAPIDiff(ctx context.Context, config Config, args []string, out io.Writer) error {
+    fs := flag.NewFlagSet("api-diff", flag.ContinueOnError)
+    format := fs.String("format", APIDiffMarkdown, "output format: markdown or json")
+    output := fs.String("o", "", "write the changelog to this file instead of stdout")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+    if fs.NArg() != 3 {
+        return fmt.Errorf("usage: api-diff [-format markdown|json] [-o file] <repository> <from-ref> <to-ref>")
+    }
+    if *format != APIDiffMarkdown && *format != APIDiffJSON {
+        return fmt.Errorf("unsupported api-diff format %q", *format)
+    }
+
+    diff, err := DiffRepositoryAPI(ctx, config, fs.Arg(0), fs.Arg(1), fs.Arg(2))
+    if err != nil {
+        return err
+    }
+
+    if *output != "" {
+        file, err := os.Create(*output)
+        if err != nil {
+            return fmt.Errorf("failed to create changelog file: %w", err)
+        }
+        defer file.Close()
+        out = file
+    }
+    if *format == APIDiffJSON {
+        data, err := json.MarshalIndent(diff, "", "  ")
+        if err != nil {
+            return fmt.Errorf("failed to marshal API diff: %w", err)
+        }
+        _, err = fmt.Fprintln(out, string(data))
+        return err
+    }
+    return writeAPIChangelog(out, diff)
+}
+
+// DiffRepositoryAPI clones a repository once, extracts its functions at
+// both refs, and compares them
+func DiffRepositoryAPI(ctx context.Context, config Config, repoURL, from, to string) (*APIDiff, error) {
+    extractor := NewGitHubFunctionExtractor(config)
+    extractor.repoURL = repoURL
+    // Progress goes to stderr, as the diff is written to stdout
+    extractor.SetGitClient(gitClientFor(repoURL, os.Stderr))
+    if err := extractor.CloneRepository(ctx, repoURL); err != nil {
+        return nil, fmt.Errorf("failed to clone repository: %w", err)
+    }
+    defer extractor.Cleanup()
+    if extractor.repo == nil {
+        return nil, fmt.Errorf("api-diff requires a git repository, %s has no history", repoURL)
+    }
+
+    // Resolve both refs first, as checking out one moves HEAD
+    var refs []HistoricalRef
+    for _, name := range []string{from, to} {
+        hash, err := extractor.resolveRef(ctx, name)
+        if err != nil {
+            return nil, fmt.Errorf("failed to resolve %s: %w", name, err)
+        }
+        refs = append(refs, HistoricalRef{Name: name, Commit: hash})
+    }
+
+    before, err := extractor.functionsAt(ctx, refs[0])
+    if err != nil {
+        return nil, err
+    }
+    after, err := extractor.functionsAt(ctx, refs[1])
+    if err != nil {
+        return nil, err
+    }
+    diff := diffAPI(before, after)
+    diff.Repository, diff.From, diff.To = repoURL, from, to
+    return &diff, nil
+}
+
+// functionsAt checks out a ref and returns its functions by qualified name
+func (g *GitHubFunctionExtractor) functionsAt(ctx context.Context, ref HistoricalRef) (map[string]FunctionInfo, error) {
+    if err := g.checkoutRef(ctx, ref); err != nil {
+        return nil, err
+    }
+
+    functions := make(map[string]FunctionInfo)
+    for function, err := range g.Functions(context.Background()) {
+        if err != nil {
+            g.logger.Printf("At %s: %v", ref.Name, err)
+            continue
+        }
+        importPath := packageImportPath(g.modulePath, path.Dir(function.RelativePath))
+        functions[functionKey(importPath, function.Name)] = function
+    }
+    return functions, nil
+}
+
+// diffAPI compares two sets of functions by qualified name. Signatures are
+// compared by parameter and result types, so renaming a parameter is not a
+// change.
+func diffAPI(before, after map[string]FunctionInfo) APIDiff {
+    diff := APIDiff{Added: []string{}, Removed: []string{}, Changed: []APIChange{}}
+    for key, old := range before {
+        current, ok := after[key]
+        if !ok {
+            diff.Removed = append(diff.Removed, key)
+            continue
+        }
+        change := APIChange{
+            Function:         key,
+            Before:           functionSignature(old),
+            After:            functionSignature(current),
+            SignatureChanged: typeSignature(old) != typeSignature(current),
+            CommentChanged:   strings.TrimSpace(old.Comment) != strings.TrimSpace(current.Comment),
+        }
+        if change.SignatureChanged || change.CommentChanged {
+            diff.Changed = append(diff.Changed, change)
+        }
+    }
+    for key := range after {
+        if _, ok := before[key]; !ok {
+            diff.Added = append(diff.Added, key)
+        }
+    }
+
+    sort.Strings(diff.Added)
+    sort.Strings(diff.Removed)
+    sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Function < diff.Changed[j].Function })
+    return diff
+}
+
+// typeSignature renders a function's parameter and result types without
+// parameter names
+func typeSignature(function FunctionInfo) string {
+    params := make([]string, len(function.Parameters))
+    for i, param := range function.Parameters {
+        params[i] = parameterType(param)
+    }
+    return "(" + strings.Join(params, ", ") + ") (" + strings.Join(function.ReturnTypes, ", ") + ")"
+}
+
+// writeAPIChangelog writes the diff as a markdown changelog
+func writeAPIChangelog(w io.Writer, diff *APIDiff) error {
+    fmt.Fprintf(w, "# API changes in %s\n\n", diff.Repository)
+    fmt.Fprintf(w, "From `%s` to `%s`: %d added, %d removed, %d changed.\n",
+        diff.From, diff.To, len(diff.Added), len(diff.Removed), len(diff.Changed))
+
+    if len(diff.Added) > 0 {
+        fmt.Fprintln(w, "\n## Added")
+        fmt.Fprintln(w)
+        for _, name := range diff.Added {
+            fmt.Fprintf(w, "- `%s`\n", name)
+        }
+    }
+    if len(diff.Removed) > 0 {
+        fmt.Fprintln(w, "\n## Removed")
+        fmt.Fprintln(w)
+        for _, name := range diff.Removed {
+            fmt.Fprintf(w, "- `%s`\n", name)
+        }
+    }
+
+    var signatures, comments []APIChange
+    for _, change := range diff.Changed {
+        if change.SignatureChanged {
+            signatures = append(signatures, change)
+        } else {
+            comments = append(comments, change)
+        }
+    }
+    if len(signatures) > 0 {
+        fmt.Fprintln(w, "\n## Changed Signatures")
+        for _, change := range signatures {
+            fmt.Fprintf(w, "\n- `%s`\n  - before: `%s`\n  - after: `%s`\n", change.Function, change.Before, change.After)
+            if change.CommentChanged {
+                fmt.Fprintln(w, "  - documentation changed")
+            }
+        }
+    }
+    if len(comments) > 0 {
+        fmt.Fprintln(w, "\n## Documentation Changed")
+        fmt.Fprintln(w)
+        for _, change := range comments {
+            fmt.Fprintf(w, "- `%s`\n", change.Function)
+        }
+    }
+    if diff.Empty() {
+        fmt.Fprintln(w, "\nNo API changes.")
+    }
+    return nil
+}
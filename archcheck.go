@@ -0,0 +1,201 @@
+package main
+
+import (
+    "fmt"
+    "go/ast"
+    "go/build"
+    "go/build/constraint"
+    "go/parser"
+    "go/token"
+    "os"
+    "path"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// Reasons a package cannot be built on the runners
+const (
+    UnsupportedAssembly = "assembly"
+    UnsupportedCUDA     = "cuda"
+    UnsupportedGPUTags  = "gpu build tags"
+    UnsupportedArch     = "architecture-specific"
+)
+
+// gpuBuildTags are build tags that select GPU toolkits the runners lack
+var gpuBuildTags = map[string]bool{
+    "cuda":   true,
+    "gpu":    true,
+    "rocm":   true,
+    "opencl": true,
+    "metal":  true,
+}
+
+// assemblyExtensions and cudaExtensions identify non-Go sources that the go
+// command hands to the assembler or that need the CUDA toolkit
+var (
+    assemblyExtensions = []string{".s", ".S", ".sx"}
+    cudaExtensions     = []string{".cu", ".cuh", ".ptx"}
+)
+
+// markUnsupportedPackages records on each package why the runners cannot
+// build it, if they cannot, and returns the reasons by package directory.
+// Packages with assembly files, CUDA sources or bindings, GPU build tags,
+// or no Go file built for the host architecture are marked.
+func (g *GitHubFunctionExtractor) markUnsupportedPackages(packages []PackageInfo, goFiles []string) map[string]string {
+    filesByDir := make(map[string][]string)
+    for _, filePath := range goFiles {
+        dir := path.Dir(g.relativePath(filePath))
+        filesByDir[dir] = append(filesByDir[dir], filePath)
+    }
+
+    unsupported := make(map[string]string)
+    for i := range packages {
+        reason := packageArchProblem(filepath.Join(g.repoPath, filepath.FromSlash(packages[i].Dir)), filesByDir[packages[i].Dir])
+        if reason == "" {
+            continue
+        }
+        packages[i].Unsupported = reason
+        unsupported[packages[i].Dir] = reason
+        g.logger.Printf("Package %s cannot be built on this runner: %s", packages[i].ImportPath, reason)
+    }
+    return unsupported
+}
+
+// packageArchProblem explains why a package directory cannot be built on
+// the host, or returns "" if nothing prevents it
+func packageArchProblem(dir string, goFiles []string) string {
+    entries, err := os.ReadDir(dir)
+    if err != nil {
+        return ""
+    }
+    var assembly, cuda []string
+    for _, entry := range entries {
+        ext := filepath.Ext(entry.Name())
+        switch {
+        case entry.IsDir():
+        case containsString(assemblyExtensions, ext):
+            assembly = append(assembly, entry.Name())
+        case containsString(cudaExtensions, ext):
+            cuda = append(cuda, entry.Name())
+        }
+    }
+    if len(cuda) > 0 {
+        return fmt.Sprintf("%s: CUDA sources %s", UnsupportedCUDA, strings.Join(cuda, ", "))
+    }
+    if len(assembly) > 0 {
+        return fmt.Sprintf("%s: %s", UnsupportedAssembly, strings.Join(assembly, ", "))
+    }
+
+    built := 0
+    for _, filePath := range goFiles {
+        name := filepath.Base(filePath)
+        if line := buildConstraint(filePath); line != "" {
+            if tags := constraintGPUTags(line); len(tags) > 0 {
+                return fmt.Sprintf("%s: %s in %s", UnsupportedGPUTags, strings.Join(tags, ", "), name)
+            }
+        }
+        if cgoUsesCUDA(filePath) {
+            return fmt.Sprintf("%s: cgo bindings in %s", UnsupportedCUDA, name)
+        }
+        if buildExclusion(filePath) == "" {
+            built++
+        }
+    }
+    if len(goFiles) > 0 && built == 0 {
+        return fmt.Sprintf("%s: no Go files for %s/%s", UnsupportedArch, build.Default.GOOS, build.Default.GOARCH)
+    }
+    return ""
+}
+
+// archSourceDirs returns the directories, among the slash-separated file
+// paths within paths, that hold assembly or CUDA sources. Only names are
+// looked at, so it also works on remote tree listings.
+func archSourceDirs(files []string, paths []string) []string {
+    seen := make(map[string]bool)
+    var dirs []string
+    for _, file := range files {
+        ext := path.Ext(file)
+        if !containsString(assemblyExtensions, ext) && !containsString(cudaExtensions, ext) {
+            continue
+        }
+        if dir := path.Dir(file); inPaths(file, paths) && !seen[dir] {
+            seen[dir] = true
+            dirs = append(dirs, dir)
+        }
+    }
+    sort.Strings(dirs)
+    return dirs
+}
+
+// constraintGPUTags returns the GPU build tags a //go:build line mentions
+// when the line only holds with them, so the file is GPU-only
+func constraintGPUTags(line string) []string {
+    expr, err := constraint.Parse(line)
+    if err != nil {
+        return nil
+    }
+    found := make(map[string]bool)
+    withGPU := expr.Eval(func(tag string) bool {
+        if gpuBuildTags[tag] {
+            found[tag] = true
+            return true
+        }
+        return hostBuildTag(tag)
+    })
+    if !withGPU || expr.Eval(hostBuildTag) {
+        return nil
+    }
+    tags := make([]string, 0, len(found))
+    for tag := range found {
+        tags = append(tags, tag)
+    }
+    sort.Strings(tags)
+    return tags
+}
+
+// hostBuildTag approximates whether the go command sets a build tag when
+// building for the host
+func hostBuildTag(tag string) bool {
+    ctxt := build.Default
+    switch {
+    case tag == ctxt.GOOS, tag == ctxt.GOARCH, tag == ctxt.Compiler:
+        return true
+    case tag == "unix":
+        return ctxt.GOOS != "windows" && ctxt.GOOS != "plan9" && ctxt.GOOS != "js" && ctxt.GOOS != "wasip1"
+    case tag == "cgo":
+        return ctxt.CgoEnabled
+    }
+    return containsString(ctxt.ReleaseTags, tag) || containsString(ctxt.BuildTags, tag)
+}
+
+// cgoUsesCUDA reports whether a file's cgo preamble includes CUDA headers
+// or links CUDA libraries
+func cgoUsesCUDA(filePath string) bool {
+    node, err := parser.ParseFile(token.NewFileSet(), filePath, nil, parser.ImportsOnly|parser.ParseComments)
+    if err != nil {
+        return false
+    }
+    for _, decl := range node.Decls {
+        genDecl, ok := decl.(*ast.GenDecl)
+        if !ok || genDecl.Tok != token.IMPORT {
+            continue
+        }
+        for _, spec := range genDecl.Specs {
+            importSpec := spec.(*ast.ImportSpec)
+            if importSpec.Path.Value != `"C"` {
+                continue
+            }
+            // Like the go command, take the declaration's comment when the
+            // import is not parenthesized
+            doc := importSpec.Doc
+            if doc == nil && len(genDecl.Specs) == 1 {
+                doc = genDecl.Doc
+            }
+            if doc != nil && strings.Contains(strings.ToLower(doc.Text()), "cuda") {
+                return true
+            }
+        }
+    }
+    return false
+}
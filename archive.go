@@ -0,0 +1,221 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "github.com/go-git/go-git/v5"
+    gitconfig "github.com/go-git/go-git/v5/config"
+    "github.com/go-git/go-git/v5/plumbing"
+    githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// archiveRefPrefix namespaces the refs pinning processed commits in
+// archives, so they survive the branch being rewritten upstream
+const archiveRefPrefix = "refs/floq/processed/"
+
+// ArchiveConfig configures mirroring processed repositories for audits
+type ArchiveConfig struct {
+    // Remote is a git URL template, with a {repo} placeholder for the
+    // repository slug, that a mirror of every processed repository is
+    // pushed to
+    Remote string `json:"remote,omitempty"`
+    // Bundle is a directory, or an http(s) URL accepting PUT requests such
+    // as an object storage bucket, that a git bundle of every processed
+    // repository is written to
+    Bundle string `json:"bundle,omitempty"`
+    // Token is sent as a bearer token when pushing to the remote over
+    // HTTP and when uploading bundles
+    Token string `json:"token,omitempty"`
+}
+
+// Enabled reports whether processed repositories are archived anywhere
+func (c ArchiveConfig) Enabled() bool {
+    return c.Remote != "" || c.Bundle != ""
+}
+
+// ArchiveRecord links a processed commit to the archive holding it
+type ArchiveRecord struct {
+    // Kind is "remote" or "bundle"
+    Kind     string `json:"kind"`
+    Location string `json:"location"`
+    Commit   string `json:"commit"`
+    // Ref is the ref pinning the commit in the archive
+    Ref string `json:"ref"`
+}
+
+// archiveCheckout archives the repository at the commit currently checked
+// out to every configured destination. Failures of one destination do not
+// prevent the others.
+func (g *GitHubFunctionExtractor) archiveCheckout(ctx context.Context, result *ProcessingResult) {
+    if g.repo == nil {
+        g.logger.Printf("Not archiving %s: it has no git history", g.repoURL)
+        return
+    }
+    head, err := g.repo.Head()
+    if err != nil {
+        result.Errors = append(result.Errors, fmt.Sprintf("Failed to archive repository: failed to resolve HEAD: %v", err))
+        return
+    }
+
+    // Pin the processed commit so the mirror keeps it even if no branch
+    // points to it anymore
+    pin := plumbing.NewHashReference(plumbing.ReferenceName(archiveRefPrefix+head.Hash().String()), head.Hash())
+    if err := g.repo.Storer.SetReference(pin); err != nil {
+        result.Errors = append(result.Errors, fmt.Sprintf("Failed to archive repository: failed to pin %s: %v", head.Hash(), err))
+        return
+    }
+
+    if g.archiveConfig.Remote != "" {
+        record, err := g.pushMirror(ctx, pin)
+        if err != nil {
+            g.logger.Printf("Failed to push mirror of %s: %v", g.repoURL, err)
+            result.Errors = append(result.Errors, fmt.Sprintf("Failed to push mirror: %v", err))
+        } else {
+            result.Archives = append(result.Archives, *record)
+        }
+    }
+    if g.archiveConfig.Bundle != "" {
+        record, err := g.writeBundle(ctx, pin)
+        if err != nil {
+            g.logger.Printf("Failed to write bundle of %s: %v", g.repoURL, err)
+            result.Errors = append(result.Errors, fmt.Sprintf("Failed to write bundle: %v", err))
+        } else {
+            result.Archives = append(result.Archives, *record)
+        }
+    }
+}
+
+// pushMirror pushes the repository's branches, tags and the pinned commit
+// to the archive remote
+func (g *GitHubFunctionExtractor) pushMirror(ctx context.Context, pin *plumbing.Reference) (*ArchiveRecord, error) {
+    url := strings.ReplaceAll(g.archiveConfig.Remote, "{repo}", repoSlug(g.repoURL))
+
+    // The clone's remote-tracking branches become the mirror's branches
+    specs := []gitconfig.RefSpec{
+        "+refs/tags/*:refs/tags/*",
+        gitconfig.RefSpec(fmt.Sprintf("+%s:%s", pin.Name(), pin.Name())),
+    }
+    refs, err := g.repo.References()
+    if err != nil {
+        return nil, fmt.Errorf("failed to list refs: %w", err)
+    }
+    err = refs.ForEach(func(ref *plumbing.Reference) error {
+        name := ref.Name().String()
+        if ref.Type() != plumbing.HashReference || !strings.HasPrefix(name, "refs/remotes/origin/") {
+            return nil
+        }
+        branch := strings.TrimPrefix(name, "refs/remotes/origin/")
+        specs = append(specs, gitconfig.RefSpec(fmt.Sprintf("+%s:refs/heads/%s", name, branch)))
+        return nil
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to list refs: %w", err)
+    }
+
+    remote, err := g.repo.CreateRemoteAnonymous(&gitconfig.RemoteConfig{
+        Name: "anonymous",
+        URLs: []string{url},
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to configure archive remote: %w", err)
+    }
+    options := &git.PushOptions{RemoteName: "anonymous", RefSpecs: specs, Force: true}
+    if g.archiveConfig.Token != "" {
+        options.Auth = &githttp.TokenAuth{Token: g.archiveConfig.Token}
+    }
+    if err := remote.PushContext(ctx, options); err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+        return nil, fmt.Errorf("failed to push to %s: %w", url, err)
+    }
+
+    g.logger.Printf("Pushed mirror of %s at %s to %s", g.repoURL, pin.Hash(), url)
+    return &ArchiveRecord{Kind: "remote", Location: url, Commit: pin.Hash().String(), Ref: pin.Name().String()}, nil
+}
+
+// writeBundle writes a git bundle of the repository, including the pinned
+// commit, to the bundle directory or uploads it to the bundle URL
+func (g *GitHubFunctionExtractor) writeBundle(ctx context.Context, pin *plumbing.Reference) (*ArchiveRecord, error) {
+    // go-git cannot write bundles
+    if _, err := exec.LookPath("git"); err != nil {
+        return nil, fmt.Errorf("writing bundles requires the git CLI: %w", err)
+    }
+
+    name := fmt.Sprintf("%s-%s.bundle", repoSlug(g.repoURL), pin.Hash().String()[:12])
+    bundle := filepath.Join(g.tempDir, name)
+    if out, err := exec.CommandContext(ctx, "git", "-C", g.repoPath, "bundle", "create", bundle, "--all").CombinedOutput(); err != nil {
+        return nil, fmt.Errorf("git bundle create: %w: %s", err, strings.TrimSpace(string(out)))
+    }
+
+    location, err := g.storeBundle(ctx, bundle, name)
+    if err != nil {
+        return nil, err
+    }
+    g.logger.Printf("Wrote bundle of %s at %s to %s", g.repoURL, pin.Hash(), location)
+    return &ArchiveRecord{Kind: "bundle", Location: location, Commit: pin.Hash().String(), Ref: pin.Name().String()}, nil
+}
+
+// storeBundle copies a bundle file to its destination, under a directory
+// named after the run, and returns where it was stored. Uploads are
+// cancelled with ctx.
+func (g *GitHubFunctionExtractor) storeBundle(ctx context.Context, bundle, name string) (string, error) {
+    file, err := os.Open(bundle)
+    if err != nil {
+        return "", fmt.Errorf("failed to open bundle: %w", err)
+    }
+    defer file.Close()
+
+    destination := g.archiveConfig.Bundle
+    runDir := orDefault(g.runID, "adhoc")
+    if strings.HasPrefix(destination, "http://") || strings.HasPrefix(destination, "https://") {
+        url := strings.TrimSuffix(destination, "/") + "/" + runDir + "/" + name
+        info, err := file.Stat()
+        if err != nil {
+            return "", fmt.Errorf("failed to stat bundle: %w", err)
+        }
+        req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, file)
+        if err != nil {
+            return "", fmt.Errorf("failed to create upload request: %w", err)
+        }
+        req.ContentLength = info.Size()
+        req.Header.Set("Content-Type", "application/octet-stream")
+        if g.archiveConfig.Token != "" {
+            req.Header.Set("Authorization", "Bearer "+g.archiveConfig.Token)
+        }
+        resp, err := (&http.Client{Timeout: 10 * time.Minute}).Do(req)
+        if err != nil {
+            return "", fmt.Errorf("failed to upload bundle: %w", err)
+        }
+        defer resp.Body.Close()
+        if resp.StatusCode/100 != 2 {
+            body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+            return "", fmt.Errorf("failed to upload bundle: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+        }
+        return url, nil
+    }
+
+    dir := filepath.Join(destination, runDir)
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return "", fmt.Errorf("failed to create bundle directory: %w", err)
+    }
+    target := filepath.Join(dir, name)
+    out, err := os.Create(target)
+    if err != nil {
+        return "", fmt.Errorf("failed to create bundle file: %w", err)
+    }
+    if _, err := io.Copy(out, file); err != nil {
+        out.Close()
+        return "", fmt.Errorf("failed to write bundle file: %w", err)
+    }
+    if err := out.Close(); err != nil {
+        return "", fmt.Errorf("failed to write bundle file: %w", err)
+    }
+    return target, nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+)
+
+// Default artifact file name templates
+const (
+    defaultResultsFileTemplate = "processing_results.json"
+    defaultLogFileTemplate     = "floq.log"
+)
+
+// runIDTimeFormat is the timestamp layout used as the prefix of run ids, chosen
+// so that run directories sort chronologically
+const runIDTimeFormat = "20060102-150405"
+
+// ArtifactsConfig controls where run outputs (results, reports, logs) are written
+type ArtifactsConfig struct {
+    // Dir is the root artifacts directory. When empty, artifacts are written
+    // to the working directory without a per-run subfolder.
+    Dir         string `json:"dir"`
+    // ResultsFile and LogFile are file name templates supporting the
+    // {run_id}, {date}, and {time} placeholders
+    ResultsFile string `json:"results_file"`
+    LogFile     string `json:"log_file"`
+    // KeepRuns is the number of most recent run directories to retain;
+    // zero disables pruning
+    KeepRuns    int    `json:"keep_runs"`
+}
+
+// RunArtifacts manages the artifact directory of a single run
+type RunArtifacts struct {
+    RunID     string
+    Dir       string
+    StartedAt time.Time
+    config    ArtifactsConfig
+    logFile   *os.File
+}
+
+// NewRunArtifacts creates the artifact directory for a new run
+func NewRunArtifacts(config ArtifactsConfig) (*RunArtifacts, error) {
+    startedAt := time.Now()
+    runID, err := newRunID(startedAt)
+    if err != nil {
+        return nil, err
+    }
+
+    dir := "."
+    if config.Dir != "" {
+        dir = filepath.Join(config.Dir, runID)
+        if err := os.MkdirAll(dir, 0755); err != nil {
+            return nil, fmt.Errorf("failed to create artifacts directory: %w", err)
+        }
+    }
+
+    return &RunArtifacts{
+        RunID:     runID,
+        Dir:       dir,
+        StartedAt: startedAt,
+        config:    config,
+    }, nil
+}
+
+// newRunID generates a sortable, unique run identifier
+func newRunID(t time.Time) (string, error) {
+    suffix := make([]byte, 3)
+    if _, err := rand.Read(suffix); err != nil {
+        return "", fmt.Errorf("failed to generate run id: %w", err)
+    }
+    return t.Format(runIDTimeFormat) + "-" + hex.EncodeToString(suffix), nil
+}
+
+// Path returns the path of an artifact file, expanding naming placeholders.
+// Names are built from configured templates and repository URLs, so a name
+// that would leave the run's directory, such as an absolute path or one
+// climbing out with "..", is rejected.
+func (a *RunArtifacts) Path(template string) (string, error) {
+    replacer := strings.NewReplacer(
+        "{run_id}", a.RunID,
+        "{date}", a.StartedAt.Format("2006-01-02"),
+        "{time}", a.StartedAt.Format("150405"),
+    )
+    name := filepath.Clean(replacer.Replace(template))
+    if !filepath.IsLocal(name) {
+        return "", fmt.Errorf("artifact path %q is outside the artifacts directory", name)
+    }
+    return filepath.Join(a.Dir, name), nil
+}
+
+// ResultsPath returns the path of the run's results file
+func (a *RunArtifacts) ResultsPath() (string, error) {
+    return a.Path(orDefault(a.config.ResultsFile, defaultResultsFileTemplate))
+}
+
+// LogPath returns the path of the run's log file
+func (a *RunArtifacts) LogPath() (string, error) {
+    return a.Path(orDefault(a.config.LogFile, defaultLogFileTemplate))
+}
+
+// OpenLog opens the run's log file and returns a writer that mirrors log
+// output to both console and the file. Logs are only persisted when an
+// artifacts directory is configured.
+func (a *RunArtifacts) OpenLog(console io.Writer) (io.Writer, error) {
+    if a.config.Dir == "" {
+        return console, nil
+    }
+
+    path, err := a.LogPath()
+    if err != nil {
+        return nil, err
+    }
+    file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open log file: %w", err)
+    }
+    a.logFile = file
+    return io.MultiWriter(console, file), nil
+}
+
+// Close closes the run's log file
+func (a *RunArtifacts) Close() error {
+    if a.logFile != nil {
+        return a.logFile.Close()
+    }
+    return nil
+}
+
+// PruneRuns removes the oldest run directories under the artifacts root so
+// that at most keep runs remain. It returns the removed directories.
+func PruneRuns(root string, keep int) ([]string, error) {
+    if root == "" || keep <= 0 {
+        return nil, nil
+    }
+
+    runs, err := listRuns(root)
+    if err != nil {
+        return nil, err
+    }
+    if len(runs) <= keep {
+        return nil, nil
+    }
+
+    var removed []string
+    for _, name := range runs[:len(runs)-keep] {
+        path := filepath.Join(root, name)
+        if err := os.RemoveAll(path); err != nil {
+            return removed, fmt.Errorf("failed to remove run %s: %w", name, err)
+        }
+        removed = append(removed, path)
+    }
+    return removed, nil
+}
+
+// isRunID reports whether a directory name looks like a generated run id.
+// Run ids name directories under the artifacts root, so one that is not a
+// single path element is not a run id.
+func isRunID(name string) bool {
+    if len(name) <= len(runIDTimeFormat) || !filepath.IsLocal(name) || filepath.Base(name) != name {
+        return false
+    }
+    _, err := time.Parse(runIDTimeFormat, name[:len(runIDTimeFormat)])
+    return err == nil
+}
+
+// repoSlug derives a file-name-safe identifier from a repository URL, e.g.
+// "https://github.com/golang/example.git" becomes "golang-example"
+func repoSlug(repoURL string) string {
+    trimmed := strings.TrimSuffix(strings.TrimSuffix(repoURL, "/"), ".git")
+    parts := strings.FieldsFunc(trimmed, func(r rune) bool {
+        return r == '/' || r == ':'
+    })
+    if len(parts) > 2 {
+        parts = parts[len(parts)-2:]
+    }
+
+    slug := strings.Map(func(r rune) rune {
+        switch {
+        case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+            return r
+        default:
+            return '-'
+        }
+    }, strings.Join(parts, "-"))
+    if slug == "" {
+        return "repository"
+    }
+    return slug
+}
+
+// orDefault returns value, or defaultValue when value is empty
+func orDefault(value, defaultValue string) string {
+    if value == "" {
+        return defaultValue
+    }
+    return value
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+    "fmt"
+    "go/types"
+    "path/filepath"
+    "slices"
+    "strings"
+)
+
+// optionsSuffixes are the type name suffixes of structs whose zero value
+// is taken to mean "all defaults"
+var optionsSuffixes = []string{"Options", "Opts"}
+
+// AutoArguments are the arguments the runner constructs for parameters
+// that need no data: a background context for a context.Context and zero
+// values for options structs
+type AutoArguments struct {
+    // Args are the argument expressions of the runner
+    Args []string
+    // Imports lists the runner imports the arguments need, as
+    // `alias "path"`
+    Imports []string
+    // Display are the arguments as they would be written by hand, for the
+    // results
+    Display []string
+}
+
+// autoArguments constructs the arguments of a function whose parameters
+// are all contexts or options structs
+func (g *GitHubFunctionExtractor) autoArguments(function FunctionInfo) (*AutoArguments, error) {
+    if g.schemas == nil || len(function.Parameters) == 0 {
+        return nil, fmt.Errorf("function %s has no parameters to construct", function.Name)
+    }
+    relDir, _ := filepath.Rel(g.repoPath, filepath.Dir(function.FilePath))
+    importPath := packageImportPath(g.modulePath, filepath.ToSlash(relDir))
+    pkg, err := g.schemas.Import(importPath)
+    if err != nil {
+        return nil, err
+    }
+    obj := pkg.Scope().Lookup(function.Name)
+    if obj == nil {
+        return nil, fmt.Errorf("function %s has no type information", function.Name)
+    }
+    signature, ok := obj.Type().Underlying().(*types.Signature)
+    if !ok || signature.Params().Len() != len(function.Parameters) {
+        return nil, fmt.Errorf("function %s has no type information", function.Name)
+    }
+
+    // The function's own package is imported as pkg by every runner
+    imports := &mockImports{aliases: map[string]string{importPath: "pkg"}}
+    auto := &AutoArguments{Args: []string{}}
+    params := signature.Params()
+    for i := 0; i < params.Len(); i++ {
+        param := params.At(i)
+        if signature.Variadic() && i == params.Len()-1 {
+            return nil, fmt.Errorf("cannot construct variadic parameter %s", param.Name())
+        }
+        arg, display, ok := autoArgument(param.Type(), imports)
+        if !ok {
+            return nil, fmt.Errorf("cannot construct parameter %s of type %s", param.Name(), param.Type())
+        }
+        auto.Args = append(auto.Args, arg)
+        auto.Display = append(auto.Display, display)
+    }
+    auto.Imports = imports.specs
+    return auto, nil
+}
+
+// autoArgument returns the runner expression constructing a value of type
+// t, and the expression as written by hand
+func autoArgument(t types.Type, imports *mockImports) (string, string, bool) {
+    pointer := ""
+    if ptr, ok := types.Unalias(t).(*types.Pointer); ok {
+        pointer = "&"
+        t = ptr.Elem()
+    }
+    named, ok := types.Unalias(t).(*types.Named)
+    if !ok || named.Obj().Pkg() == nil || !named.Obj().Exported() {
+        return "", "", false
+    }
+    obj := named.Obj()
+    if pointer == "" && obj.Pkg().Path() == "context" && obj.Name() == "Context" {
+        return imports.alias("context") + ".Background()", "context.Background()", true
+    }
+    if _, ok := named.Underlying().(*types.Struct); !ok || named.TypeParams().Len() > 0 || !isOptionsName(obj.Name()) {
+        return "", "", false
+    }
+    runnerName := imports.alias(obj.Pkg().Path()) + "." + obj.Name()
+    return pointer + runnerName + "{}", pointer + obj.Pkg().Name() + "." + obj.Name() + "{}", true
+}
+
+// isOptionsName reports whether a type name marks an options struct
+func isOptionsName(name string) bool {
+    for _, suffix := range optionsSuffixes {
+        if strings.HasSuffix(name, suffix) {
+            return true
+        }
+    }
+    return false
+}
+
+// autoArgumentImports returns the imports a runner calling function with
+// args needs when the arguments were constructed by autoArguments
+func (g *GitHubFunctionExtractor) autoArgumentImports(function FunctionInfo, args []string) []string {
+    if !g.execConfig.AutoArguments || len(args) == 0 || args[0] == mockArgument {
+        return nil
+    }
+    auto, err := g.autoArguments(function)
+    if err != nil || !slices.Equal(auto.Args, args) {
+        return nil
+    }
+    return auto.Imports
+}
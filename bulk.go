@@ -0,0 +1,537 @@
+package main
+
+import (
+    "bufio"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "io/fs"
+    "log"
+    "net/url"
+    "os"
+    "path/filepath"
+    "regexp"
+    "sort"
+    "strings"
+    "time"
+)
+
+// Defaults for bulk mode
+const (
+    defaultBulkCheckpointEvery = 100
+    defaultBulkMaxAttempts     = 3
+)
+
+// Bulk queue entry statuses
+const (
+    BulkQueued  = "queued"
+    BulkRunning = "running"
+    BulkDone    = "done"
+    BulkFailed  = "failed"
+)
+
+// BulkConfig controls bulk mode, which works through a persistent queue of
+// thousands of repositories across multiple invocations
+type BulkConfig struct {
+    // RateLimits caps repositories started per minute by provider host,
+    // e.g. {"github.com": 30}; DefaultRate applies to other remote hosts.
+    // Zero means unlimited. Local directories are never limited.
+    RateLimits  map[string]int `json:"rate_limits,omitempty"`
+    DefaultRate int            `json:"default_rate"`
+    // CheckpointEvery writes a checkpoint summary after this many
+    // repositories
+    CheckpointEvery int `json:"checkpoint_every"`
+    // MaxAttempts is how often a repository is tried before it is failed
+    MaxAttempts int `json:"max_attempts"`
+}
+
+// BulkEntry is the persisted state of one repository in a bulk queue
+type BulkEntry struct {
+    URL        string          `json:"url"`
+    Status     string          `json:"status"`
+    Attempts   int             `json:"attempts"`
+    LastError  string          `json:"last_error,omitempty"`
+    Stats      ProcessingStats `json:"stats"`
+    FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+// BulkCheckpoint summarizes the progress of a bulk queue
+type BulkCheckpoint struct {
+    Queue     string         `json:"queue"`
+    RunID     string         `json:"run_id"`
+    Time      time.Time      `json:"time"`
+    Counts    map[string]int `json:"counts"`
+    Processed int            `json:"processed"`
+    // Stats aggregates the repositories processed by this invocation
+    Stats ProcessingStats `json:"stats"`
+    // PerMinute is this invocation's throughput in repositories per minute
+    PerMinute float64 `json:"per_minute"`
+}
+
+// bulkQueueName restricts queue names to safe directory names
+var bulkQueueName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// BulkQueue is a persistent repository queue in the state store. The
+// repository list is an append-only file so it can be streamed without
+// holding the queue in memory; each repository's state is a separate entry
+// keyed by a hash of its URL.
+type BulkQueue struct {
+    Name  string
+    state *StateStore
+    list  string
+}
+
+// OpenBulkQueue opens (creating if needed) the named queue in the state store
+func OpenBulkQueue(state *StateStore, name string) (*BulkQueue, error) {
+    if !bulkQueueName.MatchString(name) {
+        return nil, fmt.Errorf("invalid queue name %q", name)
+    }
+    dir := filepath.Join(state.dir, "bulk", name)
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return nil, fmt.Errorf("failed to create queue directory: %w", err)
+    }
+    return &BulkQueue{
+        Name:  name,
+        state: state,
+        list:  filepath.Join(dir, "repositories.txt"),
+    }, nil
+}
+
+// bucket is the state bucket holding the queue's entries
+func (q *BulkQueue) bucket() string {
+    return "bulk/" + q.Name + "/entries"
+}
+
+// entryKey derives a file-name-safe key from a repository URL
+func entryKey(repoURL string) string {
+    sum := sha256.Sum256([]byte(repoURL))
+    return hex.EncodeToString(sum[:])[:16]
+}
+
+// Entry loads the state of a repository, reporting whether it is queued
+func (q *BulkQueue) Entry(repoURL string) (*BulkEntry, bool, error) {
+    var entry BulkEntry
+    found, err := q.state.Get(q.bucket(), entryKey(repoURL), &entry)
+    if err != nil || !found {
+        return nil, false, err
+    }
+    return &entry, true, nil
+}
+
+// Save persists the state of a repository
+func (q *BulkQueue) Save(entry *BulkEntry) error {
+    return q.state.Put(q.bucket(), entryKey(entry.URL), entry)
+}
+
+// Add queues repositories that are not in the queue yet and returns how
+// many were added
+func (q *BulkQueue) Add(repositories []string) (int, error) {
+    file, err := os.OpenFile(q.list, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+    if err != nil {
+        return 0, fmt.Errorf("failed to open queue list: %w", err)
+    }
+    defer file.Close()
+
+    added := 0
+    for _, repoURL := range repositories {
+        if _, found, err := q.Entry(repoURL); err != nil {
+            return added, err
+        } else if found {
+            continue
+        }
+        if err := q.Save(&BulkEntry{URL: repoURL, Status: BulkQueued}); err != nil {
+            return added, err
+        }
+        if _, err := fmt.Fprintln(file, repoURL); err != nil {
+            return added, fmt.Errorf("failed to append to queue list: %w", err)
+        }
+        added++
+    }
+    return added, nil
+}
+
+// Each streams the queue's repositories in insertion order, stopping at
+// the first error returned by fn
+func (q *BulkQueue) Each(fn func(repoURL string) error) error {
+    file, err := os.Open(q.list)
+    if errors.Is(err, fs.ErrNotExist) {
+        return nil
+    }
+    if err != nil {
+        return fmt.Errorf("failed to open queue list: %w", err)
+    }
+    defer file.Close()
+
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        if repoURL := strings.TrimSpace(scanner.Text()); repoURL != "" {
+            if err := fn(repoURL); err != nil {
+                return err
+            }
+        }
+    }
+    return scanner.Err()
+}
+
+// Counts returns the number of repositories per status
+func (q *BulkQueue) Counts() (map[string]int, error) {
+    counts := make(map[string]int)
+    err := q.Each(func(repoURL string) error {
+        entry, found, err := q.Entry(repoURL)
+        if err != nil {
+            return err
+        }
+        if found {
+            counts[entry.Status]++
+        }
+        return nil
+    })
+    return counts, err
+}
+
+// readRepositoryList reads repository URLs from a file, one per line,
+// ignoring blank lines and # comments
+func readRepositoryList(filename string) ([]string, error) {
+    file, err := os.Open(filename)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open repository list: %w", err)
+    }
+    defer file.Close()
+
+    var repositories []string
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        if line != "" && !strings.HasPrefix(line, "#") {
+            repositories = append(repositories, line)
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("failed to read repository list: %w", err)
+    }
+    return repositories, nil
+}
+
+// providerHost returns the host serving a repository, or "" for local
+// directories. Both URLs and scp-like git@host:path addresses are handled.
+func providerHost(repoURL string) string {
+    if info, err := os.Stat(repoURL); err == nil && info.IsDir() {
+        return ""
+    }
+    if u, err := url.Parse(repoURL); err == nil && u.Host != "" {
+        return strings.ToLower(u.Hostname())
+    }
+    if at := strings.Index(repoURL, "@"); at >= 0 {
+        if colon := strings.Index(repoURL[at:], ":"); colon >= 0 {
+            return strings.ToLower(repoURL[at+1 : at+colon])
+        }
+    }
+    return ""
+}
+
+// hostRateLimiter spaces out the repositories started per provider host
+type hostRateLimiter struct {
+    limits   map[string]int
+    fallback int
+    next     map[string]time.Time
+}
+
+// newHostRateLimiter creates a limiter from the bulk configuration
+func newHostRateLimiter(config BulkConfig) *hostRateLimiter {
+    limits := make(map[string]int, len(config.RateLimits))
+    for host, limit := range config.RateLimits {
+        limits[strings.ToLower(host)] = limit
+    }
+    return &hostRateLimiter{
+        limits:   limits,
+        fallback: config.DefaultRate,
+        next:     make(map[string]time.Time),
+    }
+}
+
+// Wait blocks until another repository may be started on host, or until ctx
+// is cancelled
+func (l *hostRateLimiter) Wait(ctx context.Context, host string) error {
+    if host == "" {
+        return nil
+    }
+    perMinute, ok := l.limits[host]
+    if !ok {
+        perMinute = l.fallback
+    }
+    if perMinute <= 0 {
+        return nil
+    }
+
+    now := time.Now()
+    if next := l.next[host]; next.After(now) {
+        timer := time.NewTimer(next.Sub(now))
+        defer timer.Stop()
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-timer.C:
+        }
+        now = next
+    }
+    l.next[host] = now.Add(time.Minute / time.Duration(perMinute))
+    return nil
+}
+
+// BulkRunner works through a bulk queue. Results are written to the run's
+// artifacts one repository at a time and only aggregate statistics are kept
+// in memory, so memory use does not grow with the size of the queue.
+type BulkRunner struct {
+    config    Config
+    queue     *BulkQueue
+    artifacts *RunArtifacts
+    limiter   *hostRateLimiter
+    logger    *log.Logger
+
+    started   time.Time
+    processed int
+    stats     ProcessingStats
+}
+
+// NewBulkRunner creates a runner for a queue
+func NewBulkRunner(config Config, queue *BulkQueue, artifacts *RunArtifacts) *BulkRunner {
+    return &BulkRunner{
+        config:    config,
+        queue:     queue,
+        artifacts: artifacts,
+        limiter:   newHostRateLimiter(config.Bulk),
+        logger:    log.New(logOutput, "[BULK] ", log.LstdFlags|log.Lshortfile),
+    }
+}
+
+// Run processes every repository that is not done or failed yet, until the
+// queue is drained or ctx is cancelled. Repositories interrupted by a crash
+// are left running and picked up again on the next run.
+func (b *BulkRunner) Run(ctx context.Context) (*BulkCheckpoint, error) {
+    b.started = time.Now()
+    maxAttempts := b.config.Bulk.MaxAttempts
+    every := b.config.Bulk.CheckpointEvery
+
+    // Each pass retries the repositories that failed in the previous one,
+    // until they succeed or run out of attempts
+    var err error
+    for retries := -1; retries != 0 && err == nil; {
+        retries = 0
+        err = b.queue.Each(func(repoURL string) error {
+            if ctx.Err() != nil {
+                return ctx.Err()
+            }
+            entry, found, err := b.queue.Entry(repoURL)
+            if err != nil {
+                return err
+            }
+            if !found || entry.Status == BulkDone || entry.Status == BulkFailed {
+                return nil
+            }
+
+            if err := b.limiter.Wait(ctx, providerHost(repoURL)); err != nil {
+                return err
+            }
+            // The current repository runs to completion when the run is
+            // interrupted, so the queue resumes after it
+            if b.process(context.WithoutCancel(ctx), entry, maxAttempts) == BulkQueued {
+                retries++
+            }
+
+            b.processed++
+            if every > 0 && b.processed%every == 0 {
+                if _, err := b.checkpoint(); err != nil {
+                    b.logger.Printf("Failed to write checkpoint: %v", err)
+                }
+            }
+            return nil
+        })
+    }
+    if errors.Is(err, context.Canceled) {
+        b.logger.Printf("Interrupted; the queue resumes where it stopped on the next run")
+        err = nil
+    }
+    if errors.Is(err, context.DeadlineExceeded) {
+        b.logger.Printf("Timed out; the queue resumes where it stopped on the next run")
+        err = nil
+    }
+
+    checkpoint, checkpointErr := b.checkpoint()
+    if err == nil {
+        err = checkpointErr
+    }
+    return checkpoint, err
+}
+
+// process runs one repository under ctx, persists its outcome, and returns
+// its new status
+func (b *BulkRunner) process(ctx context.Context, entry *BulkEntry, maxAttempts int) string {
+    entry.Status = BulkRunning
+    entry.Attempts++
+    if err := b.queue.Save(entry); err != nil {
+        b.logger.Printf("Failed to save queue entry for %s: %v", entry.URL, err)
+    }
+
+    b.logger.Printf("Processing %s (attempt %d/%d)", entry.URL, entry.Attempts, maxAttempts)
+    extractor := NewGitHubFunctionExtractor(b.config)
+    extractor.SetRunID(b.artifacts.RunID)
+    result, err := extractor.ProcessRepository(ctx, entry.URL)
+
+    if result != nil {
+        if writeErr := b.writeResult(entry.URL, result); writeErr != nil {
+            b.logger.Printf("Failed to write result for %s: %v", entry.URL, writeErr)
+        }
+    }
+
+    now := time.Now()
+    if err != nil {
+        b.logger.Printf("Failed to process %s: %v", entry.URL, err)
+        entry.LastError = err.Error()
+        entry.Status = BulkQueued
+        if entry.Attempts >= maxAttempts {
+            entry.Status = BulkFailed
+            entry.FinishedAt = &now
+        }
+    } else {
+        entry.Status = BulkDone
+        entry.LastError = ""
+        entry.Stats = ProcessingStats{TotalRepositories: 1}
+        entry.Stats.add(result)
+        entry.FinishedAt = &now
+        b.stats.add(result)
+    }
+    b.stats.TotalRepositories++
+    if err := b.queue.Save(entry); err != nil {
+        b.logger.Printf("Failed to save queue entry for %s: %v", entry.URL, err)
+    }
+    return entry.Status
+}
+
+// writeResult stores a repository's result in the run's artifacts
+func (b *BulkRunner) writeResult(repoURL string, result *ProcessingResult) error {
+    data, err := json.MarshalIndent(map[string]*ProcessingResult{repoURL: result}, "", "  ")
+    if err != nil {
+        return fmt.Errorf("failed to marshal result: %w", err)
+    }
+    path, err := b.artifacts.Path(filepath.Join("repositories", entryKey(repoURL)+".json"))
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+        return fmt.Errorf("failed to create results directory: %w", err)
+    }
+    return os.WriteFile(path, data, 0644)
+}
+
+// checkpoint logs the queue's progress and writes it to the run's artifacts
+func (b *BulkRunner) checkpoint() (*BulkCheckpoint, error) {
+    counts, err := b.queue.Counts()
+    if err != nil {
+        return nil, err
+    }
+    stats := b.stats
+    stats.ProcessingTimeMs = time.Since(b.started).Milliseconds()
+    checkpoint := &BulkCheckpoint{
+        Queue:     b.queue.Name,
+        RunID:     b.artifacts.RunID,
+        Time:      time.Now(),
+        Counts:    counts,
+        Processed: b.processed,
+        Stats:     stats,
+    }
+    if minutes := time.Since(b.started).Minutes(); minutes > 0 {
+        checkpoint.PerMinute = float64(b.processed) / minutes
+    }
+
+    b.logger.Printf("Checkpoint: %s", checkpoint)
+
+    data, err := json.MarshalIndent(checkpoint, "", "  ")
+    if err != nil {
+        return checkpoint, fmt.Errorf("failed to marshal checkpoint: %w", err)
+    }
+    path, err := b.artifacts.Path("bulk_checkpoint.json")
+    if err != nil {
+        return checkpoint, err
+    }
+    if err := os.WriteFile(path, data, 0644); err != nil {
+        return checkpoint, fmt.Errorf("failed to write checkpoint: %w", err)
+    }
+    return checkpoint, nil
+}
+
+// String formats the checkpoint as a one-line progress summary
+func (c *BulkCheckpoint) String() string {
+    statuses := make([]string, 0, len(c.Counts))
+    for status := range c.Counts {
+        statuses = append(statuses, status)
+    }
+    sort.Strings(statuses)
+    parts := make([]string, 0, len(statuses))
+    for _, status := range statuses {
+        parts = append(parts, fmt.Sprintf("%s=%d", status, c.Counts[status]))
+    }
+    summary := fmt.Sprintf("queue %s: %s", c.Queue, strings.Join(parts, " "))
+    if c.RunID == "" {
+        return summary
+    }
+    return fmt.Sprintf("%s; %d processed this run (%.1f/min), %d functions executed",
+        summary, c.Processed, c.PerMinute, c.Stats.TotalExecuted)
+}
+
+// RunBulk implements the bulk command: it adds repositories from the
+// arguments and an optional list file to the named queue, then works
+// through the queue until it is drained or ctx is cancelled
+func RunBulk(ctx context.Context, config Config, artifacts *RunArtifacts, args []string, out io.Writer) error {
+    fs := flag.NewFlagSet("bulk", flag.ContinueOnError)
+    name := fs.String("queue", "default", "name of the persistent queue")
+    listFile := fs.String("list", "", "file with repository URLs to add, one per line")
+    status := fs.Bool("status", false, "print the queue's progress and exit")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    state, err := NewStateStore(config.State.Dir)
+    if err != nil {
+        return err
+    }
+    queue, err := OpenBulkQueue(state, *name)
+    if err != nil {
+        return err
+    }
+
+    repositories := fs.Args()
+    if *listFile != "" {
+        listed, err := readRepositoryList(*listFile)
+        if err != nil {
+            return err
+        }
+        repositories = append(repositories, listed...)
+    }
+    added, err := queue.Add(repositories)
+    if err != nil {
+        return err
+    }
+    if added > 0 {
+        fmt.Fprintf(out, "Added %d repositories to queue %s\n", added, queue.Name)
+    }
+
+    if *status {
+        counts, err := queue.Counts()
+        if err != nil {
+            return err
+        }
+        fmt.Fprintln(out, (&BulkCheckpoint{Queue: queue.Name, Counts: counts}).String())
+        return nil
+    }
+
+    checkpoint, err := NewBulkRunner(config, queue, artifacts).Run(ctx)
+    if checkpoint != nil {
+        fmt.Fprintln(out, checkpoint.String())
+    }
+    return err
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+)
+
+// executionCacheBucket is the state store bucket holding cached outputs
+const executionCacheBucket = "executions"
+
+// cachedExecution is a stored function output
+type cachedExecution struct {
+    Value          interface{} `json:"value"`
+    Representation string      `json:"representation"`
+    CachedAt       time.Time   `json:"cached_at"`
+}
+
+// dependencyHash hashes the module files of a repository, so cached outputs
+// are invalidated whenever its dependencies change. Missing files hash as
+// empty, which keeps the hash stable for repositories without modules.
+func dependencyHash(repoPath string) string {
+    h := sha256.New()
+    for _, name := range []string{"go.mod", "go.sum"} {
+        data, _ := os.ReadFile(filepath.Join(repoPath, name))
+        h.Write([]byte(name))
+        h.Write(data)
+    }
+    return hex.EncodeToString(h.Sum(nil))
+}
+
+// packageSourceHash hashes the non-test Go files of a package directory,
+// so cached outputs are invalidated when a helper, type or constant the
+// function uses changes. Hashes are kept per directory for the repository.
+func (g *GitHubFunctionExtractor) packageSourceHash(dir string) string {
+    if hash, ok := g.packageHashes[dir]; ok {
+        return hash
+    }
+    h := sha256.New()
+    entries, _ := os.ReadDir(dir)
+    for _, entry := range entries {
+        name := entry.Name()
+        if !entry.Type().IsRegular() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+            continue
+        }
+        data, _ := os.ReadFile(filepath.Join(dir, name))
+        h.Write([]byte(name + "\x00"))
+        h.Write(data)
+    }
+    hash := hex.EncodeToString(h.Sum(nil))
+    if g.packageHashes == nil {
+        g.packageHashes = make(map[string]string)
+    }
+    g.packageHashes[dir] = hash
+    return hash
+}
+
+// executionCacheKey identifies one execution of a function: its
+// repository and module, its source and its package's, the repository's
+// dependencies, and the call arguments
+func (g *GitHubFunctionExtractor) executionCacheKey(function FunctionInfo, args []string) string {
+    h := sha256.New()
+    h.Write([]byte(g.repoURL + "\x00" + g.modulePath + "\x00"))
+    h.Write([]byte(function.RelativePath + "\x00" + function.Name + "\x00"))
+    h.Write([]byte(function.SourceHash + "\x00" + g.packageSourceHash(filepath.Dir(function.FilePath)) + "\x00"))
+    h.Write([]byte(g.depsHash + "\x00"))
+    h.Write([]byte(strings.Join(args, "\x00")))
+    return hex.EncodeToString(h.Sum(nil))
+}
+
+// cachedRun executes a function through the read-through execution cache.
+// Only successful executions are cached.
+func (g *GitHubFunctionExtractor) cachedRun(ctx context.Context, function FunctionInfo, args []string) (*ExecutionOutput, error) {
+    if g.state == nil || !g.execConfig.Cache || function.SourceHash == "" {
+        return g.runFunction(ctx, function, args, "")
+    }
+
+    key := g.executionCacheKey(function, args)
+    var entry cachedExecution
+    found, err := g.state.Get(executionCacheBucket, key, &entry)
+    if err != nil {
+        g.logger.Printf("Execution cache: %v", err)
+    }
+    if found {
+        g.cacheHits++
+        return &ExecutionOutput{Value: entry.Value, Representation: entry.Representation}, nil
+    }
+
+    g.cacheMisses++
+    output, err := g.runFunction(ctx, function, args, "")
+    if err != nil {
+        return nil, err
+    }
+
+    entry = cachedExecution{
+        Value:          output.Value,
+        Representation: output.Representation,
+        CachedAt:       time.Now(),
+    }
+    if err := g.state.Put(executionCacheBucket, key, entry); err != nil {
+        g.logger.Printf("Execution cache: %v", err)
+    }
+    return output, nil
+}
+
+// extractionCacheBucket is the state store bucket holding extracted files
+const extractionCacheBucket = "extractions"
+
+// extractionCacheVersion is part of every extraction cache key; bump it
+// when the extracted FunctionInfo changes so stale entries are not reused
+const extractionCacheVersion = 1
+
+// cachedExtraction is the stored extraction of a file. Functions are kept
+// without their absolute FilePath, which differs between clones.
+type cachedExtraction struct {
+    Package   string         `json:"package"`
+    Functions []FunctionInfo `json:"functions"`
+    Skipped   []SkippedDecl  `json:"skipped,omitempty"`
+    CachedAt  time.Time      `json:"cached_at"`
+}
+
+// extractionCacheKey identifies the extraction of a file: its content and
+// path, and the module path, extraction settings and ignore rules the
+// extracted functions depend on
+func (g *GitHubFunctionExtractor) extractionCacheKey(relPath string, src []byte) string {
+    h := sha256.New()
+    fmt.Fprintf(h, "%d\x00%s\x00%s\x00%t\x00%t\x00", extractionCacheVersion, relPath, g.modulePath,
+        g.extractConfig.FuncVariables, g.extractConfig.Closures)
+    rules, _ := json.Marshal(g.ignore.Rules())
+    h.Write(rules)
+    h.Write(src)
+    return hex.EncodeToString(h.Sum(nil))
+}
+
+// cachedExtractFile extracts a file through the read-through extraction
+// cache. Only files that parse cleanly are cached, so files with syntax
+// errors keep reporting their diagnostics.
+func (g *GitHubFunctionExtractor) cachedExtractFile(filePath string, report *FileReport) ([]FunctionInfo, error) {
+    if g.state == nil || !g.extractConfig.Cache {
+        return g.extractFile(filePath, report)
+    }
+    src, err := os.ReadFile(filePath)
+    if err != nil {
+        return g.extractFile(filePath, report)
+    }
+
+    key := g.extractionCacheKey(g.relativePath(filePath), src)
+    var entry cachedExtraction
+    found, err := g.state.Get(extractionCacheBucket, key, &entry)
+    if err != nil {
+        g.logger.Printf("Extraction cache: %v", err)
+    }
+    if found {
+        g.extractionHits++
+        report.Package = entry.Package
+        report.Skipped = append(report.Skipped, entry.Skipped...)
+        for i := range entry.Functions {
+            entry.Functions[i].FilePath = filePath
+        }
+        return entry.Functions, nil
+    }
+
+    g.extractionMisses++
+    functions, err := g.extractFile(filePath, report)
+    if err != nil {
+        return functions, err
+    }
+
+    entry = cachedExtraction{
+        Package:   report.Package,
+        Functions: make([]FunctionInfo, len(functions)),
+        Skipped:   report.Skipped,
+        CachedAt:  time.Now(),
+    }
+    for i, function := range functions {
+        function.FilePath = ""
+        entry.Functions[i] = function
+    }
+    if err := g.state.Put(extractionCacheBucket, key, entry); err != nil {
+        g.logger.Printf("Extraction cache: %v", err)
+    }
+    return functions, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path"
+    "sort"
+    "strings"
+)
+
+// maxOutputSampleLines caps the example output kept per function for the
+// markdown catalog
+const maxOutputSampleLines = 20
+
+// outputSample renders the beginning of a function's output as indented
+// JSON for the catalog
+func outputSample(data interface{}) string {
+    encoded, err := json.MarshalIndent(data, "", "  ")
+    if err != nil {
+        return fmt.Sprintf("%v", data)
+    }
+    lines := strings.Split(string(encoded), "\n")
+    if len(lines) > maxOutputSampleLines {
+        lines = append(lines[:maxOutputSampleLines], "…")
+    }
+    return strings.Join(lines, "\n")
+}
+
+// SaveMarkdownCatalog writes a repository's function catalog: one section
+// per package listing each function's signature, doc comment, and example
+// output when the function was executed
+func SaveMarkdownCatalog(filename, repoURL string, result *ProcessingResult) error {
+    file, err := os.Create(filename)
+    if err != nil {
+        return fmt.Errorf("failed to create catalog file: %w", err)
+    }
+    defer file.Close()
+
+    w := bufio.NewWriter(file)
+    writeMarkdownCatalog(w, repoURL, result)
+    if err := w.Flush(); err != nil {
+        return fmt.Errorf("failed to write catalog: %w", err)
+    }
+    return nil
+}
+
+// writeMarkdownCatalog renders the catalog of a repository
+func writeMarkdownCatalog(w *bufio.Writer, repoURL string, result *ProcessingResult) {
+    packages := make(map[string][]FunctionInfo)
+    for _, function := range result.ProcessedFunctions {
+        importPath := packageImportPath(result.ModulePath, path.Dir(function.RelativePath))
+        packages[importPath] = append(packages[importPath], function)
+    }
+    var importPaths []string
+    for importPath := range packages {
+        importPaths = append(importPaths, importPath)
+    }
+    sort.Strings(importPaths)
+
+    executed := make(map[string]bool)
+    for _, name := range result.ExecutedFunctions {
+        executed[name] = true
+    }
+
+    fmt.Fprintf(w, "# %s\n\n", repoURL)
+    if result.Ref != "" {
+        fmt.Fprintf(w, "Ref `%s` (%s).\n\n", result.Ref, result.Commit)
+    }
+    fmt.Fprintf(w, "%d functions in %d packages, %d executed.\n\n",
+        len(result.ProcessedFunctions), len(importPaths), len(result.ExecutedFunctions))
+
+    fmt.Fprintln(w, "## Packages")
+    fmt.Fprintln(w)
+    for _, importPath := range importPaths {
+        fmt.Fprintf(w, "- [%s](#%s) (%d)\n", importPath, markdownAnchor(importPath), len(packages[importPath]))
+    }
+
+    for _, importPath := range importPaths {
+        functions := packages[importPath]
+        sort.Slice(functions, func(i, j int) bool {
+            if functions[i].RelativePath != functions[j].RelativePath {
+                return functions[i].RelativePath < functions[j].RelativePath
+            }
+            return functions[i].LineNumber < functions[j].LineNumber
+        })
+
+        fmt.Fprintf(w, "\n## %s\n", importPath)
+        for _, function := range functions {
+            fmt.Fprintf(w, "\n### %s\n\n", function.Name)
+            fmt.Fprintf(w, "```go\n%s\n```\n\n", functionSignature(function))
+            fmt.Fprintf(w, "`%s:%d`", function.RelativePath, function.LineNumber)
+            if function.Class != "" {
+                fmt.Fprintf(w, " · %s", function.Class)
+            }
+            if stability, ok := result.Stability[function.Name]; ok {
+                fmt.Fprintf(w, " · %s (%.0f%% of %d runs)", stability.Status, stability.Score*100, stability.Runs)
+            }
+            fmt.Fprintln(w)
+
+            if doc := function.docComment(); doc != nil && doc.Deprecated != "" {
+                fmt.Fprintf(w, "\n> **Deprecated:** %s\n", doc.Deprecated)
+            }
+            if doc := strings.TrimSpace(function.Comment); doc != "" {
+                fmt.Fprintf(w, "\n%s\n", doc)
+            }
+
+            for _, example := range function.Examples {
+                fmt.Fprintf(w, "\nUsage in `%s:%d`:\n\n```go\n%s\n```\n", example.File, example.Line, example.Snippet)
+            }
+
+            if sample, ok := result.OutputSamples[function.Name]; ok {
+                fmt.Fprintf(w, "\nExample output:\n\n```json\n%s\n```\n", sample)
+            } else if executed[function.Name] {
+                fmt.Fprintln(w, "\nExecuted; no output captured.")
+            }
+        }
+    }
+
+    // Embedded Go is listed apart since it is neither built nor executed
+    if len(result.EmbeddedFunctions) > 0 {
+        fmt.Fprintln(w, "\n## Embedded Go")
+        fmt.Fprintln(w)
+        fmt.Fprintln(w, "| Function | Source | Location |")
+        fmt.Fprintln(w, "|----------|--------|----------|")
+        for _, function := range result.EmbeddedFunctions {
+            fmt.Fprintf(w, "| `%s` | %s | `%s:%d` |\n", strings.ReplaceAll(functionSignature(function), "|", "\\|"),
+                function.SourceKind, function.RelativePath, function.LineNumber)
+        }
+    }
+}
+
+// markdownAnchor returns the anchor GitHub generates for a heading
+func markdownAnchor(heading string) string {
+    return strings.Map(func(r rune) rune {
+        switch {
+        case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+            return r
+        case r >= 'A' && r <= 'Z':
+            return r + ('a' - 'A')
+        case r == ' ':
+            return '-'
+        }
+        return -1
+    }, heading)
+}
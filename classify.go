@@ -0,0 +1,107 @@
+package main
+
+import (
+    "strings"
+)
+
+// Function classes assigned by classifyFunction
+const (
+    ClassConstructor = "constructor"
+    ClassGetter      = "getter"
+    ClassLoader      = "loader" // reads, parses, or produces data
+    ClassValidator   = "validator"
+    ClassHandler     = "handler"
+    ClassCommand     = "command"
+    ClassOther       = "other"
+)
+
+// functionClasses lists every class, for validating configuration
+var functionClasses = []string{
+    ClassConstructor, ClassGetter, ClassLoader, ClassValidator, ClassHandler, ClassCommand, ClassOther,
+}
+
+// Name prefixes that suggest a class. A prefix only matches at a word
+// boundary, so "Newsletter" is not a constructor.
+var (
+    constructorPrefixes = []string{"New", "Make", "Create", "Build"}
+    getterPrefixes      = []string{"Get", "Is", "Has", "Default", "Current"}
+    loaderPrefixes      = []string{"Load", "Read", "Fetch", "List", "Parse", "Query", "Find", "Scan", "Open"}
+    validatorPrefixes   = []string{"Validate", "Check", "Verify", "Must", "Ensure"}
+    commandPrefixes     = []string{"Run", "Start", "Stop", "Delete", "Remove", "Write", "Save", "Send", "Exec", "Set", "Update", "Install", "Register", "Init", "Close", "Reset", "Publish"}
+)
+
+// classifyFunction guesses the role of a function from its name and
+// signature. Handlers are recognized first since their signature is
+// unambiguous, then name prefixes, then the shape of the signature.
+func classifyFunction(function FunctionInfo) string {
+    name := function.Name
+    if i := strings.LastIndex(name, "."); i >= 0 {
+        name = name[i+1:]
+    }
+
+    for _, param := range function.Parameters {
+        if paramType := parameterType(param); paramType == "http.ResponseWriter" || paramType == "*http.Request" {
+            return ClassHandler
+        }
+    }
+    if strings.HasSuffix(name, "Handler") || strings.HasPrefix(name, "Handle") || strings.HasPrefix(name, "Serve") {
+        return ClassHandler
+    }
+
+    returnsData := false
+    returnsOnlyError := len(function.ReturnTypes) > 0
+    for _, returnType := range function.ReturnTypes {
+        if returnType != "error" {
+            returnsData = true
+            returnsOnlyError = false
+        }
+    }
+
+    switch {
+    case hasWordPrefix(name, validatorPrefixes) && (returnsOnlyError || onlyReturns(function, "bool")):
+        return ClassValidator
+    case hasWordPrefix(name, constructorPrefixes) && returnsData:
+        return ClassConstructor
+    case hasWordPrefix(name, loaderPrefixes) && returnsData:
+        return ClassLoader
+    case hasWordPrefix(name, getterPrefixes) && returnsData && len(function.Parameters) == 0:
+        return ClassGetter
+    case hasWordPrefix(name, commandPrefixes), !returnsData:
+        // Nothing is returned, so calling it is only useful for its effects
+        return ClassCommand
+    case classifySafety(function).Level == SafetyHigh:
+        return ClassCommand
+    case len(function.Parameters) == 0:
+        // Produces data without input, like a loader of fixed data
+        return ClassLoader
+    }
+    return ClassOther
+}
+
+// hasWordPrefix reports whether name starts with one of the prefixes
+// followed by the end of the name or an upper-case letter
+func hasWordPrefix(name string, prefixes []string) bool {
+    for _, prefix := range prefixes {
+        if !strings.HasPrefix(name, prefix) {
+            continue
+        }
+        rest := name[len(prefix):]
+        if rest == "" || (rest[0] >= 'A' && rest[0] <= 'Z') || (rest[0] >= '0' && rest[0] <= '9') || rest[0] == '_' {
+            return true
+        }
+    }
+    return false
+}
+
+// onlyReturns reports whether a function returns exactly the given type
+func onlyReturns(function FunctionInfo, returnType string) bool {
+    return len(function.ReturnTypes) == 1 && function.ReturnTypes[0] == returnType
+}
+
+// classAllowed applies the execution policy's class filters
+func classAllowed(config ExecutionConfig, class string) bool {
+    if len(config.OnlyClasses) > 0 && !containsString(config.OnlyClasses, class) {
+        return false
+    }
+    return !containsString(config.SkipClasses, class)
+}
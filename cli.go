@@ -0,0 +1,174 @@
+package main
+
+import (
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+)
+
+// commandsUsage lists the subcommands for the usage message
+const commandsUsage = `Usage: floq-v1 [flags] [command] [arguments]
+
+Commands:
+  process <repo>...   process repositories (URLs or local directories); the default
+                      when the arguments are repositories
+  summary             print the summary of the latest or a given run
+  config              print the effective configuration with secrets redacted
+  report org          aggregate the run history into org-wide trends
+  find                search the functions of a previous run
+  query               read generated tables
+  prune               delete old data from the database
+  api-diff            compare the exported API of two refs
+  validate-repos      check that repositories can be processed
+  storage-check       run conformance checks against the storage driver
+  bulk                work through a persistent repository queue
+  seed                write test fixtures instead of filling the database
+  serve               run the long-lived service
+  doctor              check the environment
+  version             print the build metadata
+  self-update         install the latest release
+
+Run "floq-v1 <command> -h" for the flags of a command. Flags of processing
+runs may follow "process".
+
+Flags:
+`
+
+// usage prints the commands and the global flags
+func usage() {
+    fmt.Fprint(flag.CommandLine.Output(), commandsUsage)
+    flag.PrintDefaults()
+}
+
+// RunSummary implements the summary subcommand, printing the summary of a
+// previous run as it was printed at the end of the run
+func RunSummary(config Config, args []string, out io.Writer) error {
+    fs := flag.NewFlagSet("summary", flag.ContinueOnError)
+    run := fs.String("run", "", "run id to summarize instead of the latest run")
+    resultsFile := fs.String("results", "", "results file to summarize instead of the latest run")
+    asJSON := fs.Bool("json", false, "print the aggregate statistics as JSON")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    filename := *resultsFile
+    var err error
+    switch {
+    case filename != "":
+    case *run != "":
+        artifacts, err := OpenRunArtifacts(config.Artifacts, *run)
+        if err != nil {
+            return err
+        }
+        if filename, err = artifacts.ResultsPath(); err != nil {
+            return err
+        }
+    default:
+        if filename, err = latestResultsPath(config.Artifacts); err != nil {
+            return err
+        }
+    }
+
+    results, err := LoadResultsFile(filename)
+    if err != nil {
+        return err
+    }
+    if *asJSON {
+        encoder := json.NewEncoder(out)
+        encoder.SetIndent("", "  ")
+        return encoder.Encode(results.Summary)
+    }
+    runFromResults(results).WriteSummary(out)
+    return nil
+}
+
+// runFromResults rebuilds a finished run from its results file
+func runFromResults(results *RunResults) *Run {
+    run := newRun(results.RunID)
+    run.RetryOf = results.RetryOf
+    run.postRun = results.PostRun
+
+    repositories := make([]string, 0, len(results.Results))
+    for repoURL, result := range results.Results {
+        if result != nil {
+            repositories = append(repositories, repoURL)
+        }
+    }
+    sort.Strings(repositories)
+    for _, repoURL := range repositories {
+        result := results.Results[repoURL]
+        run.record(repoURL, result, !repositoryFailed(result))
+    }
+    if results.Aborted {
+        run.abort(results.Pending, results.TimedOut)
+    }
+
+    // The totals are those of the run, not of rebuilding it
+    run.repositories = results.Summary.TotalRepositories
+    run.processingTimeMs = results.Summary.ProcessingTimeMs
+    return run
+}
+
+// RunConfig implements the config subcommand, printing the configuration a
+// run would use after every layer was applied, with secrets redacted
+func RunConfig(config Config, args []string, out io.Writer) error {
+    fs := flag.NewFlagSet("config", flag.ContinueOnError)
+    validate := fs.Bool("validate", false, "also validate the configuration")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+    if *validate {
+        if err := ValidateConfig(config); err != nil {
+            return fmt.Errorf("invalid configuration: %w", err)
+        }
+    }
+
+    data, err := json.Marshal(config)
+    if err != nil {
+        return fmt.Errorf("failed to marshal config: %w", err)
+    }
+    var document interface{}
+    if err := json.Unmarshal(data, &document); err != nil {
+        return fmt.Errorf("failed to marshal config: %w", err)
+    }
+    encoder := json.NewEncoder(out)
+    encoder.SetIndent("", "  ")
+    return encoder.Encode(redactSecrets(document))
+}
+
+// secretKeys are the parts of configuration keys whose values are secrets
+var secretKeys = []string{"password", "token", "secret", "dsn", "headers"}
+
+// redactSecrets replaces the non-empty values of secret keys in a decoded
+// JSON document
+func redactSecrets(value interface{}) interface{} {
+    switch value := value.(type) {
+    case map[string]interface{}:
+        for key, field := range value {
+            if isSecretKey(key) && field != nil && field != "" {
+                value[key] = "[redacted]"
+                continue
+            }
+            value[key] = redactSecrets(field)
+        }
+    case []interface{}:
+        for i := range value {
+            value[i] = redactSecrets(value[i])
+        }
+    }
+    return value
+}
+
+// isSecretKey reports whether a configuration key holds a secret
+func isSecretKey(key string) bool {
+    key = strings.ToLower(key)
+    for _, secret := range secretKeys {
+        if strings.Contains(key, secret) {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,9 @@
+package main
+
+// columnMappingsSchema records which column each original JSON key was stored in
+const columnMappingsSchema = `CREATE TABLE IF NOT EXISTS floq_column_mappings (
+    table_name   TEXT NOT NULL,
+    original_key TEXT NOT NULL,
+    column_name  TEXT NOT NULL,
+    PRIMARY KEY (table_name, original_key)
+)`
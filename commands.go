@@ -0,0 +1,209 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "go/ast"
+    "go/parser"
+    "go/token"
+    "os"
+    "path"
+    "path/filepath"
+    "runtime"
+    "strings"
+    "unicode"
+)
+
+// CommandsConfig enables running the repository's main packages, such as
+// cmd/x binaries, to capture what they print
+type CommandsConfig struct {
+    // Enabled builds every main package and runs it once per argument set
+    Enabled bool `json:"enabled,omitempty"`
+    // Args are the argument sets each command runs with. Only arguments
+    // that make a command print something and exit, such as
+    // ["--dump-config"] or ["version", "--json"], belong here.
+    Args [][]string `json:"args,omitempty"`
+    // Packages overrides Args for main packages by directory, e.g.
+    // {"cmd/server": [["config", "dump"]]}; an empty list skips the package
+    Packages map[string][][]string `json:"packages,omitempty"`
+}
+
+// argSets returns the argument sets the main package in dir runs with
+func (c CommandsConfig) argSets(dir string) [][]string {
+    if sets, ok := c.Packages[dir]; ok {
+        return sets
+    }
+    return c.Args
+}
+
+// CommandRun records a main package run with one argument set
+type CommandRun struct {
+    // Package is the directory of the main package
+    Package string   `json:"package"`
+    Args    []string `json:"args"`
+    // Function is the name the output is stored under
+    Function       string `json:"function"`
+    Representation string `json:"representation,omitempty"`
+    Error          string `json:"error,omitempty"`
+}
+
+// runCommands builds the repository's main packages and runs each with its
+// argument sets, storing what they print to standard output like a
+// function's output. It stops early when interrupted or when the error cap
+// is reached.
+func (g *GitHubFunctionExtractor) runCommands(ctx context.Context, goFiles []string, result *ProcessingResult) error {
+    for _, pkg := range result.Packages {
+        sets := g.execConfig.Commands.argSets(pkg.Dir)
+        if pkg.Name != "main" || len(sets) == 0 {
+            continue
+        }
+        if pkg.Unsupported != "" {
+            g.logger.Printf("Skipping command %s: %s", pkg.Dir, pkg.Unsupported)
+            continue
+        }
+        entry, ok := g.commandMain(pkg.Dir, goFiles)
+        if !ok {
+            continue
+        }
+        if err := g.runCommand(ctx, entry, pkg.Dir, sets, result); err != nil {
+            return err
+        }
+        if g.errorCapReached(result, "", 0) {
+            return nil
+        }
+    }
+    return nil
+}
+
+// runCommand builds one main package and runs it with every argument set
+func (g *GitHubFunctionExtractor) runCommand(ctx context.Context, entry FunctionInfo, dir string, sets [][]string, result *ProcessingResult) error {
+    runs := make([]CommandRun, len(sets))
+    for i, args := range sets {
+        runs[i] = CommandRun{Package: dir, Args: args, Function: commandName(g.modulePath, dir, args)}
+    }
+    defer func() { result.Commands = append(result.Commands, runs...) }()
+
+    binary, cleanup, err := g.buildCommand(ctx, dir)
+    if err != nil {
+        result.Errors = append(result.Errors,
+            g.functionError(entry, "Failed to build command %s: %v", dir, err))
+        for i := range runs {
+            runs[i].Error = err.Error()
+        }
+        return nil
+    }
+    defer cleanup()
+
+    for i, args := range sets {
+        if ctx.Err() != nil {
+            return errInterrupted
+        }
+        g.reportProgress("running %s %s", dir, strings.Join(args, " "))
+        function := entry
+        function.Name = runs[i].Function
+
+        stopExecute := g.phases.track(PhaseExecute)
+        stdout, err := g.runBinary(ctx, function.Name, binary, args)
+        stopExecute()
+        if err != nil {
+            runs[i].Error = err.Error()
+            result.Errors = append(result.Errors,
+                g.functionError(function, "Failed to run command %s %s: %v", dir, strings.Join(args, " "), err))
+            continue
+        }
+        output := parseCommandOutput(stdout)
+        runs[i].Representation = output.Representation
+        g.recordOutput(ctx, function, output, result)
+    }
+    return nil
+}
+
+// buildCommand builds the main package in dir, returning the binary and
+// the function removing it
+func (g *GitHubFunctionExtractor) buildCommand(ctx context.Context, dir string) (string, func(), error) {
+    stopExecute := g.phases.track(PhaseExecute)
+    defer stopExecute()
+
+    buildDir, err := os.MkdirTemp(g.repoPath, runnerDirPrefix+"*")
+    if err != nil {
+        return "", nil, fmt.Errorf("failed to create build directory: %w", err)
+    }
+    cleanup := func() { os.RemoveAll(buildDir) }
+
+    binary := filepath.Join(buildDir, "command")
+    if runtime.GOOS == "windows" {
+        binary += ".exe"
+    }
+    build := g.toolchainCommand(ctx, "", "build", "-o", binary, "./"+dir)
+    if out, err := build.CombinedOutput(); err != nil {
+        cleanup()
+        return "", nil, g.locateErr(fmt.Errorf("%w: %s", err, lastLine(out)), out)
+    }
+    return binary, cleanup, nil
+}
+
+// commandMain finds the main function of the main package in dir, which
+// the runs of the command are attributed to
+func (g *GitHubFunctionExtractor) commandMain(dir string, goFiles []string) (FunctionInfo, bool) {
+    fset := token.NewFileSet()
+    for _, filePath := range goFiles {
+        relPath := g.relativePath(filePath)
+        if path.Dir(relPath) != dir || buildExclusion(filePath) != "" {
+            continue
+        }
+        file, err := parser.ParseFile(fset, filePath, nil, parser.SkipObjectResolution)
+        if err != nil {
+            continue
+        }
+        for _, decl := range file.Decls {
+            funcDecl, ok := decl.(*ast.FuncDecl)
+            if !ok || funcDecl.Recv != nil || funcDecl.Name.Name != "main" {
+                continue
+            }
+            pos := fset.Position(funcDecl.Name.Pos())
+            return FunctionInfo{
+                Name:         "main",
+                Kind:         FunctionKindCommand,
+                Class:        ClassCommand,
+                FilePath:     filePath,
+                RelativePath: relPath,
+                PackageName:  "main",
+                LineNumber:   pos.Line,
+                Column:       pos.Column,
+                Comment:      funcDecl.Doc.Text(),
+            }, true
+        }
+    }
+    g.logger.Printf("Skipping command %s: no main function", dir)
+    return FunctionInfo{}, false
+}
+
+// commandName names the output of a command run after the command and
+// its arguments, e.g. "server_dump_config" for cmd/server --dump-config
+func commandName(modulePath, dir string, args []string) string {
+    name := path.Base(dir)
+    if dir == "." {
+        name = path.Base(modulePath)
+    }
+    words := []string{name}
+    for _, arg := range args {
+        words = append(words, strings.FieldsFunc(arg, func(r rune) bool {
+            return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+        })...)
+    }
+    return strings.Join(words, "_")
+}
+
+// parseCommandOutput decodes what a command printed: JSON is kept as
+// structured data, anything else as the raw text
+func parseCommandOutput(stdout []byte) *ExecutionOutput {
+    var value interface{}
+    if err := json.Unmarshal(stdout, &value); err == nil {
+        return &ExecutionOutput{Value: value, Representation: RepresentationJSON}
+    }
+    return &ExecutionOutput{
+        Value:          strings.TrimSpace(string(stdout)),
+        Representation: RepresentationRawOutput,
+    }
+}
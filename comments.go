@@ -0,0 +1,66 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "strings"
+)
+
+// maxCommentExcerpt bounds the doc comment excerpt stored in table comments
+const maxCommentExcerpt = 300
+
+// tableComment describes where a generated table's data came from
+func (g *GitHubFunctionExtractor) tableComment(function FunctionInfo) string {
+    lines := []string{
+        "Generated by floq-v1",
+        "Repository: " + g.repoURL,
+        fmt.Sprintf("Function: %s.%s", function.PackageName, functionSignature(function)),
+        fmt.Sprintf("Source: %s:%d", function.RelativePath, function.LineNumber),
+    }
+    if g.ref != nil {
+        lines = append(lines, fmt.Sprintf("Ref: %s (%s)", g.ref.Name, g.ref.Commit))
+    }
+    if schema := function.PredictedSchema; schema != nil && schema.Struct != "" {
+        lines = append(lines, "Struct: "+schema.Struct)
+    }
+    if function.Class != "" {
+        lines = append(lines, "Class: "+function.Class)
+    }
+    if g.runID != "" {
+        lines = append(lines, "Run: "+g.runID)
+    }
+    if excerpt := docExcerpt(function.Comment); excerpt != "" {
+        lines = append(lines, "Doc: "+excerpt)
+    }
+    return strings.Join(lines, "\n")
+}
+
+// docExcerpt returns the first paragraph of a doc comment, truncated
+func docExcerpt(comment string) string {
+    paragraph := strings.TrimSpace(comment)
+    if i := strings.Index(paragraph, "\n\n"); i >= 0 {
+        paragraph = paragraph[:i]
+    }
+    paragraph = strings.Join(strings.Fields(paragraph), " ")
+    if len(paragraph) > maxCommentExcerpt {
+        paragraph = strings.TrimSpace(paragraph[:maxCommentExcerpt]) + "…"
+    }
+    return paragraph
+}
+
+// commentOnTable attaches provenance metadata to a generated table, and the
+// original output key to each of its data columns, along with the struct
+// field the key was predicted to come from
+func (g *GitHubFunctionExtractor) commentOnTable(ctx context.Context, tableName string, function FunctionInfo, mapping *ColumnMapping) error {
+    columnComments := make(map[string]string)
+    if mapping != nil {
+        for _, key := range mapping.Keys {
+            comment := fmt.Sprintf("Output key %q of %s", key, function.Name)
+            if column, ok := function.PredictedSchema.column(key); ok && column.Field != "" {
+                comment += fmt.Sprintf(", from field %s %s", column.Field, column.GoType)
+            }
+            columnComments[mapping.Columns[key]] = comment
+        }
+    }
+    return g.storage.CommentOnTable(ctx, tableName, g.tableComment(function), columnComments)
+}
@@ -4,33 +4,455 @@ import (
     "encoding/json"
     "fmt"
     "os"
+    "os/exec"
+    "path/filepath"
+    "strconv"
+    "strings"
 )
 
 // DatabaseConfig holds database connection configuration
 type DatabaseConfig struct {
+    // Driver selects the storage: "postgres" (default), "memory", which
+    // keeps tables in memory for dry runs, or "sql", which writes the
+    // statements to a .sql file per repository instead of executing them
+    Driver   string `json:"driver,omitempty"`
     Host     string `json:"host"`
     Port     string `json:"port"`
     Database string `json:"database"`
     User     string `json:"user"`
     Password string `json:"password"`
     SSLMode  string `json:"sslmode"`
+    // Hosts lists the servers of a primary and its warm standbys
+    // ("host" or "host:port"), tried in order in place of Host and Port;
+    // connections fail over to whichever satisfies TargetSessionAttrs
+    Hosts              []string `json:"hosts,omitempty"`
+    // TargetSessionAttrs is "read-write" (default with several hosts),
+    // which only accepts a writable primary, or "any"
+    TargetSessionAttrs string   `json:"target_session_attrs,omitempty"`
+    // DedupPayloads stores outputs content-addressed in floq_payloads,
+    // referenced from floq_function_outputs, instead of one table each
+    DedupPayloads bool `json:"dedup_payloads,omitempty"`
+    // MaxPayloadRows truncates array outputs to their first rows before
+    // they are stored; zero stores them whole
+    MaxPayloadRows int `json:"max_payload_rows,omitempty"`
+    // Flatten expands objects nested in outputs into columns
+    Flatten FlattenConfig `json:"flatten,omitempty"`
+    // PayloadStats records summary statistics of every whole output in
+    // payload_stats
+    PayloadStats bool `json:"payload_stats,omitempty"`
+    // Signatures records the parameters and results of every extracted
+    // function in function_signatures, one row each
+    Signatures bool `json:"signatures,omitempty"`
+    // DumpDir is where the sql driver writes its files (default: sql in
+    // the run's artifacts directory)
+    DumpDir       string `json:"dump_dir,omitempty"`
+    // DumpSchema makes the sql driver's files create and target this
+    // schema instead of the loading session's search path
+    DumpSchema    string `json:"dump_schema,omitempty"`
+    // Partitioning partitions the fixed high-volume tables (floq_jobs and
+    // floq_function_outputs) when they are created: "none" (default),
+    // "run_date" by range of creation time, or "repository" by hash
+    Partitioning      string `json:"partitioning,omitempty"`
+    // PartitionInterval is the run_date partition width: "month"
+    // (default) or "day"
+    PartitionInterval string `json:"partition_interval,omitempty"`
+    // PartitionCount is the number of repository hash partitions
+    // (default 8)
+    PartitionCount    int    `json:"partition_count,omitempty"`
+    // Shards spreads the generated tables over several databases by hash
+    // of the repository URL; floq_shards in this database records where
+    // each repository went
+    Shards []ShardConfig `json:"shards,omitempty"`
+    // ReplicaDSN is a lib/pq connection string or URL of a read replica
+    // serving read-only operations in place of the primary
+    ReplicaDSN string `json:"replica_dsn,omitempty"`
 }
 
-// LoadConfigFromEnv loads database configuration from environment variables
-func LoadConfigFromEnv() DatabaseConfig {
-    return DatabaseConfig{
-        Host:     getEnv("DB_HOST", "localhost"),
-        Port:     getEnv("DB_PORT", "5432"),
-        Database: getEnv("DB_NAME", "postgres"),
-        User:     getEnv("DB_USER", "postgres"),
-        Password: getEnv("DB_PASSWORD", ""),
-        SSLMode:  getEnv("DB_SSLMODE", "disable"),
+// ExecutionConfig controls how extracted functions are executed
+type ExecutionConfig struct {
+    // FuzzArguments enables the experimental argument fuzzing mode for
+    // functions that take parameters
+    FuzzArguments bool     `json:"fuzz_arguments"`
+    // MaxFuzzCases caps the number of invocations generated per function
+    MaxFuzzCases  int      `json:"max_fuzz_cases"`
+    // Cache reuses stored outputs of functions whose source and module
+    // dependencies are unchanged since a previous run
+    Cache         bool     `json:"cache"`
+    // Interactive asks for approval before every execution; it requires a
+    // terminal and is rejected in service mode
+    Interactive   bool     `json:"interactive"`
+    // GoProxy overrides GOPROXY for go commands run in repositories, e.g.
+    // a file:// proxy of vendored modules for offline synthetic modules
+    GoProxy       string   `json:"go_proxy,omitempty"`
+    // SkipClasses and OnlyClasses filter executions by function class
+    // (constructor, getter, loader, validator, handler, command, other)
+    SkipClasses   []string `json:"skip_classes,omitempty"`
+    OnlyClasses   []string `json:"only_classes,omitempty"`
+    // Sandbox isolates executed functions: "auto" (default) runs them in a
+    // network namespace where the host supports it, "netns" requires one,
+    // and "none" disables isolation
+    Sandbox       string   `json:"sandbox,omitempty"`
+    // Toolchains enables matrix mode: every function is also executed
+    // under each listed toolchain (a GOTOOLCHAIN value such as go1.22.5, or
+    // the path to a go binary) and the outputs are compared
+    Toolchains    []string `json:"toolchains,omitempty"`
+    // Timeout (seconds) and MemoryLimitMB bound every execution; zero
+    // means unlimited
+    Timeout       int      `json:"timeout,omitempty"`
+    MemoryLimitMB int      `json:"memory_limit_mb,omitempty"`
+    // RunTimeout (seconds) bounds the whole run: once it passes, the run
+    // stops as if interrupted and exits with code 124; zero means unlimited
+    RunTimeout int `json:"run_timeout,omitempty"`
+    // RetryResourceFailures retries executions that ran out of time or
+    // memory once at the end of the repository, with the limits multiplied
+    // by RetryFactor (default 2)
+    RetryResourceFailures bool `json:"retry_resource_failures,omitempty"`
+    RetryFactor           int  `json:"retry_factor,omitempty"`
+    // MockInterfaces executes functions whose only parameter is a small
+    // interface of the repository with a generated no-op implementation of
+    // it, as long as it has at most MaxMockMethods (default 8) methods
+    MockInterfaces bool `json:"mock_interfaces,omitempty"`
+    // AutoArguments executes functions whose parameters are all contexts or
+    // options structs (named *Options or *Opts) with context.Background()
+    // and zero values
+    AutoArguments bool `json:"auto_arguments,omitempty"`
+    MaxMockMethods int  `json:"max_mock_methods,omitempty"`
+    // PrecreateTables creates each function's table from the schema
+    // predicted from its return type before it runs; outputs that do not
+    // fit the prediction replace the table with one built from the output
+    PrecreateTables bool `json:"precreate_tables,omitempty"`
+    // MaxErrors stops processing a repository once it has this many
+    // errors, recording the truncation; zero means no limit
+    MaxErrors int `json:"max_errors,omitempty"`
+    // StoreQueueSize bounds the outputs waiting to be written to the
+    // database (default 16); execution blocks while the queue is full, and
+    // zero stores every output before the next function runs
+    StoreQueueSize int `json:"store_queue_size"`
+    // Order is the order functions are executed in: "walk" (default, as
+    // the files are walked), "alphabetical", "cost" (cheapest estimate
+    // first), "dependencies" (callees first) or "random", shuffled with
+    // OrderSeed (zero picks a seed and records it in the result)
+    Order     string `json:"order,omitempty"`
+    OrderSeed int64  `json:"order_seed,omitempty"`
+    // KeepRunners keeps the source of generated runners, with the output
+    // of the compiler or the runner: "failures" (default) for runners that
+    // failed to build or run, "always", or "never". They are kept under
+    // RunnerDir (default: runners in the run's artifacts directory), and
+    // not at all when neither directory is configured.
+    KeepRunners string `json:"keep_runners,omitempty"`
+    RunnerDir   string `json:"runner_dir,omitempty"`
+    // Stability tracks how reliably functions execute across runs
+    Stability StabilityConfig `json:"stability,omitempty"`
+    // Commands runs the repository's main packages with safe argument sets
+    Commands CommandsConfig `json:"commands,omitempty"`
+    // Select restricts execution to the functions matching a query, for
+    // targeted harvests; repositories it excludes are not cloned
+    Select SelectionConfig `json:"select,omitempty"`
+}
+
+// ExportConfig selects additional export formats written to the run's
+// artifacts alongside the native JSON results
+type ExportConfig struct {
+    // Formats lists the extra formats to write: "lsif" and "stubs" per
+    // repository, and
+    // "dot" (GraphViz) or "cypher" (Neo4j) property graphs for the whole run,
+    // "duckdb" for a database of the run's metadata and outputs, and
+    // "http" to upload the results to Upload.URL
+    Formats []string     `json:"formats"`
+    Upload  UploadConfig `json:"upload,omitempty"`
+    // DuckDB is the duckdb CLI the duckdb format loads its database with
+    // (default: duckdb on PATH)
+    DuckDB  string       `json:"duckdb,omitempty"`
+}
+
+// Config holds the complete application configuration. The database
+// settings are embedded so existing flat config files keep working.
+type Config struct {
+    DatabaseConfig
+    Execution  ExecutionConfig  `json:"execution"`
+    Extraction ExtractionConfig `json:"extraction"`
+    Artifacts  ArtifactsConfig  `json:"artifacts"`
+    Service    ServiceConfig    `json:"service"`
+    Export     ExportConfig     `json:"export"`
+    State      StateConfig      `json:"state"`
+    TimeTravel TimeTravelConfig `json:"time_travel"`
+    Bulk       BulkConfig       `json:"bulk"`
+    Gate       GateConfig       `json:"gate"`
+    Email      EmailConfig      `json:"email"`
+    // Vulnerabilities configures the scan of go.sum against the OSV database
+    Vulnerabilities VulnerabilityConfig `json:"vulnerabilities"`
+    // Archive configures mirroring processed repositories for audits
+    Archive    ArchiveConfig    `json:"archive"`
+    // Workspace configures where clones live and how they are removed
+    Workspace  WorkspaceConfig  `json:"workspace"`
+    // WriteBack configures committing the function catalog into the
+    // processed repositories
+    WriteBack  WriteBackConfig  `json:"write_back"`
+    // Dependencies lists, per repository URL, the repositories it depends
+    // on; those are processed first and the dependent's result records the
+    // versions it was processed against
+    Dependencies map[string][]string `json:"dependencies,omitempty"`
+    // Profiling serves pprof and writes CPU and heap profiles of runs
+    Profiling  ProfilingConfig  `json:"profiling"`
+    // Providers configures TLS and API URLs of git hosting providers
+    Providers  ProvidersConfig  `json:"providers"`
+    // Plugins are external enricher binaries whose hooks run in the
+    // pipeline
+    Plugins    []PluginConfig   `json:"plugins,omitempty"`
+    // PostRun are SQL scripts executed against the database after a run in
+    // which every repository succeeded
+    PostRun    []PostRunScript  `json:"post_run,omitempty"`
+    // Update configures the release manifest self-update installs from
+    Update     UpdateConfig     `json:"update"`
+    // LogLevel is "info" (default, or "debug") to log everything, or
+    // "warn" to only log failures and warnings
+    LogLevel string `json:"log_level,omitempty"`
+
+    // Profiles holds named partial configurations (e.g. dev, staging, prod)
+    // layered over the base settings of the file when selected
+    Profiles map[string]json.RawMessage `json:"profiles,omitempty"`
+}
+
+// ConnectionString builds a lib/pq connection string from the configuration
+func (c DatabaseConfig) ConnectionString() string {
+    return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+        c.Host, c.Port, c.User, c.Password, c.Database, c.SSLMode)
+}
+
+// LoadConfigFromEnv loads configuration from environment variables
+func LoadConfigFromEnv() Config {
+    return applyEnv(defaultConfig())
+}
+
+// LoadConfig builds the layered configuration: defaults, then the config
+// file's base settings, then the named profile, then environment variables.
+// Command-line flags are applied on top by the caller.
+func LoadConfig(filename, profile string) (Config, error) {
+    config := defaultConfig()
+
+    if filename != "" {
+        var err error
+        config, err = LoadConfigFromFile(filename)
+        if err != nil {
+            return config, err
+        }
+    }
+
+    if profile != "" {
+        if err := applyProfile(&config, profile); err != nil {
+            return config, err
+        }
+    }
+
+    return applyEnv(config), nil
+}
+
+// applyProfile overlays a named profile onto the configuration
+func applyProfile(config *Config, profile string) error {
+    raw, ok := config.Profiles[profile]
+    if !ok {
+        return fmt.Errorf("profile %q not found in config file", profile)
+    }
+    if err := json.Unmarshal(raw, config); err != nil {
+        return fmt.Errorf("failed to parse profile %q: %w", profile, err)
+    }
+    return nil
+}
+
+// applyEnv overrides configuration values with any environment variables
+// that are set, keeping the values of base otherwise
+func applyEnv(base Config) Config {
+    config := base
+    config.DatabaseConfig = DatabaseConfig{
+        Driver:   getEnv("DB_DRIVER", base.Driver),
+        Host:     getEnv("DB_HOST", base.Host),
+        Port:     getEnv("DB_PORT", base.Port),
+        Database: getEnv("DB_NAME", base.Database),
+        User:     getEnv("DB_USER", base.User),
+        Password: getEnv("DB_PASSWORD", base.Password),
+        SSLMode:  getEnv("DB_SSLMODE", base.SSLMode),
+        Hosts:              getEnvList("DB_HOSTS", base.Hosts),
+        TargetSessionAttrs: getEnv("DB_TARGET_SESSION_ATTRS", base.TargetSessionAttrs),
+        DedupPayloads: getEnvBool("DB_DEDUP_PAYLOADS", base.DedupPayloads),
+        MaxPayloadRows: getEnvInt("DB_MAX_PAYLOAD_ROWS", base.MaxPayloadRows),
+        Flatten: FlattenConfig{
+            MaxDepth:   getEnvInt("DB_FLATTEN_DEPTH", base.Flatten.MaxDepth),
+            Separator:  getEnv("DB_FLATTEN_SEPARATOR", base.Flatten.Separator),
+            Levels:     getEnvList("DB_FLATTEN_LEVELS", base.Flatten.Levels),
+            MaxColumns: getEnvInt("DB_FLATTEN_MAX_COLUMNS", base.Flatten.MaxColumns),
+        },
+        PayloadStats:   getEnvBool("DB_PAYLOAD_STATS", base.PayloadStats),
+        Signatures:     getEnvBool("DB_SIGNATURES", base.Signatures),
+        DumpDir:       getEnv("DB_DUMP_DIR", base.DumpDir),
+        DumpSchema:    getEnv("DB_DUMP_SCHEMA", base.DumpSchema),
+        Partitioning:      getEnv("DB_PARTITIONING", base.Partitioning),
+        PartitionInterval: getEnv("DB_PARTITION_INTERVAL", base.PartitionInterval),
+        PartitionCount:    getEnvInt("DB_PARTITION_COUNT", base.PartitionCount),
+        Shards:            getEnvShards("DB_SHARDS", base.Shards),
+        ReplicaDSN:        getEnv("DB_REPLICA_DSN", base.ReplicaDSN),
+    }
+    config.Execution = ExecutionConfig{
+        FuzzArguments: getEnvBool("FLOQ_FUZZ_ARGUMENTS", base.Execution.FuzzArguments),
+        MaxFuzzCases:  getEnvInt("FLOQ_MAX_FUZZ_CASES", base.Execution.MaxFuzzCases),
+        Cache:         getEnvBool("FLOQ_EXECUTION_CACHE", base.Execution.Cache),
+        Interactive:   base.Execution.Interactive,
+        GoProxy:       getEnv("FLOQ_GOPROXY", base.Execution.GoProxy),
+        SkipClasses:   getEnvList("FLOQ_SKIP_CLASSES", base.Execution.SkipClasses),
+        OnlyClasses:   getEnvList("FLOQ_ONLY_CLASSES", base.Execution.OnlyClasses),
+        Sandbox:       getEnv("FLOQ_SANDBOX", base.Execution.Sandbox),
+        Toolchains:    getEnvList("FLOQ_TOOLCHAINS", base.Execution.Toolchains),
+        Timeout:       getEnvInt("FLOQ_EXECUTION_TIMEOUT", base.Execution.Timeout),
+        MemoryLimitMB: getEnvInt("FLOQ_MEMORY_LIMIT_MB", base.Execution.MemoryLimitMB),
+        RunTimeout:    getEnvInt("FLOQ_RUN_TIMEOUT", base.Execution.RunTimeout),
+        RetryResourceFailures: getEnvBool("FLOQ_RETRY_RESOURCE_FAILURES", base.Execution.RetryResourceFailures),
+        RetryFactor:           getEnvInt("FLOQ_RETRY_FACTOR", base.Execution.RetryFactor),
+        MockInterfaces:        getEnvBool("FLOQ_MOCK_INTERFACES", base.Execution.MockInterfaces),
+        AutoArguments:         getEnvBool("FLOQ_AUTO_ARGUMENTS", base.Execution.AutoArguments),
+        MaxMockMethods:        getEnvInt("FLOQ_MAX_MOCK_METHODS", base.Execution.MaxMockMethods),
+        PrecreateTables:       getEnvBool("FLOQ_PRECREATE_TABLES", base.Execution.PrecreateTables),
+        MaxErrors:             getEnvInt("FLOQ_MAX_ERRORS", base.Execution.MaxErrors),
+        StoreQueueSize:        getEnvInt("FLOQ_STORE_QUEUE_SIZE", base.Execution.StoreQueueSize),
+        Order:                 getEnv("FLOQ_EXECUTION_ORDER", base.Execution.Order),
+        OrderSeed:             int64(getEnvInt("FLOQ_ORDER_SEED", int(base.Execution.OrderSeed))),
+        KeepRunners:           getEnv("FLOQ_KEEP_RUNNERS", base.Execution.KeepRunners),
+        RunnerDir:             getEnv("FLOQ_RUNNER_DIR", base.Execution.RunnerDir),
+        Stability: StabilityConfig{
+            Track:       getEnvBool("FLOQ_TRACK_STABILITY", base.Execution.Stability.Track),
+            Window:      getEnvInt("FLOQ_STABILITY_WINDOW", base.Execution.Stability.Window),
+            SkipFailing: getEnvInt("FLOQ_SKIP_FAILING", base.Execution.Stability.SkipFailing),
+        },
+        Commands: CommandsConfig{
+            Enabled:  getEnvBool("FLOQ_RUN_COMMANDS", base.Execution.Commands.Enabled),
+            Args:     getEnvArgSets("FLOQ_COMMAND_ARGS", base.Execution.Commands.Args),
+            Packages: base.Execution.Commands.Packages,
+        },
+        Select: SelectionConfig{
+            Name:     getEnv("FLOQ_SELECT_NAME", base.Execution.Select.Name),
+            Repo:     getEnv("FLOQ_SELECT_REPO", base.Execution.Select.Repo),
+            Package:  getEnv("FLOQ_SELECT_PACKAGE", base.Execution.Select.Package),
+            Keywords: getEnvList("FLOQ_SELECT_KEYWORDS", base.Execution.Select.Keywords),
+        },
+    }
+    config.Extraction = ExtractionConfig{
+        FuncVariables: getEnvBool("FLOQ_EXTRACT_FUNC_VARIABLES", base.Extraction.FuncVariables),
+        Closures:      getEnvBool("FLOQ_EXTRACT_CLOSURES", base.Extraction.Closures),
+        EmbeddedGo:    getEnvBool("FLOQ_EXTRACT_EMBEDDED", base.Extraction.EmbeddedGo),
+        Paths:         getEnvList("FLOQ_PATHS", base.Extraction.Paths),
+        IgnoreFile:    getEnv("FLOQ_IGNORE_FILE", base.Extraction.IgnoreFile),
+        Cache:         getEnvBool("FLOQ_EXTRACTION_CACHE", base.Extraction.Cache),
+    }
+    config.Artifacts = ArtifactsConfig{
+        Dir:         getEnv("FLOQ_ARTIFACTS_DIR", base.Artifacts.Dir),
+        ResultsFile: getEnv("FLOQ_RESULTS_FILE", base.Artifacts.ResultsFile),
+        LogFile:     getEnv("FLOQ_LOG_FILE", base.Artifacts.LogFile),
+        KeepRuns:    getEnvInt("FLOQ_KEEP_RUNS", base.Artifacts.KeepRuns),
+    }
+    config.Service = ServiceConfig{
+        ListenAddr:        getEnv("FLOQ_LISTEN_ADDR", base.Service.ListenAddr),
+        Workers:           getEnvInt("FLOQ_WORKERS", base.Service.Workers),
+        HeartbeatInterval: getEnvInt("FLOQ_HEARTBEAT_INTERVAL", base.Service.HeartbeatInterval),
+        StaleAfter:        getEnvInt("FLOQ_STALE_AFTER", base.Service.StaleAfter),
+        MaxAttempts:       getEnvInt("FLOQ_MAX_ATTEMPTS", base.Service.MaxAttempts),
+        PollInterval:      getEnvInt("FLOQ_POLL_INTERVAL", base.Service.PollInterval),
+        Token:             getEnv("FLOQ_SERVICE_TOKEN", base.Service.Token),
+        Autoscale: AutoscaleConfig{
+            Enabled:           getEnvBool("FLOQ_AUTOSCALE", base.Service.Autoscale.Enabled),
+            MinWorkers:        getEnvInt("FLOQ_AUTOSCALE_MIN_WORKERS", base.Service.Autoscale.MinWorkers),
+            MaxWorkers:        getEnvInt("FLOQ_AUTOSCALE_MAX_WORKERS", base.Service.Autoscale.MaxWorkers),
+            MaxLoadPercent:    getEnvInt("FLOQ_AUTOSCALE_MAX_LOAD_PERCENT", base.Service.Autoscale.MaxLoadPercent),
+            MinFreeMemoryMB:   getEnvInt("FLOQ_AUTOSCALE_MIN_FREE_MEMORY_MB", base.Service.Autoscale.MinFreeMemoryMB),
+            MaxWriteLatencyMS: getEnvInt("FLOQ_AUTOSCALE_MAX_WRITE_LATENCY_MS", base.Service.Autoscale.MaxWriteLatencyMS),
+            Interval:          getEnvInt("FLOQ_AUTOSCALE_INTERVAL", base.Service.Autoscale.Interval),
+        },
+    }
+    config.Export = ExportConfig{
+        Formats: getEnvList("FLOQ_EXPORT_FORMATS", base.Export.Formats),
+        Upload: UploadConfig{
+            URL:       getEnv("FLOQ_UPLOAD_URL", base.Export.Upload.URL),
+            Token:     getEnv("FLOQ_UPLOAD_TOKEN", base.Export.Upload.Token),
+            Headers:   getEnvMap("FLOQ_UPLOAD_HEADERS", base.Export.Upload.Headers),
+            ChunkSize: getEnvInt("FLOQ_UPLOAD_CHUNK_SIZE", base.Export.Upload.ChunkSize),
+            Attempts:  getEnvInt("FLOQ_UPLOAD_ATTEMPTS", base.Export.Upload.Attempts),
+        },
+        DuckDB: getEnv("FLOQ_DUCKDB", base.Export.DuckDB),
+    }
+    config.TimeTravel = TimeTravelConfig{
+        Refs:        getEnvList("FLOQ_REFS", base.TimeTravel.Refs),
+        ReleaseTags: getEnvBool("FLOQ_RELEASE_TAGS", base.TimeTravel.ReleaseTags),
+        Commits:     getEnvInt("FLOQ_SAMPLE_COMMITS", base.TimeTravel.Commits),
+    }
+    config.Bulk = BulkConfig{
+        RateLimits:      base.Bulk.RateLimits,
+        DefaultRate:     getEnvInt("FLOQ_BULK_DEFAULT_RATE", base.Bulk.DefaultRate),
+        CheckpointEvery: getEnvInt("FLOQ_BULK_CHECKPOINT_EVERY", base.Bulk.CheckpointEvery),
+        MaxAttempts:     getEnvInt("FLOQ_BULK_MAX_ATTEMPTS", base.Bulk.MaxAttempts),
     }
+    config.Workspace = WorkspaceConfig{
+        Dir:          getEnv("FLOQ_WORKSPACE_DIR", base.Workspace.Dir),
+        RequireTmpfs: getEnvBool("FLOQ_WORKSPACE_REQUIRE_TMPFS", base.Workspace.RequireTmpfs),
+        SecureWipe:   getEnvBool("FLOQ_SECURE_WIPE", base.Workspace.SecureWipe),
+    }
+    config.State = StateConfig{
+        Dir: getEnv("FLOQ_STATE_DIR", base.State.Dir),
+    }
+    config.Gate = GateConfig{
+        MinFunctions:   getEnvInt("FLOQ_GATE_MIN_FUNCTIONS", base.Gate.MinFunctions),
+        MaxErrorRate:   getEnvPercent("FLOQ_GATE_MAX_ERROR_RATE", base.Gate.MaxErrorRate),
+        MinSuccessRate: getEnvPercent("FLOQ_GATE_MIN_SUCCESS_RATE", base.Gate.MinSuccessRate),
+    }
+    config.Email = EmailConfig{
+        SMTPHost:   getEnv("FLOQ_SMTP_HOST", base.Email.SMTPHost),
+        SMTPPort:   getEnvInt("FLOQ_SMTP_PORT", base.Email.SMTPPort),
+        Username:   getEnv("FLOQ_SMTP_USERNAME", base.Email.Username),
+        Password:   getEnv("FLOQ_SMTP_PASSWORD", base.Email.Password),
+        From:       getEnv("FLOQ_EMAIL_FROM", base.Email.From),
+        To:         getEnvList("FLOQ_EMAIL_TO", base.Email.To),
+        AttachHTML: getEnvBool("FLOQ_EMAIL_ATTACH_HTML", base.Email.AttachHTML),
+    }
+    config.Vulnerabilities = VulnerabilityConfig{
+        Scan:         getEnvBool("FLOQ_VULN_SCAN", base.Vulnerabilities.Scan),
+        SkipSeverity: getEnv("FLOQ_VULN_SKIP_SEVERITY", base.Vulnerabilities.SkipSeverity),
+        OSVURL:       getEnv("FLOQ_OSV_URL", base.Vulnerabilities.OSVURL),
+    }
+    config.Archive = ArchiveConfig{
+        Remote: getEnv("FLOQ_ARCHIVE_REMOTE", base.Archive.Remote),
+        Bundle: getEnv("FLOQ_ARCHIVE_BUNDLE", base.Archive.Bundle),
+        Token:  getEnv("FLOQ_ARCHIVE_TOKEN", base.Archive.Token),
+    }
+    config.WriteBack = WriteBackConfig{
+        Format:      getEnv("FLOQ_WRITE_BACK", base.WriteBack.Format),
+        Path:        getEnv("FLOQ_WRITE_BACK_PATH", base.WriteBack.Path),
+        Branch:      getEnv("FLOQ_WRITE_BACK_BRANCH", base.WriteBack.Branch),
+        PullRequest: getEnvBool("FLOQ_WRITE_BACK_PR", base.WriteBack.PullRequest),
+        Base:        getEnv("FLOQ_WRITE_BACK_BASE", base.WriteBack.Base),
+    }
+    config.Dependencies = getEnvDependencies("FLOQ_DEPENDENCIES", base.Dependencies)
+    config.Profiling = ProfilingConfig{
+        Addr: getEnv("FLOQ_PPROF_ADDR", base.Profiling.Addr),
+        CPU:  getEnvBool("FLOQ_CPU_PROFILE", base.Profiling.CPU),
+        Heap: getEnvBool("FLOQ_HEAP_PROFILE", base.Profiling.Heap),
+    }
+    config.Providers = ProvidersConfig{
+        CABundle:           getEnv("FLOQ_CA_BUNDLE", base.Providers.CABundle),
+        InsecureSkipVerify: getEnvBool("FLOQ_TLS_INSECURE_SKIP_VERIFY", base.Providers.InsecureSkipVerify),
+        APIURLs:            getEnvMap("FLOQ_API_URLS", base.Providers.APIURLs),
+        GitTransport:       getEnv("FLOQ_GIT_TRANSPORT", base.Providers.GitTransport),
+        CloneFilter:        getEnv("FLOQ_CLONE_FILTER", base.Providers.CloneFilter),
+    }
+    config.Plugins = pluginsFromEnv(base.Plugins)
+    config.LogLevel = getEnv("LOG_LEVEL", base.LogLevel)
+    config.PostRun = postRunScriptsFromEnv(base.PostRun)
+    config.Update = UpdateConfig{
+        URL:       getEnv("FLOQ_UPDATE_URL", base.Update.URL),
+        PublicKey: getEnv("FLOQ_UPDATE_PUBLIC_KEY", base.Update.PublicKey),
+        Version:   getEnv("FLOQ_UPDATE_VERSION", base.Update.Version),
+    }
+    return config
 }
 
-// LoadConfigFromFile loads database configuration from JSON file
-func LoadConfigFromFile(filename string) (DatabaseConfig, error) {
-    var config DatabaseConfig
+// LoadConfigFromFile loads configuration from JSON file
+func LoadConfigFromFile(filename string) (Config, error) {
+    config := defaultConfig()
     
     data, err := os.ReadFile(filename)
     if err != nil {
@@ -45,8 +467,61 @@ func LoadConfigFromFile(filename string) (DatabaseConfig, error) {
     return config, nil
 }
 
-// SaveConfigToFile saves database configuration to JSON file
-func SaveConfigToFile(config DatabaseConfig, filename string) error {
+// defaultConfig returns the lowest configuration layer, so settings omitted
+// from files, profiles, and the environment keep their defaults
+func defaultConfig() Config {
+    return Config{
+        DatabaseConfig: DatabaseConfig{
+            Driver:   DriverPostgres,
+            Host:     "localhost",
+            Port:     "5432",
+            Database: "postgres",
+            User:     "postgres",
+            SSLMode:  "disable",
+        },
+        Execution: ExecutionConfig{
+            MaxFuzzCases:   defaultMaxFuzzCases,
+            Sandbox:        SandboxAuto,
+            StoreQueueSize: defaultStoreQueueSize,
+        },
+        Artifacts: ArtifactsConfig{
+            ResultsFile: defaultResultsFileTemplate,
+            LogFile:     defaultLogFileTemplate,
+        },
+        State: StateConfig{
+            Dir: defaultStateDir(),
+        },
+        Bulk: BulkConfig{
+            CheckpointEvery: defaultBulkCheckpointEvery,
+            MaxAttempts:     defaultBulkMaxAttempts,
+        },
+        Service: ServiceConfig{
+            ListenAddr:        defaultListenAddr,
+            Workers:           defaultWorkers,
+            Autoscale: AutoscaleConfig{
+                MinWorkers:        defaultAutoscaleMinWorkers,
+                MaxWorkers:        defaultAutoscaleMaxWorkers,
+                MaxLoadPercent:    defaultAutoscaleMaxLoadPercent,
+                MinFreeMemoryMB:   defaultAutoscaleMinFreeMemoryMB,
+                MaxWriteLatencyMS: defaultAutoscaleMaxWriteLatencyMS,
+                Interval:          defaultAutoscaleInterval,
+            },
+            HeartbeatInterval: defaultHeartbeatInterval,
+            StaleAfter:        defaultStaleAfter,
+            MaxAttempts:       defaultMaxAttempts,
+            PollInterval:      defaultPollInterval,
+        },
+        Email: EmailConfig{
+            SMTPPort: defaultSMTPPort,
+        },
+        Vulnerabilities: VulnerabilityConfig{
+            OSVURL: defaultOSVURL,
+        },
+    }
+}
+
+// SaveConfigToFile saves configuration to JSON file
+func SaveConfigToFile(config Config, filename string) error {
     data, err := json.MarshalIndent(config, "", "  ")
     if err != nil {
         return fmt.Errorf("failed to marshal config: %w", err)
@@ -68,11 +543,113 @@ func getEnv(key, defaultValue string) string {
     return defaultValue
 }
 
-// ValidateConfig validates database configuration
-func ValidateConfig(config DatabaseConfig) error {
-    if config.Host == "" {
+// getEnvList gets a comma-separated environment variable with default value
+func getEnvList(key string, defaultValue []string) []string {
+    value := os.Getenv(key)
+    if value == "" {
+        return defaultValue
+    }
+    var items []string
+    for _, item := range strings.Split(value, ",") {
+        if item = strings.TrimSpace(item); item != "" {
+            items = append(items, item)
+        }
+    }
+    return items
+}
+
+// getEnvMap gets a comma-separated environment variable of key=value
+// pairs with default value
+func getEnvMap(key string, defaultValue map[string]string) map[string]string {
+    entries := getEnvList(key, nil)
+    if entries == nil {
+        return defaultValue
+    }
+    values := make(map[string]string)
+    for _, entry := range entries {
+        if name, value, ok := strings.Cut(entry, "="); ok {
+            values[strings.TrimSpace(name)] = strings.TrimSpace(value)
+        }
+    }
+    return values
+}
+
+// getEnvArgSets gets a comma-separated environment variable of argument
+// sets, each split on whitespace, with default value
+func getEnvArgSets(key string, defaultValue [][]string) [][]string {
+    entries := getEnvList(key, nil)
+    if entries == nil {
+        return defaultValue
+    }
+    sets := make([][]string, 0, len(entries))
+    for _, entry := range entries {
+        sets = append(sets, strings.Fields(entry))
+    }
+    return sets
+}
+
+// getEnvBool gets a boolean environment variable with default value
+func getEnvBool(key string, defaultValue bool) bool {
+    if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+        return value
+    }
+    return defaultValue
+}
+
+// getEnvInt gets an integer environment variable with default value
+func getEnvInt(key string, defaultValue int) int {
+    if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+        return value
+    }
+    return defaultValue
+}
+
+// getEnvPercent gets an optional percentage environment variable with
+// default value
+func getEnvPercent(key string, defaultValue *float64) *float64 {
+    if value, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+        return &value
+    }
+    return defaultValue
+}
+
+// ValidateConfig validates configuration
+func ValidateConfig(config Config) error {
+    if err := validateLogLevel(config.LogLevel); err != nil {
+        return err
+    }
+    if config.Driver != "" && config.Driver != DriverPostgres && config.Driver != DriverMemory && config.Driver != DriverSQL {
+        return fmt.Errorf("unsupported database driver %q", config.Driver)
+    }
+    if _, err := NewPartitionStrategy(config.DatabaseConfig); err != nil {
+        return err
+    }
+    if config.Host == "" && len(config.Hosts) == 0 {
         return fmt.Errorf("database host is required")
     }
+    if err := config.validateShards(); err != nil {
+        return err
+    }
+    if err := validateDependencies(config.Dependencies); err != nil {
+        return err
+    }
+    if err := validateProviders(config.Providers); err != nil {
+        return err
+    }
+    if err := validatePlugins(config.Plugins); err != nil {
+        return err
+    }
+    if err := validatePostRunScripts(config.PostRun); err != nil {
+        return err
+    }
+    if err := validateWriteBack(config.WriteBack); err != nil {
+        return err
+    }
+    switch config.TargetSessionAttrs {
+    case "", SessionReadWrite, SessionAny:
+    default:
+        return fmt.Errorf("unsupported target session attrs %q", config.TargetSessionAttrs)
+    }
     if config.Database == "" {
         return fmt.Errorf("database name is required")
     }
@@ -85,5 +662,154 @@ func ValidateConfig(config DatabaseConfig) error {
     if config.SSLMode == "" {
         config.SSLMode = "disable"
     }
+    if _, err := config.Execution.Select.Query(); err != nil {
+        return err
+    }
+    if config.Execution.MaxFuzzCases < 0 {
+        return fmt.Errorf("max fuzz cases must not be negative")
+    }
+    if config.DatabaseConfig.MaxPayloadRows < 0 {
+        return fmt.Errorf("max payload rows must not be negative")
+    }
+    if err := config.DatabaseConfig.Flatten.validate(); err != nil {
+        return err
+    }
+    if config.Artifacts.KeepRuns < 0 {
+        return fmt.Errorf("artifacts keep runs must not be negative")
+    }
+    for _, template := range []string{config.Artifacts.ResultsFile, config.Artifacts.LogFile} {
+        if template != "" && !filepath.IsLocal(filepath.Clean(template)) {
+            return fmt.Errorf("artifact file %q must be a relative path inside the artifacts directory", template)
+        }
+    }
+    if config.Service.Workers < 1 {
+        return fmt.Errorf("service workers must be at least 1")
+    }
+    if config.Service.HeartbeatInterval < 1 || config.Service.PollInterval < 1 {
+        return fmt.Errorf("service heartbeat and poll intervals must be at least 1 second")
+    }
+    if config.Service.StaleAfter <= config.Service.HeartbeatInterval {
+        return fmt.Errorf("service stale_after must be longer than heartbeat_interval")
+    }
+    if config.Service.MaxAttempts < 1 {
+        return fmt.Errorf("service max attempts must be at least 1")
+    }
+    if config.Service.Token == "" && !isLoopbackAddr(config.Service.ListenAddr) {
+        return fmt.Errorf("service listen address %q is not a loopback address and needs a service token", config.Service.ListenAddr)
+    }
+    if err := config.Service.Autoscale.validate(); err != nil {
+        return err
+    }
+    for _, class := range append(append([]string(nil), config.Execution.SkipClasses...), config.Execution.OnlyClasses...) {
+        if !containsString(functionClasses, class) {
+            return fmt.Errorf("unknown function class %q", class)
+        }
+    }
+    if config.Gate.MinFunctions < 0 {
+        return fmt.Errorf("gate min functions must not be negative")
+    }
+    for _, rate := range []*float64{config.Gate.MaxErrorRate, config.Gate.MinSuccessRate} {
+        if rate != nil && (*rate < 0 || *rate > 100) {
+            return fmt.Errorf("gate rates must be percentages between 0 and 100")
+        }
+    }
+    if config.Email.Enabled() && (config.Email.SMTPHost == "" || config.Email.From == "") {
+        return fmt.Errorf("email reports need an SMTP host and a from address")
+    }
+    if config.Email.SMTPPort < 1 || config.Email.SMTPPort > 65535 {
+        return fmt.Errorf("invalid SMTP port %d", config.Email.SMTPPort)
+    }
+    if severity := strings.ToUpper(config.Vulnerabilities.SkipSeverity); severity != "" {
+        if rank, ok := severityRanks[severity]; !ok || rank == 0 {
+            return fmt.Errorf("invalid vulnerability skip severity %q (expected low, moderate, high, or critical)", config.Vulnerabilities.SkipSeverity)
+        }
+    }
+    if config.Bulk.MaxAttempts < 1 {
+        return fmt.Errorf("bulk max attempts must be at least 1")
+    }
+    if config.Bulk.DefaultRate < 0 || config.Bulk.CheckpointEvery < 0 {
+        return fmt.Errorf("bulk default rate and checkpoint interval must not be negative")
+    }
+    for host, limit := range config.Bulk.RateLimits {
+        if limit < 0 {
+            return fmt.Errorf("bulk rate limit for %s must not be negative", host)
+        }
+    }
+    if config.TimeTravel.Commits < 0 {
+        return fmt.Errorf("time travel commits must not be negative")
+    }
+    if config.Execution.Timeout < 0 || config.Execution.MemoryLimitMB < 0 {
+        return fmt.Errorf("execution timeout and memory limit must not be negative")
+    }
+    if config.Execution.RunTimeout < 0 {
+        return fmt.Errorf("run timeout must not be negative")
+    }
+    if config.Execution.MaxMockMethods < 0 {
+        return fmt.Errorf("max mock methods must not be negative")
+    }
+    if config.Execution.MaxErrors < 0 {
+        return fmt.Errorf("max errors must not be negative")
+    }
+    if config.Execution.StoreQueueSize < 0 {
+        return fmt.Errorf("store queue size must not be negative")
+    }
+    if config.Execution.RetryFactor < 0 || config.Execution.RetryFactor == 1 {
+        return fmt.Errorf("execution retry factor must be at least 2")
+    }
+    if config.Execution.RetryResourceFailures && config.Execution.Timeout == 0 && config.Execution.MemoryLimitMB == 0 {
+        return fmt.Errorf("retrying resource failures needs an execution timeout or memory limit")
+    }
+    if len(config.Execution.Toolchains) == 1 {
+        return fmt.Errorf("execution toolchains needs at least two toolchains to compare")
+    }
+    switch config.Execution.Order {
+    case "", OrderWalk, OrderAlphabetical, OrderCost, OrderDependencies, OrderRandom:
+    default:
+        return fmt.Errorf("unsupported execution order %q", config.Execution.Order)
+    }
+    if config.Execution.OrderSeed != 0 && config.Execution.Order != OrderRandom {
+        return fmt.Errorf("execution order seed needs the random order")
+    }
+    switch config.Execution.KeepRunners {
+    case "", KeepRunnersFailures, KeepRunnersAlways, KeepRunnersNever:
+    default:
+        return fmt.Errorf("unsupported keep runners mode %q", config.Execution.KeepRunners)
+    }
+    stability := config.Execution.Stability
+    if stability.Window < 0 || stability.SkipFailing < 0 {
+        return fmt.Errorf("stability window and skip failing must not be negative")
+    }
+    if stability.SkipFailing > 0 && !stability.Track {
+        return fmt.Errorf("skipping failing functions needs stability tracking")
+    }
+    // Streaks longer than the window are never recorded
+    window := stability.Window
+    if window == 0 {
+        window = defaultStabilityWindow
+    }
+    if stability.SkipFailing > window {
+        return fmt.Errorf("skip failing must not exceed the stability window of %d runs", window)
+    }
+    if config.Execution.Commands.Enabled && len(config.Execution.Commands.Args) == 0 && len(config.Execution.Commands.Packages) == 0 {
+        return fmt.Errorf("running commands needs at least one argument set")
+    }
+    switch config.Execution.Sandbox {
+    case "", SandboxNone, SandboxAuto, SandboxNetNS:
+    default:
+        return fmt.Errorf("unsupported sandbox mode %q", config.Execution.Sandbox)
+    }
+    for _, format := range config.Export.Formats {
+        if _, ok := exporters[format]; !ok {
+            return fmt.Errorf("unsupported export format %q", format)
+        }
+        if format == "http" && config.Export.Upload.URL == "" {
+            return fmt.Errorf("the http export format requires an upload URL")
+        }
+        if format == "duckdb" {
+            if _, err := exec.LookPath(orDefault(config.Export.DuckDB, defaultDuckDB)); err != nil {
+                return fmt.Errorf("the duckdb export format needs the duckdb CLI: %w", err)
+            }
+        }
+    }
     return nil
 }
\ No newline at end of file
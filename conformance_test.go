@@ -0,0 +1,30 @@
+package main
+
+import (
+    "fmt"
+    "path/filepath"
+    "testing"
+
+    "github.com/Spottybadrabbit/Floq-v1/storage/storagetest"
+)
+
+// TestMemoryStorageConformance runs the conformance checks against the
+// in-memory storage, comparing the stored rows
+func TestMemoryStorageConformance(t *testing.T) {
+    storagetest.Check(t, func() (Storage, error) {
+        return NewMemoryStorage(), nil
+    })
+}
+
+// TestSQLDumpStorageConformance runs the conformance checks against the SQL
+// dump storage, which can only be checked for writing without errors
+func TestSQLDumpStorageConformance(t *testing.T) {
+    dir := t.TempDir()
+    dumps := 0
+    storagetest.Check(t, func() (Storage, error) {
+        dumps++
+        dump := NewSQLDumpStorage(defaultConfig().DatabaseConfig)
+        dump.SetPath(filepath.Join(dir, fmt.Sprintf("check-%d.sql", dumps)))
+        return dump, nil
+    })
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+    "embed"
+    "io/fs"
+    "net/http"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// dashboardFiles holds the web dashboard served in service mode
+//
+//go:embed web
+var dashboardFiles embed.FS
+
+// maxCatalogEntries caps the functions returned by one catalog search
+const maxCatalogEntries = 500
+
+// maxErrorExamples is the number of messages kept per error kind
+const maxErrorExamples = 3
+
+// CatalogEntry is a function in the dashboard's catalog
+type CatalogEntry struct {
+    Repository string `json:"repository"`
+    Name       string `json:"name"`
+    Signature  string `json:"signature"`
+    File       string `json:"file"`
+    Line       int    `json:"line"`
+    Class      string `json:"class,omitempty"`
+    Comment    string `json:"comment,omitempty"`
+    Executed   bool   `json:"executed"`
+}
+
+// ErrorGroup counts the errors of one kind across repositories
+type ErrorGroup struct {
+    Kind         string   `json:"kind"`
+    Count        int      `json:"count"`
+    Repositories []string `json:"repositories"`
+    Examples     []string `json:"examples"`
+}
+
+// errorSubjectWords precede the name of the function, table or file an
+// error message is about
+var errorSubjectWords = map[string]bool{"function": true, "for": true, "from": true, "of": true, "on": true, "in": true}
+
+// errorKind groups an error message by the part before its first colon,
+// without the function, table or file it names, e.g. "Failed to execute
+// function"
+func errorKind(message string) string {
+    prefix, _, _ := strings.Cut(message, ":")
+    words := strings.Fields(prefix)
+    if len(words) >= 2 {
+        last := words[len(words)-1]
+        if errorSubjectWords[words[len(words)-2]] || strings.ContainsAny(last, "./") {
+            words = words[:len(words)-1]
+        }
+    }
+    return strings.Join(words, " ")
+}
+
+// groupErrors breaks the errors of the results down by kind, most frequent
+// first
+func groupErrors(results map[string]*ProcessingResult) []ErrorGroup {
+    groups := make(map[string]*ErrorGroup)
+    for repoURL, result := range results {
+        for _, message := range result.Errors {
+            kind := errorKind(message)
+            group, ok := groups[kind]
+            if !ok {
+                group = &ErrorGroup{Kind: kind}
+                groups[kind] = group
+            }
+            group.Count++
+            if !containsString(group.Repositories, repoURL) {
+                group.Repositories = append(group.Repositories, repoURL)
+            }
+            if len(group.Examples) < maxErrorExamples {
+                group.Examples = append(group.Examples, message)
+            }
+        }
+    }
+
+    breakdown := make([]ErrorGroup, 0, len(groups))
+    for _, group := range groups {
+        sort.Strings(group.Repositories)
+        breakdown = append(breakdown, *group)
+    }
+    sort.Slice(breakdown, func(i, j int) bool {
+        if breakdown[i].Count != breakdown[j].Count {
+            return breakdown[i].Count > breakdown[j].Count
+        }
+        return breakdown[i].Kind < breakdown[j].Kind
+    })
+    return breakdown
+}
+
+// dashboardRoutes registers the dashboard and the read-only API it uses.
+// The dashboard's own files hold no data and are served to anyone; its
+// API takes the service token like the rest.
+func (s *Service) dashboardRoutes(mux *http.ServeMux) {
+    web, _ := fs.Sub(dashboardFiles, "web")
+    mux.Handle("GET /ui/", http.StripPrefix("/ui/", http.FileServer(http.FS(web))))
+    mux.Handle("GET /{$}", http.RedirectHandler("/ui/", http.StatusFound))
+    mux.HandleFunc("GET /jobs/{id}", s.requireToken(s.handleJob))
+    mux.HandleFunc("GET /catalog", s.requireToken(s.handleCatalog))
+    mux.HandleFunc("GET /errors", s.requireToken(s.handleErrors))
+}
+
+// handleJob returns one job with its result
+func (s *Service) handleJob(w http.ResponseWriter, r *http.Request) {
+    id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+    if err != nil {
+        http.Error(w, "job id must be a number", http.StatusBadRequest)
+        return
+    }
+    job, err := s.jobs.Get(id)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    if job == nil {
+        http.Error(w, "job not found", http.StatusNotFound)
+        return
+    }
+    writeJSON(w, http.StatusOK, job)
+}
+
+// handleCatalog searches the functions of every repository's latest
+// successful job. ?q= is a regular expression matched against function
+// names and ?repo= against repository URLs.
+func (s *Service) handleCatalog(w http.ResponseWriter, r *http.Request) {
+    var query FunctionQuery
+    for param, pattern := range map[string]**regexp.Regexp{"q": &query.Name, "repo": &query.Repo} {
+        if value := r.URL.Query().Get(param); value != "" {
+            re, err := regexp.Compile("(?i)" + value)
+            if err != nil {
+                http.Error(w, "invalid "+param+" pattern: "+err.Error(), http.StatusBadRequest)
+                return
+            }
+            *pattern = re
+        }
+    }
+
+    results, err := s.jobs.LatestResults()
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    entries := []CatalogEntry{}
+    for _, match := range FindFunctions(&RunResults{Results: results}, query) {
+        if len(entries) == maxCatalogEntries {
+            break
+        }
+        function := match.Function
+        entries = append(entries, CatalogEntry{
+            Repository: match.Repository,
+            Name:       function.Name,
+            Signature:  functionSignature(function),
+            File:       function.RelativePath,
+            Line:       function.LineNumber,
+            Class:      function.Class,
+            Comment:    function.Comment,
+            Executed:   containsString(results[match.Repository].ExecutedFunctions, function.Name),
+        })
+    }
+    writeJSON(w, http.StatusOK, entries)
+}
+
+// handleErrors breaks down the errors of one job (?job=N) or of every
+// repository's latest successful job by kind
+func (s *Service) handleErrors(w http.ResponseWriter, r *http.Request) {
+    var results map[string]*ProcessingResult
+    if value := r.URL.Query().Get("job"); value != "" {
+        id, err := strconv.ParseInt(value, 10, 64)
+        if err != nil {
+            http.Error(w, "job must be a job id", http.StatusBadRequest)
+            return
+        }
+        job, err := s.jobs.Get(id)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        if job == nil {
+            http.Error(w, "job not found", http.StatusNotFound)
+            return
+        }
+        results = map[string]*ProcessingResult{}
+        if job.Result != nil {
+            results[job.RepoURL] = job.Result
+        }
+    } else {
+        var err error
+        if results, err = s.jobs.LatestResults(); err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+    }
+    writeJSON(w, http.StatusOK, groupErrors(results))
+}
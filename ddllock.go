@@ -0,0 +1,74 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+)
+
+// ddlLockClass namespaces floq's advisory locks ("floq" in ASCII) so they
+// cannot collide with locks other applications take in the same database
+const ddlLockClass = 0x666c6f71
+
+// withTableLock runs DDL on a table in a transaction holding an advisory
+// lock keyed by the current schema and the table name. Concurrent workers
+// and runs against one database thus create and replace a table one at a
+// time, instead of racing on the catalog, while different tables and
+// schemas proceed in parallel. The lock is released when the transaction
+// ends.
+func withTableLock(db *sql.DB, table string, ddl func(tx *sql.Tx) error) error {
+    return withTableLockContext(context.Background(), db, table, ddl)
+}
+
+// withTableLockContext is withTableLock in a transaction bound to ctx: if
+// ctx is cancelled, the DDL fails and is rolled back
+func withTableLockContext(ctx context.Context, db *sql.DB, table string, ddl func(tx *sql.Tx) error) error {
+    tx, err := db.BeginTx(ctx, nil)
+    if err != nil {
+        return fmt.Errorf("failed to begin DDL transaction for %s: %w", table, err)
+    }
+    _, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1, hashtext(coalesce(current_schema(), '') || '.' || $2))",
+        ddlLockClass, table)
+    if err != nil {
+        tx.Rollback()
+        return fmt.Errorf("failed to lock table %s: %w", table, err)
+    }
+    if err := ddl(tx); err != nil {
+        tx.Rollback()
+        return err
+    }
+    if err := tx.Commit(); err != nil {
+        return fmt.Errorf("failed to commit DDL for %s: %w", table, err)
+    }
+    return nil
+}
+
+// ensureTable creates a fixed table from its CREATE TABLE IF NOT EXISTS
+// schema under the table's lock; concurrent IF NOT EXISTS statements can
+// otherwise both attempt the creation and one fails
+func ensureTable(db *sql.DB, table, schema string) error {
+    return withTableLock(db, table, func(tx *sql.Tx) error {
+        _, err := tx.Exec(schema)
+        return err
+    })
+}
+
+// lockedDDL runs DDL on a table under the table's lock, rolling it back if
+// ctx is cancelled. SQL dumps have no database to coordinate with and write
+// the statements directly.
+func (p *PostgresStorage) lockedDDL(ctx context.Context, table string, ddl func(exec sqlExecer) error) error {
+    if p.db == nil {
+        return ddl(p.exec)
+    }
+    return withTableLockContext(ctx, p.db, table, func(tx *sql.Tx) error {
+        return ddl(tx)
+    })
+}
+
+// ensureTable creates a fixed table under the table's lock
+func (p *PostgresStorage) ensureTable(ctx context.Context, table, schema string) error {
+    return p.lockedDDL(ctx, table, func(exec sqlExecer) error {
+        _, err := exec.ExecContext(ctx, schema)
+        return err
+    })
+}
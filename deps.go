@@ -0,0 +1,277 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// DependencyVersion is the version of a repository, processed earlier in
+// the run, that a dependent repository was processed against
+type DependencyVersion struct {
+    Repository string `json:"repository"`
+    // Module and Commit identify what was processed for the dependency
+    Module string `json:"module,omitempty"`
+    Commit string `json:"commit,omitempty"`
+    // Required is the version of Module the dependent's go.mod requires,
+    // after replace directives
+    Required string `json:"required,omitempty"`
+    // Failed is set when processing the dependency failed
+    Failed bool `json:"failed,omitempty"`
+}
+
+// repositoryKey normalizes a repository URL so the same repository matches
+// with or without a .git suffix or trailing slash
+func repositoryKey(repoURL string) string {
+    return strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(repoURL), "/"), ".git")
+}
+
+// normalizeDependencies keys the declared dependencies by repositoryKey
+func normalizeDependencies(dependencies map[string][]string) map[string][]string {
+    normalized := make(map[string][]string, len(dependencies))
+    for repoURL, deps := range dependencies {
+        key := repositoryKey(repoURL)
+        for _, dep := range deps {
+            normalized[key] = append(normalized[key], repositoryKey(dep))
+        }
+    }
+    return normalized
+}
+
+// validateDependencies rejects declared dependencies that form a cycle
+func validateDependencies(dependencies map[string][]string) error {
+    graph := normalizeDependencies(dependencies)
+    repositories := make([]string, 0, len(graph))
+    for repoURL := range graph {
+        repositories = append(repositories, repoURL)
+    }
+    sort.Strings(repositories)
+
+    // Depth-first search; visiting holds the current path
+    const (
+        unvisited = iota
+        visiting
+        visited
+    )
+    state := make(map[string]int)
+    var path []string
+    var visit func(repoURL string) error
+    visit = func(repoURL string) error {
+        switch state[repoURL] {
+        case visiting:
+            start := 0
+            for path[start] != repoURL {
+                start++
+            }
+            return fmt.Errorf("dependency cycle: %s", strings.Join(append(path[start:], repoURL), " -> "))
+        case visited:
+            return nil
+        }
+        state[repoURL] = visiting
+        path = append(path, repoURL)
+        for _, dep := range graph[repoURL] {
+            if err := visit(dep); err != nil {
+                return err
+            }
+        }
+        path = path[:len(path)-1]
+        state[repoURL] = visited
+        return nil
+    }
+    for _, repoURL := range repositories {
+        if err := visit(repoURL); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// getEnvDependencies parses a comma-separated environment variable of
+// dependencies in the form repo=dep|dep, or returns defaultValue if unset
+func getEnvDependencies(key string, defaultValue map[string][]string) map[string][]string {
+    entries := getEnvList(key, nil)
+    if entries == nil {
+        return defaultValue
+    }
+    dependencies := make(map[string][]string)
+    for _, entry := range entries {
+        repoURL, deps, _ := strings.Cut(entry, "=")
+        for _, dep := range strings.Split(deps, "|") {
+            if dep = strings.TrimSpace(dep); dep != "" {
+                dependencies[strings.TrimSpace(repoURL)] = append(dependencies[strings.TrimSpace(repoURL)], dep)
+            }
+        }
+    }
+    return dependencies
+}
+
+// dependencyLevels groups repositories so every repository comes after the
+// repositories it depends on: the first group depends on none of the
+// others, and each later group only on earlier ones. Repositories keep
+// their order within a group. Dependencies that are not being processed
+// are ignored.
+func dependencyLevels(repositories []string, dependencies map[string][]string) ([][]string, error) {
+    if len(dependencies) == 0 {
+        return [][]string{repositories}, nil
+    }
+    if err := validateDependencies(dependencies); err != nil {
+        return nil, err
+    }
+    graph := normalizeDependencies(dependencies)
+
+    listed := make(map[string]bool, len(repositories))
+    for _, repoURL := range repositories {
+        listed[repositoryKey(repoURL)] = true
+    }
+
+    // The graph is acyclic, so levels resolve by memoized recursion
+    levels := make(map[string]int)
+    var level func(key string) int
+    level = func(key string) int {
+        if l, ok := levels[key]; ok {
+            return l
+        }
+        l := 0
+        for _, dep := range graph[key] {
+            if listed[dep] {
+                l = max(l, level(dep)+1)
+            }
+        }
+        levels[key] = l
+        return l
+    }
+
+    var groups [][]string
+    for _, repoURL := range repositories {
+        l := level(repositoryKey(repoURL))
+        for len(groups) <= l {
+            groups = append(groups, nil)
+        }
+        groups[l] = append(groups[l], repoURL)
+    }
+    return groups, nil
+}
+
+// dependenciesOf returns the declared dependencies of a repository
+func dependenciesOf(repoURL string, dependencies map[string][]string) []string {
+    var deps []string
+    for dependent, declared := range dependencies {
+        if repositoryKey(dependent) == repositoryKey(repoURL) {
+            deps = append(deps, declared...)
+        }
+    }
+    return deps
+}
+
+// readRequirements returns the module versions a repository's go.mod
+// requires, with replace directives applied. Replacements by a local
+// directory are reported as "=> path".
+func readRequirements(repoPath string) map[string]string {
+    data, err := os.ReadFile(filepath.Join(repoPath, "go.mod"))
+    if err != nil {
+        return nil
+    }
+
+    requirements := make(map[string]string)
+    replacements := make(map[string]string)
+    block := ""
+    for _, line := range strings.Split(string(data), "\n") {
+        if i := strings.Index(line, "//"); i >= 0 {
+            line = line[:i]
+        }
+        fields := strings.Fields(line)
+        if len(fields) == 0 {
+            continue
+        }
+        if block != "" && fields[0] == ")" {
+            block = ""
+            continue
+        }
+        if block == "" && (fields[0] == "require" || fields[0] == "replace") {
+            if len(fields) == 2 && fields[1] == "(" {
+                block = fields[0]
+                continue
+            }
+            parseRequirement(fields[0], fields[1:], requirements, replacements)
+            continue
+        }
+        if block != "" {
+            parseRequirement(block, fields, requirements, replacements)
+        }
+    }
+
+    for module, replacement := range replacements {
+        if _, ok := requirements[module]; ok {
+            requirements[module] = replacement
+        }
+    }
+    return requirements
+}
+
+// parseRequirement records one require or replace directive
+func parseRequirement(directive string, fields []string, requirements, replacements map[string]string) {
+    switch directive {
+    case "require":
+        if len(fields) >= 2 {
+            requirements[strings.Trim(fields[0], `"`)] = fields[1]
+        }
+    case "replace":
+        // old [version] => new [version]
+        arrow := -1
+        for i, field := range fields {
+            if field == "=>" {
+                arrow = i
+            }
+        }
+        if arrow < 1 || arrow+1 >= len(fields) {
+            return
+        }
+        target := fields[arrow+1:]
+        if len(target) == 1 {
+            replacements[strings.Trim(fields[0], `"`)] = "=> " + target[0]
+        } else {
+            replacements[strings.Trim(fields[0], `"`)] = target[0] + " " + target[1]
+        }
+    }
+}
+
+// describeDependency formats a dependency version for the summary
+func describeDependency(dependency DependencyVersion) string {
+    description := dependency.Repository
+    if dependency.Commit != "" {
+        description += "@" + dependency.Commit[:min(12, len(dependency.Commit))]
+    }
+    if dependency.Required != "" {
+        description += fmt.Sprintf(" (%s %s)", dependency.Module, dependency.Required)
+    }
+    if dependency.Failed {
+        description += " (failed)"
+    }
+    return description
+}
+
+// SetDependencies sets the repositories processed earlier in the run that
+// the next repository depends on
+func (g *GitHubFunctionExtractor) SetDependencies(dependencies []DependencyVersion) {
+    g.dependencies = dependencies
+}
+
+// resolveDependencies attaches the versions of the repository's
+// dependencies to the result, with the version its go.mod requires
+func (g *GitHubFunctionExtractor) resolveDependencies(result *ProcessingResult) {
+    if len(g.dependencies) == 0 {
+        return
+    }
+    requirements := readRequirements(g.repoPath)
+    for _, dependency := range g.dependencies {
+        if dependency.Module != "" {
+            dependency.Required = requirements[dependency.Module]
+        }
+        if dependency.Module != "" && dependency.Required == "" {
+            g.logger.Printf("%s is declared to depend on %s, but its go.mod does not require %s", g.repoURL, dependency.Repository, dependency.Module)
+        }
+        result.Dependencies = append(result.Dependencies, dependency)
+    }
+}
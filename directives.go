@@ -0,0 +1,87 @@
+package main
+
+import (
+    "fmt"
+    "go/ast"
+    "go/parser"
+    "strings"
+)
+
+// Execution directive actions, written as //floq:execute and //floq:skip
+// comments on a function
+const (
+    DirectiveExecute = "execute"
+    DirectiveSkip    = "skip"
+)
+
+// directivePrefix starts every floq comment directive
+const directivePrefix = "//floq:"
+
+// ExecutionDirective is an explicit annotation deciding whether and how a
+// function is executed, overriding the execution policy and heuristics
+type ExecutionDirective struct {
+    Action string `json:"action"`
+    // Arguments are the Go literals to call the function with, as in
+    // //floq:execute 42, "floq"
+    Arguments []string `json:"arguments,omitempty"`
+    // Reason is the free text after //floq:skip
+    Reason string `json:"reason,omitempty"`
+    // Error reports a malformed directive
+    Error string `json:"error,omitempty"`
+}
+
+// parseDirective returns the floq directive in a doc comment, or nil. The
+// last directive wins if there are several.
+func parseDirective(doc *ast.CommentGroup) *ExecutionDirective {
+    if doc == nil {
+        return nil
+    }
+    var directive *ExecutionDirective
+    for _, comment := range doc.List {
+        if !strings.HasPrefix(comment.Text, directivePrefix) {
+            continue
+        }
+        text := strings.TrimPrefix(comment.Text, directivePrefix)
+        action, rest, _ := strings.Cut(text, " ")
+        rest = strings.TrimSpace(rest)
+
+        switch action {
+        case DirectiveSkip:
+            directive = &ExecutionDirective{Action: DirectiveSkip, Reason: rest}
+        case DirectiveExecute:
+            directive = &ExecutionDirective{Action: DirectiveExecute}
+            args, err := directiveArguments(rest)
+            if err != nil {
+                directive.Error = err.Error()
+            }
+            directive.Arguments = args
+        default:
+            directive = &ExecutionDirective{Action: action, Error: fmt.Sprintf("unknown directive %s%s", directivePrefix, action)}
+        }
+    }
+    return directive
+}
+
+// directiveArguments splits the argument literals of an execute directive
+// by parsing them as the arguments of a call
+func directiveArguments(text string) ([]string, error) {
+    if text == "" {
+        return nil, nil
+    }
+    expr, err := parser.ParseExpr("f(" + text + ")")
+    if err != nil {
+        return nil, fmt.Errorf("invalid directive arguments %q: %w", text, err)
+    }
+    call, ok := expr.(*ast.CallExpr)
+    if !ok {
+        return nil, fmt.Errorf("invalid directive arguments %q", text)
+    }
+
+    // Positions are 1-based offsets into "f(" + text + ")"
+    src := "f(" + text + ")"
+    args := make([]string, 0, len(call.Args))
+    for _, arg := range call.Args {
+        args = append(args, src[arg.Pos()-1:arg.End()-1])
+    }
+    return args, nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+    "go/doc"
+    "go/doc/comment"
+    "strings"
+    "unicode"
+)
+
+// DocComment is the structure of a function's doc comment, as parsed by
+// go/doc/comment
+type DocComment struct {
+    // Summary is the first sentence of the comment
+    Summary string `json:"summary,omitempty"`
+    // Deprecated is the text of the "Deprecated:" paragraph, if any
+    Deprecated string `json:"deprecated,omitempty"`
+    // Params lists the parameters the comment mentions by name
+    Params []string `json:"params,omitempty"`
+    // Links are the URLs the comment links to
+    Links []DocLink `json:"links,omitempty"`
+    // Symbols are the doc links to Go symbols, written [Name],
+    // [pkg.Name] or [Recv.Method], as import/path.Recv.Name
+    Symbols []string `json:"symbols,omitempty"`
+    // CodeBlocks are the comment's indented code blocks
+    CodeBlocks []string `json:"code_blocks,omitempty"`
+}
+
+// DocLink is a URL a doc comment links to, with the text it is shown as
+type DocLink struct {
+    Text string `json:"text,omitempty"`
+    URL  string `json:"url"`
+}
+
+// deprecatedPrefix starts the paragraph that deprecates an identifier
+const deprecatedPrefix = "Deprecated: "
+
+// docParser treats every bracketed identifier as a doc link, as the
+// package's symbols are not known when a single file is parsed
+var docParser = comment.Parser{
+    LookupSym: func(recv, name string) bool { return true },
+}
+
+// parseDocComment parses a raw doc comment, returning nil for an empty
+// one. params are the function's parameters, as "name type".
+func parseDocComment(text string, params []string) *DocComment {
+    if strings.TrimSpace(text) == "" {
+        return nil
+    }
+    parsed := docParser.Parse(text)
+    result := &DocComment{Summary: new(doc.Package).Synopsis(text)}
+
+    var words []string
+    var walk func(blocks []comment.Block)
+    walk = func(blocks []comment.Block) {
+        for _, block := range blocks {
+            switch block := block.(type) {
+            case *comment.Paragraph:
+                plain := plainText(block.Text, result)
+                if result.Deprecated == "" && strings.HasPrefix(plain, deprecatedPrefix) {
+                    result.Deprecated = strings.Join(strings.Fields(strings.TrimPrefix(plain, deprecatedPrefix)), " ")
+                }
+                words = append(words, strings.FieldsFunc(plain, notIdentifier)...)
+            case *comment.Heading:
+                plainText(block.Text, result)
+            case *comment.Code:
+                result.CodeBlocks = append(result.CodeBlocks, strings.TrimSuffix(block.Text, "\n"))
+            case *comment.List:
+                for _, item := range block.Items {
+                    walk(item.Content)
+                }
+            }
+        }
+    }
+    walk(parsed.Content)
+
+    for _, param := range params {
+        fields := strings.Fields(param)
+        if len(fields) < 2 {
+            continue
+        }
+        name := strings.TrimSuffix(fields[0], ",")
+        if name != "_" && containsString(words, name) && !containsString(result.Params, name) {
+            result.Params = append(result.Params, name)
+        }
+    }
+    return result
+}
+
+// plainText flattens rich text, collecting its links into the result
+func plainText(text []comment.Text, result *DocComment) string {
+    var b strings.Builder
+    for _, t := range text {
+        switch t := t.(type) {
+        case comment.Plain:
+            b.WriteString(string(t))
+        case comment.Italic:
+            b.WriteString(string(t))
+        case *comment.Link:
+            inner := plainText(t.Text, result)
+            b.WriteString(inner)
+            if t.Auto {
+                inner = ""
+            }
+            if !hasDocLink(result.Links, t.URL) {
+                result.Links = append(result.Links, DocLink{Text: inner, URL: t.URL})
+            }
+        case *comment.DocLink:
+            b.WriteString(plainText(t.Text, result))
+            symbol := t.Name
+            if t.Recv != "" {
+                symbol = t.Recv + "." + symbol
+            }
+            if t.ImportPath != "" {
+                symbol = t.ImportPath + "." + symbol
+            }
+            if !containsString(result.Symbols, symbol) {
+                result.Symbols = append(result.Symbols, symbol)
+            }
+        }
+    }
+    return b.String()
+}
+
+// hasDocLink reports whether links contains url
+func hasDocLink(links []DocLink, url string) bool {
+    for _, link := range links {
+        if link.URL == url {
+            return true
+        }
+    }
+    return false
+}
+
+// notIdentifier splits comment text into the words parameters can be
+// named by
+func notIdentifier(r rune) bool {
+    return r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// docComment returns the function's parsed doc comment, parsing the raw
+// comment of functions from results written before it was recorded
+func (f FunctionInfo) docComment() *DocComment {
+    if f.Doc != nil {
+        return f.Doc
+    }
+    return parseDocComment(f.Comment, f.Parameters)
+}
+
+// attachDocComments parses the doc comments of extracted functions
+func attachDocComments(functions []FunctionInfo) {
+    for i := range functions {
+        functions[i].Doc = parseDocComment(functions[i].Comment, functions[i].Parameters)
+    }
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+    "fmt"
+    "net"
+    "os"
+    "os/exec"
+    "sort"
+    "strings"
+    "time"
+)
+
+// minFreeWorkspaceBytes is the free space below which the workspace check fails
+const minFreeWorkspaceBytes = 1 << 30
+
+// providerHosts are the endpoints a run needs to reach: the git hosting
+// provider and the Go module proxy used when executing functions
+var providerHosts = []string{"github.com:443", "proxy.golang.org:443"}
+
+// DoctorCheck is the outcome of one environment check
+type DoctorCheck struct {
+    Name   string `json:"name"`
+    Passed bool   `json:"passed"`
+    Detail string `json:"detail,omitempty"`
+    Hint   string `json:"hint,omitempty"`
+}
+
+// RunDoctor checks the prerequisites for a run and prints a pass/fail table.
+// It returns false if any check failed.
+func RunDoctor(config Config) bool {
+    checks := []DoctorCheck{
+        checkConfig(config),
+        checkGit(),
+        checkGoToolchain(),
+        checkDatabase(config.DatabaseConfig),
+        checkReplica(config.DatabaseConfig),
+        checkWorkspace(orDefault(config.Workspace.Dir, os.TempDir())),
+    }
+    for i := range config.Shards {
+        check := checkDatabase(config.shardDatabase(i))
+        check.Name = "database shard " + config.shardName(i)
+        checks = append(checks, check)
+    }
+    for _, host := range providerHosts {
+        checks = append(checks, checkReachable(host))
+    }
+    // Enterprise providers are reached over TLS signed by their own CA
+    var enterpriseHosts []string
+    for host := range config.Providers.APIURLs {
+        enterpriseHosts = append(enterpriseHosts, host)
+    }
+    sort.Strings(enterpriseHosts)
+    for _, host := range enterpriseHosts {
+        checks = append(checks, checkProviderTLS(host))
+    }
+
+    fmt.Println("🩺 ENVIRONMENT CHECKS")
+    fmt.Println(strings.Repeat("=", 60))
+
+    healthy := true
+    for _, check := range checks {
+        status := "✅ PASS"
+        if !check.Passed {
+            status = "❌ FAIL"
+            healthy = false
+        }
+        fmt.Printf("%s  %-26s %s\n", status, check.Name, check.Detail)
+        if !check.Passed && check.Hint != "" {
+            fmt.Printf("         ↳ %s\n", check.Hint)
+        }
+    }
+
+    fmt.Println(strings.Repeat("-", 60))
+    if healthy {
+        fmt.Println("All checks passed")
+    } else {
+        fmt.Println("Some checks failed; fix them before starting a long run")
+    }
+    return healthy
+}
+
+// checkConfig validates the loaded configuration
+func checkConfig(config Config) DoctorCheck {
+    check := DoctorCheck{Name: "configuration"}
+    if err := ValidateConfig(config); err != nil {
+        check.Detail = err.Error()
+        check.Hint = "fix the config file or DB_* / FLOQ_* environment variables"
+        return check
+    }
+    check.Passed = true
+    check.Detail = "valid"
+    return check
+}
+
+// checkGit verifies the git CLI is installed
+func checkGit() DoctorCheck {
+    check := DoctorCheck{Name: "git"}
+    out, err := exec.Command("git", "--version").Output()
+    if err != nil {
+        check.Detail = "git not found"
+        check.Hint = "install git and make sure it is on PATH"
+        return check
+    }
+    check.Passed = true
+    check.Detail = strings.TrimSpace(string(out))
+    return check
+}
+
+// checkGoToolchain verifies the go toolchain used to execute functions
+func checkGoToolchain() DoctorCheck {
+    check := DoctorCheck{Name: "go toolchain"}
+    out, err := exec.Command("go", "version").Output()
+    if err != nil {
+        check.Detail = "go not found"
+        check.Hint = "install Go 1.21 or later and make sure it is on PATH"
+        return check
+    }
+    check.Passed = true
+    check.Detail = strings.TrimPrefix(strings.TrimSpace(string(out)), "go version ")
+    return check
+}
+
+// checkDatabase verifies the database accepts connections
+func checkDatabase(config DatabaseConfig) DoctorCheck {
+    check := DoctorCheck{Name: "database"}
+    if config.Driver == DriverMemory {
+        check.Passed = true
+        check.Detail = "in-memory storage, nothing to connect to"
+        return check
+    }
+    if config.Driver == DriverSQL {
+        check.Passed = true
+        check.Detail = "writing SQL dumps, nothing to connect to"
+        return check
+    }
+    target := fmt.Sprintf("%s@%s/%s", config.User, config.describeHosts(), config.Database)
+
+    db, err := openDatabase(config)
+    if err == nil {
+        defer db.Close()
+        err = db.Ping()
+    }
+    if err != nil {
+        check.Detail = fmt.Sprintf("%s: %v", target, err)
+        check.Hint = "check the database is running and the DB_* credentials are correct"
+        return check
+    }
+    check.Passed = true
+    check.Detail = target
+    return check
+}
+
+// checkReplica verifies the read replica, if any, accepts connections. The
+// DSN may hold a password, so it is not shown.
+func checkReplica(config DatabaseConfig) DoctorCheck {
+    check := DoctorCheck{Name: "read replica"}
+    if config.ReplicaDSN == "" || config.Driver == DriverMemory || config.Driver == DriverSQL {
+        check.Passed = true
+        check.Detail = "none configured, reads use the primary"
+        return check
+    }
+
+    db, _, err := openReadDatabase(config)
+    if err == nil {
+        defer db.Close()
+        err = db.Ping()
+    }
+    if err != nil {
+        check.Detail = err.Error()
+        check.Hint = "check DB_REPLICA_DSN"
+        return check
+    }
+    check.Passed = true
+    check.Detail = "reachable"
+    return check
+}
+
+// checkWorkspace verifies the clone workspace is writable and has free space
+func checkWorkspace(dir string) DoctorCheck {
+    check := DoctorCheck{Name: "workspace"}
+
+    probe, err := os.CreateTemp(dir, "floq-doctor-*")
+    if err != nil {
+        check.Detail = fmt.Sprintf("%s is not writable: %v", dir, err)
+        check.Hint = "set TMPDIR to a writable directory"
+        return check
+    }
+    probe.Close()
+    os.Remove(probe.Name())
+
+    free, err := freeDiskSpace(dir)
+    if err != nil {
+        check.Passed = true
+        check.Detail = fmt.Sprintf("%s writable (free space unknown)", dir)
+        return check
+    }
+    check.Detail = fmt.Sprintf("%s, %.1f GiB free", dir, float64(free)/(1<<30))
+    if free < minFreeWorkspaceBytes {
+        check.Hint = "clones need room; free up disk space or point TMPDIR elsewhere"
+        return check
+    }
+    check.Passed = true
+    return check
+}
+
+// checkReachable verifies a TCP connection can be opened to host
+func checkReachable(host string) DoctorCheck {
+    check := DoctorCheck{Name: "network " + strings.TrimSuffix(host, ":443")}
+    conn, err := net.DialTimeout("tcp", host, 5*time.Second)
+    if err != nil {
+        check.Detail = err.Error()
+        check.Hint = "check network access, proxies, and firewall rules"
+        return check
+    }
+    conn.Close()
+    check.Passed = true
+    check.Detail = "reachable"
+    return check
+}
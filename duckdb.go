@@ -0,0 +1,364 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "log"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// defaultDuckDB is the duckdb CLI run when none is configured
+const defaultDuckDB = "duckdb"
+
+// duckDBMetadata declares the metadata tables of a DuckDB export with the
+// names and types of their columns, in order
+var duckDBMetadata = map[string][][2]string{
+    "runs": {{"run_id", "VARCHAR"}, {"retry_of", "VARCHAR"}, {"summary", "JSON"}},
+    "repositories": {
+        {"repository", "VARCHAR"}, {"ref", "VARCHAR"}, {"commit", "VARCHAR"}, {"shard", "VARCHAR"},
+        {"failed", "BOOLEAN"}, {"functions", "INTEGER"}, {"executed", "INTEGER"}, {"errors", "INTEGER"},
+        {"duration_ms", "BIGINT"}, {"result", "JSON"},
+    },
+    "functions": {
+        {"repository", "VARCHAR"}, {"package", "VARCHAR"}, {"name", "VARCHAR"}, {"kind", "VARCHAR"},
+        {"class", "VARCHAR"}, {"file", "VARCHAR"}, {"line", "INTEGER"}, {"signature", "VARCHAR"},
+        {"executed", "BOOLEAN"}, {"output_table", "VARCHAR"}, {"function", "JSON"},
+    },
+    "errors": {{"repository", "VARCHAR"}, {"message", "VARCHAR"}},
+    "output_tables": {
+        {"repository", "VARCHAR"}, {"function", "VARCHAR"}, {"output_table", "VARCHAR"}, {"row_count", "INTEGER"},
+    },
+}
+
+// runOutputs reads the output tables of a run back for exports: from the
+// in-memory storage its repositories shared in a dry run, or from the
+// databases they were stored in
+type runOutputs struct {
+    config DatabaseConfig
+    // memory is the storage shared by the repositories of a dry run
+    memory *MemoryStorage
+    // databases are the connected primary ("") and shards, by shard name
+    databases map[string]*PostgresStorage
+}
+
+// newRunOutputs prepares reading a run's outputs. Repositories of a dry
+// run must store into the returned memory storage.
+func newRunOutputs(config DatabaseConfig) *runOutputs {
+    outputs := &runOutputs{config: config, databases: make(map[string]*PostgresStorage)}
+    if config.Driver == DriverMemory {
+        outputs.memory = NewMemoryStorage()
+    }
+    return outputs
+}
+
+// read returns an output table stored on a shard, or on the primary for
+// an empty shard. It reports false when the table cannot be read back, as
+// with SQL dumps or the tables of a previous dry run.
+func (o *runOutputs) read(shard, table string) (*MemoryTable, bool, error) {
+    if o == nil {
+        return nil, false, nil
+    }
+    if o.memory != nil {
+        return o.memory.ReadTable(table)
+    }
+    if o.config.Driver != "" && o.config.Driver != DriverPostgres {
+        return nil, false, nil
+    }
+
+    db, ok := o.databases[shard]
+    if !ok {
+        config := o.config
+        if shard != "" {
+            found := false
+            for i := range o.config.Shards {
+                if o.config.shardName(i) == shard {
+                    config, found = o.config.shardDatabase(i), true
+                }
+            }
+            if !found {
+                return nil, false, fmt.Errorf("unknown shard %s", shard)
+            }
+        }
+        db = NewPostgresStorage(config)
+        if err := db.Connect(context.Background()); err != nil {
+            return nil, false, err
+        }
+        o.databases[shard] = db
+    }
+    return db.ReadTable(table)
+}
+
+// Close disconnects from the databases outputs were read from
+func (o *runOutputs) Close() {
+    if o == nil {
+        return
+    }
+    for _, db := range o.databases {
+        db.Close()
+    }
+}
+
+// outputTables maps the executed functions of a result to the table their
+// output was stored in, following renames after table name collisions
+func outputTables(result *ProcessingResult) map[string]string {
+    created := make(map[string]bool, len(result.CreatedTables))
+    for _, table := range result.CreatedTables {
+        created[table] = true
+    }
+    tables := make(map[string]string)
+    for _, name := range result.ExecutedFunctions {
+        table := name
+        if result.Ref != "" {
+            table += "_" + refSuffix(result.Ref)
+        }
+        table = tableNameFor(table)
+        for _, collision := range result.TableCollisions {
+            if collision.Function == name && collision.Table == table {
+                table = collision.RenamedTo
+            }
+        }
+        if created[table] {
+            tables[name] = table
+        }
+    }
+    return tables
+}
+
+// duckDBExport collects the NDJSON files a DuckDB database is loaded from
+type duckDBExport struct {
+    dir    string
+    script strings.Builder
+}
+
+// writeRows writes rows as NDJSON to a file of the staging directory, with
+// the keys of each row in the order of columns
+func (e *duckDBExport) writeRows(name string, columns []string, rows []map[string]interface{}) (string, error) {
+    var buf bytes.Buffer
+    for _, row := range rows {
+        buf.WriteByte('{')
+        for i, column := range columns {
+            if i > 0 {
+                buf.WriteByte(',')
+            }
+            key, _ := json.Marshal(column)
+            value, err := json.Marshal(row[column])
+            if err != nil {
+                return "", fmt.Errorf("failed to encode %s.%s: %w", name, column, err)
+            }
+            buf.Write(key)
+            buf.WriteByte(':')
+            buf.Write(value)
+        }
+        buf.WriteString("}\n")
+    }
+    path := filepath.Join(e.dir, filepath.FromSlash(name)+".ndjson")
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+        return "", fmt.Errorf("failed to create staging directory: %w", err)
+    }
+    if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+        return "", fmt.Errorf("failed to write %s rows: %w", name, err)
+    }
+    return path, nil
+}
+
+// addMetadata loads rows into a metadata table declared in duckDBMetadata
+func (e *duckDBExport) addMetadata(table string, rows []map[string]interface{}) error {
+    columns := duckDBMetadata[table]
+    names := make([]string, len(columns))
+    types := make([]string, len(columns))
+    for i, column := range columns {
+        names[i] = column[0]
+        types[i] = fmt.Sprintf("%s: %s", duckDBString(column[0]), duckDBString(column[1]))
+    }
+    path, err := e.writeRows(table, names, rows)
+    if err != nil {
+        return err
+    }
+    fmt.Fprintf(&e.script, "CREATE TABLE %s AS SELECT * FROM read_json(%s, format = 'newline_delimited', columns = {%s});\n",
+        duckDBIdentifier(table), duckDBString(path), strings.Join(types, ", "))
+    return nil
+}
+
+// addOutput loads an output table into the outputs schema, with column
+// types detected from its rows
+func (e *duckDBExport) addOutput(name string, table *MemoryTable) error {
+    var columns []string
+    for _, column := range table.Columns {
+        if !isGeneratedColumn(column) {
+            columns = append(columns, column)
+        }
+    }
+    target := "outputs." + duckDBIdentifier(name)
+    if len(table.Rows) == 0 {
+        if len(columns) == 0 {
+            columns = []string{"data"}
+        }
+        definitions := make([]string, len(columns))
+        for i, column := range columns {
+            definitions[i] = duckDBIdentifier(column) + " VARCHAR"
+        }
+        fmt.Fprintf(&e.script, "CREATE TABLE %s (%s);\n", target, strings.Join(definitions, ", "))
+        return nil
+    }
+    path, err := e.writeRows("outputs/"+name, columns, table.Rows)
+    if err != nil {
+        return err
+    }
+    fmt.Fprintf(&e.script, "CREATE TABLE %s AS SELECT * FROM read_json_auto(%s, format = 'newline_delimited');\n",
+        target, duckDBString(path))
+    return nil
+}
+
+// SaveDuckDBFile writes the run's metadata and the outputs its functions
+// stored into a DuckDB database at filename, by loading NDJSON files with
+// the duckdb CLI
+func SaveDuckDBFile(filename string, run *Run, duckdb string) error {
+    logger := log.New(logOutput, "[DUCKDB] ", log.LstdFlags|log.Lshortfile)
+    dir, err := os.MkdirTemp("", "floq-duckdb-")
+    if err != nil {
+        return fmt.Errorf("failed to create staging directory: %w", err)
+    }
+    defer os.RemoveAll(dir)
+    export := &duckDBExport{dir: dir}
+
+    stats := run.Stats()
+    summary, err := json.Marshal(stats)
+    if err != nil {
+        return fmt.Errorf("failed to encode summary: %w", err)
+    }
+    if err := export.addMetadata("runs", []map[string]interface{}{
+        {"run_id": run.ID, "retry_of": run.RetryOf, "summary": json.RawMessage(summary)},
+    }); err != nil {
+        return err
+    }
+
+    var repositories, functions, errs, tables []map[string]interface{}
+    results := run.Results()
+    outputs := run.outputs
+    defer outputs.Close()
+    var unreadable []string
+    exported := make(map[string]bool)
+
+    for _, repoURL := range run.Repositories() {
+        result := results[repoURL]
+        repository := *result
+        repository.ProcessedFunctions = nil
+        encoded, err := json.Marshal(repository)
+        if err != nil {
+            return fmt.Errorf("failed to encode result of %s: %w", repoURL, err)
+        }
+        repositories = append(repositories, map[string]interface{}{
+            "repository":  repoURL,
+            "ref":         result.Ref,
+            "commit":      result.Commit,
+            "shard":       result.Shard,
+            "failed":      result.Failed,
+            "functions":   len(result.ProcessedFunctions),
+            "executed":    len(result.ExecutedFunctions),
+            "errors":      len(result.Errors),
+            "duration_ms": result.DurationMs,
+            "result":      json.RawMessage(encoded),
+        })
+        for _, message := range result.Errors {
+            errs = append(errs, map[string]interface{}{"repository": repoURL, "message": message})
+        }
+
+        functionTables := outputTables(result)
+        owners := make(map[string]string, len(functionTables))
+        for _, function := range result.ProcessedFunctions {
+            encoded, err := json.Marshal(function)
+            if err != nil {
+                return fmt.Errorf("failed to encode function %s: %w", function.Name, err)
+            }
+            table, executed := functionTables[function.Name]
+            if executed {
+                owners[table] = function.Name
+            }
+            functions = append(functions, map[string]interface{}{
+                "repository":   repoURL,
+                "package":      function.PackageName,
+                "name":         function.Name,
+                "kind":         function.Kind,
+                "class":        function.Class,
+                "file":         function.RelativePath,
+                "line":         function.LineNumber,
+                "signature":    functionSignature(function),
+                "executed":     containsString(result.ExecutedFunctions, function.Name),
+                "output_table": table,
+                "function":     json.RawMessage(encoded),
+            })
+        }
+
+        for _, name := range result.CreatedTables {
+            if exported[name] {
+                continue
+            }
+            table, ok, err := outputs.read(result.Shard, name)
+            if err != nil {
+                return fmt.Errorf("failed to read output table %s: %w", name, err)
+            }
+            if !ok {
+                unreadable = append(unreadable, name)
+                continue
+            }
+            if err := export.addOutput(name, table); err != nil {
+                return err
+            }
+            exported[name] = true
+            tables = append(tables, map[string]interface{}{
+                "repository":   repoURL,
+                "function":     owners[name],
+                "output_table": name,
+                "row_count":    len(table.Rows),
+            })
+        }
+    }
+    for _, metadata := range []struct {
+        table string
+        rows  []map[string]interface{}
+    }{
+        {"repositories", repositories},
+        {"functions", functions},
+        {"errors", errs},
+        {"output_tables", tables},
+    } {
+        if err := export.addMetadata(metadata.table, metadata.rows); err != nil {
+            return err
+        }
+    }
+    if len(unreadable) > 0 {
+        sort.Strings(unreadable)
+        logger.Printf("Left out %d output tables that cannot be read back: %s", len(unreadable), strings.Join(unreadable, ", "))
+    }
+
+    // The schema comes first; the database is replaced as a whole
+    script := "CREATE SCHEMA outputs;\n" + export.script.String()
+    if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+        return fmt.Errorf("failed to replace %s: %w", filename, err)
+    }
+    cmd := exec.Command(orDefault(duckdb, defaultDuckDB), "-bail", filename)
+    cmd.Stdin = strings.NewReader(script)
+    if out, err := cmd.CombinedOutput(); err != nil {
+        os.Remove(filename)
+        return fmt.Errorf("duckdb failed: %w: %s", err, lastLine(out))
+    }
+    logger.Printf("Wrote %d repositories, %d functions and %d output tables to %s",
+        len(repositories), len(functions), len(exported), filename)
+    return nil
+}
+
+// duckDBString quotes a DuckDB string literal
+func duckDBString(s string) string {
+    return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// duckDBIdentifier quotes a DuckDB identifier
+func duckDBIdentifier(name string) string {
+    return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
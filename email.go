@@ -0,0 +1,208 @@
+package main
+
+import (
+    "bytes"
+    "encoding/base64"
+    "fmt"
+    "html/template"
+    "mime/multipart"
+    "net"
+    "net/smtp"
+    "net/textproto"
+    "strings"
+    "time"
+)
+
+// defaultSMTPPort is the mail submission port, which upgrades to TLS with
+// STARTTLS when the server offers it
+const defaultSMTPPort = 587
+
+// EmailConfig configures the email sent with the run summary when a run
+// completes. Nothing is sent without recipients.
+type EmailConfig struct {
+    SMTPHost string `json:"smtp_host,omitempty"`
+    SMTPPort int    `json:"smtp_port"`
+    // Username and Password authenticate with PLAIN auth when set
+    Username string   `json:"username,omitempty"`
+    Password string   `json:"password,omitempty"`
+    From     string   `json:"from,omitempty"`
+    To       []string `json:"to,omitempty"`
+    // AttachHTML attaches the summary rendered as an HTML report
+    AttachHTML bool `json:"attach_html"`
+}
+
+// Enabled reports whether run summaries are emailed
+func (c EmailConfig) Enabled() bool {
+    return len(c.To) > 0
+}
+
+// reportTemplate renders the HTML report attached to summary emails
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>floq run {{.RunID}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+.failed { color: #b00; }
+</style>
+</head>
+<body>
+<h1>floq run {{.RunID}}</h1>
+<table>
+<tr><th>Repositories</th><td>{{.Stats.TotalRepositories}}</td></tr>
+<tr><th>Functions processed</th><td>{{.Stats.TotalFunctions}}</td></tr>
+<tr><th>Functions executed</th><td>{{.Stats.TotalExecuted}}</td></tr>
+<tr><th>Tables created</th><td>{{.Stats.TotalTables}}</td></tr>
+<tr><th>Errors</th><td>{{.Stats.TotalErrors}}</td></tr>
+<tr><th>Processing time</th><td>{{.Stats.ProcessingTimeMs}} ms</td></tr>
+</table>
+{{with .Gate}}
+<h2>Quality gate: {{if .Passed}}passed{{else}}<span class="failed">failed</span>{{end}}</h2>
+<table>
+<tr><th>Check</th><th>Actual</th><th>Threshold</th><th>Result</th></tr>
+{{range .Checks}}<tr><td>{{.Name}}</td><td>{{printf "%.1f" .Actual}}</td><td>{{printf "%.1f" .Threshold}}</td><td>{{if .Passed}}pass{{else}}<span class="failed">fail</span>{{end}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>Repositories</h2>
+<table>
+<tr><th>Repository</th><th>Functions</th><th>Executed</th><th>Tables</th><th>Errors</th></tr>
+{{range .Repositories}}<tr><td>{{.Name}}</td><td>{{len .Result.ProcessedFunctions}}</td><td>{{len .Result.ExecutedFunctions}}</td><td>{{len .Result.CreatedTables}}</td><td>{{len .Result.Errors}}</td></tr>
+{{end}}</table>
+{{range .Repositories}}{{if .Result.Errors}}
+<h3>Errors in {{.Name}}</h3>
+<ul>
+{{range .Result.Errors}}<li>{{.}}</li>
+{{end}}</ul>
+{{end}}{{end}}
+</body>
+</html>
+`))
+
+// reportRepository is a repository's row in the HTML report
+type reportRepository struct {
+    Name   string
+    Result *ProcessingResult
+}
+
+// renderHTMLReport renders the run summary, and the gate result if the
+// gate ran, as an HTML document
+func renderHTMLReport(run *Run, gate *GateResult) ([]byte, error) {
+    results := run.Results()
+    data := struct {
+        RunID        string
+        Stats        ProcessingStats
+        Gate         *GateResult
+        Repositories []reportRepository
+    }{RunID: run.ID, Stats: run.Stats(), Gate: gate}
+    for _, repoURL := range run.Repositories() {
+        data.Repositories = append(data.Repositories, reportRepository{Name: repoURL, Result: results[repoURL]})
+    }
+
+    var buf bytes.Buffer
+    if err := reportTemplate.Execute(&buf, data); err != nil {
+        return nil, fmt.Errorf("failed to render report: %w", err)
+    }
+    return buf.Bytes(), nil
+}
+
+// emailSubject summarizes the run in one line
+func emailSubject(run *Run, gate *GateResult) string {
+    stats := run.Stats()
+    subject := fmt.Sprintf("floq run %s: %d repositories, %d functions executed, %d errors",
+        run.ID, stats.TotalRepositories, stats.TotalExecuted, stats.TotalErrors)
+    if gate != nil && !gate.Passed {
+        subject += ", quality gate failed"
+    }
+    return subject
+}
+
+// buildReportEmail builds the MIME message holding the text summary and,
+// if configured, the HTML report as an attachment
+func buildReportEmail(config EmailConfig, run *Run, gate *GateResult) ([]byte, error) {
+    var summary bytes.Buffer
+    run.WriteSummary(&summary)
+    if gate != nil {
+        gate.Print(&summary)
+    }
+
+    var msg bytes.Buffer
+    writer := multipart.NewWriter(&msg)
+    fmt.Fprintf(&msg, "From: %s\r\n", config.From)
+    fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(config.To, ", "))
+    fmt.Fprintf(&msg, "Subject: %s\r\n", mimeHeader(emailSubject(run, gate)))
+    fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+    fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+    fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", writer.Boundary())
+
+    if err := writeBase64Part(writer, textproto.MIMEHeader{
+        "Content-Type": {"text/plain; charset=utf-8"},
+    }, summary.Bytes()); err != nil {
+        return nil, err
+    }
+
+    if config.AttachHTML {
+        report, err := renderHTMLReport(run, gate)
+        if err != nil {
+            return nil, err
+        }
+        if err := writeBase64Part(writer, textproto.MIMEHeader{
+            "Content-Type":        {"text/html; charset=utf-8"},
+            "Content-Disposition": {fmt.Sprintf(`attachment; filename="floq-report-%s.html"`, run.ID)},
+        }, report); err != nil {
+            return nil, err
+        }
+    }
+
+    if err := writer.Close(); err != nil {
+        return nil, fmt.Errorf("failed to finish email: %w", err)
+    }
+    return msg.Bytes(), nil
+}
+
+// writeBase64Part adds a base64 encoded part, wrapped at 76 characters
+func writeBase64Part(writer *multipart.Writer, header textproto.MIMEHeader, body []byte) error {
+    header.Set("Content-Transfer-Encoding", "base64")
+    part, err := writer.CreatePart(header)
+    if err != nil {
+        return fmt.Errorf("failed to create email part: %w", err)
+    }
+    encoded := base64.StdEncoding.EncodeToString(body)
+    for len(encoded) > 76 {
+        fmt.Fprintf(part, "%s\r\n", encoded[:76])
+        encoded = encoded[76:]
+    }
+    _, err = fmt.Fprintf(part, "%s\r\n", encoded)
+    return err
+}
+
+// mimeHeader encodes a header value that is not plain ASCII
+func mimeHeader(value string) string {
+    for _, r := range value {
+        if r > 127 {
+            return "=?utf-8?b?" + base64.StdEncoding.EncodeToString([]byte(value)) + "?="
+        }
+    }
+    return value
+}
+
+// SendRunReport emails the run summary to the configured recipients. gate
+// is nil when no quality gate ran.
+func SendRunReport(config EmailConfig, run *Run, gate *GateResult) error {
+    msg, err := buildReportEmail(config, run, gate)
+    if err != nil {
+        return err
+    }
+
+    addr := net.JoinHostPort(config.SMTPHost, fmt.Sprint(config.SMTPPort))
+    var auth smtp.Auth
+    if config.Username != "" {
+        auth = smtp.PlainAuth("", config.Username, config.Password, config.SMTPHost)
+    }
+    if err := smtp.SendMail(addr, auth, config.From, config.To, msg); err != nil {
+        return fmt.Errorf("failed to send email via %s: %w", addr, err)
+    }
+    return nil
+}
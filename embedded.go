@@ -0,0 +1,293 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "errors"
+    "fmt"
+    "go/ast"
+    "go/parser"
+    "go/scanner"
+    "go/token"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strconv"
+    "strings"
+)
+
+// Source kinds recorded in FunctionInfo.SourceKind for functions found
+// outside the Go files that are built
+const (
+    // SourceKindGenerate is Go code passed inline to a //go:generate
+    // directive, or a generator program it runs with go run
+    SourceKindGenerate = "generate"
+    // SourceKindTemplate is Go code in a template file, with the template
+    // actions blanked out
+    SourceKindTemplate = "template"
+)
+
+// goTemplateSuffixes are the file name endings of templates producing Go
+// code
+var goTemplateSuffixes = []string{".go.tmpl", ".go.tpl", ".go.template", ".gotmpl", ".gotpl"}
+
+// templatePlaceholder replaces template actions so the surrounding Go code
+// parses; it is a valid package name, identifier, type and expression
+const templatePlaceholder = "floqTemplate"
+
+var (
+    // templateAction matches a template action, including trimming markers
+    templateAction = regexp.MustCompile(`(?s)\{\{.*?\}\}`)
+    // packageClause detects templates that are complete Go files
+    packageClause = regexp.MustCompile(`(?m)^\s*package\s`)
+    // templateFuncName recovers the name of a function whose name is
+    // produced by a template action
+    templateFuncName = regexp.MustCompile(`func\s+(\w*(?:\{\{.*?\}\}\w*)+)`)
+)
+
+// isGoTemplate reports whether a file name looks like a Go code template
+func isGoTemplate(name string) bool {
+    for _, suffix := range goTemplateSuffixes {
+        if strings.HasSuffix(name, suffix) {
+            return true
+        }
+    }
+    return false
+}
+
+// scanEmbeddedGo catalogues the functions of the Go code embedded in
+// //go:generate directives of the repository's Go files, in the generator
+// programs they run, and in Go templates. The functions are never executed.
+func (g *GitHubFunctionExtractor) scanEmbeddedGo(goFiles []string) ([]FunctionInfo, []string) {
+    var functions []FunctionInfo
+    var errs []string
+
+    generators := make(map[string]bool)
+    for _, filePath := range goFiles {
+        found, programs, err := g.scanGenerateDirectives(filePath)
+        if err != nil {
+            errs = append(errs, g.fileError(err, "Failed to scan go:generate directives in %s: %v", g.relativePath(filePath), err))
+            continue
+        }
+        functions = append(functions, found...)
+        for _, program := range programs {
+            generators[program] = true
+        }
+    }
+
+    // Generator programs are usually excluded from the build with
+    // //go:build ignore, so they were not extracted with the other files
+    for _, filePath := range goFiles {
+        if !generators[filePath] || buildExclusion(filePath) == "" {
+            continue
+        }
+        src, err := os.ReadFile(filePath)
+        if err != nil {
+            errs = append(errs, fmt.Sprintf("Failed to read generator %s: %v", g.relativePath(filePath), err))
+            continue
+        }
+        found, err := g.embeddedFunctions(filePath, src, 0, SourceKindGenerate)
+        if err != nil {
+            errs = append(errs, g.fileError(err, "Failed to parse generator %s: %v", g.relativePath(filePath), err))
+        }
+        functions = append(functions, found...)
+    }
+
+    _, err := walkRepository(g.repoPath, func(path string, entry fs.DirEntry) bool {
+        name := entry.Name()
+        if entry.IsDir() && (name == "vendor" || name == ".git") {
+            return true
+        }
+        return g.ignore.IgnoredPath(g.relativePath(path), entry.IsDir()) != nil
+    }, func(path string) error {
+        if !isGoTemplate(path) || !inPaths(g.relativePath(path), g.extractConfig.Paths) {
+            return nil
+        }
+        found, err := g.scanTemplate(path)
+        if err != nil {
+            errs = append(errs, g.fileError(err, "Failed to scan template %s: %v", g.relativePath(path), err))
+        }
+        functions = append(functions, found...)
+        return nil
+    })
+    if err != nil {
+        errs = append(errs, fmt.Sprintf("Failed to find Go templates: %v", err))
+    }
+
+    return functions, errs
+}
+
+// scanGenerateDirectives extracts the functions passed as inline code to the
+// //go:generate directives of a Go file, and returns the generator programs
+// the directives run with go run
+func (g *GitHubFunctionExtractor) scanGenerateDirectives(filePath string) ([]FunctionInfo, []string, error) {
+    file, err := os.Open(filePath)
+    if err != nil {
+        return nil, nil, err
+    }
+    defer file.Close()
+
+    var functions []FunctionInfo
+    var programs []string
+    lines := bufio.NewScanner(file)
+    lines.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+    for line := 1; lines.Scan(); line++ {
+        directive, ok := strings.CutPrefix(lines.Text(), "//go:generate ")
+        if !ok {
+            continue
+        }
+        args, err := splitGenerateArgs(directive)
+        if err != nil {
+            g.logger.Printf("Skipping go:generate directive at %s:%d: %v", g.relativePath(filePath), line, err)
+            continue
+        }
+
+        if len(args) >= 3 && args[0] == "go" && args[1] == "run" {
+            for _, arg := range args[2:] {
+                if strings.HasSuffix(arg, ".go") && !filepath.IsAbs(arg) {
+                    programs = append(programs, filepath.Join(filepath.Dir(filePath), arg))
+                }
+            }
+        }
+
+        // Quoted arguments holding function declarations are inline code
+        for _, arg := range args {
+            if !strings.Contains(arg, "func ") {
+                continue
+            }
+            src := []byte("package " + templatePlaceholder + "\n" + arg)
+            found, err := g.embeddedFunctions(filePath, src, 0, SourceKindGenerate)
+            if err != nil {
+                g.logger.Printf("Skipping go:generate code at %s:%d: %v", g.relativePath(filePath), line, err)
+            }
+            // Inline code shares the directive's line
+            for i := range found {
+                found[i].LineNumber = line
+                found[i].PackageName = ""
+            }
+            functions = append(functions, found...)
+        }
+    }
+    return functions, programs, lines.Err()
+}
+
+// splitGenerateArgs splits a go:generate command line like the go command
+// does: on spaces, with double-quoted arguments using Go string syntax
+func splitGenerateArgs(line string) ([]string, error) {
+    var args []string
+    line = strings.TrimSpace(line)
+    for line != "" {
+        if line[0] == '"' {
+            end := 1
+            for ; end < len(line); end++ {
+                if line[end] == '\\' {
+                    end++
+                } else if line[end] == '"' {
+                    break
+                }
+            }
+            if end >= len(line) {
+                return nil, fmt.Errorf("unterminated quoted string")
+            }
+            arg, err := strconv.Unquote(line[:end+1])
+            if err != nil {
+                return nil, fmt.Errorf("invalid quoted string: %w", err)
+            }
+            args = append(args, arg)
+            line = strings.TrimLeft(line[end+1:], " \t")
+            continue
+        }
+        end := strings.IndexAny(line, " \t")
+        if end < 0 {
+            end = len(line)
+        }
+        args = append(args, line[:end])
+        line = strings.TrimLeft(line[end:], " \t")
+    }
+    return args, nil
+}
+
+// scanTemplate extracts the functions of a Go template. Actions are
+// replaced with a placeholder identifier, keeping line numbers, and
+// declarations the substitution leaves unparseable are skipped.
+func (g *GitHubFunctionExtractor) scanTemplate(filePath string) ([]FunctionInfo, error) {
+    original, err := os.ReadFile(filePath)
+    if err != nil {
+        return nil, err
+    }
+    src := templateAction.ReplaceAllFunc(original, func(action []byte) []byte {
+        return append([]byte(templatePlaceholder), bytes.Repeat([]byte("\n"), bytes.Count(action, []byte("\n")))...)
+    })
+
+    // Fragments without a package clause get one on a line of their own
+    offset := 0
+    if !packageClause.Match(src) {
+        src = append([]byte("package "+templatePlaceholder+"\n"), src...)
+        offset = -1
+    }
+
+    functions, err := g.embeddedFunctions(filePath, src, offset, SourceKindTemplate)
+    originalLines := strings.Split(string(original), "\n")
+    for i := range functions {
+        if functions[i].PackageName == templatePlaceholder {
+            functions[i].PackageName = ""
+        }
+        for _, types := range [][]string{functions[i].Parameters, functions[i].ReturnTypes} {
+            for j := range types {
+                types[j] = strings.ReplaceAll(types[j], templatePlaceholder, "{{…}}")
+            }
+        }
+        if !strings.Contains(functions[i].Name, templatePlaceholder) || functions[i].LineNumber > len(originalLines) {
+            continue
+        }
+        if match := templateFuncName.FindStringSubmatch(originalLines[functions[i].LineNumber-1]); match != nil {
+            functions[i].Name = match[1]
+        }
+    }
+    return functions, err
+}
+
+// embeddedFunctions catalogues the top-level functions of embedded Go
+// source, skipping declarations affected by syntax errors. lineOffset is
+// added to the line numbers, for sources prefixed with a package clause.
+func (g *GitHubFunctionExtractor) embeddedFunctions(filePath string, src []byte, lineOffset int, kind string) ([]FunctionInfo, error) {
+    fset := token.NewFileSet()
+    node, err := parser.ParseFile(fset, filePath, src, parser.ParseComments|parser.AllErrors)
+    var parseErrs scanner.ErrorList
+    if err != nil && (!errors.As(err, &parseErrs) || node == nil || node.Name == nil) {
+        return nil, err
+    }
+
+    var functions []FunctionInfo
+    for i, decl := range node.Decls {
+        funcDecl, ok := decl.(*ast.FuncDecl)
+        if !ok || funcDecl.Recv != nil || funcDecl.Name == nil {
+            continue
+        }
+        if len(parseErrs) > 0 && declAffected(fset, node, i, parseErrs) {
+            continue
+        }
+        function := FunctionInfo{
+            Name:         funcDecl.Name.Name,
+            Kind:         FunctionKindFunc,
+            SourceKind:   kind,
+            FilePath:     filePath,
+            RelativePath: g.relativePath(filePath),
+            PackageName:  node.Name.Name,
+            LineNumber:   fset.Position(funcDecl.Pos()).Line + lineOffset,
+            Column:       fset.Position(funcDecl.Name.Pos()).Column,
+            IsExported:   ast.IsExported(funcDecl.Name.Name),
+        }
+        g.fillSignature(&function, funcDecl.Type)
+        if funcDecl.Doc != nil {
+            function.Comment = funcDecl.Doc.Text()
+        }
+        function.SourceHash = sourceHash(fset, src, funcDecl)
+        functions = append(functions, function)
+    }
+    if len(parseErrs) > 0 {
+        return functions, fmt.Errorf("%d syntax errors, first: %v", len(parseErrs), parseErrs[0])
+    }
+    return functions, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+// ErrorCapRecord describes a repository whose processing stopped early
+// because it reached the maximum number of errors
+type ErrorCapRecord struct {
+    MaxErrors int `json:"max_errors"`
+    // File is the file being processed when the cap was reached
+    File string `json:"file,omitempty"`
+    // SkippedFiles counts the files left unprocessed
+    SkippedFiles int `json:"skipped_files"`
+    // DroppedErrors counts the errors beyond the cap that were not recorded
+    DroppedErrors int `json:"dropped_errors,omitempty"`
+}
+
+// errorCapReached reports whether the repository reached the configured
+// maximum number of errors. The first time it does, the errors beyond the
+// cap are dropped and the truncation is recorded in the result; file is
+// the file being processed and skipped the number of files left. Errors
+// of stores finishing after the cap was reached are dropped too.
+func (g *GitHubFunctionExtractor) errorCapReached(result *ProcessingResult, file string, skipped int) bool {
+    if result.ErrorCap != nil {
+        if extra := len(result.Errors) - result.ErrorCap.MaxErrors; extra > 0 {
+            result.ErrorCap.DroppedErrors += extra
+            result.Errors = result.Errors[:result.ErrorCap.MaxErrors]
+        }
+        return true
+    }
+    limit := g.execConfig.MaxErrors
+    if limit <= 0 || len(result.Errors) < limit {
+        return false
+    }
+    result.ErrorCap = &ErrorCapRecord{
+        MaxErrors:     limit,
+        File:          file,
+        SkippedFiles:  skipped,
+        DroppedErrors: len(result.Errors) - limit,
+    }
+    result.Errors = result.Errors[:limit]
+    g.logger.Printf("Stopping processing of %s after %d errors, %d files not processed", g.repoURL, limit, skipped)
+    return true
+}
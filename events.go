@@ -0,0 +1,225 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+)
+
+// Run event types streamed to dashboards
+const (
+    EventRepositoryStarted  = "repository.started"
+    EventFunctionExecuted   = "function.executed"
+    EventFunctionSkipped    = "function.skipped"
+    EventError              = "error"
+    EventRepositoryFinished = "repository.finished"
+)
+
+// eventHistory is the number of recent events kept for clients that
+// reconnect with Last-Event-ID
+const eventHistory = 512
+
+// eventBuffer is the number of events queued per client before it is
+// considered too slow and disconnected
+const eventBuffer = 256
+
+// eventKeepAlive is how often idle streams get a comment so proxies keep
+// the connection open
+const eventKeepAlive = 15 * time.Second
+
+// RunEvent is a change in a job's progress
+type RunEvent struct {
+    ID       int64     `json:"id"`
+    Type     string    `json:"type"`
+    JobID    int64     `json:"job_id"`
+    RepoURL  string    `json:"repo_url"`
+    Function string    `json:"function,omitempty"`
+    Status   string    `json:"status,omitempty"`
+    Error    string    `json:"error,omitempty"`
+    Time     time.Time `json:"time"`
+}
+
+// EventHub fans run events out to the connected dashboards and keeps the
+// most recent ones for clients catching up
+type EventHub struct {
+    mu          sync.Mutex
+    nextID      int64
+    history     []RunEvent
+    subscribers map[chan RunEvent]bool
+    closed      bool
+}
+
+// NewEventHub creates a hub without subscribers
+func NewEventHub() *EventHub {
+    return &EventHub{subscribers: make(map[chan RunEvent]bool)}
+}
+
+// Publish numbers an event and sends it to every subscriber. Subscribers
+// whose queue is full are dropped; their clients reconnect and catch up.
+func (h *EventHub) Publish(event RunEvent) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    h.nextID++
+    event.ID = h.nextID
+    if event.Time.IsZero() {
+        event.Time = time.Now()
+    }
+    h.history = append(h.history, event)
+    if len(h.history) > eventHistory {
+        h.history = h.history[len(h.history)-eventHistory:]
+    }
+
+    for ch := range h.subscribers {
+        select {
+        case ch <- event:
+        default:
+            delete(h.subscribers, ch)
+            close(ch)
+        }
+    }
+}
+
+// Subscribe returns a channel receiving the events after lastID that are
+// still in the history, followed by new ones, and a function ending the
+// subscription
+func (h *EventHub) Subscribe(lastID int64) (<-chan RunEvent, func()) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    ch := make(chan RunEvent, eventBuffer+eventHistory)
+    for _, event := range h.history {
+        if event.ID > lastID {
+            ch <- event
+        }
+    }
+    if h.closed {
+        close(ch)
+        return ch, func() {}
+    }
+    h.subscribers[ch] = true
+
+    return ch, func() {
+        h.mu.Lock()
+        defer h.mu.Unlock()
+        if h.subscribers[ch] {
+            delete(h.subscribers, ch)
+            close(ch)
+        }
+    }
+}
+
+// Close ends every subscription, so open streams finish and the HTTP
+// server can shut down
+func (h *EventHub) Close() {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    h.closed = true
+    for ch := range h.subscribers {
+        delete(h.subscribers, ch)
+        close(ch)
+    }
+}
+
+// handleEvents streams run events as server-sent events. ?job=N limits the
+// stream to one job; a Last-Event-ID header (sent by EventSource when it
+// reconnects) replays the events missed in between.
+func (s *Service) handleEvents(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+        return
+    }
+
+    var jobID int64
+    if job := r.URL.Query().Get("job"); job != "" {
+        var err error
+        if jobID, err = strconv.ParseInt(job, 10, 64); err != nil {
+            http.Error(w, "job must be a job id", http.StatusBadRequest)
+            return
+        }
+    }
+    lastID, _ := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64)
+
+    events, unsubscribe := s.events.Subscribe(lastID)
+    defer unsubscribe()
+
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.Header().Set("Connection", "keep-alive")
+    w.WriteHeader(http.StatusOK)
+    flusher.Flush()
+
+    keepAlive := time.NewTicker(eventKeepAlive)
+    defer keepAlive.Stop()
+    for {
+        select {
+        case <-r.Context().Done():
+            return
+        case <-keepAlive.C:
+            fmt.Fprint(w, ": keep-alive\n\n")
+            flusher.Flush()
+        case event, ok := <-events:
+            if !ok {
+                return
+            }
+            if jobID != 0 && event.JobID != jobID {
+                continue
+            }
+            data, err := json.Marshal(event)
+            if err != nil {
+                continue
+            }
+            fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+            flusher.Flush()
+        }
+    }
+}
+
+// resultCursor remembers how much of a processing result has been
+// published, so only the delta goes out
+type resultCursor struct {
+    result   *ProcessingResult
+    executed int
+    skipped  int
+    errors   int
+}
+
+// SetEventFunc registers a callback receiving an event for every function
+// executed or skipped and every error, as they are added to the result
+func (g *GitHubFunctionExtractor) SetEventFunc(fn func(RunEvent)) {
+    g.events = fn
+}
+
+// publishDelta sends the functions and errors added to result since the
+// last call
+func (g *GitHubFunctionExtractor) publishDelta(result *ProcessingResult) {
+    if g.events == nil {
+        return
+    }
+    // A new result (e.g. the next historical ref) starts from scratch
+    if g.cursor.result != result {
+        g.cursor = resultCursor{result: result}
+    }
+    cursor := &g.cursor
+
+    for _, name := range result.ExecutedFunctions[cursor.executed:] {
+        g.events(RunEvent{Type: EventFunctionExecuted, RepoURL: g.repoURL, Function: name})
+    }
+    for _, name := range result.SkippedFunctions[cursor.skipped:] {
+        g.events(RunEvent{Type: EventFunctionSkipped, RepoURL: g.repoURL, Function: name})
+    }
+    for _, message := range result.Errors[cursor.errors:] {
+        g.events(RunEvent{Type: EventError, RepoURL: g.repoURL, Error: message})
+    }
+    cursor.executed = len(result.ExecutedFunctions)
+    cursor.skipped = len(result.SkippedFunctions)
+    cursor.errors = len(result.Errors)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "log"
+    "os"
+)
+
+// exporter writes a run in an additional format, either one file per
+// repository (write) or a single file for the whole run (writeRun), or
+// sends it elsewhere (send)
+type exporter struct {
+    extension string
+    write     func(filename, repoURL string, result *ProcessingResult) error
+    runFile   string
+    writeRun  func(filename string, run *Run, config ExportConfig) error
+    send      func(run *Run, config ExportConfig) error
+}
+
+// exporters maps the names accepted in ExportConfig.Formats to their writers
+var exporters = map[string]exporter{
+    "lsif": {
+        extension: ".lsif",
+        write: func(filename, repoURL string, result *ProcessingResult) error {
+            return SaveLSIFFile(filename, repoURL, result.ProcessedFunctions)
+        },
+    },
+    "markdown": {
+        extension: ".md",
+        write: func(filename, repoURL string, result *ProcessingResult) error {
+            return SaveMarkdownCatalog(filename, repoURL, result)
+        },
+    },
+    "stubs": {
+        extension: "-stubs",
+        write: func(dirname, repoURL string, result *ProcessingResult) error {
+            return SaveStubs(dirname, result)
+        },
+    },
+    "dot": {
+        runFile: "graph.dot",
+        writeRun: func(filename string, run *Run, config ExportConfig) error {
+            return saveGraphFile(filename, BuildGraph(run).WriteDOT)
+        },
+    },
+    "cypher": {
+        runFile: "graph.cypher",
+        writeRun: func(filename string, run *Run, config ExportConfig) error {
+            return saveGraphFile(filename, BuildGraph(run).WriteCypher)
+        },
+    },
+    "duckdb": {
+        runFile: "floq-{run_id}.duckdb",
+        writeRun: func(filename string, run *Run, config ExportConfig) error {
+            return SaveDuckDBFile(filename, run, config.DuckDB)
+        },
+    },
+    "http": {
+        send: func(run *Run, config ExportConfig) error {
+            return UploadRun(run, config.Upload)
+        },
+    },
+}
+
+// ExportRun writes every configured export format for a run into the run's
+// artifacts directory, and sends it to the configured destinations
+func ExportRun(run *Run, artifacts *RunArtifacts, config ExportConfig) error {
+    results := run.Results()
+    for _, format := range config.Formats {
+        exp, ok := exporters[format]
+        if !ok {
+            return fmt.Errorf("unsupported export format %q", format)
+        }
+        if exp.send != nil {
+            if err := exp.send(run, config); err != nil {
+                return fmt.Errorf("failed to export %s: %w", format, err)
+            }
+            continue
+        }
+        if exp.writeRun != nil {
+            filename, err := artifacts.Path(exp.runFile)
+            if err != nil {
+                return fmt.Errorf("failed to export %s: %w", format, err)
+            }
+            if err := exp.writeRun(filename, run, config); err != nil {
+                return fmt.Errorf("failed to export %s: %w", format, err)
+            }
+            log.Printf("Exported %s to %s", format, filename)
+            continue
+        }
+        for _, repoURL := range run.Repositories() {
+            filename, err := artifacts.Path(repoSlug(repoURL) + exp.extension)
+            if err != nil {
+                return fmt.Errorf("failed to export %s for %s: %w", format, repoURL, err)
+            }
+            if err := exp.write(filename, repoURL, results[repoURL]); err != nil {
+                return fmt.Errorf("failed to export %s for %s: %w", format, repoURL, err)
+            }
+            log.Printf("Exported %s for %s to %s", format, repoURL, filename)
+        }
+    }
+    return nil
+}
+
+// saveGraphFile writes a rendered graph to filename
+func saveGraphFile(filename string, render func(io.Writer) error) error {
+    file, err := os.Create(filename)
+    if err != nil {
+        return fmt.Errorf("failed to create graph file: %w", err)
+    }
+    defer file.Close()
+
+    w := bufio.NewWriter(file)
+    if err := render(w); err != nil {
+        return fmt.Errorf("failed to write graph: %w", err)
+    }
+    return w.Flush()
+}
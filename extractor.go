@@ -1,96 +1,407 @@
 package main
 
 import (
-    "database/sql"
-    "encoding/json"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
     "fmt"
     "go/ast"
     "go/parser"
+    "go/scanner"
     "go/token"
-    "io/ioutil"
+    "io/fs"
     "log"
     "os"
     "os/exec"
+    "path"
     "path/filepath"
-    "strconv"
+    "runtime"
     "strings"
+    "time"
 
     "github.com/go-git/go-git/v5"
-    _ "github.com/lib/pq"
 )
 
 // FunctionInfo represents extracted function information
 type FunctionInfo struct {
-    Name        string   `json:"name"`
-    FilePath    string   `json:"file_path"`
-    PackageName string   `json:"package_name"`
-    LineNumber  int      `json:"line_number"`
-    Parameters  []string `json:"parameters"`
-    ReturnTypes []string `json:"return_types"`
-    Comment     string   `json:"comment"`
-    IsExported  bool     `json:"is_exported"`
+    Name         string       `json:"name"`
+    // Kind distinguishes declared functions from func-typed variables and
+    // closures; see the FunctionKind constants
+    Kind         string       `json:"kind"`
+    // SourceKind is set for functions found outside the built Go files;
+    // see the SourceKind constants
+    SourceKind   string       `json:"source_kind,omitempty"`
+    // Class is the heuristic role of the function; see the Class constants
+    Class        string       `json:"class"`
+    FilePath     string       `json:"file_path"`
+    RelativePath string       `json:"relative_path"`
+    PackageName  string       `json:"package_name"`
+    LineNumber   int          `json:"line_number"`
+    Column       int          `json:"column"`
+    Parameters   []string     `json:"parameters"`
+    ReturnTypes  []string     `json:"return_types"`
+    // Signature is the normalized form of Parameters and ReturnTypes
+    Signature    *Signature   `json:"signature,omitempty"`
+    Comment      string       `json:"comment"`
+    // Doc is the structure parsed from Comment
+    Doc          *DocComment  `json:"doc,omitempty"`
+    IsExported   bool         `json:"is_exported"`
+    History      *FileHistory `json:"history,omitempty"`
+    SourceHash   string       `json:"source_hash"`
+    // Calls lists the functions this one calls, as "Name" within its own
+    // package or "import/path.Name" for imported packages
+    Calls        []string     `json:"calls,omitempty"`
+    // Directive is the function's //floq:execute or //floq:skip annotation
+    Directive    *ExecutionDirective `json:"directive,omitempty"`
+    // Examples are calls of the function found in the repository's tests
+    Examples     []UsageExample      `json:"examples,omitempty"`
+    // PredictedSchema is the table layout predicted from the return type
+    PredictedSchema *PredictedSchema `json:"predicted_schema,omitempty"`
 }
 
 // ProcessingResult holds the results of repository processing
 type ProcessingResult struct {
-    ProcessedFunctions []FunctionInfo `json:"processed_functions"`
-    CreatedTables      []string       `json:"created_tables"`
-    Errors             []string       `json:"errors"`
-    ExecutedFunctions  []string       `json:"executed_functions"`
+    ProcessedFunctions []FunctionInfo    `json:"processed_functions"`
+    CreatedTables      []string          `json:"created_tables"`
+    Errors             []string          `json:"errors"`
+    ExecutedFunctions  []string          `json:"executed_functions"`
+    // SkippedFunctions were extracted but deliberately not executed, by
+    // execution policy or interactive decision
+    SkippedFunctions   []string          `json:"skipped_functions,omitempty"`
+    // UnsupportedFunctions were not executed because their package needs
+    // assembly, CUDA, or another architecture; see Packages for the reason
+    UnsupportedFunctions []string        `json:"unsupported_functions,omitempty"`
+    Invocations        []Invocation      `json:"invocations,omitempty"`
+    // Representations records how each executed function's output was
+    // captured (json, reflect, gostring, or raw)
+    Representations    map[string]string `json:"representations,omitempty"`
+    CacheHits          int               `json:"cache_hits,omitempty"`
+    CacheMisses        int               `json:"cache_misses,omitempty"`
+    // ExtractionCacheHits and ExtractionCacheMisses count the files whose
+    // functions came from the extraction cache, and those extracted anew
+    ExtractionCacheHits   int            `json:"extraction_cache_hits,omitempty"`
+    ExtractionCacheMisses int            `json:"extraction_cache_misses,omitempty"`
+    ModulePath         string            `json:"module_path,omitempty"`
+    // SyntheticModule is set when the repository had no go.mod and a
+    // temporary module was created to execute its functions
+    SyntheticModule    bool              `json:"synthetic_module,omitempty"`
+    // Sandbox reports the isolation the repository's functions ran under
+    Sandbox            string            `json:"sandbox,omitempty"`
+    // PartialFiles lists files with syntax errors whose unaffected
+    // declarations were still extracted; ParseDiagnostics has the errors
+    PartialFiles       []string          `json:"partial_files,omitempty"`
+    ParseDiagnostics   []ParseDiagnostic `json:"parse_diagnostics,omitempty"`
+    Packages           []PackageInfo     `json:"packages,omitempty"`
+    // Files reports, per Go file, what was extracted and what was skipped
+    // Ref names the historical checkout in time-travel mode; Commit is the
+    // commit processed
+    Ref                string            `json:"ref,omitempty"`
+    Commit             string            `json:"commit,omitempty"`
+    Files              []FileReport      `json:"files,omitempty"`
+    // WalkDiagnostics lists symlinks and case-colliding paths that were
+    // not followed while looking for Go files
+    WalkDiagnostics    []WalkDiagnostic  `json:"walk_diagnostics,omitempty"`
+    // IgnoredPaths lists the files and directories excluded by ignore rules
+    IgnoredPaths       []string          `json:"ignored_paths,omitempty"`
+    // EmbeddedFunctions catalogues the functions of Go code embedded in
+    // go:generate directives and templates; they are never executed
+    EmbeddedFunctions  []FunctionInfo `json:"embedded_functions,omitempty"`
+    // Mocks records the interface implementation each function executed
+    // with a mock received
+    Mocks              map[string]MockUsage `json:"mocks,omitempty"`
+    // AutoArguments records the arguments constructed for functions taking
+    // only contexts and options structs
+    AutoArguments      map[string][]string `json:"auto_arguments,omitempty"`
+    // ToolchainRuns holds the outputs of the toolchain comparison matrix;
+    // DivergentFunctions lists the functions whose outputs differed
+    ToolchainRuns      []ToolchainRun    `json:"toolchain_runs,omitempty"`
+    DivergentFunctions []string          `json:"divergent_functions,omitempty"`
+    // PayloadHashes maps functions to their stored payload when outputs
+    // are deduplicated; DeduplicatedPayloads counts outputs already stored
+    PayloadHashes        map[string]string `json:"payload_hashes,omitempty"`
+    DeduplicatedPayloads int               `json:"deduplicated_payloads,omitempty"`
+    // TruncatedOutputs maps the functions whose output was cut down to
+    // max_payload_rows to the number of rows the output had
+    TruncatedOutputs     map[string]int    `json:"truncated_outputs,omitempty"`
+    // OutputSamples holds the beginning of each executed function's output
+    // when the markdown catalog is exported
+    OutputSamples        map[string]string `json:"output_samples,omitempty"`
+    // Retries marks the executions that hit a resource limit and were
+    // retried with increased limits, and how the retry went
+    Retries              []RetriedExecution `json:"retried_executions,omitempty"`
+    // TableCollisions lists the functions whose table name was already
+    // used in the run and were stored under a disambiguated name
+    TableCollisions      []TableCollision  `json:"table_collisions,omitempty"`
+    // SchemaMismatches lists the functions whose output did not fit the
+    // table pre-created from their predicted schema
+    SchemaMismatches     []string          `json:"schema_mismatches,omitempty"`
+    // Vulnerabilities lists the known vulnerabilities of the dependencies
+    // in go.sum when the vulnerability scan is enabled
+    Vulnerabilities      []Vulnerability   `json:"vulnerabilities,omitempty"`
+    // VulnerabilityBlock explains why no function was executed when a
+    // dependency had a vulnerability at or above the skip severity
+    VulnerabilityBlock   string            `json:"vulnerability_block,omitempty"`
+    // Archives links the processed commit to the mirrors and bundles it
+    // was archived to
+    Archives             []ArchiveRecord   `json:"archives,omitempty"`
+    // WriteBack describes the catalog committed into the repository when
+    // write-back is enabled
+    WriteBack            *WriteBackRecord  `json:"write_back,omitempty"`
+    // ErrorCap is set when processing stopped after the configured
+    // maximum number of errors
+    ErrorCap             *ErrorCapRecord   `json:"error_cap,omitempty"`
+    // StoreQueue describes the queue between execution and storage
+    StoreQueue           *StoreQueueStats  `json:"store_queue,omitempty"`
+    // ExecutionOrder is set when functions ran in a configured order
+    // rather than as the files were walked
+    ExecutionOrder       *ExecutionOrderRecord `json:"execution_order,omitempty"`
+    // Commands are the runs of the repository's main packages
+    Commands             []CommandRun      `json:"commands,omitempty"`
+    // Workspace reports how the clone was cleaned up, when it was wiped
+    // or not removed cleanly
+    Workspace            *WorkspaceReport  `json:"workspace,omitempty"`
+    // Runners are the generated runners kept for debugging
+    Runners              []RunnerRecord    `json:"runners,omitempty"`
+    // Stability scores the functions with an execution history by their
+    // recent runs, and FailingSkipped lists those skipped for failing in
+    // too many runs in a row
+    Stability            map[string]FunctionStability `json:"stability,omitempty"`
+    FailingSkipped       []string          `json:"failing_skipped,omitempty"`
+    // Stubs are the test doubles generated for the exported interfaces
+    // when the stubs format is exported
+    Stubs                []StubFile        `json:"stubs,omitempty"`
+    // DurationMs is how long processing the repository took, and PhaseMs
+    // how much of it was spent in each phase; see the Phase constants
+    DurationMs           int64             `json:"duration_ms,omitempty"`
+    PhaseMs              map[string]int64  `json:"phase_ms,omitempty"`
+    // NotSelected is set when the repository was not processed because
+    // the execution selection excludes it
+    NotSelected          bool              `json:"not_selected,omitempty"`
+    // SkippedByHook is set when a PreClone hook kept the repository out of
+    // the run, to the hooks' name and reason
+    SkippedByHook        string            `json:"skipped_by_hook,omitempty"`
+    // Labels are the metadata the repositories file gave the repository;
+    // Spec is the entry itself, unless it was a bare URL
+    Labels               map[string]string `json:"labels,omitempty"`
+    Spec                 *RepoSpec         `json:"spec,omitempty"`
+    // Failed is set when processing the repository failed as a whole
+    Failed               bool                `json:"failed,omitempty"`
+    // Retried is set when the result was re-processed by a retry of a
+    // previous run
+    Retried              *RetryRecord        `json:"retried,omitempty"`
+    // Dependencies are the versions of the repositories this one depends
+    // on that it was processed against
+    Dependencies         []DependencyVersion `json:"dependencies,omitempty"`
+    // Shard names the database shard holding the repository's tables
+    Shard                string            `json:"shard,omitempty"`
+    // SQLDump is the file the statements were written to with the sql driver
+    SQLDump              string            `json:"sql_dump,omitempty"`
 }
 
 // GitHubFunctionExtractor handles the extraction and execution of functions
 type GitHubFunctionExtractor struct {
-    dbConfig   DatabaseConfig
-    db         *sql.DB
+    dbConfig      DatabaseConfig
+    execConfig    ExecutionConfig
+    extractConfig ExtractionConfig
+    stateConfig   StateConfig
+    vulnConfig    VulnerabilityConfig
+    archiveConfig ArchiveConfig
+    workspaceConfig WorkspaceConfig
+    writeBackConfig WriteBackConfig
+    storage    Storage
+    gitClient  GitClient
+    // cloner is the client the current clone was made with
+    cloner     GitClient
     tempDir    string
     repoPath   string
+    repo       *git.Repository
+    // ref is the historical ref checked out in time-travel mode, or the
+    // pinned ref once checked out
+    ref        *HistoricalRef
+    // pinnedRef is checked out instead of the default branch; see SetRef
+    pinnedRef  string
+    repoURL    string
+    // shard names the database shard the repository's tables are stored on
+    shard      string
+    modulePath string
+    runID      string
     logger     *log.Logger
+
+    historyCache map[string]*FileHistory
+    progress     func(stage string)
+    // events receives the result's delta as functions are processed
+    events       func(RunEvent)
+    cursor       resultCursor
+
+    state       *StateStore
+    depsHash    string
+    // packageHashes are the source hashes of the repository's package
+    // directories, by directory
+    packageHashes map[string]string
+    cacheHits   int
+    cacheMisses int
+    extractionHits   int
+    extractionMisses int
+
+    approver *Approver
+    // isolateNetwork starts compiled runners in a new network namespace
+    isolateNetwork bool
+    // sampleOutputs keeps an excerpt of every output for the catalog
+    sampleOutputs bool
+    // stubs generates test doubles for the exported interfaces
+    stubs bool
+    // limits bound each execution; the retry pass raises them
+    limits ExecutionLimits
+    // selection restricts execution to the matching functions
+    selection *FunctionQuery
+    // dependencies are the repositories processed earlier in the run that
+    // this one depends on
+    dependencies []DependencyVersion
+    // ignore holds the global and repository ignore rules
+    ignore *IgnoreRules
+    // ignoredPaths collects the paths the ignore rules pruned from the walk
+    ignoredPaths []string
+    // tables tracks the table names claimed in the run
+    tables *tableRegistry
+    // phases times the phases of the repository being processed
+    phases *phaseTimer
+    // schemas predicts output schemas from the checkout's types, and
+    // precreated holds the schemas of the tables created before execution
+    schemas    *schemaChecker
+    precreated map[string]*PredictedSchema
+    // runners collects the runners kept for debugging until they are
+    // added to the result
+    runners []RunnerRecord
+    // keptRunners are the directories of the runners kept for the current
+    // repository, wiped along with its workspace when securely wiped
+    keptRunners []string
+    // workspace reports how the last clone was cleaned up, when it was
+    // wiped or not removed cleanly
+    workspace *WorkspaceReport
+    // pipeline queues the stores of the repository being processed; see
+    // startStorePipeline
+    pipeline *storePipeline
+    // hooks are the pipeline hooks registered when the extractor was created
+    hooks []Hooks
 }
 
 // NewGitHubFunctionExtractor creates a new extractor instance
-func NewGitHubFunctionExtractor(config DatabaseConfig) *GitHubFunctionExtractor {
-    logger := log.New(os.Stdout, "[EXTRACTOR] ", log.LstdFlags|log.Lshortfile)
+func NewGitHubFunctionExtractor(config Config) *GitHubFunctionExtractor {
+    logger := log.New(logOutput, "[EXTRACTOR] ", log.LstdFlags|log.Lshortfile)
+
+    // The selection was checked by ValidateConfig
+    selection, _ := config.Execution.Select.Query()
     
     return &GitHubFunctionExtractor{
-        dbConfig: config,
-        logger:   logger,
+        dbConfig:      config.DatabaseConfig,
+        execConfig:    config.Execution,
+        extractConfig: config.Extraction,
+        stateConfig:   config.State,
+        vulnConfig:    config.Vulnerabilities,
+        archiveConfig: config.Archive,
+        workspaceConfig: config.Workspace,
+        writeBackConfig: config.WriteBack,
+        sampleOutputs: containsString(config.Export.Formats, "markdown") || config.WriteBack.Format == WriteBackMarkdown,
+        stubs:         containsString(config.Export.Formats, "stubs"),
+        limits:        executionLimits(config.Execution),
+        selection:     selection,
+        hooks:         currentHooks(),
+        logger:        logger,
     }
 }
 
-// ConnectToDB establishes database connection
-func (g *GitHubFunctionExtractor) ConnectToDB() error {
-    connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-        g.dbConfig.Host, g.dbConfig.Port, g.dbConfig.User, 
-        g.dbConfig.Password, g.dbConfig.Database, g.dbConfig.SSLMode)
+// SetRunID sets the run identifier recorded in generated table comments
+func (g *GitHubFunctionExtractor) SetRunID(runID string) {
+    g.runID = runID
+}
 
-    var err error
-    g.db, err = sql.Open("postgres", connStr)
-    if err != nil {
-        return fmt.Errorf("failed to open database connection: %w", err)
+// SetProgressFunc registers a callback receiving a short description of the
+// current processing stage, e.g. for service mode heartbeats
+func (g *GitHubFunctionExtractor) SetProgressFunc(fn func(stage string)) {
+    g.progress = fn
+}
+
+// SetRef makes ProcessRepository check out a tag, branch or commit instead
+// of the default branch
+func (g *GitHubFunctionExtractor) SetRef(ref string) {
+    g.pinnedRef = ref
+}
+
+// SetSelection restricts execution to the functions matching query; the
+// others are still extracted
+func (g *GitHubFunctionExtractor) SetSelection(query *FunctionQuery) {
+    g.selection = query
+}
+
+// SetApprover makes every execution wait for the approver's decision
+func (g *GitHubFunctionExtractor) SetApprover(approver *Approver) {
+    g.approver = approver
+}
+
+// reportProgress forwards the current stage to the progress callback, if any
+func (g *GitHubFunctionExtractor) reportProgress(format string, args ...interface{}) {
+    if g.progress != nil {
+        g.progress(fmt.Sprintf(format, args...))
     }
+}
+
+// SetStorage replaces the storage selected by the database driver, e.g.
+// to share one in-memory storage between extractors
+func (g *GitHubFunctionExtractor) SetStorage(storage Storage) {
+    g.storage = storage
+}
+
+// SetGitClient replaces the git client chosen from the repository URL
+func (g *GitHubFunctionExtractor) SetGitClient(client GitClient) {
+    g.gitClient = client
+}
 
-    if err = g.db.Ping(); err != nil {
-        return fmt.Errorf("failed to ping database: %w", err)
+// ConnectToDB connects the storage selected by the database driver
+func (g *GitHubFunctionExtractor) ConnectToDB(ctx context.Context) error {
+    if g.storage == nil {
+        config, shard, err := g.shardStorageConfig()
+        if err != nil {
+            return err
+        }
+        storage, err := NewStorage(config)
+        if err != nil {
+            return err
+        }
+        if shard != "" {
+            g.logger.Printf("Storing tables of %s on shard %s", g.repoURL, shard)
+        }
+        g.storage, g.shard = storage, shard
+    }
+    if dump, ok := g.storage.(*SQLDumpStorage); ok {
+        dump.SetPath(g.sqlDumpPath())
     }
+    return g.storage.Connect(ctx)
+}
 
-    g.logger.Println("Connected to PostgreSQL database")
-    return nil
+// sqlDumpPath returns the SQL dump file of the repository and ref being
+// processed
+func (g *GitHubFunctionExtractor) sqlDumpPath() string {
+    name := repoSlug(g.repoURL)
+    if g.ref != nil {
+        name += "@" + refSuffix(g.ref.Name)
+    }
+    return filepath.Join(orDefault(g.dbConfig.DumpDir, defaultDumpDir), name+".sql")
 }
 
-// CloseDB closes the database connection
+// CloseDB closes the storage
 func (g *GitHubFunctionExtractor) CloseDB() error {
-    if g.db != nil {
-        return g.db.Close()
+    if g.storage != nil {
+        return g.storage.Close()
     }
     return nil
 }
 
 // CloneRepository clones a GitHub repository to a temporary directory
-func (g *GitHubFunctionExtractor) CloneRepository(repoURL string) error {
-    tempDir, err := ioutil.TempDir("", "repo_*")
+func (g *GitHubFunctionExtractor) CloneRepository(ctx context.Context, repoURL string) error {
+    tempDir, err := g.createWorkspace()
     if err != nil {
-        return fmt.Errorf("failed to create temp directory: %w", err)
+        return err
     }
 
     g.tempDir = tempDir
@@ -98,10 +409,18 @@ func (g *GitHubFunctionExtractor) CloneRepository(repoURL string) error {
 
     g.logger.Printf("Cloning repository %s to %s", repoURL, g.repoPath)
     
-    _, err = git.PlainClone(g.repoPath, false, &git.CloneOptions{
-        URL:      repoURL,
-        Progress: os.Stdout,
-    })
+    client := g.gitClient
+    if client == nil {
+        client = gitClientFor(repoURL, os.Stdout)
+    }
+    g.cloner = client
+    // Only fetch the configured paths when the client supports it
+    if sparse, ok := client.(SparseCloner); ok && len(g.extractConfig.Paths) > 0 {
+        g.logger.Printf("Checking out only %s", strings.Join(g.extractConfig.Paths, ", "))
+        g.repo, err = sparse.CloneSparse(ctx, repoURL, g.repoPath, g.extractConfig.Paths)
+    } else {
+        g.repo, err = client.Clone(ctx, repoURL, g.repoPath)
+    }
 
     if err != nil {
         return fmt.Errorf("failed to clone repository: %w", err)
@@ -111,109 +430,271 @@ func (g *GitHubFunctionExtractor) CloneRepository(repoURL string) error {
     return nil
 }
 
-// Cleanup removes temporary directories
+// Cleanup removes temporary directories, wiping them when configured, and
+// verifies nothing is left of them
 func (g *GitHubFunctionExtractor) Cleanup() error {
-    if g.tempDir != "" {
-        return os.RemoveAll(g.tempDir)
+    if g.tempDir == "" {
+        return nil
+    }
+    report := removeWorkspace(g.tempDir, g.workspaceConfig.SecureWipe)
+    if g.workspaceConfig.SecureWipe {
+        for _, dir := range g.keptRunners {
+            report.add(removeWorkspace(dir, true))
+            // The repository's runner directory goes once it is empty
+            os.Remove(filepath.Dir(dir))
+        }
+    }
+    g.tempDir = ""
+    g.keptRunners = nil
+    if report.Wiped {
+        g.logger.Printf("Wiped %d files (%d bytes) of workspace %s", report.Files, report.Bytes, report.Dir)
+    }
+    if report.Wiped || !report.Clean() {
+        g.workspace = report
+    }
+    if report.Error != "" {
+        return errors.New(report.Error)
+    }
+    if len(report.Leftovers) > 0 {
+        return fmt.Errorf("workspace %s was not removed: %d paths left", report.Dir, len(report.Leftovers))
     }
     return nil
 }
 
 // FindGoFiles recursively finds all Go files in the repository
 func (g *GitHubFunctionExtractor) FindGoFiles() ([]string, error) {
+    goFiles, _, err := g.findGoFiles()
+    return goFiles, err
+}
+
+// findGoFiles finds the Go files to extract and reports the symlinks and
+// case-colliding paths that were skipped
+func (g *GitHubFunctionExtractor) findGoFiles() ([]string, []WalkDiagnostic, error) {
     var goFiles []string
+    diagnostics, err := g.walkGoFiles(func(path string) error {
+        goFiles = append(goFiles, path)
+        return nil
+    })
+    diagnostics = append(diagnostics, indexCaseCollisions(g.repo, diagnostics)...)
 
-    err := filepath.Walk(g.repoPath, func(path string, info os.FileInfo, err error) error {
-        if err != nil {
-            return err
-        }
+    return goFiles, diagnostics, err
+}
+
+// walkGoFiles calls visit, in lexical order, for every Go file of the
+// repository that is processed, and returns the paths the walk skipped as
+// unsafe
+func (g *GitHubFunctionExtractor) walkGoFiles(visit func(path string) error) ([]WalkDiagnostic, error) {
+    g.ignoredPaths = nil
+    return g.walkSources(false, visit)
+}
 
-        // Skip vendor, .git, and test files
-        if strings.Contains(path, "vendor/") || 
-           strings.Contains(path, ".git/") || 
-           strings.HasSuffix(info.Name(), "_test.go") {
-            if info.IsDir() {
-                return filepath.SkipDir
+// walkTestFiles calls visit for every _test.go file alongside the processed
+// Go files
+func (g *GitHubFunctionExtractor) walkTestFiles(visit func(path string) error) error {
+    _, err := g.walkSources(true, visit)
+    return err
+}
+
+// walkSources walks either the test files or the other Go files of the
+// repository, skipping the same directories and ignored paths for both.
+// Ignored paths are only recorded for the Go files.
+func (g *GitHubFunctionExtractor) walkSources(tests bool, visit func(path string) error) ([]WalkDiagnostic, error) {
+    skip := func(path string, entry fs.DirEntry) bool {
+        // Skip vendor, .git, runner directories, and test files
+        name := entry.Name()
+        if (entry.IsDir() && (name == "vendor" || name == ".git")) ||
+            strings.HasPrefix(name, runnerDirPrefix) ||
+            (!tests && strings.HasSuffix(name, "_test.go")) {
+            return true
+        }
+        if rule := g.ignore.IgnoredPath(g.relativePath(path), entry.IsDir()); rule != nil {
+            if !tests {
+                g.logger.Printf("Ignoring %s: %s %s", g.relativePath(path), rule.Source, rule.Pattern)
+                g.ignoredPaths = append(g.ignoredPaths, g.relativePath(path))
             }
-            return nil
+            return true
         }
-
-        if strings.HasSuffix(info.Name(), ".go") && !info.IsDir() {
-            goFiles = append(goFiles, path)
+        return false
+    }
+    return walkRepository(g.repoPath, skip, func(path string) error {
+        if strings.HasSuffix(path, ".go") && strings.HasSuffix(path, "_test.go") == tests &&
+            inPaths(g.relativePath(path), g.extractConfig.Paths) {
+            return visit(path)
         }
-
         return nil
     })
-
-    return goFiles, err
 }
 
-// ExtractFunctionsFromFile parses a Go file and extracts function information
+// ExtractFunctionsFromFile parses a Go file and extracts function information.
+// Files with syntax errors return the functions that could be recovered
+// along with a *PartialParseError.
 func (g *GitHubFunctionExtractor) ExtractFunctionsFromFile(filePath string) ([]FunctionInfo, error) {
+    return g.extractFile(filePath, nil)
+}
+
+// extractFile extracts a file's functions, recording the declarations it
+// skips in report when one is given
+func (g *GitHubFunctionExtractor) extractFile(filePath string, report *FileReport) ([]FunctionInfo, error) {
     var functions []FunctionInfo
 
     // Create a file set for position information
     fset := token.NewFileSet()
 
-    // Parse the file
-    node, err := parser.ParseFile(fset, filePath, nil, parser.ParseComments)
+    src, err := os.ReadFile(filePath)
     if err != nil {
+        return nil, fmt.Errorf("failed to read file %s: %w", filePath, err)
+    }
+
+    // Parse the file, collecting every syntax error so that declarations
+    // unaffected by them can still be extracted
+    node, err := parser.ParseFile(fset, filePath, src, parser.ParseComments|parser.AllErrors)
+    var parseErrs scanner.ErrorList
+    if err != nil && (!errors.As(err, &parseErrs) || node == nil || node.Name == nil) {
         return nil, fmt.Errorf("failed to parse file %s: %w", filePath, err)
     }
 
     packageName := node.Name.Name
+    imports := fileImports(node)
+    if report != nil {
+        report.Package = packageName
+    }
+
+    relPath := g.relativePath(filePath)
 
     // Extract functions
-    for _, decl := range node.Decls {
+    skipped := 0
+    for i, decl := range node.Decls {
+        if len(parseErrs) > 0 && declAffected(fset, node, i, parseErrs) {
+            skipped++
+            if funcDecl, ok := decl.(*ast.FuncDecl); ok && funcDecl.Name != nil {
+                report.skip(funcDecl.Name.Name, fset.Position(funcDecl.Pos()).Line, SkipReasonSyntaxError)
+            }
+            continue
+        }
         if funcDecl, ok := decl.(*ast.FuncDecl); ok {
             // Skip methods (functions with receivers) and private functions
-            if funcDecl.Recv != nil || !ast.IsExported(funcDecl.Name.Name) {
+            if funcDecl.Recv != nil {
+                report.skip(funcDecl.Name.Name, fset.Position(funcDecl.Pos()).Line, SkipReasonMethod)
                 continue
             }
-
-            function := FunctionInfo{
-                Name:        funcDecl.Name.Name,
-                FilePath:    filePath,
-                PackageName: packageName,
-                LineNumber:  fset.Position(funcDecl.Pos()).Line,
-                IsExported:  ast.IsExported(funcDecl.Name.Name),
+            if !ast.IsExported(funcDecl.Name.Name) {
+                report.skip(funcDecl.Name.Name, fset.Position(funcDecl.Pos()).Line, SkipReasonUnexported)
+                continue
             }
 
-            // Extract parameters
-            if funcDecl.Type.Params != nil {
-                for _, param := range funcDecl.Type.Params.List {
-                    paramType := g.formatType(param.Type)
-                    if len(param.Names) > 0 {
-                        for _, name := range param.Names {
-                            function.Parameters = append(function.Parameters, 
-                                fmt.Sprintf("%s %s", name.Name, paramType))
-                        }
-                    } else {
-                        function.Parameters = append(function.Parameters, paramType)
-                    }
-                }
+            function := FunctionInfo{
+                Name:         funcDecl.Name.Name,
+                Kind:         FunctionKindFunc,
+                FilePath:     filePath,
+                RelativePath: relPath,
+                PackageName:  packageName,
+                LineNumber:   fset.Position(funcDecl.Pos()).Line,
+                Column:       fset.Position(funcDecl.Name.Pos()).Column,
+                IsExported:   ast.IsExported(funcDecl.Name.Name),
             }
 
-            // Extract return types
-            if funcDecl.Type.Results != nil {
-                for _, result := range funcDecl.Type.Results.List {
-                    returnType := g.formatType(result.Type)
-                    function.ReturnTypes = append(function.ReturnTypes, returnType)
-                }
-            }
+            // Extract parameters and return types
+            g.fillSignature(&function, funcDecl.Type)
 
             // Extract comment/documentation
             if funcDecl.Doc != nil {
                 function.Comment = funcDecl.Doc.Text()
             }
+            function.Directive = parseDirective(funcDecl.Doc)
+
+            // Hash the declaration source to detect changes between runs
+            function.SourceHash = sourceHash(fset, src, funcDecl)
+
+            function.Calls = functionCalls(funcDecl.Body, imports)
 
             functions = append(functions, function)
+
+            if g.extractConfig.Closures {
+                functions = append(functions, g.extractClosures(fset, src, funcDecl, function, imports)...)
+            }
+        } else if genDecl, ok := decl.(*ast.GenDecl); ok && g.extractConfig.FuncVariables {
+            functions = append(functions, g.extractFuncVariables(fset, src, genDecl, FunctionInfo{
+                FilePath:     filePath,
+                RelativePath: relPath,
+                PackageName:  packageName,
+            }, imports)...)
+        }
+    }
+
+    for i := range functions {
+        functions[i].Class = classifyFunction(functions[i])
+    }
+
+    // Ignore rules may exclude functions by name or package
+    if len(g.ignore.Rules()) > 0 {
+        importPath := packageImportPath(g.modulePath, path.Dir(relPath))
+        kept := functions[:0]
+        for _, function := range functions {
+            if rule := g.ignore.IgnoredFunction(function, importPath); rule != nil {
+                report.skip(function.Name, function.LineNumber, SkipReasonIgnored+" by "+rule.Source)
+                continue
+            }
+            kept = append(kept, function)
+        }
+        functions = kept
+    }
+
+    if len(parseErrs) > 0 {
+        return functions, &PartialParseError{
+            File:        relPath,
+            Diagnostics: parseDiagnostics(relPath, parseErrs),
+            Skipped:     skipped,
         }
     }
 
     return functions, nil
 }
 
+// relativePath returns a file's slash-separated path relative to the
+// repository root, or the path unchanged outside of a repository
+func (g *GitHubFunctionExtractor) relativePath(filePath string) string {
+    if g.repoPath != "" {
+        if rel, err := filepath.Rel(g.repoPath, filePath); err == nil {
+            return filepath.ToSlash(rel)
+        }
+    }
+    return filePath
+}
+
+// fillSignature extracts the parameters and return types of a function type
+func (g *GitHubFunctionExtractor) fillSignature(function *FunctionInfo, funcType *ast.FuncType) {
+    // Extract parameters
+    if funcType.Params != nil {
+        for _, param := range funcType.Params.List {
+            paramType := g.formatType(param.Type)
+            if len(param.Names) > 0 {
+                for _, name := range param.Names {
+                    function.Parameters = append(function.Parameters, 
+                        fmt.Sprintf("%s %s", name.Name, paramType))
+                }
+            } else {
+                function.Parameters = append(function.Parameters, paramType)
+            }
+        }
+    }
+
+    // Extract return types
+    if funcType.Results != nil {
+        for _, result := range funcType.Results.List {
+            returnType := g.formatType(result.Type)
+            function.ReturnTypes = append(function.ReturnTypes, returnType)
+        }
+    }
+    function.Signature = g.buildSignature(funcType)
+}
+
+// sourceHash hashes the source of a node to detect changes between runs
+func sourceHash(fset *token.FileSet, src []byte, node ast.Node) string {
+    start, end := fset.Position(node.Pos()).Offset, fset.Position(node.End()).Offset
+    sum := sha256.Sum256(src[start:end])
+    return hex.EncodeToString(sum[:])
+}
+
 // formatType converts an AST type to a string representation
 func (g *GitHubFunctionExtractor) formatType(expr ast.Expr) string {
     switch t := expr.(type) {
@@ -235,307 +716,763 @@ func (g *GitHubFunctionExtractor) formatType(expr ast.Expr) string {
 }
 
 // ExecuteFunction attempts to execute a Go function and capture its output
-func (g *GitHubFunctionExtractor) ExecuteFunction(function FunctionInfo) (interface{}, error) {
-    // Only execute functions with no parameters that return data
-    if len(function.Parameters) > 0 {
+func (g *GitHubFunctionExtractor) ExecuteFunction(ctx context.Context, function FunctionInfo) (*ExecutionOutput, error) {
+    // Only execute functions with no parameters that return data, or that
+    // write their data to an io.Writer
+    if len(function.Parameters) > 0 && !isWriterFunction(function) {
         return nil, fmt.Errorf("function %s requires parameters, skipping", function.Name)
     }
 
-    // Create a temporary main.go file to execute the function
-    mainContent := g.generateMainFile(function)
-    
-    tempMainPath := filepath.Join(g.tempDir, "temp_main.go")
-    err := ioutil.WriteFile(tempMainPath, []byte(mainContent), 0644)
-    if err != nil {
-        return nil, fmt.Errorf("failed to create temp main file: %w", err)
-    }
-    defer os.Remove(tempMainPath)
-
-    // Execute the temporary program
-    cmd := exec.Command("go", "run", tempMainPath)
-    cmd.Dir = g.repoPath // Set working directory to repo path for imports
-    
-    output, err := cmd.Output()
-    if err != nil {
-        return nil, fmt.Errorf("failed to execute function %s: %w", function.Name, err)
-    }
+    return g.cachedRun(ctx, function, nil)
+}
 
-    // Try to parse output as JSON
-    var result interface{}
-    if err := json.Unmarshal(output, &result); err != nil {
-        // If not valid JSON, return as string
-        return strings.TrimSpace(string(output)), nil
+// ExecuteFunctionWithArgs executes a Go function with the given argument
+// literals and captures its output
+func (g *GitHubFunctionExtractor) ExecuteFunctionWithArgs(ctx context.Context, function FunctionInfo, args []string) (*ExecutionOutput, error) {
+    if len(args) != len(function.Parameters) {
+        return nil, fmt.Errorf("function %s expects %d arguments, got %d",
+            function.Name, len(function.Parameters), len(args))
     }
 
-    return result, nil
+    return g.cachedRun(ctx, function, args)
 }
 
-// generateMainFile creates a temporary main.go file to execute a function
-func (g *GitHubFunctionExtractor) generateMainFile(function FunctionInfo) string {
-    // Extract package import path relative to repo
-    relPath, _ := filepath.Rel(g.repoPath, filepath.Dir(function.FilePath))
-    
-    var importPath string
-    if relPath == "." {
-        importPath = "."
-    } else {
-        importPath = "./" + strings.ReplaceAll(relPath, "\\", "/")
-    }
+// runnerDirPrefix names the per-execution runner directories created in the
+// repository; FindGoFiles skips them
+const runnerDirPrefix = ".floq-run-"
 
-    return fmt.Sprintf(`package main
+// runFunction generates, runs, and decodes a runner for a function call.
+// Every execution gets its own uniquely named directory inside the module,
+// so concurrent executions in the same repository never share files and the
+// runner never collides with the repository's own files.
+// An empty toolchain builds the runner with the go on PATH.
+func (g *GitHubFunctionExtractor) runFunction(ctx context.Context, function FunctionInfo, args []string, toolchain string) (*ExecutionOutput, error) {
+    defer g.phases.track(PhaseExecute)()
 
-import (
-    "encoding/json"
-    "fmt"
-    "log"
-    
-    pkg "%s"
-)
+    if g.modulePath == "" {
+        return nil, fmt.Errorf("cannot execute function %s: repository has no go.mod", function.Name)
+    }
+    if function.PackageName == "main" {
+        return nil, fmt.Errorf("cannot execute function %s: package main cannot be imported", function.Name)
+    }
 
-func main() {
-    defer func() {
-        if r := recover(); r != nil {
-            log.Printf("Function panicked: %%v", r)
-        }
-    }()
-    
-    result := pkg.%s()
-    
-    // Try to marshal result as JSON
-    jsonResult, err := json.Marshal(result)
+    runnerDir, err := os.MkdirTemp(g.repoPath, runnerDirPrefix+"*")
     if err != nil {
-        // If marshaling fails, print as string
-        fmt.Print(result)
-    } else {
-        fmt.Print(string(jsonResult))
+        return nil, fmt.Errorf("failed to create runner directory: %w", err)
     }
-}
-`, importPath, function.Name)
-}
+    defer os.RemoveAll(runnerDir)
 
-// CreateTableFromData creates a PostgreSQL table based on data structure
-func (g *GitHubFunctionExtractor) CreateTableFromData(tableName string, data interface{}) error {
-    // Drop table if exists
-    dropQuery := fmt.Sprintf("DROP TABLE IF EXISTS %s", tableName)
-    _, err := g.db.Exec(dropQuery)
+    // Create the runner's main.go to execute the function
+    mainContent := g.generateMainFile(function, args)
+    err = os.WriteFile(filepath.Join(runnerDir, "main.go"), []byte(mainContent), 0644)
     if err != nil {
-        return fmt.Errorf("failed to drop existing table: %w", err)
+        return nil, fmt.Errorf("failed to create runner file: %w", err)
     }
 
-    // Determine table structure based on data type
-    var createQuery string
-    
-    switch v := data.(type) {
-    case map[string]interface{}:
-        columns := []string{"id SERIAL PRIMARY KEY"}
-        for key, value := range v {
-            columnType := g.getPostgreSQLType(value)
-            columns = append(columns, fmt.Sprintf("%s %s", key, columnType))
-        }
-        createQuery = fmt.Sprintf("CREATE TABLE %s (%s)", tableName, strings.Join(columns, ", "))
-        
-    case []interface{}:
-        if len(v) > 0 {
-            if firstItem, ok := v[0].(map[string]interface{}); ok {
-                // Array of objects
-                columns := []string{"id SERIAL PRIMARY KEY"}
-                for key, value := range firstItem {
-                    columnType := g.getPostgreSQLType(value)
-                    columns = append(columns, fmt.Sprintf("%s %s", key, columnType))
-                }
-                createQuery = fmt.Sprintf("CREATE TABLE %s (%s)", tableName, strings.Join(columns, ", "))
-            } else {
-                // Array of primitives
-                createQuery = fmt.Sprintf("CREATE TABLE %s (id SERIAL PRIMARY KEY, value TEXT)", tableName)
-            }
-        } else {
-            createQuery = fmt.Sprintf("CREATE TABLE %s (id SERIAL PRIMARY KEY, data JSONB)", tableName)
-        }
-        
-    default:
-        // Single value or unknown structure
-        createQuery = fmt.Sprintf("CREATE TABLE %s (id SERIAL PRIMARY KEY, data JSONB)", tableName)
+    // Build the runner with network access so missing modules can still be
+    // downloaded, then execute it from the module root under the sandbox
+    binary := filepath.Join(runnerDir, "runner")
+    if runtime.GOOS == "windows" {
+        binary += ".exe"
+    }
+    build := g.toolchainCommand(ctx, toolchain, "build", "-o", binary, "./"+filepath.Base(runnerDir))
+    if out, err := build.CombinedOutput(); err != nil {
+        g.keepRunner(function, mainContent, RunnerStageBuild, out)
+        return nil, g.locateErr(fmt.Errorf("failed to build runner for %s: %w: %s", function.Name, err, lastLine(out)), out)
     }
 
-    _, err = g.db.Exec(createQuery)
+    output, err := g.runBinary(ctx, function.Name, binary, nil)
     if err != nil {
-        return fmt.Errorf("failed to create table %s: %w", tableName, err)
+        var exitErr *exec.ExitError
+        var stderr []byte
+        if errors.As(err, &exitErr) {
+            stderr = exitErr.Stderr
+        }
+        g.keepRunner(function, mainContent, RunnerStageRun, stderr)
+        return nil, err
     }
-
-    g.logger.Printf("Created table %s", tableName)
-    return nil
+    g.keepRunner(function, mainContent, "", nil)
+    return parseRunnerOutput(output), nil
 }
 
-// getPostgreSQLType maps Go types to PostgreSQL types
-func (g *GitHubFunctionExtractor) getPostgreSQLType(value interface{}) string {
-    switch value.(type) {
-    case int, int32, int64:
-        return "INTEGER"
-    case float32, float64:
-        return "NUMERIC"
-    case bool:
-        return "BOOLEAN"
-    case []interface{}, map[string]interface{}:
-        return "JSONB"
-    case string:
-        return "TEXT"
-    default:
-        return "TEXT"
-    }
-}
-
-// InsertDataToTable inserts data into PostgreSQL table
-func (g *GitHubFunctionExtractor) InsertDataToTable(tableName string, data interface{}) error {
-    switch v := data.(type) {
-    case map[string]interface{}:
-        return g.insertSingleRecord(tableName, v)
-        
-    case []interface{}:
-        if len(v) > 0 {
-            if _, ok := v[0].(map[string]interface{}); ok {
-                // Array of objects
-                for _, item := range v {
-                    if record, ok := item.(map[string]interface{}); ok {
-                        if err := g.insertSingleRecord(tableName, record); err != nil {
-                            return err
-                        }
-                    }
-                }
-            } else {
-                // Array of primitives
-                for _, item := range v {
-                    query := fmt.Sprintf("INSERT INTO %s (value) VALUES ($1)", tableName)
-                    _, err := g.db.Exec(query, fmt.Sprintf("%v", item))
-                    if err != nil {
-                        return fmt.Errorf("failed to insert primitive value: %w", err)
-                    }
-                }
-            }
+// runBinary runs a built binary with args from the module root, under the
+// execution limits and the sandbox, and returns its standard output. name
+// is the function or command the binary executes, for errors.
+func (g *GitHubFunctionExtractor) runBinary(ctx context.Context, name, binary string, args []string) ([]byte, error) {
+    if g.limits.Timeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, g.limits.Timeout)
+        defer cancel()
+    }
+    cmd := limitedCommand(ctx, binary, g.limits.MemoryMB, args...)
+    cmd.Dir = g.repoPath
+    cmd.WaitDelay = time.Second
+    if g.limits.MemoryMB > 0 {
+        cmd.Env = append(os.Environ(), fmt.Sprintf("GOMEMLIMIT=%dMiB", g.limits.MemoryMB))
+    }
+    if g.isolateNetwork {
+        cmd.SysProcAttr = netnsAttrs()
+    }
+
+    output, err := cmd.Output()
+    if err != nil {
+        var exitErr *exec.ExitError
+        errors.As(err, &exitErr)
+        var stderr []byte
+        if exitErr != nil {
+            stderr = exitErr.Stderr
         }
-        
-    default:
-        // Single value as JSON
-        jsonData, err := json.Marshal(data)
-        if err != nil {
-            return fmt.Errorf("failed to marshal data to JSON: %w", err)
+        if kind := resourceFailure(ctx, err, stderr, g.limits); kind != "" {
+            return nil, &ResourceError{Function: name, Kind: kind, Limits: g.limits, Err: err}
         }
-        
-        query := fmt.Sprintf("INSERT INTO %s (data) VALUES ($1)", tableName)
-        _, err = g.db.Exec(query, string(jsonData))
-        if err != nil {
-            return fmt.Errorf("failed to insert JSON data: %w", err)
+        if exitErr != nil && len(exitErr.Stderr) > 0 {
+            return nil, g.locateErr(fmt.Errorf("failed to execute function %s: %w: %s", name, err, lastLine(exitErr.Stderr)), exitErr.Stderr)
         }
+        return nil, fmt.Errorf("failed to execute function %s: %w", name, err)
     }
+    return output, nil
+}
 
-    g.logger.Printf("Data inserted into table %s", tableName)
-    return nil
+// lastLine returns the last non-empty line of a command's output
+func lastLine(output []byte) string {
+    lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+    return strings.TrimSpace(lines[len(lines)-1])
 }
 
-// insertSingleRecord inserts a single record (map) into a table
-func (g *GitHubFunctionExtractor) insertSingleRecord(tableName string, record map[string]interface{}) error {
-    if len(record) == 0 {
-        return nil
+// StoreTableFromData replaces a table with one shaped for data and holding
+// it, in a single write, and returns the column mapping of object data
+func (g *GitHubFunctionExtractor) StoreTableFromData(ctx context.Context, tableName string, data interface{}) (*ColumnMapping, error) {
+    var mapping *ColumnMapping
+    if records, ok := objectRecords(data); ok {
+        mapping = buildColumnMapping(records, postgreSQLType)
     }
 
-    var columns []string
-    var placeholders []string
-    var values []interface{}
-
-    i := 1
-    for key, value := range record {
-        columns = append(columns, key)
-        placeholders = append(placeholders, "$"+strconv.Itoa(i))
-        
-        // Convert complex types to JSON strings
-        switch v := value.(type) {
-        case []interface{}, map[string]interface{}:
-            jsonData, err := json.Marshal(v)
-            if err != nil {
-                return fmt.Errorf("failed to marshal complex type: %w", err)
-            }
-            values = append(values, string(jsonData))
-        default:
-            values = append(values, value)
-        }
-        i++
+    if err := g.storage.ReplaceTable(ctx, tableName, data, mapping); err != nil {
+        return nil, err
+    }
+    if mapping != nil && mapping.Renamed() {
+        g.logger.Printf("Normalized column names for table %s", tableName)
     }
 
-    query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
-        tableName, strings.Join(columns, ", "), strings.Join(placeholders, ", "))
-
-    _, err := g.db.Exec(query, values...)
-    return err
+    g.logger.Printf("Created table %s", tableName)
+    return mapping, nil
 }
 
-// ProcessRepository is the main method to process a GitHub repository
-func (g *GitHubFunctionExtractor) ProcessRepository(repoURL string) (*ProcessingResult, error) {
-    result := &ProcessingResult{
+// newProcessingResult returns an empty result for one processed checkout
+func newProcessingResult() *ProcessingResult {
+    return &ProcessingResult{
         ProcessedFunctions: []FunctionInfo{},
         CreatedTables:      []string{},
         Errors:             []string{},
         ExecutedFunctions:  []string{},
     }
+}
+
+// ProcessRepository is the main method to process a GitHub repository
+func (g *GitHubFunctionExtractor) ProcessRepository(ctx context.Context, repoURL string) (*ProcessingResult, error) {
+    result := newProcessingResult()
+    g.phases = newPhaseTimer()
+    defer g.stampTiming(result, time.Now())
+
+    g.repoURL = repoURL
+
+    // Targeted harvests do not fetch repositories they cannot match
+    if g.selection != nil && !g.selection.MatchesRepository(repoURL) {
+        g.logger.Printf("Skipping %s: it does not match the selection", repoURL)
+        result.NotSelected = true
+        return result, nil
+    }
+
+    // Hooks may keep repositories out of the run
+    if name, err := g.runPreClone(); err != nil {
+        g.logger.Printf("Skipping %s: %s: %v", repoURL, describeHooks(name), err)
+        result.SkippedByHook = fmt.Sprintf("%s: %v", describeHooks(name), err)
+        return result, nil
+    }
 
     // Clone repository
-    if err := g.CloneRepository(repoURL); err != nil {
+    g.reportProgress("cloning %s", repoURL)
+    stopClone := g.phases.track(PhaseClone)
+    err := g.CloneRepository(ctx, repoURL)
+    stopClone()
+    if err != nil {
         return result, fmt.Errorf("failed to clone repository: %w", err)
     }
-    defer g.Cleanup()
+    defer func() {
+        if err := g.Cleanup(); err != nil {
+            g.logger.Printf("Failed to clean up %s: %v", repoURL, err)
+        }
+        result.Workspace, g.workspace = g.workspace, nil
+        // Wiped runners are gone, so they are not listed
+        if result.Workspace != nil && result.Workspace.Wiped {
+            result.Runners = nil
+        }
+    }()
+
+    // Pinned refs are checked out like historical ones
+    if g.pinnedRef != "" {
+        hash, err := g.resolveRef(ctx, g.pinnedRef)
+        if err != nil {
+            return result, fmt.Errorf("failed to resolve %s: %w", g.pinnedRef, err)
+        }
+        if err := g.checkoutRef(ctx, HistoricalRef{Name: g.pinnedRef, Commit: hash}); err != nil {
+            return result, err
+        }
+        result.Ref, result.Commit = g.pinnedRef, hash
+    }
+
+    // Dependents record which commit of the repository they ran against
+    if g.repo != nil && result.Commit == "" {
+        if head, err := g.repo.Head(); err == nil {
+            result.Commit = head.Hash().String()
+        }
+    }
+
+    result, err = g.processCheckout(ctx, result)
+    if err == nil && g.writeBackConfig.Enabled() {
+        g.reportProgress("writing back catalog of %s", repoURL)
+        g.writeBackCatalog(ctx, result)
+    }
+    return result, err
+}
+
+// stampTiming records how long a repository took since started, and the
+// time spent in each phase
+func (g *GitHubFunctionExtractor) stampTiming(result *ProcessingResult, started time.Time) {
+    result.DurationMs = time.Since(started).Milliseconds()
+    result.PhaseMs = g.phases.milliseconds()
+}
+
+// processCheckout extracts and executes the functions of the files
+// currently checked out in the cloned repository
+func (g *GitHubFunctionExtractor) processCheckout(ctx context.Context, result *ProcessingResult) (*ProcessingResult, error) {
+    // Legacy GOPATH-era repositories need a module before anything can run
+    synthetic, err := g.ensureModule(ctx)
+    if err != nil {
+        return result, err
+    }
+    result.SyntheticModule = synthetic
+
+    // Keep an audit copy of exactly what is about to be processed
+    if g.archiveConfig.Enabled() {
+        g.reportProgress("archiving %s", g.repoURL)
+        g.archiveCheckout(ctx, result)
+    }
+
+    // Decide once per repository whether runners get network isolation
+    g.isolateNetwork, result.Sandbox, err = resolveSandbox(g.execConfig.Sandbox)
+    if err != nil {
+        return result, err
+    }
+    if !g.isolateNetwork && g.execConfig.Sandbox == SandboxAuto {
+        g.logger.Printf("Running functions without sandbox: %s", result.Sandbox)
+    }
+
+    // Open the local state store backing the execution and extraction
+    // caches and the execution histories
+    if g.execConfig.Cache || g.extractConfig.Cache || g.execConfig.Stability.Track {
+        state, err := NewStateStore(g.stateConfig.Dir)
+        if err != nil {
+            return result, fmt.Errorf("failed to open state store: %w", err)
+        }
+        g.state = state
+        g.depsHash = dependencyHash(g.repoPath)
+        g.packageHashes = nil
+    }
 
     // Connect to database
-    if err := g.ConnectToDB(); err != nil {
+    if err := g.ConnectToDB(ctx); err != nil {
         return result, fmt.Errorf("failed to connect to database: %w", err)
     }
     defer g.CloseDB()
+    if dump, ok := g.storage.(*SQLDumpStorage); ok {
+        result.SQLDump = dump.Path()
+    }
+    result.Shard = g.shard
+
+    // Look up the dependencies in the vulnerability database
+    var blocked string
+    if g.vulnConfig.Scan {
+        blocked = g.scanVulnerabilities(ctx, result)
+        if blocked != "" {
+            g.logger.Printf("Skipping execution: %s", blocked)
+            result.VulnerabilityBlock = blocked
+        }
+    }
+
+    // Read the global and repository ignore rules
+    g.ignore, err = LoadIgnoreRules(g.extractConfig.IgnoreFile, g.repoPath)
+    if err != nil {
+        return result, fmt.Errorf("failed to load ignore rules: %w", err)
+    }
 
     // Find Go files
-    goFiles, err := g.FindGoFiles()
+    goFiles, walkDiagnostics, err := g.findGoFiles()
     if err != nil {
         return result, fmt.Errorf("failed to find Go files: %w", err)
     }
+    for _, diagnostic := range walkDiagnostics {
+        g.logger.Printf("Skipping %s", diagnostic)
+    }
+    result.WalkDiagnostics = walkDiagnostics
+    result.IgnoredPaths = g.ignoredPaths
 
     g.logger.Printf("Found %d Go files", len(goFiles))
 
+    // Record the package layout for graph exports
+    result.ModulePath = readModulePath(g.repoPath)
+    g.modulePath = result.ModulePath
+    g.resolveDependencies(result)
+    g.schemas = g.newSchemaChecker()
+    g.precreated = make(map[string]*PredictedSchema)
+    result.Packages = g.ScanPackages(result.ModulePath, goFiles)
+    unsupported := g.markUnsupportedPackages(result.Packages, goFiles)
+
+    // Generate test doubles from the interfaces' full method sets
+    if g.stubs {
+        g.generateStubs(result)
+    }
+
+    // Catalogue the Go code outside the files that are built
+    if g.extractConfig.EmbeddedGo {
+        embedded, errs := g.scanEmbeddedGo(goFiles)
+        attachDocComments(embedded)
+        g.logger.Printf("Found %d functions in embedded Go code", len(embedded))
+        result.EmbeddedFunctions = embedded
+        result.Errors = append(result.Errors, errs...)
+    }
+
+    // Outputs are stored by a consumer of their own while execution goes on
+    g.startStorePipeline()
+    defer g.stopStorePipeline(result)
+
     // Process each Go file
-    for _, filePath := range goFiles {
-        functions, err := g.ExtractFunctionsFromFile(filePath)
-        if err != nil {
+    var deferred []deferredExecution
+    var pending []FunctionInfo
+    for i, filePath := range goFiles {
+        if ctx.Err() != nil {
+            return result, errInterrupted
+        }
+        g.collectStored(result)
+        // A badly broken repository stops before its errors bloat the results
+        if g.errorCapReached(result, "", len(goFiles)-i) {
+            break
+        }
+        g.reportProgress("processing file %d/%d", i+1, len(goFiles))
+        report := FileReport{File: g.relativePath(filePath)}
+
+        // Files the host build excludes could never be executed
+        if reason := buildExclusion(filePath); reason != "" {
+            g.logger.Printf("Skipping %s: %s", report.File, reason)
+            report.Excluded = reason
+            result.Files = append(result.Files, report)
+            continue
+        }
+
+        stopExtract := g.phases.track(PhaseExtract)
+        functions, err := g.cachedExtractFile(filePath, &report)
+        stopExtract()
+        var partial *PartialParseError
+        if errors.As(err, &partial) {
+            g.logger.Printf("Recovered %d functions from %s despite parse errors", len(functions), partial.File)
+            message := partial.Error()
+            for i, diagnostic := range partial.Diagnostics {
+                pos := g.sourcePosition(diagnostic.File, diagnostic.Line, diagnostic.Column)
+                partial.Diagnostics[i].URL = pos.URL
+                if i == 0 {
+                    message = locate(message, pos)
+                }
+            }
+            result.Errors = append(result.Errors, message)
+            result.ParseDiagnostics = append(result.ParseDiagnostics, partial.Diagnostics...)
+            result.PartialFiles = append(result.PartialFiles, partial.File)
+            report.Diagnostics = partial.Diagnostics
+            g.logger.Printf("Skipping execution of functions in %s: the file does not compile", partial.File)
+        } else if err != nil {
             result.Errors = append(result.Errors, 
-                fmt.Sprintf("Failed to extract functions from %s: %v", filePath, err))
+                g.fileError(err, "Failed to extract functions from %s: %v", g.relativePath(filePath), err))
+            report.Error = err.Error()
+            result.Files = append(result.Files, report)
             continue
+        } else {
+            report.Parsed = true
+            stopPredict := g.phases.track(PhaseExtract)
+            g.predictSchemas(functions)
+            stopPredict()
+        }
+        attachDocComments(functions)
+        functions = g.runPostExtract(functions)
+        for _, function := range functions {
+            report.Functions = append(report.Functions, function.Name)
+        }
+        result.Files = append(result.Files, report)
+
+        // Attach git history so the corpus can be filtered by freshness
+        if len(functions) > 0 && g.repo != nil {
+            stopHistory := g.phases.track(PhaseExtract)
+            history, err := g.FileHistory(filePath)
+            stopHistory()
+            if err != nil {
+                g.logger.Printf("Failed to read history for %s: %v", filePath, err)
+            }
+            for i := range functions {
+                functions[i].History = history
+            }
         }
 
-        // Process each function
+        // Queue the functions that may run
+        var queued []FunctionInfo
         for _, function := range functions {
             result.ProcessedFunctions = append(result.ProcessedFunctions, function)
+            if partial != nil || function.Kind == FunctionKindClosure {
+                continue
+            }
+            if g.selection != nil && !g.selection.Matches(g.repoURL, g.modulePath, function) {
+                continue
+            }
+            if blocked != "" {
+                result.SkippedFunctions = append(result.SkippedFunctions, function.Name)
+                continue
+            }
+            // Packages the runners cannot build get a status of their own
+            if reason, ok := unsupported[path.Dir(function.RelativePath)]; ok {
+                g.logger.Printf("Skipping %s: %s", function.Name, reason)
+                result.UnsupportedFunctions = append(result.UnsupportedFunctions, function.Name)
+                continue
+            }
+            queued = append(queued, function)
+        }
+
+        // Functions run as their file is processed, unless an execution
+        // order makes them wait for the rest of the repository
+        if g.ordered() {
+            pending = append(pending, queued...)
+            continue
+        }
+        capped, err := g.executeFunctions(ctx, queued, result, &deferred, len(goFiles)-i-1)
+        if err != nil {
+            return result, err
+        }
+        if capped {
+            break
+        }
+    }
+    if len(pending) > 0 {
+        g.orderFunctions(pending, result)
+        if _, err := g.executeFunctions(ctx, pending, result, &deferred, 0); err != nil {
+            return result, err
+        }
+    }
 
-            // Try to execute function
-            data, err := g.ExecuteFunction(function)
+    // Main packages are run as commands when enabled
+    if g.execConfig.Commands.Enabled && blocked == "" && !g.errorCapReached(result, "", 0) {
+        if err := g.runCommands(ctx, goFiles, result); err != nil {
+            return result, err
+        }
+    }
+    g.collectStored(result)
+    if !g.errorCapReached(result, "", 0) {
+        g.retryResourceFailures(ctx, deferred, result)
+    }
+    g.stopStorePipeline(result)
+    // Signatures are written once the pipeline's consumer is done, as the
+    // storage takes one writer at a time
+    if g.dbConfig.Signatures {
+        g.storeSignatures(ctx, result)
+    }
+    // The last stores may still have reached the cap
+    g.errorCapReached(result, "", 0)
+
+    // Show how the tests call each function
+    g.attachUsageExamples(result.ProcessedFunctions)
+
+    result.CacheHits = g.cacheHits
+    result.CacheMisses = g.cacheMisses
+    result.ExtractionCacheHits = g.extractionHits
+    result.ExtractionCacheMisses = g.extractionMisses
+    result.Runners, g.runners = g.runners, nil
+    g.attachStability(result)
+    g.publishDelta(result)
+
+    return result, nil
+}
+
+// executeFunctions runs the queued functions the execution policy,
+// approval and hooks allow, recording their outputs; executions that hit
+// a resource limit are added to deferred for a retry. It reports whether
+// the error cap was reached, with skipped files left unprocessed.
+func (g *GitHubFunctionExtractor) executeFunctions(ctx context.Context, functions []FunctionInfo, result *ProcessingResult, deferred *[]deferredExecution, skipped int) (bool, error) {
+    var err error
+    for _, function := range functions {
+        if ctx.Err() != nil {
+            return false, errInterrupted
+        }
+        g.collectStored(result)
+        if g.errorCapReached(result, function.RelativePath, skipped) {
+            return true, nil
+        }
+        g.publishDelta(result)
+
+        // Explicit annotations override the policy and heuristics below
+        directive := function.Directive
+        if directive != nil && directive.Error != "" {
+            result.Errors = append(result.Errors,
+                g.functionError(function, "Invalid directive on function %s: %s", function.Name, directive.Error))
+            continue
+        }
+        if directive != nil && directive.Action == DirectiveSkip {
+            g.logger.Printf("Skipping %s: annotated //floq:skip %s", function.Name, directive.Reason)
+            result.SkippedFunctions = append(result.SkippedFunctions, function.Name)
+            continue
+        }
+        annotated := directive != nil && directive.Action == DirectiveExecute
+
+        // The execution policy may exclude whole classes of functions
+        if !annotated && !classAllowed(g.execConfig, function.Class) {
+            g.logger.Printf("Skipping %s: class %s excluded by execution policy", function.Name, function.Class)
+            result.SkippedFunctions = append(result.SkippedFunctions, function.Name)
+            continue
+        }
+
+        // Functions that kept failing in previous runs are not retried
+        // until their source changes
+        if streak, skip := g.skipFailing(function); !annotated && skip {
+            g.logger.Printf("Skipping %s: failed in its last %d runs", function.Name, streak)
+            result.SkippedFunctions = append(result.SkippedFunctions, function.Name)
+            result.FailingSkipped = append(result.FailingSkipped, function.Name)
+            continue
+        }
+
+        // In interactive mode the user decides what runs
+        if g.approver != nil {
+            approved, err := g.approver.Approve(function)
             if err != nil {
-                result.Errors = append(result.Errors, 
-                    fmt.Sprintf("Failed to execute function %s: %v", function.Name, err))
+                g.logger.Printf("Skipping %s: %v", function.Name, err)
+                continue
+            }
+            if !approved {
+                g.logger.Printf("Skipping %s: not approved", function.Name)
+                result.SkippedFunctions = append(result.SkippedFunctions, function.Name)
                 continue
             }
+        }
 
-            if data != nil {
-                // Create table and insert data
-                if err := g.CreateTableFromData(function.Name, data); err != nil {
-                    result.Errors = append(result.Errors, 
-                        fmt.Sprintf("Failed to create table for %s: %v", function.Name, err))
-                    continue
-                }
+        // Hooks have the last word on what runs
+        if name, err := g.runPreExecute(function); err != nil {
+            g.logger.Printf("Skipping %s: vetoed by %s: %v", function.Name, describeHooks(name), err)
+            result.SkippedFunctions = append(result.SkippedFunctions, function.Name)
+            continue
+        }
 
-                if err := g.InsertDataToTable(function.Name, data); err != nil {
-                    result.Errors = append(result.Errors, 
-                        fmt.Sprintf("Failed to insert data for %s: %v", function.Name, err))
-                    continue
-                }
+        // Functions with parameters can only be run with a mock of their
+        // interface parameter, with constructed contexts and options, or
+        // through the fuzzer, unless their directive supplies the arguments
+        annotatedArgs := annotated && len(directive.Arguments) > 0
+        var mock *InterfaceMock
+        if !annotatedArgs && len(function.Parameters) == 1 && !isWriterFunction(function) && g.execConfig.MockInterfaces {
+            mock, err = g.interfaceMock(function)
+            if err != nil {
+                g.logger.Printf("Cannot mock the parameter of %s: %v", function.Name, err)
+            }
+        }
+        var auto *AutoArguments
+        if mock == nil && !annotatedArgs && len(function.Parameters) > 0 && !isWriterFunction(function) && g.execConfig.AutoArguments {
+            // Most functions with parameters need real data, so failing
+            // to construct their arguments is not worth a log line
+            auto, _ = g.autoArguments(function)
+        }
+        if mock == nil && auto == nil && !annotatedArgs && len(function.Parameters) > 0 && !isWriterFunction(function) && g.execConfig.FuzzArguments {
+            g.fuzzFunction(ctx, function, result)
+            continue
+        }
 
-                result.CreatedTables = append(result.CreatedTables, function.Name)
-                result.ExecutedFunctions = append(result.ExecutedFunctions, function.Name)
+        g.precreateTable(ctx, function, result)
+
+        // Try to execute function
+        var args []string
+        if annotatedArgs {
+            args = directive.Arguments
+        } else if mock != nil {
+            g.logger.Printf("Executing %s with a %s mock of %s", function.Name, mock.Strategy, mock.Interface)
+            if result.Mocks == nil {
+                result.Mocks = make(map[string]MockUsage)
+            }
+            result.Mocks[function.Name] = mock.MockUsage
+            args = []string{mockArgument}
+        } else if auto != nil {
+            g.logger.Printf("Executing %s with constructed arguments (%s)", function.Name, strings.Join(auto.Display, ", "))
+            if result.AutoArguments == nil {
+                result.AutoArguments = make(map[string][]string)
+            }
+            result.AutoArguments[function.Name] = auto.Display
+            args = auto.Args
+        }
+        var output *ExecutionOutput
+        if args != nil {
+            output, err = g.ExecuteFunctionWithArgs(ctx, function, args)
+        } else {
+            output, err = g.ExecuteFunction(ctx, function)
+        }
+        if err != nil {
+            // Running out of time or memory earns a second chance at
+            // the end of the repository
+            if g.execConfig.RetryResourceFailures && isResourceError(err) {
+                g.logger.Printf("Deferring %s for a retry: %v", function.Name, err)
+                *deferred = append(*deferred, deferredExecution{function: function, args: args, err: err})
+                continue
             }
+            g.recordStability(function, err)
+            result.Errors = append(result.Errors, 
+                g.functionError(function, "Failed to execute function %s: %v", function.Name, err))
+            continue
         }
+
+        g.recordStability(function, nil)
+        g.recordOutput(ctx, function, output, result)
     }
+    return false, nil
+}
 
-    return result, nil
-}
\ No newline at end of file
+// recordOutput records a successful execution's output: it runs the
+// toolchain comparison and queues the output for storage
+func (g *GitHubFunctionExtractor) recordOutput(ctx context.Context, function FunctionInfo, output *ExecutionOutput, result *ProcessingResult) {
+    // Matrix mode repeats the execution under every configured toolchain
+    if len(g.execConfig.Toolchains) > 0 {
+        g.compareToolchains(ctx, function, result)
+    }
+    g.enqueueStore(result, func(stored *ProcessingResult) {
+        g.storeOutput(ctx, function, output, stored)
+    })
+}
+
+// storeOutput stores an output: it keeps the representation and catalog
+// sample, and writes the output to its table or the deduplicated payload
+// tables
+func (g *GitHubFunctionExtractor) storeOutput(ctx context.Context, function FunctionInfo, output *ExecutionOutput, result *ProcessingResult) {
+    defer g.phases.track(PhaseStore)()
+
+    data := output.Value
+    if output.Representation != RepresentationJSON {
+        g.logger.Printf("Captured %s using %s representation", function.Name, output.Representation)
+    }
+    if result.Representations == nil {
+        result.Representations = make(map[string]string)
+    }
+    result.Representations[function.Name] = output.Representation
+    if g.sampleOutputs && data != nil {
+        if result.OutputSamples == nil {
+            result.OutputSamples = make(map[string]string)
+        }
+        result.OutputSamples[function.Name] = outputSample(data)
+    }
+    if data != nil {
+        data = g.prepareOutput(ctx, function, data, result)
+    }
+
+    // Deduplicated outputs are stored once per distinct payload
+    if data != nil && g.dbConfig.DedupPayloads {
+        if err := g.storePayload(ctx, function, data, result); err != nil {
+            result.Errors = append(result.Errors, 
+                g.functionError(function, "Failed to store output of %s: %v", function.Name, err))
+            return
+        }
+        result.ExecutedFunctions = append(result.ExecutedFunctions, function.Name)
+        return
+    }
+
+    if data != nil {
+        data = g.flattenForStorage(function, data)
+        tableName := g.claimTable(function, g.tableNameFor(function.Name), result)
+
+        // Outputs fitting the table pre-created for them are inserted with
+        // its mapping; the others get a table created from the data
+        mapping, precreated := g.precreatedMapping(function, tableName, data, result)
+        if precreated {
+            if err := g.storage.InsertData(ctx, tableName, data, mapping); err != nil {
+                result.Errors = append(result.Errors,
+                    g.functionError(function, "Failed to insert data for %s: %v", function.Name, err))
+                return
+            }
+            g.logger.Printf("Data inserted into table %s", tableName)
+        } else {
+            // Create the table and insert the data together, so a failed
+            // insert does not leave an empty table behind
+            var err error
+            if mapping, err = g.StoreTableFromData(ctx, tableName, data); err != nil {
+                result.Errors = append(result.Errors, 
+                    g.functionError(function, "Failed to store data for %s: %v", function.Name, err))
+                return
+            }
+        }
+
+        // Describe the table's provenance for people browsing the database
+        if err := g.commentOnTable(ctx, tableName, function, mapping); err != nil {
+            g.logger.Printf("Failed to comment on table %s: %v", tableName, err)
+        }
+        g.runPostInsert(function, tableName, data, result)
+
+        result.CreatedTables = appendMissing(result.CreatedTables, []string{tableName})
+        result.ExecutedFunctions = append(result.ExecutedFunctions, function.Name)
+    }
+}
+
+// fuzzFunction executes a function with parameters against a matrix of
+// generated arguments, recording every invocation and storing the
+// successful ones in a table named after the function
+func (g *GitHubFunctionExtractor) fuzzFunction(ctx context.Context, function FunctionInfo, result *ProcessingResult) {
+    matrix, ok := fuzzArgumentMatrix(function.Parameters, g.execConfig.MaxFuzzCases)
+    if !ok {
+        result.Errors = append(result.Errors,
+            g.functionError(function, "Failed to fuzz function %s: unsupported parameter types %v", function.Name, function.Parameters))
+        return
+    }
+
+    g.logger.Printf("Fuzzing function %s with %d argument sets (experimental)", function.Name, len(matrix))
+
+    var succeeded []Invocation
+    for _, args := range matrix {
+        invocation := Invocation{Function: function.Name, Arguments: args}
+        output, err := g.ExecuteFunctionWithArgs(ctx, function, args)
+        if err != nil {
+            invocation.Error = err.Error()
+        } else {
+            invocation.Output = output.Value
+            invocation.Representation = output.Representation
+            succeeded = append(succeeded, invocation)
+        }
+        result.Invocations = append(result.Invocations, invocation)
+    }
+
+    if len(succeeded) == 0 {
+        result.Errors = append(result.Errors,
+            g.functionError(function, "Failed to execute function %s: no fuzzed invocation succeeded", function.Name))
+        return
+    }
+
+    g.enqueueStore(result, func(stored *ProcessingResult) {
+        tableName := g.claimTable(function, g.tableNameFor(function.Name), stored)
+        if err := g.storeInvocations(ctx, tableName, succeeded); err != nil {
+            stored.Errors = append(stored.Errors,
+                g.functionError(function, "Failed to store invocations for %s: %v", function.Name, err))
+            return
+        }
+        if err := g.commentOnTable(ctx, tableName, function, nil); err != nil {
+            g.logger.Printf("Failed to comment on table %s: %v", tableName, err)
+        }
+
+        stored.CreatedTables = append(stored.CreatedTables, tableName)
+        stored.ExecutedFunctions = append(stored.ExecutedFunctions, function.Name)
+    })
+}
+
+// storeInvocations creates a table holding one row per fuzzed invocation
+func (g *GitHubFunctionExtractor) storeInvocations(ctx context.Context, tableName string, invocations []Invocation) error {
+    defer g.phases.track(PhaseStore)()
+
+    if err := g.storage.StoreInvocations(ctx, tableName, invocations); err != nil {
+        return err
+    }
+
+    g.logger.Printf("Stored %d invocations in table %s", len(invocations), tableName)
+    return nil
+}
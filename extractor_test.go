@@ -0,0 +1,162 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+// TestExtractFunctionsFromCorpus extracts the fixture corpus in place,
+// without cloning or executing anything
+func TestExtractFunctionsFromCorpus(t *testing.T) {
+    extractor := newTestExtractor(t, newFakeGitClient(), NewMemoryStorage())
+    extractor.repoPath = corpusDir
+
+    files, err := extractor.FindGoFiles()
+    if err != nil {
+        t.Fatalf("FindGoFiles: %v", err)
+    }
+
+    extracted := map[string]FunctionInfo{}
+    for _, file := range files {
+        functions, err := extractor.ExtractFunctionsFromFile(file)
+        if err != nil && !strings.HasSuffix(file, filepath.Join("broken", "broken.go")) {
+            t.Fatalf("ExtractFunctionsFromFile(%s): %v", file, err)
+        }
+        for _, function := range functions {
+            extracted[function.Name] = function
+        }
+    }
+
+    for _, name := range []string{"Greeting", "Inventory", "Sum", "Repeat", "Items", "Select"} {
+        if _, ok := extracted[name]; !ok {
+            t.Errorf("function %s was not extracted", name)
+        }
+    }
+    for _, name := range []string{"helper", "Inc"} {
+        if _, ok := extracted[name]; ok {
+            t.Errorf("function %s was extracted, but unexported functions and methods are skipped", name)
+        }
+    }
+
+    sum := extracted["Sum"]
+    if sum.PackageName != "corpus" || sum.RelativePath != "corpus.go" {
+        t.Errorf("Sum is in package %q at %q, want corpus at corpus.go", sum.PackageName, sum.RelativePath)
+    }
+    if strings.Join(sum.Parameters, ", ") != "a int, b int" || strings.Join(sum.ReturnTypes, ", ") != "int" {
+        t.Errorf("Sum has parameters %q and returns %q", sum.Parameters, sum.ReturnTypes)
+    }
+}
+
+// TestProcessRepository runs the whole pipeline on the fixture corpus with a
+// fake git client and in-memory storage
+func TestProcessRepository(t *testing.T) {
+    if testing.Short() {
+        t.Skip("builds and runs the corpus functions")
+    }
+
+    const repoURL = "https://github.com/example/corpus"
+    client := newFakeGitClient()
+    storage := NewMemoryStorage()
+    extractor := newTestExtractor(t, client, storage)
+
+    result, err := extractor.ProcessRepository(context.Background(), repoURL)
+    if err != nil {
+        t.Fatalf("ProcessRepository: %v", err)
+    }
+
+    if clones := client.Clones(); len(clones) != 1 || clones[0] != repoURL {
+        t.Errorf("cloned %q, want [%s]", clones, repoURL)
+    }
+    for _, name := range []string{"Greeting", "Items", "Primes", "Select"} {
+        if !containsString(result.ExecutedFunctions, name) {
+            t.Errorf("function %s was not executed; executed %q", name, result.ExecutedFunctions)
+        }
+    }
+    if containsString(result.ExecutedFunctions, "Shutdown") {
+        t.Errorf("function Shutdown was executed despite its floq:skip directive")
+    }
+    if !hasError(result.Errors, "Failed to execute function Sum") {
+        t.Errorf("missing the error for Sum, which takes parameters; errors: %q", result.Errors)
+    }
+
+    greeting, ok := storage.Table("greeting")
+    if !ok {
+        t.Fatalf("table greeting was not created; tables: %q", storage.TableNames())
+    }
+    if len(greeting.Rows) != 1 || !rowContains(greeting.Rows[0], "hello, corpus") {
+        t.Errorf("greeting holds %v, want one row with \"hello, corpus\"", greeting.Rows)
+    }
+
+    items, ok := storage.Table("items")
+    if !ok {
+        t.Fatalf("table items was not created; tables: %q", storage.TableNames())
+    }
+    if len(items.Rows) != 2 {
+        t.Errorf("items has %d rows, want 2", len(items.Rows))
+    }
+    if !containsString(items.Columns, "name") {
+        t.Errorf("items has columns %q, want a name column", items.Columns)
+    }
+
+    for _, table := range result.CreatedTables {
+        if _, ok := storage.Table(table); !ok {
+            t.Errorf("created table %s is not in the storage", table)
+        }
+    }
+}
+
+// TestProcessRepositoryCloneFailure checks a failed clone stops the
+// repository before anything is stored
+func TestProcessRepositoryCloneFailure(t *testing.T) {
+    client := newFakeGitClient()
+    client.err = errors.New("repository not found")
+    storage := NewMemoryStorage()
+    extractor := newTestExtractor(t, client, storage)
+
+    _, err := extractor.ProcessRepository(context.Background(), "https://github.com/example/missing")
+    if err == nil || !strings.Contains(err.Error(), "repository not found") {
+        t.Fatalf("ProcessRepository returned %v, want the clone error", err)
+    }
+    if names := storage.TableNames(); len(names) != 0 {
+        t.Errorf("tables %q were stored for a repository that failed to clone", names)
+    }
+}
+
+// TestProcessRepositoryCancelled checks a cancelled run does not clone
+func TestProcessRepositoryCancelled(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+
+    extractor := newTestExtractor(t, newFakeGitClient(), NewMemoryStorage())
+    if _, err := extractor.ProcessRepository(ctx, "https://github.com/example/corpus"); !errors.Is(err, context.Canceled) {
+        t.Fatalf("ProcessRepository returned %v, want context.Canceled", err)
+    }
+}
+
+// hasError reports whether one of errs starts with prefix
+func hasError(errs []string, prefix string) bool {
+    for _, err := range errs {
+        if strings.HasPrefix(err, prefix) {
+            return true
+        }
+    }
+    return false
+}
+
+// rowContains reports whether a stored row holds value in one of its
+// columns, directly or as JSON
+func rowContains(row map[string]interface{}, value string) bool {
+    for _, v := range row {
+        if v == value {
+            return true
+        }
+        if data, err := json.Marshal(v); err == nil && strings.Contains(string(data), value) {
+            return true
+        }
+    }
+    return false
+}
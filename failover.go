@@ -0,0 +1,206 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "database/sql/driver"
+    "fmt"
+    "io"
+    "log"
+    "net"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/lib/pq"
+)
+
+// Target session attributes accepted in DatabaseConfig.TargetSessionAttrs
+const (
+    SessionReadWrite = "read-write"
+    SessionAny       = "any"
+)
+
+// failoverConnMaxLifetime bounds how long a pooled connection is reused,
+// so connections to a primary that was demoted without dropping them are
+// eventually replaced by ones to the new primary
+const failoverConnMaxLifetime = 5 * time.Minute
+
+// dbHost is one candidate database server
+type dbHost struct {
+    Host string
+    Port string
+}
+
+// String returns host:port
+func (h dbHost) String() string {
+    return net.JoinHostPort(h.Host, h.Port)
+}
+
+// hostList returns the configured database servers in order of
+// preference: Hosts entries ("host" or "host:port") when set, else Host
+func (c DatabaseConfig) hostList() []dbHost {
+    if len(c.Hosts) == 0 {
+        return []dbHost{{Host: c.Host, Port: c.Port}}
+    }
+    var hosts []dbHost
+    for _, entry := range c.Hosts {
+        if host, port, err := net.SplitHostPort(entry); err == nil {
+            hosts = append(hosts, dbHost{Host: host, Port: port})
+        } else {
+            hosts = append(hosts, dbHost{Host: entry, Port: c.Port})
+        }
+    }
+    return hosts
+}
+
+// targetSessionAttrs returns the session requirement, defaulting to
+// read-write when several hosts are configured
+func (c DatabaseConfig) targetSessionAttrs() string {
+    if c.TargetSessionAttrs != "" {
+        return c.TargetSessionAttrs
+    }
+    if len(c.Hosts) > 1 {
+        return SessionReadWrite
+    }
+    return SessionAny
+}
+
+// describeHosts returns the configured servers for messages
+func (c DatabaseConfig) describeHosts() string {
+    var names []string
+    for _, host := range c.hostList() {
+        names = append(names, host.String())
+    }
+    return strings.Join(names, ",")
+}
+
+// openDatabase opens a connection pool for the configuration. With several
+// hosts or read-write sessions, every new connection tries the hosts in
+// order, starting with the last one that worked, and only accepts a
+// writable primary; the pool replaces broken connections through the same
+// path, so a run survives the primary moving to a standby.
+func openDatabase(config DatabaseConfig) (*sql.DB, error) {
+    if len(config.Hosts) <= 1 && config.targetSessionAttrs() == SessionAny {
+        if len(config.Hosts) == 1 {
+            host := config.hostList()[0]
+            config.Host, config.Port = host.Host, host.Port
+        }
+        return sql.Open("postgres", config.ConnectionString())
+    }
+
+    db := sql.OpenDB(&failoverConnector{
+        config: config,
+        hosts:  config.hostList(),
+        logger: log.New(logOutput, "[DATABASE] ", log.LstdFlags|log.Lshortfile),
+    })
+    db.SetConnMaxLifetime(failoverConnMaxLifetime)
+    return db, nil
+}
+
+// openReadDatabase opens a connection pool for read-only work: the read
+// replica when one is configured, so reads leave the primary to ingest,
+// and the primary otherwise. It reports whether the replica was chosen.
+func openReadDatabase(config DatabaseConfig) (*sql.DB, bool, error) {
+    if config.ReplicaDSN == "" {
+        db, err := openDatabase(config)
+        return db, false, err
+    }
+    db, err := sql.Open("postgres", config.ReplicaDSN)
+    return db, true, err
+}
+
+// failoverConnector connects to the first usable host of a list
+type failoverConnector struct {
+    config  DatabaseConfig
+    hosts   []dbHost
+    logger  *log.Logger
+    mu      sync.Mutex
+    current int
+}
+
+// Connect opens a connection to the first host, starting with the last
+// one that worked, that accepts connections and satisfies the target
+// session attributes
+func (c *failoverConnector) Connect(ctx context.Context) (driver.Conn, error) {
+    c.mu.Lock()
+    start := c.current
+    c.mu.Unlock()
+
+    var failures []string
+    for i := range c.hosts {
+        index := (start + i) % len(c.hosts)
+        host := c.hosts[index]
+
+        conn, err := c.connectHost(ctx, host)
+        if err != nil {
+            failures = append(failures, fmt.Sprintf("%s: %v", host, err))
+            continue
+        }
+
+        c.mu.Lock()
+        if index != c.current {
+            c.logger.Printf("Database failover: now connected to %s", host)
+            c.current = index
+        }
+        c.mu.Unlock()
+        return conn, nil
+    }
+    return nil, fmt.Errorf("no usable database host: %s", strings.Join(failures, "; "))
+}
+
+// connectHost connects to one host and checks it accepts writes when
+// read-write sessions are required
+func (c *failoverConnector) connectHost(ctx context.Context, host dbHost) (driver.Conn, error) {
+    config := c.config
+    config.Host, config.Port = host.Host, host.Port
+    connector, err := pq.NewConnector(config.ConnectionString())
+    if err != nil {
+        return nil, err
+    }
+    conn, err := connector.Connect(ctx)
+    if err != nil {
+        return nil, err
+    }
+    if c.config.targetSessionAttrs() != SessionReadWrite {
+        return conn, nil
+    }
+
+    readOnly, err := sessionReadOnly(ctx, conn)
+    if err == nil && readOnly {
+        err = fmt.Errorf("server is read-only")
+    }
+    if err != nil {
+        conn.Close()
+        return nil, err
+    }
+    return conn, nil
+}
+
+// Driver returns the lib/pq driver
+func (c *failoverConnector) Driver() driver.Driver {
+    return &pq.Driver{}
+}
+
+// sessionReadOnly reports whether a connection's server only accepts
+// reads, as standbys do
+func sessionReadOnly(ctx context.Context, conn driver.Conn) (bool, error) {
+    queryer, ok := conn.(driver.QueryerContext)
+    if !ok {
+        return false, fmt.Errorf("connection cannot run queries")
+    }
+    rows, err := queryer.QueryContext(ctx, "SHOW transaction_read_only", nil)
+    if err != nil {
+        return false, fmt.Errorf("failed to check session: %w", err)
+    }
+    defer rows.Close()
+
+    values := make([]driver.Value, len(rows.Columns()))
+    if err := rows.Next(values); err != nil && err != io.EOF {
+        return false, fmt.Errorf("failed to check session: %w", err)
+    }
+    if len(values) == 0 {
+        return false, fmt.Errorf("failed to check session: no result")
+    }
+    return fmt.Sprintf("%s", values[0]) == "on", nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+    "context"
+    "sync"
+    "testing"
+
+    "github.com/go-git/go-git/v5"
+)
+
+// corpusDir is the fixture corpus the fakes serve in place of a clone
+const corpusDir = "testdata/corpus"
+
+// fakeGitClient serves a local directory for every repository URL, so the
+// extractor can be tested without a git server. It records the URLs it was
+// asked to clone.
+type fakeGitClient struct {
+    mu     sync.Mutex
+    source string
+    // err, when set, fails every clone
+    err    error
+    clones []string
+}
+
+// newFakeGitClient creates a client that clones the fixture corpus
+func newFakeGitClient() *fakeGitClient {
+    return &fakeGitClient{source: corpusDir}
+}
+
+// Clone copies the source directory into dir, whatever repoURL is
+func (f *fakeGitClient) Clone(ctx context.Context, repoURL, dir string) (*git.Repository, error) {
+    f.mu.Lock()
+    f.clones = append(f.clones, repoURL)
+    f.mu.Unlock()
+
+    if f.err != nil {
+        return nil, f.err
+    }
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    return localDirClient{}.Clone(ctx, f.source, dir)
+}
+
+// Fetch fails, as the copies have no origin
+func (f *fakeGitClient) Fetch(ctx context.Context, dir string, refs ...string) error {
+    return errNoHistory
+}
+
+// Checkout fails, as the copies have no commits
+func (f *fakeGitClient) Checkout(ctx context.Context, dir, commit string, paths []string) error {
+    return errNoHistory
+}
+
+// ResolveRef fails, as the copies have no refs
+func (f *fakeGitClient) ResolveRef(ctx context.Context, dir, ref string) (string, error) {
+    return "", errNoHistory
+}
+
+// Clones returns the repository URLs cloned so far
+func (f *fakeGitClient) Clones() []string {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    return append([]string(nil), f.clones...)
+}
+
+// newTestExtractor creates an extractor that clones with client and stores
+// into storage, running functions without a sandbox and keeping its
+// workspaces and state under the test's temporary directory
+func newTestExtractor(t testing.TB, client GitClient, storage Storage) *GitHubFunctionExtractor {
+    config := defaultConfig()
+    config.DatabaseConfig.Driver = DriverMemory
+    config.Execution.Sandbox = SandboxNone
+    config.State.Dir = t.TempDir()
+    config.Workspace.Dir = t.TempDir()
+
+    extractor := NewGitHubFunctionExtractor(config)
+    extractor.SetGitClient(client)
+    extractor.SetStorage(storage)
+    return extractor
+}
+
@@ -0,0 +1,96 @@
+package main
+
+import (
+    "fmt"
+    "go/build"
+    "go/build/constraint"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// Reasons a declaration in a parsed file was not extracted
+const (
+    SkipReasonMethod      = "method"
+    SkipReasonUnexported  = "unexported"
+    SkipReasonSyntaxError = "syntax error"
+    SkipReasonIgnored     = "ignored"
+)
+
+// SkippedDecl is a function declaration that was found in a file but not
+// extracted
+type SkippedDecl struct {
+    Name   string `json:"name"`
+    Line   int    `json:"line"`
+    Reason string `json:"reason"`
+}
+
+// FileReport records what happened to a single Go file during extraction,
+// so users can audit why a function they expected is missing
+type FileReport struct {
+    File    string `json:"file"`
+    Package string `json:"package,omitempty"`
+    // Parsed is true when the file parsed without any syntax error
+    Parsed bool `json:"parsed"`
+    // Excluded explains why the host build excludes the file, by build
+    // constraint or file name suffix; excluded files are not extracted
+    Excluded    string            `json:"excluded,omitempty"`
+    Functions   []string          `json:"functions,omitempty"`
+    Skipped     []SkippedDecl     `json:"skipped,omitempty"`
+    Diagnostics []ParseDiagnostic `json:"diagnostics,omitempty"`
+    Error       string            `json:"error,omitempty"`
+}
+
+// skip records a declaration that was not extracted. It is safe to call on
+// a nil report.
+func (r *FileReport) skip(name string, line int, reason string) {
+    if r == nil {
+        return
+    }
+    r.Skipped = append(r.Skipped, SkippedDecl{Name: name, Line: line, Reason: reason})
+}
+
+// excludedFiles counts the reports of files excluded from the build
+func excludedFiles(reports []FileReport) int {
+    count := 0
+    for _, report := range reports {
+        if report.Excluded != "" {
+            count++
+        }
+    }
+    return count
+}
+
+// buildExclusion reports why the host build context excludes a file, or ""
+// if the file is part of the build. Runners are compiled for the host, so
+// functions in excluded files could not be executed anyway.
+func buildExclusion(filePath string) string {
+    ctxt := build.Default
+    match, err := ctxt.MatchFile(filepath.Dir(filePath), filepath.Base(filePath))
+    if err != nil || match {
+        return ""
+    }
+    if line := buildConstraint(filePath); line != "" {
+        return fmt.Sprintf("%s excludes the file for %s/%s", line, ctxt.GOOS, ctxt.GOARCH)
+    }
+    return fmt.Sprintf("file name excludes the file for %s/%s", ctxt.GOOS, ctxt.GOARCH)
+}
+
+// buildConstraint returns the file's //go:build line, if any, from the
+// comments preceding the package clause
+func buildConstraint(filePath string) string {
+    src, err := os.ReadFile(filePath)
+    if err != nil {
+        return ""
+    }
+    for _, line := range strings.Split(string(src), "\n") {
+        line = strings.TrimSpace(line)
+        if constraint.IsGoBuild(line) {
+            return line
+        }
+        if strings.HasPrefix(line, "package ") {
+            break
+        }
+    }
+    return ""
+}
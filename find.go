@@ -0,0 +1,263 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "path"
+    "regexp"
+    "sort"
+    "strings"
+    "text/tabwriter"
+)
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(value string) error {
+    *s = append(*s, value)
+    return nil
+}
+
+// FunctionQuery filters extracted functions by name and signature
+type FunctionQuery struct {
+    Name     *regexp.Regexp
+    Repo     *regexp.Regexp
+    // Package is matched against the import path and the package name
+    Package  *regexp.Regexp
+    // Keywords must all appear in the doc comment, ignoring case
+    Keywords []string
+    Params   []string
+    Returns  []string
+    Classes  []string
+    NoParams bool
+    // Deprecated keeps only the functions whose doc comment deprecates
+    // them, and NotDeprecated only the others
+    Deprecated    bool
+    NotDeprecated bool
+}
+
+// SelectionConfig is the configured form of a FunctionQuery restricting
+// execution to the matching functions
+type SelectionConfig struct {
+    // Name, Repo and Package are regular expressions
+    Name     string   `json:"name,omitempty"`
+    Repo     string   `json:"repo,omitempty"`
+    Package  string   `json:"package,omitempty"`
+    Keywords []string `json:"keywords,omitempty"`
+}
+
+// Query compiles the selection, returning nil when it selects everything
+func (c SelectionConfig) Query() (*FunctionQuery, error) {
+    if c.Name == "" && c.Repo == "" && c.Package == "" && len(c.Keywords) == 0 {
+        return nil, nil
+    }
+    query := &FunctionQuery{Keywords: c.Keywords}
+    for _, pattern := range []struct {
+        name   string
+        source string
+        target **regexp.Regexp
+    }{
+        {"name", c.Name, &query.Name},
+        {"repo", c.Repo, &query.Repo},
+        {"package", c.Package, &query.Package},
+    } {
+        if pattern.source == "" {
+            continue
+        }
+        compiled, err := regexp.Compile(pattern.source)
+        if err != nil {
+            return nil, fmt.Errorf("invalid selection %s pattern: %w", pattern.name, err)
+        }
+        *pattern.target = compiled
+    }
+    return query, nil
+}
+
+// MatchesRepository reports whether the query can match any function of a
+// repository, so repositories it excludes need not be fetched
+func (q FunctionQuery) MatchesRepository(repoURL string) bool {
+    return q.Repo == nil || q.Repo.MatchString(repoURL)
+}
+
+// Matches reports whether a function of the given repository, whose module
+// path is modulePath, satisfies every filter of the query. Parameter and
+// return types are compared exactly, ignoring parameter names.
+func (q FunctionQuery) Matches(repoURL, modulePath string, function FunctionInfo) bool {
+    if q.Name != nil && !q.Name.MatchString(function.Name) {
+        return false
+    }
+    if !q.MatchesRepository(repoURL) {
+        return false
+    }
+    if q.Package != nil {
+        importPath := packageImportPath(modulePath, path.Dir(function.RelativePath))
+        if !q.Package.MatchString(importPath) && !q.Package.MatchString(function.PackageName) {
+            return false
+        }
+    }
+    if len(q.Keywords) > 0 {
+        comment := strings.ToLower(function.Comment)
+        for _, keyword := range q.Keywords {
+            if !strings.Contains(comment, strings.ToLower(keyword)) {
+                return false
+            }
+        }
+    }
+    if q.NoParams && len(function.Parameters) > 0 {
+        return false
+    }
+    if len(q.Classes) > 0 && !containsString(q.Classes, function.Class) {
+        return false
+    }
+    if q.Deprecated || q.NotDeprecated {
+        doc := function.docComment()
+        deprecated := doc != nil && doc.Deprecated != ""
+        if deprecated != q.Deprecated {
+            return false
+        }
+    }
+
+    paramTypes := make([]string, len(function.Parameters))
+    for i, param := range function.Parameters {
+        paramTypes[i] = parameterType(param)
+    }
+    for _, want := range q.Params {
+        if !containsString(paramTypes, want) {
+            return false
+        }
+    }
+    for _, want := range q.Returns {
+        if !containsString(function.ReturnTypes, want) {
+            return false
+        }
+    }
+    return true
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+    for _, item := range list {
+        if item == s {
+            return true
+        }
+    }
+    return false
+}
+
+// FunctionMatch is a function found by a query
+type FunctionMatch struct {
+    Repository string
+    Function   FunctionInfo
+}
+
+// FindFunctions returns the functions of a run's results matching the
+// query, ordered by repository, file, and line
+func FindFunctions(results *RunResults, query FunctionQuery) []FunctionMatch {
+    var matches []FunctionMatch
+    for repoURL, result := range results.Results {
+        if result == nil {
+            continue
+        }
+        for _, function := range result.ProcessedFunctions {
+            if query.Matches(repoURL, result.ModulePath, function) {
+                matches = append(matches, FunctionMatch{Repository: repoURL, Function: function})
+            }
+        }
+    }
+
+    sort.Slice(matches, func(i, j int) bool {
+        a, b := matches[i], matches[j]
+        if a.Repository != b.Repository {
+            return a.Repository < b.Repository
+        }
+        if a.Function.RelativePath != b.Function.RelativePath {
+            return a.Function.RelativePath < b.Function.RelativePath
+        }
+        return a.Function.LineNumber < b.Function.LineNumber
+    })
+    return matches
+}
+
+// RunFind implements the find subcommand, printing matching functions as
+// repo, file:line, and signature columns. It returns the number of matches.
+func RunFind(config Config, args []string, out io.Writer) (int, error) {
+    fs := flag.NewFlagSet("find", flag.ContinueOnError)
+    name := fs.String("name", "", "regular expression matching function names")
+    repo := fs.String("repo", "", "regular expression matching repository URLs")
+    pkg := fs.String("package", "", "regular expression matching import paths or package names")
+    run := fs.String("run", "", "run id to search instead of the latest run")
+    resultsFile := fs.String("results", "", "results file to search instead of the latest run")
+    noParams := fs.Bool("no-params", false, "only functions without parameters")
+    deprecated := fs.Bool("deprecated", false, "only functions whose doc comment deprecates them")
+    notDeprecated := fs.Bool("no-deprecated", false, "leave out deprecated functions")
+    var params, returns, classes, keywords stringList
+    fs.Var(&keywords, "keyword", "word the doc comment must contain, ignoring case (repeatable)")
+    fs.Var(&params, "param", "parameter type the function must take (repeatable)")
+    fs.Var(&returns, "returns", "type the function must return (repeatable)")
+    fs.Var(&classes, "class", "function class to include (repeatable)")
+    if err := fs.Parse(args); err != nil {
+        return 0, err
+    }
+
+    if *deprecated && *notDeprecated {
+        return 0, fmt.Errorf("-deprecated and -no-deprecated are mutually exclusive")
+    }
+    query := FunctionQuery{Keywords: keywords, Params: params, Returns: returns, Classes: classes, NoParams: *noParams,
+        Deprecated: *deprecated, NotDeprecated: *notDeprecated}
+    var err error
+    if *name != "" {
+        if query.Name, err = regexp.Compile(*name); err != nil {
+            return 0, fmt.Errorf("invalid name pattern: %w", err)
+        }
+    }
+    if *repo != "" {
+        if query.Repo, err = regexp.Compile(*repo); err != nil {
+            return 0, fmt.Errorf("invalid repo pattern: %w", err)
+        }
+    }
+    if *pkg != "" {
+        if query.Package, err = regexp.Compile(*pkg); err != nil {
+            return 0, fmt.Errorf("invalid package pattern: %w", err)
+        }
+    }
+
+    filename := *resultsFile
+    switch {
+    case filename != "":
+    case *run != "":
+        artifacts, err := OpenRunArtifacts(config.Artifacts, *run)
+        if err != nil {
+            return 0, err
+        }
+        if filename, err = artifacts.ResultsPath(); err != nil {
+            return 0, err
+        }
+    default:
+        if filename, err = latestResultsPath(config.Artifacts); err != nil {
+            return 0, err
+        }
+    }
+
+    results, err := LoadResultsFile(filename)
+    if err != nil {
+        return 0, err
+    }
+
+    matches := FindFunctions(results, query)
+    w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+    for _, match := range matches {
+        fmt.Fprintf(w, "%s\t%s:%d\t%s\n", match.Repository, match.Function.RelativePath,
+            match.Function.LineNumber, functionSignature(match.Function))
+    }
+    if err := w.Flush(); err != nil {
+        return len(matches), err
+    }
+    if len(matches) == 0 {
+        fmt.Fprintln(os.Stderr, "no functions matched")
+    }
+    return len(matches), nil
+}
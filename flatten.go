@@ -0,0 +1,174 @@
+package main
+
+import "fmt"
+
+// Modes of a flattening level
+const (
+    // FlattenColumns expands the objects of a level into a column per key
+    FlattenColumns = "columns"
+    // FlattenJSONB keeps the objects of a level whole in a JSONB column
+    FlattenJSONB = "jsonb"
+    // FlattenBoth expands the objects of a level and keeps them whole too
+    FlattenBoth = "both"
+)
+
+// defaultFlattenSeparator joins the keys of a path into a flattened key
+const defaultFlattenSeparator = "."
+
+// maxTableColumns is the most data columns a table may have: PostgreSQL
+// allows 1600 columns, one of which is the generated id
+const maxTableColumns = 1599
+
+// FlattenConfig controls how nested objects in outputs are stored. By
+// default an object nested in an output's objects is stored whole in a
+// JSONB column; flattening expands it into a column per key instead.
+type FlattenConfig struct {
+    // MaxDepth is how many levels of nested objects are expanded; objects
+    // nested deeper stay whole in a JSONB column. Zero disables
+    // flattening unless Levels is set, which then gives the depth.
+    MaxDepth int `json:"max_depth,omitempty"`
+    // Separator joins the keys of a path, e.g. "address.city" (default
+    // "."). Flattened keys are normalized into column names like any
+    // other key, so "address.city" is stored in address_city.
+    Separator string `json:"separator,omitempty"`
+    // Levels sets the mode of each depth, starting at the objects nested
+    // directly in the output's objects: columns (default), jsonb, or both.
+    // A jsonb level keeps its objects whole, so deeper levels are never
+    // reached.
+    Levels []string `json:"levels,omitempty"`
+    // MaxColumns caps the columns of a table: when expanding a level would
+    // exceed it, that level and those below stay in JSONB columns. Tables
+    // never exceed the PostgreSQL limit of 1600 columns.
+    MaxColumns int `json:"max_columns,omitempty"`
+}
+
+// Enabled reports whether nested objects are expanded at all
+func (c FlattenConfig) Enabled() bool {
+    return c.depth() > 0
+}
+
+// depth returns how many levels are expanded at most
+func (c FlattenConfig) depth() int {
+    if c.MaxDepth > 0 {
+        return c.MaxDepth
+    }
+    return len(c.Levels)
+}
+
+// mode returns the mode of a depth, starting at 1
+func (c FlattenConfig) mode(depth int) string {
+    if depth <= len(c.Levels) && c.Levels[depth-1] != "" {
+        return c.Levels[depth-1]
+    }
+    return FlattenColumns
+}
+
+// columnLimit returns the most columns a flattened table may have
+func (c FlattenConfig) columnLimit() int {
+    if c.MaxColumns > 0 && c.MaxColumns < maxTableColumns {
+        return c.MaxColumns
+    }
+    return maxTableColumns
+}
+
+// validate checks the flattening settings
+func (c FlattenConfig) validate() error {
+    if c.MaxDepth < 0 || c.MaxColumns < 0 {
+        return fmt.Errorf("flatten max depth and max columns must not be negative")
+    }
+    for _, mode := range c.Levels {
+        switch mode {
+        case FlattenColumns, FlattenJSONB, FlattenBoth:
+        default:
+            return fmt.Errorf("unsupported flatten level mode %q, want columns, jsonb or both", mode)
+        }
+    }
+    return nil
+}
+
+// flattenOutput expands the nested objects of an output's objects into
+// keys joined by the separator, as deep as the configuration allows and
+// the column limit leaves room for. It returns the output to store, with
+// the same shape as data, and the depth that was expanded. Arrays and
+// empty objects are kept whole.
+func flattenOutput(data interface{}, config FlattenConfig) (interface{}, int) {
+    records, ok := objectRecords(data)
+    if !ok || !config.Enabled() {
+        return data, 0
+    }
+
+    // Each level dropped removes columns, until the table fits
+    var flattened []map[string]interface{}
+    depth := config.depth()
+    for ; depth > 0; depth-- {
+        flattened = flattenRecords(records, config, depth)
+        if countKeys(flattened) <= config.columnLimit() {
+            break
+        }
+    }
+    if depth == 0 {
+        return data, 0
+    }
+
+    if _, ok := data.(map[string]interface{}); ok {
+        return flattened[0], depth
+    }
+    items := make([]interface{}, len(flattened))
+    for i, record := range flattened {
+        items[i] = record
+    }
+    return items, depth
+}
+
+// flattenRecords expands the nested objects of records up to maxDepth
+func flattenRecords(records []map[string]interface{}, config FlattenConfig, maxDepth int) []map[string]interface{} {
+    separator := orDefault(config.Separator, defaultFlattenSeparator)
+    flattened := make([]map[string]interface{}, len(records))
+    for i, record := range records {
+        flattened[i] = make(map[string]interface{}, len(record))
+        flattenInto(flattened[i], record, "", 0, maxDepth, separator, config)
+    }
+    return flattened
+}
+
+// flattenInto writes the keys of an object found at depth into out,
+// prefixed with the path leading to it
+func flattenInto(out, object map[string]interface{}, prefix string, depth, maxDepth int, separator string, config FlattenConfig) {
+    for key, value := range object {
+        name := prefix + key
+        nested, ok := value.(map[string]interface{})
+        if !ok || len(nested) == 0 || depth+1 > maxDepth || config.mode(depth+1) == FlattenJSONB {
+            out[name] = value
+            continue
+        }
+        if config.mode(depth+1) == FlattenBoth {
+            out[name] = value
+        }
+        flattenInto(out, nested, name+separator, depth+1, maxDepth, separator, config)
+    }
+}
+
+// countKeys counts the distinct keys of records
+func countKeys(records []map[string]interface{}) int {
+    keys := make(map[string]bool)
+    for _, record := range records {
+        for key := range record {
+            keys[key] = true
+        }
+    }
+    return len(keys)
+}
+
+// flattenForStorage flattens an output before it is stored in its table,
+// logging when the column limit kept it from being expanded fully
+func (g *GitHubFunctionExtractor) flattenForStorage(function FunctionInfo, data interface{}) interface{} {
+    flatten := g.dbConfig.Flatten
+    flattened, depth := flattenOutput(data, flatten)
+    if flatten.Enabled() && depth < flatten.depth() {
+        if _, ok := objectRecords(data); ok {
+            g.logger.Printf("Flattened output of %s to depth %d instead of %d to stay within %d columns",
+                function.Name, depth, flatten.depth(), flatten.columnLimit())
+        }
+    }
+    return flattened
+}
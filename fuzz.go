@@ -0,0 +1,86 @@
+package main
+
+import (
+    "strings"
+)
+
+// defaultMaxFuzzCases is used when no explicit fuzz case limit is configured
+const defaultMaxFuzzCases = 16
+
+// fuzzValues maps supported parameter types to the Go literals tried for them
+var fuzzValues = map[string][]string{
+    "string":   {`""`, `"a"`, `"floq"`},
+    "int":      {"0", "1", "-1", "42"},
+    "int8":     {"0", "1", "-1"},
+    "int16":    {"0", "1", "-1"},
+    "int32":    {"0", "1", "-1"},
+    "int64":    {"0", "1", "-1", "42"},
+    "uint":     {"0", "1", "42"},
+    "uint8":    {"0", "1", "255"},
+    "uint16":   {"0", "1"},
+    "uint32":   {"0", "1"},
+    "uint64":   {"0", "1"},
+    "byte":     {"0", "'a'"},
+    "rune":     {"0", "'a'"},
+    "float32":  {"0", "1.5"},
+    "float64":  {"0", "1.5", "-1"},
+    "bool":     {"false", "true"},
+    "[]string": {"nil", `[]string{}`, `[]string{"a", "b"}`},
+    "[]int":    {"nil", `[]int{}`, `[]int{1, 2, 3}`},
+    "[]byte":   {"nil", `[]byte("")`, `[]byte("floq")`},
+}
+
+// parameterType returns the type portion of a formatted parameter
+// ("name type" or just "type")
+func parameterType(param string) string {
+    fields := strings.Fields(param)
+    if len(fields) == 0 {
+        return ""
+    }
+    return fields[len(fields)-1]
+}
+
+// fuzzArgumentMatrix builds a matrix of argument literal sets for the given
+// parameters. It returns false if any parameter type is not supported. The
+// matrix is walked like an odometer so the first cases vary the last
+// parameter first, and it is capped at maxCases entries.
+func fuzzArgumentMatrix(params []string, maxCases int) ([][]string, bool) {
+    if maxCases <= 0 {
+        maxCases = defaultMaxFuzzCases
+    }
+
+    candidates := make([][]string, len(params))
+    for i, param := range params {
+        values, ok := fuzzValues[parameterType(param)]
+        if !ok {
+            return nil, false
+        }
+        candidates[i] = values
+    }
+
+    var matrix [][]string
+    indexes := make([]int, len(params))
+    for len(matrix) < maxCases {
+        args := make([]string, len(params))
+        for i, idx := range indexes {
+            args[i] = candidates[i][idx]
+        }
+        matrix = append(matrix, args)
+
+        // Advance the odometer, stopping once every combination was produced
+        pos := len(indexes) - 1
+        for pos >= 0 {
+            indexes[pos]++
+            if indexes[pos] < len(candidates[pos]) {
+                break
+            }
+            indexes[pos] = 0
+            pos--
+        }
+        if pos < 0 {
+            break
+        }
+    }
+
+    return matrix, true
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+)
+
+// gateFailedExitCode is the exit status of a run whose results miss a
+// quality gate threshold; fatal errors exit with 1
+const gateFailedExitCode = 3
+
+// defaultGateFile is the artifact the gate result is written to
+const defaultGateFile = "gate.json"
+
+// GateConfig sets quality thresholds evaluated after a run, so CI can fail
+// the build when extraction quality regresses. Unset thresholds are not
+// checked. Rates are percentages.
+type GateConfig struct {
+    // MinFunctions is the fewest functions the run must extract
+    MinFunctions int `json:"min_functions,omitempty"`
+    // MaxErrorRate caps errors per extracted function
+    MaxErrorRate *float64 `json:"max_error_rate,omitempty"`
+    // MinSuccessRate is the lowest share of extracted functions that must
+    // execute successfully
+    MinSuccessRate *float64 `json:"min_success_rate,omitempty"`
+}
+
+// Enabled reports whether any threshold is set
+func (c GateConfig) Enabled() bool {
+    return c.MinFunctions > 0 || c.MaxErrorRate != nil || c.MinSuccessRate != nil
+}
+
+// GateCheck is the outcome of one threshold
+type GateCheck struct {
+    Name      string  `json:"name"`
+    Threshold float64 `json:"threshold"`
+    Actual    float64 `json:"actual"`
+    Passed    bool    `json:"passed"`
+}
+
+// GateResult is the machine-readable outcome of the quality gate
+type GateResult struct {
+    Passed bool        `json:"passed"`
+    RunID  string      `json:"run_id"`
+    Checks []GateCheck `json:"checks"`
+}
+
+// EvaluateGate checks a run's aggregate statistics against the thresholds
+func EvaluateGate(config GateConfig, runID string, stats ProcessingStats) GateResult {
+    result := GateResult{Passed: true, RunID: runID}
+    check := func(name string, threshold, actual float64, passed bool) {
+        result.Checks = append(result.Checks, GateCheck{Name: name, Threshold: threshold, Actual: actual, Passed: passed})
+        result.Passed = result.Passed && passed
+    }
+
+    var errorRate, successRate float64
+    if stats.TotalFunctions > 0 {
+        errorRate = float64(stats.TotalErrors) / float64(stats.TotalFunctions) * 100
+        successRate = float64(stats.TotalExecuted) / float64(stats.TotalFunctions) * 100
+    } else if stats.TotalErrors > 0 {
+        errorRate = 100
+    }
+
+    if config.MinFunctions > 0 {
+        functions := float64(stats.TotalFunctions)
+        check("min_functions", float64(config.MinFunctions), functions, functions >= float64(config.MinFunctions))
+    }
+    if config.MaxErrorRate != nil {
+        check("max_error_rate", *config.MaxErrorRate, errorRate, errorRate <= *config.MaxErrorRate)
+    }
+    if config.MinSuccessRate != nil {
+        check("min_success_rate", *config.MinSuccessRate, successRate, successRate >= *config.MinSuccessRate)
+    }
+    return result
+}
+
+// Print writes the gate checks as a pass/fail list
+func (r GateResult) Print(out io.Writer) {
+    fmt.Fprintln(out, "\n🚦 QUALITY GATE")
+    for _, check := range r.Checks {
+        status := "✅ PASS"
+        if !check.Passed {
+            status = "❌ FAIL"
+        }
+        fmt.Fprintf(out, "%s  %-18s actual %.1f, threshold %.1f\n", status, check.Name, check.Actual, check.Threshold)
+    }
+    if r.Passed {
+        fmt.Fprintln(out, "Gate passed")
+    } else {
+        fmt.Fprintf(out, "Gate failed; exiting with status %d\n", gateFailedExitCode)
+    }
+}
+
+// SaveGateFile writes the gate result as JSON
+func SaveGateFile(filename string, result GateResult) error {
+    data, err := json.MarshalIndent(result, "", "  ")
+    if err != nil {
+        return fmt.Errorf("failed to marshal gate result: %w", err)
+    }
+    if err := os.WriteFile(filename, data, 0644); err != nil {
+        return fmt.Errorf("failed to write gate result: %w", err)
+    }
+    return nil
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "io/fs"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strings"
+
+    "github.com/go-git/go-git/v5"
+    gitconfig "github.com/go-git/go-git/v5/config"
+    "github.com/go-git/go-git/v5/plumbing"
+)
+
+// Git transports selectable with providers.git_transport
+const (
+    gitTransportGoGit = "go-git"
+    gitTransportCLI   = "git"
+)
+
+// errNoHistory is returned by clients whose copies have no history
+var errNoHistory = errors.New("the repository copy has no history")
+
+// GitClient fetches a repository into a local directory and moves it
+// between commits. Implementations can be swapped with SetGitClient, e.g.
+// for an in-memory client in tests. Network operations and git commands
+// stop once their ctx is cancelled.
+type GitClient interface {
+    // Clone copies the repository at repoURL into dir. The returned
+    // repository gives access to history and is nil when the source has none.
+    Clone(ctx context.Context, repoURL, dir string) (*git.Repository, error)
+    // Fetch updates the clone in dir with the branches and tags of its
+    // origin, plus refs given by full name such as refs/pull/1/head
+    Fetch(ctx context.Context, dir string, refs ...string) error
+    // Checkout checks out a commit in dir, discarding changes and untracked
+    // files. paths limits the worktree to those directories.
+    Checkout(ctx context.Context, dir, commit string, paths []string) error
+    // ResolveRef returns the commit hash a branch, tag or revision of the
+    // clone in dir names
+    ResolveRef(ctx context.Context, dir, ref string) (string, error)
+}
+
+// goGitClient clones with go-git
+type goGitClient struct {
+    progress io.Writer
+}
+
+// Clone clones repoURL into dir
+func (c goGitClient) Clone(ctx context.Context, repoURL, dir string) (*git.Repository, error) {
+    return git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{
+        URL:      repoURL,
+        Progress: c.progress,
+    })
+}
+
+// Fetch fetches the branches, tags and refs of origin into the clone in dir
+func (c goGitClient) Fetch(ctx context.Context, dir string, refs ...string) error {
+    repo, err := git.PlainOpen(dir)
+    if err != nil {
+        return fmt.Errorf("failed to open repository: %w", err)
+    }
+    specs := []gitconfig.RefSpec{
+        "+refs/heads/*:refs/remotes/origin/*",
+        "+refs/tags/*:refs/tags/*",
+    }
+    for _, ref := range refs {
+        specs = append(specs, gitconfig.RefSpec(fmt.Sprintf("+%s:%s", ref, ref)))
+    }
+    err = repo.FetchContext(ctx, &git.FetchOptions{RefSpecs: specs, Progress: c.progress})
+    if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+        return fmt.Errorf("failed to fetch: %w", err)
+    }
+    return nil
+}
+
+// Checkout checks out commit in dir, sparsely when paths are given
+func (c goGitClient) Checkout(ctx context.Context, dir, commit string, paths []string) error {
+    repo, err := git.PlainOpen(dir)
+    if err != nil {
+        return fmt.Errorf("failed to open repository: %w", err)
+    }
+    worktree, err := repo.Worktree()
+    if err != nil {
+        return fmt.Errorf("failed to open worktree: %w", err)
+    }
+    options := &git.CheckoutOptions{
+        Hash:  plumbing.NewHash(commit),
+        Force: true,
+    }
+    if len(paths) > 0 {
+        options.SparseCheckoutDirectories = sparsePatterns(paths)
+    }
+    if err := worktree.Checkout(options); err != nil {
+        return err
+    }
+    if err := worktree.Clean(&git.CleanOptions{Dir: true}); err != nil {
+        return fmt.Errorf("failed to clean worktree: %w", err)
+    }
+    return nil
+}
+
+// ResolveRef resolves ref in the clone in dir
+func (c goGitClient) ResolveRef(ctx context.Context, dir, ref string) (string, error) {
+    repo, err := git.PlainOpen(dir)
+    if err != nil {
+        return "", fmt.Errorf("failed to open repository: %w", err)
+    }
+    hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+    if err != nil {
+        return "", err
+    }
+    return hash.String(), nil
+}
+
+// gitCLIClient runs the git CLI, for features go-git lacks such as partial
+// clone filters. It inherits the provider TLS settings through the
+// environment, see ConfigureProviders.
+type gitCLIClient struct {
+    progress io.Writer
+    // filter is passed to clones as --filter, e.g. blob:none
+    filter string
+}
+
+// git runs a git command, killed once ctx is cancelled, copying its output
+// to the progress writer, and returns its standard output
+func (c gitCLIClient) git(ctx context.Context, args ...string) (string, error) {
+    var stdout, stderr bytes.Buffer
+    cmd := exec.CommandContext(ctx, "git", args...)
+    cmd.Stdout = &stdout
+    cmd.Stderr = &stderr
+    if c.progress != nil {
+        cmd.Stderr = io.MultiWriter(&stderr, c.progress)
+    }
+    if err := cmd.Run(); err != nil {
+        return "", fmt.Errorf("git %s failed: %w: %s", args[0], err, lastLine(stderr.Bytes()))
+    }
+    return strings.TrimSpace(stdout.String()), nil
+}
+
+// Clone clones repoURL into dir, applying the configured filter
+func (c gitCLIClient) Clone(ctx context.Context, repoURL, dir string) (*git.Repository, error) {
+    args := []string{"clone"}
+    if c.filter != "" {
+        args = append(args, "--filter="+c.filter)
+    }
+    if _, err := c.git(ctx, append(args, "--", repoURL, dir)...); err != nil {
+        return nil, err
+    }
+    return git.PlainOpen(dir)
+}
+
+// CloneSparse makes a partial clone with a sparse checkout of paths
+func (c gitCLIClient) CloneSparse(ctx context.Context, repoURL, dir string, paths []string) (*git.Repository, error) {
+    return cloneSparseCLI(ctx, repoURL, dir, paths, orDefault(c.filter, "blob:none"))
+}
+
+// Fetch fetches the branches, tags and refs of origin into the clone in dir
+func (c gitCLIClient) Fetch(ctx context.Context, dir string, refs ...string) error {
+    args := []string{"-C", dir, "fetch", "--tags", "origin", "+refs/heads/*:refs/remotes/origin/*"}
+    for _, ref := range refs {
+        args = append(args, fmt.Sprintf("+%s:%s", ref, ref))
+    }
+    _, err := c.git(ctx, args...)
+    return err
+}
+
+// Checkout checks out commit in dir. A sparse clone keeps its sparse
+// checkout patterns, so paths need not be applied again.
+func (c gitCLIClient) Checkout(ctx context.Context, dir, commit string, paths []string) error {
+    if _, err := c.git(ctx, "-C", dir, "checkout", "--quiet", "--force", "--detach", commit); err != nil {
+        return err
+    }
+    _, err := c.git(ctx, "-C", dir, "clean", "-fdq")
+    return err
+}
+
+// ResolveRef resolves ref in the clone in dir
+func (c gitCLIClient) ResolveRef(ctx context.Context, dir, ref string) (string, error) {
+    return c.git(ctx, "-C", dir, "rev-parse", "--verify", "--end-of-options", ref+"^{commit}")
+}
+
+// localDirClient copies a plain local directory, such as the fixture corpus
+// in testdata, so it can be processed without a git server. Copies have no
+// history.
+type localDirClient struct{}
+
+// Clone copies the directory tree at source into dir
+func (localDirClient) Clone(ctx context.Context, source, dir string) (*git.Repository, error) {
+    err := filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        rel, err := filepath.Rel(source, path)
+        if err != nil {
+            return err
+        }
+        target := filepath.Join(dir, rel)
+
+        if d.IsDir() {
+            return os.MkdirAll(target, 0755)
+        }
+        if !d.Type().IsRegular() {
+            return nil
+        }
+        data, err := os.ReadFile(path)
+        if err != nil {
+            return err
+        }
+        return os.WriteFile(target, data, 0644)
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to copy %s: %w", source, err)
+    }
+    return nil, nil
+}
+
+// Fetch fails, as copies have no origin
+func (localDirClient) Fetch(ctx context.Context, dir string, refs ...string) error {
+    return errNoHistory
+}
+
+// Checkout fails, as copies have no commits
+func (localDirClient) Checkout(ctx context.Context, dir, commit string, paths []string) error {
+    return errNoHistory
+}
+
+// ResolveRef fails, as copies have no refs
+func (localDirClient) ResolveRef(ctx context.Context, dir, ref string) (string, error) {
+    return "", errNoHistory
+}
+
+// gitClientFor picks the client for a repository argument: local
+// directories that are not git repositories are copied, everything else is
+// cloned with the configured transport. progress receives clone progress.
+func gitClientFor(repoURL string, progress io.Writer) GitClient {
+    if info, err := os.Stat(repoURL); err == nil && info.IsDir() {
+        if _, err := os.Stat(filepath.Join(repoURL, ".git")); err != nil {
+            return localDirClient{}
+        }
+    }
+    if providers.GitTransport == gitTransportCLI {
+        return gitCLIClient{progress: progress, filter: providers.CloneFilter}
+    }
+    return goGitClient{progress: progress}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+    "fmt"
+    "go/ast"
+    "go/parser"
+    "go/token"
+    "io"
+    "os"
+    "path"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// PackageInfo describes a Go package found in a repository
+type PackageInfo struct {
+    ImportPath string   `json:"import_path"`
+    Dir        string   `json:"dir"`
+    Name       string   `json:"name"`
+    Imports    []string `json:"imports"`
+    // Unsupported explains why the runners cannot build the package; its
+    // functions are not executed
+    Unsupported string  `json:"unsupported,omitempty"`
+}
+
+// readModulePath returns the module path declared in a repository's go.mod,
+// or "" when there is none
+func readModulePath(repoPath string) string {
+    data, err := os.ReadFile(filepath.Join(repoPath, "go.mod"))
+    if err != nil {
+        return ""
+    }
+    for _, line := range strings.Split(string(data), "\n") {
+        fields := strings.Fields(line)
+        if len(fields) >= 2 && fields[0] == "module" {
+            return strings.Trim(fields[1], `"`)
+        }
+    }
+    return ""
+}
+
+// packageImportPath joins a module path and a package directory
+func packageImportPath(modulePath, dir string) string {
+    if dir == "." || dir == "" {
+        return modulePath
+    }
+    if modulePath == "" {
+        return dir
+    }
+    return modulePath + "/" + dir
+}
+
+// fileImports maps the names under which a file refers to its imports to
+// the imported package paths
+func fileImports(file *ast.File) map[string]string {
+    imports := make(map[string]string)
+    for _, spec := range file.Imports {
+        importPath, err := strconv.Unquote(spec.Path.Value)
+        if err != nil {
+            continue
+        }
+        name := path.Base(importPath)
+        if spec.Name != nil {
+            name = spec.Name.Name
+        }
+        if name == "_" || name == "." {
+            continue
+        }
+        imports[name] = importPath
+    }
+    return imports
+}
+
+// functionCalls lists the functions called from a function body: calls into
+// the same package as "Name" and calls into imported packages as
+// "import/path.Name". Method calls on values are not resolvable without type
+// information and are skipped.
+func functionCalls(body *ast.BlockStmt, imports map[string]string) []string {
+    if body == nil {
+        return nil
+    }
+
+    seen := make(map[string]bool)
+    ast.Inspect(body, func(n ast.Node) bool {
+        call, ok := n.(*ast.CallExpr)
+        if !ok {
+            return true
+        }
+        switch fun := call.Fun.(type) {
+        case *ast.Ident:
+            if fun.Obj == nil || fun.Obj.Kind == ast.Fun {
+                seen[fun.Name] = true
+            }
+        case *ast.SelectorExpr:
+            if x, ok := fun.X.(*ast.Ident); ok && x.Obj == nil {
+                if importPath, ok := imports[x.Name]; ok {
+                    seen[importPath+"."+fun.Sel.Name] = true
+                }
+            }
+        }
+        return true
+    })
+
+    calls := make([]string, 0, len(seen))
+    for call := range seen {
+        calls = append(calls, call)
+    }
+    sort.Strings(calls)
+    return calls
+}
+
+// GraphNode is a vertex of the exported property graph
+type GraphNode struct {
+    ID    string
+    Label string
+    Props map[string]string
+}
+
+// GraphEdge is a typed, directed relationship between two nodes
+type GraphEdge struct {
+    From string
+    To   string
+    Type string
+}
+
+// Graph is a property graph of repositories, packages, and functions with
+// CONTAINS, DEFINES, IMPORTS, and CALLS relationships
+type Graph struct {
+    Nodes []GraphNode
+    Edges []GraphEdge
+}
+
+// BuildGraph assembles the property graph of a run. Import and call edges
+// are only kept when both ends were scanned, so the graph shows how the
+// scanned estate fits together rather than every standard library call.
+func BuildGraph(run *Run) *Graph {
+    graph := &Graph{}
+    results := run.Results()
+    packages := make(map[string]bool)
+    functions := make(map[string]bool)
+
+    for _, repoURL := range run.Repositories() {
+        result := results[repoURL]
+        repoID := "repo:" + repoURL
+        graph.Nodes = append(graph.Nodes, GraphNode{
+            ID: repoID, Label: "Repository",
+            Props: map[string]string{"url": repoURL, "module": result.ModulePath},
+        })
+
+        for _, pkg := range result.Packages {
+            pkgID := "pkg:" + pkg.ImportPath
+            if packages[pkgID] {
+                continue
+            }
+            packages[pkgID] = true
+            graph.Nodes = append(graph.Nodes, GraphNode{
+                ID: pkgID, Label: "Package",
+                Props: map[string]string{"import_path": pkg.ImportPath, "name": pkg.Name},
+            })
+            graph.Edges = append(graph.Edges, GraphEdge{From: repoID, To: pkgID, Type: "CONTAINS"})
+        }
+
+        for _, function := range result.ProcessedFunctions {
+            importPath := packageImportPath(result.ModulePath, path.Dir(function.RelativePath))
+            fnID := "fn:" + importPath + "." + function.Name
+            if functions[fnID] {
+                continue
+            }
+            functions[fnID] = true
+            graph.Nodes = append(graph.Nodes, GraphNode{
+                ID: fnID, Label: "Function",
+                Props: map[string]string{
+                    "name":      function.Name,
+                    "class":     function.Class,
+                    "signature": functionSignature(function),
+                    "file":      function.RelativePath,
+                    "line":      strconv.Itoa(function.LineNumber),
+                },
+            })
+            graph.Edges = append(graph.Edges, GraphEdge{From: "pkg:" + importPath, To: fnID, Type: "DEFINES"})
+        }
+    }
+
+    // Second pass: relationships between scanned nodes
+    for _, repoURL := range run.Repositories() {
+        result := results[repoURL]
+        for _, pkg := range result.Packages {
+            for _, imported := range pkg.Imports {
+                if packages["pkg:"+imported] {
+                    graph.Edges = append(graph.Edges, GraphEdge{From: "pkg:" + pkg.ImportPath, To: "pkg:" + imported, Type: "IMPORTS"})
+                }
+            }
+        }
+        for _, function := range result.ProcessedFunctions {
+            importPath := packageImportPath(result.ModulePath, path.Dir(function.RelativePath))
+            for _, call := range function.Calls {
+                target := call
+                if !strings.Contains(call, ".") {
+                    target = importPath + "." + call
+                }
+                if functions["fn:"+target] {
+                    graph.Edges = append(graph.Edges, GraphEdge{From: "fn:" + importPath + "." + function.Name, To: "fn:" + target, Type: "CALLS"})
+                }
+            }
+        }
+    }
+    return graph
+}
+
+// WriteDOT renders the graph in GraphViz DOT format
+func (g *Graph) WriteDOT(w io.Writer) error {
+    shapes := map[string]string{"Repository": "folder", "Package": "box", "Function": "ellipse"}
+
+    var b strings.Builder
+    b.WriteString("digraph floq {\n  rankdir=LR;\n")
+    for _, node := range g.Nodes {
+        label := node.Props["name"]
+        if node.Label == "Repository" {
+            label = node.Props["url"]
+        } else if node.Label == "Package" {
+            label = node.Props["import_path"]
+        }
+        fmt.Fprintf(&b, "  %s [label=%s, shape=%s];\n", strconv.Quote(node.ID), strconv.Quote(label), shapes[node.Label])
+    }
+    for _, edge := range g.Edges {
+        fmt.Fprintf(&b, "  %s -> %s [label=%s];\n", strconv.Quote(edge.From), strconv.Quote(edge.To), strconv.Quote(edge.Type))
+    }
+    b.WriteString("}\n")
+
+    _, err := io.WriteString(w, b.String())
+    return err
+}
+
+// WriteCypher renders the graph as an idempotent Cypher script that can be
+// loaded into Neo4j with cypher-shell
+func (g *Graph) WriteCypher(w io.Writer) error {
+    var b strings.Builder
+    for _, node := range g.Nodes {
+        keys := make([]string, 0, len(node.Props))
+        for key := range node.Props {
+            keys = append(keys, key)
+        }
+        sort.Strings(keys)
+
+        var sets []string
+        for _, key := range keys {
+            sets = append(sets, fmt.Sprintf("n.%s = %s", key, cypherString(node.Props[key])))
+        }
+        fmt.Fprintf(&b, "MERGE (n:%s {id: %s})", node.Label, cypherString(node.ID))
+        if len(sets) > 0 {
+            fmt.Fprintf(&b, " SET %s", strings.Join(sets, ", "))
+        }
+        b.WriteString(";\n")
+    }
+    for _, edge := range g.Edges {
+        fmt.Fprintf(&b, "MATCH (a {id: %s}), (b {id: %s}) MERGE (a)-[:%s]->(b);\n",
+            cypherString(edge.From), cypherString(edge.To), edge.Type)
+    }
+
+    _, err := io.WriteString(w, b.String())
+    return err
+}
+
+// cypherString quotes a string literal for Cypher
+func cypherString(s string) string {
+    return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`).Replace(s) + "'"
+}
+
+// ScanPackages groups the repository's Go files into packages and collects
+// each package's imports. Files that fail to parse are skipped here; the
+// extraction pass reports them.
+func (g *GitHubFunctionExtractor) ScanPackages(modulePath string, goFiles []string) []PackageInfo {
+    byDir := make(map[string]*PackageInfo)
+    imports := make(map[string]map[string]bool)
+    fset := token.NewFileSet()
+
+    for _, filePath := range goFiles {
+        node, err := parser.ParseFile(fset, filePath, nil, parser.ImportsOnly)
+        if err != nil || strings.HasSuffix(node.Name.Name, "_test") {
+            continue
+        }
+
+        dir := "."
+        if rel, err := filepath.Rel(g.repoPath, filepath.Dir(filePath)); err == nil {
+            dir = filepath.ToSlash(rel)
+        }
+
+        pkg, ok := byDir[dir]
+        if !ok {
+            pkg = &PackageInfo{
+                ImportPath: packageImportPath(modulePath, dir),
+                Dir:        dir,
+                Name:       node.Name.Name,
+            }
+            byDir[dir] = pkg
+            imports[dir] = make(map[string]bool)
+        }
+        for _, spec := range node.Imports {
+            if importPath, err := strconv.Unquote(spec.Path.Value); err == nil {
+                imports[dir][importPath] = true
+            }
+        }
+    }
+
+    packages := make([]PackageInfo, 0, len(byDir))
+    for dir, pkg := range byDir {
+        for importPath := range imports[dir] {
+            pkg.Imports = append(pkg.Imports, importPath)
+        }
+        sort.Strings(pkg.Imports)
+        packages = append(packages, *pkg)
+    }
+    sort.Slice(packages, func(i, j int) bool { return packages[i].ImportPath < packages[j].ImportPath })
+    return packages
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "runtime"
+    "runtime/debug"
+    "time"
+)
+
+// version is the release version, set at build time with
+// -ldflags "-X main.version=v1.2.3"
+var version = "dev"
+
+// readinessTimeout bounds each readiness check so probes answer quickly
+const readinessTimeout = 2 * time.Second
+
+// BuildInfo describes the running binary and its configuration
+type BuildInfo struct {
+    Version    string `json:"version"`
+    GoVersion  string `json:"go_version"`
+    Platform   string `json:"platform"`
+    Revision   string `json:"revision,omitempty"`
+    BuildTime  string `json:"build_time,omitempty"`
+    Modified   bool   `json:"modified,omitempty"`
+    ConfigHash string `json:"config_hash"`
+}
+
+// readBuildInfo collects the version, the VCS stamp embedded by the go
+// command, and a hash of the configuration in effect
+func readBuildInfo(config Config) BuildInfo {
+    info := BuildInfo{
+        Version:    version,
+        GoVersion:  runtime.Version(),
+        Platform:   runtime.GOOS + "/" + runtime.GOARCH,
+        ConfigHash: configHash(config),
+    }
+    if build, ok := debug.ReadBuildInfo(); ok {
+        for _, setting := range build.Settings {
+            switch setting.Key {
+            case "vcs.revision":
+                info.Revision = setting.Value
+            case "vcs.time":
+                info.BuildTime = setting.Value
+            case "vcs.modified":
+                info.Modified = setting.Value == "true"
+            }
+        }
+    }
+    return info
+}
+
+// configHash fingerprints a configuration so replicas running different
+// settings can be told apart. Secrets are left out of the hash.
+func configHash(config Config) string {
+    config.Password = ""
+    config.Service.Token = ""
+    config.Profiles = nil
+    data, err := json.Marshal(config)
+    if err != nil {
+        return ""
+    }
+    sum := sha256.Sum256(data)
+    return hex.EncodeToString(sum[:])[:16]
+}
+
+// handleHealthz reports that the process is alive
+func (s *Service) handleHealthz(w http.ResponseWriter, r *http.Request) {
+    writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz reports whether the service can process jobs: the database
+// and any read replica are reachable, the clone workspace is writable, and
+// the job queue is available. It answers 503 while any check fails.
+func (s *Service) handleReadyz(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+    defer cancel()
+
+    checks := []DoctorCheck{
+        s.checkDatabaseReady(ctx),
+        checkWorkspace(orDefault(s.currentConfig().Workspace.Dir, os.TempDir())),
+        s.checkQueueReady(ctx),
+    }
+    if s.replica != nil {
+        checks = append(checks, s.checkReplicaReady(ctx))
+    }
+
+    status, code := "ready", http.StatusOK
+    for _, check := range checks {
+        if !check.Passed {
+            status, code = "not ready", http.StatusServiceUnavailable
+        }
+    }
+    writeJSON(w, code, map[string]interface{}{"status": status, "checks": checks})
+}
+
+// handleBuildInfo reports the version and configuration hash
+func (s *Service) handleBuildInfo(w http.ResponseWriter, r *http.Request) {
+    writeJSON(w, http.StatusOK, readBuildInfo(s.currentConfig()))
+}
+
+// checkDatabaseReady pings the service's database connection
+func (s *Service) checkDatabaseReady(ctx context.Context) DoctorCheck {
+    check := DoctorCheck{Name: "database"}
+    if err := s.db.PingContext(ctx); err != nil {
+        check.Detail = err.Error()
+        return check
+    }
+    check.Passed = true
+    check.Detail = "reachable"
+    return check
+}
+
+// checkReplicaReady pings the read replica serving job listings
+func (s *Service) checkReplicaReady(ctx context.Context) DoctorCheck {
+    check := DoctorCheck{Name: "replica"}
+    if err := s.replica.PingContext(ctx); err != nil {
+        check.Detail = err.Error()
+        return check
+    }
+    check.Passed = true
+    check.Detail = "reachable"
+    return check
+}
+
+// checkQueueReady verifies the job queue table can be read
+func (s *Service) checkQueueReady(ctx context.Context) DoctorCheck {
+    check := DoctorCheck{Name: "queue"}
+    if err := s.jobs.Ping(ctx); err != nil {
+        check.Detail = fmt.Sprintf("job queue unavailable: %v", err)
+        return check
+    }
+    check.Passed = true
+    check.Detail = "connected"
+    return check
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+    "fmt"
+    "path/filepath"
+    "time"
+
+    "github.com/go-git/go-git/v5"
+)
+
+// FileHistory holds the most recent commit touching a source file
+type FileHistory struct {
+    LastCommit  string    `json:"last_commit"`
+    Author      string    `json:"author"`
+    AuthorEmail string    `json:"author_email"`
+    // AuthorDate is when the change was written and CommitDate when it was
+    // committed; they differ for rebased, amended and cherry-picked commits
+    AuthorDate  time.Time `json:"author_date"`
+    CommitDate  time.Time `json:"commit_date"`
+}
+
+// FileHistory looks up the last commit that modified the given file in the
+// cloned repository. Results are cached per file since every function in a
+// file shares the same history.
+func (g *GitHubFunctionExtractor) FileHistory(filePath string) (*FileHistory, error) {
+    if g.repo == nil {
+        return nil, fmt.Errorf("repository not cloned")
+    }
+
+    relPath, err := filepath.Rel(g.repoPath, filePath)
+    if err != nil {
+        return nil, fmt.Errorf("failed to resolve path %s: %w", filePath, err)
+    }
+    relPath = filepath.ToSlash(relPath)
+
+    if history, ok := g.historyCache[relPath]; ok {
+        return history, nil
+    }
+
+    iter, err := g.repo.Log(&git.LogOptions{FileName: &relPath})
+    if err != nil {
+        return nil, fmt.Errorf("failed to read git log for %s: %w", relPath, err)
+    }
+    defer iter.Close()
+
+    commit, err := iter.Next()
+    if err != nil {
+        return nil, fmt.Errorf("no commits found for %s: %w", relPath, err)
+    }
+
+    history := &FileHistory{
+        LastCommit:  commit.Hash.String(),
+        Author:      commit.Author.Name,
+        AuthorEmail: commit.Author.Email,
+        AuthorDate:  commit.Author.When,
+        CommitDate:  commit.Committer.When,
+    }
+
+    if g.historyCache == nil {
+        g.historyCache = make(map[string]*FileHistory)
+    }
+    g.historyCache[relPath] = history
+    return history, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+    "slices"
+    "sync"
+)
+
+// HookContext identifies the repository a hook is called for
+type HookContext struct {
+    RunID      string `json:"run_id,omitempty"`
+    Repository string `json:"repository"`
+    // Ref is the historical ref being processed in time-travel mode
+    Ref string `json:"ref,omitempty"`
+}
+
+// Hooks are callbacks run at stages of the pipeline, so embedders can take
+// part in processing without changing it. Every hook is optional; register
+// them with RegisterHooks.
+type Hooks struct {
+    // Name identifies the hooks in logs and results
+    Name string
+    // PreClone runs before a repository is cloned; an error skips the
+    // repository, recording the error as the reason
+    PreClone func(ctx HookContext) error
+    // PostExtract runs on the functions extracted from a file and returns
+    // the functions to keep, which may be changed, before they are recorded
+    // and executed
+    PostExtract func(ctx HookContext, functions []FunctionInfo) []FunctionInfo
+    // PreExecute runs before a function is executed; an error vetoes the
+    // execution, and the function is recorded as skipped
+    PreExecute func(ctx HookContext, function FunctionInfo) error
+    // PostInsert runs after a function's output was inserted into its
+    // table, e.g. to enrich the rows; an error is recorded for the function
+    PostInsert func(ctx HookContext, function FunctionInfo, table string, data interface{}) error
+}
+
+// registeredHooks are the hooks every extractor runs, in registration
+// order, each with the ID it was registered under
+var (
+    hooksMu         sync.Mutex
+    registeredHooks []registeredHook
+    nextHooksID     int
+)
+
+// registeredHook is an entry of registeredHooks
+type registeredHook struct {
+    id    int
+    hooks Hooks
+}
+
+// RegisterHooks adds hooks to the pipeline. Call it before processing
+// starts, typically from the init function of a file compiled into the
+// binary; extractors created afterwards run the hooks.
+func RegisterHooks(hooks Hooks) {
+    registerHooks(hooks)
+}
+
+// registerHooks adds hooks to the pipeline and returns a function removing
+// them again. Extractors created in between keep running them.
+func registerHooks(hooks Hooks) func() {
+    hooksMu.Lock()
+    defer hooksMu.Unlock()
+    nextHooksID++
+    id := nextHooksID
+    registeredHooks = append(registeredHooks, registeredHook{id: id, hooks: hooks})
+    return func() {
+        hooksMu.Lock()
+        defer hooksMu.Unlock()
+        registeredHooks = slices.DeleteFunc(registeredHooks, func(entry registeredHook) bool {
+            return entry.id == id
+        })
+    }
+}
+
+// currentHooks returns the registered hooks in registration order
+func currentHooks() []Hooks {
+    hooksMu.Lock()
+    defer hooksMu.Unlock()
+    hooks := make([]Hooks, len(registeredHooks))
+    for i, entry := range registeredHooks {
+        hooks[i] = entry.hooks
+    }
+    return hooks
+}
+
+// describeHooks names hooks in logs and results
+func describeHooks(name string) string {
+    if name == "" {
+        return "unnamed hooks"
+    }
+    return name
+}
+
+// hookContext describes the current checkout to hooks
+func (g *GitHubFunctionExtractor) hookContext() HookContext {
+    ctx := HookContext{RunID: g.runID, Repository: g.repoURL}
+    if g.ref != nil {
+        ctx.Ref = g.ref.Name
+    }
+    return ctx
+}
+
+// runPreClone runs the PreClone hooks, returning the name of the hooks
+// that skipped the repository and their reason
+func (g *GitHubFunctionExtractor) runPreClone() (string, error) {
+    for _, hooks := range g.hooks {
+        if hooks.PreClone == nil {
+            continue
+        }
+        if err := hooks.PreClone(g.hookContext()); err != nil {
+            return hooks.Name, err
+        }
+    }
+    return "", nil
+}
+
+// runPostExtract passes a file's functions through the PostExtract hooks
+func (g *GitHubFunctionExtractor) runPostExtract(functions []FunctionInfo) []FunctionInfo {
+    for _, hooks := range g.hooks {
+        if hooks.PostExtract != nil {
+            functions = hooks.PostExtract(g.hookContext(), functions)
+        }
+    }
+    return functions
+}
+
+// runPreExecute runs the PreExecute hooks, returning the name of the hooks
+// that vetoed the execution and their reason
+func (g *GitHubFunctionExtractor) runPreExecute(function FunctionInfo) (string, error) {
+    for _, hooks := range g.hooks {
+        if hooks.PreExecute == nil {
+            continue
+        }
+        if err := hooks.PreExecute(g.hookContext(), function); err != nil {
+            return hooks.Name, err
+        }
+    }
+    return "", nil
+}
+
+// runPostInsert runs the PostInsert hooks of a stored output, recording
+// their errors for the function
+func (g *GitHubFunctionExtractor) runPostInsert(function FunctionInfo, table string, data interface{}, result *ProcessingResult) {
+    for _, hooks := range g.hooks {
+        if hooks.PostInsert == nil {
+            continue
+        }
+        if err := hooks.PostInsert(g.hookContext(), function, table, data); err != nil {
+            result.Errors = append(result.Errors,
+                g.functionError(function, "Failed to run post-insert hook for %s (%s): %v", function.Name, describeHooks(hooks.Name), err))
+        }
+    }
+}
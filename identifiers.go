@@ -0,0 +1,11 @@
+package main
+
+// tableNameFor returns the table name used for a function's output. In
+// time-travel mode the table is tagged with the checked out ref (v1.2.0
+// becomes a _v1_2_0 suffix), so every ref keeps its own tables.
+func (g *GitHubFunctionExtractor) tableNameFor(functionName string) string {
+    if g.ref != nil {
+        return tableNameFor(functionName + "_" + refSuffix(g.ref.Name))
+    }
+    return tableNameFor(functionName)
+}
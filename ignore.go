@@ -0,0 +1,243 @@
+package main
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "os"
+    "path"
+    "path/filepath"
+    "strings"
+)
+
+// ignoreFileName is the ignore file read from the root of every repository
+const ignoreFileName = ".floqignore"
+
+// Kinds of ignore rules. Path rules use gitignore syntax; function and
+// package rules are written as func:<glob> and pkg:<glob>.
+const (
+    IgnorePath     = "path"
+    IgnoreFunction = "func"
+    IgnorePackage  = "pkg"
+)
+
+// IgnoreRule is a single pattern of an ignore file
+type IgnoreRule struct {
+    Kind    string `json:"kind"`
+    Pattern string `json:"pattern"`
+    // Source is the file and line the rule was read from
+    Source string `json:"source"`
+    // Negate re-includes what earlier rules ignored (a leading !)
+    Negate bool `json:"negate,omitempty"`
+    // DirOnly rules only match directories (a trailing /)
+    DirOnly bool `json:"dir_only,omitempty"`
+    // segments is the slash-separated glob matched against paths
+    segments []string
+}
+
+// IgnoreRules are the rules of the global ignore file followed by those of
+// the repository's .floqignore. As in gitignore, the last matching rule
+// decides, so a repository can re-include what the global file ignores,
+// and nothing below an ignored directory can be re-included.
+type IgnoreRules struct {
+    rules []IgnoreRule
+}
+
+// defaultIgnoreFile returns the global ignore file used when none is
+// configured, floq/ignore in the user's configuration directory
+func defaultIgnoreFile() string {
+    dir, err := os.UserConfigDir()
+    if err != nil {
+        return ""
+    }
+    return filepath.Join(dir, "floq", "ignore")
+}
+
+// LoadIgnoreRules reads the global ignore file and the .floqignore at the
+// root of repoPath. A configured global file must exist; the default one
+// and the repository's file are optional.
+func LoadIgnoreRules(globalFile, repoPath string) (*IgnoreRules, error) {
+    rules := &IgnoreRules{}
+
+    required := globalFile != ""
+    if !required {
+        globalFile = defaultIgnoreFile()
+    }
+    if globalFile != "" {
+        global, err := parseIgnoreFile(globalFile)
+        if err != nil && (required || !errors.Is(err, os.ErrNotExist)) {
+            return nil, err
+        }
+        rules.rules = append(rules.rules, global...)
+    }
+
+    local, err := parseIgnoreFile(filepath.Join(repoPath, ignoreFileName))
+    if err != nil && !errors.Is(err, os.ErrNotExist) {
+        return nil, err
+    }
+    rules.rules = append(rules.rules, local...)
+
+    return rules, nil
+}
+
+// parseIgnoreFile reads the rules of an ignore file
+func parseIgnoreFile(filename string) ([]IgnoreRule, error) {
+    file, err := os.Open(filename)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open ignore file: %w", err)
+    }
+    defer file.Close()
+
+    var rules []IgnoreRule
+    scanner := bufio.NewScanner(file)
+    for line := 1; scanner.Scan(); line++ {
+        rule, ok, err := parseIgnoreLine(scanner.Text())
+        if err != nil {
+            return nil, fmt.Errorf("%s:%d: %w", filename, line, err)
+        }
+        if ok {
+            rule.Source = fmt.Sprintf("%s:%d", filepath.Base(filename), line)
+            rules = append(rules, rule)
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("failed to read ignore file: %w", err)
+    }
+    return rules, nil
+}
+
+// parseIgnoreLine parses one line of an ignore file. Blank lines and
+// comments yield no rule. A backslash escapes a leading # or !.
+func parseIgnoreLine(line string) (IgnoreRule, bool, error) {
+    line = strings.TrimRight(line, " \t\r")
+    if line == "" || strings.HasPrefix(line, "#") {
+        return IgnoreRule{}, false, nil
+    }
+
+    rule := IgnoreRule{Kind: IgnorePath}
+    if strings.HasPrefix(line, "!") {
+        rule.Negate = true
+        line = line[1:]
+    }
+    if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+        line = line[1:]
+    }
+
+    if kind, pattern, ok := strings.Cut(line, ":"); ok && (kind == IgnoreFunction || kind == IgnorePackage) {
+        rule.Kind = kind
+        line = pattern
+        if line == "" {
+            return rule, false, fmt.Errorf("empty %s: pattern", kind)
+        }
+    }
+    rule.Pattern = line
+
+    if rule.Kind == IgnorePath {
+        if strings.HasSuffix(line, "/") {
+            rule.DirOnly = true
+            line = strings.TrimRight(line, "/")
+        }
+        // Patterns without a slash match a name at any depth; the others
+        // are anchored to the repository root
+        if strings.Contains(line, "/") {
+            line = strings.TrimPrefix(line, "/")
+        } else {
+            line = "**/" + line
+        }
+        if line == "" || line == "**/" {
+            return rule, false, fmt.Errorf("empty path pattern")
+        }
+    }
+
+    rule.segments = strings.Split(line, "/")
+    for _, segment := range rule.segments {
+        if _, err := path.Match(segment, ""); err != nil {
+            return rule, false, fmt.Errorf("invalid pattern %q: %w", rule.Pattern, err)
+        }
+    }
+    return rule, true, nil
+}
+
+// Rules returns the loaded rules in the order they are applied
+func (r *IgnoreRules) Rules() []IgnoreRule {
+    if r == nil {
+        return nil
+    }
+    return r.rules
+}
+
+// IgnoredPath returns the rule ignoring a slash-separated path relative to
+// the repository root, or nil. A path is ignored when any of its parent
+// directories is.
+func (r *IgnoreRules) IgnoredPath(relPath string, isDir bool) *IgnoreRule {
+    if r == nil || len(r.rules) == 0 {
+        return nil
+    }
+    parts := strings.Split(relPath, "/")
+    for i := 1; i < len(parts); i++ {
+        if rule := r.decide(IgnorePath, parts[:i], true); rule != nil {
+            return rule
+        }
+    }
+    return r.decide(IgnorePath, parts, isDir)
+}
+
+// IgnoredFunction returns the rule ignoring a function, by its name or its
+// package's import path or name, or nil
+func (r *IgnoreRules) IgnoredFunction(function FunctionInfo, importPath string) *IgnoreRule {
+    if r == nil || len(r.rules) == 0 {
+        return nil
+    }
+    if rule := r.decide(IgnoreFunction, []string{function.Name}, false); rule != nil {
+        return rule
+    }
+    if rule := r.decide(IgnorePackage, strings.Split(importPath, "/"), false); rule != nil {
+        return rule
+    }
+    return r.decide(IgnorePackage, []string{function.PackageName}, false)
+}
+
+// decide applies the rules of a kind to a path, returning the last
+// matching rule if it ignores the path
+func (r *IgnoreRules) decide(kind string, parts []string, isDir bool) *IgnoreRule {
+    var decision *IgnoreRule
+    for i := range r.rules {
+        rule := &r.rules[i]
+        if rule.Kind != kind || (rule.DirOnly && !isDir) {
+            continue
+        }
+        if matchSegments(rule.segments, parts) {
+            decision = rule
+        }
+    }
+    if decision != nil && decision.Negate {
+        return nil
+    }
+    return decision
+}
+
+// matchSegments matches path segments against glob segments, where ** stands
+// for any number of segments, or at least one when it ends the pattern
+func matchSegments(pattern, parts []string) bool {
+    if len(pattern) == 0 {
+        return len(parts) == 0
+    }
+    if pattern[0] == "**" {
+        if len(pattern) == 1 {
+            return len(parts) > 0
+        }
+        for i := 0; i <= len(parts); i++ {
+            if matchSegments(pattern[1:], parts[i:]) {
+                return true
+            }
+        }
+        return false
+    }
+    if len(parts) == 0 {
+        return false
+    }
+    if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+        return false
+    }
+    return matchSegments(pattern[1:], parts[1:])
+}
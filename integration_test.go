@@ -0,0 +1,102 @@
+//go:build integration
+
+package main
+
+import (
+    "context"
+    "testing"
+
+    "github.com/ory/dockertest/v3"
+
+    "github.com/Spottybadrabbit/Floq-v1/storage/storagetest"
+)
+
+// startPostgres starts a throwaway PostgreSQL container for the test and
+// returns the configuration to connect to it. The container is removed when
+// the test finishes.
+func startPostgres(t *testing.T) DatabaseConfig {
+    t.Helper()
+
+    pool, err := dockertest.NewPool("")
+    if err != nil {
+        t.Fatalf("failed to connect to docker: %v", err)
+    }
+    resource, err := pool.Run("postgres", "16", []string{"POSTGRES_PASSWORD=floq"})
+    if err != nil {
+        t.Fatalf("failed to start postgres: %v", err)
+    }
+    t.Cleanup(func() {
+        if err := pool.Purge(resource); err != nil {
+            t.Errorf("failed to remove postgres: %v", err)
+        }
+    })
+
+    config := defaultConfig().DatabaseConfig
+    config.Host = "localhost"
+    config.Port = resource.GetPort("5432/tcp")
+    config.Password = "floq"
+
+    err = pool.Retry(func() error {
+        storage := NewPostgresStorage(config)
+        if err := storage.Connect(context.Background()); err != nil {
+            return err
+        }
+        return storage.Close()
+    })
+    if err != nil {
+        t.Fatalf("postgres did not become ready: %v", err)
+    }
+    return config
+}
+
+// TestProcessRepositoryPostgres runs the pipeline on the fixture corpus
+// against a real PostgreSQL server
+func TestProcessRepositoryPostgres(t *testing.T) {
+    config := startPostgres(t)
+    ctx := context.Background()
+
+    storage := NewPostgresStorage(config)
+    extractor := newTestExtractor(t, newFakeGitClient(), storage)
+    if err := extractor.ConnectToDB(ctx); err != nil {
+        t.Fatalf("ConnectToDB: %v", err)
+    }
+    defer extractor.CloseDB()
+
+    result, err := extractor.ProcessRepository(ctx, "https://github.com/example/corpus")
+    if err != nil {
+        t.Fatalf("ProcessRepository: %v", err)
+    }
+    if len(result.CreatedTables) == 0 {
+        t.Fatalf("no tables were created; errors: %q", result.Errors)
+    }
+
+    for _, name := range result.CreatedTables {
+        if _, ok, err := storage.ReadTable(name); err != nil || !ok {
+            t.Errorf("created table %s cannot be read back: found %v, error %v", name, ok, err)
+        }
+    }
+
+    greeting, ok, err := storage.ReadTable("greeting")
+    if err != nil || !ok {
+        t.Fatalf("table greeting cannot be read back: found %v, error %v", ok, err)
+    }
+    if len(greeting.Rows) != 1 || !rowContains(greeting.Rows[0], "hello, corpus") {
+        t.Errorf("greeting holds %v, want one row with \"hello, corpus\"", greeting.Rows)
+    }
+
+    // Postgres would silently cut longer names, so they are shortened first
+    for _, name := range result.CreatedTables {
+        if len(name) > maxIdentifierBytes {
+            t.Errorf("table %s is longer than %d bytes", name, maxIdentifierBytes)
+        }
+    }
+}
+
+// TestPostgresStorageConformance runs the conformance checks against a real
+// PostgreSQL server, comparing the stored rows
+func TestPostgresStorageConformance(t *testing.T) {
+    config := startPostgres(t)
+    storagetest.Check(t, func() (Storage, error) {
+        return NewPostgresStorage(config), nil
+    })
+}
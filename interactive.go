@@ -0,0 +1,126 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "strings"
+    "sync"
+    "time"
+)
+
+// approvalsBucket is the state store bucket holding remembered decisions
+const approvalsBucket = "approvals"
+
+// Approval decisions
+const (
+    approvalYes    = "yes"
+    approvalNo     = "no"
+    approvalAlways = "always"
+    approvalNever  = "never"
+)
+
+// storedApproval is a remembered always/never decision for a function
+type storedApproval struct {
+    Function  string    `json:"function"`
+    Decision  string    `json:"decision"`
+    DecidedAt time.Time `json:"decided_at"`
+}
+
+// Approver asks the user before each function execution in interactive
+// mode. "always" and "never" answers are remembered per function source
+// hash, so they apply to future runs until the function changes.
+type Approver struct {
+    mu    sync.Mutex
+    in    *bufio.Reader
+    out   io.Writer
+    state *StateStore
+}
+
+// NewApprover creates an approver reading answers from in and writing
+// prompts to out. Decisions are remembered in state when it is non-nil.
+func NewApprover(in io.Reader, out io.Writer, state *StateStore) *Approver {
+    return &Approver{
+        in:    bufio.NewReader(in),
+        out:   out,
+        state: state,
+    }
+}
+
+// Approve reports whether the function may be executed, prompting unless a
+// remembered decision applies
+func (a *Approver) Approve(function FunctionInfo) (bool, error) {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+
+    key := function.SourceHash
+    if a.state != nil && key != "" {
+        var stored storedApproval
+        found, err := a.state.Get(approvalsBucket, key, &stored)
+        if err != nil {
+            return false, err
+        }
+        if found {
+            fmt.Fprintf(a.out, "%s: remembered decision %q\n", function.Name, stored.Decision)
+            return stored.Decision == approvalAlways, nil
+        }
+    }
+
+    a.describe(function)
+    for {
+        fmt.Fprint(a.out, "Execute? [y]es/[n]o/[a]lways/ne[v]er: ")
+        line, err := a.in.ReadString('\n')
+        if err != nil && line == "" {
+            return false, fmt.Errorf("failed to read approval: %w", err)
+        }
+
+        decision := parseApproval(line)
+        if decision == "" {
+            fmt.Fprintln(a.out, "Please answer y, n, always, or never.")
+            continue
+        }
+
+        if (decision == approvalAlways || decision == approvalNever) && a.state != nil && key != "" {
+            stored := storedApproval{Function: function.RelativePath + ":" + function.Name, Decision: decision, DecidedAt: time.Now()}
+            if err := a.state.Put(approvalsBucket, key, stored); err != nil {
+                return false, err
+            }
+        }
+        return decision == approvalYes || decision == approvalAlways, nil
+    }
+}
+
+// describe prints the signature, doc comment, class, and safety
+// classification of a function
+func (a *Approver) describe(function FunctionInfo) {
+    safety := classifySafety(function)
+
+    fmt.Fprintf(a.out, "\n%s  (%s:%d)\n", functionSignature(function), function.RelativePath, function.LineNumber)
+    if doc := strings.TrimSpace(function.Comment); doc != "" {
+        for _, line := range strings.Split(doc, "\n") {
+            fmt.Fprintf(a.out, "    // %s\n", line)
+        }
+    }
+    if function.Class != "" {
+        fmt.Fprintf(a.out, "Class: %s\n", function.Class)
+    }
+    fmt.Fprintf(a.out, "Safety: %s\n", safety.Level)
+    for _, reason := range safety.Reasons {
+        fmt.Fprintf(a.out, "  - %s\n", reason)
+    }
+}
+
+// parseApproval maps an answer to a decision, returning "" if unrecognized
+func parseApproval(answer string) string {
+    switch strings.ToLower(strings.TrimSpace(answer)) {
+    case "y", "yes":
+        return approvalYes
+    case "n", "no":
+        return approvalNo
+    case "a", "always":
+        return approvalAlways
+    case "v", "never":
+        return approvalNever
+    }
+    return ""
+}
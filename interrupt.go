@@ -0,0 +1,64 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "time"
+)
+
+// interruptedExitCode is the exit status of a run stopped by SIGINT or
+// SIGTERM, as shells report for SIGINT
+const interruptedExitCode = 130
+
+// timedOutExitCode is the exit status of a run stopped by its timeout, as
+// timeout(1) reports
+const timedOutExitCode = 124
+
+// errInterrupted stops processing a repository once the run is interrupted
+var errInterrupted = errors.New("processing interrupted")
+
+// withRunTimeout returns ctx bounded by the run timeout in seconds, or ctx
+// unbounded when there is none
+func withRunTimeout(ctx context.Context, seconds int) (context.Context, context.CancelFunc) {
+    if seconds <= 0 {
+        return context.WithCancel(ctx)
+    }
+    return context.WithTimeout(ctx, time.Duration(seconds)*time.Second)
+}
+
+// timedOut reports whether ctx ended because its deadline passed, as
+// opposed to being cancelled by an interrupt
+func timedOut(ctx context.Context) bool {
+    return errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
+
+// abort marks the run as interrupted, by its timeout when timedOut is
+// set, before the pending repositories were processed
+func (r *Run) abort(pending []RepoSpec, timedOut bool) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.aborted = true
+    r.timedOut = timedOut
+    r.pending = append([]RepoSpec(nil), pending...)
+}
+
+// Pending returns the repositories an interrupted run did not start
+func (r *Run) Pending() []RepoSpec {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return append([]RepoSpec(nil), r.pending...)
+}
+
+// Aborted reports whether the run was interrupted
+func (r *Run) Aborted() bool {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return r.aborted
+}
+
+// TimedOut reports whether the run's timeout interrupted it
+func (r *Run) TimedOut() bool {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return r.timedOut
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "time"
+)
+
+// Job statuses stored in the jobs table
+const (
+    JobQueued    = "queued"
+    JobRunning   = "running"
+    JobSucceeded = "succeeded"
+    JobFailed    = "failed"
+)
+
+// jobsSchema creates the table backing the service mode job queue; it is
+// rendered with the partition strategy's primary key and clause
+const jobsSchema = `CREATE TABLE IF NOT EXISTS floq_jobs (
+    id           BIGSERIAL,
+    repo_url     TEXT NOT NULL,
+    status       TEXT NOT NULL DEFAULT 'queued',
+    attempts     INTEGER NOT NULL DEFAULT 0,
+    worker_id    TEXT,
+    progress     TEXT,
+    last_error   TEXT,
+    result       JSONB,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    started_at   TIMESTAMPTZ,
+    heartbeat_at TIMESTAMPTZ,
+    finished_at  TIMESTAMPTZ,
+    PRIMARY KEY (%[1]s)
+)%[2]s`
+
+// Job is a queued request to process one repository
+type Job struct {
+    ID          int64      `json:"id"`
+    RepoURL     string     `json:"repo_url"`
+    Status      string     `json:"status"`
+    Attempts    int        `json:"attempts"`
+    WorkerID    string     `json:"worker_id,omitempty"`
+    Progress    string     `json:"progress,omitempty"`
+    LastError   string     `json:"last_error,omitempty"`
+    CreatedAt   time.Time  `json:"created_at"`
+    HeartbeatAt *time.Time `json:"heartbeat_at,omitempty"`
+}
+
+// JobStore persists the service mode job queue in PostgreSQL
+type JobStore struct {
+    db         *sql.DB
+    // reader serves List, which tolerates replication lag
+    reader     *sql.DB
+    partitions PartitionStrategy
+}
+
+// NewJobStore creates a job store and ensures its table exists,
+// partitioned by the given strategy
+func NewJobStore(db *sql.DB, partitions PartitionStrategy) (*JobStore, error) {
+    if err := createPartitionedTable(context.Background(), db, partitions, jobsTable, jobsSchema); err != nil {
+        return nil, fmt.Errorf("failed to create jobs table: %w", err)
+    }
+    return &JobStore{db: db, reader: db, partitions: partitions}, nil
+}
+
+// SetReader lists jobs from reader, e.g. a read replica, instead of the
+// primary
+func (s *JobStore) SetReader(reader *sql.DB) {
+    s.reader = reader
+}
+
+// Ping verifies the jobs table can be queried
+func (s *JobStore) Ping(ctx context.Context) error {
+    var exists bool
+    return s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM floq_jobs)").Scan(&exists)
+}
+
+// Enqueue adds a repository to the queue
+func (s *JobStore) Enqueue(repoURL string) (*Job, error) {
+    job := &Job{RepoURL: repoURL, Status: JobQueued}
+    if err := s.partitions.Prepare(context.Background(), s.db, jobsTable, time.Now()); err != nil {
+        return nil, fmt.Errorf("failed to enqueue job: %w", err)
+    }
+    err := s.db.QueryRow(
+        "INSERT INTO floq_jobs (repo_url) VALUES ($1) RETURNING id, created_at",
+        repoURL).Scan(&job.ID, &job.CreatedAt)
+    if err != nil {
+        return nil, fmt.Errorf("failed to enqueue job: %w", err)
+    }
+    return job, nil
+}
+
+// Claim atomically takes the oldest queued job for a worker, returning nil
+// when the queue is empty. Concurrent workers never claim the same job.
+func (s *JobStore) Claim(workerID string) (*Job, error) {
+    job := &Job{}
+    err := s.db.QueryRow(`
+        UPDATE floq_jobs
+        SET status = $1, worker_id = $2, attempts = attempts + 1,
+            started_at = now(), heartbeat_at = now(), progress = NULL
+        WHERE id = (
+            SELECT id FROM floq_jobs
+            WHERE status = $3
+            ORDER BY id
+            FOR UPDATE SKIP LOCKED
+            LIMIT 1
+        )
+        RETURNING id, repo_url, status, attempts, worker_id, created_at`,
+        JobRunning, workerID, JobQueued).Scan(
+        &job.ID, &job.RepoURL, &job.Status, &job.Attempts, &job.WorkerID, &job.CreatedAt)
+    if errors.Is(err, sql.ErrNoRows) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to claim job: %w", err)
+    }
+    return job, nil
+}
+
+// Heartbeat records that a worker is still making progress on a job. It
+// fails if the job was reaped and handed to another worker in the meantime.
+func (s *JobStore) Heartbeat(job *Job, progress string) error {
+    res, err := s.db.Exec(`
+        UPDATE floq_jobs SET heartbeat_at = now(), progress = $1
+        WHERE id = $2 AND worker_id = $3 AND status = $4`,
+        progress, job.ID, job.WorkerID, JobRunning)
+    if err != nil {
+        return fmt.Errorf("failed to record heartbeat: %w", err)
+    }
+    if n, _ := res.RowsAffected(); n == 0 {
+        return fmt.Errorf("job %d is no longer owned by %s", job.ID, job.WorkerID)
+    }
+    return nil
+}
+
+// Complete marks a job as succeeded and stores its result
+func (s *JobStore) Complete(job *Job, result *ProcessingResult) error {
+    data, err := json.Marshal(result)
+    if err != nil {
+        return fmt.Errorf("failed to marshal job result: %w", err)
+    }
+    res, err := s.db.Exec(`
+        UPDATE floq_jobs SET status = $1, result = $2, finished_at = now()
+        WHERE id = $3 AND worker_id = $4 AND status = $5`,
+        JobSucceeded, string(data), job.ID, job.WorkerID, JobRunning)
+    if err != nil {
+        return fmt.Errorf("failed to complete job: %w", err)
+    }
+    // The reaper may have requeued the job while it was running
+    if n, _ := res.RowsAffected(); n == 0 {
+        return fmt.Errorf("job %d is no longer running under %s", job.ID, job.WorkerID)
+    }
+    return nil
+}
+
+// Fail records a job failure, re-queueing it unless it has exhausted
+// maxAttempts. It reports whether the failure was final.
+func (s *JobStore) Fail(job *Job, jobErr error, maxAttempts int) (bool, error) {
+    var status string
+    err := s.db.QueryRow(`
+        UPDATE floq_jobs
+        SET status = CASE WHEN attempts >= $1 THEN $2 ELSE $3 END,
+            last_error = $4, worker_id = NULL,
+            finished_at = CASE WHEN attempts >= $1 THEN now() END
+        WHERE id = $5 AND worker_id = $6
+        RETURNING status`,
+        maxAttempts, JobFailed, JobQueued, jobErr.Error(), job.ID, job.WorkerID).Scan(&status)
+    if errors.Is(err, sql.ErrNoRows) {
+        return false, fmt.Errorf("job %d is no longer owned by %s", job.ID, job.WorkerID)
+    }
+    if err != nil {
+        return false, fmt.Errorf("failed to record job failure: %w", err)
+    }
+    return status == JobFailed, nil
+}
+
+// ReapStale finds running jobs whose worker has not sent a heartbeat within
+// staleAfter and re-queues them, or fails them permanently once they have
+// used maxAttempts. It returns the number of requeued and failed jobs.
+func (s *JobStore) ReapStale(staleAfter time.Duration, maxAttempts int) (requeued, failed int, err error) {
+    rows, err := s.db.Query(`
+        UPDATE floq_jobs
+        SET status = CASE WHEN attempts >= $1 THEN $2 ELSE $3 END,
+            last_error = 'worker ' || COALESCE(worker_id, '?') || ' stopped sending heartbeats',
+            worker_id = NULL,
+            finished_at = CASE WHEN attempts >= $1 THEN now() END
+        WHERE status = $4 AND heartbeat_at < now() - make_interval(secs => $5)
+        RETURNING status`,
+        maxAttempts, JobFailed, JobQueued, JobRunning, staleAfter.Seconds())
+    if err != nil {
+        return 0, 0, fmt.Errorf("failed to reap stale jobs: %w", err)
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var status string
+        if err := rows.Scan(&status); err != nil {
+            return requeued, failed, fmt.Errorf("failed to scan reaped job: %w", err)
+        }
+        if status == JobFailed {
+            failed++
+        } else {
+            requeued++
+        }
+    }
+    return requeued, failed, rows.Err()
+}
+
+// List returns the most recent jobs, newest first
+func (s *JobStore) List(limit int) ([]Job, error) {
+    rows, err := s.reader.Query(`
+        SELECT id, repo_url, status, attempts, COALESCE(worker_id, ''),
+               COALESCE(progress, ''), COALESCE(last_error, ''), created_at, heartbeat_at
+        FROM floq_jobs ORDER BY id DESC LIMIT $1`, limit)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list jobs: %w", err)
+    }
+    defer rows.Close()
+
+    var jobs []Job
+    for rows.Next() {
+        var job Job
+        if err := rows.Scan(&job.ID, &job.RepoURL, &job.Status, &job.Attempts, &job.WorkerID,
+            &job.Progress, &job.LastError, &job.CreatedAt, &job.HeartbeatAt); err != nil {
+            return nil, fmt.Errorf("failed to scan job: %w", err)
+        }
+        jobs = append(jobs, job)
+    }
+    return jobs, rows.Err()
+}
+
+// JobDetail is a job with its timestamps and, once it succeeded, its result
+type JobDetail struct {
+    Job
+    StartedAt  *time.Time        `json:"started_at,omitempty"`
+    FinishedAt *time.Time        `json:"finished_at,omitempty"`
+    Result     *ProcessingResult `json:"result,omitempty"`
+}
+
+// Get returns a job by id, or nil if there is none
+func (s *JobStore) Get(id int64) (*JobDetail, error) {
+    var job JobDetail
+    var result []byte
+    err := s.reader.QueryRow(`
+        SELECT id, repo_url, status, attempts, COALESCE(worker_id, ''),
+               COALESCE(progress, ''), COALESCE(last_error, ''), created_at, heartbeat_at,
+               started_at, finished_at, result
+        FROM floq_jobs WHERE id = $1`, id).Scan(&job.ID, &job.RepoURL, &job.Status, &job.Attempts,
+        &job.WorkerID, &job.Progress, &job.LastError, &job.CreatedAt, &job.HeartbeatAt,
+        &job.StartedAt, &job.FinishedAt, &result)
+    if errors.Is(err, sql.ErrNoRows) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to get job: %w", err)
+    }
+    if result != nil {
+        job.Result = &ProcessingResult{}
+        if err := json.Unmarshal(result, job.Result); err != nil {
+            return nil, fmt.Errorf("failed to decode job result: %w", err)
+        }
+    }
+    return &job, nil
+}
+
+// LatestResults returns the result of the most recent successful job of
+// every repository, keyed by repository URL
+func (s *JobStore) LatestResults() (map[string]*ProcessingResult, error) {
+    rows, err := s.reader.Query(`
+        SELECT DISTINCT ON (repo_url) repo_url, result
+        FROM floq_jobs WHERE status = $1 AND result IS NOT NULL
+        ORDER BY repo_url, finished_at DESC`, JobSucceeded)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list results: %w", err)
+    }
+    defer rows.Close()
+
+    results := make(map[string]*ProcessingResult)
+    for rows.Next() {
+        var repoURL string
+        var data []byte
+        if err := rows.Scan(&repoURL, &data); err != nil {
+            return nil, fmt.Errorf("failed to scan result: %w", err)
+        }
+        result := &ProcessingResult{}
+        if err := json.Unmarshal(data, result); err != nil {
+            return nil, fmt.Errorf("failed to decode result of %s: %w", repoURL, err)
+        }
+        results[repoURL] = result
+    }
+    return results, rows.Err()
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+    "go/ast"
+    "go/token"
+)
+
+// Function kinds recorded in FunctionInfo.Kind
+const (
+    // FunctionKindFunc is a top-level function declaration
+    FunctionKindFunc = "func"
+    // FunctionKindVariable is an exported package-level variable holding a
+    // function literal, e.g. var Handler = func(...) {...}
+    FunctionKindVariable = "var"
+    // FunctionKindClosure is a function literal bound to a local variable
+    // inside an exported function; it is extracted but never executed
+    FunctionKindClosure = "closure"
+    // FunctionKindCommand is the main function of a main package, run as
+    // a command with the configured argument sets
+    FunctionKindCommand = "command"
+)
+
+// ExtractionConfig enables optional kinds of extracted functions
+type ExtractionConfig struct {
+    // FuncVariables extracts exported variables initialized with function
+    // literals
+    FuncVariables bool `json:"func_variables"`
+    // Closures extracts function literals assigned to local variables of
+    // exported functions, named Outer.local
+    Closures      bool `json:"closures"`
+    // Paths limits processing to these repository-relative directories,
+    // which are the only ones checked out when the git client supports it
+    Paths         []string `json:"paths,omitempty"`
+    // IgnoreFile is the global ignore file applied to every repository
+    // before its own .floqignore; floq/ignore in the user's configuration
+    // directory is used when it exists
+    IgnoreFile    string `json:"ignore_file,omitempty"`
+    // EmbeddedGo catalogues the functions in //go:generate code, the
+    // generator programs it runs, and Go templates
+    EmbeddedGo    bool `json:"embedded_go,omitempty"`
+    // Cache reuses the functions extracted from files whose content is
+    // unchanged since an earlier run, from the local state store
+    Cache         bool `json:"cache,omitempty"`
+}
+
+// extractFuncVariables extracts the exported variables of a var declaration
+// that are initialized with function literals. base supplies the file
+// fields of the returned functions.
+func (g *GitHubFunctionExtractor) extractFuncVariables(fset *token.FileSet, src []byte, decl *ast.GenDecl, base FunctionInfo, imports map[string]string) []FunctionInfo {
+    if decl.Tok != token.VAR {
+        return nil
+    }
+
+    var functions []FunctionInfo
+    for _, spec := range decl.Specs {
+        valueSpec, ok := spec.(*ast.ValueSpec)
+        if !ok {
+            continue
+        }
+        for i, name := range valueSpec.Names {
+            if i >= len(valueSpec.Values) || !ast.IsExported(name.Name) {
+                continue
+            }
+            lit, ok := valueSpec.Values[i].(*ast.FuncLit)
+            if !ok {
+                continue
+            }
+
+            function := base
+            function.Name = name.Name
+            function.Kind = FunctionKindVariable
+            function.LineNumber = fset.Position(name.Pos()).Line
+            function.Column = fset.Position(name.Pos()).Column
+            function.IsExported = true
+            g.fillSignature(&function, lit.Type)
+
+            // A doc comment may sit on the spec or, for single-spec
+            // declarations, on the var keyword
+            if valueSpec.Doc != nil {
+                function.Comment = valueSpec.Doc.Text()
+            } else if decl.Doc != nil && len(decl.Specs) == 1 {
+                function.Comment = decl.Doc.Text()
+            }
+
+            function.SourceHash = sourceHash(fset, src, valueSpec)
+            function.Calls = functionCalls(lit.Body, imports)
+            functions = append(functions, function)
+        }
+    }
+    return functions
+}
+
+// extractClosures extracts the function literals bound to local variables
+// (x := func... or var x = func...) anywhere in an exported function's body
+func (g *GitHubFunctionExtractor) extractClosures(fset *token.FileSet, src []byte, decl *ast.FuncDecl, outer FunctionInfo, imports map[string]string) []FunctionInfo {
+    if decl.Body == nil {
+        return nil
+    }
+
+    var functions []FunctionInfo
+    add := func(name *ast.Ident, lit *ast.FuncLit) {
+        if name.Name == "_" {
+            return
+        }
+        function := FunctionInfo{
+            Name:         outer.Name + "." + name.Name,
+            Kind:         FunctionKindClosure,
+            FilePath:     outer.FilePath,
+            RelativePath: outer.RelativePath,
+            PackageName:  outer.PackageName,
+            LineNumber:   fset.Position(name.Pos()).Line,
+            Column:       fset.Position(name.Pos()).Column,
+        }
+        g.fillSignature(&function, lit.Type)
+        function.SourceHash = sourceHash(fset, src, lit)
+        function.Calls = functionCalls(lit.Body, imports)
+        functions = append(functions, function)
+    }
+
+    ast.Inspect(decl.Body, func(n ast.Node) bool {
+        switch stmt := n.(type) {
+        case *ast.AssignStmt:
+            for i, rhs := range stmt.Rhs {
+                lit, ok := rhs.(*ast.FuncLit)
+                if !ok || i >= len(stmt.Lhs) {
+                    continue
+                }
+                if name, ok := stmt.Lhs[i].(*ast.Ident); ok {
+                    add(name, lit)
+                }
+            }
+        case *ast.ValueSpec:
+            for i, value := range stmt.Values {
+                if lit, ok := value.(*ast.FuncLit); ok && i < len(stmt.Names) {
+                    add(stmt.Names[i], lit)
+                }
+            }
+        }
+        return true
+    })
+    return functions
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "os/exec"
+    "strings"
+    "time"
+)
+
+// Kinds of resource limits an execution can hit
+const (
+    ResourceTimeout = "timeout"
+    ResourceMemory  = "memory"
+)
+
+// defaultRetryFactor multiplies the limits of second-chance executions
+// when no factor is configured
+const defaultRetryFactor = 2
+
+// ExecutionLimits bounds a single function execution; zero values mean
+// unlimited
+type ExecutionLimits struct {
+    Timeout  time.Duration
+    MemoryMB int
+}
+
+// executionLimits returns the limits configured for executions
+func executionLimits(config ExecutionConfig) ExecutionLimits {
+    return ExecutionLimits{
+        Timeout:  time.Duration(config.Timeout) * time.Second,
+        MemoryMB: config.MemoryLimitMB,
+    }
+}
+
+// scaled returns the limits multiplied by factor
+func (l ExecutionLimits) scaled(factor int) ExecutionLimits {
+    return ExecutionLimits{Timeout: l.Timeout * time.Duration(factor), MemoryMB: l.MemoryMB * factor}
+}
+
+// String describes the limits, e.g. "timeout 30s, memory 512 MiB"
+func (l ExecutionLimits) String() string {
+    var parts []string
+    if l.Timeout > 0 {
+        parts = append(parts, "timeout "+l.Timeout.String())
+    }
+    if l.MemoryMB > 0 {
+        parts = append(parts, fmt.Sprintf("memory %d MiB", l.MemoryMB))
+    }
+    if len(parts) == 0 {
+        return "unlimited"
+    }
+    return strings.Join(parts, ", ")
+}
+
+// ResourceError reports an execution that ran out of time or memory and
+// might succeed with more headroom
+type ResourceError struct {
+    Function string
+    Kind     string
+    Limits   ExecutionLimits
+    Err      error
+}
+
+// Error describes which limit the function hit
+func (e *ResourceError) Error() string {
+    return fmt.Sprintf("function %s exceeded its %s limit (%s): %v", e.Function, e.Kind, e.Limits, e.Err)
+}
+
+// Unwrap returns the underlying execution error
+func (e *ResourceError) Unwrap() error {
+    return e.Err
+}
+
+// isResourceError reports whether err is a ResourceError
+func isResourceError(err error) bool {
+    var resourceErr *ResourceError
+    return errors.As(err, &resourceErr)
+}
+
+// resourceFailure classifies a failed execution: it ran out of time when
+// its context expired, and out of memory when the Go runtime said so or,
+// under a memory limit, the process was killed, as the OOM killer does
+func resourceFailure(ctx context.Context, err error, stderr []byte, limits ExecutionLimits) string {
+    if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+        return ResourceTimeout
+    }
+    // Interrupted executions were killed on purpose
+    if errors.Is(ctx.Err(), context.Canceled) {
+        return ""
+    }
+    if strings.Contains(string(stderr), "out of memory") || strings.Contains(string(stderr), "cannot allocate memory") {
+        return ResourceMemory
+    }
+    var exitErr *exec.ExitError
+    if limits.MemoryMB > 0 && errors.As(err, &exitErr) && strings.Contains(exitErr.String(), "signal: killed") {
+        return ResourceMemory
+    }
+    return ""
+}
+
+// RetriedExecution records the second chance given to an execution that
+// hit a resource limit
+type RetriedExecution struct {
+    Function   string `json:"function"`
+    FirstError string `json:"first_error"`
+    // Limits are the increased limits of the retry
+    Limits    string `json:"limits"`
+    Succeeded bool   `json:"succeeded"`
+    Error     string `json:"error,omitempty"`
+}
+
+// deferredExecution is an execution that hit a resource limit, held back
+// for the second-chance pass at the end of the repository
+type deferredExecution struct {
+    function FunctionInfo
+    args     []string
+    err      error
+}
+
+// retryResourceFailures runs every deferred execution once more with the
+// limits multiplied by the configured factor, recording successful outputs
+// like any other and marking every outcome in result.Retries
+func (g *GitHubFunctionExtractor) retryResourceFailures(ctx context.Context, deferred []deferredExecution, result *ProcessingResult) {
+    if len(deferred) == 0 {
+        return
+    }
+
+    base := g.limits
+    factor := g.execConfig.RetryFactor
+    if factor == 0 {
+        factor = defaultRetryFactor
+    }
+    g.limits = base.scaled(factor)
+    defer func() { g.limits = base }()
+
+    g.logger.Printf("Retrying %d executions that hit resource limits with %s", len(deferred), g.limits)
+    for _, execution := range deferred {
+        g.reportProgress("retrying %s", execution.function.Name)
+        retry := RetriedExecution{
+            Function:   execution.function.Name,
+            FirstError: execution.err.Error(),
+            Limits:     g.limits.String(),
+        }
+
+        var output *ExecutionOutput
+        var err error
+        if len(execution.args) > 0 {
+            output, err = g.ExecuteFunctionWithArgs(ctx, execution.function, execution.args)
+        } else {
+            output, err = g.ExecuteFunction(ctx, execution.function)
+        }
+        g.recordStability(execution.function, err)
+        if err != nil {
+            retry.Error = err.Error()
+            result.Errors = append(result.Errors,
+                g.functionError(execution.function, "Failed to execute function %s after retry: %v", execution.function.Name, err))
+        } else {
+            retry.Succeeded = true
+            g.logger.Printf("Retry of %s succeeded with %s", execution.function.Name, g.limits)
+            g.recordOutput(ctx, execution.function, output, result)
+        }
+        result.Retries = append(result.Retries, retry)
+    }
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import (
+    "context"
+    "os/exec"
+)
+
+// limitedCommand runs binary with args; hard memory limits are not
+// supported on this platform, so only the GOMEMLIMIT soft limit applies
+func limitedCommand(ctx context.Context, binary string, memoryMB int, args ...string) *exec.Cmd {
+    return exec.CommandContext(ctx, binary, args...)
+}
@@ -0,0 +1,21 @@
+//go:build unix
+
+package main
+
+import (
+    "context"
+    "os/exec"
+    "strconv"
+)
+
+// limitedCommand runs binary with args and its data segment capped at
+// memoryMB through the shell's ulimit, which applies before the binary
+// starts. The Go heap counts against the data limit; an address space limit
+// would instead break the runtime's up-front reservations.
+func limitedCommand(ctx context.Context, binary string, memoryMB int, args ...string) *exec.Cmd {
+    if memoryMB <= 0 {
+        return exec.CommandContext(ctx, binary, args...)
+    }
+    return exec.CommandContext(ctx, "/bin/sh", append([]string{"-c", `ulimit -d "$1" && shift && exec "$0" "$@"`,
+        binary, strconv.Itoa(memoryMB*1024)}, args...)...)
+}
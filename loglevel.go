@@ -0,0 +1,60 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "regexp"
+    "sync/atomic"
+)
+
+// Log levels; see Config.LogLevel
+const (
+    LogLevelDebug = "debug"
+    LogLevelInfo  = "info"
+    LogLevelWarn  = "warn"
+)
+
+// warningLine matches the log lines reporting a problem: by convention
+// their message starts with Failed, Warning or Error, or says what failed
+// or was rejected
+var warningLine = regexp.MustCompile(`^(\[[A-Z]+\] )?[0-9/]+ [0-9:]+ ([^ ]+\.go:[0-9]+: )?(Failed|Warning|Error|.*\b(failed|rejected)\b)`)
+
+// logFilter holds whether only warnings are logged. Every log written
+// through a writer wrapped by filterLog follows it, so the level can change
+// while loggers are in use.
+var logFilter atomic.Bool
+
+// levelWriter drops the log lines below the current level
+type levelWriter struct {
+    out io.Writer
+}
+
+// Write implements io.Writer; a logger writes each line in one call
+func (w levelWriter) Write(p []byte) (int, error) {
+    if logFilter.Load() && !warningLine.Match(p) {
+        return len(p), nil
+    }
+    return w.out.Write(p)
+}
+
+// filterLog wraps a log destination so it follows the log level
+func filterLog(out io.Writer) io.Writer {
+    if _, ok := out.(levelWriter); ok {
+        return out
+    }
+    return levelWriter{out: out}
+}
+
+// setLogLevel switches the level of every filtered log
+func setLogLevel(level string) {
+    logFilter.Store(level == LogLevelWarn)
+}
+
+// validateLogLevel checks a configured log level
+func validateLogLevel(level string) error {
+    switch level {
+    case "", LogLevelDebug, LogLevelInfo, LogLevelWarn:
+        return nil
+    }
+    return fmt.Errorf("unsupported log level %q, want %s, %s or %s", level, LogLevelDebug, LogLevelInfo, LogLevelWarn)
+}
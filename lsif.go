@@ -0,0 +1,169 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+)
+
+// lsifVersion is the LSIF protocol version emitted by WriteLSIF
+const lsifVersion = "0.5.0"
+
+// lsifWriter emits LSIF vertices and edges as JSON lines with sequential ids
+type lsifWriter struct {
+    enc    *json.Encoder
+    nextID int
+    err    error
+}
+
+// emit writes one LSIF element and returns its id
+func (w *lsifWriter) emit(element map[string]interface{}) int {
+    w.nextID++
+    element["id"] = w.nextID
+    if w.err == nil {
+        w.err = w.enc.Encode(element)
+    }
+    return w.nextID
+}
+
+// vertex emits an LSIF vertex with the given label and properties
+func (w *lsifWriter) vertex(label string, props map[string]interface{}) int {
+    element := map[string]interface{}{"type": "vertex", "label": label}
+    for k, v := range props {
+        element[k] = v
+    }
+    return w.emit(element)
+}
+
+// edge emits an LSIF edge from outV to one or more inVs
+func (w *lsifWriter) edge(label string, outV int, inVs ...int) {
+    element := map[string]interface{}{"type": "edge", "label": label, "outV": outV}
+    if len(inVs) == 1 && label != "contains" && label != "item" {
+        element["inV"] = inVs[0]
+    } else {
+        element["inVs"] = inVs
+    }
+    w.emit(element)
+}
+
+// WriteLSIF exports a repository's extracted functions as an LSIF dump so it
+// can be loaded into code-intelligence tools. Each function becomes a
+// definition range with hover text (signature and doc comment) and an
+// exported moniker "<package>.<Name>". Document URIs are rooted at the
+// repository URL.
+func WriteLSIF(out io.Writer, repoURL string, functions []FunctionInfo) error {
+    w := &lsifWriter{enc: json.NewEncoder(out)}
+    root := strings.TrimSuffix(repoURL, ".git") + "/"
+
+    w.vertex("metaData", map[string]interface{}{
+        "version":          lsifVersion,
+        "projectRoot":      root,
+        "positionEncoding": "utf-16",
+        "toolInfo":         map[string]interface{}{"name": "floq-v1"},
+    })
+    project := w.vertex("project", map[string]interface{}{"kind": "go"})
+
+    // Group functions by document, keeping first-seen order
+    var paths []string
+    byPath := make(map[string][]FunctionInfo)
+    for _, function := range functions {
+        if _, ok := byPath[function.RelativePath]; !ok {
+            paths = append(paths, function.RelativePath)
+        }
+        byPath[function.RelativePath] = append(byPath[function.RelativePath], function)
+    }
+
+    var documents []int
+    for _, path := range paths {
+        document := w.vertex("document", map[string]interface{}{
+            "uri":        root + path,
+            "languageId": "go",
+        })
+        documents = append(documents, document)
+
+        var ranges []int
+        for _, function := range byPath[path] {
+            line := function.LineNumber - 1
+            start := function.Column - 1
+            rng := w.vertex("range", map[string]interface{}{
+                "start": map[string]int{"line": line, "character": start},
+                "end":   map[string]int{"line": line, "character": start + len(function.Name)},
+                "tag": map[string]interface{}{
+                    "type": "definition",
+                    "text": function.Name,
+                    "kind": 12, // SymbolKind.Function
+                    "fullRange": map[string]interface{}{
+                        "start": map[string]int{"line": line, "character": 0},
+                        "end":   map[string]int{"line": line, "character": start + len(function.Name)},
+                    },
+                },
+            })
+            ranges = append(ranges, rng)
+
+            resultSet := w.vertex("resultSet", nil)
+            w.edge("next", rng, resultSet)
+
+            hover := w.vertex("hoverResult", map[string]interface{}{
+                "result": map[string]interface{}{
+                    "contents": []map[string]string{
+                        {"language": "go", "value": functionSignature(function)},
+                        {"language": "markdown", "value": function.Comment},
+                    },
+                },
+            })
+            w.edge("textDocument/hover", resultSet, hover)
+
+            definition := w.vertex("definitionResult", nil)
+            w.edge("textDocument/definition", resultSet, definition)
+            w.emit(map[string]interface{}{
+                "type": "edge", "label": "item", "outV": definition,
+                "inVs": []int{rng}, "shard": document,
+            })
+
+            moniker := w.vertex("moniker", map[string]interface{}{
+                "kind":       "export",
+                "scheme":     "gomod",
+                "identifier": function.PackageName + "." + function.Name,
+                "unique":     "scheme",
+            })
+            w.edge("moniker", resultSet, moniker)
+        }
+        if len(ranges) > 0 {
+            w.edge("contains", document, ranges...)
+        }
+    }
+
+    if len(documents) > 0 {
+        w.edge("contains", project, documents...)
+    }
+    return w.err
+}
+
+// functionSignature renders a function's declaration line
+func functionSignature(function FunctionInfo) string {
+    signature := fmt.Sprintf("func %s(%s)", function.Name, strings.Join(function.Parameters, ", "))
+    switch len(function.ReturnTypes) {
+    case 0:
+    case 1:
+        signature += " " + function.ReturnTypes[0]
+    default:
+        signature += " (" + strings.Join(function.ReturnTypes, ", ") + ")"
+    }
+    return signature
+}
+
+// SaveLSIFFile writes a repository's LSIF dump to filename
+func SaveLSIFFile(filename, repoURL string, functions []FunctionInfo) error {
+    file, err := os.Create(filename)
+    if err != nil {
+        return fmt.Errorf("failed to create LSIF file: %w", err)
+    }
+    defer file.Close()
+
+    if err := WriteLSIF(file, repoURL, functions); err != nil {
+        return fmt.Errorf("failed to write LSIF dump: %w", err)
+    }
+    return nil
+}
@@ -1,49 +1,489 @@
 package main
 
 import (
+    "context"
+    "flag"
+    "io"
     "log"
     "os"
+    "os/signal"
+    "path/filepath"
+    "strings"
+    "syscall"
 )
 
+// logOutput is the destination of all component loggers. It defaults to
+// stdout and is redirected to also write into the run's log artifact.
+var logOutput io.Writer = os.Stdout
+
 func main() {
-    // Load configuration from environment or file
-    var config DatabaseConfig
-    var err error
+    flag.Usage = usage
+    configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a JSON config file")
+    profile := flag.String("profile", os.Getenv("FLOQ_PROFILE"), "named profile from the config file to apply")
+    dbHost := flag.String("db-host", "", "database host (overrides config and environment)")
+    dbPort := flag.String("db-port", "", "database port (overrides config and environment)")
+    dbName := flag.String("db-name", "", "database name (overrides config and environment)")
+    dbUser := flag.String("db-user", "", "database user (overrides config and environment)")
+    artifactsDir := flag.String("artifacts-dir", "", "artifacts directory (overrides config and environment)")
+    workers := flag.Int("workers", 0, "service mode worker count (overrides config and environment)")
+    timeout := flag.Int("timeout", 0, "stop the run after this many seconds, keeping what was completed (overrides config and environment)")
+    interactive := flag.Bool("interactive", false, "ask for approval before executing each function")
+    dryRun := flag.Bool("dry-run", false, "keep generated tables in memory instead of writing to the database")
+    pprofAddr := flag.String("pprof", "", "serve net/http/pprof on this address, e.g. :6060")
+    cpuProfile := flag.Bool("cpu-profile", false, "write a CPU profile of the run into the artifacts directory")
+    heapProfile := flag.Bool("heap-profile", false, "write a heap profile at the end of the run into the artifacts directory")
+    retryFailures := flag.String("retry-failures", "", "re-process only what failed in this results file or run id")
+    reposFile := flag.String("repos", os.Getenv("FLOQ_REPOS_FILE"), "CSV, JSON, YAML or text file listing repositories with their ref, subdirectory, labels and overrides; - reads standard input")
+    flag.StringVar(reposFile, "repos-file", *reposFile, "alias of -repos")
+    output := flag.String("output", "", "also write the results file to this path")
+    quiet := flag.Bool("quiet", false, "print only the summary; logs still go to the run's log file")
+    flag.Parse()
 
-    if configFile := os.Getenv("CONFIG_FILE"); configFile != "" {
-        config, err = LoadConfigFromFile(configFile)
-        if err != nil {
-            log.Printf("Failed to load config from file: %v", err)
-            config = LoadConfigFromEnv()
+    // "process" names the default command; the flags of the run may
+    // follow it, and the remaining arguments are the repositories
+    command := flag.Arg(0)
+    if command == "process" {
+        flag.CommandLine.Parse(flag.Args()[1:])
+    }
+
+    // Load configuration: defaults < config file < profile < environment
+    config, err := LoadConfig(*configFile, *profile)
+    if err != nil {
+        // Never silently fall back to defaults when a profile was requested
+        if *profile != "" {
+            log.Fatalf("Failed to load config profile: %v", err)
         }
-    } else {
+        log.Printf("Failed to load config: %v", err)
         config = LoadConfigFromEnv()
     }
 
+    // Command-line flags take precedence over every other layer
+    applyFlags := func(config *Config) {
+        flag.Visit(func(f *flag.Flag) {
+            switch f.Name {
+            case "db-host":
+                config.Host = *dbHost
+            case "db-port":
+                config.Port = *dbPort
+            case "db-name":
+                config.Database = *dbName
+            case "db-user":
+                config.User = *dbUser
+            case "artifacts-dir":
+                config.Artifacts.Dir = *artifactsDir
+            case "workers":
+                config.Service.Workers = *workers
+            case "timeout":
+                config.Execution.RunTimeout = *timeout
+            case "interactive":
+                config.Execution.Interactive = *interactive
+            case "dry-run":
+                if *dryRun {
+                    config.Driver = DriverMemory
+                }
+            case "pprof":
+                config.Profiling.Addr = *pprofAddr
+            case "cpu-profile":
+                config.Profiling.CPU = *cpuProfile
+            case "heap-profile":
+                config.Profiling.Heap = *heapProfile
+            }
+        })
+    }
+    applyFlags(&config)
+
+    // The version needs nothing but the binary
+    if command == "version" {
+        if err := RunVersion(config, flag.Args()[1:], os.Stdout); err != nil {
+            log.Fatalf("Version failed: %v", err)
+        }
+        return
+    }
+
+    // The configuration is printed as loaded, even when it is invalid
+    if command == "config" {
+        if err := RunConfig(config, flag.Args()[1:], os.Stdout); err != nil {
+            log.Fatalf("Config failed: %v", err)
+        }
+        return
+    }
+
+    // The doctor reports configuration problems itself
+    if command == "doctor" {
+        ConfigureProviders(config.Providers)
+        if !RunDoctor(config) {
+            os.Exit(1)
+        }
+        return
+    }
+
+    // Clones and provider API calls trust the configured CAs from here on
+    if err := ConfigureProviders(config.Providers); err != nil {
+        log.Fatalf("Failed to configure providers: %v", err)
+    }
+
+    // Updates replace the binary and need no database
+    if command == "self-update" {
+        if err := RunSelfUpdate(config, flag.Args()[1:], os.Stdout); err != nil {
+            log.Fatalf("Self-update failed: %v", err)
+        }
+        return
+    }
+
+    // Searching previous results needs no database
+    if command == "find" {
+        matches, err := RunFind(config, flag.Args()[1:], os.Stdout)
+        if err != nil {
+            log.Fatalf("Find failed: %v", err)
+        }
+        if matches == 0 {
+            os.Exit(1)
+        }
+        return
+    }
+
+    // Summaries of previous runs only read their results files
+    if command == "summary" {
+        if err := RunSummary(config, flag.Args()[1:], os.Stdout); err != nil {
+            log.Fatalf("Summary failed: %v", err)
+        }
+        return
+    }
+
+    // Org reports aggregate the results files of the run history
+    if command == "report" {
+        logOutput = os.Stderr
+        if err := RunReport(config, flag.Args()[1:], os.Stdout); err != nil {
+            log.Fatalf("Report failed: %v", err)
+        }
+        return
+    }
+
+    // API diffs only extract, so they need no database
+    if command == "api-diff" {
+        // Logs go to stderr so the changelog can be piped
+        logOutput = os.Stderr
+        ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+        defer stop()
+        if err := RunAPIDiff(ctx, config, flag.Args()[1:], os.Stdout); err != nil {
+            log.Fatalf("API diff failed: %v", err)
+        }
+        return
+    }
+
+    // Repository preflight checks need no database either
+    if command == "validate-repos" {
+        ready, err := RunValidateRepos(config, flag.Args()[1:], os.Stdout)
+        if err != nil {
+            log.Fatalf("Repository validation failed: %v", err)
+        }
+        if !ready {
+            os.Exit(1)
+        }
+        return
+    }
+
     // Validate configuration
     if err := ValidateConfig(config); err != nil {
         log.Fatalf("Invalid configuration: %v", err)
     }
+    setLogLevel(config.LogLevel)
+
+    // Conformance checks exercise the configured storage driver
+    if command == "storage-check" {
+        logOutput = os.Stderr
+        passed, err := RunStorageCheck(config, flag.Args()[1:], os.Stdout)
+        if err != nil {
+            log.Fatalf("Storage check failed: %v", err)
+        }
+        if !passed {
+            os.Exit(1)
+        }
+        return
+    }
+
+    // Pruning deletes from the fixed tables and drops generated ones
+    if command == "prune" {
+        logOutput = os.Stderr
+        if err := RunPrune(config, flag.Args()[1:], os.Stdout); err != nil {
+            log.Fatalf("Prune failed: %v", err)
+        }
+        return
+    }
+
+    // Queries only read, from the replica when one is configured
+    if command == "query" {
+        // Logs go to stderr so the rows can be piped
+        logOutput = os.Stderr
+        if err := RunQuery(config, flag.Args()[1:], os.Stdout); err != nil {
+            log.Fatalf("Query failed: %v", err)
+        }
+        return
+    }
+
+    if config.Execution.Interactive && (command == "serve" || command == "bulk") {
+        log.Fatalf("Interactive mode is not available in %s mode", command)
+    }
+    // Approvals are read from standard input, so it cannot list repositories
+    if config.Execution.Interactive && *reposFile == "-" {
+        log.Fatalf("Interactive mode cannot read repositories from standard input")
+    }
+
+    // External plugins join the pipeline through hooks, so they start
+    // before any extractor is created. They serve every run of the process
+    // until closed, as bulk and service mode still need them to finish
+    // their current repository once interrupted.
+    plugins, err := LoadPlugins(context.Background(), config.Plugins)
+    if err != nil {
+        log.Fatalf("Failed to load plugins: %v", err)
+    }
+    defer plugins.Close()
+
+    if command == "serve" {
+        logOutput = filterLog(logOutput)
+        runService(config, *configFile, func() (Config, error) {
+            config, err := LoadConfig(*configFile, *profile)
+            if err != nil {
+                return config, err
+            }
+            applyFlags(&config)
+            return config, nil
+        })
+        return
+    }
+
+    // Retries start from the results of a previous run
+    var previous *RunResults
+    if *retryFailures != "" {
+        if flag.NArg() > 0 {
+            log.Fatalf("-retry-failures re-processes the repositories of the previous run and takes no arguments")
+        }
+        previous, err = LoadRetrySource(config.Artifacts, *retryFailures)
+        if err != nil {
+            log.Fatalf("Failed to load the run to retry: %v", err)
+        }
+    }
+
+    // Set up the artifact directory for this run
+    artifacts, err := NewRunArtifacts(config.Artifacts)
+    if err != nil {
+        log.Fatalf("Failed to set up artifacts: %v", err)
+    }
+    defer artifacts.Close()
+
+    console := io.Writer(os.Stdout)
+    if *quiet {
+        console = io.Discard
+    }
+    logOutput, err = artifacts.OpenLog(console)
+    if err != nil {
+        log.Fatalf("Failed to open log: %v", err)
+    }
+    logOutput = filterLog(logOutput)
+    log.SetOutput(logOutput)
+
+    // Profiles cover the whole run; Stop is called again once it is over
+    profiler, err := StartProfiling(config.Profiling, artifacts)
+    if err != nil {
+        log.Fatalf("Failed to start profiling: %v", err)
+    }
+    defer profiler.Stop()
+
+    // SQL dumps belong to the run unless a directory was configured.
+    // Runners are only kept in an artifacts directory that was asked for,
+    // never in the working directory.
+    if config.Driver == DriverSQL && config.DumpDir == "" {
+        config.DumpDir = filepath.Join(artifacts.Dir, defaultDumpDir)
+    }
+    if config.Execution.RunnerDir == "" && config.Artifacts.Dir != "" {
+        config.Execution.RunnerDir = filepath.Join(artifacts.Dir, defaultRunnerDir)
+    }
+
+    // Bulk mode works through a persistent queue until drained or interrupted
+    if command == "bulk" {
+        ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+        defer stop()
+        ctx, cancel := withRunTimeout(ctx, config.Execution.RunTimeout)
+        defer cancel()
+        if err := RunBulk(ctx, config, artifacts, flag.Args()[1:], os.Stdout); err != nil {
+            log.Fatalf("Bulk run failed: %v", err)
+        }
+        return
+    }
+
+    // Seed mode writes test fixtures instead of filling the database
+    if command == "seed" {
+        ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+        defer stop()
+        if err := RunSeed(ctx, config, artifacts, flag.Args()[1:], os.Stdout); err != nil {
+            log.Fatalf("Seed failed: %v", err)
+        }
+        return
+    }
 
-    // Example repositories to process - modify as needed
-    repositories := []string{
-        "https://github.com/golang/example.git",
-        // Add your repositories here
+    // Repositories (URLs or local directories) come from the repositories
+    // file and the arguments, falling back to the example repository
+    var specs []RepoSpec
+    if *reposFile != "" {
+        specs, err = LoadRepoSpecs(*reposFile)
+        if err != nil {
+            log.Fatalf("Failed to load repositories: %v", err)
+        }
+    }
+    specs = append(specs, specsFromURLs(flag.Args())...)
+    if command == "process" && len(specs) == 0 && previous == nil {
+        log.Fatalf("process needs at least one repository, or -repos or -retry-failures")
+    }
+    if len(specs) == 0 {
+        specs = specsFromURLs([]string{
+            "https://github.com/golang/example.git",
+        })
     }
 
     // Create processor and process repositories
     processor := NewRepositoryProcessor(config)
+    if config.Execution.Interactive {
+        state, err := NewStateStore(config.State.Dir)
+        if err != nil {
+            log.Fatalf("Failed to open state store: %v", err)
+        }
+        processor.SetApprover(NewApprover(os.Stdin, os.Stdout, state))
+    }
     
-    err = processor.ProcessRepositories(repositories)
+    // The first interrupt, or the run timeout, cancels the run: processing
+    // stops, the output being stored is rolled back, and what was completed
+    // is kept for the summary and results; a second interrupt exits
+    // immediately
+    interrupted, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    ctx, cancel := withRunTimeout(interrupted, config.Execution.RunTimeout)
+    defer cancel()
+    processed := make(chan struct{})
+    go func() {
+        sigs := make(chan os.Signal, 1)
+        defer signal.Stop(sigs)
+        select {
+        case <-ctx.Done():
+            // Keep catching signals so the next one doesn't kill the run
+            signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+            stop()
+            if timedOut(ctx) {
+                log.Printf("Timed out after %ds; rolling back the output being stored to save a partial summary", config.Execution.RunTimeout)
+            } else {
+                log.Printf("Interrupted; rolling back the output being stored to save a partial summary, interrupt again to exit immediately")
+            }
+        case <-processed:
+            return
+        }
+        select {
+        case <-sigs:
+            os.Exit(interruptedExitCode)
+        case <-processed:
+        }
+    }()
+
+    var run *Run
+    if previous != nil {
+        run, err = processor.RetryFailures(ctx, artifacts.RunID, previous)
+    } else {
+        run, err = processor.ProcessRepoSpecs(ctx, artifacts.RunID, specs)
+    }
+    close(processed)
+    stop()
     if err != nil {
         log.Fatalf("Failed to process repositories: %v", err)
     }
+    if err := profiler.Stop(); err != nil {
+        log.Printf("Failed to write profiles: %v", err)
+    }
+
+    // Run the post-run SQL scripts once every repository succeeded
+    run.RunPostScripts(config)
 
     // Print summary
-    processor.PrintSummary()
+    run.PrintSummary()
 
     // Save results to file
-    if err := processor.SaveResultsToFile("processing_results.json"); err != nil {
+    if resultsPath, err := artifacts.ResultsPath(); err != nil {
+        log.Printf("Failed to save results: %v", err)
+    } else if err := run.SaveResultsToFile(resultsPath); err != nil {
         log.Printf("Failed to save results: %v", err)
     }
+    if *output != "" {
+        if err := run.SaveResultsToFile(*output); err != nil {
+            log.Printf("Failed to save results: %v", err)
+        }
+    }
+
+    // Write additional export formats
+    if err := ExportRun(run, artifacts, config.Export); err != nil {
+        log.Printf("Failed to export results: %v", err)
+    }
+
+    // Prune old runs beyond the retention limit
+    removed, err := PruneRuns(config.Artifacts.Dir, config.Artifacts.KeepRuns)
+    if err != nil {
+        log.Printf("Failed to prune old runs: %v", err)
+    }
+    for _, dir := range removed {
+        log.Printf("Pruned old run %s", dir)
+    }
+
+    // Fail CI builds whose extraction quality regressed; partial runs are
+    // not judged
+    var gate *GateResult
+    if config.Gate.Enabled() && !run.Aborted() {
+        result := EvaluateGate(config.Gate, run.ID, run.Stats())
+        gate = &result
+        gate.Print(os.Stdout)
+        if gatePath, err := artifacts.Path(defaultGateFile); err != nil {
+            log.Printf("Failed to save gate result: %v", err)
+        } else if err := SaveGateFile(gatePath, *gate); err != nil {
+            log.Printf("Failed to save gate result: %v", err)
+        }
+    }
+
+    // Email the summary to teams running scheduled scans
+    if config.Email.Enabled() {
+        if err := SendRunReport(config.Email, run, gate); err != nil {
+            log.Printf("Failed to email run report: %v", err)
+        } else {
+            log.Printf("Emailed run report to %s", strings.Join(config.Email.To, ", "))
+        }
+    }
+
+    if run.Aborted() {
+        artifacts.Close()
+        if run.TimedOut() {
+            os.Exit(timedOutExitCode)
+        }
+        os.Exit(interruptedExitCode)
+    }
+    if gate != nil && !gate.Passed {
+        artifacts.Close()
+        os.Exit(gateFailedExitCode)
+    }
+}
+
+// runService runs the long-lived service mode until interrupted, reloading
+// configFile with load when it changes
+func runService(config Config, configFile string, load func() (Config, error)) {
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+
+    service, err := NewService(config)
+    if err != nil {
+        log.Fatalf("Failed to start service: %v", err)
+    }
+    defer service.Close()
+
+    // The service has no run to write profiles into; pprof serves them
+    profiler, err := StartProfiling(ProfilingConfig{Addr: config.Profiling.Addr}, nil)
+    if err != nil {
+        log.Fatalf("Failed to start profiling: %v", err)
+    }
+    defer profiler.Stop()
+
+    if err := service.Run(ctx, configFile, load); err != nil {
+        log.Fatalf("Service failed: %v", err)
+    }
 }
\ No newline at end of file
@@ -0,0 +1,263 @@
+package main
+
+import (
+    "bytes"
+    "fmt"
+    "go/ast"
+    "go/build"
+    "go/parser"
+    "go/printer"
+    "go/token"
+    "go/types"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// mockArgument is the argument passed to functions executed with a mock;
+// the runner defines the floqMock type next to the call
+const mockArgument = "floqMock{}"
+
+// defaultMaxMockMethods is the largest interface mocked when no limit is
+// configured
+const defaultMaxMockMethods = 8
+
+// MockStrategyNoop mocks every method with one that does nothing and
+// returns zero values
+const MockStrategyNoop = "noop"
+
+// MockUsage records the mock a function was executed with
+type MockUsage struct {
+    Interface string   `json:"interface"`
+    Methods   []string `json:"methods"`
+    Strategy  string   `json:"strategy"`
+}
+
+// InterfaceMock is a generated implementation of an interface parameter
+type InterfaceMock struct {
+    MockUsage
+    // Imports lists the runner imports the methods' signatures need, as
+    // `alias "path"`
+    Imports []string
+    // Source declares floqMock and its methods
+    Source string
+}
+
+// mockImports assigns runner aliases to the packages a mock refers to
+type mockImports struct {
+    aliases map[string]string
+    specs   []string
+}
+
+// alias returns the runner's name for an imported package
+func (m *mockImports) alias(importPath string) string {
+    if alias, ok := m.aliases[importPath]; ok {
+        return alias
+    }
+    alias := fmt.Sprintf("floqm%d", len(m.specs))
+    m.aliases[importPath] = alias
+    m.specs = append(m.specs, fmt.Sprintf("%s %q", alias, importPath))
+    return alias
+}
+
+// interfaceMock generates a no-op implementation of the interface a
+// function takes as its only parameter. The interface must be declared in
+// the repository's module, be small, and only have exported methods whose
+// signatures can be written outside its package.
+func (g *GitHubFunctionExtractor) interfaceMock(function FunctionInfo) (*InterfaceMock, error) {
+    if len(function.Parameters) != 1 {
+        return nil, fmt.Errorf("mocks are only supported for a single parameter")
+    }
+    typeName := parameterType(function.Parameters[0])
+
+    // Interfaces of other packages must come from the same module
+    pkgDir := filepath.Dir(function.FilePath)
+    relDir, _ := filepath.Rel(g.repoPath, pkgDir)
+    importPath := packageImportPath(g.modulePath, filepath.ToSlash(relDir))
+    if qualifier, name, ok := strings.Cut(typeName, "."); ok {
+        file, err := parser.ParseFile(token.NewFileSet(), function.FilePath, nil, parser.ImportsOnly)
+        if err != nil {
+            return nil, fmt.Errorf("failed to parse imports: %w", err)
+        }
+        importPath = fileImports(file)[qualifier]
+        if g.modulePath == "" || (importPath != g.modulePath && !strings.HasPrefix(importPath, g.modulePath+"/")) {
+            return nil, fmt.Errorf("%s is not declared in this repository", typeName)
+        }
+        rel := strings.TrimPrefix(strings.TrimPrefix(importPath, g.modulePath), "/")
+        pkgDir = filepath.Join(g.repoPath, filepath.FromSlash(rel))
+        typeName = name
+    }
+    if !token.IsIdentifier(typeName) {
+        return nil, fmt.Errorf("%s is not a named interface", typeName)
+    }
+
+    fset := token.NewFileSet()
+    iface, imports, err := findInterface(fset, pkgDir, typeName)
+    if err != nil {
+        return nil, err
+    }
+
+    maxMethods := g.execConfig.MaxMockMethods
+    if maxMethods <= 0 {
+        maxMethods = defaultMaxMockMethods
+    }
+    if n := len(iface.Methods.List); n > maxMethods {
+        return nil, fmt.Errorf("%s has %d methods, more than the %d mocked", typeName, n, maxMethods)
+    }
+
+    runnerImports := &mockImports{aliases: make(map[string]string)}
+    requalify := func(expr ast.Expr) (ast.Expr, error) {
+        return requalifyType(expr, importPath, imports, runnerImports)
+    }
+
+    mock := &InterfaceMock{MockUsage: MockUsage{Interface: typeName, Strategy: MockStrategyNoop}}
+    var source strings.Builder
+    fmt.Fprintf(&source, "\n// floqMock is a no-op implementation of %s\ntype floqMock struct{}\n", typeName)
+    for _, method := range iface.Methods.List {
+        if len(method.Names) == 0 {
+            return nil, fmt.Errorf("%s embeds another interface", typeName)
+        }
+        name := method.Names[0].Name
+        if !ast.IsExported(name) {
+            return nil, fmt.Errorf("%s has the unexported method %s", typeName, name)
+        }
+        signature, ok := method.Type.(*ast.FuncType)
+        if !ok {
+            return nil, fmt.Errorf("%s has an unsupported method %s", typeName, name)
+        }
+        for _, list := range []*ast.FieldList{signature.Params, signature.Results} {
+            if list == nil {
+                continue
+            }
+            for _, field := range list.List {
+                if field.Type, err = requalify(field.Type); err != nil {
+                    return nil, fmt.Errorf("cannot mock %s.%s: %w", typeName, name, err)
+                }
+            }
+        }
+
+        // Blank named results let every method end in a bare return
+        body := "{}"
+        if signature.Results != nil && len(signature.Results.List) > 0 {
+            for _, field := range signature.Results.List {
+                count := max(len(field.Names), 1)
+                field.Names = make([]*ast.Ident, count)
+                for i := range field.Names {
+                    field.Names[i] = ast.NewIdent("_")
+                }
+            }
+            body = "{ return }"
+        }
+
+        var buf bytes.Buffer
+        if err := printer.Fprint(&buf, fset, signature); err != nil {
+            return nil, fmt.Errorf("failed to print %s.%s: %w", typeName, name, err)
+        }
+        fmt.Fprintf(&source, "\nfunc (floqMock) %s%s %s\n", name, strings.TrimPrefix(buf.String(), "func"), body)
+        mock.Methods = append(mock.Methods, name)
+    }
+    mock.Imports = runnerImports.specs
+    mock.Source = source.String()
+    return mock, nil
+}
+
+// findInterface finds the declaration of an interface among the Go files
+// of a package directory built for the host, and returns it with the
+// imports of its file
+func findInterface(fset *token.FileSet, dir, name string) (*ast.InterfaceType, map[string]string, error) {
+    entries, err := os.ReadDir(dir)
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to read package: %w", err)
+    }
+    for _, entry := range entries {
+        fileName := entry.Name()
+        if entry.IsDir() || !strings.HasSuffix(fileName, ".go") || strings.HasSuffix(fileName, "_test.go") {
+            continue
+        }
+        if match, err := build.Default.MatchFile(dir, fileName); err != nil || !match {
+            continue
+        }
+        file, err := parser.ParseFile(fset, filepath.Join(dir, fileName), nil, parser.SkipObjectResolution)
+        if err != nil {
+            continue
+        }
+        for _, decl := range file.Decls {
+            gen, ok := decl.(*ast.GenDecl)
+            if !ok || gen.Tok != token.TYPE {
+                continue
+            }
+            for _, spec := range gen.Specs {
+                typeSpec := spec.(*ast.TypeSpec)
+                if typeSpec.Name.Name != name {
+                    continue
+                }
+                iface, ok := typeSpec.Type.(*ast.InterfaceType)
+                if !ok || typeSpec.TypeParams != nil {
+                    return nil, nil, fmt.Errorf("%s is not a non-generic interface", name)
+                }
+                return iface, fileImports(file), nil
+            }
+        }
+    }
+    return nil, nil, fmt.Errorf("interface %s not found", name)
+}
+
+// requalifyType rewrites a type from an interface's package so it can be
+// written in the runner: the package's own types and the packages it
+// imports are qualified with runner aliases
+func requalifyType(expr ast.Expr, pkgPath string, imports map[string]string, runnerImports *mockImports) (ast.Expr, error) {
+    requalify := func(expr ast.Expr) (ast.Expr, error) {
+        return requalifyType(expr, pkgPath, imports, runnerImports)
+    }
+
+    var err error
+    switch t := expr.(type) {
+    case *ast.Ident:
+        if _, predeclared := types.Universe.Lookup(t.Name).(*types.TypeName); predeclared {
+            return t, nil
+        }
+        if !ast.IsExported(t.Name) {
+            return nil, fmt.Errorf("it uses the unexported type %s", t.Name)
+        }
+        return &ast.SelectorExpr{X: ast.NewIdent(runnerImports.alias(pkgPath)), Sel: t}, nil
+    case *ast.SelectorExpr:
+        qualifier, ok := t.X.(*ast.Ident)
+        if !ok || imports[qualifier.Name] == "" {
+            return nil, fmt.Errorf("it uses an unresolvable type")
+        }
+        return &ast.SelectorExpr{X: ast.NewIdent(runnerImports.alias(imports[qualifier.Name])), Sel: t.Sel}, nil
+    case *ast.StarExpr:
+        t.X, err = requalify(t.X)
+    case *ast.ArrayType:
+        t.Elt, err = requalify(t.Elt)
+    case *ast.Ellipsis:
+        t.Elt, err = requalify(t.Elt)
+    case *ast.ChanType:
+        t.Value, err = requalify(t.Value)
+    case *ast.MapType:
+        if t.Key, err = requalify(t.Key); err == nil {
+            t.Value, err = requalify(t.Value)
+        }
+    case *ast.FuncType:
+        for _, list := range []*ast.FieldList{t.Params, t.Results} {
+            if list == nil {
+                continue
+            }
+            for _, field := range list.List {
+                if field.Type, err = requalify(field.Type); err != nil {
+                    return nil, err
+                }
+            }
+        }
+    case *ast.InterfaceType:
+        if len(t.Methods.List) > 0 {
+            return nil, fmt.Errorf("it uses an interface literal")
+        }
+    default:
+        return nil, fmt.Errorf("it uses an unsupported type")
+    }
+    if err != nil {
+        return nil, err
+    }
+    return expr, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "net/url"
+    "os/exec"
+    "path"
+    "strings"
+)
+
+// goCommand prepares a go command run from the repository root, using the
+// configured module proxy if any
+func (g *GitHubFunctionExtractor) goCommand(ctx context.Context, args ...string) *exec.Cmd {
+    return g.toolchainCommand(ctx, "", args...)
+}
+
+// syntheticModulePath derives a module path for a repository without
+// go.mod. GOPATH-era code imports its own packages by their repository
+// path (e.g. github.com/owner/repo/sub), so the URL's host and path are
+// used where possible.
+func syntheticModulePath(repoURL string) string {
+    trimmed := strings.TrimSuffix(strings.TrimSuffix(repoURL, "/"), ".git")
+
+    // scp-like git URLs: git@github.com:owner/repo
+    if i := strings.Index(trimmed, "@"); i >= 0 && !strings.Contains(trimmed, "://") {
+        trimmed = "ssh://" + trimmed[:i+1] + strings.Replace(trimmed[i+1:], ":", "/", 1)
+    }
+
+    if u, err := url.Parse(trimmed); err == nil && u.Host != "" {
+        return strings.ToLower(u.Hostname()) + path.Clean("/"+u.Path)
+    }
+    return "floq.local/" + repoSlug(repoURL)
+}
+
+// ensureModule makes the repository a Go module so its functions can be
+// executed. Repositories without go.mod get a temporary synthetic module
+// (go mod init, then go mod tidy to resolve imports). It reports whether a
+// synthetic module was created.
+func (g *GitHubFunctionExtractor) ensureModule(ctx context.Context) (bool, error) {
+    if readModulePath(g.repoPath) != "" {
+        return false, nil
+    }
+
+    modulePath := syntheticModulePath(g.repoURL)
+    g.logger.Printf("No go.mod found, synthesizing module %s", modulePath)
+
+    if output, err := g.goCommand(ctx, "mod", "init", modulePath).CombinedOutput(); err != nil {
+        return false, fmt.Errorf("failed to initialize synthetic module: %w: %s", err, lastLine(output))
+    }
+
+    // Unresolvable imports only break the functions that need them, so
+    // tidy errors are logged rather than fatal
+    if output, err := g.goCommand(ctx, "mod", "tidy", "-e").CombinedOutput(); err != nil {
+        g.logger.Printf("go mod tidy failed for synthetic module: %v: %s", err, lastLine(output))
+    }
+    return true, nil
+}
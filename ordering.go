@@ -0,0 +1,180 @@
+package main
+
+import (
+    "math/rand/v2"
+    "path"
+    "sort"
+    "strings"
+    "time"
+)
+
+// Execution orders; see ExecutionConfig.Order
+const (
+    OrderWalk         = "walk"         // as the files are walked (default)
+    OrderAlphabetical = "alphabetical" // by package path and function name
+    OrderCost         = "cost"         // cheapest estimated execution first
+    OrderDependencies = "dependencies" // callees before their callers
+    OrderRandom       = "random"       // shuffled with OrderSeed
+)
+
+// ExecutionOrderRecord describes the order a repository's functions ran in
+// when it was not the walk order
+type ExecutionOrderRecord struct {
+    Strategy string `json:"strategy"`
+    // Seed is the seed random orders were shuffled with; running again
+    // with it reproduces the order
+    Seed int64 `json:"seed,omitempty"`
+}
+
+// ordered reports whether functions wait for the whole repository to be
+// extracted so they can be executed in the configured order
+func (g *GitHubFunctionExtractor) ordered() bool {
+    return g.execConfig.Order != "" && g.execConfig.Order != OrderWalk
+}
+
+// orderFunctions sorts the functions to execute by the configured order,
+// recording the order in the result
+func (g *GitHubFunctionExtractor) orderFunctions(functions []FunctionInfo, result *ProcessingResult) {
+    record := &ExecutionOrderRecord{Strategy: g.execConfig.Order}
+    switch g.execConfig.Order {
+    case OrderAlphabetical:
+        sort.SliceStable(functions, func(i, j int) bool {
+            a, b := path.Dir(functions[i].RelativePath), path.Dir(functions[j].RelativePath)
+            if a != b {
+                return a < b
+            }
+            return functions[i].Name < functions[j].Name
+        })
+    case OrderCost:
+        type costed struct {
+            function FunctionInfo
+            cost     int
+        }
+        estimates := make([]costed, len(functions))
+        for i, function := range functions {
+            estimates[i] = costed{function, g.estimatedCost(function)}
+        }
+        sort.SliceStable(estimates, func(i, j int) bool {
+            return estimates[i].cost < estimates[j].cost
+        })
+        for i, estimate := range estimates {
+            functions[i] = estimate.function
+        }
+    case OrderDependencies:
+        copy(functions, g.dependencyOrder(functions))
+    case OrderRandom:
+        record.Seed = g.execConfig.OrderSeed
+        if record.Seed == 0 {
+            record.Seed = time.Now().UnixNano()
+        }
+        random := rand.New(rand.NewPCG(uint64(record.Seed), 0))
+        random.Shuffle(len(functions), func(i, j int) {
+            functions[i], functions[j] = functions[j], functions[i]
+        })
+    }
+    if record.Seed != 0 {
+        g.logger.Printf("Executing %d functions in %s order (seed %d)", len(functions), record.Strategy, record.Seed)
+    } else {
+        g.logger.Printf("Executing %d functions in %s order", len(functions), record.Strategy)
+    }
+    result.ExecutionOrder = record
+}
+
+// estimatedCost ranks how expensive executing a function is likely to be.
+// Cached outputs cost nothing; otherwise functions doing I/O cost more than
+// getters and constructors, every call in the body adds to the cost, and
+// fuzzed functions run once per argument set.
+func (g *GitHubFunctionExtractor) estimatedCost(function FunctionInfo) int {
+    if len(function.Parameters) == 0 && g.cachedExecution(function) {
+        return 0
+    }
+
+    cost := 1 + len(function.Calls)
+    switch function.Class {
+    case ClassGetter, ClassConstructor, ClassValidator:
+    case ClassLoader, ClassHandler, ClassCommand:
+        cost *= 4
+    default:
+        cost *= 2
+    }
+    annotatedArgs := function.Directive != nil && len(function.Directive.Arguments) > 0
+    if len(function.Parameters) > 0 && !annotatedArgs && g.execConfig.FuzzArguments {
+        cost *= max(g.execConfig.MaxFuzzCases, 1)
+    }
+    return cost
+}
+
+// cachedExecution reports whether the execution cache holds the output of
+// a function called without arguments
+func (g *GitHubFunctionExtractor) cachedExecution(function FunctionInfo) bool {
+    if g.state == nil || !g.execConfig.Cache || function.SourceHash == "" {
+        return false
+    }
+    var entry cachedExecution
+    found, err := g.state.Get(executionCacheBucket, g.executionCacheKey(function, nil), &entry)
+    return err == nil && found
+}
+
+// dependencyOrder returns the functions with those a function calls before
+// it, so outputs of building blocks are stored before the functions
+// composing them run. Functions keep their walk order otherwise, and
+// functions calling each other in a cycle run in walk order.
+func (g *GitHubFunctionExtractor) dependencyOrder(functions []FunctionInfo) []FunctionInfo {
+    qualified := func(function FunctionInfo, name string) string {
+        if strings.Contains(name, ".") {
+            return name
+        }
+        return packageImportPath(g.modulePath, path.Dir(function.RelativePath)) + "." + name
+    }
+    index := make(map[string][]int)
+    for i, function := range functions {
+        name := qualified(function, function.Name)
+        index[name] = append(index[name], i)
+    }
+
+    // callers[i] are the functions calling function i; waiting[i] counts
+    // the callees function i waits for
+    callers := make([][]int, len(functions))
+    waiting := make([]int, len(functions))
+    for i, function := range functions {
+        seen := make(map[int]bool)
+        for _, call := range function.Calls {
+            for _, callee := range index[qualified(function, call)] {
+                if callee == i || seen[callee] {
+                    continue
+                }
+                seen[callee] = true
+                callers[callee] = append(callers[callee], i)
+                waiting[i]++
+            }
+        }
+    }
+
+    ordered := make([]FunctionInfo, 0, len(functions))
+    done := make([]bool, len(functions))
+    for len(ordered) < len(functions) {
+        // The first ready function in walk order runs next; in a cycle no
+        // function is ready and the first one left breaks it
+        next := -1
+        for i := range functions {
+            if !done[i] && waiting[i] == 0 {
+                next = i
+                break
+            }
+        }
+        if next < 0 {
+            for i := range functions {
+                if !done[i] {
+                    next = i
+                    break
+                }
+            }
+        }
+        done[next] = true
+        ordered = append(ordered, functions[next])
+        for _, caller := range callers[next] {
+            waiting[caller]--
+        }
+    }
+    return ordered
+}
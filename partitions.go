@@ -0,0 +1,279 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "log"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Partitioning strategies for the fixed tables created by the tool
+const (
+    PartitionNone       = "none"
+    PartitionRunDate    = "run_date"
+    PartitionRepository = "repository"
+)
+
+// Run date partition intervals
+const (
+    PartitionMonthly = "month"
+    PartitionDaily   = "day"
+)
+
+// defaultPartitionCount is the number of hash partitions used by the
+// repository strategy when none is configured
+const defaultPartitionCount = 8
+
+// PartitionedTable describes a fixed table that may be partitioned: the
+// column holding the row's run date and the one naming its repository
+type PartitionedTable struct {
+    Name             string
+    DateColumn       string
+    RepositoryColumn string
+}
+
+// Tables that accumulate rows with every run and support partitioning
+var (
+    jobsTable            = PartitionedTable{Name: "floq_jobs", DateColumn: "created_at", RepositoryColumn: "repo_url"}
+    functionOutputsTable = PartitionedTable{Name: "floq_function_outputs", DateColumn: "created_at", RepositoryColumn: "repository"}
+)
+
+// PartitionStrategy decides how a fixed table is partitioned. Schemas are
+// rendered with its primary key and PARTITION BY clause, Setup runs once
+// after the table is created and Prepare before rows are inserted.
+type PartitionStrategy interface {
+    // Name returns the configured strategy name
+    Name() string
+    // PrimaryKey returns the primary key columns of a table whose own key
+    // is id; partitioned tables must include their partition key
+    PrimaryKey(table PartitionedTable) string
+    // Clause returns the PARTITION BY clause appended to CREATE TABLE
+    Clause(table PartitionedTable) string
+    // Setup creates the partitions a new table needs up front
+    Setup(ctx context.Context, exec sqlExecer, table PartitionedTable) error
+    // Prepare ensures a partition exists for rows written at now
+    Prepare(ctx context.Context, exec sqlExecer, table PartitionedTable, now time.Time) error
+}
+
+// NewPartitionStrategy returns the strategy selected in the storage settings
+func NewPartitionStrategy(config DatabaseConfig) (PartitionStrategy, error) {
+    switch config.Partitioning {
+    case "", PartitionNone:
+        return noPartitioning{}, nil
+    case PartitionRunDate:
+        switch config.PartitionInterval {
+        case "", PartitionMonthly:
+            return &runDatePartitioning{interval: PartitionMonthly, ready: make(map[string]bool)}, nil
+        case PartitionDaily:
+            return &runDatePartitioning{interval: PartitionDaily, ready: make(map[string]bool)}, nil
+        }
+        return nil, fmt.Errorf("unsupported partition interval %q", config.PartitionInterval)
+    case PartitionRepository:
+        count := config.PartitionCount
+        if count == 0 {
+            count = defaultPartitionCount
+        }
+        if count < 1 {
+            return nil, fmt.Errorf("partition count must be at least 1")
+        }
+        return repositoryPartitioning{count: count}, nil
+    }
+    return nil, fmt.Errorf("unsupported partitioning strategy %q", config.Partitioning)
+}
+
+// createPartitionedTable creates a fixed table from a schema template whose
+// %[1]s verb takes the primary key and %[2]s the partition clause, then
+// lets the strategy create its partitions, all under the table's lock.
+// Tables created before partitioning was configured are left
+// unpartitioned.
+func createPartitionedTable(ctx context.Context, db *sql.DB, strategy PartitionStrategy, table PartitionedTable, schema string) error {
+    return withTableLockContext(ctx, db, table.Name, func(tx *sql.Tx) error {
+        return createPartitionedTableLocked(ctx, tx, strategy, table, schema)
+    })
+}
+
+// createPartitionedTableLocked creates a partitioned table while holding
+// its lock
+func createPartitionedTableLocked(ctx context.Context, tx *sql.Tx, strategy PartitionStrategy, table PartitionedTable, schema string) error {
+    var exists, partitioned bool
+    err := tx.QueryRowContext(ctx,
+        "SELECT to_regclass($1) IS NOT NULL, EXISTS (SELECT 1 FROM pg_partitioned_table WHERE partrelid = to_regclass($1))",
+        table.Name).Scan(&exists, &partitioned)
+    if err != nil {
+        return fmt.Errorf("failed to look up table %s: %w", table.Name, err)
+    }
+
+    if !exists {
+        if _, err := tx.ExecContext(ctx, fmt.Sprintf(schema, strategy.PrimaryKey(table), strategy.Clause(table))); err != nil {
+            return fmt.Errorf("failed to create table %s: %w", table.Name, err)
+        }
+    } else if !partitioned {
+        if strategy.Name() != PartitionNone {
+            log.Printf("Table %s already exists unpartitioned; %s partitioning not applied", table.Name, strategy.Name())
+        }
+        return nil
+    }
+    return strategy.Setup(ctx, tx, table)
+}
+
+// noPartitioning keeps tables unpartitioned
+type noPartitioning struct{}
+
+// Name returns the strategy name
+func (noPartitioning) Name() string {
+    return PartitionNone
+}
+
+// PrimaryKey keeps the id key
+func (noPartitioning) PrimaryKey(table PartitionedTable) string {
+    return "id"
+}
+
+// Clause returns no partition clause
+func (noPartitioning) Clause(table PartitionedTable) string {
+    return ""
+}
+
+// Setup does nothing
+func (noPartitioning) Setup(ctx context.Context, exec sqlExecer, table PartitionedTable) error {
+    return nil
+}
+
+// Prepare does nothing
+func (noPartitioning) Prepare(ctx context.Context, exec sqlExecer, table PartitionedTable, now time.Time) error {
+    return nil
+}
+
+// runDatePartitioning range partitions tables by run date, one partition
+// per month or day, created on demand
+type runDatePartitioning struct {
+    interval string
+    mu       sync.Mutex
+    ready    map[string]bool
+}
+
+// Name returns the strategy name
+func (r *runDatePartitioning) Name() string {
+    return PartitionRunDate
+}
+
+// PrimaryKey adds the date column to the key
+func (r *runDatePartitioning) PrimaryKey(table PartitionedTable) string {
+    return "id, " + table.DateColumn
+}
+
+// Clause partitions by range of the date column
+func (r *runDatePartitioning) Clause(table PartitionedTable) string {
+    return fmt.Sprintf(" PARTITION BY RANGE (%s)", table.DateColumn)
+}
+
+// Setup creates the partition for the current period
+func (r *runDatePartitioning) Setup(ctx context.Context, exec sqlExecer, table PartitionedTable) error {
+    return r.Prepare(ctx, exec, table, time.Now())
+}
+
+// Prepare creates the partitions for the period containing now and the
+// next one, so inserts around a period boundary never miss a partition
+func (r *runDatePartitioning) Prepare(ctx context.Context, exec sqlExecer, table PartitionedTable, now time.Time) error {
+    start := r.periodStart(now.UTC())
+    for _, from := range []time.Time{start, r.next(start)} {
+        if err := r.ensure(ctx, exec, table, from); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// ensure creates the partition for the period starting at from once per
+// process
+func (r *runDatePartitioning) ensure(ctx context.Context, exec sqlExecer, table PartitionedTable, from time.Time) error {
+    layout := "200601"
+    if r.interval == PartitionDaily {
+        layout = "20060102"
+    }
+    name := fmt.Sprintf("%s_p%s", table.Name, from.Format(layout))
+
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if r.ready[name] {
+        return nil
+    }
+
+    query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')",
+        name, table.Name, from.Format(time.RFC3339), r.next(from).Format(time.RFC3339))
+    create := func(exec sqlExecer) error {
+        _, err := exec.ExecContext(ctx, query)
+        return err
+    }
+    // Setup runs in the transaction already holding the table's lock
+    var err error
+    if db, ok := exec.(*sql.DB); ok {
+        err = withTableLockContext(ctx, db, table.Name, func(tx *sql.Tx) error { return create(tx) })
+    } else {
+        err = create(exec)
+    }
+    if err != nil {
+        return fmt.Errorf("failed to create partition %s: %w", name, err)
+    }
+    r.ready[name] = true
+    return nil
+}
+
+// periodStart truncates t to the start of its month or day
+func (r *runDatePartitioning) periodStart(t time.Time) time.Time {
+    if r.interval == PartitionDaily {
+        return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+    }
+    return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// next returns the start of the period after the one starting at start
+func (r *runDatePartitioning) next(start time.Time) time.Time {
+    if r.interval == PartitionDaily {
+        return start.AddDate(0, 0, 1)
+    }
+    return start.AddDate(0, 1, 0)
+}
+
+// repositoryPartitioning hash partitions tables by repository into a fixed
+// number of partitions created with the table
+type repositoryPartitioning struct {
+    count int
+}
+
+// Name returns the strategy name
+func (r repositoryPartitioning) Name() string {
+    return PartitionRepository
+}
+
+// PrimaryKey adds the repository column to the key
+func (r repositoryPartitioning) PrimaryKey(table PartitionedTable) string {
+    return "id, " + table.RepositoryColumn
+}
+
+// Clause partitions by hash of the repository column
+func (r repositoryPartitioning) Clause(table PartitionedTable) string {
+    return fmt.Sprintf(" PARTITION BY HASH (%s)", table.RepositoryColumn)
+}
+
+// Setup creates every hash partition
+func (r repositoryPartitioning) Setup(ctx context.Context, exec sqlExecer, table PartitionedTable) error {
+    var statements []string
+    for i := 0; i < r.count; i++ {
+        statements = append(statements, fmt.Sprintf(
+            "CREATE TABLE IF NOT EXISTS %s_h%d PARTITION OF %s FOR VALUES WITH (MODULUS %d, REMAINDER %d)",
+            table.Name, i, table.Name, r.count, i))
+    }
+    if _, err := exec.ExecContext(ctx, strings.Join(statements, "; ")); err != nil {
+        return fmt.Errorf("failed to create partitions of %s: %w", table.Name, err)
+    }
+    return nil
+}
+
+// Prepare does nothing; hash partitions cover every repository
+func (r repositoryPartitioning) Prepare(ctx context.Context, exec sqlExecer, table PartitionedTable, now time.Time) error {
+    return nil
+}
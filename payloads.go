@@ -0,0 +1,129 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "path"
+    "time"
+)
+
+// payloadsSchema stores every distinct function output once, keyed by the
+// SHA-256 of its canonical JSON encoding
+const payloadsSchema = `CREATE TABLE IF NOT EXISTS floq_payloads (
+    hash       TEXT PRIMARY KEY,
+    payload    JSONB NOT NULL,
+    size       INTEGER NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+// functionOutputsSchema holds one row per executed function referencing
+// its output in floq_payloads; it is rendered with the partition
+// strategy's primary key and clause
+const functionOutputsSchema = `CREATE TABLE IF NOT EXISTS floq_function_outputs (
+    id           BIGSERIAL,
+    repository   TEXT NOT NULL,
+    ref          TEXT,
+    package      TEXT NOT NULL,
+    function     TEXT NOT NULL,
+    run_id       TEXT,
+    payload_hash TEXT NOT NULL REFERENCES floq_payloads (hash),
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (%[1]s)
+)%[2]s`
+
+// payloadRef describes the execution of a function in this repository
+func (g *GitHubFunctionExtractor) payloadRef(function FunctionInfo) PayloadRef {
+    ref := PayloadRef{
+        Repository: g.repoURL,
+        Package:    packageImportPath(g.modulePath, path.Dir(function.RelativePath)),
+        Function:   function.Name,
+        RunID:      g.runID,
+    }
+    if g.ref != nil {
+        ref.Ref = g.ref.Name
+    }
+    return ref
+}
+
+// storePayload stores a function's output content-addressed and records
+// the reference in the result
+func (g *GitHubFunctionExtractor) storePayload(ctx context.Context, function FunctionInfo, data interface{}, result *ProcessingResult) error {
+    hash, created, err := g.storage.StorePayload(ctx, g.payloadRef(function), data)
+    if err != nil {
+        return err
+    }
+    if !created {
+        g.logger.Printf("Output of %s deduplicated as payload %s", function.Name, hash[:12])
+        result.DeduplicatedPayloads++
+    }
+    if result.PayloadHashes == nil {
+        result.PayloadHashes = make(map[string]string)
+    }
+    result.PayloadHashes[function.Name] = hash
+    return nil
+}
+
+// StorePayload stores a payload once and references it from a function
+// output row
+func (p *PostgresStorage) StorePayload(ctx context.Context, ref PayloadRef, payload interface{}) (string, bool, error) {
+    hash, data, err := canonicalPayload(payload)
+    if err != nil {
+        return "", false, err
+    }
+    if !p.payloadTables {
+        if err := p.ensureTable(ctx, "floq_payloads", payloadsSchema); err != nil {
+            return "", false, fmt.Errorf("failed to create payload tables: %w", err)
+        }
+        if err := createPartitionedTable(ctx, p.db, p.partitions, functionOutputsTable, functionOutputsSchema); err != nil {
+            return "", false, fmt.Errorf("failed to create payload tables: %w", err)
+        }
+        p.payloadTables = true
+    }
+    if err := p.partitions.Prepare(ctx, p.db, functionOutputsTable, time.Now()); err != nil {
+        return "", false, fmt.Errorf("failed to store payload reference: %w", err)
+    }
+
+    // The payload and its reference are stored together or not at all
+    var inserted int64
+    err = p.inTransaction(ctx, func(exec sqlExecer) error {
+        res, err := exec.ExecContext(ctx,
+            "INSERT INTO floq_payloads (hash, payload, size) VALUES ($1, $2, $3) ON CONFLICT (hash) DO NOTHING",
+            hash, string(data), len(data))
+        if err != nil {
+            return fmt.Errorf("failed to store payload: %w", err)
+        }
+        if inserted, err = res.RowsAffected(); err != nil {
+            return fmt.Errorf("failed to store payload: %w", err)
+        }
+
+        _, err = exec.ExecContext(ctx,
+            "INSERT INTO floq_function_outputs (repository, ref, package, function, run_id, payload_hash) VALUES ($1, NULLIF($2, ''), $3, $4, NULLIF($5, ''), $6)",
+            ref.Repository, ref.Ref, ref.Package, ref.Function, ref.RunID, hash)
+        if err != nil {
+            return fmt.Errorf("failed to store payload reference: %w", err)
+        }
+        return nil
+    })
+    if err != nil {
+        return "", false, err
+    }
+    return hash, inserted > 0, nil
+}
+
+// StorePayload stores a payload once and records a reference to it
+func (m *MemoryStorage) StorePayload(ctx context.Context, ref PayloadRef, payload interface{}) (string, bool, error) {
+    hash, _, err := canonicalPayload(payload)
+    if err != nil {
+        return "", false, err
+    }
+
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    _, exists := m.payloads[hash]
+    if !exists {
+        m.payloads[hash] = payload
+    }
+    m.payloadRefs = append(m.payloadRefs, ref)
+    return hash, !exists, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "sort"
+)
+
+// payloadStatsSchema creates the payload_stats table
+const payloadStatsSchema = `CREATE TABLE IF NOT EXISTS payload_stats (
+    id            BIGSERIAL PRIMARY KEY,
+    repository    TEXT NOT NULL,
+    ref           TEXT,
+    package       TEXT NOT NULL,
+    function      TEXT NOT NULL,
+    run_id        TEXT,
+    row_count     INTEGER NOT NULL,
+    stored_rows   INTEGER NOT NULL,
+    truncated     BOOLEAN NOT NULL,
+    size          BIGINT NOT NULL,
+    distinct_keys INTEGER NOT NULL,
+    value_types   JSONB NOT NULL,
+    column_stats  JSONB NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+// truncatePayload keeps the first maxRows rows of an array output; other
+// outputs and a maxRows of zero leave it whole
+func truncatePayload(data interface{}, maxRows int) (interface{}, bool) {
+    rows, ok := data.([]interface{})
+    if !ok || maxRows <= 0 || len(rows) <= maxRows {
+        return data, false
+    }
+    return rows[:maxRows], true
+}
+
+// prepareOutput truncates an output to the configured number of rows and
+// records statistics of the whole output when enabled. It returns the
+// output to store.
+func (g *GitHubFunctionExtractor) prepareOutput(ctx context.Context, function FunctionInfo, data interface{}, result *ProcessingResult) interface{} {
+    stored, truncated := truncatePayload(data, g.dbConfig.MaxPayloadRows)
+    if truncated {
+        rows := len(data.([]interface{}))
+        g.logger.Printf("Truncated output of %s from %d to %d rows", function.Name, rows, g.dbConfig.MaxPayloadRows)
+        if result.TruncatedOutputs == nil {
+            result.TruncatedOutputs = make(map[string]int)
+        }
+        result.TruncatedOutputs[function.Name] = rows
+    }
+
+    if g.dbConfig.PayloadStats {
+        stats := computePayloadStats(data)
+        stats.PayloadRef = g.payloadRef(function)
+        if truncated {
+            stats.StoredRows = g.dbConfig.MaxPayloadRows
+            stats.Truncated = true
+        }
+        if err := g.storage.StorePayloadStats(ctx, stats); err != nil {
+            result.Errors = append(result.Errors,
+                g.functionError(function, "Failed to store statistics of %s: %v", function.Name, err))
+        }
+    }
+    return stored
+}
+
+// encodeStatsColumns encodes the JSON columns of a payload_stats row
+func encodeStatsColumns(stats PayloadStats) (string, string, error) {
+    types, err := json.Marshal(stats.Types)
+    if err != nil {
+        return "", "", fmt.Errorf("failed to encode value types: %w", err)
+    }
+    columns, err := json.Marshal(stats.Columns)
+    if err != nil {
+        return "", "", fmt.Errorf("failed to encode column statistics: %w", err)
+    }
+    return string(types), string(columns), nil
+}
+
+// StorePayloadStats appends an output's statistics to the payload_stats
+// table
+func (p *PostgresStorage) StorePayloadStats(ctx context.Context, stats PayloadStats) error {
+    types, columns, err := encodeStatsColumns(stats)
+    if err != nil {
+        return err
+    }
+    if err := p.ensureTable(ctx, "payload_stats", payloadStatsSchema); err != nil {
+        return fmt.Errorf("failed to create payload_stats table: %w", err)
+    }
+    _, err = p.exec.ExecContext(ctx,
+        "INSERT INTO payload_stats (repository, ref, package, function, run_id, row_count, stored_rows, truncated, size, distinct_keys, value_types, column_stats) "+
+            "VALUES ($1, NULLIF($2, ''), $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10, $11, $12)",
+        stats.Repository, stats.Ref, stats.Package, stats.Function, stats.RunID,
+        stats.Rows, stats.StoredRows, stats.Truncated, stats.Size, stats.DistinctKeys, types, columns)
+    if err != nil {
+        return fmt.Errorf("failed to store payload statistics: %w", err)
+    }
+    return nil
+}
+
+// StorePayloadStats appends an output's statistics to the payload_stats
+// table
+func (m *MemoryStorage) StorePayloadStats(ctx context.Context, stats PayloadStats) error {
+    types, columns, err := encodeStatsColumns(stats)
+    if err != nil {
+        return err
+    }
+
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    table, ok := m.tables[payloadStatsTable]
+    if !ok {
+        table = &MemoryTable{Columns: []string{"repository", "ref", "package", "function", "run_id", "row_count", "stored_rows", "truncated", "size", "distinct_keys", "value_types", "column_stats"}}
+        m.tables[payloadStatsTable] = table
+    }
+    table.Rows = append(table.Rows, map[string]interface{}{
+        "repository":    stats.Repository,
+        "ref":           stats.Ref,
+        "package":       stats.Package,
+        "function":      stats.Function,
+        "run_id":        stats.RunID,
+        "row_count":     stats.Rows,
+        "stored_rows":   stats.StoredRows,
+        "truncated":     stats.Truncated,
+        "size":          stats.Size,
+        "distinct_keys": stats.DistinctKeys,
+        "value_types":   types,
+        "column_stats":  columns,
+    })
+    return nil
+}
+
+// describeTruncated formats the truncated outputs for the summary
+func describeTruncated(truncated map[string]int) string {
+    names := make([]string, 0, len(truncated))
+    for name := range truncated {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    descriptions := make([]string, len(names))
+    for i, name := range names {
+        descriptions[i] = fmt.Sprintf("%s (%d rows)", name, truncated[name])
+    }
+    return joinStrings(descriptions, ", ")
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net"
+    "net/rpc"
+    "strings"
+
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/credentials/insecure"
+    "google.golang.org/grpc/status"
+    "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// pluginGRPCService is the gRPC service plugins speaking protocol grpc
+// serve; its methods are named like the JSON-RPC ones
+const pluginGRPCService = "floq.plugin.v1.Enricher"
+
+// pluginClient calls the methods of a plugin over the protocol it chose in
+// its handshake
+type pluginClient interface {
+    // Call invokes a method such as Enricher.PreClone, giving up once ctx
+    // is done
+    Call(ctx context.Context, method string, args PluginCall, reply interface{}) error
+    Close() error
+}
+
+// jsonRPCPluginClient calls plugins speaking JSON-RPC over stdio
+type jsonRPCPluginClient struct {
+    client *rpc.Client
+}
+
+// Call implements pluginClient
+func (c jsonRPCPluginClient) Call(ctx context.Context, method string, args PluginCall, reply interface{}) error {
+    call := c.client.Go(method, args, reply, make(chan *rpc.Call, 1))
+    select {
+    case <-call.Done:
+        return call.Error
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+// Close implements pluginClient
+func (c jsonRPCPluginClient) Close() error {
+    return c.client.Close()
+}
+
+// grpcPluginClient calls plugins serving pluginGRPCService on the local
+// address they announced. Calls and replies are the JSON documents the
+// JSON-RPC protocol carries, wrapped in google.protobuf.BytesValue, so
+// plugins need no stubs generated for floq's types.
+type grpcPluginClient struct {
+    conn *grpc.ClientConn
+}
+
+// dialPluginGRPC connects to a plugin's gRPC server. Only unix sockets
+// and loopback addresses are accepted, as in go-plugin.
+func dialPluginGRPC(network, address string) (*grpcPluginClient, error) {
+    switch network {
+    case "unix":
+    case "tcp":
+        host, _, err := net.SplitHostPort(address)
+        if err != nil {
+            return nil, fmt.Errorf("invalid plugin address %q: %w", address, err)
+        }
+        if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+            return nil, fmt.Errorf("plugin address %s is not a loopback address", address)
+        }
+    default:
+        return nil, fmt.Errorf("unsupported plugin network %q", network)
+    }
+    dial := func(ctx context.Context, _ string) (net.Conn, error) {
+        var dialer net.Dialer
+        return dialer.DialContext(ctx, network, address)
+    }
+    conn, err := grpc.NewClient("passthrough:///plugin",
+        grpc.WithTransportCredentials(insecure.NewCredentials()),
+        grpc.WithContextDialer(dial))
+    if err != nil {
+        return nil, fmt.Errorf("failed to connect to plugin: %w", err)
+    }
+    return &grpcPluginClient{conn: conn}, nil
+}
+
+// Call implements pluginClient
+func (c *grpcPluginClient) Call(ctx context.Context, method string, args PluginCall, reply interface{}) error {
+    service, name, ok := strings.Cut(method, ".")
+    if !ok || service != "Enricher" {
+        return fmt.Errorf("unknown plugin method %s", method)
+    }
+    request, err := json.Marshal(args)
+    if err != nil {
+        return fmt.Errorf("failed to encode %s call: %w", method, err)
+    }
+    response := &wrapperspb.BytesValue{}
+    err = c.conn.Invoke(ctx, "/"+pluginGRPCService+"/"+name, wrapperspb.Bytes(request), response)
+    if ctx.Err() != nil {
+        return ctx.Err()
+    }
+    if err != nil {
+        // A plugin's own errors read the same as over JSON-RPC
+        if s, ok := status.FromError(err); ok {
+            return errors.New(s.Message())
+        }
+        return err
+    }
+    if len(response.Value) == 0 {
+        return nil
+    }
+    if err := json.Unmarshal(response.Value, reply); err != nil {
+        return fmt.Errorf("failed to decode %s reply: %w", method, err)
+    }
+    return nil
+}
+
+// Close implements pluginClient
+func (c *grpcPluginClient) Close() error {
+    return c.conn.Close()
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+    "bufio"
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "net/rpc/jsonrpc"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// External plugins are started with the magic cookie in their environment,
+// so a plugin binary run by hand can tell it is not talking to floq, and
+// answer with a handshake line naming the protocol version and the
+// protocol they speak: JSON-RPC over stdio, or gRPC on a local address
+// they announce, as with go-plugin
+const (
+    pluginCookieKey       = "FLOQ_PLUGIN_MAGIC_COOKIE"
+    pluginCookieValue     = "8d2f6c1e5a7b4e09b3f1floqenricher"
+    pluginProtocolVersion = 1
+    pluginProtocolJSONRPC = "jsonrpc"
+    pluginProtocolGRPC    = "grpc"
+)
+
+// Plugin defaults
+const (
+    defaultPluginTimeout   = 30
+    pluginHandshakeTimeout = 10 * time.Second
+    pluginShutdownTimeout  = 5 * time.Second
+)
+
+// Hook names plugins declare in their manifest
+const (
+    PluginHookPreClone    = "pre_clone"
+    PluginHookPostExtract = "post_extract"
+    PluginHookPreExecute  = "pre_execute"
+    PluginHookPostInsert  = "post_insert"
+)
+
+// PluginConfig configures an external enricher plugin: a separate binary
+// started by floq that serves the hooks it implements over its stdin and
+// stdout
+type PluginConfig struct {
+    // Name identifies the plugin in logs and results (default: the base
+    // name of the command)
+    Name    string   `json:"name,omitempty"`
+    Command string   `json:"command"`
+    Args    []string `json:"args,omitempty"`
+    // Timeout bounds each hook call in seconds (default 30)
+    Timeout int `json:"timeout,omitempty"`
+}
+
+// name returns the plugin's configured or derived name
+func (c PluginConfig) name() string {
+    if c.Name != "" {
+        return c.Name
+    }
+    return filepath.Base(c.Command)
+}
+
+// PluginManifest is a plugin's answer to Enricher.Describe
+type PluginManifest struct {
+    Name string `json:"name"`
+    // Hooks lists the hooks the plugin implements; see the PluginHook
+    // constants
+    Hooks []string `json:"hooks"`
+}
+
+// PluginCall is the argument of every hook call; only the fields of the
+// hook being called are set
+type PluginCall struct {
+    Context   HookContext    `json:"context"`
+    Function  *FunctionInfo  `json:"function,omitempty"`
+    Functions []FunctionInfo `json:"functions,omitempty"`
+    Table     string         `json:"table,omitempty"`
+    Data      interface{}    `json:"data,omitempty"`
+}
+
+// PluginReply is the result of a hook call. A PostExtract reply replaces
+// the file's functions with Functions unless it is null; the other hooks
+// answer with an empty reply, or an error to skip or veto.
+type PluginReply struct {
+    Functions []FunctionInfo `json:"functions"`
+}
+
+// externalPlugin is a running plugin process
+type externalPlugin struct {
+    config   PluginConfig
+    cmd      *exec.Cmd
+    stdin    io.WriteCloser
+    client   pluginClient
+    manifest PluginManifest
+    timeout  time.Duration
+    logger   *log.Logger
+}
+
+// PluginSet holds the plugins started for a run
+type PluginSet struct {
+    plugins []*externalPlugin
+    // unregister removes the plugins' hooks from the pipeline
+    unregister []func()
+}
+
+// pluginConn joins the plugin's stdout, past the handshake line, and stdin
+// into the connection JSON-RPC runs over
+type pluginConn struct {
+    io.Reader
+    io.WriteCloser
+}
+
+// pluginHandshake is what a plugin announced in its handshake line
+type pluginHandshake struct {
+    Protocol string
+    // Network and Address are where a gRPC plugin serves, "unix" and a
+    // socket path or "tcp" and a loopback address
+    Network string
+    Address string
+}
+
+// validatePlugins checks that every plugin has a unique name and a command
+// that can be found
+func validatePlugins(configs []PluginConfig) error {
+    names := make(map[string]bool)
+    for _, config := range configs {
+        if config.Command == "" {
+            return fmt.Errorf("plugin %q has no command", config.Name)
+        }
+        if _, err := exec.LookPath(config.Command); err != nil {
+            return fmt.Errorf("plugin %s: %w", config.name(), err)
+        }
+        if names[config.name()] {
+            return fmt.Errorf("plugin name %s is used twice", config.name())
+        }
+        names[config.name()] = true
+        if config.Timeout < 0 {
+            return fmt.Errorf("timeout of plugin %s must not be negative", config.name())
+        }
+    }
+    return nil
+}
+
+// pluginsFromEnv returns the plugins configured by FLOQ_PLUGINS, a comma
+// separated list of commands, or base when it is not set
+func pluginsFromEnv(base []PluginConfig) []PluginConfig {
+    commands := getEnvList("FLOQ_PLUGINS", nil)
+    if commands == nil {
+        return base
+    }
+    configs := make([]PluginConfig, len(commands))
+    for i, command := range commands {
+        configs[i] = PluginConfig{Command: command}
+    }
+    return configs
+}
+
+// LoadPlugins starts the configured plugins and registers the hooks they
+// implement. Close the set to stop them once processing is over; they are
+// also stopped once ctx is cancelled.
+func LoadPlugins(ctx context.Context, configs []PluginConfig) (*PluginSet, error) {
+    set := &PluginSet{}
+    for _, config := range configs {
+        plugin, err := startPlugin(ctx, config)
+        if err != nil {
+            set.Close()
+            return nil, fmt.Errorf("failed to start plugin %s: %w", config.name(), err)
+        }
+        set.plugins = append(set.plugins, plugin)
+        set.unregister = append(set.unregister, registerHooks(plugin.hooks()))
+        plugin.logger.Printf("Loaded plugin %s with hooks %s", plugin.config.name(), strings.Join(plugin.manifest.Hooks, ", "))
+    }
+    return set, nil
+}
+
+// startPlugin starts a plugin's process, completes the handshake and asks
+// for its manifest. Cancelling ctx stops the process like stop does.
+func startPlugin(ctx context.Context, config PluginConfig) (*externalPlugin, error) {
+    timeout := config.Timeout
+    if timeout == 0 {
+        timeout = defaultPluginTimeout
+    }
+    plugin := &externalPlugin{
+        config:  config,
+        timeout: time.Duration(timeout) * time.Second,
+        logger:  log.New(logOutput, "[PLUGIN] ", log.LstdFlags|log.Lshortfile),
+    }
+
+    cmd := exec.CommandContext(ctx, config.Command, config.Args...)
+    cmd.Env = append(os.Environ(),
+        pluginCookieKey+"="+pluginCookieValue,
+        fmt.Sprintf("FLOQ_PLUGIN_PROTOCOL_VERSION=%d", pluginProtocolVersion))
+    stdin, err := cmd.StdinPipe()
+    if err != nil {
+        return nil, fmt.Errorf("failed to open stdin: %w", err)
+    }
+    // A cancelled plugin gets the same chance to exit as a stopped one
+    cmd.Cancel = stdin.Close
+    cmd.WaitDelay = pluginShutdownTimeout
+    stdout, err := cmd.StdoutPipe()
+    if err != nil {
+        return nil, fmt.Errorf("failed to open stdout: %w", err)
+    }
+    stderr, err := cmd.StderrPipe()
+    if err != nil {
+        return nil, fmt.Errorf("failed to open stderr: %w", err)
+    }
+    if err := cmd.Start(); err != nil {
+        return nil, err
+    }
+    plugin.cmd, plugin.stdin = cmd, stdin
+    go plugin.forwardLog(stderr)
+
+    reader := bufio.NewReader(stdout)
+    handshake, err := plugin.handshake(reader)
+    if err != nil {
+        plugin.stop()
+        return nil, err
+    }
+    switch handshake.Protocol {
+    case pluginProtocolJSONRPC:
+        plugin.client = jsonRPCPluginClient{client: jsonrpc.NewClient(pluginConn{Reader: reader, WriteCloser: stdin})}
+    case pluginProtocolGRPC:
+        client, err := dialPluginGRPC(handshake.Network, handshake.Address)
+        if err != nil {
+            plugin.stop()
+            return nil, err
+        }
+        plugin.client = client
+        // Past the handshake, stdout is only output
+        go plugin.forwardLog(reader)
+    }
+    if err := plugin.call("Enricher.Describe", PluginCall{}, &plugin.manifest); err != nil {
+        plugin.stop()
+        return nil, fmt.Errorf("failed to describe plugin: %w", err)
+    }
+    for _, hook := range plugin.manifest.Hooks {
+        switch hook {
+        case PluginHookPreClone, PluginHookPostExtract, PluginHookPreExecute, PluginHookPostInsert:
+        default:
+            plugin.stop()
+            return nil, fmt.Errorf("plugin declares unknown hook %q", hook)
+        }
+    }
+    return plugin, nil
+}
+
+// handshake reads the plugin's first line, "<version>|jsonrpc" or
+// "<version>|grpc|<network>|<address>", and checks that it speaks a
+// protocol floq does
+func (p *externalPlugin) handshake(reader *bufio.Reader) (pluginHandshake, error) {
+    lines := make(chan string, 1)
+    errs := make(chan error, 1)
+    go func() {
+        line, err := reader.ReadString('\n')
+        if err != nil {
+            errs <- fmt.Errorf("plugin exited before the handshake: %w", err)
+            return
+        }
+        lines <- strings.TrimSpace(line)
+    }()
+
+    select {
+    case err := <-errs:
+        return pluginHandshake{}, err
+    case <-time.After(pluginHandshakeTimeout):
+        return pluginHandshake{}, fmt.Errorf("no handshake within %s", pluginHandshakeTimeout)
+    case line := <-lines:
+        return parsePluginHandshake(line)
+    }
+}
+
+// parsePluginHandshake parses a plugin's handshake line
+func parsePluginHandshake(line string) (pluginHandshake, error) {
+    fields := strings.Split(line, "|")
+    version := strconv.Itoa(pluginProtocolVersion)
+    switch {
+    case len(fields) == 2 && fields[0] == version && fields[1] == pluginProtocolJSONRPC:
+        return pluginHandshake{Protocol: pluginProtocolJSONRPC}, nil
+    case len(fields) == 4 && fields[0] == version && fields[1] == pluginProtocolGRPC:
+        return pluginHandshake{Protocol: pluginProtocolGRPC, Network: fields[2], Address: fields[3]}, nil
+    }
+    return pluginHandshake{}, fmt.Errorf("unsupported handshake %q, want %q or %q", line,
+        version+"|"+pluginProtocolJSONRPC, version+"|"+pluginProtocolGRPC+"|<network>|<address>")
+}
+
+// forwardLog copies what the plugin writes to stderr into the log
+func (p *externalPlugin) forwardLog(stderr io.Reader) {
+    scanner := bufio.NewScanner(stderr)
+    for scanner.Scan() {
+        p.logger.Printf("%s: %s", p.config.name(), scanner.Text())
+    }
+}
+
+// call invokes a method of the plugin, giving up after the plugin's timeout
+func (p *externalPlugin) call(method string, args PluginCall, reply interface{}) error {
+    ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+    defer cancel()
+    err := p.client.Call(ctx, method, args, reply)
+    if errors.Is(err, context.DeadlineExceeded) {
+        return fmt.Errorf("%s timed out after %s", method, p.timeout)
+    }
+    return err
+}
+
+// implements reports whether the plugin declared a hook
+func (p *externalPlugin) implements(hook string) bool {
+    return containsString(p.manifest.Hooks, hook)
+}
+
+// hooks bridges the hooks the plugin implements into pipeline hooks
+func (p *externalPlugin) hooks() Hooks {
+    hooks := Hooks{Name: "plugin " + p.config.name()}
+    if p.implements(PluginHookPreClone) {
+        hooks.PreClone = func(ctx HookContext) error {
+            return p.call("Enricher.PreClone", PluginCall{Context: ctx}, &PluginReply{})
+        }
+    }
+    if p.implements(PluginHookPostExtract) {
+        hooks.PostExtract = func(ctx HookContext, functions []FunctionInfo) []FunctionInfo {
+            var reply PluginReply
+            if err := p.call("Enricher.PostExtract", PluginCall{Context: ctx, Functions: functions}, &reply); err != nil {
+                p.logger.Printf("Keeping the functions of %s unchanged: %s failed: %v", ctx.Repository, p.config.name(), err)
+                return functions
+            }
+            if reply.Functions == nil {
+                return functions
+            }
+            return reply.Functions
+        }
+    }
+    if p.implements(PluginHookPreExecute) {
+        hooks.PreExecute = func(ctx HookContext, function FunctionInfo) error {
+            return p.call("Enricher.PreExecute", PluginCall{Context: ctx, Function: &function}, &PluginReply{})
+        }
+    }
+    if p.implements(PluginHookPostInsert) {
+        hooks.PostInsert = func(ctx HookContext, function FunctionInfo, table string, data interface{}) error {
+            return p.call("Enricher.PostInsert", PluginCall{Context: ctx, Function: &function, Table: table, Data: data}, &PluginReply{})
+        }
+    }
+    return hooks
+}
+
+// stop closes the plugin's stdin, which ends its serving loop, and kills
+// it if it does not exit in time
+func (p *externalPlugin) stop() {
+    if p.client != nil {
+        p.client.Close()
+    }
+    p.stdin.Close()
+    done := make(chan error, 1)
+    go func() { done <- p.cmd.Wait() }()
+    select {
+    case <-done:
+    case <-time.After(pluginShutdownTimeout):
+        p.cmd.Process.Kill()
+        <-done
+    }
+}
+
+// Close removes the plugins' hooks from the pipeline and stops the
+// plugins. Extractors created before keep the hooks, whose calls fail
+// from then on.
+func (s *PluginSet) Close() {
+    if s == nil {
+        return
+    }
+    for _, unregister := range s.unregister {
+        unregister()
+    }
+    s.unregister = nil
+    for _, plugin := range s.plugins {
+        plugin.stop()
+    }
+}
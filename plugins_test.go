@@ -0,0 +1,125 @@
+package main
+
+import (
+    "context"
+    "os/exec"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+// buildTestPlugin builds the plugin in testdata/plugin
+func buildTestPlugin(t *testing.T) string {
+    t.Helper()
+    binary := filepath.Join(t.TempDir(), "plugin")
+    if output, err := exec.Command("go", "build", "-o", binary, "./testdata/plugin").CombinedOutput(); err != nil {
+        t.Fatalf("failed to build the test plugin: %v\n%s", err, output)
+    }
+    return binary
+}
+
+// TestPlugins loads the test plugin over each protocol, calls its hooks
+// and checks closing the set removes them from the pipeline
+func TestPlugins(t *testing.T) {
+    if testing.Short() {
+        t.Skip("builds the test plugin")
+    }
+    binary := buildTestPlugin(t)
+
+    for _, protocol := range []string{pluginProtocolJSONRPC, pluginProtocolGRPC} {
+        t.Run(protocol, func(t *testing.T) {
+            set, err := LoadPlugins(context.Background(), []PluginConfig{
+                {Name: "test", Command: binary, Args: []string{"-protocol", protocol}},
+            })
+            if err != nil {
+                t.Fatalf("LoadPlugins: %v", err)
+            }
+            defer set.Close()
+
+            hooks, ok := findHooks("plugin test")
+            if !ok {
+                t.Fatalf("the plugin's hooks were not registered")
+            }
+            if hooks.PreClone != nil || hooks.PostInsert != nil {
+                t.Errorf("hooks the plugin does not declare were registered")
+            }
+
+            ctx := HookContext{Repository: "https://github.com/example/corpus"}
+            kept := hooks.PostExtract(ctx, []FunctionInfo{{Name: "Kept"}, {Name: "Dropped"}})
+            if len(kept) != 1 || kept[0].Name != "Kept" {
+                t.Errorf("PostExtract kept %v, want only Kept", kept)
+            }
+            if err := hooks.PreExecute(ctx, FunctionInfo{Name: "Kept"}); err != nil {
+                t.Errorf("PreExecute(Kept) = %v, want nil", err)
+            }
+            err = hooks.PreExecute(ctx, FunctionInfo{Name: "Vetoed"})
+            if err == nil || err.Error() != "vetoed by the test plugin" {
+                t.Errorf("PreExecute(Vetoed) = %v, want the plugin's veto", err)
+            }
+
+            set.Close()
+            if _, ok := findHooks("plugin test"); ok {
+                t.Errorf("the plugin's hooks are still registered after Close")
+            }
+        })
+    }
+}
+
+func TestParsePluginHandshake(t *testing.T) {
+    tests := []struct {
+        line string
+        want pluginHandshake
+        err  bool
+    }{
+        {"1|jsonrpc", pluginHandshake{Protocol: pluginProtocolJSONRPC}, false},
+        {"1|grpc|unix|/tmp/plugin.sock", pluginHandshake{Protocol: pluginProtocolGRPC, Network: "unix", Address: "/tmp/plugin.sock"}, false},
+        {"1|grpc|tcp|127.0.0.1:4000", pluginHandshake{Protocol: pluginProtocolGRPC, Network: "tcp", Address: "127.0.0.1:4000"}, false},
+        {"2|jsonrpc", pluginHandshake{}, true},
+        {"1|grpc", pluginHandshake{}, true},
+        {"1|1|unix|/tmp/plugin.sock|grpc", pluginHandshake{}, true},
+        {"", pluginHandshake{}, true},
+    }
+    for _, tt := range tests {
+        got, err := parsePluginHandshake(tt.line)
+        if (err != nil) != tt.err || got != tt.want {
+            t.Errorf("parsePluginHandshake(%q) = %+v, %v", tt.line, got, err)
+        }
+    }
+}
+
+func TestDialPluginGRPCAddresses(t *testing.T) {
+    tests := []struct {
+        network string
+        address string
+        err     string
+    }{
+        {"tcp", "10.0.0.1:4000", "not a loopback address"},
+        {"tcp", "example.com:4000", "not a loopback address"},
+        {"tcp", "127.0.0.1", "invalid plugin address"},
+        {"udp", "127.0.0.1:4000", "unsupported plugin network"},
+    }
+    for _, tt := range tests {
+        _, err := dialPluginGRPC(tt.network, tt.address)
+        if err == nil || !strings.Contains(err.Error(), tt.err) {
+            t.Errorf("dialPluginGRPC(%s, %s) = %v, want an error containing %q", tt.network, tt.address, err, tt.err)
+        }
+    }
+    for _, address := range []string{"127.0.0.1:4000", "[::1]:4000"} {
+        client, err := dialPluginGRPC("tcp", address)
+        if err != nil {
+            t.Errorf("dialPluginGRPC(tcp, %s) = %v, want a client", address, err)
+            continue
+        }
+        client.Close()
+    }
+}
+
+// findHooks returns the registered hooks named name
+func findHooks(name string) (Hooks, bool) {
+    for _, hooks := range currentHooks() {
+        if hooks.Name == name {
+            return hooks, true
+        }
+    }
+    return Hooks{}, false
+}
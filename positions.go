@@ -0,0 +1,165 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "go/scanner"
+    "path/filepath"
+    "regexp"
+    "strconv"
+    "strings"
+)
+
+// SourcePosition locates code in a repository. It renders as
+// file:line:col, which editors and language servers turn into links.
+type SourcePosition struct {
+    // File is relative to the repository root
+    File   string `json:"file"`
+    Line   int    `json:"line"`
+    Column int    `json:"column,omitempty"`
+    // URL shows the line on the repository's provider, at the processed
+    // commit; it is empty when the provider is unknown
+    URL string `json:"url,omitempty"`
+}
+
+// String formats the position as file:line:col, or file:line without a
+// column
+func (p SourcePosition) String() string {
+    if p.Column > 0 {
+        return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+    }
+    return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+// PositionError is an error caused by the code at a position, such as a
+// compiler error or a panic in the repository
+type PositionError struct {
+    Position SourcePosition
+    Err      error
+}
+
+func (e *PositionError) Error() string {
+    return e.Err.Error()
+}
+
+func (e *PositionError) Unwrap() error {
+    return e.Err
+}
+
+// sourceURL links a line of a file at a commit on the provider hosting a
+// repository: github.com and GitHub Enterprise Servers with a configured
+// API URL, gitlab.com and bitbucket.org. Other repositories get no link.
+func sourceURL(repoURL, commit string, pos SourcePosition) string {
+    host := providerHost(repoURL)
+    slug := repositorySlug(repoURL)
+    if host == "" || commit == "" || !strings.Contains(slug, "/") {
+        return ""
+    }
+    base := "https://" + host + "/" + slug
+    switch {
+    case providerAPIURL(host) != "":
+        return fmt.Sprintf("%s/blob/%s/%s#L%d", base, commit, pos.File, pos.Line)
+    case host == "gitlab.com":
+        return fmt.Sprintf("%s/-/blob/%s/%s#L%d", base, commit, pos.File, pos.Line)
+    case host == "bitbucket.org":
+        return fmt.Sprintf("%s/src/%s/%s#lines-%d", base, commit, pos.File, pos.Line)
+    }
+    return ""
+}
+
+// commitHash returns the commit being processed, or "" for copies without
+// history
+func (g *GitHubFunctionExtractor) commitHash() string {
+    if g.ref != nil {
+        return g.ref.Commit
+    }
+    if g.repo != nil {
+        if head, err := g.repo.Head(); err == nil {
+            return head.Hash().String()
+        }
+    }
+    return ""
+}
+
+// sourcePosition builds the position of a line in a file of the clone,
+// given by absolute or repository-relative path
+func (g *GitHubFunctionExtractor) sourcePosition(file string, line, column int) SourcePosition {
+    if filepath.IsAbs(file) {
+        file = g.relativePath(file)
+    }
+    pos := SourcePosition{File: filepath.ToSlash(filepath.Clean(file)), Line: line, Column: column}
+    pos.URL = sourceURL(g.repoURL, g.commitHash(), pos)
+    return pos
+}
+
+// functionPosition returns the position of a function's declaration
+func (g *GitHubFunctionExtractor) functionPosition(function FunctionInfo) SourcePosition {
+    return g.sourcePosition(function.RelativePath, function.LineNumber, function.Column)
+}
+
+// locate appends a position and its link to an error message:
+// "... (at pkg/a.go:10:6, https://github.com/acme/lib/blob/<sha>/pkg/a.go#L10)"
+func locate(message string, pos SourcePosition) string {
+    if pos.URL != "" {
+        return fmt.Sprintf("%s (at %s, %s)", message, pos, pos.URL)
+    }
+    return fmt.Sprintf("%s (at %s)", message, pos)
+}
+
+// functionError formats an error of a function, located at the code an
+// error among args points to, or else at the function's declaration
+func (g *GitHubFunctionExtractor) functionError(function FunctionInfo, format string, args ...interface{}) string {
+    pos := g.functionPosition(function)
+    for _, arg := range args {
+        var located *PositionError
+        if err, ok := arg.(error); ok && errors.As(err, &located) {
+            pos = located.Position
+        }
+    }
+    return locate(fmt.Sprintf(format, args...), pos)
+}
+
+// fileError formats an error of a file, located at its first syntax error
+// when err is a parse error
+func (g *GitHubFunctionExtractor) fileError(err error, format string, args ...interface{}) string {
+    message := fmt.Sprintf(format, args...)
+    var syntax scanner.ErrorList
+    if errors.As(err, &syntax) && len(syntax) > 0 {
+        first := syntax[0].Pos
+        return locate(message, g.sourcePosition(first.Filename, first.Line, first.Column))
+    }
+    return message
+}
+
+// outputPosition matches file positions in compiler output and stack
+// traces: "pkg/a.go:10:6: undefined: x" or "\t/tmp/repo/pkg/a.go:10 +0x1d"
+var outputPosition = regexp.MustCompile(`([^\s:]+\.go):(\d+)(?::(\d+))?`)
+
+// locateOutput returns the first position in a tool's output that lies in
+// the repository's own code, leaving out generated runners and code
+// outside the clone such as dependencies and the standard library
+func (g *GitHubFunctionExtractor) locateOutput(output []byte) (SourcePosition, bool) {
+    for _, match := range outputPosition.FindAllStringSubmatch(string(output), -1) {
+        file := match[1]
+        if !filepath.IsAbs(file) {
+            file = filepath.Join(g.repoPath, file)
+        }
+        rel, err := filepath.Rel(g.repoPath, file)
+        if err != nil || strings.HasPrefix(rel, "..") || strings.HasPrefix(rel, runnerDirPrefix) {
+            continue
+        }
+        line, _ := strconv.Atoi(match[2])
+        column, _ := strconv.Atoi(match[3])
+        return g.sourcePosition(rel, line, column), true
+    }
+    return SourcePosition{}, false
+}
+
+// locateErr wraps err in a PositionError when the tool output it came with
+// points into the repository's code
+func (g *GitHubFunctionExtractor) locateErr(err error, output []byte) error {
+    if pos, ok := g.locateOutput(output); ok {
+        return &PositionError{Position: pos, Err: err}
+    }
+    return err
+}
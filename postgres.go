@@ -0,0 +1,304 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "log"
+    "strconv"
+    "strings"
+
+    "github.com/lib/pq"
+)
+
+// sqlExecer executes statements under a context; PostgresStorage writes
+// tables through it so the same statements can go to a database or an SQL
+// dump. *sql.DB and *sql.Tx implement it.
+type sqlExecer interface {
+    ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// PostgresStorage stores generated tables in PostgreSQL
+type PostgresStorage struct {
+    config        DatabaseConfig
+    db            *sql.DB
+    exec          sqlExecer
+    logger        *log.Logger
+    partitions    PartitionStrategy
+    payloadTables bool
+}
+
+// NewPostgresStorage creates a PostgreSQL storage; call Connect before use
+func NewPostgresStorage(config DatabaseConfig) *PostgresStorage {
+    return &PostgresStorage{
+        config: config,
+        logger: log.New(logOutput, "[STORAGE] ", log.LstdFlags|log.Lshortfile),
+    }
+}
+
+// Connect establishes the database connection
+func (p *PostgresStorage) Connect(ctx context.Context) error {
+    var err error
+    p.db, err = openDatabase(p.config)
+    if err != nil {
+        return fmt.Errorf("failed to open database connection: %w", err)
+    }
+
+    if err = p.db.PingContext(ctx); err != nil {
+        return fmt.Errorf("failed to ping database: %w", err)
+    }
+    p.exec = p.db
+
+    p.partitions, err = NewPartitionStrategy(p.config)
+    if err != nil {
+        return err
+    }
+
+    p.logger.Println("Connected to PostgreSQL database")
+    return nil
+}
+
+// inTransaction runs the writes of one output in a transaction, so they
+// are stored completely or not at all; cancelling ctx rolls them back. SQL
+// dumps have no transactions and write the statements directly.
+func (p *PostgresStorage) inTransaction(ctx context.Context, write func(exec sqlExecer) error) error {
+    if p.db == nil {
+        return write(p.exec)
+    }
+    tx, err := p.db.BeginTx(ctx, nil)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    if err := write(tx); err != nil {
+        tx.Rollback()
+        return err
+    }
+    if err := tx.Commit(); err != nil {
+        return fmt.Errorf("failed to commit: %w", err)
+    }
+    return nil
+}
+
+// Close closes the database connection
+func (p *PostgresStorage) Close() error {
+    if p.db != nil {
+        return p.db.Close()
+    }
+    return nil
+}
+
+// CreateTable creates a PostgreSQL table based on data structure. The
+// table is replaced under its advisory lock, so concurrent workers writing
+// the same table do not race.
+func (p *PostgresStorage) CreateTable(ctx context.Context, tableName string, data interface{}, mapping *ColumnMapping) error {
+    if mapping != nil {
+        if err := p.ensureTable(ctx, "floq_column_mappings", columnMappingsSchema); err != nil {
+            return fmt.Errorf("failed to create column mappings table: %w", err)
+        }
+    }
+    return p.lockedDDL(ctx, tableName, func(exec sqlExecer) error {
+        return createTable(ctx, exec, tableName, data, mapping)
+    })
+}
+
+// ReplaceTable replaces a table and inserts data into it in the
+// transaction holding the table's lock, so a failed or cancelled insert
+// leaves the previous table in place rather than an empty one
+func (p *PostgresStorage) ReplaceTable(ctx context.Context, tableName string, data interface{}, mapping *ColumnMapping) error {
+    if mapping != nil {
+        if err := p.ensureTable(ctx, "floq_column_mappings", columnMappingsSchema); err != nil {
+            return fmt.Errorf("failed to create column mappings table: %w", err)
+        }
+    }
+    return p.lockedDDL(ctx, tableName, func(exec sqlExecer) error {
+        if err := createTable(ctx, exec, tableName, data, mapping); err != nil {
+            return err
+        }
+        return insertData(ctx, exec, tableName, data, mapping)
+    })
+}
+
+// createTable replaces a table with an empty one shaped for data with exec
+func createTable(ctx context.Context, exec sqlExecer, tableName string, data interface{}, mapping *ColumnMapping) error {
+    // Determine table structure based on data type
+    var createQuery string
+
+    if mapping != nil {
+        // Object or array of objects: one column per normalized key
+        columns := []string{"id SERIAL PRIMARY KEY"}
+        for _, key := range mapping.Keys {
+            columns = append(columns, fmt.Sprintf("%s %s", quoteIdentifier(mapping.Columns[key]), mapping.Types[key]))
+        }
+        createQuery = fmt.Sprintf("CREATE TABLE %s (%s)", quoteIdentifier(tableName), strings.Join(columns, ", "))
+    } else if v, ok := data.([]interface{}); ok && len(v) > 0 {
+        // Array of primitives
+        createQuery = fmt.Sprintf("CREATE TABLE %s (id SERIAL PRIMARY KEY, value TEXT)", quoteIdentifier(tableName))
+    } else {
+        // Single value, empty array, or unknown structure
+        createQuery = fmt.Sprintf("CREATE TABLE %s (id SERIAL PRIMARY KEY, data JSONB)", quoteIdentifier(tableName))
+    }
+
+    // Drop table if exists
+    dropQuery := fmt.Sprintf("DROP TABLE IF EXISTS %s", quoteIdentifier(tableName))
+    if _, err := exec.ExecContext(ctx, dropQuery); err != nil {
+        return fmt.Errorf("failed to drop existing table: %w", err)
+    }
+    if _, err := exec.ExecContext(ctx, createQuery); err != nil {
+        return fmt.Errorf("failed to create table %s: %w", tableName, err)
+    }
+    if mapping != nil {
+        return saveColumnMapping(ctx, exec, tableName, mapping)
+    }
+    return nil
+}
+
+// InsertData inserts data into a PostgreSQL table. The rows are inserted
+// in one transaction, so an interrupted insert leaves none of them.
+func (p *PostgresStorage) InsertData(ctx context.Context, tableName string, data interface{}, mapping *ColumnMapping) error {
+    return p.inTransaction(ctx, func(exec sqlExecer) error {
+        return insertData(ctx, exec, tableName, data, mapping)
+    })
+}
+
+// insertData inserts the rows of data with exec
+func insertData(ctx context.Context, exec sqlExecer, tableName string, data interface{}, mapping *ColumnMapping) error {
+    if records, ok := objectRecords(data); ok && mapping != nil {
+        // Objects use the same deterministic column mapping as the table
+        for _, record := range records {
+            if err := insertSingleRecord(ctx, exec, tableName, record, mapping); err != nil {
+                return err
+            }
+        }
+        return nil
+    }
+
+    switch v := data.(type) {
+    case []interface{}:
+        // Array of primitives
+        for _, item := range v {
+            query := fmt.Sprintf("INSERT INTO %s (value) VALUES ($1)", quoteIdentifier(tableName))
+            _, err := exec.ExecContext(ctx, query, fmt.Sprintf("%v", item))
+            if err != nil {
+                return fmt.Errorf("failed to insert primitive value: %w", err)
+            }
+        }
+
+    default:
+        // Single value as JSON
+        jsonData, err := json.Marshal(data)
+        if err != nil {
+            return fmt.Errorf("failed to marshal data to JSON: %w", err)
+        }
+
+        query := fmt.Sprintf("INSERT INTO %s (data) VALUES ($1)", quoteIdentifier(tableName))
+        _, err = exec.ExecContext(ctx, query, string(jsonData))
+        if err != nil {
+            return fmt.Errorf("failed to insert JSON data: %w", err)
+        }
+    }
+    return nil
+}
+
+// insertSingleRecord inserts a single record (map) into a table, storing
+// each key in its mapped column
+func insertSingleRecord(ctx context.Context, exec sqlExecer, tableName string, record map[string]interface{}, mapping *ColumnMapping) error {
+    if len(record) == 0 {
+        return nil
+    }
+
+    var columns []string
+    var placeholders []string
+    var values []interface{}
+
+    i := 1
+    for key, value := range record {
+        columns = append(columns, quoteIdentifier(mapping.Columns[key]))
+        placeholders = append(placeholders, "$"+strconv.Itoa(i))
+
+        // Convert complex types to JSON strings
+        switch v := value.(type) {
+        case []interface{}, map[string]interface{}:
+            jsonData, err := json.Marshal(v)
+            if err != nil {
+                return fmt.Errorf("failed to marshal complex type: %w", err)
+            }
+            values = append(values, string(jsonData))
+        default:
+            values = append(values, value)
+        }
+        i++
+    }
+
+    query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+        quoteIdentifier(tableName), strings.Join(columns, ", "), strings.Join(placeholders, ", "))
+
+    _, err := exec.ExecContext(ctx, query, values...)
+    return err
+}
+
+// StoreInvocations creates a table holding one row per fuzzed invocation.
+// The table is replaced and filled in one transaction under its lock.
+func (p *PostgresStorage) StoreInvocations(ctx context.Context, tableName string, invocations []Invocation) error {
+    return p.lockedDDL(ctx, tableName, func(exec sqlExecer) error {
+        dropQuery := fmt.Sprintf("DROP TABLE IF EXISTS %s", quoteIdentifier(tableName))
+        if _, err := exec.ExecContext(ctx, dropQuery); err != nil {
+            return fmt.Errorf("failed to drop existing table: %w", err)
+        }
+        createQuery := fmt.Sprintf("CREATE TABLE %s (id SERIAL PRIMARY KEY, arguments JSONB, output JSONB)", quoteIdentifier(tableName))
+        if _, err := exec.ExecContext(ctx, createQuery); err != nil {
+            return fmt.Errorf("failed to create table %s: %w", tableName, err)
+        }
+
+        query := fmt.Sprintf("INSERT INTO %s (arguments, output) VALUES ($1, $2)", quoteIdentifier(tableName))
+        for _, invocation := range invocations {
+            argsJSON, err := json.Marshal(invocation.Arguments)
+            if err != nil {
+                return fmt.Errorf("failed to marshal arguments: %w", err)
+            }
+            outputJSON, err := json.Marshal(invocation.Output)
+            if err != nil {
+                return fmt.Errorf("failed to marshal output: %w", err)
+            }
+            if _, err := exec.ExecContext(ctx, query, string(argsJSON), string(outputJSON)); err != nil {
+                return fmt.Errorf("failed to insert invocation: %w", err)
+            }
+        }
+        return nil
+    })
+}
+
+// CommentOnTable attaches comments to a table and its columns
+func (p *PostgresStorage) CommentOnTable(ctx context.Context, tableName, comment string, columnComments map[string]string) error {
+    query := fmt.Sprintf("COMMENT ON TABLE %s IS %s", quoteIdentifier(tableName), pq.QuoteLiteral(comment))
+    if _, err := p.exec.ExecContext(ctx, query); err != nil {
+        return fmt.Errorf("failed to comment on table %s: %w", tableName, err)
+    }
+
+    for column, comment := range columnComments {
+        query := fmt.Sprintf("COMMENT ON COLUMN %s.%s IS %s",
+            quoteIdentifier(tableName), quoteIdentifier(column), pq.QuoteLiteral(comment))
+        if _, err := p.exec.ExecContext(ctx, query); err != nil {
+            return fmt.Errorf("failed to comment on column %s.%s: %w", tableName, column, err)
+        }
+    }
+    return nil
+}
+
+// saveColumnMapping stores the original key to column mapping of a table so
+// consumers can translate column names back to the function's output keys;
+// it runs with the table's DDL so the mapping changes with the table
+func saveColumnMapping(ctx context.Context, exec sqlExecer, tableName string, mapping *ColumnMapping) error {
+    if _, err := exec.ExecContext(ctx, "DELETE FROM floq_column_mappings WHERE table_name = $1", tableName); err != nil {
+        return fmt.Errorf("failed to clear column mappings: %w", err)
+    }
+    for _, key := range mapping.Keys {
+        _, err := exec.ExecContext(ctx,
+            "INSERT INTO floq_column_mappings (table_name, original_key, column_name) VALUES ($1, $2, $3)",
+            tableName, key, mapping.Columns[key])
+        if err != nil {
+            return fmt.Errorf("failed to store column mapping: %w", err)
+        }
+    }
+    return nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "path/filepath"
+    "time"
+)
+
+// defaultScriptTimeout bounds a post-run script in seconds
+const defaultScriptTimeout = 300
+
+// What a post-run script does when it fails
+const (
+    ScriptOnErrorStop     = "stop"
+    ScriptOnErrorContinue = "continue"
+)
+
+// Outcomes of post-run scripts
+const (
+    ScriptSucceeded = "succeeded"
+    ScriptFailed    = "failed"
+    ScriptSkipped   = "skipped"
+)
+
+// PostRunScript is an SQL script executed against the database after a
+// successful run, e.g. to refresh materialized views or grant access to
+// the new tables
+type PostRunScript struct {
+    // Name identifies the script in the results (default: the file name)
+    Name string `json:"name,omitempty"`
+    // File holds the script; SQL gives it inline instead
+    File string `json:"file,omitempty"`
+    SQL  string `json:"sql,omitempty"`
+    // Timeout bounds the script in seconds (default 300)
+    Timeout int `json:"timeout,omitempty"`
+    // OnError is "stop" (default) to skip the remaining scripts when this
+    // one fails, or "continue"
+    OnError string `json:"on_error,omitempty"`
+}
+
+// name returns the script's configured or derived name
+func (s PostRunScript) name(i int) string {
+    if s.Name != "" {
+        return s.Name
+    }
+    if s.File != "" {
+        return filepath.Base(s.File)
+    }
+    return fmt.Sprintf("script%d", i+1)
+}
+
+// source returns the script's SQL
+func (s PostRunScript) source() (string, error) {
+    if s.File == "" {
+        return s.SQL, nil
+    }
+    data, err := os.ReadFile(s.File)
+    if err != nil {
+        return "", fmt.Errorf("failed to read script: %w", err)
+    }
+    return string(data), nil
+}
+
+// ScriptResult records how a post-run script went on one database
+type ScriptResult struct {
+    Name     string `json:"name"`
+    Database string `json:"database"`
+    // Status is one of the Script outcome constants
+    Status     string `json:"status"`
+    Error      string `json:"error,omitempty"`
+    DurationMs int64  `json:"duration_ms"`
+}
+
+// validatePostRunScripts checks that every script has one source and a
+// known error policy
+func validatePostRunScripts(scripts []PostRunScript) error {
+    for i, script := range scripts {
+        if (script.File == "") == (script.SQL == "") {
+            return fmt.Errorf("post-run script %s needs either a file or sql", script.name(i))
+        }
+        if script.File != "" {
+            if _, err := os.Stat(script.File); err != nil {
+                return fmt.Errorf("post-run script %s: %w", script.name(i), err)
+            }
+        }
+        switch script.OnError {
+        case "", ScriptOnErrorStop, ScriptOnErrorContinue:
+        default:
+            return fmt.Errorf("on_error of post-run script %s must be %s or %s, got %q",
+                script.name(i), ScriptOnErrorStop, ScriptOnErrorContinue, script.OnError)
+        }
+        if script.Timeout < 0 {
+            return fmt.Errorf("timeout of post-run script %s must not be negative", script.name(i))
+        }
+    }
+    return nil
+}
+
+// postRunScriptsFromEnv returns the scripts configured by
+// FLOQ_POST_RUN_SCRIPTS, a comma separated list of files, or base when it
+// is not set
+func postRunScriptsFromEnv(base []PostRunScript) []PostRunScript {
+    files := getEnvList("FLOQ_POST_RUN_SCRIPTS", nil)
+    if files == nil {
+        return base
+    }
+    scripts := make([]PostRunScript, len(files))
+    for i, file := range files {
+        scripts[i] = PostRunScript{File: file}
+    }
+    return scripts
+}
+
+// RunPostScripts executes the configured scripts against the primary
+// database and every shard once the run is over, and records their
+// outcomes in the run. Runs with failed repositories, dry runs and SQL
+// dumps skip the scripts.
+func (r *Run) RunPostScripts(config Config) {
+    if len(config.PostRun) == 0 {
+        return
+    }
+    logger := log.New(logOutput, "[POSTRUN] ", log.LstdFlags|log.Lshortfile)
+
+    skip := ""
+    switch {
+    case r.Aborted():
+        skip = "the run was aborted"
+    case r.hasFailures():
+        skip = "the run has failed repositories"
+    case config.Driver == DriverMemory:
+        skip = "dry runs write no database"
+    case config.Driver == DriverSQL:
+        skip = "the sql driver writes no database"
+    }
+
+    targets := []string{"primary"}
+    databases := map[string]DatabaseConfig{"primary": config.DatabaseConfig}
+    for i := range config.Shards {
+        targets = append(targets, config.shardName(i))
+        databases[config.shardName(i)] = config.shardDatabase(i)
+    }
+
+    var results []ScriptResult
+    for _, target := range targets {
+        if skip != "" {
+            results = append(results, skipScripts(config.PostRun, 0, target, skip)...)
+            continue
+        }
+        db, err := openDatabase(databases[target])
+        if err != nil {
+            results = append(results, skipScripts(config.PostRun, 0, target, err.Error())...)
+            continue
+        }
+        results = append(results, runScripts(db, config.PostRun, target, logger)...)
+        db.Close()
+    }
+    if skip != "" {
+        logger.Printf("Skipping post-run scripts: %s", skip)
+    }
+
+    r.mu.Lock()
+    r.postRun = results
+    r.mu.Unlock()
+}
+
+// runScripts executes the scripts in order on one database
+func runScripts(db *sql.DB, scripts []PostRunScript, database string, logger *log.Logger) []ScriptResult {
+    var results []ScriptResult
+    for i, script := range scripts {
+        result := ScriptResult{Name: script.name(i), Database: database, Status: ScriptSucceeded}
+        started := time.Now()
+        err := runScript(db, script)
+        result.DurationMs = time.Since(started).Milliseconds()
+        if err == nil {
+            logger.Printf("Ran post-run script %s on %s in %dms", result.Name, database, result.DurationMs)
+            results = append(results, result)
+            continue
+        }
+
+        logger.Printf("Post-run script %s failed on %s: %v", result.Name, database, err)
+        result.Status, result.Error = ScriptFailed, err.Error()
+        results = append(results, result)
+        if script.OnError != ScriptOnErrorContinue {
+            return append(results, skipScripts(scripts, i+1, database, "script "+result.Name+" failed")...)
+        }
+    }
+    return results
+}
+
+// runScript executes one script within its timeout. The script is sent as
+// a single simple query, so it may hold several statements.
+func runScript(db *sql.DB, script PostRunScript) error {
+    source, err := script.source()
+    if err != nil {
+        return err
+    }
+    timeout := script.Timeout
+    if timeout == 0 {
+        timeout = defaultScriptTimeout
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+    defer cancel()
+    if _, err := db.ExecContext(ctx, source); err != nil {
+        if ctx.Err() != nil {
+            return fmt.Errorf("timed out after %ds: %w", timeout, err)
+        }
+        return err
+    }
+    return nil
+}
+
+// skipScripts records the scripts from index from on as skipped
+func skipScripts(scripts []PostRunScript, from int, database, reason string) []ScriptResult {
+    var results []ScriptResult
+    for i := from; i < len(scripts); i++ {
+        results = append(results, ScriptResult{Name: scripts[i].name(i), Database: database, Status: ScriptSkipped, Error: reason})
+    }
+    return results
+}
+
+// hasFailures reports whether any repository of the run failed
+func (r *Run) hasFailures() bool {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    for _, failed := range r.failed {
+        if failed {
+            return true
+        }
+    }
+    return false
+}
+
+// writePostRunSummary lists the post-run scripts' outcomes in the summary
+func writePostRunSummary(w io.Writer, results []ScriptResult) {
+    if len(results) == 0 {
+        return
+    }
+    fmt.Fprintln(w, "🧾 Post-Run Scripts:")
+    for _, result := range results {
+        switch result.Status {
+        case ScriptSucceeded:
+            fmt.Fprintf(w, "   ✅ %s on %s (%dms)\n", result.Name, result.Database, result.DurationMs)
+        case ScriptFailed:
+            fmt.Fprintf(w, "   ❌ %s on %s (%dms): %s\n", result.Name, result.Database, result.DurationMs, result.Error)
+        default:
+            fmt.Fprintf(w, "   ⏭️  %s on %s skipped: %s\n", result.Name, result.Database, result.Error)
+        }
+    }
+}
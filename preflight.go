@@ -0,0 +1,314 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "io/fs"
+    "net/http"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strings"
+    "sync"
+    "text/tabwriter"
+    "time"
+
+    "github.com/go-git/go-git/v5"
+    gitconfig "github.com/go-git/go-git/v5/config"
+    "github.com/go-git/go-git/v5/plumbing"
+    "github.com/go-git/go-git/v5/plumbing/transport"
+    "github.com/go-git/go-git/v5/storage/memory"
+)
+
+// preflightWorkers is the number of repositories checked concurrently
+const preflightWorkers = 8
+
+// RepoPreflight is the outcome of checking one repository before a run.
+// SizeKB and GoFiles are -1 when they could not be determined.
+type RepoPreflight struct {
+    Repository    string `json:"repository"`
+    Go            bool   `json:"go"`
+    DefaultBranch string `json:"default_branch,omitempty"`
+    SizeKB        int64  `json:"size_kb"`
+    GoFiles       int    `json:"go_files"`
+    Problem       string `json:"problem,omitempty"`
+    // ArchSpecific lists the directories with assembly or CUDA sources,
+    // whose functions will not be executed
+    ArchSpecific  []string `json:"arch_specific,omitempty"`
+}
+
+// preflightRepository checks that a repository can be cloned and has Go
+// code, without cloning it fully: remote repositories are probed with a ref
+// listing and a blobless, depth 1 tree listing
+func preflightRepository(repoURL string, paths []string) RepoPreflight {
+    check := RepoPreflight{Repository: repoURL, SizeKB: -1, GoFiles: -1}
+
+    if info, err := os.Stat(repoURL); err == nil && info.IsDir() {
+        preflightLocal(&check, paths)
+    } else {
+        preflightRemote(&check, paths)
+    }
+
+    if check.Problem == "" && check.GoFiles == 0 {
+        check.Problem = "no Go files"
+        if len(paths) > 0 {
+            check.Problem = "no Go files under " + strings.Join(paths, ", ")
+        }
+    }
+    check.Go = check.Problem == ""
+    return check
+}
+
+// preflightLocal measures a local directory
+func preflightLocal(check *RepoPreflight, paths []string) {
+    if repo, err := git.PlainOpen(check.Repository); err == nil {
+        if head, err := repo.Head(); err == nil {
+            check.DefaultBranch = head.Name().Short()
+        }
+    }
+
+    var size int64
+    goFiles := 0
+    var files []string
+    err := filepath.WalkDir(check.Repository, func(path string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        if d.IsDir() {
+            if d.Name() == ".git" {
+                return filepath.SkipDir
+            }
+            return nil
+        }
+        if info, err := d.Info(); err == nil {
+            size += info.Size()
+        }
+        rel, _ := filepath.Rel(check.Repository, path)
+        files = append(files, filepath.ToSlash(rel))
+        if strings.HasSuffix(path, ".go") && inPaths(filepath.ToSlash(rel), paths) {
+            goFiles++
+        }
+        return nil
+    })
+    if err != nil {
+        check.Problem = fmt.Sprintf("failed to read directory: %v", err)
+        return
+    }
+    check.SizeKB = size / 1024
+    check.GoFiles = goFiles
+    check.ArchSpecific = archSourceDirs(files, paths)
+}
+
+// preflightRemote lists the remote's refs, which checks reachability and
+// authentication and yields the default branch, then counts Go files in
+// the default branch's tree
+func preflightRemote(check *RepoPreflight, paths []string) {
+    remote := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{
+        Name: "origin",
+        URLs: []string{check.Repository},
+    })
+    refs, err := remote.List(&git.ListOptions{})
+    if err != nil {
+        switch {
+        case errors.Is(err, transport.ErrAuthenticationRequired), errors.Is(err, transport.ErrAuthorizationFailed):
+            check.Problem = "authentication required"
+        case errors.Is(err, transport.ErrRepositoryNotFound):
+            check.Problem = "repository not found"
+        case errors.Is(err, transport.ErrEmptyRemoteRepository):
+            check.Problem = "repository is empty"
+        default:
+            check.Problem = fmt.Sprintf("unreachable: %v", err)
+        }
+        return
+    }
+    for _, ref := range refs {
+        if ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference {
+            check.DefaultBranch = ref.Target().Short()
+        }
+    }
+
+    if size, ok := githubRepositorySize(check.Repository); ok {
+        check.SizeKB = size
+    }
+
+    files, err := listRemoteTree(check.Repository)
+    if err != nil {
+        check.Problem = err.Error()
+        return
+    }
+    check.GoFiles = 0
+    for _, file := range files {
+        if strings.HasSuffix(file, ".go") && inPaths(file, paths) {
+            check.GoFiles++
+        }
+    }
+    check.ArchSpecific = archSourceDirs(files, paths)
+}
+
+// listRemoteTree returns the file paths at the tip of the default branch.
+// The blobless, depth 1 clone only downloads one commit and its trees.
+func listRemoteTree(repoURL string) ([]string, error) {
+    dir, err := os.MkdirTemp("", "floq-preflight-*")
+    if err != nil {
+        return nil, fmt.Errorf("failed to create temp directory: %w", err)
+    }
+    defer os.RemoveAll(dir)
+
+    steps := [][]string{
+        {"clone", "--bare", "--depth", "1", "--filter=blob:none", repoURL, dir},
+        {"-C", dir, "ls-tree", "-r", "--name-only", "HEAD"},
+    }
+    var out []byte
+    for _, args := range steps {
+        cmd := exec.Command("git", args...)
+        cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+        if out, err = cmd.CombinedOutput(); err != nil {
+            return nil, fmt.Errorf("git %s failed: %w: %s", args[0], err, lastLine(out))
+        }
+    }
+    return strings.Fields(string(out)), nil
+}
+
+// githubRepositorySize asks the GitHub API of github.com, or of a GitHub
+// Enterprise Server with a configured API URL, for a repository's
+// approximate size in KB. The provider's token is sent when set, to raise
+// the unauthenticated rate limit and see private repositories.
+func githubRepositorySize(repoURL string) (int64, bool) {
+    host := providerHost(repoURL)
+    apiURL := providerAPIURL(host)
+    slug := repositorySlug(repoURL)
+    if apiURL == "" || strings.Count(slug, "/") != 1 {
+        return 0, false
+    }
+
+    req, err := http.NewRequest(http.MethodGet, apiURL+"/repos/"+slug, nil)
+    if err != nil {
+        return 0, false
+    }
+    req.Header.Set("Accept", "application/vnd.github+json")
+    if token := providerToken(host); token != "" {
+        req.Header.Set("Authorization", "Bearer "+token)
+    }
+
+    resp, err := providerHTTPClient(10 * time.Second).Do(req)
+    if err != nil {
+        return 0, false
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return 0, false
+    }
+
+    var repo struct {
+        Size int64 `json:"size"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&repo); err != nil {
+        return 0, false
+    }
+    return repo.Size, true
+}
+
+// formatSizeKB renders an approximate size for the preflight table
+func formatSizeKB(kb int64) string {
+    switch {
+    case kb < 0:
+        return "?"
+    case kb >= 1<<20:
+        return fmt.Sprintf("%.1f GiB", float64(kb)/(1<<20))
+    case kb >= 1<<10:
+        return fmt.Sprintf("%.1f MiB", float64(kb)/(1<<10))
+    }
+    return fmt.Sprintf("%d KiB", kb)
+}
+
+// RunValidateRepos implements the validate-repos subcommand: it checks
+// every repository from the arguments and an optional list file and prints
+// a go/no-go table. It returns false if any repository is a no-go.
+func RunValidateRepos(config Config, args []string, out io.Writer) (bool, error) {
+    fs := flag.NewFlagSet("validate-repos", flag.ContinueOnError)
+    listFile := fs.String("list", "", "file with repository URLs to check, one per line")
+    asJSON := fs.Bool("json", false, "print the checks as JSON")
+    if err := fs.Parse(args); err != nil {
+        return false, err
+    }
+
+    repositories := fs.Args()
+    if *listFile != "" {
+        listed, err := readRepositoryList(*listFile)
+        if err != nil {
+            return false, err
+        }
+        repositories = append(repositories, listed...)
+    }
+    if len(repositories) == 0 {
+        return false, fmt.Errorf("no repositories to validate")
+    }
+
+    checks := make([]RepoPreflight, len(repositories))
+    indexes := make(chan int)
+    var wg sync.WaitGroup
+    for w := 0; w < preflightWorkers && w < len(repositories); w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for i := range indexes {
+                checks[i] = preflightRepository(repositories[i], config.Extraction.Paths)
+            }
+        }()
+    }
+    for i := range repositories {
+        indexes <- i
+    }
+    close(indexes)
+    wg.Wait()
+
+    ready := true
+    for _, check := range checks {
+        ready = ready && check.Go
+    }
+
+    if *asJSON {
+        data, err := json.MarshalIndent(checks, "", "  ")
+        if err != nil {
+            return false, fmt.Errorf("failed to marshal checks: %w", err)
+        }
+        fmt.Fprintln(out, string(data))
+        return ready, nil
+    }
+
+    w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "STATUS\tREPOSITORY\tBRANCH\tSIZE\tGO FILES\tPROBLEM")
+    for _, check := range checks {
+        status := "✅ GO"
+        if !check.Go {
+            status = "❌ NO-GO"
+        }
+        goFiles := "?"
+        if check.GoFiles >= 0 {
+            goFiles = fmt.Sprint(check.GoFiles)
+        }
+        fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", status, check.Repository, check.DefaultBranch,
+            formatSizeKB(check.SizeKB), goFiles, check.Problem)
+    }
+    if err := w.Flush(); err != nil {
+        return ready, err
+    }
+
+    passed := 0
+    for _, check := range checks {
+        if check.Go {
+            passed++
+        }
+    }
+    for _, check := range checks {
+        if len(check.ArchSpecific) > 0 {
+            fmt.Fprintf(out, "\n⚠️  %s: assembly or CUDA sources in %s; their functions will not be executed\n",
+                check.Repository, strings.Join(check.ArchSpecific, ", "))
+        }
+    }
+    fmt.Fprintf(out, "\n%d/%d repositories ready\n", passed, len(checks))
+    return ready, nil
+}
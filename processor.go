@@ -1,21 +1,58 @@
 package main
 
 import (
+    "context"
     "encoding/json"
     "fmt"
+    "io"
     "log"
     "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
     "time"
 )
 
-// RepositoryProcessor manages processing of multiple repositories
+// RepositoryProcessor manages processing of multiple repositories. It holds
+// no per-run state, so ProcessRepositories may be called concurrently from
+// multiple goroutines; each call gets its own Run.
 type RepositoryProcessor struct {
-    config     DatabaseConfig
-    extractor  *GitHubFunctionExtractor
+    config   Config
+    logger   *log.Logger
+    approver *Approver
+}
+
+// processorWorker is the worker name ProcessRepositories records under
+const processorWorker = "processor"
+
+// Run holds the results and aggregate statistics of a single
+// ProcessRepositories call
+type Run struct {
+    ID         string
+    // RetryOf is the run whose failures this run retried
+    RetryOf    string
+    mu         sync.Mutex
+    order      []string
     results    map[string]*ProcessingResult
-    logger     *log.Logger
-    startTime  time.Time
-    totalStats ProcessingStats
+    // failed marks the repositories whose processing failed
+    failed     map[string]bool
+    stats      *StatsAggregator
+    // repositories and processingTimeMs are stamped by finish
+    repositories     int
+    processingTimeMs int64
+    // tables holds the table names claimed by the run's repositories
+    tables     *tableRegistry
+    // outputs reads the tables back for exports that include them
+    outputs    *runOutputs
+    // postRun holds the outcomes of the post-run SQL scripts
+    postRun    []ScriptResult
+    // aborted is set when the run was interrupted, and pending lists the
+    // repositories it did not start; timedOut is set when the run's
+    // timeout interrupted it
+    aborted    bool
+    timedOut   bool
+    pending    []RepoSpec
 }
 
 // ProcessingStats holds aggregate statistics
@@ -25,121 +62,538 @@ type ProcessingStats struct {
     TotalExecuted       int `json:"total_executed"`
     TotalTables         int `json:"total_tables"`
     TotalErrors         int `json:"total_errors"`
+    TotalCacheHits      int `json:"total_cache_hits"`
+    TotalCacheMisses    int `json:"total_cache_misses"`
+    TotalExtractionCacheHits   int `json:"total_extraction_cache_hits,omitempty"`
+    TotalExtractionCacheMisses int `json:"total_extraction_cache_misses,omitempty"`
     ProcessingTimeMs    int64 `json:"processing_time_ms"`
+    // Repository durations; RepositoryTimeMs and TimedRepositories are
+    // kept so averages can be merged
+    MinRepositoryMs     int64 `json:"min_repository_ms,omitempty"`
+    MaxRepositoryMs     int64 `json:"max_repository_ms,omitempty"`
+    AvgRepositoryMs     int64 `json:"avg_repository_ms,omitempty"`
+    RepositoryTimeMs    int64 `json:"repository_time_ms,omitempty"`
+    TimedRepositories   int   `json:"timed_repositories,omitempty"`
+    // PhaseMs sums the time spent in each phase across repositories
+    PhaseMs             map[string]int64 `json:"phase_ms,omitempty"`
+    // ErrorsByKind counts errors by category; see errorKind
+    ErrorsByKind        map[string]int `json:"errors_by_kind,omitempty"`
+    // StoreQueueDepth is the number of outputs waiting to be stored when
+    // the statistics were taken; MaxStoreQueueDepth is the deepest a
+    // repository's queue got, and StoreBlockedMs how long execution waited
+    // for the database
+    StoreQueueDepth     int64 `json:"store_queue_depth"`
+    MaxStoreQueueDepth  int   `json:"max_store_queue_depth,omitempty"`
+    StoreBlockedMs      int64 `json:"store_blocked_ms,omitempty"`
+    // Workers accounts for each worker that recorded repositories
+    Workers             []WorkerStats `json:"workers,omitempty"`
 }
 
 // NewRepositoryProcessor creates a new repository processor
-func NewRepositoryProcessor(config DatabaseConfig) *RepositoryProcessor {
-    logger := log.New(os.Stdout, "[PROCESSOR] ", log.LstdFlags|log.Lshortfile)
+func NewRepositoryProcessor(config Config) *RepositoryProcessor {
+    logger := log.New(logOutput, "[PROCESSOR] ", log.LstdFlags|log.Lshortfile)
     
     return &RepositoryProcessor{
-        config:  config,
+        config: config,
+        logger: logger,
+    }
+}
+
+// SetApprover makes extractors ask the approver before every execution
+func (p *RepositoryProcessor) SetApprover(approver *Approver) {
+    p.approver = approver
+}
+
+// newRun creates an empty run starting now
+func newRun(id string) *Run {
+    return &Run{
+        ID:      id,
         results: make(map[string]*ProcessingResult),
-        logger:  logger,
+        failed:  make(map[string]bool),
+        stats:   NewStatsAggregator(),
+        tables:  newTableRegistry(),
     }
 }
 
-// ProcessRepositories processes a list of repository URLs
-func (p *RepositoryProcessor) ProcessRepositories(repositories []string) error {
-    p.startTime = time.Now()
-    p.logger.Printf("Starting processing of %d repositories", len(repositories))
+// ProcessRepositories processes a list of repository URLs under the given
+// run id and returns the run holding their results. Cancelling ctx stops
+// the run: no repository is started afterwards, and the current one stops
+// its clone, build or execution and rolls back the output being stored.
+func (p *RepositoryProcessor) ProcessRepositories(ctx context.Context, runID string, repositories []string) (*Run, error) {
+    return p.processRepositories(ctx, runID, specsFromURLs(repositories), nil)
+}
+
+// ProcessRepoSpecs processes the repositories of a repositories file under
+// the given run id; results are keyed by RepoSpec.Key
+func (p *RepositoryProcessor) ProcessRepoSpecs(ctx context.Context, runID string, specs []RepoSpec) (*Run, error) {
+    return p.processRepositories(ctx, runID, specs, nil)
+}
+
+// processRepositories processes repositories; functions, when set,
+// restricts the execution of the repositories it lists, by key, to the
+// named functions
+func (p *RepositoryProcessor) processRepositories(ctx context.Context, runID string, specs []RepoSpec, functions map[string][]string) (*Run, error) {
+    run := newRun(runID)
+    // Dry runs keep their outputs until the export reads them
+    if containsString(p.config.Export.Formats, "duckdb") {
+        run.outputs = newRunOutputs(p.config.DatabaseConfig)
+    }
+    p.logger.Printf("Starting processing of %d repositories", len(specs))
+
+    // Shared libraries go before the repositories depending on them
+    specs, err := p.orderByDependencies(specs)
+    if err != nil {
+        return nil, err
+    }
     
-    for i, repoURL := range repositories {
-        p.logger.Printf("Processing repository %d/%d: %s", i+1, len(repositories), repoURL)
+    processed := len(specs)
+    for i, spec := range specs {
+        if ctx.Err() != nil {
+            p.logger.Printf("Interrupted; %d repositories were not started", len(specs)-i)
+            run.abort(specs[i:], timedOut(ctx))
+            processed = i
+            break
+        }
+        repoURL, key := spec.URL, spec.Key()
+        p.logger.Printf("Processing repository %d/%d: %s", i+1, len(specs), key)
+
+        config, err := spec.applyTo(p.config)
+        if err != nil {
+            p.logger.Printf("Failed to process repository %s: %v", key, err)
+            run.record(key, spec.stamp(&ProcessingResult{Errors: []string{err.Error()}}), false)
+            continue
+        }
         
         // Create new extractor for each repository
-        p.extractor = NewGitHubFunctionExtractor(p.config)
+        extractor := NewGitHubFunctionExtractor(config)
+        extractor.SetRunID(runID)
+        extractor.SetTableRegistry(run.tables)
+        if run.outputs != nil && run.outputs.memory != nil {
+            extractor.SetStorage(run.outputs.memory)
+        }
+        if p.approver != nil {
+            extractor.SetApprover(p.approver)
+        }
+        extractor.SetDependencies(run.dependencyVersions(dependenciesOf(repoURL, p.config.Dependencies)))
+        if names := functions[key]; len(names) > 0 {
+            extractor.SetSelection(retrySelection(names))
+        }
+        extractor.SetRef(spec.Ref)
         
-        result, err := p.extractor.ProcessRepository(repoURL)
-        if err != nil {
-            p.logger.Printf("Failed to process repository %s: %v", repoURL, err)
-            // Store partial results even on failure
-            if result != nil {
-                p.results[repoURL] = result
-            } else {
-                p.results[repoURL] = &ProcessingResult{
-                    Errors: []string{err.Error()},
+        // Time travel records one result per historical ref, unless the
+        // spec pins one
+        if p.config.TimeTravel.Enabled() && spec.Ref == "" {
+            err := extractor.ProcessRepositoryHistory(ctx, repoURL, p.config.TimeTravel, func(ref HistoricalRef, result *ProcessingResult, err error) {
+                refKey := key + "@" + ref.Name
+                if err != nil {
+                    p.logger.Printf("Failed to process repository %s: %v", refKey, err)
+                    result.Errors = append(result.Errors, err.Error())
                 }
+                run.record(refKey, spec.stamp(result), err == nil)
+            })
+            if err != nil {
+                p.logger.Printf("Failed to process repository %s: %v", repoURL, err)
+                run.record(key, spec.stamp(&ProcessingResult{Errors: []string{err.Error()}}), false)
+                continue
             }
+            p.logger.Printf("Successfully processed repository history: %s", repoURL)
             continue
         }
         
-        p.results[repoURL] = result
-        p.logger.Printf("Successfully processed repository: %s", repoURL)
+        result, err := extractor.ProcessRepository(ctx, repoURL)
+        if err != nil {
+            p.logger.Printf("Failed to process repository %s: %v", key, err)
+            // Store partial results even on failure
+            if result == nil {
+                result = &ProcessingResult{}
+            }
+            result.Errors = append(result.Errors, err.Error())
+            run.record(key, spec.stamp(result), false)
+            continue
+        }
         
-        // Update aggregate stats
-        p.updateStats(result)
+        run.record(key, spec.stamp(result), true)
+        p.logger.Printf("Successfully processed repository: %s", key)
+    }
+    // A run interrupted during its last repository has nothing pending
+    // but was still cut short
+    if processed == len(specs) && ctx.Err() != nil && !run.Aborted() {
+        run.abort(nil, timedOut(ctx))
     }
     
-    p.totalStats.TotalRepositories = len(repositories)
-    p.totalStats.ProcessingTimeMs = time.Since(p.startTime).Milliseconds()
+    run.finish(processed)
     
     p.logger.Printf("Completed processing %d repositories in %dms", 
-        len(repositories), p.totalStats.ProcessingTimeMs)
+        processed, run.Stats().ProcessingTimeMs)
     
-    return nil
+    return run, nil
+}
+
+// orderByDependencies moves shared libraries before the repositories
+// depending on them, keeping the given order otherwise
+func (p *RepositoryProcessor) orderByDependencies(specs []RepoSpec) ([]RepoSpec, error) {
+    repositories := make([]string, len(specs))
+    byURL := make(map[string][]RepoSpec)
+    for i, spec := range specs {
+        repositories[i] = spec.URL
+        byURL[spec.URL] = append(byURL[spec.URL], spec)
+    }
+    groups, err := dependencyLevels(repositories, p.config.Dependencies)
+    if err != nil {
+        return nil, err
+    }
+    if len(groups) <= 1 {
+        return specs, nil
+    }
+
+    ordered := make([]RepoSpec, 0, len(specs))
+    for level, group := range groups {
+        p.logger.Printf("Dependency level %d: %s", level, strings.Join(group, ", "))
+        for _, repoURL := range group {
+            ordered = append(ordered, byURL[repoURL][0])
+            byURL[repoURL] = byURL[repoURL][1:]
+        }
+    }
+    return ordered, nil
+}
+
+// record stores a repository's result and accounts for it in the
+// aggregate statistics
+func (r *Run) record(repoURL string, result *ProcessingResult, succeeded bool) {
+    r.recordFrom(processorWorker, repoURL, result, succeeded)
+}
+
+// recordFrom stores a repository's result and accounts for it under the
+// worker that processed it. It may be called from concurrent workers.
+func (r *Run) recordFrom(worker, repoURL string, result *ProcessingResult, succeeded bool) {
+    r.mu.Lock()
+    if _, seen := r.results[repoURL]; !seen {
+        r.order = append(r.order, repoURL)
+    }
+    result.Failed = !succeeded
+    r.results[repoURL] = result
+    r.failed[repoURL] = !succeeded
+    r.mu.Unlock()
+
+    r.stats.Worker(worker).Record(result, succeeded)
 }
 
-// updateStats updates aggregate statistics
-func (p *RepositoryProcessor) updateStats(result *ProcessingResult) {
-    p.totalStats.TotalFunctions += len(result.ProcessedFunctions)
-    p.totalStats.TotalExecuted += len(result.ExecutedFunctions)
-    p.totalStats.TotalTables += len(result.CreatedTables)
-    p.totalStats.TotalErrors += len(result.Errors)
+// dependencyVersions returns the versions of the given repositories that
+// the run processed; repositories not processed in the run are left out
+func (r *Run) dependencyVersions(dependencies []string) []DependencyVersion {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    var versions []DependencyVersion
+    for _, dependency := range dependencies {
+        for _, repoURL := range r.order {
+            if repositoryKey(repoURL) != repositoryKey(dependency) {
+                continue
+            }
+            result := r.results[repoURL]
+            versions = append(versions, DependencyVersion{
+                Repository: repoURL,
+                Module:     result.ModulePath,
+                Commit:     result.Commit,
+                Failed:     r.failed[repoURL],
+            })
+            break
+        }
+    }
+    return versions
+}
+
+// finish stamps the final repository count and processing time
+func (r *Run) finish(repositories int) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    r.repositories = repositories
+    r.processingTimeMs = r.stats.Snapshot().ProcessingTimeMs
+}
+
+// statsLocked returns the aggregate statistics, with the totals stamped
+// by finish once the run is over. The caller must hold r.mu.
+func (r *Run) statsLocked() ProcessingStats {
+    stats := r.stats.Snapshot()
+    if r.processingTimeMs > 0 || r.repositories > 0 {
+        stats.TotalRepositories = r.repositories
+        stats.ProcessingTimeMs = r.processingTimeMs
+    }
+    return stats
+}
+
+// add folds a repository's result into the statistics
+func (s *ProcessingStats) add(result *ProcessingResult) {
+    s.TotalFunctions += len(result.ProcessedFunctions)
+    s.TotalExecuted += len(result.ExecutedFunctions)
+    s.TotalTables += len(result.CreatedTables)
+    s.TotalErrors += len(result.Errors)
+    s.TotalCacheHits += result.CacheHits
+    s.TotalCacheMisses += result.CacheMisses
+    s.TotalExtractionCacheHits += result.ExtractionCacheHits
+    s.TotalExtractionCacheMisses += result.ExtractionCacheMisses
+
+    repository := ProcessingStats{
+        MinRepositoryMs:   result.DurationMs,
+        MaxRepositoryMs:   result.DurationMs,
+        RepositoryTimeMs:  result.DurationMs,
+        TimedRepositories: 1,
+        PhaseMs:           result.PhaseMs,
+    }
+    if result.StoreQueue != nil {
+        repository.MaxStoreQueueDepth = result.StoreQueue.MaxDepth
+        repository.StoreBlockedMs = result.StoreQueue.BlockedMs
+    }
+    for _, message := range result.Errors {
+        if repository.ErrorsByKind == nil {
+            repository.ErrorsByKind = make(map[string]int)
+        }
+        repository.ErrorsByKind[errorKind(message)]++
+    }
+    s.merge(repository)
 }
 
 // PrintSummary prints a detailed summary of processing results
-func (p *RepositoryProcessor) PrintSummary() {
-    fmt.Println("\n" + "="*60)
-    fmt.Println("🎉 PROCESSING SUMMARY")
-    fmt.Println("="*60)
+func (r *Run) PrintSummary() {
+    r.WriteSummary(os.Stdout)
+}
+
+// WriteSummary writes the detailed summary of processing results to w
+func (r *Run) WriteSummary(w io.Writer) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    fmt.Fprintln(w, "\n" + strings.Repeat("=", 60))
+    fmt.Fprintln(w, "🎉 PROCESSING SUMMARY")
+    fmt.Fprintln(w, strings.Repeat("=", 60))
+    if r.aborted && r.timedOut {
+        fmt.Fprintf(w, "🛑 Run aborted: timed out with %d repositories not started\n", len(r.pending))
+    } else if r.aborted {
+        fmt.Fprintf(w, "🛑 Run aborted: interrupted with %d repositories not started\n", len(r.pending))
+    }
     
-    fmt.Printf("📊 Total Repositories: %d\n", p.totalStats.TotalRepositories)
-    fmt.Printf("⚡ Total Functions Processed: %d\n", p.totalStats.TotalFunctions)
-    fmt.Printf("✅ Total Functions Executed: %d\n", p.totalStats.TotalExecuted)
-    fmt.Printf("🗄️  Total Tables Created: %d\n", p.totalStats.TotalTables)
-    fmt.Printf("❌ Total Errors: %d\n", p.totalStats.TotalErrors)
-    fmt.Printf("⏱️  Processing Time: %dms\n", p.totalStats.ProcessingTimeMs)
+    stats := r.statsLocked()
+    fmt.Fprintf(w, "📊 Total Repositories: %d\n", stats.TotalRepositories)
+    fmt.Fprintf(w, "⚡ Total Functions Processed: %d\n", stats.TotalFunctions)
+    fmt.Fprintf(w, "✅ Total Functions Executed: %d\n", stats.TotalExecuted)
+    fmt.Fprintf(w, "🗄️  Total Tables Created: %d\n", stats.TotalTables)
+    fmt.Fprintf(w, "❌ Total Errors: %d\n", stats.TotalErrors)
+    fmt.Fprintf(w, "⏱️  Processing Time: %dms\n", stats.ProcessingTimeMs)
     
-    if p.totalStats.TotalFunctions > 0 {
-        successRate := float64(p.totalStats.TotalExecuted) / float64(p.totalStats.TotalFunctions) * 100
-        fmt.Printf("📈 Success Rate: %.1f%%\n", successRate)
+    if stats.TotalFunctions > 0 {
+        successRate := float64(stats.TotalExecuted) / float64(stats.TotalFunctions) * 100
+        fmt.Fprintf(w, "📈 Success Rate: %.1f%%\n", successRate)
+    }
+
+    if lookups := stats.TotalCacheHits + stats.TotalCacheMisses; lookups > 0 {
+        hitRate := float64(stats.TotalCacheHits) / float64(lookups) * 100
+        fmt.Fprintf(w, "💾 Cache Hit Rate: %.1f%% (%d/%d)\n", hitRate, stats.TotalCacheHits, lookups)
+    }
+    if lookups := stats.TotalExtractionCacheHits + stats.TotalExtractionCacheMisses; lookups > 0 {
+        hitRate := float64(stats.TotalExtractionCacheHits) / float64(lookups) * 100
+        fmt.Fprintf(w, "📦 Extraction Cache Hit Rate: %.1f%% (%d/%d files)\n", hitRate, stats.TotalExtractionCacheHits, lookups)
+    }
+    if stats.TimedRepositories > 0 {
+        fmt.Fprintf(w, "🕒 Repository Time: %dms min, %dms avg, %dms max\n",
+            stats.MinRepositoryMs, stats.AvgRepositoryMs, stats.MaxRepositoryMs)
+    }
+    if len(stats.PhaseMs) > 0 {
+        var phases []string
+        for _, phase := range []string{PhaseClone, PhaseExtract, PhaseExecute, PhaseStore} {
+            phases = append(phases, fmt.Sprintf("%s %dms", phase, stats.PhaseMs[phase]))
+        }
+        fmt.Fprintf(w, "🧭 Phases: %s\n", joinStrings(phases, ", "))
+    }
+    if stats.MaxStoreQueueDepth > 0 {
+        fmt.Fprintf(w, "🚰 Store Queue: %d max depth, execution blocked %dms\n",
+            stats.MaxStoreQueueDepth, stats.StoreBlockedMs)
+    }
+    writeWorkspaceSummary(w, r.results)
+    if len(stats.ErrorsByKind) > 0 {
+        kinds := make([]string, 0, len(stats.ErrorsByKind))
+        for kind := range stats.ErrorsByKind {
+            kinds = append(kinds, kind)
+        }
+        sort.Slice(kinds, func(i, j int) bool {
+            if stats.ErrorsByKind[kinds[i]] != stats.ErrorsByKind[kinds[j]] {
+                return stats.ErrorsByKind[kinds[i]] > stats.ErrorsByKind[kinds[j]]
+            }
+            return kinds[i] < kinds[j]
+        })
+        fmt.Fprintln(w, "🏷️  Errors By Kind:")
+        for _, kind := range kinds {
+            fmt.Fprintf(w, "   • %s: %d\n", kind, stats.ErrorsByKind[kind])
+        }
     }
+    writePostRunSummary(w, r.postRun)
     
-    fmt.Println("\n📋 REPOSITORY DETAILS:")
-    fmt.Println("-" * 60)
+    fmt.Fprintln(w, "\n📋 REPOSITORY DETAILS:")
+    fmt.Fprintln(w, strings.Repeat("-", 60))
     
-    for repoURL, result := range p.results {
-        fmt.Printf("\n🔗 Repository: %s\n", repoURL)
-        fmt.Printf("   📝 Functions: %d\n", len(result.ProcessedFunctions))
-        fmt.Printf("   ⚡ Executed: %d\n", len(result.ExecutedFunctions))
-        fmt.Printf("   🗄️  Tables: %d\n", len(result.CreatedTables))
-        fmt.Printf("   ❌ Errors: %d\n", len(result.Errors))
+    for _, repoURL := range r.order {
+        result := r.results[repoURL]
+        fmt.Fprintf(w, "\n🔗 Repository: %s\n", repoURL)
+        if result.Ref != "" {
+            fmt.Fprintf(w, "   🕰️  Ref: %s (%s)\n", result.Ref, result.Commit)
+        }
+        if len(result.Labels) > 0 {
+            fmt.Fprintf(w, "   🏷️  Labels: %s\n", formatLabels(result.Labels))
+        }
+        if result.NotSelected {
+            fmt.Fprintln(w, "   🎯 Not selected")
+            continue
+        }
+        if result.SkippedByHook != "" {
+            fmt.Fprintf(w, "   🪝 Skipped by %s\n", result.SkippedByHook)
+            continue
+        }
+        fmt.Fprintf(w, "   📝 Functions: %d\n", len(result.ProcessedFunctions))
+        fmt.Fprintf(w, "   ⚡ Executed: %d\n", len(result.ExecutedFunctions))
+        fmt.Fprintf(w, "   🗄️  Tables: %d\n", len(result.CreatedTables))
+        for _, archive := range result.Archives {
+            fmt.Fprintf(w, "   🗃️  Archived (%s): %s\n", archive.Kind, archive.Location)
+        }
+        if record := result.WriteBack; record != nil {
+            switch {
+            case record.Unchanged:
+                fmt.Fprintf(w, "   ✍️  Catalog: %s unchanged\n", record.Path)
+            case record.PullRequest != "":
+                fmt.Fprintf(w, "   ✍️  Catalog: %s on %s (%s)\n", record.Path, record.Branch, record.PullRequest)
+            case record.Commit != "":
+                fmt.Fprintf(w, "   ✍️  Catalog: %s on %s\n", record.Path, record.Branch)
+            }
+        }
+        for _, dependency := range result.Dependencies {
+            fmt.Fprintf(w, "   🔗 Depends On: %s\n", describeDependency(dependency))
+        }
+        if result.Retried != nil {
+            fmt.Fprintf(w, "   🔁 Retried: %s\n", describeRetry(result.Retried))
+        }
+        if result.Shard != "" {
+            fmt.Fprintf(w, "   🧩 Shard: %s\n", result.Shard)
+        }
+        fmt.Fprintf(w, "   ❌ Errors: %d\n", len(result.Errors))
+        if len(result.PayloadHashes) > 0 {
+            fmt.Fprintf(w, "   ♻️  Payloads: %d stored, %d deduplicated\n",
+                len(result.PayloadHashes)-result.DeduplicatedPayloads, result.DeduplicatedPayloads)
+        }
+        if len(result.TruncatedOutputs) > 0 {
+            fmt.Fprintf(w, "   ✂️  Truncated Outputs: %s\n", describeTruncated(result.TruncatedOutputs))
+        }
+        if len(result.DivergentFunctions) > 0 {
+            fmt.Fprintf(w, "   🔀 Divergent Across Toolchains: %s\n", joinStrings(result.DivergentFunctions, ", "))
+        }
+        if len(result.UnsupportedFunctions) > 0 {
+            fmt.Fprintf(w, "   🧱 Unsupported On This Runner: %d\n", len(result.UnsupportedFunctions))
+        }
+        if len(result.EmbeddedFunctions) > 0 {
+            fmt.Fprintf(w, "   🧬 Embedded Go Functions: %d\n", len(result.EmbeddedFunctions))
+        }
+        if len(result.Mocks) > 0 {
+            fmt.Fprintf(w, "   🎭 Executed With Mocks: %d\n", len(result.Mocks))
+        }
+        if excluded := excludedFiles(result.Files); excluded > 0 {
+            fmt.Fprintf(w, "   🚫 Excluded Files: %d\n", excluded)
+        }
+        if len(result.Retries) > 0 {
+            succeeded := 0
+            for _, retry := range result.Retries {
+                if retry.Succeeded {
+                    succeeded++
+                }
+            }
+            fmt.Fprintf(w, "   🔁 Retried With More Headroom: %d (%d succeeded)\n", len(result.Retries), succeeded)
+        }
+        if len(result.TableCollisions) > 0 {
+            fmt.Fprintf(w, "   ⚠️  Table Name Collisions: %d\n", len(result.TableCollisions))
+            for _, collision := range result.TableCollisions {
+                fmt.Fprintf(w, "      • %s\n", collision)
+            }
+        }
+        if len(result.Vulnerabilities) > 0 {
+            fmt.Fprintf(w, "   🛡️  Known Vulnerabilities: %d\n", len(result.Vulnerabilities))
+        }
+        if result.VulnerabilityBlock != "" {
+            fmt.Fprintf(w, "   ⛔ Execution Skipped: %s\n", result.VulnerabilityBlock)
+        }
+        if result.ErrorCap != nil {
+            fmt.Fprintf(w, "   🧯 Stopped After %d Errors: %d files not processed\n", result.ErrorCap.MaxErrors, result.ErrorCap.SkippedFiles)
+        }
+        if workspace := result.Workspace; workspace != nil {
+            if workspace.Wiped {
+                fmt.Fprintf(w, "   🧹 Workspace Wiped: %d files, %d bytes\n", workspace.Files, workspace.Bytes)
+            }
+            if !workspace.Clean() {
+                fmt.Fprintf(w, "   ⚠️  Workspace Not Clean: %d leftovers in %s %s\n", len(workspace.Leftovers), workspace.Dir, workspace.Error)
+            }
+        }
+        if len(result.Runners) > 0 {
+            fmt.Fprintf(w, "   🔬 Kept Runners: %d in %s\n", len(result.Runners), filepath.Dir(result.Runners[0].Dir))
+        }
+        if len(result.Stability) > 0 {
+            statuses := make(map[string]int)
+            for _, stability := range result.Stability {
+                statuses[stability.Status]++
+            }
+            fmt.Fprintf(w, "   📈 Stability: %d stable, %d flaky, %d failing (%d skipped)\n", statuses[StabilityStable],
+                statuses[StabilityFlaky], statuses[StabilityFailing], len(result.FailingSkipped))
+        }
+        if len(result.Commands) > 0 {
+            failed := 0
+            for _, run := range result.Commands {
+                if run.Error != "" {
+                    failed++
+                }
+            }
+            fmt.Fprintf(w, "   🖥️  Command Runs: %d (%d failed)\n", len(result.Commands), failed)
+        }
+        if len(result.IgnoredPaths) > 0 {
+            fmt.Fprintf(w, "   🙈 Ignored Paths: %d\n", len(result.IgnoredPaths))
+        }
+        if len(result.WalkDiagnostics) > 0 {
+            fmt.Fprintf(w, "   🔗 Unsafe Paths Skipped: %d\n", len(result.WalkDiagnostics))
+        }
+        if result.SQLDump != "" {
+            fmt.Fprintf(w, "   📄 SQL Dump: %s\n", result.SQLDump)
+        }
+        if result.Sandbox != "" {
+            fmt.Fprintf(w, "   🛡️  Sandbox: %s\n", result.Sandbox)
+        }
+        if result.SyntheticModule {
+            fmt.Fprintf(w, "   🧩 Synthetic module: %s\n", result.ModulePath)
+        }
         
         if len(result.CreatedTables) > 0 {
-            fmt.Printf("   📋 Created Tables: %s\n", joinStrings(result.CreatedTables, ", "))
+            fmt.Fprintf(w, "   📋 Created Tables: %s\n", joinStrings(result.CreatedTables, ", "))
         }
         
         if len(result.Errors) > 0 {
-            fmt.Printf("   ⚠️  Error Details:\n")
+            fmt.Fprintf(w, "   ⚠️  Error Details:\n")
             for _, err := range result.Errors {
-                fmt.Printf("      • %s\n", err)
+                fmt.Fprintf(w, "      • %s\n", err)
             }
         }
     }
 }
 
 // SaveResultsToFile saves processing results to a JSON file
-func (p *RepositoryProcessor) SaveResultsToFile(filename string) error {
+func (r *Run) SaveResultsToFile(filename string) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
     // Create comprehensive results structure
-    output := struct {
-        Summary ProcessingStats                  `json:"summary"`
-        Results map[string]*ProcessingResult   `json:"results"`
-        GeneratedAt string                     `json:"generated_at"`
-    }{
-        Summary:     p.totalStats,
-        Results:     p.results,
-        GeneratedAt: time.Now().Format(time.RFC3339),
+    output := RunResults{
+        SchemaVersion: ResultsSchemaVersion,
+        Summary:       r.statsLocked(),
+        Results:       r.results,
+        GeneratedAt:   time.Now().Format(time.RFC3339),
+        RunID:         r.ID,
+        RetryOf:       r.RetryOf,
+        PostRun:       r.postRun,
+        Aborted:       r.aborted,
+        TimedOut:      r.timedOut,
+        Pending:       r.pending,
     }
     
     data, err := json.MarshalIndent(output, "", "  ")
@@ -152,18 +606,36 @@ func (p *RepositoryProcessor) SaveResultsToFile(filename string) error {
         return fmt.Errorf("failed to write results file: %w", err)
     }
     
-    p.logger.Printf("Results saved to %s", filename)
+    log.Printf("Results saved to %s", filename)
     return nil
 }
 
-// GetResults returns the processing results
-func (p *RepositoryProcessor) GetResults() map[string]*ProcessingResult {
-    return p.results
+// Results returns a copy of the run's per-repository results
+func (r *Run) Results() map[string]*ProcessingResult {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    results := make(map[string]*ProcessingResult, len(r.results))
+    for repoURL, result := range r.results {
+        results[repoURL] = result
+    }
+    return results
+}
+
+// Repositories returns the run's repository URLs in processing order
+func (r *Run) Repositories() []string {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    return append([]string(nil), r.order...)
 }
 
-// GetStats returns the aggregate statistics
-func (p *RepositoryProcessor) GetStats() ProcessingStats {
-    return p.totalStats
+// Stats returns the run's aggregate statistics
+func (r *Run) Stats() ProcessingStats {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    return r.statsLocked()
 }
 
 // helper function to join strings
@@ -0,0 +1,141 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "net"
+    "net/http"
+    "net/http/pprof"
+    "os"
+    "runtime"
+    runtimepprof "runtime/pprof"
+    "sync"
+)
+
+// Profile file name templates, expanded in the run's artifacts directory
+const (
+    cpuProfileTemplate  = "cpu-{run_id}.pprof"
+    heapProfileTemplate = "heap-{run_id}.pprof"
+)
+
+// ProfilingConfig enables profiling long runs
+type ProfilingConfig struct {
+    // Addr is the address net/http/pprof is served on, e.g. ":6060" or
+    // "localhost:6060"; empty disables it
+    Addr string `json:"addr,omitempty"`
+    // CPU profiles the whole run and Heap snapshots the heap at its end,
+    // into the run's artifacts directory
+    CPU  bool `json:"cpu,omitempty"`
+    Heap bool `json:"heap,omitempty"`
+}
+
+// Profiler serves pprof and writes the profiles of one run
+type Profiler struct {
+    config    ProfilingConfig
+    artifacts *RunArtifacts
+    server    *http.Server
+    cpuFile   *os.File
+    logger    *log.Logger
+    stopOnce  sync.Once
+    stopErr   error
+}
+
+// StartProfiling starts the pprof server and the CPU profile as
+// configured. artifacts may be nil when the caller has no run, such as
+// service mode; profiles are then not written.
+func StartProfiling(config ProfilingConfig, artifacts *RunArtifacts) (*Profiler, error) {
+    p := &Profiler{
+        config:    config,
+        artifacts: artifacts,
+        logger:    log.New(logOutput, "[PROFILING] ", log.LstdFlags|log.Lshortfile),
+    }
+
+    if config.Addr != "" {
+        // Listen up front so a taken port fails the start
+        listener, err := net.Listen("tcp", config.Addr)
+        if err != nil {
+            return nil, fmt.Errorf("failed to listen for pprof on %s: %w", config.Addr, err)
+        }
+        mux := http.NewServeMux()
+        mux.HandleFunc("/debug/pprof/", pprof.Index)
+        mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+        mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+        mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+        mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+        p.server = &http.Server{Handler: mux}
+        go func() {
+            if err := p.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+                p.logger.Printf("pprof server failed: %v", err)
+            }
+        }()
+        p.logger.Printf("Serving pprof on http://%s/debug/pprof/", listener.Addr())
+    }
+
+    if config.CPU && artifacts != nil {
+        path, err := artifacts.Path(cpuProfileTemplate)
+        if err != nil {
+            p.Stop()
+            return nil, fmt.Errorf("failed to create CPU profile: %w", err)
+        }
+        file, err := os.Create(path)
+        if err != nil {
+            p.Stop()
+            return nil, fmt.Errorf("failed to create CPU profile: %w", err)
+        }
+        if err := runtimepprof.StartCPUProfile(file); err != nil {
+            file.Close()
+            p.Stop()
+            return nil, fmt.Errorf("failed to start CPU profile: %w", err)
+        }
+        p.cpuFile = file
+    }
+    return p, nil
+}
+
+// Stop ends the CPU profile, writes the heap profile and shuts the pprof
+// server down. Only the first call has an effect.
+func (p *Profiler) Stop() error {
+    p.stopOnce.Do(func() {
+        if p.cpuFile != nil {
+            runtimepprof.StopCPUProfile()
+            if err := p.cpuFile.Close(); err != nil {
+                p.stopErr = fmt.Errorf("failed to write CPU profile: %w", err)
+            } else {
+                p.logger.Printf("Wrote CPU profile to %s", p.cpuFile.Name())
+            }
+        }
+        if p.config.Heap && p.artifacts != nil {
+            if err := p.writeHeapProfile(); err != nil && p.stopErr == nil {
+                p.stopErr = err
+            }
+        }
+        if p.server != nil {
+            p.server.Close()
+        }
+    })
+    return p.stopErr
+}
+
+// writeHeapProfile writes a heap profile reflecting the last collection
+func (p *Profiler) writeHeapProfile() error {
+    path, err := p.artifacts.Path(heapProfileTemplate)
+    if err != nil {
+        return fmt.Errorf("failed to create heap profile: %w", err)
+    }
+    file, err := os.Create(path)
+    if err != nil {
+        return fmt.Errorf("failed to create heap profile: %w", err)
+    }
+    // Collect first so the profile reflects live memory at the end of the run
+    runtime.GC()
+    if err := runtimepprof.Lookup("heap").WriteTo(file, 0); err != nil {
+        file.Close()
+        return fmt.Errorf("failed to write heap profile: %w", err)
+    }
+    if err := file.Close(); err != nil {
+        return fmt.Errorf("failed to write heap profile: %w", err)
+    }
+    p.logger.Printf("Wrote heap profile to %s", path)
+    return nil
+}
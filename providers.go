@@ -0,0 +1,227 @@
+package main
+
+import (
+    "crypto/tls"
+    "crypto/x509"
+    "fmt"
+    "log"
+    "net"
+    "net/http"
+    "net/url"
+    "os"
+    "os/exec"
+    "strings"
+    "time"
+
+    "github.com/go-git/go-git/v5/plumbing/transport/client"
+    githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// githubAPIURL is the API of github.com; other hosts need a configured one
+const githubAPIURL = "https://api.github.com"
+
+// ProvidersConfig configures access to git hosting providers, such as a
+// GitHub Enterprise Server behind an internal CA
+type ProvidersConfig struct {
+    // CABundle is a PEM file of CA certificates trusted, in addition to the
+    // system roots, for clones, pushes and provider API calls
+    CABundle string `json:"ca_bundle,omitempty"`
+    // InsecureSkipVerify disables TLS certificate verification towards
+    // providers. Anyone on the network path can then impersonate them; use
+    // it only to diagnose certificate problems.
+    InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+    // APIURLs maps provider hosts to their API base URL, e.g.
+    // "ghe.example.com": "https://ghe.example.com/api/v3"; a host may carry
+    // the port the doctor checks TLS on
+    APIURLs map[string]string `json:"api_urls,omitempty"`
+    // GitTransport selects how repositories are cloned and checked out:
+    // "go-git" (default) or "git", the git CLI
+    GitTransport string `json:"git_transport,omitempty"`
+    // CloneFilter is a partial clone filter for the git transport, e.g.
+    // "blob:none" to download file contents only when checked out
+    CloneFilter string `json:"clone_filter,omitempty"`
+}
+
+// providers is the configuration installed by ConfigureProviders, and
+// providerTransport the HTTP transport built from it
+var (
+    providers         ProvidersConfig
+    providerTransport http.RoundTripper = http.DefaultTransport
+)
+
+// providerTLSConfig builds the TLS configuration for providers, or returns
+// nil when the defaults apply
+func providerTLSConfig(config ProvidersConfig) (*tls.Config, error) {
+    if config.CABundle == "" && !config.InsecureSkipVerify {
+        return nil, nil
+    }
+    tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+    if config.CABundle != "" {
+        pem, err := os.ReadFile(config.CABundle)
+        if err != nil {
+            return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+        }
+        roots, err := x509.SystemCertPool()
+        if err != nil {
+            roots = x509.NewCertPool()
+        }
+        if !roots.AppendCertsFromPEM(pem) {
+            return nil, fmt.Errorf("CA bundle %s contains no PEM certificates", config.CABundle)
+        }
+        tlsConfig.RootCAs = roots
+    }
+    return tlsConfig, nil
+}
+
+// validateProviders checks the CA bundle, API base URLs and git transport
+func validateProviders(config ProvidersConfig) error {
+    if _, err := providerTLSConfig(config); err != nil {
+        return err
+    }
+    switch config.GitTransport {
+    case "", gitTransportGoGit:
+        if config.CloneFilter != "" {
+            return fmt.Errorf("clone filters need the git transport, go-git does not support partial clones")
+        }
+    case gitTransportCLI:
+        if _, err := exec.LookPath("git"); err != nil {
+            return fmt.Errorf("the git transport needs the git CLI: %w", err)
+        }
+    default:
+        return fmt.Errorf("git transport must be %s or %s, got %q", gitTransportGoGit, gitTransportCLI, config.GitTransport)
+    }
+    for host, apiURL := range config.APIURLs {
+        u, err := url.Parse(apiURL)
+        if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+            return fmt.Errorf("API URL of %s must be an http(s) URL, got %q", host, apiURL)
+        }
+    }
+    return nil
+}
+
+// ConfigureProviders applies the provider configuration to everything that
+// talks to providers: go-git clones and pushes, the git CLI, which reads
+// GIT_SSL_CAINFO and GIT_SSL_NO_VERIFY from the environment it inherits,
+// and provider API calls
+func ConfigureProviders(config ProvidersConfig) error {
+    tlsConfig, err := providerTLSConfig(config)
+    if err != nil {
+        return err
+    }
+    providers = config
+    if tlsConfig == nil {
+        return nil
+    }
+
+    transport := http.DefaultTransport.(*http.Transport).Clone()
+    transport.TLSClientConfig = tlsConfig
+    providerTransport = transport
+    gitTransport := githttp.NewClient(&http.Client{Transport: transport})
+    client.InstallProtocol("https", gitTransport)
+    client.InstallProtocol("http", gitTransport)
+
+    if config.CABundle != "" {
+        os.Setenv("GIT_SSL_CAINFO", config.CABundle)
+    }
+    if config.InsecureSkipVerify {
+        os.Setenv("GIT_SSL_NO_VERIFY", "true")
+        warnInsecureProviders()
+    }
+    return nil
+}
+
+// warnInsecureProviders announces disabled certificate verification on
+// stderr and in the log, so it is not left enabled unnoticed
+func warnInsecureProviders() {
+    banner := strings.Repeat("!", 72)
+    fmt.Fprintf(os.Stderr, "%s\n!! WARNING: TLS certificate verification is DISABLED for git providers.\n"+
+        "!! Clones and API calls can be intercepted. Configure providers.ca_bundle\n"+
+        "!! instead of providers.insecure_skip_verify.\n%s\n", banner, banner)
+    log.New(logOutput, "[PROVIDERS] ", log.LstdFlags|log.Lshortfile).
+        Println("WARNING: TLS certificate verification is disabled for git providers")
+}
+
+// providerHTTPClient returns a client for provider API calls
+func providerHTTPClient(timeout time.Duration) *http.Client {
+    return &http.Client{Transport: providerTransport, Timeout: timeout}
+}
+
+// providerAPIURL returns the API base URL of a provider host, or "" if it
+// has none
+func providerAPIURL(host string) string {
+    for configured, apiURL := range providers.APIURLs {
+        if name, _, err := net.SplitHostPort(configured); err == nil {
+            configured = name
+        }
+        if strings.EqualFold(configured, host) {
+            return strings.TrimSuffix(apiURL, "/")
+        }
+    }
+    if host == "github.com" {
+        return githubAPIURL
+    }
+    return ""
+}
+
+// providerToken returns the API token for a provider host: GITHUB_TOKEN for
+// github.com and GH_ENTERPRISE_TOKEN for configured enterprise hosts, so
+// neither is sent to the other
+func providerToken(host string) string {
+    if host == "github.com" {
+        return os.Getenv("GITHUB_TOKEN")
+    }
+    return os.Getenv("GH_ENTERPRISE_TOKEN")
+}
+
+// repositorySlug returns the owner/name path of a repository URL, for
+// https URLs as well as scp-like git@host:owner/name addresses
+func repositorySlug(repoURL string) string {
+    slug := ""
+    if u, err := url.Parse(repoURL); err == nil && u.Host != "" {
+        slug = u.Path
+    } else if at := strings.Index(repoURL, "@"); at >= 0 {
+        if colon := strings.Index(repoURL[at:], ":"); colon >= 0 {
+            slug = repoURL[at+colon+1:]
+        }
+    }
+    return strings.TrimSuffix(strings.Trim(slug, "/"), ".git")
+}
+
+// checkProviderTLS connects to a provider host and verifies its certificate
+// against the configured CAs
+func checkProviderTLS(host string) DoctorCheck {
+    check := DoctorCheck{Name: "tls " + host}
+    tlsConfig, err := providerTLSConfig(providers)
+    if err != nil {
+        check.Detail = err.Error()
+        return check
+    }
+    if tlsConfig == nil {
+        tlsConfig = &tls.Config{}
+    }
+    if tlsConfig.InsecureSkipVerify {
+        check.Detail = "⚠️  certificate verification disabled"
+        check.Passed = true
+        return check
+    }
+
+    address := host
+    if _, _, err := net.SplitHostPort(host); err != nil {
+        address = net.JoinHostPort(host, "443")
+    }
+    dialer := &net.Dialer{Timeout: 5 * time.Second}
+    conn, err := tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+    if err != nil {
+        check.Detail = err.Error()
+        check.Hint = "set providers.ca_bundle (FLOQ_CA_BUNDLE) to the PEM file of the CA that signed the host's certificate"
+        return check
+    }
+    defer conn.Close()
+    certs := conn.ConnectionState().PeerCertificates
+    check.Detail = "certificate verified"
+    if len(certs) > 0 {
+        check.Detail = "issued by " + certs[0].Issuer.CommonName
+    }
+    check.Passed = true
+    return check
+}
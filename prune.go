@@ -0,0 +1,464 @@
+package main
+
+import (
+    "database/sql"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "log"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/lib/pq"
+)
+
+// generatedTableMarker starts the comment of every table generated from a
+// function's output; see tableComment
+const generatedTableMarker = "Generated by floq-v1"
+
+// PruneOptions selects the data the prune command removes
+type PruneOptions struct {
+    // KeepRuns removes the rows of all but the most recent KeepRuns runs
+    // from the fixed tables; 0 keeps every run
+    KeepRuns int
+    // OlderThan removes the rows of the fixed tables written more than
+    // this long ago, and finished jobs; 0 keeps every row
+    OlderThan time.Duration
+    // Orphans drops generated tables whose function no longer exists
+    Orphans bool
+    // DryRun only reports what would be removed
+    DryRun bool
+}
+
+// OrphanedTable is a generated table left behind by a function that no
+// longer exists
+type OrphanedTable struct {
+    Table      string `json:"table"`
+    Repository string `json:"repository"`
+    Function   string `json:"function,omitempty"`
+    Ref        string `json:"ref,omitempty"`
+    Run        string `json:"run"`
+    Reason     string `json:"reason"`
+}
+
+// PruneReport lists what was removed from one database, or with a dry run
+// what would be
+type PruneReport struct {
+    Database string `json:"database"`
+    DryRun   bool   `json:"dry_run"`
+    // Runs are the runs whose rows were removed to keep the newest ones
+    Runs []string `json:"runs,omitempty"`
+    // Rows counts the removed rows per fixed table
+    Rows   map[string]int64 `json:"rows"`
+    Tables []OrphanedTable  `json:"tables,omitempty"`
+}
+
+// RunPrune implements the prune subcommand: it removes old rows from the
+// fixed tables and drops orphaned generated tables in the primary database
+// and every shard
+func RunPrune(config Config, args []string, out io.Writer) error {
+    fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+    keepRuns := fs.Int("runs", 0, "keep the rows of only this many most recent runs")
+    days := fs.Int("days", 0, "remove rows older than this many days")
+    orphans := fs.Bool("orphans", false, "drop generated tables whose function no longer exists")
+    dryRun := fs.Bool("dry-run", false, "only show what would be removed")
+    asJSON := fs.Bool("json", false, "print the reports as JSON")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+    if *keepRuns < 0 || *days < 0 {
+        return fmt.Errorf("-runs and -days must not be negative")
+    }
+    if *keepRuns == 0 && *days == 0 && !*orphans {
+        return fmt.Errorf("usage: prune [-runs n] [-days n] [-orphans] [-dry-run] [-json]")
+    }
+    if config.Driver != "" && config.Driver != DriverPostgres {
+        return fmt.Errorf("prune needs the %s driver", DriverPostgres)
+    }
+
+    options := PruneOptions{
+        KeepRuns:  *keepRuns,
+        OlderThan: time.Duration(*days) * 24 * time.Hour,
+        Orphans:   *orphans,
+        DryRun:    *dryRun,
+    }
+    pruner := &pruner{
+        options:   options,
+        artifacts: config.Artifacts,
+        results:   make(map[string]*RunResults),
+        logger:    log.New(logOutput, "[PRUNE] ", log.LstdFlags|log.Lshortfile),
+    }
+
+    targets := map[string]DatabaseConfig{"primary": config.DatabaseConfig}
+    names := []string{"primary"}
+    for i := range config.Shards {
+        targets[config.shardName(i)] = config.shardDatabase(i)
+        names = append(names, config.shardName(i))
+    }
+
+    var reports []PruneReport
+    for _, name := range names {
+        db, err := openDatabase(targets[name])
+        if err != nil {
+            return fmt.Errorf("failed to open database %s: %w", name, err)
+        }
+        report, err := pruner.prune(db)
+        db.Close()
+        if err != nil {
+            return fmt.Errorf("failed to prune database %s: %w", name, err)
+        }
+        report.Database = name
+        reports = append(reports, *report)
+    }
+
+    if *asJSON {
+        encoder := json.NewEncoder(out)
+        encoder.SetIndent("", "  ")
+        return encoder.Encode(reports)
+    }
+    for _, report := range reports {
+        printPruneReport(out, report)
+    }
+    return nil
+}
+
+// printPruneReport prints what was removed from one database
+func printPruneReport(out io.Writer, report PruneReport) {
+    verb := "Removed"
+    if report.DryRun {
+        verb = "Would remove"
+    }
+    fmt.Fprintf(out, "🧹 PRUNE %s\n", strings.ToUpper(report.Database))
+    fmt.Fprintln(out, strings.Repeat("=", 60))
+    if len(report.Runs) > 0 {
+        fmt.Fprintf(out, "%s the rows of %d runs: %s\n", verb, len(report.Runs), strings.Join(report.Runs, ", "))
+    }
+    tables := make([]string, 0, len(report.Rows))
+    for table := range report.Rows {
+        tables = append(tables, table)
+    }
+    sort.Strings(tables)
+    for _, table := range tables {
+        fmt.Fprintf(out, "%s %d rows from %s\n", verb, report.Rows[table], table)
+    }
+    for _, table := range report.Tables {
+        fmt.Fprintf(out, "%s table %s (%s): %s\n", verb, table.Table, table.Repository, table.Reason)
+    }
+    if len(tables) == 0 && len(report.Tables) == 0 {
+        fmt.Fprintln(out, "Nothing to prune")
+    }
+    fmt.Fprintln(out)
+}
+
+// pruner removes data from the databases of one prune command
+type pruner struct {
+    options   PruneOptions
+    artifacts ArtifactsConfig
+    // results caches the results files of runs, nil when unavailable
+    results map[string]*RunResults
+    logger  *log.Logger
+}
+
+// prune removes the selected data from one database in a single
+// transaction. A dry run counts the rows the same statements would
+// delete, and rolls back.
+func (p *pruner) prune(db *sql.DB) (*PruneReport, error) {
+    report := &PruneReport{DryRun: p.options.DryRun, Rows: make(map[string]int64)}
+
+    tx, err := db.Begin()
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback()
+
+    existing := make(map[string]bool)
+    for _, table := range []string{functionOutputsTable.Name, vulnerabilitiesTable, payloadStatsTable, signaturesTable, jobsTable.Name, "floq_payloads", "floq_column_mappings"} {
+        var exists bool
+        if err := tx.QueryRow("SELECT to_regclass($1) IS NOT NULL", table).Scan(&exists); err != nil {
+            return nil, fmt.Errorf("failed to look up table %s: %w", table, err)
+        }
+        existing[table] = exists
+    }
+
+    if p.options.KeepRuns > 0 || p.options.OlderThan > 0 {
+        if err := p.pruneRows(tx, existing, report); err != nil {
+            return nil, err
+        }
+    }
+    if p.options.Orphans {
+        if err := p.dropOrphans(tx, existing, report); err != nil {
+            return nil, err
+        }
+    }
+
+    if !p.options.DryRun {
+        if err := tx.Commit(); err != nil {
+            return nil, fmt.Errorf("failed to commit: %w", err)
+        }
+    }
+    return report, nil
+}
+
+// pruneRows removes the rows of old runs from the fixed tables, then the
+// payloads no remaining output references
+func (p *pruner) pruneRows(tx *sql.Tx, existing map[string]bool, report *PruneReport) error {
+    // Runs are ordered by their last write, since service run ids do not
+    // sort chronologically
+    var runTables []string
+    for _, table := range []string{functionOutputsTable.Name, vulnerabilitiesTable, payloadStatsTable, signaturesTable} {
+        if existing[table] {
+            runTables = append(runTables, "SELECT run_id, created_at FROM "+table)
+        }
+    }
+    if p.options.KeepRuns > 0 && len(runTables) > 0 {
+        rows, err := tx.Query(fmt.Sprintf(
+            "SELECT run_id FROM (%s) AS written WHERE run_id IS NOT NULL GROUP BY run_id ORDER BY max(created_at) DESC OFFSET $1",
+            strings.Join(runTables, " UNION ALL ")), p.options.KeepRuns)
+        if err != nil {
+            return fmt.Errorf("failed to list runs: %w", err)
+        }
+        for rows.Next() {
+            var run string
+            if err := rows.Scan(&run); err != nil {
+                rows.Close()
+                return fmt.Errorf("failed to list runs: %w", err)
+            }
+            report.Runs = append(report.Runs, run)
+        }
+        rows.Close()
+        if err := rows.Err(); err != nil {
+            return fmt.Errorf("failed to list runs: %w", err)
+        }
+        sort.Strings(report.Runs)
+    }
+
+    var cutoff interface{}
+    if p.options.OlderThan > 0 {
+        cutoff = time.Now().Add(-p.options.OlderThan)
+    }
+    // expired matches the rows of pruned runs and rows past the cutoff
+    const expired = "COALESCE(run_id = ANY($1) OR created_at < $2::timestamptz, false)"
+    runs := pq.Array(report.Runs)
+
+    steps := []struct {
+        table string
+        where string
+        args  []interface{}
+    }{
+        {functionOutputsTable.Name, expired, []interface{}{runs, cutoff}},
+        // Payloads go once every output referencing them does
+        {"floq_payloads", fmt.Sprintf(
+            "NOT EXISTS (SELECT 1 FROM %s AS o WHERE o.payload_hash = floq_payloads.hash AND NOT %s)",
+            functionOutputsTable.Name, strings.ReplaceAll(strings.ReplaceAll(expired, "run_id", "o.run_id"), "created_at", "o.created_at")),
+            []interface{}{runs, cutoff}},
+        {vulnerabilitiesTable, expired, []interface{}{runs, cutoff}},
+        {payloadStatsTable, expired, []interface{}{runs, cutoff}},
+        {signaturesTable, expired, []interface{}{runs, cutoff}},
+    }
+    if cutoff != nil {
+        steps = append(steps, struct {
+            table string
+            where string
+            args  []interface{}
+        }{jobsTable.Name, "status IN ($1, $2) AND finished_at < $3", []interface{}{JobSucceeded, JobFailed, cutoff}})
+    }
+
+    for _, step := range steps {
+        if !existing[step.table] || (step.table == "floq_payloads" && !existing[functionOutputsTable.Name]) {
+            continue
+        }
+        count, err := p.deleteRows(tx, step.table, step.where, step.args...)
+        if err != nil {
+            return err
+        }
+        if count > 0 {
+            report.Rows[step.table] = count
+        }
+    }
+    return nil
+}
+
+// deleteRows deletes the rows of a table matching where, or in a dry run
+// counts them, and returns how many matched
+func (p *pruner) deleteRows(tx *sql.Tx, table, where string, args ...interface{}) (int64, error) {
+    if p.options.DryRun {
+        var count int64
+        if err := tx.QueryRow(fmt.Sprintf("SELECT count(*) FROM %s WHERE %s", table, where), args...).Scan(&count); err != nil {
+            return 0, fmt.Errorf("failed to count rows of %s: %w", table, err)
+        }
+        return count, nil
+    }
+
+    res, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", table, where), args...)
+    if err != nil {
+        return 0, fmt.Errorf("failed to delete rows of %s: %w", table, err)
+    }
+    count, err := res.RowsAffected()
+    if err != nil {
+        return 0, fmt.Errorf("failed to delete rows of %s: %w", table, err)
+    }
+    p.logger.Printf("Deleted %d rows from %s", count, table)
+    return count, nil
+}
+
+// generatedTable is a table generated from a function's output, described
+// by its comment
+type generatedTable struct {
+    name       string
+    repository string
+    function   string
+    ref        string
+    run        string
+}
+
+// dropOrphans drops the generated tables the latest run of their
+// repository did not regenerate, unless that run's results file shows the
+// function still exists, along with their column mappings
+func (p *pruner) dropOrphans(tx *sql.Tx, existing map[string]bool, report *PruneReport) error {
+    tables, err := listGeneratedTables(tx)
+    if err != nil {
+        return err
+    }
+
+    // Every checkout of a repository regenerates the tables of all its
+    // functions, so a table from an earlier run than the latest one of
+    // its repository and ref was left behind. Tables are listed in
+    // creation order, so the last one seen belongs to the latest run.
+    latest := make(map[string]string)
+    for _, table := range tables {
+        if table.run != "" {
+            latest[table.repository+"@"+table.ref] = table.run
+        }
+    }
+
+    for _, table := range tables {
+        run := latest[table.repository+"@"+table.ref]
+        if table.run == "" || table.run == run || table.repository == "" {
+            continue
+        }
+        reason := fmt.Sprintf("not regenerated by run %s", run)
+        if results := p.runResults(run); results != nil {
+            result, ok := results.Results[table.repository]
+            if ok && catalogues(result, table.function) {
+                continue
+            }
+            if ok {
+                reason = fmt.Sprintf("%s no longer exists in run %s", table.function, run)
+            }
+        }
+
+        report.Tables = append(report.Tables, OrphanedTable{
+            Table:      table.name,
+            Repository: table.repository,
+            Function:   table.function,
+            Ref:        table.ref,
+            Run:        table.run,
+            Reason:     reason,
+        })
+        if p.options.DryRun {
+            continue
+        }
+        if _, err := tx.Exec("DROP TABLE " + quoteIdentifier(table.name)); err != nil {
+            return fmt.Errorf("failed to drop table %s: %w", table.name, err)
+        }
+        p.logger.Printf("Dropped orphaned table %s of %s", table.name, table.repository)
+    }
+
+    if existing["floq_column_mappings"] && len(report.Tables) > 0 {
+        names := make([]string, len(report.Tables))
+        for i, table := range report.Tables {
+            names[i] = table.Table
+        }
+        count, err := p.deleteRows(tx, "floq_column_mappings", "table_name = ANY($1)", pq.Array(names))
+        if err != nil {
+            return err
+        }
+        if count > 0 {
+            report.Rows["floq_column_mappings"] = count
+        }
+    }
+    return nil
+}
+
+// listGeneratedTables returns the generated tables of the current schema
+// in creation order
+func listGeneratedTables(tx *sql.Tx) ([]generatedTable, error) {
+    rows, err := tx.Query(`SELECT c.relname, obj_description(c.oid, 'pg_class')
+        FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+        WHERE n.nspname = current_schema() AND c.relkind IN ('r', 'p')
+        AND obj_description(c.oid, 'pg_class') LIKE $1
+        ORDER BY c.oid`, generatedTableMarker+"%")
+    if err != nil {
+        return nil, fmt.Errorf("failed to list generated tables: %w", err)
+    }
+    defer rows.Close()
+
+    var tables []generatedTable
+    for rows.Next() {
+        var name, comment string
+        if err := rows.Scan(&name, &comment); err != nil {
+            return nil, fmt.Errorf("failed to list generated tables: %w", err)
+        }
+        tables = append(tables, parseTableComment(name, comment))
+    }
+    return tables, rows.Err()
+}
+
+// parseTableComment recovers a generated table's provenance from the
+// comment written by tableComment
+func parseTableComment(name, comment string) generatedTable {
+    table := generatedTable{name: name}
+    for _, line := range strings.Split(comment, "\n") {
+        key, value, ok := strings.Cut(line, ": ")
+        if !ok {
+            continue
+        }
+        switch key {
+        case "Repository":
+            table.repository = value
+        case "Function":
+            // "pkg.func Name(params) results"
+            if _, signature, ok := strings.Cut(value, "func "); ok {
+                table.function, _, _ = strings.Cut(signature, "(")
+            }
+        case "Ref":
+            table.ref, _, _ = strings.Cut(value, " (")
+        case "Run":
+            table.run = value
+        }
+    }
+    return table
+}
+
+// runResults returns the results file of a run from the artifacts
+// directory, or nil when it is not available
+func (p *pruner) runResults(run string) *RunResults {
+    if results, ok := p.results[run]; ok {
+        return results
+    }
+    var results *RunResults
+    artifacts, err := OpenRunArtifacts(p.artifacts, run)
+    if err == nil {
+        var path string
+        if path, err = artifacts.ResultsPath(); err == nil {
+            results, err = LoadResultsFile(path)
+        }
+    }
+    if err != nil {
+        p.logger.Printf("Results of run %s unavailable, judging its tables by run alone: %v", run, err)
+    }
+    p.results[run] = results
+    return results
+}
+
+// catalogues reports whether a repository's result lists a function
+func catalogues(result *ProcessingResult, function string) bool {
+    for _, processed := range result.ProcessedFunctions {
+        if processed.Name == function {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/csv"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "strings"
+    "text/tabwriter"
+    "time"
+)
+
+// Query output formats
+const (
+    QueryTable = "table"
+    QueryJSON  = "json"
+    QueryCSV   = "csv"
+)
+
+// RunQuery implements the query subcommand: it runs one SQL statement in
+// a read-only transaction against the read replica when one is configured,
+// or the primary otherwise, and writes the rows to out
+func RunQuery(config Config, args []string, out io.Writer) error {
+    fs := flag.NewFlagSet("query", flag.ContinueOnError)
+    format := fs.String("format", QueryTable, "output format: table, json, or csv")
+    file := fs.String("f", "", "read the statement from this file")
+    shard := fs.String("shard", "", "query this database shard instead of the primary database")
+    primary := fs.Bool("primary", false, "query the primary even when a read replica is configured")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+    if *format != QueryTable && *format != QueryJSON && *format != QueryCSV {
+        return fmt.Errorf("unsupported query format %q", *format)
+    }
+    if config.Driver != "" && config.Driver != DriverPostgres {
+        return fmt.Errorf("query needs the %s driver", DriverPostgres)
+    }
+
+    statement := strings.Join(fs.Args(), " ")
+    if *file != "" {
+        data, err := os.ReadFile(*file)
+        if err != nil {
+            return fmt.Errorf("failed to read query: %w", err)
+        }
+        statement = string(data)
+    }
+    if strings.TrimSpace(statement) == "" {
+        return fmt.Errorf("usage: query [-format table|json|csv] [-shard name] [-primary] (-f file | <statement>)")
+    }
+
+    target := config.DatabaseConfig
+    if *shard != "" {
+        found := false
+        for i := range config.Shards {
+            if config.shardName(i) == *shard {
+                target, found = config.shardDatabase(i), true
+                break
+            }
+        }
+        if !found {
+            return fmt.Errorf("unknown database shard %q", *shard)
+        }
+    }
+    if *primary {
+        target.ReplicaDSN = ""
+    }
+
+    db, replica, err := openReadDatabase(target)
+    if err != nil {
+        return fmt.Errorf("failed to open database connection: %w", err)
+    }
+    defer db.Close()
+    logger := log.New(logOutput, "[QUERY] ", log.LstdFlags|log.Lshortfile)
+    if replica {
+        logger.Println("Querying the read replica")
+    } else {
+        logger.Println("Querying the primary database")
+    }
+
+    columns, rows, err := queryReadOnly(db, statement)
+    if err != nil {
+        return err
+    }
+    switch *format {
+    case QueryJSON:
+        return writeQueryJSON(out, columns, rows)
+    case QueryCSV:
+        return writeQueryCSV(out, columns, rows)
+    }
+    return writeQueryTable(out, columns, rows)
+}
+
+// queryReadOnly runs statement in a read-only transaction, so it cannot
+// change data even on the primary, and returns the column names and rows
+func queryReadOnly(db *sql.DB, statement string) ([]string, [][]interface{}, error) {
+    ctx := context.Background()
+    tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to start read-only transaction: %w", err)
+    }
+    defer tx.Rollback()
+
+    result, err := tx.QueryContext(ctx, statement)
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to run query: %w", err)
+    }
+    defer result.Close()
+
+    columns, err := result.Columns()
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to read columns: %w", err)
+    }
+    var rows [][]interface{}
+    for result.Next() {
+        values := make([]interface{}, len(columns))
+        pointers := make([]interface{}, len(columns))
+        for i := range values {
+            pointers[i] = &values[i]
+        }
+        if err := result.Scan(pointers...); err != nil {
+            return nil, nil, fmt.Errorf("failed to scan row: %w", err)
+        }
+        // Text and JSON columns arrive as bytes
+        for i, value := range values {
+            if b, ok := value.([]byte); ok {
+                values[i] = string(b)
+            }
+        }
+        rows = append(rows, values)
+    }
+    if err := result.Err(); err != nil {
+        return nil, nil, fmt.Errorf("failed to run query: %w", err)
+    }
+    return columns, rows, nil
+}
+
+// formatQueryValue renders a column value for table and CSV output
+func formatQueryValue(value interface{}) string {
+    switch v := value.(type) {
+    case nil:
+        return ""
+    case time.Time:
+        return v.Format(time.RFC3339)
+    }
+    return fmt.Sprint(value)
+}
+
+// writeQueryTable writes the rows as aligned columns under a header
+func writeQueryTable(out io.Writer, columns []string, rows [][]interface{}) error {
+    w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, strings.Join(columns, "\t"))
+    for _, row := range rows {
+        cells := make([]string, len(row))
+        for i, value := range row {
+            // Tabs and newlines would break the alignment
+            cells[i] = strings.NewReplacer("\t", " ", "\n", " ").Replace(formatQueryValue(value))
+        }
+        fmt.Fprintln(w, strings.Join(cells, "\t"))
+    }
+    if err := w.Flush(); err != nil {
+        return err
+    }
+    fmt.Fprintf(os.Stderr, "(%d rows)\n", len(rows))
+    return nil
+}
+
+// writeQueryCSV writes the rows as CSV with a header record
+func writeQueryCSV(out io.Writer, columns []string, rows [][]interface{}) error {
+    w := csv.NewWriter(out)
+    if err := w.Write(columns); err != nil {
+        return err
+    }
+    for _, row := range rows {
+        record := make([]string, len(row))
+        for i, value := range row {
+            record[i] = formatQueryValue(value)
+        }
+        if err := w.Write(record); err != nil {
+            return err
+        }
+    }
+    w.Flush()
+    return w.Error()
+}
+
+// writeQueryJSON writes the rows as a JSON array of objects keyed by column
+func writeQueryJSON(out io.Writer, columns []string, rows [][]interface{}) error {
+    records := make([]map[string]interface{}, len(rows))
+    for i, row := range rows {
+        records[i] = make(map[string]interface{}, len(columns))
+        for j, column := range columns {
+            records[i][column] = row[j]
+        }
+    }
+    encoder := json.NewEncoder(out)
+    encoder.SetIndent("", "  ")
+    return encoder.Encode(records)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+    "fmt"
+    "go/ast"
+    "go/scanner"
+    "go/token"
+)
+
+// ParseDiagnostic is a syntax error reported while parsing a file
+type ParseDiagnostic struct {
+    File    string `json:"file"`
+    Line    int    `json:"line"`
+    Column  int    `json:"column"`
+    Message string `json:"message"`
+    // URL shows the line on the repository's provider, when it is known
+    URL     string `json:"url,omitempty"`
+}
+
+// PartialParseError reports a file that had syntax errors but from which
+// the declarations unaffected by them were still extracted
+type PartialParseError struct {
+    File        string
+    Diagnostics []ParseDiagnostic
+    Skipped     int
+}
+
+func (e *PartialParseError) Error() string {
+    return fmt.Sprintf("partially extracted %s: %d parse errors, %d declarations skipped",
+        e.File, len(e.Diagnostics), e.Skipped)
+}
+
+// parseDiagnostics converts a parser error list into diagnostics relative to
+// the repository
+func parseDiagnostics(relPath string, errs scanner.ErrorList) []ParseDiagnostic {
+    diagnostics := make([]ParseDiagnostic, 0, len(errs))
+    for _, e := range errs {
+        diagnostics = append(diagnostics, ParseDiagnostic{
+            File:    relPath,
+            Line:    e.Pos.Line,
+            Column:  e.Pos.Column,
+            Message: e.Msg,
+        })
+    }
+    return diagnostics
+}
+
+// declAffected reports whether the declaration at index i of file is
+// affected by one of the errors, in which case its extracted signature
+// cannot be trusted. Errors between two declarations (such as a missing
+// closing brace reported at the end of the file) are attributed to the
+// preceding declaration.
+func declAffected(fset *token.FileSet, file *ast.File, i int, errs scanner.ErrorList) bool {
+    start := fset.Position(file.Decls[i].Pos()).Offset
+    end := -1
+    if i+1 < len(file.Decls) {
+        end = fset.Position(file.Decls[i+1].Pos()).Offset
+    }
+    for _, e := range errs {
+        if e.Pos.Offset >= start && (end < 0 || e.Pos.Offset < end) {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+    "context"
+    "os"
+    "os/signal"
+    "path/filepath"
+    "reflect"
+    "syscall"
+    "time"
+
+    "github.com/fsnotify/fsnotify"
+)
+
+// configSettleDelay is how long the config file must go without changes
+// before it is reloaded, so a file written in several steps is read once
+const configSettleDelay = 500 * time.Millisecond
+
+// restartRequired lists the settings that differ between two configurations
+// but only take effect on restart: the database connection, the listen
+// address and token, the state directory, interactive mode, and provider TLS
+func restartRequired(current, next Config) []string {
+    var changed []string
+    if !reflect.DeepEqual(current.DatabaseConfig, next.DatabaseConfig) {
+        changed = append(changed, "database")
+    }
+    if current.Service.ListenAddr != next.Service.ListenAddr {
+        changed = append(changed, "service.listen_addr")
+    }
+    if current.Service.Token != next.Service.Token {
+        changed = append(changed, "service.token")
+    }
+    if current.State != next.State {
+        changed = append(changed, "state.dir")
+    }
+    if current.Execution.Interactive != next.Execution.Interactive {
+        changed = append(changed, "execution.interactive")
+    }
+    if !reflect.DeepEqual(current.Providers, next.Providers) {
+        changed = append(changed, "providers")
+    }
+    return changed
+}
+
+// reloadable copies the settings that require a restart from current into
+// next, so only the safe-to-change settings of next take effect
+func reloadable(current, next Config) Config {
+    next.DatabaseConfig = current.DatabaseConfig
+    next.Service.ListenAddr = current.Service.ListenAddr
+    next.Service.Token = current.Service.Token
+    next.State = current.State
+    next.Execution.Interactive = current.Execution.Interactive
+    next.Providers = current.Providers
+    return next
+}
+
+// ApplyConfig switches the running service to a new configuration. Settings
+// that need re-initialization are rejected with a log message and keep their
+// current values; everything else (workers, intervals, attempts, execution
+// and extraction settings, exports) applies to the next job.
+func (s *Service) ApplyConfig(next Config) error {
+    if err := ValidateConfig(next); err != nil {
+        return err
+    }
+
+    current := s.currentConfig()
+    for _, setting := range restartRequired(current, next) {
+        s.logger.Printf("Config reload: ignoring change to %s, which requires a restart", setting)
+    }
+    next = reloadable(current, next)
+    if reflect.DeepEqual(current, next) {
+        return nil
+    }
+
+    if current.LogLevel != next.LogLevel {
+        s.logger.Printf("Config reload: log level %s -> %s", orDefault(current.LogLevel, LogLevelInfo), orDefault(next.LogLevel, LogLevelInfo))
+        setLogLevel(next.LogLevel)
+    }
+
+    s.mu.Lock()
+    s.config = next
+    // Autoscaling starts over from the configured count when re-enabled
+    if !next.Service.Autoscale.Enabled {
+        s.target = 0
+    }
+    s.mu.Unlock()
+
+    if current.Service.Workers != next.Service.Workers || current.Service.Autoscale != next.Service.Autoscale {
+        if !next.Service.Autoscale.Enabled {
+            s.logger.Printf("Config reload: scaling workers from %d to %d", current.Service.Workers, next.Service.Workers)
+        }
+        select {
+        case s.resize <- struct{}{}:
+        default:
+        }
+    }
+    s.logger.Println("Config reload: applied")
+    return nil
+}
+
+// watchConfig reloads the configuration whenever the config file changes or
+// the process receives SIGHUP, until ctx is cancelled. load must build the
+// configuration the same way as at startup. The file's directory is
+// watched rather than the file, so editors and deployments replacing it by
+// a rename are noticed too; bursts of events are reloaded once.
+func (s *Service) watchConfig(ctx context.Context, filename string, load func() (Config, error)) {
+    hangup := make(chan os.Signal, 1)
+    signal.Notify(hangup, syscall.SIGHUP)
+    defer signal.Stop(hangup)
+
+    var events <-chan fsnotify.Event
+    var watchErrors <-chan error
+    watcher, err := fsnotify.NewWatcher()
+    if err == nil {
+        defer watcher.Close()
+        err = watcher.Add(filepath.Dir(filename))
+    }
+    if err != nil {
+        s.logger.Printf("Config reload: failed to watch %s, reloading on SIGHUP only: %v", filename, err)
+    } else {
+        events, watchErrors = watcher.Events, watcher.Errors
+    }
+
+    // A change is reloaded once the file has been quiet for a moment
+    settle := time.NewTimer(0)
+    <-settle.C
+    defer settle.Stop()
+    target := filepath.Clean(filename)
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case err := <-watchErrors:
+            s.logger.Printf("Config reload: failed to watch %s: %v", filename, err)
+            continue
+        case event := <-events:
+            if filepath.Clean(event.Name) == target && event.Op != fsnotify.Chmod {
+                settle.Reset(configSettleDelay)
+            }
+            continue
+        case <-settle.C:
+            s.logger.Printf("Config reload: %s changed", filename)
+        case <-hangup:
+            s.logger.Println("Config reload: SIGHUP received")
+        }
+
+        next, err := load()
+        if err == nil {
+            err = s.ApplyConfig(next)
+        }
+        if err != nil {
+            s.logger.Printf("Config reload: rejected, keeping current configuration: %v", err)
+        }
+    }
+}
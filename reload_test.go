@@ -0,0 +1,116 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "io"
+    "log"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+// TestWatchConfig checks the config file is reloaded once after it is
+// written, and again after it is replaced by a rename
+func TestWatchConfig(t *testing.T) {
+    dir := t.TempDir()
+    filename := filepath.Join(dir, "config.json")
+    if err := os.WriteFile(filename, []byte("{}"), 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    loads := make(chan struct{}, 10)
+    service := &Service{logger: log.New(io.Discard, "", 0)}
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        service.watchConfig(ctx, filename, func() (Config, error) {
+            loads <- struct{}{}
+            return Config{}, errors.New("not applied in tests")
+        })
+    }()
+    defer func() {
+        cancel()
+        <-done
+    }()
+    // Give the watcher time to start
+    time.Sleep(100 * time.Millisecond)
+
+    waitForLoad := func(what string) {
+        t.Helper()
+        select {
+        case <-loads:
+        case <-time.After(5 * time.Second):
+            t.Fatalf("the config was not reloaded after %s", what)
+        }
+    }
+
+    // Several writes in a row are reloaded once
+    for i := 0; i < 3; i++ {
+        if err := os.WriteFile(filename, []byte(`{"log_level": "warn"}`), 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+    waitForLoad("writing it")
+    select {
+    case <-loads:
+        t.Fatalf("a burst of writes was reloaded more than once")
+    case <-time.After(2 * configSettleDelay):
+    }
+
+    replacement := filepath.Join(dir, "config.json.new")
+    if err := os.WriteFile(replacement, []byte("{}"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.Rename(replacement, filename); err != nil {
+        t.Fatal(err)
+    }
+    waitForLoad("replacing it")
+
+    // Other files of the directory are not watched
+    if err := os.WriteFile(filepath.Join(dir, "other.json"), []byte("{}"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    select {
+    case <-loads:
+        t.Fatalf("writing another file reloaded the config")
+    case <-time.After(2 * configSettleDelay):
+    }
+}
+
+func TestLogLevel(t *testing.T) {
+    defer setLogLevel("")
+
+    var buf bytes.Buffer
+    logger := log.New(filterLog(&buf), "[SERVICE] ", log.LstdFlags|log.Lshortfile)
+    lines := []struct {
+        message string
+        warning bool
+    }{
+        {"Processing repository https://github.com/example/corpus", false},
+        {"Failed to clone https://github.com/example/missing: not found", true},
+        {"Warning: workspace was not removed", true},
+        {"Config reload: rejected, keeping current configuration: invalid", true},
+        {"Job 4 failed after 3 attempts", true},
+        {"Config reload: applied", false},
+    }
+
+    for _, level := range []string{LogLevelInfo, LogLevelWarn, LogLevelInfo} {
+        setLogLevel(level)
+        for _, line := range lines {
+            buf.Reset()
+            logger.Print(line.message)
+            logged := buf.Len() > 0
+            if want := level != LogLevelWarn || line.warning; logged != want {
+                t.Errorf("at level %s, %q was logged: %v, want %v", level, line.message, logged, want)
+            }
+        }
+    }
+
+    if err := validateLogLevel("verbose"); err == nil {
+        t.Errorf("log level verbose was accepted")
+    }
+}
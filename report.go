@@ -0,0 +1,379 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "html/template"
+    "io"
+    "log"
+    "os"
+    "sort"
+    "text/tabwriter"
+    "time"
+)
+
+// Periods org reports group runs by
+const (
+    PeriodDay     = "day"
+    PeriodWeek    = "week"
+    PeriodMonth   = "month"
+    PeriodQuarter = "quarter"
+)
+
+// defaultHotSpots is the number of repositories listed as error hot spots
+const defaultHotSpots = 10
+
+// OrgReport aggregates the run history of the artifacts directory into
+// organization-wide trends
+type OrgReport struct {
+    GeneratedAt string `json:"generated_at"`
+    Period      string `json:"period"`
+    // Runs summarizes every run the report covers, oldest first
+    Runs []OrgRun `json:"runs"`
+    // Periods are the trends, oldest first
+    Periods []OrgPeriod `json:"periods"`
+    // HotSpots are the repositories with the most errors, most first
+    HotSpots []OrgHotSpot `json:"hot_spots"`
+}
+
+// OrgRun is a run's summary in an org report
+type OrgRun struct {
+    RunID        string    `json:"run_id"`
+    StartedAt    time.Time `json:"started_at"`
+    Repositories int       `json:"repositories"`
+    Functions    int       `json:"functions"`
+    Executed     int       `json:"executed"`
+    Errors       int       `json:"errors"`
+    Aborted      bool      `json:"aborted,omitempty"`
+}
+
+// OrgPeriod holds the trends of one period. Repositories processed several
+// times in the period count with their latest result, so reruns and retries
+// are not counted twice.
+type OrgPeriod struct {
+    Period       string `json:"period"`
+    Runs         int    `json:"runs"`
+    Repositories int    `json:"repositories"`
+    // Functions counts the functions cataloged in the period, and
+    // CumulativeFunctions the distinct functions cataloged up to its end
+    Functions           int `json:"functions"`
+    CumulativeFunctions int `json:"cumulative_functions"`
+    Executed            int `json:"executed"`
+    Errors              int `json:"errors"`
+    // SuccessRate is the share of the cataloged functions executed, in
+    // percent
+    SuccessRate float64 `json:"success_rate"`
+}
+
+// OrgHotSpot is a repository's error record over the report's periods
+type OrgHotSpot struct {
+    Repository string `json:"repository"`
+    Errors     int    `json:"errors"`
+    // Periods counts the periods the repository was processed in, and
+    // FailingPeriods those it had errors in
+    Periods        int `json:"periods"`
+    FailingPeriods int `json:"failing_periods"`
+    // TopErrorKind is its most frequent kind of error
+    TopErrorKind string `json:"top_error_kind,omitempty"`
+    LastRun      string `json:"last_run"`
+}
+
+// RunReport implements the report subcommand. "report org" aggregates the
+// run history into trends for engineering reports.
+func RunReport(config Config, args []string, out io.Writer) error {
+    if len(args) == 0 || args[0] != "org" {
+        return fmt.Errorf("usage: report org [-since date] [-until date] [-period p] [-top n] [-format f] [-output file]")
+    }
+    fs := flag.NewFlagSet("report org", flag.ContinueOnError)
+    since := fs.String("since", "", "only runs started on or after this date (YYYY-MM-DD)")
+    until := fs.String("until", "", "only runs started before this date (YYYY-MM-DD)")
+    period := fs.String("period", PeriodMonth, "period trends are grouped by: day, week, month or quarter")
+    top := fs.Int("top", defaultHotSpots, "number of error hot spots to list")
+    format := fs.String("format", "text", "output format: text, json or html")
+    output := fs.String("output", "", "file to write the report to instead of standard output")
+    if err := fs.Parse(args[1:]); err != nil {
+        return err
+    }
+
+    switch *period {
+    case PeriodDay, PeriodWeek, PeriodMonth, PeriodQuarter:
+    default:
+        return fmt.Errorf("unsupported report period %q", *period)
+    }
+    var from, to time.Time
+    var err error
+    if *since != "" {
+        if from, err = time.ParseInLocation("2006-01-02", *since, time.Local); err != nil {
+            return fmt.Errorf("invalid -since date: %w", err)
+        }
+    }
+    if *until != "" {
+        if to, err = time.ParseInLocation("2006-01-02", *until, time.Local); err != nil {
+            return fmt.Errorf("invalid -until date: %w", err)
+        }
+    }
+
+    history, err := loadRunHistory(config.Artifacts, from, to)
+    if err != nil {
+        return err
+    }
+    report := BuildOrgReport(history, *period, *top)
+
+    var buf bytes.Buffer
+    switch *format {
+    case "text":
+        err = report.WriteText(&buf)
+    case "json":
+        encoder := json.NewEncoder(&buf)
+        encoder.SetIndent("", "  ")
+        err = encoder.Encode(report)
+    case "html":
+        err = orgReportTemplate.Execute(&buf, report)
+    default:
+        return fmt.Errorf("unsupported report format %q", *format)
+    }
+    if err != nil {
+        return fmt.Errorf("failed to render report: %w", err)
+    }
+
+    if *output == "" {
+        _, err = out.Write(buf.Bytes())
+        return err
+    }
+    if err := os.WriteFile(*output, buf.Bytes(), 0644); err != nil {
+        return fmt.Errorf("failed to write report: %w", err)
+    }
+    fmt.Fprintf(out, "Report of %d runs written to %s\n", len(report.Runs), *output)
+    return nil
+}
+
+// historicalRun is a run of the history with when it started
+type historicalRun struct {
+    startedAt time.Time
+    results   *RunResults
+}
+
+// loadRunHistory loads the results of the runs in the artifacts directory
+// that started in [from, to), oldest first; zero times leave the range
+// open. Runs whose results cannot be read are skipped.
+func loadRunHistory(config ArtifactsConfig, from, to time.Time) ([]historicalRun, error) {
+    if config.Dir == "" {
+        return nil, fmt.Errorf("no artifacts directory configured")
+    }
+    runs, err := listRuns(config.Dir)
+    if err != nil {
+        return nil, err
+    }
+    logger := log.New(logOutput, "[REPORT] ", log.LstdFlags|log.Lshortfile)
+
+    var history []historicalRun
+    for _, runID := range runs {
+        artifacts, err := OpenRunArtifacts(config, runID)
+        if err != nil {
+            logger.Printf("Skipping run %s: %v", runID, err)
+            continue
+        }
+        if (!from.IsZero() && artifacts.StartedAt.Before(from)) || (!to.IsZero() && !artifacts.StartedAt.Before(to)) {
+            continue
+        }
+        path, err := artifacts.ResultsPath()
+        if err != nil {
+            logger.Printf("Skipping run %s: %v", runID, err)
+            continue
+        }
+        results, err := LoadResultsFile(path)
+        if err != nil {
+            logger.Printf("Skipping run %s: %v", runID, err)
+            continue
+        }
+        history = append(history, historicalRun{startedAt: artifacts.StartedAt, results: results})
+    }
+    if len(history) == 0 {
+        return nil, fmt.Errorf("no runs with results found in %s", config.Dir)
+    }
+    return history, nil
+}
+
+// periodKey names the period of the given kind a time falls in, in a form
+// that sorts chronologically
+func periodKey(t time.Time, period string) string {
+    switch period {
+    case PeriodDay:
+        return t.Format("2006-01-02")
+    case PeriodWeek:
+        year, week := t.ISOWeek()
+        return fmt.Sprintf("%d-W%02d", year, week)
+    case PeriodQuarter:
+        return fmt.Sprintf("%d-Q%d", t.Year(), (int(t.Month())-1)/3+1)
+    }
+    return t.Format("2006-01")
+}
+
+// BuildOrgReport aggregates a run history, oldest first, into an org
+// report listing at most top hot spots
+func BuildOrgReport(history []historicalRun, period string, top int) *OrgReport {
+    report := &OrgReport{GeneratedAt: time.Now().Format(time.RFC3339), Period: period}
+
+    // The latest result of every repository in each period
+    type periodResults struct {
+        runs    int
+        latest  map[string]*ProcessingResult
+        lastRun map[string]string
+    }
+    periods := make(map[string]*periodResults)
+    var keys []string
+    for _, run := range history {
+        summary := run.results.Summary
+        report.Runs = append(report.Runs, OrgRun{
+            RunID:        run.results.RunID,
+            StartedAt:    run.startedAt,
+            Repositories: summary.TotalRepositories,
+            Functions:    summary.TotalFunctions,
+            Executed:     summary.TotalExecuted,
+            Errors:       summary.TotalErrors,
+            Aborted:      run.results.Aborted,
+        })
+
+        key := periodKey(run.startedAt, period)
+        current, ok := periods[key]
+        if !ok {
+            current = &periodResults{latest: make(map[string]*ProcessingResult), lastRun: make(map[string]string)}
+            periods[key] = current
+            keys = append(keys, key)
+        }
+        current.runs++
+        for repoURL, result := range run.results.Results {
+            if result != nil {
+                current.latest[repoURL] = result
+                current.lastRun[repoURL] = run.results.RunID
+            }
+        }
+    }
+
+    cataloged := make(map[string]bool)
+    hotSpots := make(map[string]*OrgHotSpot)
+    errorKinds := make(map[string]map[string]int)
+    for _, key := range keys {
+        current := periods[key]
+        point := OrgPeriod{Period: key, Runs: current.runs, Repositories: len(current.latest)}
+        for repoURL, result := range current.latest {
+            point.Functions += len(result.ProcessedFunctions)
+            point.Executed += len(result.ExecutedFunctions)
+            point.Errors += len(result.Errors)
+            for _, function := range result.ProcessedFunctions {
+                cataloged[repoURL+"\x00"+function.RelativePath+"\x00"+function.Name] = true
+            }
+
+            spot, ok := hotSpots[repoURL]
+            if !ok {
+                spot = &OrgHotSpot{Repository: repoURL}
+                hotSpots[repoURL] = spot
+                errorKinds[repoURL] = make(map[string]int)
+            }
+            spot.Periods++
+            spot.LastRun = current.lastRun[repoURL]
+            if len(result.Errors) > 0 {
+                spot.FailingPeriods++
+                spot.Errors += len(result.Errors)
+            }
+            for _, message := range result.Errors {
+                errorKinds[repoURL][errorKind(message)]++
+            }
+        }
+        point.CumulativeFunctions = len(cataloged)
+        if point.Functions > 0 {
+            point.SuccessRate = float64(point.Executed) / float64(point.Functions) * 100
+        }
+        report.Periods = append(report.Periods, point)
+    }
+
+    for repoURL, spot := range hotSpots {
+        if spot.Errors == 0 {
+            continue
+        }
+        for kind, count := range errorKinds[repoURL] {
+            if best := errorKinds[repoURL][spot.TopErrorKind]; count > best || (count == best && kind < spot.TopErrorKind) {
+                spot.TopErrorKind = kind
+            }
+        }
+        report.HotSpots = append(report.HotSpots, *spot)
+    }
+    sort.Slice(report.HotSpots, func(i, j int) bool {
+        a, b := report.HotSpots[i], report.HotSpots[j]
+        if a.Errors != b.Errors {
+            return a.Errors > b.Errors
+        }
+        return a.Repository < b.Repository
+    })
+    if top >= 0 && len(report.HotSpots) > top {
+        report.HotSpots = report.HotSpots[:top]
+    }
+    return report
+}
+
+// WriteText writes the report as plain text tables
+func (r *OrgReport) WriteText(w io.Writer) error {
+    tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+    first, last := r.Runs[0], r.Runs[len(r.Runs)-1]
+    fmt.Fprintf(tw, "Org report: %d runs from %s to %s, by %s\n\n", len(r.Runs),
+        first.StartedAt.Format("2006-01-02"), last.StartedAt.Format("2006-01-02"), r.Period)
+
+    fmt.Fprintln(tw, "PERIOD\tRUNS\tREPOSITORIES\tFUNCTIONS\tCUMULATIVE\tEXECUTED\tSUCCESS\tERRORS")
+    for _, p := range r.Periods {
+        fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%.1f%%\t%d\n", p.Period, p.Runs, p.Repositories,
+            p.Functions, p.CumulativeFunctions, p.Executed, p.SuccessRate, p.Errors)
+    }
+
+    if len(r.HotSpots) > 0 {
+        fmt.Fprintln(tw, "\nERROR HOT SPOTS\tERRORS\tFAILING PERIODS\tTOP ERROR KIND")
+        for _, spot := range r.HotSpots {
+            fmt.Fprintf(tw, "%s\t%d\t%d/%d\t%s\n", spot.Repository, spot.Errors,
+                spot.FailingPeriods, spot.Periods, spot.TopErrorKind)
+        }
+    }
+    return tw.Flush()
+}
+
+// orgReportTemplate renders org reports as a standalone HTML document
+var orgReportTemplate = template.Must(template.New("org").Funcs(template.FuncMap{
+    "percent": func(rate float64) string { return fmt.Sprintf("%.1f", rate) },
+    "date":    func(t time.Time) string { return t.Format("2006-01-02 15:04") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>floq org report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+td.number { text-align: right; }
+.bar { background: #4a8; height: 0.8em; }
+.failed { color: #b00; }
+</style>
+</head>
+<body>
+<h1>floq org report</h1>
+<p>{{len .Runs}} runs, grouped by {{.Period}}. Generated {{.GeneratedAt}}.</p>
+<h2>Trends</h2>
+<table>
+<tr><th>Period</th><th>Runs</th><th>Repositories</th><th>Functions</th><th>Cumulative</th><th>Executed</th><th>Success</th><th></th><th>Errors</th></tr>
+{{range .Periods}}<tr><td>{{.Period}}</td><td class="number">{{.Runs}}</td><td class="number">{{.Repositories}}</td><td class="number">{{.Functions}}</td><td class="number">{{.CumulativeFunctions}}</td><td class="number">{{.Executed}}</td><td class="number">{{percent .SuccessRate}}%</td><td style="width: 10em"><div class="bar" style="width: {{percent .SuccessRate}}%"></div></td><td class="number">{{.Errors}}</td></tr>
+{{end}}</table>
+{{if .HotSpots}}
+<h2>Error hot spots</h2>
+<table>
+<tr><th>Repository</th><th>Errors</th><th>Failing periods</th><th>Top error kind</th><th>Last run</th></tr>
+{{range .HotSpots}}<tr><td>{{.Repository}}</td><td class="number failed">{{.Errors}}</td><td class="number">{{.FailingPeriods}}/{{.Periods}}</td><td>{{.TopErrorKind}}</td><td>{{.LastRun}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>Runs</h2>
+<table>
+<tr><th>Run</th><th>Started</th><th>Repositories</th><th>Functions</th><th>Executed</th><th>Errors</th></tr>
+{{range .Runs}}<tr><td>{{.RunID}}{{if .Aborted}} <span class="failed">(aborted)</span>{{end}}</td><td>{{date .StartedAt}}</td><td class="number">{{.Repositories}}</td><td class="number">{{.Functions}}</td><td class="number">{{.Executed}}</td><td class="number">{{.Errors}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
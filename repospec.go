@@ -0,0 +1,373 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "path"
+    "path/filepath"
+    "sort"
+    "strings"
+
+    "gopkg.in/yaml.v3"
+)
+
+// RepoSpec describes a repository to process, as listed in a repositories
+// file: where to find it, what to check out, and how to process it
+type RepoSpec struct {
+    URL string `json:"url"`
+    // Ref is a tag, branch or commit to check out instead of the default
+    // branch
+    Ref string `json:"ref,omitempty"`
+    // Subdirectory restricts processing to one directory of the repository
+    Subdirectory string `json:"subdirectory,omitempty"`
+    // Labels are free-form metadata recorded with the repository's result
+    Labels map[string]string `json:"labels,omitempty"`
+    // Overrides holds "extraction" and "execution" settings layered over
+    // the configuration for this repository only
+    Overrides json.RawMessage `json:"overrides,omitempty"`
+}
+
+// repoOverrides are the configuration sections a RepoSpec may override
+type repoOverrides struct {
+    Extraction json.RawMessage `json:"extraction"`
+    Execution  json.RawMessage `json:"execution"`
+}
+
+// UnmarshalJSON accepts a bare URL as well as an object
+func (s *RepoSpec) UnmarshalJSON(data []byte) error {
+    if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+        *s = RepoSpec{}
+        return json.Unmarshal(data, &s.URL)
+    }
+    type plain RepoSpec
+    return json.Unmarshal(data, (*plain)(s))
+}
+
+// Key identifies the spec's result in a run: the URL, followed by
+// //subdirectory and @ref when they are set
+func (s RepoSpec) Key() string {
+    key := s.URL
+    if s.Subdirectory != "" {
+        key += "//" + s.Subdirectory
+    }
+    if s.Ref != "" {
+        key += "@" + s.Ref
+    }
+    return key
+}
+
+// plain reports whether the spec holds nothing but a URL
+func (s RepoSpec) plain() bool {
+    return s.Ref == "" && s.Subdirectory == "" && len(s.Labels) == 0 && len(s.Overrides) == 0
+}
+
+// stamp records the spec's labels, and the spec itself unless it is a bare
+// URL, in a result
+func (s RepoSpec) stamp(result *ProcessingResult) *ProcessingResult {
+    result.Labels = s.Labels
+    if !s.plain() {
+        spec := s
+        result.Spec = &spec
+    }
+    return result
+}
+
+// specsFromURLs wraps bare repository URLs into specs
+func specsFromURLs(repositories []string) []RepoSpec {
+    specs := make([]RepoSpec, len(repositories))
+    for i, repoURL := range repositories {
+        specs[i] = RepoSpec{URL: repoURL}
+    }
+    return specs
+}
+
+// applyTo returns the configuration the repository is processed with
+func (s RepoSpec) applyTo(config Config) (Config, error) {
+    if len(s.Overrides) > 0 {
+        var overrides repoOverrides
+        if err := json.Unmarshal(s.Overrides, &overrides); err != nil {
+            return config, fmt.Errorf("failed to parse overrides of %s: %w", s.Key(), err)
+        }
+        var err error
+        if config.Extraction, err = overlaid(config.Extraction, overrides.Extraction); err != nil {
+            return config, fmt.Errorf("failed to parse extraction overrides of %s: %w", s.Key(), err)
+        }
+        if config.Execution, err = overlaid(config.Execution, overrides.Execution); err != nil {
+            return config, fmt.Errorf("failed to parse execution overrides of %s: %w", s.Key(), err)
+        }
+    }
+    if s.Subdirectory != "" {
+        config.Extraction.Paths = []string{s.Subdirectory}
+    }
+    return config, nil
+}
+
+// overlaid returns a copy of base with overrides decoded over it. The copy
+// is made through JSON, as decoding into base itself would write into the
+// arrays its slices share with the base configuration.
+func overlaid[T any](base T, overrides json.RawMessage) (T, error) {
+    if len(overrides) == 0 || string(overrides) == "null" {
+        return base, nil
+    }
+    var result T
+    data, err := json.Marshal(base)
+    if err != nil {
+        return base, err
+    }
+    if err := json.Unmarshal(data, &result); err != nil {
+        return base, err
+    }
+    if err := json.Unmarshal(overrides, &result); err != nil {
+        return base, err
+    }
+    return result, nil
+}
+
+// validateRepoSpecs checks specs read from a repositories file
+func validateRepoSpecs(specs []RepoSpec) error {
+    seen := make(map[string]bool, len(specs))
+    for i, spec := range specs {
+        if spec.URL == "" {
+            return fmt.Errorf("repository %d has no url", i+1)
+        }
+        if spec.Subdirectory != "" {
+            clean := path.Clean(filepath.ToSlash(spec.Subdirectory))
+            if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+                return fmt.Errorf("subdirectory %q of %s is outside the repository", spec.Subdirectory, spec.URL)
+            }
+        }
+        if len(spec.Overrides) > 0 {
+            decoder := json.NewDecoder(bytes.NewReader(spec.Overrides))
+            decoder.DisallowUnknownFields()
+            if err := decoder.Decode(&repoOverrides{}); err != nil {
+                return fmt.Errorf("overrides of %s may only set extraction and execution: %w", spec.Key(), err)
+            }
+            if _, err := spec.applyTo(Config{}); err != nil {
+                return err
+            }
+        }
+        if seen[spec.Key()] {
+            return fmt.Errorf("repository %s is listed twice", spec.Key())
+        }
+        seen[spec.Key()] = true
+    }
+    return nil
+}
+
+// Formats of repositories files
+const (
+    repoFormatJSON = "json"
+    repoFormatYAML = "yaml"
+    repoFormatCSV  = "csv"
+    repoFormatText = "text"
+)
+
+// LoadRepoSpecs reads a repositories file, or standard input when filename
+// is "-". Its format follows the extension: .json and .yaml (or .yml) hold
+// a list of specs or bare URLs, .csv a header row naming the url, ref,
+// subdirectory, labels and overrides columns, and .txt (or .list) one URL
+// per line. Without an extension the format is detected from the content.
+func LoadRepoSpecs(filename string) ([]RepoSpec, error) {
+    var data []byte
+    var err error
+    if filename == "-" {
+        data, err = io.ReadAll(os.Stdin)
+    } else {
+        data, err = os.ReadFile(filename)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to read repositories file: %w", err)
+    }
+
+    var format string
+    switch ext := strings.ToLower(filepath.Ext(filename)); ext {
+    case ".json":
+        format = repoFormatJSON
+    case ".yaml", ".yml":
+        format = repoFormatYAML
+    case ".csv":
+        format = repoFormatCSV
+    case ".txt", ".list":
+        format = repoFormatText
+    case "":
+        format = detectRepoFormat(data)
+    default:
+        return nil, fmt.Errorf("unsupported repositories file extension %q, want .json, .yaml, .csv or .txt", ext)
+    }
+    specs, err := ParseRepoSpecs(data, format)
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse repositories file: %w", err)
+    }
+    if err := validateRepoSpecs(specs); err != nil {
+        return nil, err
+    }
+    return specs, nil
+}
+
+// ParseRepoSpecs parses the content of a repositories file in the given
+// format, without validating the specs
+func ParseRepoSpecs(data []byte, format string) ([]RepoSpec, error) {
+    switch format {
+    case repoFormatJSON:
+        var specs []RepoSpec
+        if err := json.Unmarshal(data, &specs); err != nil {
+            return nil, err
+        }
+        return specs, nil
+    case repoFormatYAML:
+        return parseYAMLSpecs(data)
+    case repoFormatCSV:
+        return parseCSVSpecs(bytes.NewReader(data))
+    case repoFormatText:
+        return parseTextSpecs(bytes.NewReader(data))
+    }
+    return nil, fmt.Errorf("unknown repositories format %q", format)
+}
+
+// detectRepoFormat guesses the format of a repositories file from its
+// first significant line: a JSON list starts with "[", a YAML list with
+// "- " and a CSV file with a header naming the url column. Anything else
+// is read as one URL per line.
+func detectRepoFormat(data []byte) string {
+    scanner := bufio.NewScanner(bytes.NewReader(data))
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        switch {
+        case strings.HasPrefix(line, "["):
+            return repoFormatJSON
+        case strings.HasPrefix(line, "- ") || line == "-":
+            return repoFormatYAML
+        case strings.Contains(line, ","):
+            for _, column := range strings.Split(line, ",") {
+                if strings.EqualFold(strings.TrimSpace(column), "url") {
+                    return repoFormatCSV
+                }
+            }
+        }
+        return repoFormatText
+    }
+    return repoFormatText
+}
+
+// parseTextSpecs reads one repository URL per line, ignoring blank lines
+// and # comments
+func parseTextSpecs(r io.Reader) ([]RepoSpec, error) {
+    var specs []RepoSpec
+    scanner := bufio.NewScanner(r)
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        if line != "" && !strings.HasPrefix(line, "#") {
+            specs = append(specs, RepoSpec{URL: line})
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, err
+    }
+    return specs, nil
+}
+
+// parseYAMLSpecs reads specs from YAML by way of JSON, so both formats
+// share the field names and the handling of overrides
+func parseYAMLSpecs(data []byte) ([]RepoSpec, error) {
+    var document interface{}
+    if err := yaml.Unmarshal(data, &document); err != nil {
+        return nil, err
+    }
+    if document == nil {
+        return nil, nil
+    }
+    converted, err := json.Marshal(document)
+    if err != nil {
+        return nil, err
+    }
+    var specs []RepoSpec
+    if err := json.Unmarshal(converted, &specs); err != nil {
+        return nil, err
+    }
+    return specs, nil
+}
+
+// parseCSVSpecs reads specs from CSV. Labels are written key=value,
+// separated by semicolons, and overrides as a JSON object.
+func parseCSVSpecs(r io.Reader) ([]RepoSpec, error) {
+    reader := csv.NewReader(r)
+    reader.TrimLeadingSpace = true
+    reader.Comment = '#'
+    header, err := reader.Read()
+    if err == io.EOF {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    columns := make(map[string]int, len(header))
+    for i, name := range header {
+        name = strings.ToLower(strings.TrimSpace(name))
+        switch name {
+        case "url", "ref", "subdirectory", "labels", "overrides":
+        default:
+            return nil, fmt.Errorf("unknown column %q", name)
+        }
+        columns[name] = i
+    }
+    if _, ok := columns["url"]; !ok {
+        return nil, fmt.Errorf("missing url column")
+    }
+
+    var specs []RepoSpec
+    for {
+        record, err := reader.Read()
+        if err == io.EOF {
+            return specs, nil
+        }
+        if err != nil {
+            return nil, err
+        }
+        field := func(name string) string {
+            if i, ok := columns[name]; ok {
+                return strings.TrimSpace(record[i])
+            }
+            return ""
+        }
+        spec := RepoSpec{URL: field("url"), Ref: field("ref"), Subdirectory: field("subdirectory")}
+        if labels := field("labels"); labels != "" {
+            spec.Labels = make(map[string]string)
+            for _, label := range strings.Split(labels, ";") {
+                key, value, ok := strings.Cut(label, "=")
+                if !ok || strings.TrimSpace(key) == "" {
+                    return nil, fmt.Errorf("label %q of %s is not key=value", label, spec.URL)
+                }
+                spec.Labels[strings.TrimSpace(key)] = strings.TrimSpace(value)
+            }
+        }
+        if overrides := field("overrides"); overrides != "" {
+            spec.Overrides = json.RawMessage(overrides)
+            if !json.Valid(spec.Overrides) {
+                return nil, fmt.Errorf("overrides of %s are not valid JSON", spec.URL)
+            }
+        }
+        specs = append(specs, spec)
+    }
+}
+
+// formatLabels renders labels as sorted key=value pairs
+func formatLabels(labels map[string]string) string {
+    keys := make([]string, 0, len(labels))
+    for key := range labels {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    pairs := make([]string, len(keys))
+    for i, key := range keys {
+        pairs[i] = key + "=" + labels[key]
+    }
+    return strings.Join(pairs, ", ")
+}
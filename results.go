@@ -0,0 +1,176 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "time"
+)
+
+// ResultsSchemaVersion is the layout of the results files written by this
+// build. Bump it when a change to RunResults or ProcessingResult means
+// older files no longer read correctly, and register the upgrade from the
+// previous version in resultsUpgrades.
+const ResultsSchemaVersion = 2
+
+// minResultsSchemaVersion is the oldest layout LoadResultsFile can upgrade.
+// Files written before schema_version was recorded are version 1.
+const minResultsSchemaVersion = 1
+
+// resultsUpgrades maps a schema version to the upgrade producing the next
+// version; filename is the file being loaded
+var resultsUpgrades = map[int]func(results *RunResults, filename string){
+    1: upgradeResultsV1,
+}
+
+// RunResults is the document written by SaveResultsToFile
+type RunResults struct {
+    SchemaVersion int                          `json:"schema_version"`
+    Summary       ProcessingStats              `json:"summary"`
+    Results       map[string]*ProcessingResult `json:"results"`
+    GeneratedAt   string                       `json:"generated_at"`
+    RunID         string                       `json:"run_id"`
+    // RetryOf is the run whose failures this run retried
+    RetryOf       string                       `json:"retry_of,omitempty"`
+    // PostRun records the post-run SQL scripts, per database
+    PostRun       []ScriptResult               `json:"post_run,omitempty"`
+    // Aborted is set when the run was interrupted; Pending lists the
+    // repositories it did not start, which a retry processes
+    Aborted       bool                         `json:"aborted,omitempty"`
+    // TimedOut is set when the run's timeout aborted it
+    TimedOut      bool                         `json:"timed_out,omitempty"`
+    Pending       []RepoSpec                   `json:"pending,omitempty"`
+}
+
+// LoadResultsFile reads a results file written by a previous run, upgrading
+// files written with an older schema to the current one
+func LoadResultsFile(filename string) (*RunResults, error) {
+    data, err := os.ReadFile(filename)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read results file: %w", err)
+    }
+
+    // Check the version first so newer layouts are reported as such rather
+    // than as whatever decoding error they cause
+    var header struct {
+        SchemaVersion int `json:"schema_version"`
+    }
+    if err := json.Unmarshal(data, &header); err != nil {
+        return nil, fmt.Errorf("failed to parse results file %s: %w", filename, err)
+    }
+    version := max(header.SchemaVersion, minResultsSchemaVersion)
+    if version > ResultsSchemaVersion {
+        return nil, fmt.Errorf("results file %s has schema version %d, newer than the supported %d",
+            filename, version, ResultsSchemaVersion)
+    }
+
+    var results RunResults
+    if err := json.Unmarshal(data, &results); err != nil {
+        return nil, fmt.Errorf("failed to parse results file %s: %w", filename, err)
+    }
+    for ; version < ResultsSchemaVersion; version++ {
+        resultsUpgrades[version](&results, filename)
+    }
+    results.SchemaVersion = version
+    return &results, nil
+}
+
+// upgradeResultsV1 fills in what files written before schema versioning
+// may lack: the run id, which only later became part of the document,
+// function kinds, which predate closures and variables, and output
+// representations, which were always JSON before they were negotiated
+func upgradeResultsV1(results *RunResults, filename string) {
+    if results.RunID == "" {
+        if dir := filepath.Base(filepath.Dir(filename)); isRunID(dir) {
+            results.RunID = dir
+        }
+    }
+    if results.Results == nil {
+        results.Results = make(map[string]*ProcessingResult)
+    }
+    for _, result := range results.Results {
+        if result == nil {
+            continue
+        }
+        for i := range result.ProcessedFunctions {
+            if result.ProcessedFunctions[i].Kind == "" {
+                result.ProcessedFunctions[i].Kind = FunctionKindFunc
+            }
+        }
+        for _, name := range result.ExecutedFunctions {
+            if _, ok := result.Representations[name]; ok {
+                continue
+            }
+            if result.Representations == nil {
+                result.Representations = make(map[string]string)
+            }
+            result.Representations[name] = RepresentationJSON
+        }
+    }
+}
+
+// listRuns returns the run ids under the artifacts root, oldest first
+func listRuns(root string) ([]string, error) {
+    entries, err := os.ReadDir(root)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read artifacts directory: %w", err)
+    }
+
+    var runs []string
+    for _, entry := range entries {
+        if entry.IsDir() && isRunID(entry.Name()) {
+            runs = append(runs, entry.Name())
+        }
+    }
+    // Run ids start with a timestamp, so lexical order is chronological
+    sort.Strings(runs)
+    return runs, nil
+}
+
+// OpenRunArtifacts returns the artifacts of an existing run, so its files
+// can be located with the same naming templates used to write them
+func OpenRunArtifacts(config ArtifactsConfig, runID string) (*RunArtifacts, error) {
+    if config.Dir == "" {
+        return nil, fmt.Errorf("no artifacts directory configured")
+    }
+    if !isRunID(runID) {
+        return nil, fmt.Errorf("invalid run id %q", runID)
+    }
+
+    dir := filepath.Join(config.Dir, runID)
+    if _, err := os.Stat(dir); err != nil {
+        return nil, fmt.Errorf("run %s not found: %w", runID, err)
+    }
+
+    startedAt, _ := time.ParseInLocation(runIDTimeFormat, runID[:len(runIDTimeFormat)], time.Local)
+    return &RunArtifacts{
+        RunID:     runID,
+        Dir:       dir,
+        StartedAt: startedAt,
+        config:    config,
+    }, nil
+}
+
+// latestResultsPath returns the results file of the most recent run, or the
+// working directory results file when no artifacts directory is configured
+func latestResultsPath(config ArtifactsConfig) (string, error) {
+    if config.Dir == "" {
+        return orDefault(config.ResultsFile, defaultResultsFileTemplate), nil
+    }
+
+    runs, err := listRuns(config.Dir)
+    if err != nil {
+        return "", err
+    }
+    if len(runs) == 0 {
+        return "", fmt.Errorf("no runs found in %s", config.Dir)
+    }
+
+    artifacts, err := OpenRunArtifacts(config, runs[len(runs)-1])
+    if err != nil {
+        return "", err
+    }
+    return artifacts.ResultsPath()
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "regexp"
+    "sort"
+    "strings"
+)
+
+// RetryRecord marks a result that was re-processed by a retry of a
+// previous run
+type RetryRecord struct {
+    RunID string `json:"run_id"`
+    // Functions lists the functions that were re-run; it is empty when the
+    // whole repository was re-processed
+    Functions []string `json:"functions,omitempty"`
+}
+
+// functionErrorPrefixes begin the errors recorded for a single function,
+// followed by the function's name. Prefixes no longer recorded are kept
+// for the results of earlier runs.
+var functionErrorPrefixes = []string{
+    "Failed to execute function ",
+    "Failed to fuzz function ",
+    "Failed to store output of ",
+    "Failed to store data for ",
+    "Failed to create table for ",
+    "Failed to insert data for ",
+    "Failed to store invocations for ",
+    "Failed to store statistics of ",
+    "Failed to store toolchain outputs for ",
+    "Failed to create toolchain table for ",
+    "Failed to run post-insert hook for ",
+    "Failed to insert toolchain outputs for ",
+}
+
+// errorFunction returns the function an error was recorded for, if any
+func errorFunction(message string) (string, bool) {
+    for _, prefix := range functionErrorPrefixes {
+        if rest, ok := strings.CutPrefix(message, prefix); ok {
+            name, _, _ := strings.Cut(rest, ":")
+            if fields := strings.Fields(name); len(fields) > 0 {
+                return fields[0], true
+            }
+        }
+    }
+    return "", false
+}
+
+// repositoryFailed reports whether processing a repository failed as a
+// whole. Results written before Failed was recorded count as failed when
+// they hold errors but no functions.
+func repositoryFailed(result *ProcessingResult) bool {
+    return result.Failed || (len(result.ProcessedFunctions) == 0 && len(result.Errors) > 0)
+}
+
+// failedFunctions returns the functions of a result that failed, in the
+// order their errors were recorded
+func failedFunctions(result *ProcessingResult) []string {
+    var names []string
+    for _, message := range result.Errors {
+        if name, ok := errorFunction(message); ok && !containsString(names, name) {
+            names = append(names, name)
+        }
+    }
+    return names
+}
+
+// planRetry returns what to re-process of a previous run: repositories that
+// failed map to nil and are processed in full, the others to the functions
+// that failed, as do the repositories an interrupted run did not start.
+// Time-travel results are left out, as their refs are not processed on
+// their own; refs pinned by a repositories file are retried.
+func planRetry(previous *RunResults) map[string][]string {
+    plan := make(map[string][]string)
+    for repoURL, result := range previous.Results {
+        if result == nil || result.NotSelected {
+            continue
+        }
+        if result.Ref != "" && (result.Spec == nil || result.Spec.Ref == "") {
+            continue
+        }
+        if repositoryFailed(result) {
+            plan[repoURL] = nil
+        } else if functions := failedFunctions(result); len(functions) > 0 {
+            plan[repoURL] = functions
+        }
+    }
+    // Interrupted runs leave repositories that were never started
+    for _, spec := range previous.Pending {
+        plan[spec.Key()] = nil
+    }
+    return plan
+}
+
+// retrySelection restricts execution to the named functions
+func retrySelection(functions []string) *FunctionQuery {
+    quoted := make([]string, len(functions))
+    for i, name := range functions {
+        quoted[i] = regexp.QuoteMeta(name)
+    }
+    return &FunctionQuery{Name: regexp.MustCompile("^(?:" + strings.Join(quoted, "|") + ")$")}
+}
+
+// LoadRetrySource loads the results a retry starts from: source is a
+// results file or the id of a run in the artifacts directory
+func LoadRetrySource(config ArtifactsConfig, source string) (*RunResults, error) {
+    if _, err := os.Stat(source); err != nil && isRunID(source) {
+        artifacts, err := OpenRunArtifacts(config, source)
+        if err != nil {
+            return nil, err
+        }
+        if source, err = artifacts.ResultsPath(); err != nil {
+            return nil, err
+        }
+    }
+    return LoadResultsFile(source)
+}
+
+// RetryFailures re-processes only what failed in a previous run: failed
+// repositories in full, and the failed functions of the others. The run it
+// returns holds the previous results with the new outcomes merged in, so it
+// replaces the previous run as the latest complete picture.
+func (p *RepositoryProcessor) RetryFailures(ctx context.Context, runID string, previous *RunResults) (*Run, error) {
+    plan := planRetry(previous)
+    repositories := make([]string, 0, len(plan))
+    functions := 0
+    for repoURL, names := range plan {
+        repositories = append(repositories, repoURL)
+        functions += len(names)
+    }
+    sort.Strings(repositories)
+    p.logger.Printf("Retrying failures of run %s: %d repositories, %d functions", previous.RunID, len(repositories), functions)
+
+    // Entries of a repositories file are retried as they were listed
+    listed := make(map[string]RepoSpec)
+    for _, spec := range previous.Pending {
+        listed[spec.Key()] = spec
+    }
+    for repoURL, result := range previous.Results {
+        if result != nil && result.Spec != nil {
+            listed[repoURL] = *result.Spec
+        }
+    }
+    specs := make([]RepoSpec, len(repositories))
+    for i, repoURL := range repositories {
+        specs[i] = RepoSpec{URL: repoURL}
+        if spec, ok := listed[repoURL]; ok {
+            specs[i] = spec
+        }
+    }
+
+    retried, err := p.processRepositories(ctx, runID, specs, plan)
+    if err != nil {
+        return nil, err
+    }
+
+    run := newRun(runID)
+    run.RetryOf = previous.RunID
+    run.outputs = retried.outputs
+    names := make([]string, 0, len(previous.Results)+len(previous.Pending))
+    for repoURL, result := range previous.Results {
+        if result != nil {
+            names = append(names, repoURL)
+        }
+    }
+    for _, spec := range previous.Pending {
+        if previous.Results[spec.Key()] == nil {
+            names = append(names, spec.Key())
+        }
+    }
+    sort.Strings(names)
+
+    outcomes := retried.Results()
+    recorded := 0
+    for _, repoURL := range names {
+        old := previous.Results[repoURL]
+        functions, ok := plan[repoURL]
+        outcome := outcomes[repoURL]
+        // Repositories an interrupted retry did not start keep their
+        // previous result, if they had one
+        if !ok || outcome == nil {
+            if old != nil {
+                run.record(repoURL, old, !repositoryFailed(old))
+                recorded++
+            }
+            continue
+        }
+        // Retried functions merge into the previous result, which keeps
+        // its other functions even if the repository failed this time
+        succeeded := !outcome.Failed
+        if functions != nil {
+            outcome = mergeRetriedFunctions(old, outcome, functions)
+            succeeded = true
+        }
+        outcome.Retried = &RetryRecord{RunID: previous.RunID, Functions: functions}
+        run.record(repoURL, outcome, succeeded)
+        recorded++
+    }
+    if retried.Aborted() {
+        run.abort(retried.Pending(), retried.TimedOut())
+    }
+    run.finish(recorded)
+    return run, nil
+}
+
+// mergeRetriedFunctions returns the previous result of a repository with
+// the new outcomes of the retried functions in place of the old ones
+func mergeRetriedFunctions(old, outcome *ProcessingResult, functions []string) *ProcessingResult {
+    merged := *old
+    retried := func(message string) bool {
+        name, ok := errorFunction(message)
+        return ok && containsString(functions, name)
+    }
+
+    merged.Errors = nil
+    for _, message := range old.Errors {
+        if !retried(message) {
+            merged.Errors = append(merged.Errors, message)
+        }
+    }
+    for _, message := range outcome.Errors {
+        if retried(message) || !containsString(merged.Errors, message) {
+            merged.Errors = append(merged.Errors, message)
+        }
+    }
+
+    merged.ExecutedFunctions = appendMissing(old.ExecutedFunctions, outcome.ExecutedFunctions)
+    merged.CreatedTables = appendMissing(old.CreatedTables, outcome.CreatedTables)
+    merged.Invocations = append(append([]Invocation(nil), old.Invocations...), outcome.Invocations...)
+    merged.Retries = append(append([]RetriedExecution(nil), old.Retries...), outcome.Retries...)
+    merged.SchemaMismatches = appendMissing(old.SchemaMismatches, outcome.SchemaMismatches)
+    merged.TableCollisions = append(append([]TableCollision(nil), old.TableCollisions...), outcome.TableCollisions...)
+    merged.Representations = mergeMaps(old.Representations, outcome.Representations)
+    merged.OutputSamples = mergeMaps(old.OutputSamples, outcome.OutputSamples)
+    merged.PayloadHashes = mergeMaps(old.PayloadHashes, outcome.PayloadHashes)
+    merged.TruncatedOutputs = mergeMaps(old.TruncatedOutputs, outcome.TruncatedOutputs)
+    merged.Mocks = mergeMaps(old.Mocks, outcome.Mocks)
+    if outcome.WriteBack != nil {
+        merged.WriteBack = outcome.WriteBack
+    }
+    merged.CacheHits += outcome.CacheHits
+    merged.CacheMisses += outcome.CacheMisses
+    merged.ExtractionCacheHits += outcome.ExtractionCacheHits
+    merged.ExtractionCacheMisses += outcome.ExtractionCacheMisses
+    merged.DurationMs += outcome.DurationMs
+    merged.PhaseMs = make(map[string]int64, len(old.PhaseMs))
+    for _, phases := range []map[string]int64{old.PhaseMs, outcome.PhaseMs} {
+        for phase, ms := range phases {
+            merged.PhaseMs[phase] += ms
+        }
+    }
+    return &merged
+}
+
+// appendMissing returns list with the items of more it does not contain yet
+func appendMissing(list, more []string) []string {
+    merged := append([]string(nil), list...)
+    for _, item := range more {
+        if !containsString(merged, item) {
+            merged = append(merged, item)
+        }
+    }
+    return merged
+}
+
+// mergeMaps returns the entries of both maps, those of next winning
+func mergeMaps[V any](previous, next map[string]V) map[string]V {
+    if len(previous) == 0 && len(next) == 0 {
+        return nil
+    }
+    merged := make(map[string]V, len(previous)+len(next))
+    for key, value := range previous {
+        merged[key] = value
+    }
+    for key, value := range next {
+        merged[key] = value
+    }
+    return merged
+}
+
+// describeRetry formats what a retry re-ran for the summary
+func describeRetry(retry *RetryRecord) string {
+    if len(retry.Functions) == 0 {
+        return "whole repository"
+    }
+    return fmt.Sprintf("%d functions (%s)", len(retry.Functions), joinStrings(retry.Functions, ", "))
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "path/filepath"
+    "strings"
+)
+
+// Output representations the runner can capture, from most to least faithful
+const (
+    RepresentationJSON      = "json"
+    RepresentationReflect   = "reflect"
+    RepresentationGoString  = "gostring"
+    RepresentationWriter    = "writer"
+    RepresentationRawOutput = "raw"
+)
+
+// ExecutionOutput is a function's captured result along with the
+// representation the runner used to serialize it
+type ExecutionOutput struct {
+    Value          interface{}
+    Representation string
+}
+
+// runnerEnvelope is the JSON document a generated runner prints to stdout
+type runnerEnvelope struct {
+    Representation string          `json:"representation"`
+    Value          json.RawMessage `json:"value"`
+}
+
+// parseRunnerOutput decodes a runner's stdout. Output that is not a runner
+// envelope is kept as raw text.
+func parseRunnerOutput(output []byte) *ExecutionOutput {
+    var envelope runnerEnvelope
+    if err := json.Unmarshal(output, &envelope); err == nil && envelope.Representation != "" {
+        var value interface{}
+        if err := json.Unmarshal(envelope.Value, &value); err == nil {
+            return &ExecutionOutput{Value: value, Representation: envelope.Representation}
+        }
+    }
+
+    return &ExecutionOutput{
+        Value:          strings.TrimSpace(string(output)),
+        Representation: RepresentationRawOutput,
+    }
+}
+
+// generateMainFile creates a temporary main.go file to execute a function
+func (g *GitHubFunctionExtractor) generateMainFile(function FunctionInfo, args []string) string {
+    // Import the function's package by its module import path, since the
+    // runner lives in its own directory of the module
+    relPath, _ := filepath.Rel(g.repoPath, filepath.Dir(function.FilePath))
+    importPath := packageImportPath(g.modulePath, filepath.ToSlash(relPath))
+
+    imports := []string{`"encoding/json"`, `"fmt"`, `"log"`, `"reflect"`}
+    var call string
+    if isWriterFunction(function) && len(args) == 0 {
+        // Writer-based functions get a buffer and their written bytes
+        // become the payload
+        imports = append(imports, `"bytes"`)
+        invoke := fmt.Sprintf(`if err := pkg.%s(&buf); err != nil {
+        log.Fatalf("Function returned error: %%v", err)
+    }`, function.Name)
+        if len(function.ReturnTypes) == 0 {
+            invoke = fmt.Sprintf("pkg.%s(&buf)", function.Name)
+        }
+        call = fmt.Sprintf(`var buf bytes.Buffer
+    %s
+    representation, value := captureWritten(buf.Bytes())`, invoke)
+    } else {
+        call = fmt.Sprintf(`representation, value := capture(pkg.%s(%s))`,
+            function.Name, strings.Join(args, ", "))
+    }
+
+    // Constructed arguments need their packages imported
+    imports = append(imports, g.autoArgumentImports(function, args)...)
+
+    // Mocked parameters need their implementation declared in the runner
+    var mockSource string
+    if len(args) == 1 && args[0] == mockArgument {
+        if mock, err := g.interfaceMock(function); err == nil {
+            imports = append(imports, mock.Imports...)
+            mockSource = mock.Source
+        }
+    }
+
+    return fmt.Sprintf(`package main
+
+import (
+    %s
+    
+    pkg "%s"
+)
+
+func main() {
+    defer func() {
+        if r := recover(); r != nil {
+            log.Printf("Function panicked: %%v", r)
+        }
+    }()
+    
+    %s
+    
+    envelope, err := json.Marshal(map[string]interface{}{
+        "representation": representation,
+        "value":          value,
+    })
+    if err != nil {
+        // If marshaling fails, print as string
+        fmt.Print(value)
+        return
+    }
+    fmt.Print(string(envelope))
+}
+`, strings.Join(imports, "\n    "), importPath, call) + mockSource + runnerCaptureSource
+}
+
+// isWriterFunction reports whether a function has the writer-based output
+// shape func(w io.Writer) error (or no result at all)
+func isWriterFunction(function FunctionInfo) bool {
+    if len(function.Parameters) != 1 || parameterType(function.Parameters[0]) != "io.Writer" {
+        return false
+    }
+    return len(function.ReturnTypes) == 0 ||
+        (len(function.ReturnTypes) == 1 && function.ReturnTypes[0] == "error")
+}
+
+// runnerCaptureSource is appended to every generated runner. capture picks
+// the most faithful representation of a result: plain JSON when it loses
+// nothing, a reflection-based dump when JSON would drop unexported fields
+// (or fails outright), and the %#v Go syntax as a last resort.
+const runnerCaptureSource = `
+const maxDumpDepth = 16
+
+func capture(result interface{}) (string, interface{}) {
+    v := reflect.ValueOf(result)
+    if data, err := json.Marshal(result); err == nil && !hidesFields(v, 0) {
+        return "json", json.RawMessage(data)
+    }
+    if dumped, ok := dump(v, 0); ok {
+        return "reflect", dumped
+    }
+    return "gostring", fmt.Sprintf("%#v", result)
+}
+
+// captureWritten keeps bytes written by a writer-based function, embedding
+// them as structured data when they already form a JSON document
+func captureWritten(written []byte) (string, interface{}) {
+    if json.Valid(written) {
+        return "writer", json.RawMessage(written)
+    }
+    return "writer", string(written)
+}
+
+// Types implementing these encode themselves, whatever fields they hide;
+// the text interface is encoding.TextMarshaler, spelled out to keep the
+// runner's imports fixed
+var (
+    jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+    textMarshalerType = reflect.TypeOf((*interface{ MarshalText() ([]byte, error) })(nil)).Elem()
+)
+
+// marshalsItself reports whether values of t have their own JSON or text
+// encoding, with a value or pointer receiver, like time.Time or big.Int
+func marshalsItself(t reflect.Type) bool {
+    for _, marshaler := range []reflect.Type{jsonMarshalerType, textMarshalerType} {
+        if t.Implements(marshaler) || reflect.PtrTo(t).Implements(marshaler) {
+            return true
+        }
+    }
+    return false
+}
+
+// hidesFields reports whether JSON encoding would silently drop unexported
+// struct fields somewhere inside v
+func hidesFields(v reflect.Value, depth int) bool {
+    if !v.IsValid() || depth > maxDumpDepth {
+        return false
+    }
+    if marshalsItself(v.Type()) {
+        return false
+    }
+    switch v.Kind() {
+    case reflect.Ptr, reflect.Interface:
+        return !v.IsNil() && hidesFields(v.Elem(), depth+1)
+    case reflect.Struct:
+        t := v.Type()
+        for i := 0; i < v.NumField(); i++ {
+            if t.Field(i).PkgPath != "" || hidesFields(v.Field(i), depth+1) {
+                return true
+            }
+        }
+    case reflect.Slice, reflect.Array:
+        for i := 0; i < v.Len(); i++ {
+            if hidesFields(v.Index(i), depth+1) {
+                return true
+            }
+        }
+    case reflect.Map:
+        iter := v.MapRange()
+        for iter.Next() {
+            if hidesFields(iter.Value(), depth+1) {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// dump converts v into JSON-friendly maps, slices, and scalars, reading
+// unexported fields through reflection
+func dump(v reflect.Value, depth int) (interface{}, bool) {
+    if !v.IsValid() {
+        return nil, true
+    }
+    if depth > maxDumpDepth {
+        return "...", true
+    }
+    switch v.Kind() {
+    case reflect.Bool:
+        return v.Bool(), true
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        return v.Int(), true
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+        return v.Uint(), true
+    case reflect.Float32, reflect.Float64:
+        return v.Float(), true
+    case reflect.String:
+        return v.String(), true
+    case reflect.Ptr, reflect.Interface:
+        if v.IsNil() {
+            return nil, true
+        }
+        return dump(v.Elem(), depth+1)
+    case reflect.Struct:
+        out := make(map[string]interface{}, v.NumField())
+        t := v.Type()
+        for i := 0; i < v.NumField(); i++ {
+            field, ok := dump(v.Field(i), depth+1)
+            if !ok {
+                field = v.Field(i).Type().String()
+            }
+            out[t.Field(i).Name] = field
+        }
+        return out, true
+    case reflect.Slice, reflect.Array:
+        if v.Kind() == reflect.Slice && v.IsNil() {
+            return nil, true
+        }
+        out := make([]interface{}, v.Len())
+        for i := range out {
+            item, ok := dump(v.Index(i), depth+1)
+            if !ok {
+                return nil, false
+            }
+            out[i] = item
+        }
+        return out, true
+    case reflect.Map:
+        out := make(map[string]interface{}, v.Len())
+        iter := v.MapRange()
+        for iter.Next() {
+            item, ok := dump(iter.Value(), depth+1)
+            if !ok {
+                return nil, false
+            }
+            out[fmt.Sprint(iter.Key())] = item
+        }
+        return out, true
+    }
+    // Funcs, channels, complex numbers, and unsafe pointers have no
+    // structured representation
+    return nil, false
+}
+`
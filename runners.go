@@ -0,0 +1,75 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+)
+
+// Runner retention modes; see ExecutionConfig.KeepRunners
+const (
+    KeepRunnersFailures = "failures" // runners that failed to build or run (default)
+    KeepRunnersAlways   = "always"
+    KeepRunnersNever    = "never"
+)
+
+// Stages a runner can fail in
+const (
+    RunnerStageBuild = "build"
+    RunnerStageRun   = "run"
+)
+
+// defaultRunnerDir is the directory runners are kept in within a
+// configured artifacts directory
+const defaultRunnerDir = "runners"
+
+// RunnerRecord points to the kept source of a generated runner
+type RunnerRecord struct {
+    Function string `json:"function"`
+    // Stage is the stage the runner failed in, empty if it succeeded
+    Stage string `json:"stage,omitempty"`
+    // Dir holds the runner's main.go and, for a failed runner, the
+    // compiler's or the runner's output in build.log or run.log
+    Dir string `json:"dir"`
+}
+
+// keepRunner copies the source of a runner that is about to be removed,
+// along with the output of the stage it failed in, so failures can be
+// debugged. Successful runners are only kept when always configured, and
+// none are kept without a runner directory.
+func (g *GitHubFunctionExtractor) keepRunner(function FunctionInfo, source, stage string, output []byte) {
+    mode := g.execConfig.KeepRunners
+    if mode == KeepRunnersNever || g.execConfig.RunnerDir == "" || (stage == "" && mode != KeepRunnersAlways) {
+        return
+    }
+    dir, err := g.saveRunner(function, source, stage, output)
+    if err != nil {
+        g.logger.Printf("Failed to keep runner of %s: %v", function.Name, err)
+        return
+    }
+    g.logger.Printf("Kept runner of %s in %s", function.Name, dir)
+    g.runners = append(g.runners, RunnerRecord{Function: function.Name, Stage: stage, Dir: dir})
+    g.keptRunners = append(g.keptRunners, dir)
+}
+
+// saveRunner writes a runner's files to a directory of their own under
+// the repository's runner directory and returns it
+func (g *GitHubFunctionExtractor) saveRunner(function FunctionInfo, source, stage string, output []byte) (string, error) {
+    parent := filepath.Join(g.execConfig.RunnerDir, repoSlug(g.repoURL))
+    if err := os.MkdirAll(parent, 0755); err != nil {
+        return "", fmt.Errorf("failed to create runner directory: %w", err)
+    }
+    dir, err := os.MkdirTemp(parent, safeIdentifier(function.Name)+"-*")
+    if err != nil {
+        return "", fmt.Errorf("failed to create runner directory: %w", err)
+    }
+    if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(source), 0644); err != nil {
+        return "", fmt.Errorf("failed to write runner source: %w", err)
+    }
+    if stage != "" && len(output) > 0 {
+        if err := os.WriteFile(filepath.Join(dir, stage+".log"), output, 0644); err != nil {
+            return "", fmt.Errorf("failed to write %s output: %w", stage, err)
+        }
+    }
+    return dir, nil
+}
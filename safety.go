@@ -0,0 +1,69 @@
+package main
+
+import (
+    "strings"
+)
+
+// Safety levels assigned by classifySafety
+const (
+    SafetyLow    = "low"
+    SafetyMedium = "medium"
+    SafetyHigh   = "high"
+)
+
+// riskyCalls maps qualified calls (or whole packages, ending in ".") to the
+// risk they indicate and its level
+var riskyCalls = []struct {
+    prefix string
+    risk   string
+    level  string
+}{
+    {"os/exec.", "runs external commands", SafetyHigh},
+    {"syscall.", "makes raw system calls", SafetyHigh},
+    {"os.StartProcess", "starts processes", SafetyHigh},
+    {"os.Exit", "exits the process", SafetyHigh},
+    {"net.", "opens network connections", SafetyHigh},
+    {"net/http.", "makes HTTP requests", SafetyHigh},
+    {"os.Remove", "deletes files", SafetyHigh},
+    {"os.RemoveAll", "deletes files", SafetyHigh},
+    {"os.Create", "writes files", SafetyMedium},
+    {"os.WriteFile", "writes files", SafetyMedium},
+    {"io/ioutil.WriteFile", "writes files", SafetyMedium},
+    {"os.OpenFile", "writes files", SafetyMedium},
+    {"os.Mkdir", "creates directories", SafetyMedium},
+    {"os.MkdirAll", "creates directories", SafetyMedium},
+    {"os.Rename", "moves files", SafetyMedium},
+    {"os.Chmod", "changes file permissions", SafetyMedium},
+    {"os.Setenv", "changes the environment", SafetyMedium},
+    {"os.Chdir", "changes the working directory", SafetyMedium},
+}
+
+// Safety is a static classification of what executing a function may do
+type Safety struct {
+    Level   string   `json:"level"`
+    Reasons []string `json:"reasons,omitempty"`
+}
+
+// classifySafety classifies a function by the calls in its own body. It is
+// a heuristic: calls made through methods or unexported helpers are not
+// followed, so a low level means no risky call was seen, not a guarantee.
+func classifySafety(function FunctionInfo) Safety {
+    safety := Safety{Level: SafetyLow}
+    seen := make(map[string]bool)
+
+    for _, call := range function.Calls {
+        for _, risky := range riskyCalls {
+            if call != risky.prefix && !(strings.HasSuffix(risky.prefix, ".") && strings.HasPrefix(call, risky.prefix)) {
+                continue
+            }
+            if !seen[risky.risk] {
+                seen[risky.risk] = true
+                safety.Reasons = append(safety.Reasons, risky.risk+" ("+call+")")
+            }
+            if risky.level == SafetyHigh || safety.Level == SafetyLow {
+                safety.Level = risky.level
+            }
+        }
+    }
+    return safety
+}
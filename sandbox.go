@@ -0,0 +1,50 @@
+package main
+
+import (
+    "fmt"
+    "sync"
+)
+
+// Sandbox modes accepted in ExecutionConfig.Sandbox
+const (
+    // SandboxNone runs the runner without isolation
+    SandboxNone = "none"
+    // SandboxAuto isolates the runner's network when the host supports it
+    // and falls back to no isolation otherwise
+    SandboxAuto = "auto"
+    // SandboxNetNS requires network isolation; executions fail without it
+    SandboxNetNS = "netns"
+)
+
+var (
+    netnsOnce sync.Once
+    netnsErr  error
+)
+
+// netnsAvailable probes once whether runners can be started in a new
+// network namespace
+func netnsAvailable() error {
+    netnsOnce.Do(func() {
+        netnsErr = probeNetns()
+    })
+    return netnsErr
+}
+
+// resolveSandbox decides whether runners are started in an isolated
+// network namespace under the given mode, along with a short report of the
+// isolation in effect for the run summary
+func resolveSandbox(mode string) (bool, string, error) {
+    switch mode {
+    case "", SandboxNone:
+        return false, "none", nil
+    case SandboxAuto, SandboxNetNS:
+        if err := netnsAvailable(); err != nil {
+            if mode == SandboxNetNS {
+                return false, "", fmt.Errorf("network isolation unavailable: %w", err)
+            }
+            return false, fmt.Sprintf("none (network isolation unavailable: %v)", err), nil
+        }
+        return true, "network namespace (no network access)", nil
+    }
+    return false, "", fmt.Errorf("unknown sandbox mode %q", mode)
+}
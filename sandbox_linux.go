@@ -0,0 +1,38 @@
+//go:build linux
+
+package main
+
+import (
+    "fmt"
+    "os"
+    "os/exec"
+    "syscall"
+)
+
+// netnsAttrs starts a process in new user and network namespaces. The
+// network namespace only has a loopback interface, which is down, so the
+// process cannot reach any host. The user namespace maps the current user
+// to itself so that unprivileged users can create the network namespace.
+func netnsAttrs() *syscall.SysProcAttr {
+    if os.Geteuid() == 0 {
+        return &syscall.SysProcAttr{Cloneflags: syscall.CLONE_NEWNET}
+    }
+    return &syscall.SysProcAttr{
+        Cloneflags:                 syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET,
+        UidMappings:                []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}},
+        GidMappings:                []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}},
+        GidMappingsEnableSetgroups: false,
+    }
+}
+
+// probeNetns starts a trivial process in a new network namespace to check
+// that the kernel and its settings (e.g. unprivileged user namespaces) allow it
+func probeNetns() error {
+    path, err := exec.LookPath("true")
+    if err != nil {
+        return fmt.Errorf("failed to probe network namespaces: %w", err)
+    }
+    cmd := exec.Command(path)
+    cmd.SysProcAttr = netnsAttrs()
+    return cmd.Run()
+}
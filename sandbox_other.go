@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+import (
+    "errors"
+    "syscall"
+)
+
+// netnsAttrs is not supported outside Linux
+func netnsAttrs() *syscall.SysProcAttr {
+    return nil
+}
+
+// probeNetns reports that network namespaces are Linux-only
+func probeNetns() error {
+    return errors.New("network namespaces are only available on Linux")
+}
@@ -0,0 +1,601 @@
+package main
+
+import (
+    "context"
+    "go/ast"
+    "go/build"
+    "go/importer"
+    "go/parser"
+    "go/token"
+    "go/types"
+    "path"
+    "path/filepath"
+    "reflect"
+    "strings"
+)
+
+// Shapes of predicted schemas, following how storage lays outputs out
+const (
+    // SchemaShapeObjects is an object or array of objects, stored with a
+    // column per key
+    SchemaShapeObjects = "objects"
+    // SchemaShapeValues is an array of primitives, stored in a value column
+    SchemaShapeValues = "values"
+    // SchemaShapeData is a single value, stored in a data column
+    SchemaShapeData = "data"
+    // SchemaShapeDynamic is an output whose layout depends on its values,
+    // such as a map or an interface
+    SchemaShapeDynamic = "dynamic"
+)
+
+// maxEmbeddingDepth bounds how deep embedded structs are followed
+const maxEmbeddingDepth = 8
+
+// PredictedSchema is the table layout a function's output is expected to
+// have, predicted from its return type before it runs
+type PredictedSchema struct {
+    Shape string `json:"shape"`
+    // Struct is the named struct type the objects of an objects schema
+    // come from
+    Struct  string            `json:"struct,omitempty"`
+    Columns []PredictedColumn `json:"columns,omitempty"`
+}
+
+// PredictedColumn is one column of a predicted schema
+type PredictedColumn struct {
+    // Name is the column the JSON key Key is stored in
+    Name string `json:"name"`
+    Key  string `json:"key"`
+    // Type is the column's PostgreSQL type, or empty when the field's
+    // values may have any type
+    Type string `json:"type,omitempty"`
+    // Field is the struct field the key is written from, as a path through
+    // embedded structs ("Base.ID"), and GoType the field's Go type
+    Field  string `json:"field,omitempty"`
+    GoType string `json:"go_type,omitempty"`
+}
+
+// column returns the predicted column of an output key, if any
+func (s *PredictedSchema) column(key string) (PredictedColumn, bool) {
+    if s != nil {
+        for _, column := range s.Columns {
+            if column.Key == key {
+                return column, true
+            }
+        }
+    }
+    return PredictedColumn{}, false
+}
+
+// Precreatable reports whether a table can be created from the schema
+// before the function runs
+func (s *PredictedSchema) Precreatable() bool {
+    if s.Shape == SchemaShapeDynamic {
+        return false
+    }
+    for _, column := range s.Columns {
+        if column.Type == "" {
+            return false
+        }
+    }
+    return true
+}
+
+// hasJSONB reports whether any column holds arrays or objects
+func (s *PredictedSchema) hasJSONB() bool {
+    for _, column := range s.Columns {
+        if column.Type == "JSONB" {
+            return true
+        }
+    }
+    return false
+}
+
+// columnMapping returns the mapping of tables created from an objects
+// schema, which maps keys to columns like buildColumnMapping
+func (s *PredictedSchema) columnMapping() *ColumnMapping {
+    record := make(map[string]interface{}, len(s.Columns))
+    for _, column := range s.Columns {
+        record[column.Key] = nil
+    }
+    mapping := buildColumnMapping([]map[string]interface{}{record}, nil)
+    for _, column := range s.Columns {
+        if column.Type != "" {
+            mapping.Types[column.Key] = column.Type
+        }
+    }
+    return mapping
+}
+
+// fits reports whether an output can be stored in a table created from the
+// schema: it must have the schema's shape, and objects may only have the
+// schema's keys with values of their column's type
+func (s *PredictedSchema) fits(data interface{}, typeOf func(interface{}) string) bool {
+    if outputShape(data) != s.Shape {
+        return false
+    }
+    if s.Shape != SchemaShapeObjects {
+        return true
+    }
+    // objectRecords leaves out the items of arrays that are not objects
+    records, _ := objectRecords(data)
+    if items, ok := data.([]interface{}); ok && len(items) != len(records) {
+        return false
+    }
+    columns := make(map[string]string, len(s.Columns))
+    for _, column := range s.Columns {
+        columns[column.Key] = column.Type
+    }
+    for _, record := range records {
+        for key, value := range record {
+            columnType, ok := columns[key]
+            if !ok || (value != nil && typeOf(value) != columnType) {
+                return false
+            }
+        }
+    }
+    return true
+}
+
+// outputShape returns the shape storage gives an output
+func outputShape(data interface{}) string {
+    if _, ok := objectRecords(data); ok {
+        return SchemaShapeObjects
+    }
+    if items, ok := data.([]interface{}); ok && len(items) > 0 {
+        return SchemaShapeValues
+    }
+    return SchemaShapeData
+}
+
+// schemaChecker type-checks the packages of a checkout to predict output
+// schemas. Packages of the module are checked from source, the standard
+// library is imported from export data, and other imports stand in as
+// empty packages, leaving the types that come from them unknown.
+type schemaChecker struct {
+    fset       *token.FileSet
+    repoPath   string
+    modulePath string
+    std        types.Importer
+    packages   map[string]*types.Package
+}
+
+// newSchemaChecker returns a checker for the current checkout, sharing the
+// standard library imports of the previous one
+func (g *GitHubFunctionExtractor) newSchemaChecker() *schemaChecker {
+    checker := &schemaChecker{
+        repoPath:   g.repoPath,
+        modulePath: g.modulePath,
+        packages:   make(map[string]*types.Package),
+    }
+    if g.schemas != nil {
+        checker.fset, checker.std = g.schemas.fset, g.schemas.std
+    } else {
+        checker.fset = token.NewFileSet()
+        checker.std = importer.ForCompiler(checker.fset, "gc", nil)
+    }
+    return checker
+}
+
+// Import implements types.Importer
+func (c *schemaChecker) Import(importPath string) (*types.Package, error) {
+    if pkg, ok := c.packages[importPath]; ok {
+        return pkg, nil
+    }
+    // Placeholders also break import cycles of broken repositories
+    c.packages[importPath] = types.NewPackage(importPath, path.Base(importPath))
+
+    var pkg *types.Package
+    if rel, ok := c.moduleDir(importPath); ok {
+        pkg = c.check(filepath.Join(c.repoPath, filepath.FromSlash(rel)), importPath)
+    } else if !strings.Contains(strings.Split(importPath, "/")[0], ".") {
+        pkg, _ = c.std.Import(importPath)
+    }
+    if pkg == nil {
+        pkg = c.packages[importPath]
+        pkg.MarkComplete()
+    }
+    c.packages[importPath] = pkg
+    return pkg, nil
+}
+
+// moduleDir returns the directory of a package of the module, relative to
+// the repository root
+func (c *schemaChecker) moduleDir(importPath string) (string, bool) {
+    if c.modulePath == "" {
+        return "", false
+    }
+    if importPath == c.modulePath {
+        return ".", true
+    }
+    rel, ok := strings.CutPrefix(importPath, c.modulePath+"/")
+    return rel, ok
+}
+
+// check type-checks the package in a directory from the files the host
+// build includes, tolerating errors; it returns nil if the directory has
+// no package
+func (c *schemaChecker) check(dir, importPath string) *types.Package {
+    bp, err := build.ImportDir(dir, 0)
+    if err != nil {
+        return nil
+    }
+    var files []*ast.File
+    for _, name := range bp.GoFiles {
+        file, _ := parser.ParseFile(c.fset, filepath.Join(dir, name), nil, 0)
+        if file != nil {
+            files = append(files, file)
+        }
+    }
+    config := types.Config{Importer: c, Error: func(error) {}, FakeImportC: true}
+    pkg, _ := config.Check(importPath, c.fset, files, nil)
+    return pkg
+}
+
+// predict returns the predicted schema of a function's output, or nil if
+// its result cannot be told from its signature
+func (c *schemaChecker) predict(function FunctionInfo) *PredictedSchema {
+    if function.Kind == FunctionKindClosure || isWriterFunction(function) {
+        return nil
+    }
+    if c.modulePath == "" {
+        return nil
+    }
+    pkg, _ := c.Import(packageImportPath(c.modulePath, path.Dir(function.RelativePath)))
+    object := pkg.Scope().Lookup(function.Name)
+    if object == nil {
+        return nil
+    }
+    signature, ok := object.Type().Underlying().(*types.Signature)
+    if !ok {
+        return nil
+    }
+
+    // The output is the one result besides a trailing error
+    results := signature.Results()
+    n := results.Len()
+    if n > 0 && isErrorType(results.At(n-1).Type()) {
+        n--
+    }
+    if n != 1 {
+        return nil
+    }
+    // Types of the function's own package are written unqualified
+    qualifier := func(other *types.Package) string {
+        if other == pkg {
+            return ""
+        }
+        return other.Name()
+    }
+    return predictSchema(results.At(0).Type(), qualifier)
+}
+
+// predictSchema maps a result type to the schema of its JSON encoding.
+// Runners capture values with unexported fields through reflection rather
+// than JSON, so their layout is left dynamic.
+func predictSchema(t types.Type, qualifier types.Qualifier) *PredictedSchema {
+    t = dereference(t)
+    if typeHidesFields(t, 0) {
+        return &PredictedSchema{Shape: SchemaShapeDynamic}
+    }
+    if _, ok := primitiveType(t); ok {
+        return &PredictedSchema{Shape: SchemaShapeData, Columns: []PredictedColumn{{Name: "data", Key: "data", Type: "JSONB"}}}
+    }
+    if hasMethod(t, "MarshalJSON") {
+        return &PredictedSchema{Shape: SchemaShapeDynamic}
+    }
+
+    switch u := t.Underlying().(type) {
+    case *types.Struct:
+        return objectSchema(t, u, qualifier)
+    case *types.Slice, *types.Array:
+        elem := dereference(u.(interface{ Elem() types.Type }).Elem())
+        if _, ok := primitiveType(elem); ok {
+            return &PredictedSchema{Shape: SchemaShapeValues, Columns: []PredictedColumn{{Name: "value", Key: "value", Type: "TEXT"}}}
+        }
+        if s, ok := elem.Underlying().(*types.Struct); ok && !hasMethod(elem, "MarshalJSON") {
+            return objectSchema(elem, s, qualifier)
+        }
+    }
+    return &PredictedSchema{Shape: SchemaShapeDynamic}
+}
+
+// objectSchema returns the schema of the JSON objects of a struct type t
+func objectSchema(t types.Type, s *types.Struct, qualifier types.Qualifier) *PredictedSchema {
+    schema := &PredictedSchema{Shape: SchemaShapeObjects}
+    if _, named := t.(*types.Named); named {
+        schema.Struct = types.TypeString(t, qualifier)
+    }
+    for _, field := range jsonFields(s, 0, "", qualifier) {
+        schema.Columns = append(schema.Columns, PredictedColumn{
+            Key:    field.key,
+            Type:   field.sqlType,
+            Field:  field.path,
+            GoType: field.goType,
+        })
+    }
+    mapping := schema.columnMapping()
+    columns := make(map[string]PredictedColumn, len(schema.Columns))
+    for _, column := range schema.Columns {
+        column.Name = mapping.Columns[column.Key]
+        columns[column.Key] = column
+    }
+    // Columns follow the table's column order
+    schema.Columns = schema.Columns[:0]
+    for _, key := range mapping.Keys {
+        schema.Columns = append(schema.Columns, columns[key])
+    }
+    return schema
+}
+
+// jsonField is a key of a struct's JSON encoding
+type jsonField struct {
+    key     string
+    sqlType string
+    path    string
+    goType  string
+    depth   int
+    tagged  bool
+}
+
+// jsonFields lists the keys encoding/json writes for a struct, following
+// its tags and promoting the fields of embedded structs. Of fields sharing
+// a key the shallowest wins, and among equally deep ones the only tagged
+// one; otherwise the key is dropped, as encoding/json does.
+func jsonFields(s *types.Struct, depth int, prefix string, qualifier types.Qualifier) []jsonField {
+    var candidates []jsonField
+    for i := 0; i < s.NumFields(); i++ {
+        field := s.Field(i)
+        tag := reflect.StructTag(s.Tag(i)).Get("json")
+        if tag == "-" {
+            continue
+        }
+        name, options, _ := strings.Cut(tag, ",")
+
+        if field.Embedded() && name == "" {
+            t := field.Type()
+            _, pointer := t.(*types.Pointer)
+            t = dereference(t)
+            if embedded, ok := t.Underlying().(*types.Struct); ok {
+                if pointer && !field.Exported() {
+                    continue
+                }
+                if depth < maxEmbeddingDepth {
+                    candidates = append(candidates, jsonFields(embedded, depth+1, prefix+field.Name()+".", qualifier)...)
+                }
+                continue
+            }
+        }
+        if !field.Exported() {
+            continue
+        }
+        if name == "" {
+            name = field.Name()
+        }
+        sqlType := columnType(field.Type())
+        for _, option := range strings.Split(options, ",") {
+            if option == "string" && sqlType != "JSONB" {
+                sqlType = "TEXT"
+            }
+        }
+        candidates = append(candidates, jsonField{
+            key:     name,
+            sqlType: sqlType,
+            path:    prefix + field.Name(),
+            goType:  types.TypeString(field.Type(), qualifier),
+            depth:   depth,
+            tagged:  tag != "",
+        })
+    }
+    if depth > 0 {
+        return candidates
+    }
+
+    var fields []jsonField
+    seen := make(map[string]bool)
+    for _, candidate := range candidates {
+        if seen[candidate.key] {
+            continue
+        }
+        seen[candidate.key] = true
+        if field, ok := dominantField(candidates, candidate.key); ok {
+            fields = append(fields, field)
+        }
+    }
+    return fields
+}
+
+// dominantField returns the field encoding/json writes for a key shared by
+// several fields, and false if none dominates the others
+func dominantField(candidates []jsonField, key string) (jsonField, bool) {
+    var shallowest []jsonField
+    for _, candidate := range candidates {
+        if candidate.key != key {
+            continue
+        }
+        if len(shallowest) > 0 && candidate.depth > shallowest[0].depth {
+            continue
+        }
+        if len(shallowest) > 0 && candidate.depth < shallowest[0].depth {
+            shallowest = shallowest[:0]
+        }
+        shallowest = append(shallowest, candidate)
+    }
+    if len(shallowest) == 1 {
+        return shallowest[0], true
+    }
+    var tagged []jsonField
+    for _, candidate := range shallowest {
+        if candidate.tagged {
+            tagged = append(tagged, candidate)
+        }
+    }
+    if len(tagged) == 1 {
+        return tagged[0], true
+    }
+    return jsonField{}, false
+}
+
+// columnType returns the column type of a struct field: the type of a
+// primitive, JSONB for arrays and objects, and empty when it depends on
+// the value
+func columnType(t types.Type) string {
+    t = dereference(t)
+    if sqlType, ok := primitiveType(t); ok {
+        return sqlType
+    }
+    if hasMethod(t, "MarshalJSON") {
+        return ""
+    }
+    switch t.Underlying().(type) {
+    case *types.Struct, *types.Slice, *types.Array, *types.Map:
+        return "JSONB"
+    }
+    return ""
+}
+
+// typeHidesFields reports whether values of a type may have unexported
+// struct fields, which JSON would drop
+func typeHidesFields(t types.Type, depth int) bool {
+    if depth > maxEmbeddingDepth {
+        return false
+    }
+    switch u := t.Underlying().(type) {
+    case *types.Pointer:
+        return typeHidesFields(u.Elem(), depth+1)
+    case *types.Slice:
+        return typeHidesFields(u.Elem(), depth+1)
+    case *types.Array:
+        return typeHidesFields(u.Elem(), depth+1)
+    case *types.Map:
+        return typeHidesFields(u.Elem(), depth+1)
+    case *types.Struct:
+        for i := 0; i < u.NumFields(); i++ {
+            if !u.Field(i).Exported() || typeHidesFields(u.Field(i).Type(), depth+1) {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// primitiveType returns the column type of a type encoded as a JSON
+// primitive: booleans, numbers, and strings, including []byte and text
+// marshalers
+func primitiveType(t types.Type) (string, bool) {
+    if hasMethod(t, "MarshalJSON") {
+        return "", false
+    }
+    if hasMethod(t, "MarshalText") {
+        return "TEXT", true
+    }
+    switch u := t.Underlying().(type) {
+    case *types.Basic:
+        switch {
+        case u.Info()&types.IsBoolean != 0:
+            return "BOOLEAN", true
+        case u.Info()&(types.IsInteger|types.IsFloat) != 0:
+            return "NUMERIC", true
+        case u.Info()&types.IsString != 0:
+            return "TEXT", true
+        }
+    case *types.Slice:
+        if basic, ok := u.Elem().Underlying().(*types.Basic); ok && basic.Kind() == types.Byte {
+            return "TEXT", true
+        }
+    }
+    return "", false
+}
+
+// dereference returns the type a pointer points to, or the type itself
+func dereference(t types.Type) types.Type {
+    for {
+        pointer, ok := t.Underlying().(*types.Pointer)
+        if !ok {
+            return t
+        }
+        t = pointer.Elem()
+    }
+}
+
+// hasMethod reports whether a type or a pointer to it has a method
+func hasMethod(t types.Type, name string) bool {
+    if _, isInterface := t.Underlying().(*types.Interface); isInterface {
+        return false
+    }
+    return types.NewMethodSet(types.NewPointer(t)).Lookup(nil, name) != nil ||
+        types.NewMethodSet(t).Lookup(nil, name) != nil
+}
+
+// isErrorType reports whether a type is the error interface
+func isErrorType(t types.Type) bool {
+    return types.Identical(t, types.Universe.Lookup("error").Type())
+}
+
+// predictSchemas attaches the predicted output schema to the functions of a
+// file
+func (g *GitHubFunctionExtractor) predictSchemas(functions []FunctionInfo) {
+    for i := range functions {
+        functions[i].PredictedSchema = g.schemas.predict(functions[i])
+    }
+}
+
+// precreateTable queues the creation of a function's table from its
+// predicted schema before the function runs, so the schema does not depend
+// on the output. Failures are left to storeOutput, which creates the table
+// from the output instead.
+func (g *GitHubFunctionExtractor) precreateTable(ctx context.Context, function FunctionInfo, result *ProcessingResult) {
+    schema := function.PredictedSchema
+    if !g.execConfig.PrecreateTables || g.dbConfig.DedupPayloads || schema == nil || !schema.Precreatable() {
+        return
+    }
+    // Flattening replaces the JSONB columns of nested objects
+    if g.dbConfig.Flatten.Enabled() && schema.hasJSONB() {
+        return
+    }
+    g.enqueueStore(result, func(stored *ProcessingResult) {
+        g.createPredictedTable(ctx, function, schema, stored)
+    })
+}
+
+// createPredictedTable creates a function's table from its predicted
+// schema, remembering the schema for storeOutput
+func (g *GitHubFunctionExtractor) createPredictedTable(ctx context.Context, function FunctionInfo, schema *PredictedSchema, result *ProcessingResult) {
+    tableName := g.claimTable(function, g.tableNameFor(function.Name), result)
+
+    var sample interface{}
+    var mapping *ColumnMapping
+    switch schema.Shape {
+    case SchemaShapeObjects:
+        mapping = schema.columnMapping()
+    case SchemaShapeValues:
+        sample = []interface{}{nil}
+    }
+    if err := g.storage.CreateTable(ctx, tableName, sample, mapping); err != nil {
+        g.logger.Printf("Failed to pre-create table %s: %v", tableName, err)
+        return
+    }
+    g.logger.Printf("Pre-created table %s from the predicted schema of %s", tableName, function.Name)
+    g.precreated[tableName] = schema
+    result.CreatedTables = appendMissing(result.CreatedTables, []string{tableName})
+}
+
+// precreatedMapping returns the column mapping of a function's pre-created
+// table if its output fits the table. An output that does not fit is
+// recorded as a schema mismatch and gets a table created from the output.
+func (g *GitHubFunctionExtractor) precreatedMapping(function FunctionInfo, tableName string, data interface{}, result *ProcessingResult) (*ColumnMapping, bool) {
+    schema, ok := g.precreated[tableName]
+    if !ok {
+        return nil, false
+    }
+    delete(g.precreated, tableName)
+    if !schema.fits(data, postgreSQLType) {
+        g.logger.Printf("Output of %s does not match its predicted schema, recreating table %s", function.Name, tableName)
+        result.SchemaMismatches = append(result.SchemaMismatches, function.Name)
+        return nil, false
+    }
+    if schema.Shape == SchemaShapeObjects {
+        return schema.columnMapping(), true
+    }
+    return nil, true
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "regexp"
+)
+
+// Seed fixture formats
+const (
+    SeedFormatSQL  = "sql"
+    SeedFormatJSON = "json"
+)
+
+// defaultSeedSchema is the schema fixtures target when none is given
+const defaultSeedSchema = "floq_seed"
+
+// seedSchemaPattern restricts schema names to plain identifiers
+var seedSchemaPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SeedFixture is a repository's JSON fixture file
+type SeedFixture struct {
+    Schema     string      `json:"schema"`
+    Repository string      `json:"repository"`
+    RunID      string      `json:"run_id"`
+    Tables     []SeedTable `json:"tables"`
+}
+
+// SeedTable holds the rows of one fixture table
+type SeedTable struct {
+    Name    string                   `json:"name"`
+    Columns []string                 `json:"columns"`
+    Rows    []map[string]interface{} `json:"rows"`
+}
+
+// RunSeed implements the seed subcommand: it executes the selected
+// data-producing functions of each repository and writes one idempotent
+// fixture per repository targeting a named schema, either an SQL script
+// that recreates the tables or a JSON fixture file. Cancelling ctx stops
+// the repository being processed.
+func RunSeed(ctx context.Context, config Config, artifacts *RunArtifacts, args []string, out io.Writer) error {
+    fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+    schema := fs.String("schema", defaultSeedSchema, "schema the fixtures create and fill")
+    format := fs.String("format", SeedFormatSQL, "fixture format: sql or json")
+    outDir := fs.String("out", "", "directory for the fixtures (default: seed in the run's artifacts directory)")
+    name := fs.String("name", "", "regular expression selecting functions by name")
+    var returns, classes stringList
+    fs.Var(&returns, "returns", "type the selected functions must return (repeatable)")
+    fs.Var(&classes, "class", "function class to select (repeatable)")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    if !seedSchemaPattern.MatchString(*schema) {
+        return fmt.Errorf("invalid schema name %q", *schema)
+    }
+    if *format != SeedFormatSQL && *format != SeedFormatJSON {
+        return fmt.Errorf("unsupported seed format %q", *format)
+    }
+    repositories := fs.Args()
+    if len(repositories) == 0 {
+        return fmt.Errorf("no repositories to seed from")
+    }
+
+    query := FunctionQuery{Returns: returns, Classes: classes}
+    if *name != "" {
+        pattern, err := regexp.Compile(*name)
+        if err != nil {
+            return fmt.Errorf("invalid name pattern: %w", err)
+        }
+        query.Name = pattern
+    }
+
+    dir := *outDir
+    if dir == "" {
+        dir = filepath.Join(artifacts.Dir, "seed")
+    }
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return fmt.Errorf("failed to create seed directory: %w", err)
+    }
+
+    // Every output becomes its own table, which the fixtures recreate from
+    // scratch each time they are loaded
+    config.DedupPayloads = false
+    if *format == SeedFormatSQL {
+        config.Driver = DriverSQL
+        config.DumpDir = dir
+        config.DumpSchema = *schema
+    }
+
+    failed := 0
+    for _, repoURL := range repositories {
+        extractor := NewGitHubFunctionExtractor(config)
+        extractor.SetRunID(artifacts.RunID)
+        extractor.SetSelection(&query)
+        var memory *MemoryStorage
+        if *format == SeedFormatJSON {
+            memory = NewMemoryStorage()
+            extractor.SetStorage(memory)
+        }
+
+        result, err := extractor.ProcessRepository(ctx, repoURL)
+        if err != nil {
+            fmt.Fprintf(out, "❌ %s: %v\n", repoURL, err)
+            failed++
+            continue
+        }
+
+        path := result.SQLDump
+        if memory != nil {
+            path = filepath.Join(dir, repoSlug(repoURL)+".json")
+            if err := saveSeedFixture(path, *schema, repoURL, artifacts.RunID, memory); err != nil {
+                fmt.Fprintf(out, "❌ %s: %v\n", repoURL, err)
+                failed++
+                continue
+            }
+        }
+        fmt.Fprintf(out, "🌱 %s: %d tables from %d functions → %s\n",
+            repoURL, len(result.CreatedTables), len(result.ExecutedFunctions), path)
+    }
+
+    if failed > 0 {
+        return fmt.Errorf("%d of %d repositories failed", failed, len(repositories))
+    }
+    return nil
+}
+
+// saveSeedFixture writes the tables held by memory as a JSON fixture
+func saveSeedFixture(filename, schema, repoURL, runID string, memory *MemoryStorage) error {
+    fixture := SeedFixture{Schema: schema, Repository: repoURL, RunID: runID}
+    for _, name := range memory.TableNames() {
+        table, _ := memory.Table(name)
+        fixture.Tables = append(fixture.Tables, SeedTable{Name: name, Columns: table.Columns, Rows: table.Rows})
+    }
+
+    data, err := json.MarshalIndent(fixture, "", "  ")
+    if err != nil {
+        return fmt.Errorf("failed to marshal fixture: %w", err)
+    }
+    if err := os.WriteFile(filename, data, 0644); err != nil {
+        return fmt.Errorf("failed to write fixture: %w", err)
+    }
+    return nil
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+    "crypto/ed25519"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "os"
+    "path/filepath"
+    "runtime"
+    "time"
+
+    "golang.org/x/mod/semver"
+)
+
+// updateTimeout bounds fetching the release manifest and downloading a
+// release binary
+const updateTimeout = 10 * time.Minute
+
+// UpdateConfig configures where the self-update command finds releases and
+// how it verifies them
+type UpdateConfig struct {
+    // URL is the release manifest listing the published versions
+    URL string `json:"url,omitempty"`
+    // PublicKey is the base64 Ed25519 key releases are signed with;
+    // binaries without a valid signature are rejected. Installing without
+    // it takes self-update -insecure.
+    PublicKey string `json:"public_key,omitempty"`
+    // Version pins the version self-update installs instead of the latest
+    Version string `json:"version,omitempty"`
+}
+
+// ReleaseManifest is the document served at UpdateConfig.URL
+type ReleaseManifest struct {
+    Releases []Release `json:"releases"`
+}
+
+// Release is a published version of the CLI
+type Release struct {
+    Version string `json:"version"`
+    // Assets maps "os/arch", e.g. "linux/amd64", to the platform's binary
+    Assets map[string]ReleaseAsset `json:"assets"`
+}
+
+// ReleaseAsset is a release binary. URL may be relative to the manifest,
+// SHA256 is the hex digest of the binary, and Signature the base64
+// Ed25519 signature of the raw digest.
+type ReleaseAsset struct {
+    URL       string `json:"url"`
+    SHA256    string `json:"sha256"`
+    Signature string `json:"signature,omitempty"`
+}
+
+// RunVersion implements the version subcommand, printing the build
+// metadata of the binary
+func RunVersion(config Config, args []string, out io.Writer) error {
+    fs := flag.NewFlagSet("version", flag.ContinueOnError)
+    asJSON := fs.Bool("json", false, "print the build metadata as JSON")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    info := readBuildInfo(config)
+    if *asJSON {
+        encoder := json.NewEncoder(out)
+        encoder.SetIndent("", "  ")
+        return encoder.Encode(info)
+    }
+    fmt.Fprintf(out, "floq-v1 %s\n", info.Version)
+    if info.Revision != "" {
+        modified := ""
+        if info.Modified {
+            modified = " (modified)"
+        }
+        fmt.Fprintf(out, "  revision: %s%s\n", info.Revision, modified)
+    }
+    if info.BuildTime != "" {
+        fmt.Fprintf(out, "  built:    %s\n", info.BuildTime)
+    }
+    fmt.Fprintf(out, "  go:       %s %s\n", info.GoVersion, info.Platform)
+    return nil
+}
+
+// RunSelfUpdate implements the self-update subcommand: it looks up the
+// latest or pinned release in the manifest, verifies the binary's checksum
+// and signature, and replaces the running executable with it
+func RunSelfUpdate(config Config, args []string, out io.Writer) error {
+    fs := flag.NewFlagSet("self-update", flag.ContinueOnError)
+    check := fs.Bool("check", false, "only report whether an update is available")
+    pinned := fs.String("version", config.Update.Version, "version to install instead of the latest")
+    force := fs.Bool("force", false, "install even when the version is current or the binary is a development build")
+    insecure := fs.Bool("insecure", false, "install releases without verifying their signature when no public key is configured")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+    if config.Update.URL == "" {
+        return fmt.Errorf("no release manifest configured; set update.url or FLOQ_UPDATE_URL")
+    }
+    if err := requireHTTPS(config.Update.URL, "release manifest"); err != nil {
+        return err
+    }
+    var publicKey ed25519.PublicKey
+    if config.Update.PublicKey != "" {
+        key, err := base64.StdEncoding.DecodeString(config.Update.PublicKey)
+        if err != nil || len(key) != ed25519.PublicKeySize {
+            return fmt.Errorf("update public key must be a base64 Ed25519 public key")
+        }
+        publicKey = key
+    }
+
+    client := providerHTTPClient(updateTimeout)
+    manifest, err := fetchReleaseManifest(client, config.Update.URL)
+    if err != nil {
+        return err
+    }
+    platform := runtime.GOOS + "/" + runtime.GOARCH
+    release, err := selectRelease(manifest, *pinned, platform)
+    if err != nil {
+        return err
+    }
+
+    switch {
+    case release.Version == version && !*force:
+        fmt.Fprintf(out, "floq-v1 %s is up to date\n", version)
+        return nil
+    case *pinned == "" && semver.IsValid(version) && semver.Compare(release.Version, version) < 0 && !*force:
+        fmt.Fprintf(out, "floq-v1 %s is newer than the latest release %s\n", version, release.Version)
+        return nil
+    case *check:
+        fmt.Fprintf(out, "floq-v1 %s is available (current: %s)\n", release.Version, version)
+        return nil
+    case !semver.IsValid(version) && !*force:
+        return fmt.Errorf("floq-v1 %s is a development build; use -force to replace it with %s", version, release.Version)
+    }
+
+    executable, err := os.Executable()
+    if err != nil {
+        return fmt.Errorf("failed to locate the executable: %w", err)
+    }
+    if executable, err = filepath.EvalSymlinks(executable); err != nil {
+        return fmt.Errorf("failed to locate the executable: %w", err)
+    }
+    if publicKey == nil && !*insecure {
+        return fmt.Errorf("no update public key configured to verify releases with; set update.public_key or FLOQ_UPDATE_PUBLIC_KEY, or use -insecure to install an unsigned release")
+    }
+    asset := release.Assets[platform]
+    assetURL, err := resolveAssetURL(config.Update.URL, asset.URL)
+    if err != nil {
+        return err
+    }
+    if err := requireHTTPS(assetURL, "release binary"); err != nil {
+        return err
+    }
+    if publicKey == nil {
+        fmt.Fprintf(out, "Warning: installing floq-v1 %s without verifying its signature\n", release.Version)
+    }
+
+    fmt.Fprintf(out, "Downloading floq-v1 %s for %s\n", release.Version, platform)
+    downloaded, err := downloadRelease(client, assetURL, filepath.Dir(executable), asset, publicKey)
+    if err != nil {
+        return err
+    }
+    if err := replaceExecutable(executable, downloaded); err != nil {
+        os.Remove(downloaded)
+        return err
+    }
+    fmt.Fprintf(out, "Updated %s from %s to %s\n", executable, version, release.Version)
+    return nil
+}
+
+// fetchReleaseManifest downloads and parses the release manifest
+func fetchReleaseManifest(client *http.Client, manifestURL string) (*ReleaseManifest, error) {
+    resp, err := client.Get(manifestURL)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch release manifest: %w", err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("failed to fetch release manifest: %s", resp.Status)
+    }
+    var manifest ReleaseManifest
+    if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+        return nil, fmt.Errorf("failed to parse release manifest: %w", err)
+    }
+    return &manifest, nil
+}
+
+// selectRelease returns the pinned release, or the latest stable release
+// with a binary for the platform
+func selectRelease(manifest *ReleaseManifest, pinned, platform string) (Release, error) {
+    var latest *Release
+    for i, release := range manifest.Releases {
+        if _, ok := release.Assets[platform]; !ok || !semver.IsValid(release.Version) {
+            continue
+        }
+        if pinned != "" {
+            if semver.Compare(release.Version, pinned) == 0 {
+                return release, nil
+            }
+            continue
+        }
+        if semver.Prerelease(release.Version) != "" {
+            continue
+        }
+        if latest == nil || semver.Compare(release.Version, latest.Version) > 0 {
+            latest = &manifest.Releases[i]
+        }
+    }
+    if pinned != "" {
+        return Release{}, fmt.Errorf("release %s has no binary for %s", pinned, platform)
+    }
+    if latest == nil {
+        return Release{}, fmt.Errorf("no release has a binary for %s", platform)
+    }
+    return *latest, nil
+}
+
+// requireHTTPS rejects URLs that are not fetched over HTTPS, which would
+// let anyone on the path replace the manifest or the binary
+func requireHTTPS(rawURL, what string) error {
+    u, err := url.Parse(rawURL)
+    if err != nil {
+        return fmt.Errorf("invalid %s URL: %w", what, err)
+    }
+    if u.Scheme != "https" || u.Host == "" {
+        return fmt.Errorf("%s URL %s must be an https URL", what, rawURL)
+    }
+    return nil
+}
+
+// resolveAssetURL resolves an asset URL relative to the manifest's
+func resolveAssetURL(manifestURL, assetURL string) (string, error) {
+    base, err := url.Parse(manifestURL)
+    if err != nil {
+        return "", fmt.Errorf("invalid release manifest URL: %w", err)
+    }
+    ref, err := url.Parse(assetURL)
+    if err != nil {
+        return "", fmt.Errorf("invalid release asset URL: %w", err)
+    }
+    return base.ResolveReference(ref).String(), nil
+}
+
+// downloadRelease downloads a release binary into dir, next to the
+// executable it replaces, and verifies it; it returns the file's path
+func downloadRelease(client *http.Client, assetURL, dir string, asset ReleaseAsset, publicKey ed25519.PublicKey) (string, error) {
+    want, err := hex.DecodeString(asset.SHA256)
+    if err != nil || len(want) != sha256.Size {
+        return "", fmt.Errorf("release has no valid sha256 checksum")
+    }
+    var signature []byte
+    if publicKey != nil {
+        if signature, err = base64.StdEncoding.DecodeString(asset.Signature); err != nil || len(signature) != ed25519.SignatureSize {
+            return "", fmt.Errorf("release has no valid signature")
+        }
+    }
+
+    resp, err := client.Get(assetURL)
+    if err != nil {
+        return "", fmt.Errorf("failed to download release: %w", err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return "", fmt.Errorf("failed to download release: %s", resp.Status)
+    }
+
+    file, err := os.CreateTemp(dir, ".floq-update-*")
+    if err != nil {
+        return "", fmt.Errorf("failed to create update file: %w", err)
+    }
+    hash := sha256.New()
+    _, err = io.Copy(io.MultiWriter(file, hash), resp.Body)
+    if closeErr := file.Close(); err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        os.Remove(file.Name())
+        return "", fmt.Errorf("failed to download release: %w", err)
+    }
+
+    digest := hash.Sum(nil)
+    if hex.EncodeToString(digest) != hex.EncodeToString(want) {
+        os.Remove(file.Name())
+        return "", fmt.Errorf("release checksum mismatch: got %x, want %s", digest, asset.SHA256)
+    }
+    if publicKey != nil && !ed25519.Verify(publicKey, digest, signature) {
+        os.Remove(file.Name())
+        return "", fmt.Errorf("release signature does not verify with the configured public key")
+    }
+    if err := os.Chmod(file.Name(), 0755); err != nil {
+        os.Remove(file.Name())
+        return "", fmt.Errorf("failed to make update executable: %w", err)
+    }
+    return file.Name(), nil
+}
+
+// replaceExecutable moves the new binary over the executable. The old one
+// is moved aside first, as Windows cannot overwrite a running executable,
+// and restored if the new one cannot take its place.
+func replaceExecutable(executable, replacement string) error {
+    old := executable + ".old"
+    os.Remove(old)
+    if err := os.Rename(executable, old); err != nil {
+        return fmt.Errorf("failed to move the current executable aside: %w", err)
+    }
+    if err := os.Rename(replacement, executable); err != nil {
+        os.Rename(old, executable)
+        return fmt.Errorf("failed to install the update: %w", err)
+    }
+    // A running Windows executable cannot be removed; the next update does
+    os.Remove(old)
+    return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+    "crypto/ed25519"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "testing"
+)
+
+func TestSelectRelease(t *testing.T) {
+    binary := map[string]ReleaseAsset{"linux/amd64": {URL: "floq-v1"}}
+    manifest := &ReleaseManifest{Releases: []Release{
+        {Version: "v1.2.0", Assets: binary},
+        {Version: "v1.10.0", Assets: binary},
+        {Version: "v1.11.0-rc.1", Assets: binary},
+        {Version: "v1.12.0", Assets: map[string]ReleaseAsset{"darwin/arm64": {URL: "floq-v1"}}},
+        {Version: "1.13.0", Assets: binary},
+    }}
+    tests := []struct {
+        name     string
+        pinned   string
+        platform string
+        want     string
+        err      string
+    }{
+        {"latest stable by semver", "", "linux/amd64", "v1.10.0", ""},
+        {"pinned", "v1.2.0", "linux/amd64", "v1.2.0", ""},
+        {"pinned prerelease", "v1.11.0-rc.1", "linux/amd64", "v1.11.0-rc.1", ""},
+        {"pinned without the platform", "v1.12.0", "linux/amd64", "", "release v1.12.0 has no binary for linux/amd64"},
+        {"pinned missing", "v9.0.0", "linux/amd64", "", "release v9.0.0 has no binary"},
+        {"other platform", "", "darwin/arm64", "v1.12.0", ""},
+        {"no binary for the platform", "", "windows/amd64", "", "no release has a binary for windows/amd64"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            release, err := selectRelease(manifest, tt.pinned, tt.platform)
+            if tt.err != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.err) {
+                    t.Fatalf("selectRelease returned %v, want an error containing %q", err, tt.err)
+                }
+                return
+            }
+            if err != nil || release.Version != tt.want {
+                t.Fatalf("selectRelease returned %s, %v, want %s", release.Version, err, tt.want)
+            }
+        })
+    }
+}
+
+func TestDownloadRelease(t *testing.T) {
+    content := []byte("floq-v1 release binary")
+    sum := sha256.Sum256(content)
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write(content)
+    }))
+    defer server.Close()
+
+    public, private, err := ed25519.GenerateKey(nil)
+    if err != nil {
+        t.Fatalf("failed to generate key: %v", err)
+    }
+    otherPublic, _, err := ed25519.GenerateKey(nil)
+    if err != nil {
+        t.Fatalf("failed to generate key: %v", err)
+    }
+    signature := base64.StdEncoding.EncodeToString(ed25519.Sign(private, sum[:]))
+    wrongSum := sha256.Sum256([]byte("something else"))
+
+    tests := []struct {
+        name  string
+        asset ReleaseAsset
+        key   ed25519.PublicKey
+        err   string
+    }{
+        {"checksum only", ReleaseAsset{SHA256: hex.EncodeToString(sum[:])}, nil, ""},
+        {"signed", ReleaseAsset{SHA256: hex.EncodeToString(sum[:]), Signature: signature}, public, ""},
+        {"checksum mismatch", ReleaseAsset{SHA256: hex.EncodeToString(wrongSum[:]), Signature: signature}, public, "release checksum mismatch"},
+        {"invalid checksum", ReleaseAsset{SHA256: "abc"}, nil, "no valid sha256 checksum"},
+        {"unsigned", ReleaseAsset{SHA256: hex.EncodeToString(sum[:])}, public, "no valid signature"},
+        {"signed with another key", ReleaseAsset{SHA256: hex.EncodeToString(sum[:]), Signature: signature}, otherPublic, "signature does not verify"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            dir := t.TempDir()
+            path, err := downloadRelease(server.Client(), server.URL, dir, tt.asset, tt.key)
+            if tt.err != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.err) {
+                    t.Fatalf("downloadRelease returned %v, want an error containing %q", err, tt.err)
+                }
+                if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+                    t.Errorf("a rejected download left %d files behind", len(entries))
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("downloadRelease: %v", err)
+            }
+            if data, err := os.ReadFile(path); err != nil || string(data) != string(content) {
+                t.Errorf("downloaded %q, %v, want the release binary", data, err)
+            }
+        })
+    }
+}
+
+func TestRequireHTTPS(t *testing.T) {
+    for _, rawURL := range []string{"https://releases.example.com/floq/manifest.json", "https://127.0.0.1:8443/manifest.json"} {
+        if err := requireHTTPS(rawURL, "release manifest"); err != nil {
+            t.Errorf("requireHTTPS(%s) = %v, want nil", rawURL, err)
+        }
+    }
+    for _, rawURL := range []string{"http://releases.example.com/manifest.json", "file:///tmp/manifest.json", "releases.example.com/manifest.json", "https:///manifest.json"} {
+        if err := requireHTTPS(rawURL, "release manifest"); err == nil {
+            t.Errorf("requireHTTPS(%s) = nil, want an error", rawURL)
+        }
+    }
+}
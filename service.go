@@ -0,0 +1,535 @@
+package main
+
+import (
+    "context"
+    "crypto/subtle"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "net"
+    "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// Service mode defaults
+const (
+    defaultListenAddr        = "127.0.0.1:8080"
+    defaultWorkers           = 2
+    defaultHeartbeatInterval = 15
+    defaultStaleAfter        = 120
+    defaultMaxAttempts       = 3
+    defaultPollInterval      = 5
+)
+
+// ServiceConfig controls the long-running service mode. Intervals are in seconds.
+type ServiceConfig struct {
+    ListenAddr        string `json:"listen_addr"`
+    Workers           int    `json:"workers"`
+    HeartbeatInterval int    `json:"heartbeat_interval"`
+    StaleAfter        int    `json:"stale_after"`
+    MaxAttempts       int    `json:"max_attempts"`
+    PollInterval      int    `json:"poll_interval"`
+    // Token is the bearer token required to enqueue jobs. Without one the
+    // service only listens on a loopback address, as anyone reaching the
+    // API can make it clone and run arbitrary code.
+    Token string `json:"token,omitempty"`
+    // Autoscale replaces the fixed worker count with one adjusted to the
+    // host's load, free memory and database write latency
+    Autoscale AutoscaleConfig `json:"autoscale"`
+}
+
+// Service runs queued repository jobs with a pool of workers and exposes an
+// HTTP API for enqueueing and inspecting them
+type Service struct {
+    mu       sync.Mutex
+    config   Config
+    resize   chan struct{}
+    db       *sql.DB
+    // replica serves the read-only API when a read replica is configured
+    replica  *sql.DB
+    jobs     *JobStore
+    webhooks *WebhookStore
+    events   *EventHub
+    // stats accounts for the jobs processed by this instance's workers
+    stats    *StatsAggregator
+    logger   *log.Logger
+
+    // target is the autoscaled worker count, zero until first used
+    target       int
+    busy         atomic.Int32
+    writeLatency latencyMeter
+}
+
+// NewService connects to the database and prepares the job queue
+func NewService(config Config) (*Service, error) {
+    db, err := openDatabase(config.DatabaseConfig)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open database connection: %w", err)
+    }
+    if err := db.Ping(); err != nil {
+        db.Close()
+        return nil, fmt.Errorf("failed to ping database: %w", err)
+    }
+
+    logger := log.New(logOutput, "[SERVICE] ", log.LstdFlags|log.Lshortfile)
+
+    partitions, err := NewPartitionStrategy(config.DatabaseConfig)
+    if err != nil {
+        db.Close()
+        return nil, err
+    }
+
+    jobs, err := NewJobStore(db, partitions)
+    if err != nil {
+        db.Close()
+        return nil, err
+    }
+
+    webhooks, err := NewWebhookStore(db, logger)
+    if err != nil {
+        db.Close()
+        return nil, err
+    }
+
+    // Job listings are read from the replica to keep the primary free
+    var replica *sql.DB
+    if config.ReplicaDSN != "" {
+        replica, _, err = openReadDatabase(config.DatabaseConfig)
+        if err != nil {
+            db.Close()
+            return nil, fmt.Errorf("failed to open replica connection: %w", err)
+        }
+        jobs.SetReader(replica)
+        logger.Println("Serving job listings from the read replica")
+    }
+
+    return &Service{
+        config:   config,
+        resize:   make(chan struct{}, 1),
+        db:       db,
+        replica:  replica,
+        jobs:     jobs,
+        webhooks: webhooks,
+        events:   NewEventHub(),
+        stats:    NewStatsAggregator(),
+        logger:   logger,
+    }, nil
+}
+
+// currentConfig returns the configuration in effect, which may change
+// between jobs when the config file is reloaded
+func (s *Service) currentConfig() Config {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.config
+}
+
+// Close releases the service's database connections
+func (s *Service) Close() error {
+    if s.replica != nil {
+        s.replica.Close()
+    }
+    return s.db.Close()
+}
+
+// Run starts the HTTP API, the workers, and the stale job reaper, and
+// blocks until ctx is cancelled. When configFile is set, it is watched and
+// reloaded with load.
+func (s *Service) Run(ctx context.Context, configFile string, load func() (Config, error)) error {
+    cfg := s.currentConfig().Service
+    hostname, _ := os.Hostname()
+
+    server := &http.Server{Addr: cfg.ListenAddr, Handler: s.routes()}
+    server.RegisterOnShutdown(s.events.Close)
+    serverErr := make(chan error, 1)
+    go func() {
+        s.logger.Printf("Listening on %s", cfg.ListenAddr)
+        if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+            serverErr <- err
+        }
+    }()
+
+    var wg sync.WaitGroup
+    wg.Add(1)
+    go func() {
+        defer wg.Done()
+        s.superviseWorkers(ctx, hostname)
+    }()
+
+    wg.Add(1)
+    go func() {
+        defer wg.Done()
+        s.reaper(ctx)
+    }()
+
+    wg.Add(1)
+    go func() {
+        defer wg.Done()
+        s.autoscale(ctx)
+    }()
+
+    if configFile != "" && load != nil {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            s.watchConfig(ctx, configFile, load)
+        }()
+    }
+
+    var err error
+    select {
+    case <-ctx.Done():
+    case err = <-serverErr:
+    }
+
+    s.logger.Println("Shutting down")
+    shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+    server.Shutdown(shutdownCtx)
+    wg.Wait()
+    return err
+}
+
+// superviseWorkers keeps the configured number of workers running,
+// starting or stopping workers when a config reload or the autoscaler
+// changes the count. Stopped workers finish their current job first.
+func (s *Service) superviseWorkers(ctx context.Context, hostname string) {
+    var workers sync.WaitGroup
+    var cancels []context.CancelFunc
+    next := 0
+
+    scale := func() {
+        want := s.workerTarget()
+        for len(cancels) < want {
+            workerCtx, cancel := context.WithCancel(ctx)
+            workerID := fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), next)
+            next++
+            cancels = append(cancels, cancel)
+            workers.Add(1)
+            go func() {
+                defer workers.Done()
+                s.worker(workerCtx, workerID)
+            }()
+        }
+        for len(cancels) > want {
+            cancels[len(cancels)-1]()
+            cancels = cancels[:len(cancels)-1]
+        }
+    }
+
+    scale()
+    for {
+        select {
+        case <-ctx.Done():
+            workers.Wait()
+            return
+        case <-s.resize:
+            scale()
+        }
+    }
+}
+
+// worker repeatedly claims and processes queued jobs
+func (s *Service) worker(ctx context.Context, workerID string) {
+    for {
+        pollInterval := time.Duration(s.currentConfig().Service.PollInterval) * time.Second
+
+        start := time.Now()
+        job, err := s.jobs.Claim(workerID)
+        s.writeLatency.Observe(start)
+        if err != nil {
+            s.logger.Printf("Worker %s: %v", workerID, err)
+        }
+        if job == nil {
+            select {
+            case <-ctx.Done():
+                return
+            case <-time.After(pollInterval):
+            }
+            continue
+        }
+
+        // Workers finish their current job when the service stops
+        s.processJob(context.WithoutCancel(ctx), job)
+
+        if ctx.Err() != nil {
+            return
+        }
+    }
+}
+
+// processJob runs a claimed job under ctx while a background goroutine
+// sends heartbeats
+func (s *Service) processJob(ctx context.Context, job *Job) {
+    s.busy.Add(1)
+    defer s.busy.Add(-1)
+    s.logger.Printf("Worker %s processing job %d (%s), attempt %d",
+        job.WorkerID, job.ID, job.RepoURL, job.Attempts)
+
+    var mu sync.Mutex
+    progress := "starting"
+    config := s.currentConfig()
+
+    extractor := NewGitHubFunctionExtractor(config)
+    extractor.SetRunID(fmt.Sprintf("job-%d-attempt-%d", job.ID, job.Attempts))
+    extractor.SetProgressFunc(func(stage string) {
+        mu.Lock()
+        progress = stage
+        mu.Unlock()
+    })
+    extractor.SetEventFunc(func(event RunEvent) {
+        event.JobID = job.ID
+        s.events.Publish(event)
+    })
+    s.events.Publish(RunEvent{Type: EventRepositoryStarted, JobID: job.ID, RepoURL: job.RepoURL})
+
+    done := make(chan struct{})
+    go func() {
+        ticker := time.NewTicker(time.Duration(config.Service.HeartbeatInterval) * time.Second)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-done:
+                return
+            case <-ticker.C:
+                mu.Lock()
+                stage := progress
+                mu.Unlock()
+                start := time.Now()
+                if err := s.jobs.Heartbeat(job, stage); err != nil {
+                    s.logger.Printf("Job %d heartbeat failed: %v", job.ID, err)
+                }
+                s.writeLatency.Observe(start)
+            }
+        }
+    }()
+
+    result, err := extractor.ProcessRepository(ctx, job.RepoURL)
+    close(done)
+    s.stats.Worker(job.WorkerID).Record(result, err == nil)
+
+    if err != nil {
+        s.logger.Printf("Job %d failed: %v", job.ID, err)
+        s.events.Publish(RunEvent{Type: EventRepositoryFinished, JobID: job.ID, RepoURL: job.RepoURL,
+            Status: JobFailed, Error: err.Error()})
+        final, failErr := s.jobs.Fail(job, err, config.Service.MaxAttempts)
+        if failErr != nil {
+            s.logger.Printf("Job %d: %v", job.ID, failErr)
+            return
+        }
+        // Retried jobs only notify once they finish for good
+        if final {
+            s.webhooks.Notify(WebhookEvent{
+                Event:      "repository.finished",
+                JobID:      job.ID,
+                RepoURL:    job.RepoURL,
+                Status:     JobFailed,
+                Error:      err.Error(),
+                Result:     result,
+                FinishedAt: time.Now(),
+            })
+        }
+        return
+    }
+
+    if err := s.jobs.Complete(job, result); err != nil {
+        s.logger.Printf("Job %d: %v", job.ID, err)
+        return
+    }
+    s.logger.Printf("Job %d completed", job.ID)
+    s.events.Publish(RunEvent{Type: EventRepositoryFinished, JobID: job.ID, RepoURL: job.RepoURL, Status: JobSucceeded})
+
+    s.webhooks.Notify(WebhookEvent{
+        Event:      "repository.finished",
+        JobID:      job.ID,
+        RepoURL:    job.RepoURL,
+        Status:     JobSucceeded,
+        Result:     result,
+        FinishedAt: time.Now(),
+    })
+}
+
+// reaper periodically re-queues jobs whose workers stopped sending heartbeats
+func (s *Service) reaper(ctx context.Context) {
+    for {
+        cfg := s.currentConfig().Service
+        select {
+        case <-ctx.Done():
+            return
+        case <-time.After(time.Duration(cfg.HeartbeatInterval) * time.Second):
+            requeued, failed, err := s.jobs.ReapStale(time.Duration(cfg.StaleAfter)*time.Second, cfg.MaxAttempts)
+            if err != nil {
+                s.logger.Printf("Reaper: %v", err)
+                continue
+            }
+            if requeued > 0 || failed > 0 {
+                s.logger.Printf("Reaper: requeued %d stale jobs, failed %d after %d attempts",
+                    requeued, failed, cfg.MaxAttempts)
+            }
+        }
+    }
+}
+
+// routes builds the service's HTTP API
+func (s *Service) routes() http.Handler {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/jobs", s.requireToken(s.handleJobs))
+    mux.HandleFunc("/webhooks", s.handleWebhooks)
+    mux.HandleFunc("/events", s.requireToken(s.handleEvents))
+    mux.HandleFunc("/healthz", s.handleHealthz)
+    mux.HandleFunc("/readyz", s.handleReadyz)
+    mux.HandleFunc("/buildinfo", s.requireToken(s.handleBuildInfo))
+    mux.HandleFunc("/stats", s.requireToken(s.handleStats))
+    s.dashboardRoutes(mux)
+    return mux
+}
+
+// requireToken wraps a handler so it only serves requests carrying the
+// service token, when one is set. Every endpoint but the health checks
+// takes it, since job results hold the processed repositories' code.
+func (s *Service) requireToken(handler http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if s.authorized(w, r) {
+            handler(w, r)
+        }
+    }
+}
+
+// handleJobs enqueues a repository (POST) or lists recent jobs (GET)
+func (s *Service) handleJobs(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodPost:
+        var req struct {
+            RepoURL string `json:"repo_url"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RepoURL == "" {
+            http.Error(w, "request body must be JSON with a repo_url", http.StatusBadRequest)
+            return
+        }
+        job, err := s.jobs.Enqueue(req.RepoURL)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        writeJSON(w, http.StatusCreated, job)
+
+    case http.MethodGet:
+        jobs, err := s.jobs.List(100)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        writeJSON(w, http.StatusOK, jobs)
+
+    default:
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+    }
+}
+
+// handleWebhooks registers (POST), lists (GET), or removes (DELETE ?id=N)
+// callback URLs notified when each repository finishes
+func (s *Service) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+    // Webhooks receive every job's results, so managing them always takes
+    // the token
+    if s.currentConfig().Service.Token == "" {
+        http.Error(w, "managing webhooks requires a service token", http.StatusForbidden)
+        return
+    }
+    if !s.authorized(w, r) {
+        return
+    }
+
+    switch r.Method {
+    case http.MethodPost:
+        var req struct {
+            URL    string `json:"url"`
+            Secret string `json:"secret"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.URL == "" || req.Secret == "" {
+            http.Error(w, "request body must be JSON with a url and a secret", http.StatusBadRequest)
+            return
+        }
+        if err := validateWebhookURL(req.URL); err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        hook, err := s.webhooks.Register(req.URL, req.Secret)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        hook.Secret = ""
+        writeJSON(w, http.StatusCreated, hook)
+
+    case http.MethodGet:
+        hooks, err := s.webhooks.List()
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        for i := range hooks {
+            hooks[i].Secret = ""
+        }
+        writeJSON(w, http.StatusOK, hooks)
+
+    case http.MethodDelete:
+        id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+        if err != nil {
+            http.Error(w, "id query parameter is required", http.StatusBadRequest)
+            return
+        }
+        if err := s.webhooks.Unregister(id); err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        w.WriteHeader(http.StatusNoContent)
+
+    default:
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+    }
+}
+
+// authorized reports whether a request carries the service token, answering
+// 401 when it does not. Without a token the service only listens on
+// loopback, and every request is authorized.
+func (s *Service) authorized(w http.ResponseWriter, r *http.Request) bool {
+    token := s.currentConfig().Service.Token
+    if token == "" {
+        return true
+    }
+    given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+    if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+        w.Header().Set("WWW-Authenticate", `Bearer realm="floq"`)
+        http.Error(w, "missing or invalid bearer token", http.StatusUnauthorized)
+        return false
+    }
+    return true
+}
+
+// isLoopbackAddr reports whether a listen address only accepts local
+// connections; an empty host listens on every interface
+func isLoopbackAddr(addr string) bool {
+    host, _, err := net.SplitHostPort(addr)
+    if err != nil {
+        return false
+    }
+    if host == "localhost" {
+        return true
+    }
+    ip := net.ParseIP(host)
+    return ip != nil && ip.IsLoopback()
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(v)
+}
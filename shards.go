@@ -0,0 +1,175 @@
+package main
+
+import (
+    "database/sql"
+    "fmt"
+    "hash/fnv"
+    "strings"
+)
+
+// shardsSchema creates the table recording the shard holding each
+// repository's generated tables; it lives in the primary database next to
+// floq_jobs
+const shardsSchema = `CREATE TABLE IF NOT EXISTS floq_shards (
+    repository  TEXT PRIMARY KEY,
+    shard       TEXT NOT NULL,
+    assigned_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+// ShardConfig is a database the generated tables of some repositories are
+// stored in. Empty fields take the value of the primary database settings.
+type ShardConfig struct {
+    // Name identifies the shard in floq_shards; it defaults to shardN
+    // after the shard's position and should be set before shards are
+    // reordered
+    Name     string   `json:"name,omitempty"`
+    Host     string   `json:"host,omitempty"`
+    Port     string   `json:"port,omitempty"`
+    Database string   `json:"database,omitempty"`
+    User     string   `json:"user,omitempty"`
+    Password string   `json:"password,omitempty"`
+    SSLMode  string   `json:"sslmode,omitempty"`
+    Hosts    []string `json:"hosts,omitempty"`
+    // ReplicaDSN is the shard's read replica; the primary database's
+    // replica is never used for a shard
+    ReplicaDSN string `json:"replica_dsn,omitempty"`
+}
+
+// getEnvShards parses a comma-separated environment variable of shards in
+// the form [name=]host[:port][/database], or returns defaultValue if unset
+func getEnvShards(key string, defaultValue []ShardConfig) []ShardConfig {
+    entries := getEnvList(key, nil)
+    if entries == nil {
+        return defaultValue
+    }
+    var shards []ShardConfig
+    for _, entry := range entries {
+        var shard ShardConfig
+        if name, rest, ok := strings.Cut(entry, "="); ok {
+            shard.Name, entry = name, rest
+        }
+        entry, shard.Database, _ = strings.Cut(entry, "/")
+        shard.Host, shard.Port, _ = strings.Cut(entry, ":")
+        shards = append(shards, shard)
+    }
+    return shards
+}
+
+// shardName returns the name of the i-th shard
+func (c DatabaseConfig) shardName(i int) string {
+    if c.Shards[i].Name != "" {
+        return c.Shards[i].Name
+    }
+    return fmt.Sprintf("shard%d", i)
+}
+
+// shardDatabase returns the settings for connecting to the i-th shard
+func (c DatabaseConfig) shardDatabase(i int) DatabaseConfig {
+    shard := c.Shards[i]
+    config := c
+    config.Shards = nil
+    if shard.Host != "" || len(shard.Hosts) > 0 {
+        config.Host, config.Hosts = shard.Host, shard.Hosts
+    }
+    config.Port = orDefault(shard.Port, config.Port)
+    config.Database = orDefault(shard.Database, config.Database)
+    config.User = orDefault(shard.User, config.User)
+    config.Password = orDefault(shard.Password, config.Password)
+    config.SSLMode = orDefault(shard.SSLMode, config.SSLMode)
+    config.ReplicaDSN = shard.ReplicaDSN
+    return config
+}
+
+// validateShards checks the shard settings
+func (c DatabaseConfig) validateShards() error {
+    if len(c.Shards) == 0 {
+        return nil
+    }
+    if c.Driver != "" && c.Driver != DriverPostgres {
+        return fmt.Errorf("database shards require the %s driver", DriverPostgres)
+    }
+    names := make(map[string]bool)
+    for i := range c.Shards {
+        name := c.shardName(i)
+        if names[name] {
+            return fmt.Errorf("duplicate database shard %q", name)
+        }
+        names[name] = true
+    }
+    return nil
+}
+
+// hashShard returns the shard a repository is placed on when it has none yet
+func hashShard(repoURL string, shards int) int {
+    h := fnv.New32a()
+    h.Write([]byte(repoURL))
+    return int(h.Sum32() % uint32(shards))
+}
+
+// ShardMap assigns repositories to shards, keeping the assignments in the
+// primary database so a repository stays on its shard when shards are added
+type ShardMap struct {
+    config DatabaseConfig
+    db     *sql.DB
+}
+
+// OpenShardMap connects to the primary database holding the assignments
+func OpenShardMap(config DatabaseConfig) (*ShardMap, error) {
+    db, err := openDatabase(config)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open database connection: %w", err)
+    }
+    if err := ensureTable(db, "floq_shards", shardsSchema); err != nil {
+        db.Close()
+        return nil, fmt.Errorf("failed to create shard table: %w", err)
+    }
+    return &ShardMap{config: config, db: db}, nil
+}
+
+// Close closes the connection to the primary database
+func (m *ShardMap) Close() error {
+    return m.db.Close()
+}
+
+// Assign returns the index of the shard holding the repository's tables,
+// placing the repository by the hash of its URL the first time it is seen
+func (m *ShardMap) Assign(repoURL string) (int, error) {
+    name := m.config.shardName(hashShard(repoURL, len(m.config.Shards)))
+    _, err := m.db.Exec(
+        "INSERT INTO floq_shards (repository, shard) VALUES ($1, $2) ON CONFLICT (repository) DO NOTHING",
+        repoURL, name)
+    if err != nil {
+        return 0, fmt.Errorf("failed to assign shard: %w", err)
+    }
+
+    // Another run may have placed the repository first
+    if err := m.db.QueryRow("SELECT shard FROM floq_shards WHERE repository = $1", repoURL).Scan(&name); err != nil {
+        return 0, fmt.Errorf("failed to look up shard: %w", err)
+    }
+    for i := range m.config.Shards {
+        if m.config.shardName(i) == name {
+            return i, nil
+        }
+    }
+    return 0, fmt.Errorf("repository is assigned to shard %q, which is not configured", name)
+}
+
+// shardStorageConfig returns the settings of the database the repository's
+// tables are stored in and the name of its shard, which is empty without
+// sharding
+func (g *GitHubFunctionExtractor) shardStorageConfig() (DatabaseConfig, string, error) {
+    if len(g.dbConfig.Shards) == 0 {
+        return g.dbConfig, "", nil
+    }
+    shards, err := OpenShardMap(g.dbConfig)
+    if err != nil {
+        return DatabaseConfig{}, "", err
+    }
+    defer shards.Close()
+
+    i, err := shards.Assign(g.repoURL)
+    if err != nil {
+        return DatabaseConfig{}, "", err
+    }
+    return g.dbConfig.shardDatabase(i), g.dbConfig.shardName(i), nil
+}
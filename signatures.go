@@ -0,0 +1,168 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "go/ast"
+    "strings"
+)
+
+// signaturesSchema creates the function_signatures table
+const signaturesSchema = `CREATE TABLE IF NOT EXISTS function_signatures (
+    id         BIGSERIAL PRIMARY KEY,
+    repository TEXT NOT NULL,
+    ref        TEXT,
+    run_id     TEXT,
+    package    TEXT NOT NULL,
+    function   TEXT NOT NULL,
+    kind       TEXT NOT NULL,
+    position   INTEGER NOT NULL,
+    name       TEXT,
+    type       TEXT NOT NULL,
+    variadic   BOOLEAN NOT NULL,
+    documented BOOLEAN,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+// Signature is the normalized form of a function's parameters and return
+// types, with one field per parameter and per result
+type Signature struct {
+    Parameters []SignatureField `json:"parameters,omitempty"`
+    Results    []SignatureField `json:"results,omitempty"`
+}
+
+// buildSignature normalizes a function type, giving every name of a
+// grouped field such as (a, b int) its own field
+func (g *GitHubFunctionExtractor) buildSignature(funcType *ast.FuncType) *Signature {
+    fields := func(list *ast.FieldList) []SignatureField {
+        if list == nil {
+            return nil
+        }
+        var fields []SignatureField
+        for _, field := range list.List {
+            expr, variadic := field.Type, false
+            if ellipsis, ok := expr.(*ast.Ellipsis); ok {
+                expr, variadic = ellipsis.Elt, true
+            }
+            fieldType := g.formatType(expr)
+            if len(field.Names) == 0 {
+                fields = append(fields, SignatureField{Position: len(fields), Type: fieldType, Variadic: variadic})
+                continue
+            }
+            for _, name := range field.Names {
+                fields = append(fields, SignatureField{Position: len(fields), Name: name.Name, Type: fieldType, Variadic: variadic})
+            }
+        }
+        return fields
+    }
+    return &Signature{Parameters: fields(funcType.Params), Results: fields(funcType.Results)}
+}
+
+// signature returns the function's normalized signature, deriving it from
+// Parameters and ReturnTypes for functions from results written before it
+// was recorded
+func (f FunctionInfo) signature() *Signature {
+    if f.Signature != nil {
+        return f.Signature
+    }
+    signature := &Signature{}
+    for i, param := range f.Parameters {
+        field := SignatureField{Position: i, Type: param}
+        if name, fieldType, ok := strings.Cut(param, " "); ok {
+            field.Name, field.Type = name, fieldType
+        }
+        signature.Parameters = append(signature.Parameters, field)
+    }
+    for i, returnType := range f.ReturnTypes {
+        signature.Results = append(signature.Results, SignatureField{Position: i, Type: returnType})
+    }
+    return signature
+}
+
+// signatureRows returns the function_signatures rows of a function,
+// cross-checking its named parameters against its doc comment
+func signatureRows(ref PayloadRef, function FunctionInfo) []SignatureRow {
+    signature := function.signature()
+    var documented []string
+    if doc := function.docComment(); doc != nil {
+        documented = doc.Params
+    }
+    rows := make([]SignatureRow, 0, len(signature.Parameters)+len(signature.Results))
+    for _, field := range signature.Parameters {
+        row := SignatureRow{PayloadRef: ref, Kind: SignatureParameter, SignatureField: field}
+        if field.Name != "" && field.Name != "_" {
+            mentioned := containsString(documented, field.Name)
+            row.Documented = &mentioned
+        }
+        rows = append(rows, row)
+    }
+    for _, field := range signature.Results {
+        rows = append(rows, SignatureRow{PayloadRef: ref, Kind: SignatureResult, SignatureField: field})
+    }
+    return rows
+}
+
+// storeSignatures stores the signatures of the repository's extracted
+// functions in the function_signatures table
+func (g *GitHubFunctionExtractor) storeSignatures(ctx context.Context, result *ProcessingResult) {
+    var rows []SignatureRow
+    for _, function := range result.ProcessedFunctions {
+        rows = append(rows, signatureRows(g.payloadRef(function), function)...)
+    }
+    if len(rows) == 0 {
+        return
+    }
+    if err := g.storage.StoreSignatures(ctx, rows); err != nil {
+        result.Errors = append(result.Errors, fmt.Sprintf("Failed to store signatures: %v", err))
+        return
+    }
+    g.logger.Printf("Stored %d signature fields of %d functions", len(rows), len(result.ProcessedFunctions))
+}
+
+// StoreSignatures appends signature rows to the function_signatures table
+func (p *PostgresStorage) StoreSignatures(ctx context.Context, rows []SignatureRow) error {
+    if err := p.ensureTable(ctx, "function_signatures", signaturesSchema); err != nil {
+        return fmt.Errorf("failed to create function_signatures table: %w", err)
+    }
+    return p.inTransaction(ctx, func(exec sqlExecer) error {
+        for _, row := range rows {
+            _, err := exec.ExecContext(ctx,
+                "INSERT INTO function_signatures (repository, ref, run_id, package, function, kind, position, name, type, variadic, documented) "+
+                    "VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, $6, $7, NULLIF($8, ''), $9, $10, $11)",
+                row.Repository, row.Ref, row.RunID, row.Package, row.Function,
+                row.Kind, row.Position, row.Name, row.Type, row.Variadic, row.DocumentedColumn())
+            if err != nil {
+                return fmt.Errorf("failed to store signature of %s: %w", row.Function, err)
+            }
+        }
+        return nil
+    })
+}
+
+// StoreSignatures appends signature rows to the function_signatures table
+func (m *MemoryStorage) StoreSignatures(ctx context.Context, rows []SignatureRow) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    table, ok := m.tables[signaturesTable]
+    if !ok {
+        table = &MemoryTable{Columns: []string{"repository", "ref", "run_id", "package", "function", "kind", "position", "name", "type", "variadic", "documented"}}
+        m.tables[signaturesTable] = table
+    }
+    for _, row := range rows {
+        table.Rows = append(table.Rows, map[string]interface{}{
+            "repository": row.Repository,
+            "ref":        row.Ref,
+            "run_id":     row.RunID,
+            "package":    row.Package,
+            "function":   row.Function,
+            "kind":       row.Kind,
+            "position":   row.Position,
+            "name":       row.Name,
+            "type":       row.Type,
+            "variadic":   row.Variadic,
+            "documented": row.DocumentedColumn(),
+        })
+    }
+    return nil
+}
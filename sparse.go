@@ -0,0 +1,116 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "os/exec"
+    "path"
+    "strings"
+
+    "github.com/go-git/go-git/v5"
+)
+
+// SparseCloner is implemented by git clients that can fetch only some
+// paths of a repository
+type SparseCloner interface {
+    // CloneSparse clones repoURL into dir, checking out only the given
+    // repository-relative directories and the root go.mod and go.sum
+    CloneSparse(ctx context.Context, repoURL, dir string, paths []string) (*git.Repository, error)
+}
+
+// sparsePatterns turns repository-relative directories into go-git sparse
+// checkout prefixes. The root go.mod and go.sum are always included, since
+// functions cannot be executed without the module definition.
+func sparsePatterns(paths []string) []string {
+    patterns := []string{"go.mod", "go.sum"}
+    for _, p := range paths {
+        p = strings.Trim(path.Clean("/"+p), "/")
+        if p != "" {
+            patterns = append(patterns, p+"/")
+        }
+    }
+    return patterns
+}
+
+// inPaths reports whether a repository-relative file lies in one of the
+// directories, or everywhere when no directories are given
+func inPaths(relPath string, paths []string) bool {
+    if len(paths) == 0 {
+        return true
+    }
+    for _, pattern := range sparsePatterns(paths)[2:] {
+        if strings.HasPrefix(relPath, pattern) {
+            return true
+        }
+    }
+    return false
+}
+
+// CloneSparse clones without checking out, then checks out only the
+// requested paths with go-git. If go-git fails, it falls back to a partial
+// clone with the git CLI.
+func (c goGitClient) CloneSparse(ctx context.Context, repoURL, dir string, paths []string) (*git.Repository, error) {
+    repo, err := c.cloneSparseGoGit(ctx, repoURL, dir, paths)
+    if err == nil {
+        return repo, nil
+    }
+    if _, lookErr := exec.LookPath("git"); lookErr != nil {
+        return nil, err
+    }
+    log.Printf("go-git sparse checkout failed (%v), retrying with the git CLI", err)
+    return cloneSparseCLI(ctx, repoURL, dir, paths, "blob:none")
+}
+
+// cloneSparseGoGit clones with go-git and populates the worktree sparsely.
+// Every object is still fetched, but only the requested paths are written
+// to disk.
+func (c goGitClient) cloneSparseGoGit(ctx context.Context, repoURL, dir string, paths []string) (*git.Repository, error) {
+    repo, err := git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{
+        URL:        repoURL,
+        Progress:   c.progress,
+        NoCheckout: true,
+    })
+    if err != nil {
+        return nil, err
+    }
+    head, err := repo.Head()
+    if err != nil {
+        return nil, fmt.Errorf("failed to resolve HEAD: %w", err)
+    }
+    worktree, err := repo.Worktree()
+    if err != nil {
+        return nil, fmt.Errorf("failed to open worktree: %w", err)
+    }
+    err = worktree.Checkout(&git.CheckoutOptions{
+        Branch:                    head.Name(),
+        Force:                     true,
+        SparseCheckoutDirectories: sparsePatterns(paths),
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to check out sparsely: %w", err)
+    }
+    return repo, nil
+}
+
+// cloneSparseCLI makes a partial clone with the git CLI. With a blob:none
+// filter only the file contents under the requested paths are downloaded.
+// The git commands are killed once ctx is cancelled.
+func cloneSparseCLI(ctx context.Context, repoURL, dir string, paths []string, filter string) (*git.Repository, error) {
+    patterns := []string{"/go.mod", "/go.sum"}
+    for _, pattern := range sparsePatterns(paths)[2:] {
+        patterns = append(patterns, "/"+pattern)
+    }
+
+    steps := [][]string{
+        {"clone", "--filter=" + filter, "--no-checkout", repoURL, dir},
+        append([]string{"-C", dir, "sparse-checkout", "set", "--no-cone"}, patterns...),
+        {"-C", dir, "checkout"},
+    }
+    for _, args := range steps {
+        if out, err := exec.CommandContext(ctx, "git", args...).CombinedOutput(); err != nil {
+            return nil, fmt.Errorf("git %s failed: %w: %s", args[0], err, lastLine(out))
+        }
+    }
+    return git.PlainOpen(dir)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+    "bufio"
+    "context"
+    "database/sql"
+    "database/sql/driver"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/lib/pq"
+)
+
+// defaultDumpDir is where SQL dumps are written when no directory is
+// configured
+const defaultDumpDir = "sql"
+
+// SQLDumpStorage writes the statements that would create and fill the
+// generated tables to a .sql file instead of executing them, for users who
+// cannot give the tool database access. It builds statements with the
+// PostgreSQL storage and expands their parameters into escaped literals.
+// It is safe for concurrent use: stores run on the store pipeline's
+// consumer while others run on the caller, and each statement is written
+// whole.
+type SQLDumpStorage struct {
+    *PostgresStorage
+    path string
+    // mu guards the file, the writer and payloads
+    mu       sync.Mutex
+    file     *os.File
+    writer   *bufio.Writer
+    payloads map[string]bool
+}
+
+// NewSQLDumpStorage creates a dump storage; call SetPath and Connect
+// before use
+func NewSQLDumpStorage(config DatabaseConfig) *SQLDumpStorage {
+    return &SQLDumpStorage{PostgresStorage: NewPostgresStorage(config)}
+}
+
+// SetPath sets the file the next Connect writes to
+func (d *SQLDumpStorage) SetPath(path string) {
+    d.path = path
+}
+
+// Path returns the file the dump is written to
+func (d *SQLDumpStorage) Path() string {
+    return d.path
+}
+
+// Connect creates the dump file, replacing any previous dump, and opens a
+// transaction so the file loads all or nothing
+func (d *SQLDumpStorage) Connect(ctx context.Context) error {
+    if d.path == "" {
+        return fmt.Errorf("no SQL dump path set")
+    }
+    if err := os.MkdirAll(filepath.Dir(d.path), 0755); err != nil {
+        return fmt.Errorf("failed to create dump directory: %w", err)
+    }
+    file, err := os.Create(d.path)
+    if err != nil {
+        return fmt.Errorf("failed to create SQL dump: %w", err)
+    }
+    d.file = file
+    d.writer = bufio.NewWriter(file)
+    d.exec = d
+    d.payloads = make(map[string]bool)
+
+    fmt.Fprintf(d.writer, "-- Generated by floq on %s\n", time.Now().Format(time.RFC3339))
+    fmt.Fprintf(d.writer, "-- Review, then load with: psql -v ON_ERROR_STOP=1 -f %s\n\n", filepath.Base(d.path))
+    fmt.Fprintln(d.writer, "BEGIN;")
+    if d.config.DumpSchema != "" {
+        schema := quoteIdentifier(d.config.DumpSchema)
+        fmt.Fprintf(d.writer, "CREATE SCHEMA IF NOT EXISTS %s;\n", schema)
+        fmt.Fprintf(d.writer, "SET LOCAL search_path TO %s;\n", schema)
+    }
+    d.logger.Printf("Writing SQL dump to %s", d.path)
+    return nil
+}
+
+// Close commits the transaction and closes the dump file
+func (d *SQLDumpStorage) Close() error {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    if d.file == nil {
+        return nil
+    }
+    fmt.Fprintln(d.writer, "\nCOMMIT;")
+    err := d.writer.Flush()
+    if closeErr := d.file.Close(); err == nil {
+        err = closeErr
+    }
+    d.file = nil
+    if err != nil {
+        return fmt.Errorf("failed to write SQL dump: %w", err)
+    }
+    return nil
+}
+
+// ExecContext writes a statement with its parameters expanded into
+// literals. Writing a file cannot be cancelled, so ctx is not used.
+func (d *SQLDumpStorage) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    return d.write(query, args...)
+}
+
+// write is ExecContext for callers holding mu
+func (d *SQLDumpStorage) write(query string, args ...interface{}) (sql.Result, error) {
+    statement, err := expandParameters(query, args)
+    if err != nil {
+        return nil, err
+    }
+    if _, err := fmt.Fprintf(d.writer, "%s;\n", statement); err != nil {
+        return nil, fmt.Errorf("failed to write SQL dump: %w", err)
+    }
+    return driver.RowsAffected(1), nil
+}
+
+// StorePayload writes the payload tables, unpartitioned, and a payload and
+// its reference. Payloads are reported new the first time they appear in
+// the dump; ON CONFLICT skips those already loaded.
+func (d *SQLDumpStorage) StorePayload(ctx context.Context, ref PayloadRef, payload interface{}) (string, bool, error) {
+    hash, data, err := canonicalPayload(payload)
+    if err != nil {
+        return "", false, err
+    }
+
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    var none noPartitioning
+    if len(d.payloads) == 0 {
+        statements := []string{
+            payloadsSchema,
+            fmt.Sprintf(functionOutputsSchema, none.PrimaryKey(functionOutputsTable), none.Clause(functionOutputsTable)),
+        }
+        for _, statement := range statements {
+            if _, err := d.write(statement); err != nil {
+                return "", false, err
+            }
+        }
+    }
+
+    created := !d.payloads[hash]
+    if created {
+        d.payloads[hash] = true
+        _, err = d.write(
+            "INSERT INTO floq_payloads (hash, payload, size) VALUES ($1, $2, $3) ON CONFLICT (hash) DO NOTHING",
+            hash, string(data), len(data))
+        if err != nil {
+            return "", false, err
+        }
+    }
+
+    _, err = d.write(
+        "INSERT INTO floq_function_outputs (repository, ref, package, function, run_id, payload_hash) VALUES ($1, NULLIF($2, ''), $3, $4, NULLIF($5, ''), $6)",
+        ref.Repository, ref.Ref, ref.Package, ref.Function, ref.RunID, hash)
+    if err != nil {
+        return "", false, err
+    }
+    return hash, created, nil
+}
+
+// expandParameters replaces the $n placeholders of a statement with the
+// quoted literals of args, leaving quoted strings and identifiers alone
+func expandParameters(query string, args []interface{}) (string, error) {
+    var b strings.Builder
+    var quote byte
+    for i := 0; i < len(query); i++ {
+        c := query[i]
+        switch {
+        case quote != 0:
+            if c == quote {
+                quote = 0
+            }
+        case c == '\'' || c == '"':
+            quote = c
+        case c == '$' && i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9':
+            j := i + 1
+            for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+                j++
+            }
+            n, _ := strconv.Atoi(query[i+1 : j])
+            if n < 1 || n > len(args) {
+                return "", fmt.Errorf("statement references missing parameter $%d", n)
+            }
+            b.WriteString(sqlLiteral(args[n-1]))
+            i = j - 1
+            continue
+        }
+        b.WriteByte(c)
+    }
+    return b.String(), nil
+}
+
+// sqlLiteral renders a parameter as a quoted literal. Values are written
+// as strings, the way lib/pq sends parameters, so PostgreSQL converts them
+// to the column's type.
+func sqlLiteral(value interface{}) string {
+    var text string
+    switch v := value.(type) {
+    case nil:
+        return "NULL"
+    case string:
+        text = v
+    case []byte:
+        text = string(v)
+    case float64:
+        text = strconv.FormatFloat(v, 'f', -1, 64)
+    case float32:
+        text = strconv.FormatFloat(float64(v), 'f', -1, 32)
+    case bool:
+        text = strconv.FormatBool(v)
+    case time.Time:
+        text = v.Format(time.RFC3339Nano)
+    default:
+        text = fmt.Sprint(v)
+    }
+    return pq.QuoteLiteral(text)
+}
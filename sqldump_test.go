@@ -0,0 +1,80 @@
+package main
+
+import (
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestSQLLiteral(t *testing.T) {
+    when := time.Date(2024, 3, 9, 14, 5, 6, 700000000, time.FixedZone("", 3600))
+    tests := []struct {
+        name  string
+        value interface{}
+        want  string
+    }{
+        {"null", nil, "NULL"},
+        {"string", "plain", "'plain'"},
+        {"single quote", "it's", "'it''s'"},
+        {"double quote", `say "hi"`, `'say "hi"'`},
+        {"backslash", `C:\tmp`, ` E'C:\\tmp'`},
+        {"backslash and quote", `a\'b`, ` E'a\\''b'`},
+        {"bytes", []byte("raw"), "'raw'"},
+        {"int", 42, "'42'"},
+        {"negative int64", int64(-7), "'-7'"},
+        {"float64", 1.5, "'1.5'"},
+        {"float32", float32(0.1), "'0.1'"},
+        {"bool", true, "'true'"},
+        {"time", when, "'2024-03-09T14:05:06.7+01:00'"},
+        {"utc time", time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC), "'2024-03-09T00:00:00Z'"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := sqlLiteral(tt.value); got != tt.want {
+                t.Errorf("sqlLiteral(%#v) = %s, want %s", tt.value, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestExpandParameters(t *testing.T) {
+    args := []interface{}{"one", 2, nil, "four", "five", "six", "seven", "eight", "nine", "ten", `it's`, `C:\tmp`}
+    tests := []struct {
+        name  string
+        query string
+        args  []interface{}
+        want  string
+        err   string
+    }{
+        {"positional", `INSERT INTO t (a, b) VALUES ($1, $2)`, args, `INSERT INTO t (a, b) VALUES ('one', '2')`, ""},
+        {"reordered and repeated", `SELECT $2, $1, $2`, args, `SELECT '2', 'one', '2'`, ""},
+        {"null", `UPDATE t SET c = $3`, args, `UPDATE t SET c = NULL`, ""},
+        {"$10 is not $1", `SELECT $10, $1 || $10`, args, `SELECT 'ten', 'one' || 'ten'`, ""},
+        {"value with a quote", `SELECT $11`, args, `SELECT 'it''s'`, ""},
+        {"value with a backslash", `INSERT INTO t (path) VALUES ($12)`, args, `INSERT INTO t (path) VALUES ( E'C:\\tmp')`, ""},
+        {"placeholder in a string", `SELECT '$1', $1`, args, `SELECT '$1', 'one'`, ""},
+        {"placeholder in an identifier", `SELECT "$1" FROM t WHERE a = $1`, args, `SELECT "$1" FROM t WHERE a = 'one'`, ""},
+        {"double quote in a string", `SELECT 'say "$1"', $1`, args, `SELECT 'say "$1"', 'one'`, ""},
+        {"single quote in an identifier", `SELECT "it's $1", $1`, args, `SELECT "it's $1", 'one'`, ""},
+        {"escaped quote in a string", `SELECT 'it''s $1', $2`, args, `SELECT 'it''s $1', '2'`, ""},
+        {"dollar without a digit", `SELECT $a, $`, args, `SELECT $a, $`, ""},
+        {"no parameters", `SELECT 1`, nil, `SELECT 1`, ""},
+        {"missing parameter", `SELECT $13`, args, "", "missing parameter $13"},
+        {"parameter zero", `SELECT $0`, args, "", "missing parameter $0"},
+        {"no arguments", `SELECT $1`, nil, "", "missing parameter $1"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := expandParameters(tt.query, tt.args)
+            if tt.err != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.err) {
+                    t.Fatalf("expandParameters(%s) = %q, %v, want an error containing %q", tt.query, got, err, tt.err)
+                }
+                return
+            }
+            if err != nil || got != tt.want {
+                t.Fatalf("expandParameters(%s) = %q, %v, want %q", tt.query, got, err, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "time"
+)
+
+// stabilityBucket is the state store bucket holding execution histories
+const stabilityBucket = "stability"
+
+// defaultStabilityWindow is the number of runs a stability score covers
+// when no window is configured
+const defaultStabilityWindow = 10
+
+// Stability statuses; see FunctionStability
+const (
+    StabilityStable  = "stable"  // succeeded in every run of the window
+    StabilityFlaky   = "flaky"   // succeeded in some runs and failed in others
+    StabilityFailing = "failing" // failed in every run of the window
+)
+
+// StabilityConfig controls tracking how reliably functions execute across
+// runs
+type StabilityConfig struct {
+    // Track records whether each execution succeeded in the state store
+    // and scores every function by its recent runs
+    Track bool `json:"track,omitempty"`
+    // Window is the number of recent runs a score covers (default 10)
+    Window int `json:"window,omitempty"`
+    // SkipFailing skips functions that failed in their last SkipFailing
+    // runs; zero executes them regardless
+    SkipFailing int `json:"skip_failing,omitempty"`
+}
+
+// stabilityRun is one recorded execution of a function
+type stabilityRun struct {
+    At        time.Time `json:"at"`
+    Succeeded bool      `json:"succeeded"`
+}
+
+// stabilityHistory is the stored execution history of a function. It
+// starts over whenever the function's source changes, so an edited
+// function is not judged by how its previous version ran.
+type stabilityHistory struct {
+    Function   string         `json:"function"`
+    SourceHash string         `json:"source_hash"`
+    Runs       []stabilityRun `json:"runs"`
+}
+
+// FunctionStability scores how reliably a function executed over its
+// recent runs
+type FunctionStability struct {
+    Status string `json:"status"`
+    // Score is the share of the runs that succeeded, from 0 to 1
+    Score float64 `json:"score"`
+    Runs  int     `json:"runs"`
+    // FailingStreak counts the failures since the last success
+    FailingStreak int `json:"failing_streak,omitempty"`
+}
+
+// stabilityKey identifies a function of a repository across runs
+func (g *GitHubFunctionExtractor) stabilityKey(function FunctionInfo) string {
+    h := sha256.New()
+    h.Write([]byte(repoSlug(g.repoURL) + "\x00" + function.RelativePath + "\x00" + function.Name))
+    return hex.EncodeToString(h.Sum(nil))
+}
+
+// loadStability returns the execution history of a function, empty when
+// it has none for its current source
+func (g *GitHubFunctionExtractor) loadStability(function FunctionInfo) stabilityHistory {
+    history := stabilityHistory{Function: function.Name, SourceHash: function.SourceHash}
+    if g.state == nil || !g.execConfig.Stability.Track {
+        return history
+    }
+    var stored stabilityHistory
+    found, err := g.state.Get(stabilityBucket, g.stabilityKey(function), &stored)
+    if err != nil {
+        g.logger.Printf("Stability: %v", err)
+    }
+    if found && stored.SourceHash == function.SourceHash {
+        history.Runs = stored.Runs
+    }
+    return history
+}
+
+// recordStability adds the outcome of executing a function to its history
+func (g *GitHubFunctionExtractor) recordStability(function FunctionInfo, err error) {
+    if g.state == nil || !g.execConfig.Stability.Track {
+        return
+    }
+    history := g.loadStability(function)
+    history.Runs = append(history.Runs, stabilityRun{At: time.Now(), Succeeded: err == nil})
+    window := g.execConfig.Stability.Window
+    if window == 0 {
+        window = defaultStabilityWindow
+    }
+    if len(history.Runs) > window {
+        history.Runs = history.Runs[len(history.Runs)-window:]
+    }
+    if err := g.state.Put(stabilityBucket, g.stabilityKey(function), history); err != nil {
+        g.logger.Printf("Stability: %v", err)
+    }
+}
+
+// skipFailing reports whether the execution policy skips a function for
+// failing in its recent runs, and how many runs in a row it failed
+func (g *GitHubFunctionExtractor) skipFailing(function FunctionInfo) (int, bool) {
+    threshold := g.execConfig.Stability.SkipFailing
+    if threshold == 0 {
+        return 0, false
+    }
+    score, ok := g.loadStability(function).score()
+    return score.FailingStreak, ok && score.FailingStreak >= threshold
+}
+
+// score rates a history, reporting false when it has no runs
+func (h stabilityHistory) score() (FunctionStability, bool) {
+    if len(h.Runs) == 0 {
+        return FunctionStability{}, false
+    }
+    succeeded := 0
+    for _, run := range h.Runs {
+        if run.Succeeded {
+            succeeded++
+        }
+    }
+    streak := 0
+    for i := len(h.Runs) - 1; i >= 0 && !h.Runs[i].Succeeded; i-- {
+        streak++
+    }
+
+    stability := FunctionStability{
+        Status:        StabilityFlaky,
+        Score:         float64(succeeded) / float64(len(h.Runs)),
+        Runs:          len(h.Runs),
+        FailingStreak: streak,
+    }
+    switch succeeded {
+    case len(h.Runs):
+        stability.Status = StabilityStable
+    case 0:
+        stability.Status = StabilityFailing
+    }
+    return stability, true
+}
+
+// attachStability scores the functions of a repository that have an
+// execution history, including the runs of this processing
+func (g *GitHubFunctionExtractor) attachStability(result *ProcessingResult) {
+    if g.state == nil || !g.execConfig.Stability.Track {
+        return
+    }
+    for _, function := range result.ProcessedFunctions {
+        score, ok := g.loadStability(function).score()
+        if !ok {
+            continue
+        }
+        if result.Stability == nil {
+            result.Stability = make(map[string]FunctionStability)
+        }
+        result.Stability[function.Name] = score
+    }
+}
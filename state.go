@@ -0,0 +1,98 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/fs"
+    "os"
+    "path/filepath"
+)
+
+// StateConfig controls the local state store that persists data between runs
+type StateConfig struct {
+    Dir string `json:"dir"`
+}
+
+// defaultStateDir returns the per-user state directory, falling back to a
+// directory in the working directory
+func defaultStateDir() string {
+    if dir, err := os.UserCacheDir(); err == nil {
+        return filepath.Join(dir, "floq-v1")
+    }
+    return ".floq"
+}
+
+// StateStore is a small file-backed key/value store for data that must
+// survive between runs. Values are JSON documents grouped into buckets,
+// stored as <dir>/<bucket>/<key>.json.
+type StateStore struct {
+    dir string
+}
+
+// NewStateStore opens (creating if needed) the state store at dir
+func NewStateStore(dir string) (*StateStore, error) {
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return nil, fmt.Errorf("failed to create state directory: %w", err)
+    }
+    return &StateStore{dir: dir}, nil
+}
+
+// path returns the file holding a key. Keys are expected to be hashes or
+// other file-name-safe strings.
+func (s *StateStore) path(bucket, key string) string {
+    return filepath.Join(s.dir, bucket, key+".json")
+}
+
+// Get loads the value stored under key into v, reporting whether it existed
+func (s *StateStore) Get(bucket, key string, v interface{}) (bool, error) {
+    data, err := os.ReadFile(s.path(bucket, key))
+    if errors.Is(err, fs.ErrNotExist) {
+        return false, nil
+    }
+    if err != nil {
+        return false, fmt.Errorf("failed to read state %s/%s: %w", bucket, key, err)
+    }
+    if err := json.Unmarshal(data, v); err != nil {
+        return false, fmt.Errorf("failed to parse state %s/%s: %w", bucket, key, err)
+    }
+    return true, nil
+}
+
+// Put stores v under key, replacing any previous value atomically
+func (s *StateStore) Put(bucket, key string, v interface{}) error {
+    data, err := json.Marshal(v)
+    if err != nil {
+        return fmt.Errorf("failed to marshal state %s/%s: %w", bucket, key, err)
+    }
+
+    path := s.path(bucket, key)
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+        return fmt.Errorf("failed to create state bucket %s: %w", bucket, err)
+    }
+
+    tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+    if err != nil {
+        return fmt.Errorf("failed to write state %s/%s: %w", bucket, key, err)
+    }
+    if _, err := tmp.Write(data); err != nil {
+        tmp.Close()
+        os.Remove(tmp.Name())
+        return fmt.Errorf("failed to write state %s/%s: %w", bucket, key, err)
+    }
+    tmp.Close()
+    if err := os.Rename(tmp.Name(), path); err != nil {
+        os.Remove(tmp.Name())
+        return fmt.Errorf("failed to write state %s/%s: %w", bucket, key, err)
+    }
+    return nil
+}
+
+// Delete removes the value stored under key, if any
+func (s *StateStore) Delete(bucket, key string) error {
+    err := os.Remove(s.path(bucket, key))
+    if err != nil && !errors.Is(err, fs.ErrNotExist) {
+        return fmt.Errorf("failed to delete state %s/%s: %w", bucket, key, err)
+    }
+    return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+    "net/http"
+    "sort"
+    "sync"
+    "time"
+)
+
+// Phases of processing a repository, timed separately
+const (
+    PhaseClone   = "clone"
+    PhaseExtract = "extract"
+    PhaseExecute = "execute"
+    PhaseStore   = "store"
+)
+
+// phaseTimer accumulates the time a repository spends in each phase
+type phaseTimer struct {
+    mu    sync.Mutex
+    spent map[string]time.Duration
+}
+
+// newPhaseTimer creates a timer with nothing tracked yet
+func newPhaseTimer() *phaseTimer {
+    return &phaseTimer{spent: make(map[string]time.Duration)}
+}
+
+// track starts timing a phase and returns the function that stops it. A
+// nil timer tracks nothing.
+func (t *phaseTimer) track(phase string) func() {
+    if t == nil {
+        return func() {}
+    }
+    start := time.Now()
+    return func() {
+        t.mu.Lock()
+        t.spent[phase] += time.Since(start)
+        t.mu.Unlock()
+    }
+}
+
+// milliseconds returns the time spent per phase
+func (t *phaseTimer) milliseconds() map[string]int64 {
+    if t == nil {
+        return nil
+    }
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    phases := make(map[string]int64, len(t.spent))
+    for phase, spent := range t.spent {
+        phases[phase] = spent.Milliseconds()
+    }
+    return phases
+}
+
+// WorkerStats accounts for the repositories a single worker processed
+type WorkerStats struct {
+    Worker       string `json:"worker"`
+    Repositories int    `json:"repositories"`
+    Failed       int    `json:"failed"`
+    Executed     int    `json:"executed"`
+    Errors       int    `json:"errors"`
+    BusyMs       int64  `json:"busy_ms"`
+}
+
+// merge folds another set of statistics into s
+func (s *ProcessingStats) merge(other ProcessingStats) {
+    s.TotalRepositories += other.TotalRepositories
+    s.TotalFunctions += other.TotalFunctions
+    s.TotalExecuted += other.TotalExecuted
+    s.TotalTables += other.TotalTables
+    s.TotalErrors += other.TotalErrors
+    s.TotalCacheHits += other.TotalCacheHits
+    s.TotalCacheMisses += other.TotalCacheMisses
+    s.TotalExtractionCacheHits += other.TotalExtractionCacheHits
+    s.TotalExtractionCacheMisses += other.TotalExtractionCacheMisses
+    s.ProcessingTimeMs = max(s.ProcessingTimeMs, other.ProcessingTimeMs)
+
+    if other.TimedRepositories > 0 {
+        if s.TimedRepositories == 0 || other.MinRepositoryMs < s.MinRepositoryMs {
+            s.MinRepositoryMs = other.MinRepositoryMs
+        }
+        s.MaxRepositoryMs = max(s.MaxRepositoryMs, other.MaxRepositoryMs)
+        s.TimedRepositories += other.TimedRepositories
+        s.RepositoryTimeMs += other.RepositoryTimeMs
+        s.AvgRepositoryMs = s.RepositoryTimeMs / int64(s.TimedRepositories)
+    }
+    for phase, ms := range other.PhaseMs {
+        if s.PhaseMs == nil {
+            s.PhaseMs = make(map[string]int64)
+        }
+        s.PhaseMs[phase] += ms
+    }
+    for kind, count := range other.ErrorsByKind {
+        if s.ErrorsByKind == nil {
+            s.ErrorsByKind = make(map[string]int)
+        }
+        s.ErrorsByKind[kind] += count
+    }
+    s.MaxStoreQueueDepth = max(s.MaxStoreQueueDepth, other.MaxStoreQueueDepth)
+    s.StoreBlockedMs += other.StoreBlockedMs
+    s.Workers = append(s.Workers, other.Workers...)
+}
+
+// StatsAggregator collects statistics from concurrent workers. Every
+// worker records into a counter of its own, so workers never contend with
+// each other, and Snapshot merges the counters.
+type StatsAggregator struct {
+    mu       sync.Mutex
+    started  time.Time
+    counters map[string]*WorkerCounter
+}
+
+// NewStatsAggregator creates an aggregator timing from now
+func NewStatsAggregator() *StatsAggregator {
+    return &StatsAggregator{
+        started:  time.Now(),
+        counters: make(map[string]*WorkerCounter),
+    }
+}
+
+// Worker returns the counter of a worker, creating it on first use
+func (a *StatsAggregator) Worker(name string) *WorkerCounter {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+
+    counter, ok := a.counters[name]
+    if !ok {
+        counter = &WorkerCounter{worker: WorkerStats{Worker: name}}
+        a.counters[name] = counter
+    }
+    return counter
+}
+
+// Snapshot merges the counters of every worker. TotalRepositories counts
+// failed repositories too, while the other totals only cover the
+// repositories that were processed successfully.
+func (a *StatsAggregator) Snapshot() ProcessingStats {
+    a.mu.Lock()
+    counters := make([]*WorkerCounter, 0, len(a.counters))
+    for _, counter := range a.counters {
+        counters = append(counters, counter)
+    }
+    a.mu.Unlock()
+
+    var stats ProcessingStats
+    for _, counter := range counters {
+        stats.merge(counter.snapshot())
+    }
+    sort.Slice(stats.Workers, func(i, j int) bool {
+        return stats.Workers[i].Worker < stats.Workers[j].Worker
+    })
+    stats.ProcessingTimeMs = time.Since(a.started).Milliseconds()
+    stats.StoreQueueDepth = storeQueueDepth.Load()
+    return stats
+}
+
+// WorkerCounter holds the statistics recorded by one worker
+type WorkerCounter struct {
+    mu     sync.Mutex
+    stats  ProcessingStats
+    worker WorkerStats
+}
+
+// Record accounts for a repository the worker finished. Only successful
+// repositories contribute to the totals.
+func (c *WorkerCounter) Record(result *ProcessingResult, succeeded bool) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    c.stats.TotalRepositories++
+    if result != nil {
+        c.worker.BusyMs += result.DurationMs
+    }
+    if !succeeded || result == nil {
+        c.worker.Failed++
+        return
+    }
+    c.stats.add(result)
+    c.worker.Repositories++
+    c.worker.Executed += len(result.ExecutedFunctions)
+    c.worker.Errors += len(result.Errors)
+}
+
+// snapshot returns a copy of the worker's statistics
+func (c *WorkerCounter) snapshot() ProcessingStats {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    var stats ProcessingStats
+    stats.merge(c.stats)
+    stats.Workers = []WorkerStats{c.worker}
+    return stats
+}
+
+// handleStats serves the statistics of the jobs processed by this instance
+// since it started, broken down by worker
+func (s *Service) handleStats(w http.ResponseWriter, r *http.Request) {
+    writeJSON(w, http.StatusOK, s.stats.Snapshot())
+}
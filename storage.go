@@ -0,0 +1,242 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "sort"
+    "sync"
+
+    "github.com/Spottybadrabbit/Floq-v1/storage"
+)
+
+// Storage drivers accepted in DatabaseConfig.Driver
+const (
+    DriverPostgres = "postgres"
+    DriverMemory   = "memory"
+    DriverSQL      = "sql"
+)
+
+// The storage contract lives in the storage package, so that storages
+// written outside floq can be checked with storagetest; floq's own drivers
+// implement it here
+type (
+    Storage        = storage.Storage
+    TableReader    = storage.TableReader
+    MemoryTable    = storage.MemoryTable
+    ColumnMapping  = storage.ColumnMapping
+    Invocation     = storage.Invocation
+    PayloadRef     = storage.PayloadRef
+    PayloadStats   = storage.PayloadStats
+    ColumnStats    = storage.ColumnStats
+    Vulnerability  = storage.Vulnerability
+    SignatureField = storage.SignatureField
+    SignatureRow   = storage.SignatureRow
+)
+
+// Kinds of signature fields
+const (
+    SignatureParameter = storage.SignatureParameter
+    SignatureResult    = storage.SignatureResult
+)
+
+// Names of the tables every storage appends to, and the identifier limit
+// table names are shortened to
+const (
+    vulnerabilitiesTable = storage.VulnerabilitiesTable
+    payloadStatsTable    = storage.PayloadStatsTable
+    signaturesTable      = storage.SignaturesTable
+    maxIdentifierBytes   = storage.MaxIdentifierBytes
+)
+
+// Naming, column mapping and payload helpers shared with the storage package
+var (
+    tableNameFor        = storage.TableName
+    safeIdentifier      = storage.SafeIdentifier
+    quoteIdentifier     = storage.QuoteIdentifier
+    objectRecords       = storage.ObjectRecords
+    buildColumnMapping  = storage.BuildColumnMapping
+    postgreSQLType      = storage.PostgreSQLType
+    canonicalPayload    = storage.CanonicalPayload
+    computePayloadStats = storage.ComputePayloadStats
+    isGeneratedColumn   = storage.IsGeneratedColumn
+    errTablesUnreadable = storage.ErrTablesUnreadable
+)
+
+// NewStorage returns the storage implementation selected by the driver
+func NewStorage(config DatabaseConfig) (Storage, error) {
+    switch config.Driver {
+    case "", DriverPostgres:
+        return NewPostgresStorage(config), nil
+    case DriverMemory:
+        return NewMemoryStorage(), nil
+    case DriverSQL:
+        return NewSQLDumpStorage(config), nil
+    }
+    return nil, fmt.Errorf("unsupported database driver %q", config.Driver)
+}
+
+// MemoryStorage keeps generated tables in memory. It backs dry runs, where
+// nothing is written to a database, and lets the pipeline run without
+// Postgres.
+type MemoryStorage struct {
+    mu          sync.Mutex
+    tables      map[string]*MemoryTable
+    payloads    map[string]interface{}
+    payloadRefs []PayloadRef
+    logger      *log.Logger
+}
+
+// NewMemoryStorage creates an empty in-memory storage
+func NewMemoryStorage() *MemoryStorage {
+    return &MemoryStorage{
+        tables:   make(map[string]*MemoryTable),
+        payloads: make(map[string]interface{}),
+        logger:   log.New(logOutput, "[STORAGE] ", log.LstdFlags|log.Lshortfile),
+    }
+}
+
+// Connect is a no-op for memory storage
+func (m *MemoryStorage) Connect(ctx context.Context) error {
+    m.logger.Println("Using in-memory storage; no data will be written to a database")
+    return nil
+}
+
+// Close logs what a database-backed run would have written
+func (m *MemoryStorage) Close() error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    rows := 0
+    for _, table := range m.tables {
+        rows += len(table.Rows)
+    }
+    m.logger.Printf("In-memory storage held %d tables with %d rows", len(m.tables), rows)
+    if len(m.payloadRefs) > 0 {
+        m.logger.Printf("In-memory storage held %d distinct payloads for %d outputs", len(m.payloads), len(m.payloadRefs))
+    }
+    return nil
+}
+
+// CreateTable replaces tableName with an empty table
+func (m *MemoryStorage) CreateTable(ctx context.Context, tableName string, data interface{}, mapping *ColumnMapping) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    m.tables[tableName] = newMemoryTable(data, mapping)
+    return nil
+}
+
+// newMemoryTable returns an empty table shaped for data
+func newMemoryTable(data interface{}, mapping *ColumnMapping) *MemoryTable {
+    table := &MemoryTable{}
+    if mapping != nil {
+        for _, key := range mapping.Keys {
+            table.Columns = append(table.Columns, mapping.Columns[key])
+        }
+    } else if v, ok := data.([]interface{}); ok && len(v) > 0 {
+        table.Columns = []string{"value"}
+    } else {
+        table.Columns = []string{"data"}
+    }
+    return table
+}
+
+// InsertData appends data to a table as rows keyed by column name
+func (m *MemoryStorage) InsertData(ctx context.Context, tableName string, data interface{}, mapping *ColumnMapping) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    table, ok := m.tables[tableName]
+    if !ok {
+        return fmt.Errorf("table %s does not exist", tableName)
+    }
+    insertRows(table, data, mapping)
+    return nil
+}
+
+// ReplaceTable replaces tableName with a table holding data
+func (m *MemoryStorage) ReplaceTable(ctx context.Context, tableName string, data interface{}, mapping *ColumnMapping) error {
+    table := newMemoryTable(data, mapping)
+    insertRows(table, data, mapping)
+
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.tables[tableName] = table
+    return nil
+}
+
+// insertRows appends data to a table as rows keyed by column name
+func insertRows(table *MemoryTable, data interface{}, mapping *ColumnMapping) {
+    if records, ok := objectRecords(data); ok && mapping != nil {
+        for _, record := range records {
+            row := make(map[string]interface{}, len(record))
+            for key, value := range record {
+                row[mapping.Columns[key]] = value
+            }
+            table.Rows = append(table.Rows, row)
+        }
+        return
+    }
+
+    if v, ok := data.([]interface{}); ok {
+        for _, item := range v {
+            table.Rows = append(table.Rows, map[string]interface{}{"value": fmt.Sprintf("%v", item)})
+        }
+        return
+    }
+
+    table.Rows = append(table.Rows, map[string]interface{}{"data": data})
+}
+
+// StoreInvocations replaces tableName with one row per invocation
+func (m *MemoryStorage) StoreInvocations(ctx context.Context, tableName string, invocations []Invocation) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    table := &MemoryTable{Columns: []string{"arguments", "output"}}
+    for _, invocation := range invocations {
+        table.Rows = append(table.Rows, map[string]interface{}{
+            "arguments": invocation.Arguments,
+            "output":    invocation.Output,
+        })
+    }
+    m.tables[tableName] = table
+    return nil
+}
+
+// CommentOnTable records the comments of a table and its columns
+func (m *MemoryStorage) CommentOnTable(ctx context.Context, tableName, comment string, columnComments map[string]string) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    table, ok := m.tables[tableName]
+    if !ok {
+        return fmt.Errorf("table %s does not exist", tableName)
+    }
+    table.Comment = comment
+    table.ColumnComments = columnComments
+    return nil
+}
+
+// Table returns a stored table
+func (m *MemoryStorage) Table(tableName string) (*MemoryTable, bool) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    table, ok := m.tables[tableName]
+    return table, ok
+}
+
+// TableNames returns the names of all stored tables in sorted order
+func (m *MemoryStorage) TableNames() []string {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    names := make([]string, 0, len(m.tables))
+    for name := range m.tables {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
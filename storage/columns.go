@@ -0,0 +1,140 @@
+package storage
+
+import (
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// reservedColumns are generated by the tool itself and never used for data keys
+var reservedColumns = map[string]bool{"id": true}
+
+// ColumnMapping maps the original JSON keys of object records to normalized,
+// collision-free column names
+type ColumnMapping struct {
+    Keys    []string          // original keys in column order
+    Columns map[string]string // original key -> column name
+    Types   map[string]string // original key -> PostgreSQL type
+}
+
+// normalizeColumnName folds a JSON key into a safe lowercase identifier:
+// illegal characters become underscores and names that do not start with a
+// letter or underscore are prefixed
+func normalizeColumnName(key string) string {
+    var b strings.Builder
+    lastUnderscore := false
+    for _, r := range strings.ToLower(key) {
+        if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+            b.WriteRune(r)
+            lastUnderscore = false
+        } else if !lastUnderscore {
+            b.WriteRune('_')
+            lastUnderscore = true
+        }
+    }
+
+    name := strings.Trim(b.String(), "_")
+    if name == "" {
+        return "column"
+    }
+    if name[0] >= '0' && name[0] <= '9' {
+        name = "c_" + name
+    }
+    return SafeIdentifier(name)
+}
+
+// BuildColumnMapping assigns a column to every key found in the records.
+// Keys are processed in sorted order so the mapping is deterministic, and
+// keys that normalize to the same name (e.g. "ID" and "id", or a key
+// clashing with the generated id column) get numeric suffixes.
+func BuildColumnMapping(records []map[string]interface{}, typeOf func(interface{}) string) *ColumnMapping {
+    mapping := &ColumnMapping{
+        Columns: make(map[string]string),
+        Types:   make(map[string]string),
+    }
+
+    for _, record := range records {
+        for key, value := range record {
+            if _, seen := mapping.Types[key]; !seen {
+                mapping.Keys = append(mapping.Keys, key)
+                mapping.Types[key] = ""
+            }
+            // Type the column from the first non-null value
+            if mapping.Types[key] == "" && value != nil {
+                mapping.Types[key] = typeOf(value)
+            }
+        }
+    }
+    sort.Strings(mapping.Keys)
+
+    used := make(map[string]bool)
+    for name := range reservedColumns {
+        used[name] = true
+    }
+    for _, key := range mapping.Keys {
+        base := normalizeColumnName(key)
+        column := base
+        for n := 2; used[column]; n++ {
+            column = SafeIdentifier(base + "_" + strconv.Itoa(n))
+        }
+        used[column] = true
+        mapping.Columns[key] = column
+        if mapping.Types[key] == "" {
+            mapping.Types[key] = "TEXT"
+        }
+    }
+    return mapping
+}
+
+// Renamed reports whether any key was stored under a different column name
+func (m *ColumnMapping) Renamed() bool {
+    for key, column := range m.Columns {
+        if key != column {
+            return true
+        }
+    }
+    return false
+}
+
+// ObjectRecords returns the records of data shaped as an object or an array
+// of objects, and false for any other shape
+func ObjectRecords(data interface{}) ([]map[string]interface{}, bool) {
+    switch v := data.(type) {
+    case map[string]interface{}:
+        return []map[string]interface{}{v}, true
+    case []interface{}:
+        if len(v) == 0 {
+            return nil, false
+        }
+        if _, ok := v[0].(map[string]interface{}); !ok {
+            return nil, false
+        }
+        var records []map[string]interface{}
+        for _, item := range v {
+            if record, ok := item.(map[string]interface{}); ok {
+                records = append(records, record)
+            }
+        }
+        return records, true
+    }
+    return nil, false
+}
+
+// PostgreSQLType maps a decoded JSON value to the PostgreSQL type of the
+// column holding it
+func PostgreSQLType(value interface{}) string {
+    switch value.(type) {
+    case int, int32, int64:
+        return "INTEGER"
+    case float32, float64:
+        return "NUMERIC"
+    case bool:
+        return "BOOLEAN"
+    case []interface{}, map[string]interface{}:
+        return "JSONB"
+    case string:
+        return "TEXT"
+    default:
+        return "TEXT"
+    }
+}
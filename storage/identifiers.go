@@ -0,0 +1,95 @@
+package storage
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "strings"
+    "unicode/utf8"
+
+    "github.com/lib/pq"
+)
+
+// MaxIdentifierBytes is PostgreSQL's NAMEDATALEN-1 limit; longer identifiers
+// are silently truncated by the server
+const MaxIdentifierBytes = 63
+
+// identifierHashLength is the number of hex digits of the name hash kept
+// when an identifier has to be shortened
+const identifierHashLength = 8
+
+// reservedWords are the PostgreSQL key words that cannot be used as bare
+// table or column names
+var reservedWords = map[string]bool{}
+
+func init() {
+    for _, word := range strings.Fields(`
+        all analyse analyze and any array as asc asymmetric authorization
+        binary both case cast check collate collation column concurrently
+        constraint create cross current_catalog current_date current_role
+        current_schema current_time current_timestamp current_user default
+        deferrable desc distinct do else end except false fetch for foreign
+        freeze from full grant group having ilike in initially inner
+        intersect into is isnull join lateral leading left like limit
+        localtime localtimestamp natural not notnull null offset on only or
+        order outer overlaps placing primary references returning right
+        select session_user similar some symmetric table tablesample then to
+        trailing true union unique user using variadic verbose when where
+        window with`) {
+        reservedWords[word] = true
+    }
+}
+
+// SafeIdentifier lowercases a name, matching how PostgreSQL folds unquoted
+// identifiers, and fits it into 63 bytes. Names that are too long keep a
+// prefix and get a hash of the full name appended, so distinct long names
+// stay distinct instead of being truncated into each other.
+func SafeIdentifier(name string) string {
+    name = strings.ToLower(name)
+    if len(name) <= MaxIdentifierBytes {
+        return name
+    }
+
+    sum := sha256.Sum256([]byte(name))
+    suffix := "_" + hex.EncodeToString(sum[:])[:identifierHashLength]
+
+    prefix := name[:MaxIdentifierBytes-len(suffix)]
+    // Never cut a multi-byte character in half
+    for !utf8.ValidString(prefix) {
+        prefix = prefix[:len(prefix)-1]
+    }
+    return prefix + suffix
+}
+
+// QuoteIdentifier renders an identifier for use in SQL, quoting it when it
+// is a reserved word or is not a plain lowercase identifier
+func QuoteIdentifier(name string) string {
+    if reservedWords[name] || !isPlainIdentifier(name) {
+        return pq.QuoteIdentifier(name)
+    }
+    return name
+}
+
+// isPlainIdentifier reports whether name can be used unquoted without
+// changing its meaning
+func isPlainIdentifier(name string) bool {
+    if name == "" {
+        return false
+    }
+    for i, r := range name {
+        switch {
+        case r >= 'a' && r <= 'z', r == '_':
+        case (r >= '0' && r <= '9') || r == '$':
+            if i == 0 {
+                return false
+            }
+        default:
+            return false
+        }
+    }
+    return true
+}
+
+// TableName returns the table name used for a function's output
+func TableName(functionName string) string {
+    return SafeIdentifier(functionName)
+}
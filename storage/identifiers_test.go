@@ -0,0 +1,145 @@
+package storage
+
+import (
+    "fmt"
+    "strings"
+    "testing"
+    "unicode/utf8"
+)
+
+func TestSafeIdentifier(t *testing.T) {
+    tests := []struct {
+        name   string
+        input  string
+        want   string
+        quoted string
+    }{
+        {"reserved word", "Select", "select", `"select"`},
+        {"reserved user", "User", "user", `"user"`},
+        {"reserved order", "order", "order", `"order"`},
+        {"mixed case", "GetUserData", "getuserdata", "getuserdata"},
+        {"underscores and digits", "Get_Data2", "get_data2", "get_data2"},
+        {"leading digit", "2fa", "2fa", `"2fa"`},
+        {"embedded quote", `Say"Hi"`, `say"hi"`, `"say""hi"""`},
+        {"space", "Unit Price", "unit price", `"unit price"`},
+        {"unicode", "Größe", "größe", `"größe"`},
+        {"dollar inside", "a$b", "a$b", "a$b"},
+        {"empty", "", "", `""`},
+        {"exactly 63 bytes", strings.Repeat("a", 63), strings.Repeat("a", 63), strings.Repeat("a", 63)},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := SafeIdentifier(tt.input)
+            if got != tt.want {
+                t.Errorf("SafeIdentifier(%q) = %q, want %q", tt.input, got, tt.want)
+            }
+            if quoted := QuoteIdentifier(got); quoted != tt.quoted {
+                t.Errorf("QuoteIdentifier(%q) = %s, want %s", got, quoted, tt.quoted)
+            }
+        })
+    }
+}
+
+func TestSafeIdentifierTruncation(t *testing.T) {
+    long := strings.Repeat("VeryLongGenericFunctionName", 3)
+    tests := []struct {
+        name  string
+        input string
+        // prefix is the start of the name that must be kept
+        prefix string
+    }{
+        {"64 bytes", strings.Repeat("a", 64), strings.Repeat("a", 54)},
+        {"generics heavy", long, strings.ToLower(long[:54])},
+        {"multi-byte character at the cut", "a" + strings.Repeat("é", 40), "a" + strings.Repeat("é", 26)},
+        {"reserved word prefix", "Select" + strings.Repeat("x", 80), "select" + strings.Repeat("x", 48)},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := SafeIdentifier(tt.input)
+            if len(got) > MaxIdentifierBytes {
+                t.Errorf("SafeIdentifier(%q) = %q, %d bytes long", tt.input, got, len(got))
+            }
+            if !utf8.ValidString(got) {
+                t.Errorf("SafeIdentifier(%q) = %q, which is not valid UTF-8", tt.input, got)
+            }
+            if !strings.HasPrefix(got, tt.prefix) {
+                t.Errorf("SafeIdentifier(%q) = %q, want prefix %q", tt.input, got, tt.prefix)
+            }
+            suffix := got[len(got)-identifierHashLength-1:]
+            if suffix[0] != '_' || strings.Trim(suffix[1:], "0123456789abcdef") != "" {
+                t.Errorf("SafeIdentifier(%q) = %q, want a _<hash> suffix of %d hex digits", tt.input, got, identifierHashLength)
+            }
+            if again := SafeIdentifier(tt.input); again != got {
+                t.Errorf("SafeIdentifier(%q) is not deterministic: %q then %q", tt.input, got, again)
+            }
+        })
+    }
+}
+
+func TestSafeIdentifierDistinct(t *testing.T) {
+    // Names only differing after the first 63 bytes would be truncated into
+    // one another by PostgreSQL
+    long := strings.Repeat("x", 70)
+    seen := map[string]string{}
+    for i := 0; i < 1000; i++ {
+        for _, name := range []string{
+            fmt.Sprintf("%s%d", long, i),
+            fmt.Sprintf("%s_v%d", long, i),
+            fmt.Sprintf("%d%s", i, long),
+        } {
+            got := SafeIdentifier(name)
+            if other, ok := seen[got]; ok {
+                t.Fatalf("SafeIdentifier(%q) and SafeIdentifier(%q) are both %q", name, other, got)
+            }
+            seen[got] = name
+        }
+    }
+}
+
+func TestNormalizeColumnName(t *testing.T) {
+    tests := []struct {
+        key  string
+        want string
+    }{
+        {"Name", "name"},
+        {"User ID", "user_id"},
+        {"in-stock", "in_stock"},
+        {"order", "order"},
+        {"1st Place", "c_1st_place"},
+        {`say "hi"`, "say_hi"},
+        {"Größe", "gr_e"},
+        {"___", "column"},
+        {"", "column"},
+        {strings.Repeat("Key", 30), SafeIdentifier(strings.Repeat("key", 30))},
+    }
+    for _, tt := range tests {
+        if got := normalizeColumnName(tt.key); got != tt.want {
+            t.Errorf("normalizeColumnName(%q) = %q, want %q", tt.key, got, tt.want)
+        }
+    }
+}
+
+func TestBuildColumnMappingCollisions(t *testing.T) {
+    long := strings.Repeat("k", 70)
+    records := []map[string]interface{}{{
+        "ID":        1,
+        "id":        2,
+        "User Name": "a",
+        "user_name": "b",
+        long + "1":  true,
+        long + "2":  false,
+    }}
+    mapping := BuildColumnMapping(records, PostgreSQLType)
+
+    used := map[string]string{"id": "generated id column"}
+    for _, key := range mapping.Keys {
+        column := mapping.Columns[key]
+        if len(column) > MaxIdentifierBytes {
+            t.Errorf("key %q maps to %q, %d bytes long", key, column, len(column))
+        }
+        if other, ok := used[column]; ok {
+            t.Errorf("keys %q and %q both map to column %q", key, other, column)
+        }
+        used[column] = key
+    }
+}
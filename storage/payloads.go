@@ -0,0 +1,143 @@
+package storage
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+)
+
+// CanonicalPayload encodes a payload as canonical JSON and returns it with
+// its hash. Outputs are decoded JSON values, whose object keys encoding/json
+// sorts, so equal payloads always hash equally.
+func CanonicalPayload(payload interface{}) (string, []byte, error) {
+    data, err := json.Marshal(payload)
+    if err != nil {
+        return "", nil, fmt.Errorf("failed to marshal payload: %w", err)
+    }
+    sum := sha256.Sum256(data)
+    return hex.EncodeToString(sum[:]), data, nil
+}
+
+// PayloadStats summarizes a whole function output, including the rows
+// that were not stored because the output was truncated
+type PayloadStats struct {
+    PayloadRef
+    // Rows is the number of rows the output has, and StoredRows how many
+    // of them were stored
+    Rows       int  `json:"rows"`
+    StoredRows int  `json:"stored_rows"`
+    Truncated  bool `json:"truncated"`
+    // Size is the length of the output's JSON encoding in bytes
+    Size int `json:"size"`
+    // DistinctKeys counts the keys across the output's objects
+    DistinctKeys int `json:"distinct_keys"`
+    // Types counts the output's values by JSON type
+    Types map[string]int `json:"types"`
+    // Columns has the statistics of every column the output is stored
+    // in: the object keys, "value" for arrays of primitives, or "data"
+    Columns map[string]*ColumnStats `json:"columns"`
+}
+
+// ColumnStats summarizes the values of one column of an output
+type ColumnStats struct {
+    Count int            `json:"count"`
+    Types map[string]int `json:"types"`
+    // Min, Max and Avg are set when the column has numbers
+    Min *float64 `json:"min,omitempty"`
+    Max *float64 `json:"max,omitempty"`
+    Avg *float64 `json:"avg,omitempty"`
+
+    sum     float64
+    numbers int
+}
+
+// add records a value of the column
+func (c *ColumnStats) add(value interface{}) {
+    c.Count++
+    c.Types[jsonType(value)]++
+    number, ok := value.(float64)
+    if !ok {
+        return
+    }
+    if c.numbers == 0 || number < *c.Min {
+        c.Min = &number
+    }
+    if c.numbers == 0 || number > *c.Max {
+        c.Max = &number
+    }
+    c.sum += number
+    c.numbers++
+    avg := c.sum / float64(c.numbers)
+    c.Avg = &avg
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(value interface{}) string {
+    switch value.(type) {
+    case nil:
+        return "null"
+    case bool:
+        return "boolean"
+    case float64, json.Number:
+        return "number"
+    case string:
+        return "string"
+    case []interface{}:
+        return "array"
+    case map[string]interface{}:
+        return "object"
+    }
+    return fmt.Sprintf("%T", value)
+}
+
+// ComputePayloadStats summarizes an output. Columns follow how storage
+// lays the output out: arrays have a row per element, objects a column per
+// key, and primitives a single value or data column.
+func ComputePayloadStats(data interface{}) PayloadStats {
+    stats := PayloadStats{
+        Rows:    1,
+        Types:   make(map[string]int),
+        Columns: make(map[string]*ColumnStats),
+    }
+    if encoded, err := json.Marshal(data); err == nil {
+        stats.Size = len(encoded)
+    }
+
+    add := func(column string, value interface{}) {
+        c, ok := stats.Columns[column]
+        if !ok {
+            c = &ColumnStats{Types: make(map[string]int)}
+            stats.Columns[column] = c
+        }
+        c.add(value)
+        stats.Types[jsonType(value)]++
+    }
+    addRow := func(row interface{}, column string) {
+        if record, ok := row.(map[string]interface{}); ok {
+            for key, value := range record {
+                add(key, value)
+            }
+            return
+        }
+        add(column, row)
+    }
+
+    switch v := data.(type) {
+    case []interface{}:
+        stats.Rows = len(v)
+        for _, item := range v {
+            addRow(item, "value")
+        }
+    default:
+        addRow(v, "data")
+    }
+
+    for column := range stats.Columns {
+        if column != "value" && column != "data" {
+            stats.DistinctKeys++
+        }
+    }
+    stats.StoredRows = stats.Rows
+    return stats
+}
@@ -0,0 +1,152 @@
+// Package storage defines where floq keeps the outputs of the functions it
+// runs: the Storage interface its drivers implement, the records they store
+// and how tables and columns are named. Drivers written outside floq can be
+// checked against it with the conformance suite in storagetest.
+package storage
+
+import (
+    "context"
+    "errors"
+)
+
+// Storage persists the tables generated from function outputs. Every
+// method that takes a table name expects it to be a safe identifier as
+// returned by TableName. Database writes fail once their ctx is
+// cancelled, rolling back what they had written.
+type Storage interface {
+    Connect(ctx context.Context) error
+    Close() error
+    // CreateTable replaces tableName with an empty table shaped for data.
+    // mapping is non-nil when data holds objects and gives one column per key.
+    CreateTable(ctx context.Context, tableName string, data interface{}, mapping *ColumnMapping) error
+    // InsertData stores data in a table created by CreateTable with the same
+    // mapping
+    InsertData(ctx context.Context, tableName string, data interface{}, mapping *ColumnMapping) error
+    // ReplaceTable is CreateTable followed by InsertData as one write: if
+    // the insert fails or ctx is cancelled, the previous table is kept
+    ReplaceTable(ctx context.Context, tableName string, data interface{}, mapping *ColumnMapping) error
+    // StoreInvocations replaces tableName with one row per fuzzed invocation
+    StoreInvocations(ctx context.Context, tableName string, invocations []Invocation) error
+    // CommentOnTable attaches a comment to a table and, keyed by column name,
+    // to its columns
+    CommentOnTable(ctx context.Context, tableName, comment string, columnComments map[string]string) error
+    // StorePayload stores a function output content-addressed, once per
+    // distinct payload, and references it from a row describing ref. It
+    // returns the payload hash and whether the payload was new.
+    StorePayload(ctx context.Context, ref PayloadRef, payload interface{}) (string, bool, error)
+    // StoreVulnerabilities appends the known vulnerabilities found in a
+    // repository's dependencies to the vulnerabilities table
+    StoreVulnerabilities(ctx context.Context, repository, ref, runID string, findings []Vulnerability) error
+    // StorePayloadStats appends the statistics of a function output to the
+    // payload_stats table
+    StorePayloadStats(ctx context.Context, stats PayloadStats) error
+    // StoreSignatures appends the parameters and results of functions to
+    // the function_signatures table
+    StoreSignatures(ctx context.Context, rows []SignatureRow) error
+}
+
+// Tables every storage appends to, besides the tables of function outputs
+const (
+    // VulnerabilitiesTable holds the known-vulnerable dependencies of every
+    // scanned repository
+    VulnerabilitiesTable = "vulnerabilities"
+    // PayloadStatsTable holds summary statistics of function outputs
+    PayloadStatsTable = "payload_stats"
+    // SignaturesTable holds the parameters and results of every extracted
+    // function, one row each
+    SignaturesTable = "function_signatures"
+)
+
+// TableReader is implemented by storages that can read back the tables
+// they wrote. The conformance checks compare the stored rows of storages
+// implementing it, and only check that writes succeed for the others.
+type TableReader interface {
+    // ReadTable returns a table's columns and rows, keyed by column name,
+    // in insertion order. It reports false if the table does not exist.
+    ReadTable(tableName string) (*MemoryTable, bool, error)
+}
+
+// ErrTablesUnreadable is returned by storages that implement TableReader
+// through an embedded storage but cannot actually read tables back
+var ErrTablesUnreadable = errors.New("storage cannot read tables back")
+
+// MemoryTable is a table held in memory, or read back from a storage by a
+// TableReader
+type MemoryTable struct {
+    Columns        []string
+    Rows           []map[string]interface{}
+    Comment        string
+    ColumnComments map[string]string
+}
+
+// IsGeneratedColumn reports whether a column is filled by the storage
+// itself rather than from the stored data
+func IsGeneratedColumn(column string) bool {
+    return column == "id" || column == "created_at"
+}
+
+// Invocation records a single fuzzed call of a function with generated arguments
+type Invocation struct {
+    Function       string      `json:"function"`
+    Arguments      []string    `json:"arguments"`
+    Output         interface{} `json:"output,omitempty"`
+    Representation string      `json:"representation,omitempty"`
+    Error          string      `json:"error,omitempty"`
+}
+
+// PayloadRef identifies the function execution that produced a payload
+type PayloadRef struct {
+    Repository string `json:"repository"`
+    Ref        string `json:"ref,omitempty"`
+    Package    string `json:"package"`
+    Function   string `json:"function"`
+    RunID      string `json:"run_id,omitempty"`
+}
+
+// Vulnerability is a known vulnerability of a dependency
+type Vulnerability struct {
+    Module   string   `json:"module"`
+    Version  string   `json:"version"`
+    ID       string   `json:"id"`
+    Aliases  []string `json:"aliases,omitempty"`
+    Summary  string   `json:"summary,omitempty"`
+    Severity string   `json:"severity"`
+    Fixed    string   `json:"fixed,omitempty"`
+}
+
+// Kinds of signature fields
+const (
+    SignatureParameter = "parameter"
+    SignatureResult    = "result"
+)
+
+// SignatureField is one parameter or result of a signature
+type SignatureField struct {
+    // Position is the field's zero-based index among the parameters or
+    // among the results
+    Position int `json:"position"`
+    // Name is empty for unnamed fields
+    Name string `json:"name,omitempty"`
+    Type string `json:"type"`
+    // Variadic is set on the ...T last parameter, whose Type is T
+    Variadic bool `json:"variadic,omitempty"`
+}
+
+// SignatureRow is a row of the function_signatures table
+type SignatureRow struct {
+    PayloadRef
+    Kind string
+    SignatureField
+    // Documented reports whether the doc comment mentions a named
+    // parameter; it is nil for results and unnamed parameters
+    Documented *bool
+}
+
+// DocumentedColumn returns the value of the documented column, nil for
+// NULL
+func (r SignatureRow) DocumentedColumn() interface{} {
+    if r.Documented == nil {
+        return nil
+    }
+    return *r.Documented
+}
@@ -0,0 +1,568 @@
+// Package storagetest is the conformance suite of storage.Storage
+// implementations, in the spirit of the database/sql driver tests: it checks
+// that a storage stores function outputs the way floq's own drivers do.
+// Call Check from the implementation's tests.
+package storagetest
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/Spottybadrabbit/Floq-v1/storage"
+)
+
+// conformanceTablePrefix namespaces the tables written by the conformance
+// checks, so they are easy to find and drop in a shared database
+const conformanceTablePrefix = "floq_conformance_"
+
+// conformanceRepository is the repository the conformance checks attribute
+// payloads and vulnerabilities to
+const conformanceRepository = "floq://conformance"
+
+// Result is the outcome of one conformance check
+type Result struct {
+    Check string `json:"check"`
+    // Verified is false when the storage could not read its tables back,
+    // so only the writes themselves were checked
+    Verified bool  `json:"verified"`
+    Err      error `json:"-"`
+}
+
+// T reports conformance failures; *testing.T implements it, so a
+// storage's tests can call Check directly
+type T interface {
+    Helper()
+    Errorf(format string, args ...interface{})
+    Logf(format string, args ...interface{})
+}
+
+// Check runs the conformance checks and reports every failure to t
+func Check(t T, newStorage func() (storage.Storage, error)) {
+    t.Helper()
+    for _, result := range Run(context.Background(), newStorage) {
+        if result.Err != nil {
+            t.Errorf("%s: %v", result.Check, result.Err)
+        } else if !result.Verified {
+            t.Logf("%s: stored rows not verified; the storage does not implement TableReader", result.Check)
+        }
+    }
+}
+
+// conformanceCheck is a behavior every Storage implementation must have
+type conformanceCheck struct {
+    name string
+    run  func(ctx context.Context, c *conformanceRun) error
+}
+
+// storageConformanceChecks are run in order, each against a fresh storage
+var storageConformanceChecks = []conformanceCheck{
+    {"object tables", checkObjectTables},
+    {"primitive arrays", checkPrimitiveArrays},
+    {"single values", checkSingleValues},
+    {"create replaces", checkCreateReplaces},
+    {"replace table", checkReplaceTable},
+    {"insert appends", checkInsertAppends},
+    {"missing tables", checkMissingTables},
+    {"table naming", checkTableNaming},
+    {"comments", checkComments},
+    {"invocations", checkInvocations},
+    {"payload upserts", checkPayloadUpserts},
+    {"vulnerabilities", checkVulnerabilities},
+    {"payload stats", checkPayloadStats},
+    {"signatures", checkSignatures},
+}
+
+// Run runs every conformance check against a fresh storage returned by
+// newStorage, which must not be connected yet, writing
+// under ctx. Checks write tables prefixed with floq_conformance_, so run
+// them against an empty or scratch database.
+func Run(ctx context.Context, newStorage func() (storage.Storage, error)) []Result {
+    // Payloads and vulnerabilities outlive the checks in real databases,
+    // so every run uses distinct ones
+    nonce := strconv.FormatInt(time.Now().UnixNano(), 36)
+
+    var results []Result
+    for _, check := range storageConformanceChecks {
+        result := Result{Check: check.name}
+        store, err := newStorage()
+        if err != nil {
+            result.Err = fmt.Errorf("failed to create storage: %w", err)
+            results = append(results, result)
+            continue
+        }
+        if err := store.Connect(ctx); err != nil {
+            result.Err = fmt.Errorf("failed to connect: %w", err)
+            results = append(results, result)
+            continue
+        }
+
+        run := &conformanceRun{storage: store, nonce: nonce, verified: true}
+        run.reader, _ = store.(storage.TableReader)
+        result.Err = check.run(ctx, run)
+        if err := store.Close(); err != nil && result.Err == nil {
+            result.Err = fmt.Errorf("failed to close: %w", err)
+        }
+        result.Verified = run.verified
+        results = append(results, result)
+    }
+    return results
+}
+
+// conformanceRun is the state of one check against one storage
+type conformanceRun struct {
+    storage  storage.Storage
+    reader   storage.TableReader
+    nonce    string
+    verified bool
+}
+
+// read reads a table back. It returns false without an error when the
+// storage cannot read tables, marking the check unverified.
+func (c *conformanceRun) read(tableName string) (*storage.MemoryTable, bool, error) {
+    if c.reader != nil {
+        table, found, err := c.reader.ReadTable(tableName)
+        if !errors.Is(err, storage.ErrTablesUnreadable) {
+            if err != nil {
+                return nil, false, fmt.Errorf("failed to read %s: %w", tableName, err)
+            }
+            if !found {
+                return nil, false, fmt.Errorf("table %s does not exist", tableName)
+            }
+            return table, true, nil
+        }
+        c.reader = nil
+    }
+    c.verified = false
+    return nil, false, nil
+}
+
+// expectTable checks that a table has exactly the given data columns and
+// rows, in order. Values are compared by their JSON encoding, with JSON
+// text decoded first, so a storage may keep values as text or JSON.
+func (c *conformanceRun) expectTable(tableName string, columns []string, rows []map[string]interface{}) error {
+    table, ok, err := c.read(tableName)
+    if err != nil || !ok {
+        return err
+    }
+
+    var stored []string
+    for _, column := range table.Columns {
+        if !storage.IsGeneratedColumn(column) {
+            stored = append(stored, column)
+        }
+    }
+    sort.Strings(stored)
+    want := append([]string(nil), columns...)
+    sort.Strings(want)
+    if strings.Join(stored, ",") != strings.Join(want, ",") {
+        return fmt.Errorf("table %s has columns %v, want %v", tableName, stored, want)
+    }
+
+    if len(table.Rows) != len(rows) {
+        return fmt.Errorf("table %s has %d rows, want %d", tableName, len(table.Rows), len(rows))
+    }
+    for i, row := range rows {
+        for _, column := range columns {
+            got, want := conformanceValue(table.Rows[i][column]), conformanceValue(row[column])
+            if got != want {
+                return fmt.Errorf("table %s row %d column %s is %s, want %s", tableName, i+1, column, got, want)
+            }
+        }
+    }
+    return nil
+}
+
+// conformanceValue renders a stored value for comparison. Text holding
+// JSON is decoded, and missing values equal empty strings, since storages
+// may keep optional text as NULL.
+func conformanceValue(value interface{}) string {
+    switch v := value.(type) {
+    case nil:
+        value = ""
+    case []byte:
+        value = string(v)
+    }
+    if text, ok := value.(string); ok {
+        var decoded interface{}
+        if json.Unmarshal([]byte(text), &decoded) == nil {
+            value = decoded
+        }
+    }
+    data, err := json.Marshal(value)
+    if err != nil {
+        return fmt.Sprintf("%v", value)
+    }
+    return string(data)
+}
+
+// conformanceTable returns the name of a table written by the checks
+func conformanceTable(name string) string {
+    return storage.TableName(conformanceTablePrefix + name)
+}
+
+// conformanceMapping builds the column mapping the extractor would use for
+// object data
+func conformanceMapping(data interface{}) *storage.ColumnMapping {
+    records, ok := storage.ObjectRecords(data)
+    if !ok {
+        return nil
+    }
+    return storage.BuildColumnMapping(records, storage.PostgreSQLType)
+}
+
+// createAndInsert creates a table shaped for data and inserts data into it,
+// like the extractor stores a function's output
+func (c *conformanceRun) createAndInsert(ctx context.Context, tableName string, data interface{}) error {
+    mapping := conformanceMapping(data)
+    if err := c.storage.CreateTable(ctx, tableName, data, mapping); err != nil {
+        return fmt.Errorf("failed to create %s: %w", tableName, err)
+    }
+    if err := c.storage.InsertData(ctx, tableName, data, mapping); err != nil {
+        return fmt.Errorf("failed to insert into %s: %w", tableName, err)
+    }
+    return nil
+}
+
+// checkObjectTables stores objects in one column per normalized key
+func checkObjectTables(ctx context.Context, c *conformanceRun) error {
+    tableName := conformanceTable("Objects")
+    data := []interface{}{
+        map[string]interface{}{"Name": "first", "User ID": float64(1), "nested": map[string]interface{}{"ok": true}},
+        map[string]interface{}{"Name": "second", "User ID": float64(2), "nested": []interface{}{"a", "b"}, "id": "key"},
+    }
+    if err := c.createAndInsert(ctx, tableName, data); err != nil {
+        return err
+    }
+    // Keys colliding with the generated id column are renamed
+    return c.expectTable(tableName, []string{"name", "user_id", "nested", "id_2"}, []map[string]interface{}{
+        {"name": "first", "user_id": float64(1), "nested": map[string]interface{}{"ok": true}},
+        {"name": "second", "user_id": float64(2), "nested": []interface{}{"a", "b"}, "id_2": "key"},
+    })
+}
+
+// checkPrimitiveArrays stores arrays of primitives as one value row per
+// element
+func checkPrimitiveArrays(ctx context.Context, c *conformanceRun) error {
+    tableName := conformanceTable("Primitives")
+    if err := c.createAndInsert(ctx, tableName, []interface{}{"text", float64(2), true}); err != nil {
+        return err
+    }
+    return c.expectTable(tableName, []string{"value"}, []map[string]interface{}{
+        {"value": "text"}, {"value": "2"}, {"value": "true"},
+    })
+}
+
+// checkSingleValues stores any other output as a single data row. Empty
+// arrays get a data column too, but no rows.
+func checkSingleValues(ctx context.Context, c *conformanceRun) error {
+    tableName := conformanceTable("Scalar")
+    if err := c.createAndInsert(ctx, tableName, "hello"); err != nil {
+        return err
+    }
+    if err := c.expectTable(tableName, []string{"data"}, []map[string]interface{}{{"data": "hello"}}); err != nil {
+        return err
+    }
+
+    tableName = conformanceTable("Empty")
+    if err := c.createAndInsert(ctx, tableName, []interface{}{}); err != nil {
+        return err
+    }
+    return c.expectTable(tableName, []string{"data"}, nil)
+}
+
+// checkCreateReplaces recreates tables empty, even with another shape
+func checkCreateReplaces(ctx context.Context, c *conformanceRun) error {
+    tableName := conformanceTable("Replaced")
+    if err := c.createAndInsert(ctx, tableName, []interface{}{"old"}); err != nil {
+        return err
+    }
+    data := map[string]interface{}{"fresh": "yes"}
+    if err := c.storage.CreateTable(ctx, tableName, data, conformanceMapping(data)); err != nil {
+        return fmt.Errorf("failed to recreate %s: %w", tableName, err)
+    }
+    return c.expectTable(tableName, []string{"fresh"}, nil)
+}
+
+// checkReplaceTable replaces a table with another shape holding new data
+// in one call
+func checkReplaceTable(ctx context.Context, c *conformanceRun) error {
+    tableName := conformanceTable("Swapped")
+    if err := c.createAndInsert(ctx, tableName, []interface{}{"old"}); err != nil {
+        return err
+    }
+    data := []interface{}{map[string]interface{}{"fresh": "yes"}, map[string]interface{}{"fresh": "too"}}
+    if err := c.storage.ReplaceTable(ctx, tableName, data, conformanceMapping(data)); err != nil {
+        return fmt.Errorf("failed to replace %s: %w", tableName, err)
+    }
+    return c.expectTable(tableName, []string{"fresh"}, []map[string]interface{}{{"fresh": "yes"}, {"fresh": "too"}})
+}
+
+// checkInsertAppends keeps the rows of earlier inserts
+func checkInsertAppends(ctx context.Context, c *conformanceRun) error {
+    tableName := conformanceTable("Appended")
+    data := map[string]interface{}{"n": float64(1)}
+    if err := c.createAndInsert(ctx, tableName, data); err != nil {
+        return err
+    }
+    if err := c.storage.InsertData(ctx, tableName, data, conformanceMapping(data)); err != nil {
+        return fmt.Errorf("failed to insert into %s again: %w", tableName, err)
+    }
+    return c.expectTable(tableName, []string{"n"}, []map[string]interface{}{{"n": float64(1)}, {"n": float64(1)}})
+}
+
+// checkMissingTables refuses to insert into or comment on tables that were
+// never created. Storages that cannot read tables back write blind and
+// cannot know, so they are not checked.
+func checkMissingTables(ctx context.Context, c *conformanceRun) error {
+    tableName := conformanceTable("Missing_" + c.nonce)
+    if _, _, err := c.read(tableName); err == nil {
+        if !c.verified {
+            return nil
+        }
+        return fmt.Errorf("table %s exists before being created", tableName)
+    }
+    if err := c.storage.InsertData(ctx, tableName, "value", nil); err == nil {
+        return fmt.Errorf("inserting into missing table %s succeeded", tableName)
+    }
+    if err := c.storage.CommentOnTable(ctx, tableName, "comment", nil); err == nil {
+        return fmt.Errorf("commenting on missing table %s succeeded", tableName)
+    }
+    return nil
+}
+
+// checkTableNaming accepts every name TableName returns: reserved words,
+// names folded from mixed case and names shortened with a hash, which stay
+// distinct
+func checkTableNaming(ctx context.Context, c *conformanceRun) error {
+    long := strings.Repeat("VeryLongFunctionName", 4)
+    names := []string{
+        storage.TableName("Select"),
+        storage.TableName("User"),
+        conformanceTable("MixedCase"),
+        conformanceTable(long + "A"),
+        conformanceTable(long + "B"),
+    }
+    for _, name := range names {
+        if len(name) > storage.MaxIdentifierBytes {
+            return fmt.Errorf("TableName returned %s, longer than %d bytes", name, storage.MaxIdentifierBytes)
+        }
+        if err := c.createAndInsert(ctx, name, name); err != nil {
+            return err
+        }
+    }
+    for _, name := range names {
+        if err := c.expectTable(name, []string{"data"}, []map[string]interface{}{{"data": name}}); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// checkComments comments on tables and their columns
+func checkComments(ctx context.Context, c *conformanceRun) error {
+    tableName := conformanceTable("Commented")
+    data := map[string]interface{}{"Total Count": float64(3)}
+    if err := c.createAndInsert(ctx, tableName, data); err != nil {
+        return err
+    }
+    err := c.storage.CommentOnTable(ctx, tableName, "Output of a function; it's quoted", map[string]string{"total_count": "The count's total"})
+    if err != nil {
+        return fmt.Errorf("failed to comment on %s: %w", tableName, err)
+    }
+    return nil
+}
+
+// checkInvocations replaces invocation tables with one row per invocation
+func checkInvocations(ctx context.Context, c *conformanceRun) error {
+    tableName := conformanceTable("Invocations")
+    first := []storage.Invocation{
+        {Function: "Double", Arguments: []string{"1"}, Output: float64(2)},
+        {Function: "Double", Arguments: []string{"2"}, Output: map[string]interface{}{"value": float64(4)}},
+    }
+    if err := c.storage.StoreInvocations(ctx, tableName, first); err != nil {
+        return fmt.Errorf("failed to store invocations: %w", err)
+    }
+    if err := c.expectTable(tableName, []string{"arguments", "output"}, []map[string]interface{}{
+        {"arguments": []string{"1"}, "output": float64(2)},
+        {"arguments": []string{"2"}, "output": map[string]interface{}{"value": float64(4)}},
+    }); err != nil {
+        return err
+    }
+
+    second := []storage.Invocation{{Function: "Double", Arguments: []string{"3"}, Output: float64(6)}}
+    if err := c.storage.StoreInvocations(ctx, tableName, second); err != nil {
+        return fmt.Errorf("failed to store invocations again: %w", err)
+    }
+    return c.expectTable(tableName, []string{"arguments", "output"}, []map[string]interface{}{
+        {"arguments": []string{"3"}, "output": float64(6)},
+    })
+}
+
+// checkPayloadUpserts stores equal payloads once under their canonical
+// hash, whatever the key order, and distinct payloads separately
+func checkPayloadUpserts(ctx context.Context, c *conformanceRun) error {
+    ref := storage.PayloadRef{Repository: conformanceRepository, Package: "conformance", Function: "Payload", RunID: c.nonce}
+    payload := func(first string) interface{} {
+        var data map[string]interface{}
+        raw := fmt.Sprintf(`{"first": %q, "nonce": %q, "values": [1, 2]}`, first, c.nonce)
+        json.Unmarshal([]byte(raw), &data)
+        return data
+    }
+
+    want, _, err := storage.CanonicalPayload(payload("a"))
+    if err != nil {
+        return err
+    }
+    steps := []struct {
+        payload interface{}
+        hash    string
+        created bool
+    }{
+        {payload("a"), want, true},
+        {payload("a"), want, false},
+        {payload("b"), "", true},
+    }
+    for i, step := range steps {
+        hash, created, err := c.storage.StorePayload(ctx, ref, step.payload)
+        if err != nil {
+            return fmt.Errorf("failed to store payload %d: %w", i+1, err)
+        }
+        if step.hash != "" && hash != step.hash {
+            return fmt.Errorf("payload %d stored as %s, want its canonical hash %s", i+1, hash, step.hash)
+        }
+        if step.hash == "" && hash == want {
+            return fmt.Errorf("payload %d stored under the hash of a different payload", i+1)
+        }
+        if created != step.created {
+            return fmt.Errorf("payload %d reported new=%t, want %t", i+1, created, step.created)
+        }
+    }
+    return nil
+}
+
+// checkVulnerabilities appends findings to the vulnerabilities table
+func checkVulnerabilities(ctx context.Context, c *conformanceRun) error {
+    repository := conformanceRepository + "/" + c.nonce
+    findings := []storage.Vulnerability{
+        {Module: "example.com/a", Version: "v1.0.0", ID: "GO-0000-0001", Aliases: []string{"CVE-0000-0001", "GHSA-xxxx"}, Severity: "HIGH", Fixed: "v1.0.1"},
+        {Module: "example.com/b", Version: "v0.1.0", ID: "GO-0000-0002", Summary: "Summary", Severity: "UNKNOWN"},
+    }
+    if err := c.storage.StoreVulnerabilities(ctx, repository, "", c.nonce, findings); err != nil {
+        return fmt.Errorf("failed to store vulnerabilities: %w", err)
+    }
+    if err := c.storage.StoreVulnerabilities(ctx, repository, "v1.0.0", c.nonce, findings[:1]); err != nil {
+        return fmt.Errorf("failed to store vulnerabilities again: %w", err)
+    }
+    if err := c.storage.StoreVulnerabilities(ctx, repository, "", c.nonce, nil); err != nil {
+        return fmt.Errorf("failed to store no vulnerabilities: %w", err)
+    }
+
+    table, ok, err := c.read(storage.VulnerabilitiesTable)
+    if err != nil || !ok {
+        return err
+    }
+    // Optional text may be stored as NULL
+    text := func(value interface{}) string {
+        if value == nil {
+            return ""
+        }
+        return fmt.Sprint(value)
+    }
+    var ids []string
+    for _, row := range table.Rows {
+        if text(row["repository"]) == repository {
+            ids = append(ids, fmt.Sprintf("%s@%s:%s", text(row["vuln_id"]), text(row["ref"]), text(row["aliases"])))
+        }
+    }
+    want := []string{"GO-0000-0001@:CVE-0000-0001,GHSA-xxxx", "GO-0000-0002@:", "GO-0000-0001@v1.0.0:CVE-0000-0001,GHSA-xxxx"}
+    if strings.Join(ids, " ") != strings.Join(want, " ") {
+        return fmt.Errorf("stored vulnerabilities %v, want %v", ids, want)
+    }
+    return nil
+}
+
+// checkPayloadStats appends output statistics to the payload_stats table
+func checkPayloadStats(ctx context.Context, c *conformanceRun) error {
+    var data interface{}
+    json.Unmarshal([]byte(`[{"id": 1, "name": "a"}, {"id": 3, "name": null}]`), &data)
+    stats := storage.ComputePayloadStats(data)
+    stats.PayloadRef = storage.PayloadRef{Repository: conformanceRepository, Package: "conformance", Function: "Stats", RunID: c.nonce}
+    stats.StoredRows = 1
+    stats.Truncated = true
+    if err := c.storage.StorePayloadStats(ctx, stats); err != nil {
+        return fmt.Errorf("failed to store payload statistics: %w", err)
+    }
+
+    table, ok, err := c.read(storage.PayloadStatsTable)
+    if err != nil || !ok {
+        return err
+    }
+    want := map[string]interface{}{
+        "row_count":     2,
+        "stored_rows":   1,
+        "truncated":     true,
+        "distinct_keys": 2,
+        "value_types":   map[string]int{"number": 2, "string": 1, "null": 1},
+        "column_stats": map[string]interface{}{
+            "id":   map[string]interface{}{"count": 2, "types": map[string]int{"number": 2}, "min": 1, "max": 3, "avg": 2},
+            "name": map[string]interface{}{"count": 2, "types": map[string]int{"string": 1, "null": 1}},
+        },
+    }
+    for _, row := range table.Rows {
+        if conformanceValue(row["run_id"]) != conformanceValue(c.nonce) {
+            continue
+        }
+        for column, value := range want {
+            if got := conformanceValue(row[column]); got != conformanceValue(value) {
+                return fmt.Errorf("stored %s %s, want %s", column, got, conformanceValue(value))
+            }
+        }
+        return nil
+    }
+    return fmt.Errorf("payload statistics of run %s not found", c.nonce)
+}
+
+// checkSignatures appends signature fields to the function_signatures
+// table, with a documented flag that may be NULL
+func checkSignatures(ctx context.Context, c *conformanceRun) error {
+    ref := storage.PayloadRef{Repository: conformanceRepository, Package: "conformance", Function: "Signature", RunID: c.nonce}
+    documented := true
+    rows := []storage.SignatureRow{
+        {PayloadRef: ref, Kind: storage.SignatureParameter, SignatureField: storage.SignatureField{Position: 0, Name: "ctx", Type: "context.Context"}, Documented: &documented},
+        {PayloadRef: ref, Kind: storage.SignatureParameter, SignatureField: storage.SignatureField{Position: 1, Type: "string", Variadic: true}},
+        {PayloadRef: ref, Kind: storage.SignatureResult, SignatureField: storage.SignatureField{Position: 0, Type: "error"}},
+    }
+    if err := c.storage.StoreSignatures(ctx, rows); err != nil {
+        return fmt.Errorf("failed to store signatures: %w", err)
+    }
+
+    table, ok, err := c.read(storage.SignaturesTable)
+    if err != nil || !ok {
+        return err
+    }
+    var fields []string
+    for _, row := range table.Rows {
+        if conformanceValue(row["run_id"]) != conformanceValue(c.nonce) {
+            continue
+        }
+        fields = append(fields, fmt.Sprintf("%s:%s:%s:%s:%s:%s",
+            conformanceValue(row["kind"]), conformanceValue(row["position"]), conformanceValue(row["name"]),
+            conformanceValue(row["type"]), conformanceValue(row["variadic"]), conformanceValue(row["documented"])))
+    }
+    want := []string{
+        `"parameter":0:"ctx":"context.Context":false:true`,
+        `"parameter":1:"":"string":true:""`,
+        `"result":0:"":"error":false:""`,
+    }
+    if strings.Join(fields, " ") != strings.Join(want, " ") {
+        return fmt.Errorf("stored signatures %v, want %v", fields, want)
+    }
+    return nil
+}
+
@@ -0,0 +1,167 @@
+package main
+
+import (
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// defaultStoreQueueSize is the number of outputs that may wait for storage
+// before execution blocks
+const defaultStoreQueueSize = 16
+
+// storeQueueDepth counts the stores waiting in the queues of every
+// extractor of the process, for the live statistics
+var storeQueueDepth atomic.Int64
+
+// StoreQueueStats describes how a repository's outputs queued up between
+// execution and storage
+type StoreQueueStats struct {
+    Capacity int `json:"capacity"`
+    // MaxDepth is the most stores that were pending at once
+    MaxDepth int `json:"max_depth"`
+    // BlockedMs is how long execution waited for room in the queue
+    BlockedMs int64 `json:"blocked_ms"`
+}
+
+// storeJob writes to the database, recording its outcome in result
+type storeJob func(result *ProcessingResult)
+
+// storePipeline decouples executing functions from storing their outputs.
+// The executor submits a job per output to a bounded queue drained by a
+// single consumer; when the database falls behind, the queue fills up and
+// submit blocks, so execution slows down to the pace of the writes instead
+// of holding ever more outputs in memory. Jobs record their outcome in a
+// pending result the executor collects into its own.
+type storePipeline struct {
+    jobs    chan storeJob
+    done    chan struct{}
+    queued  atomic.Int64
+    blocked time.Duration
+    stats   StoreQueueStats
+
+    mu      sync.Mutex
+    pending *ProcessingResult
+}
+
+// newStorePipeline starts a pipeline queueing up to capacity stores
+func newStorePipeline(capacity int) *storePipeline {
+    p := &storePipeline{
+        jobs:    make(chan storeJob, capacity),
+        done:    make(chan struct{}),
+        stats:   StoreQueueStats{Capacity: capacity},
+        pending: &ProcessingResult{},
+    }
+    go p.consume()
+    return p
+}
+
+// consume runs the queued jobs in order
+func (p *storePipeline) consume() {
+    defer close(p.done)
+    for job := range p.jobs {
+        var stored ProcessingResult
+        job(&stored)
+        p.queued.Add(-1)
+        storeQueueDepth.Add(-1)
+
+        p.mu.Lock()
+        mergeStored(p.pending, &stored)
+        p.mu.Unlock()
+    }
+}
+
+// submit queues a job, blocking while the queue is full
+func (p *storePipeline) submit(job storeJob) {
+    depth := int(p.queued.Add(1))
+    storeQueueDepth.Add(1)
+    p.stats.MaxDepth = max(p.stats.MaxDepth, depth)
+
+    select {
+    case p.jobs <- job:
+        return
+    default:
+    }
+    start := time.Now()
+    p.jobs <- job
+    p.blocked += time.Since(start)
+}
+
+// collect moves the outcome of the jobs finished so far into result
+func (p *storePipeline) collect(result *ProcessingResult) {
+    p.mu.Lock()
+    stored := p.pending
+    p.pending = &ProcessingResult{}
+    p.mu.Unlock()
+
+    mergeStored(result, stored)
+}
+
+// close waits for the queued jobs, collects their outcome into result and
+// records the queue's statistics
+func (p *storePipeline) close(result *ProcessingResult) {
+    close(p.jobs)
+    <-p.done
+    p.collect(result)
+
+    stats := p.stats
+    stats.BlockedMs = p.blocked.Milliseconds()
+    result.StoreQueue = &stats
+}
+
+// mergeStored adds what store jobs recorded in src to dst
+func mergeStored(dst, src *ProcessingResult) {
+    dst.Errors = append(dst.Errors, src.Errors...)
+    dst.ExecutedFunctions = append(dst.ExecutedFunctions, src.ExecutedFunctions...)
+    dst.CreatedTables = appendMissing(dst.CreatedTables, src.CreatedTables)
+    dst.TableCollisions = append(dst.TableCollisions, src.TableCollisions...)
+    dst.SchemaMismatches = append(dst.SchemaMismatches, src.SchemaMismatches...)
+    dst.DeduplicatedPayloads += src.DeduplicatedPayloads
+    if len(src.Representations) > 0 {
+        dst.Representations = mergeMaps(dst.Representations, src.Representations)
+    }
+    if len(src.OutputSamples) > 0 {
+        dst.OutputSamples = mergeMaps(dst.OutputSamples, src.OutputSamples)
+    }
+    if len(src.TruncatedOutputs) > 0 {
+        dst.TruncatedOutputs = mergeMaps(dst.TruncatedOutputs, src.TruncatedOutputs)
+    }
+    if len(src.PayloadHashes) > 0 {
+        dst.PayloadHashes = mergeMaps(dst.PayloadHashes, src.PayloadHashes)
+    }
+}
+
+// startStorePipeline starts the queue between execution and storage,
+// unless the queue size is zero and outputs are stored as they come
+func (g *GitHubFunctionExtractor) startStorePipeline() {
+    if size := g.execConfig.StoreQueueSize; size > 0 {
+        g.pipeline = newStorePipeline(size)
+    }
+}
+
+// enqueueStore runs a store job through the pipeline, or right away
+// against result when there is none
+func (g *GitHubFunctionExtractor) enqueueStore(result *ProcessingResult, job storeJob) {
+    if g.pipeline == nil {
+        job(result)
+        return
+    }
+    g.pipeline.submit(job)
+}
+
+// collectStored moves the outcome of the finished stores into result
+func (g *GitHubFunctionExtractor) collectStored(result *ProcessingResult) {
+    if g.pipeline != nil {
+        g.pipeline.collect(result)
+    }
+}
+
+// stopStorePipeline waits for the pending stores and collects their
+// outcome into result
+func (g *GitHubFunctionExtractor) stopStorePipeline(result *ProcessingResult) {
+    if g.pipeline == nil {
+        return
+    }
+    g.pipeline.close(result)
+    g.pipeline = nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "iter"
+)
+
+// errStopIteration ends the repository walk when the consumer stops early
+var errStopIteration = errors.New("iteration stopped")
+
+// Functions returns an iterator over the functions of the cloned repository,
+// yielding each file's functions as soon as the file is parsed so callers
+// can consume them in a pipeline and stop early without extracting the
+// rest. Files that fail to parse yield an error and iteration continues;
+// files with syntax errors yield the recovered functions followed by a
+// *PartialParseError. Cancelling ctx yields ctx.Err() and ends iteration.
+//
+//     if err := extractor.CloneRepository(repoURL); err != nil {
+//         return err
+//     }
+//     defer extractor.Cleanup()
+//     for function, err := range extractor.Functions(ctx) {
+//         ...
+//     }
+func (g *GitHubFunctionExtractor) Functions(ctx context.Context) iter.Seq2[FunctionInfo, error] {
+    return func(yield func(FunctionInfo, error) bool) {
+        if g.repoPath == "" {
+            yield(FunctionInfo{}, fmt.Errorf("no repository cloned"))
+            return
+        }
+
+        ignore, err := LoadIgnoreRules(g.extractConfig.IgnoreFile, g.repoPath)
+        if err != nil {
+            yield(FunctionInfo{}, fmt.Errorf("failed to load ignore rules: %w", err))
+            return
+        }
+        g.ignore = ignore
+        g.modulePath = readModulePath(g.repoPath)
+
+        _, err = g.walkGoFiles(func(filePath string) error {
+            if err := ctx.Err(); err != nil {
+                return err
+            }
+            // Functions in files the host build excludes are not extracted
+            if buildExclusion(filePath) != "" {
+                return nil
+            }
+
+            functions, err := g.extractFile(filePath, nil)
+            for _, function := range functions {
+                if !yield(function, nil) {
+                    return errStopIteration
+                }
+            }
+            if err != nil && !yield(FunctionInfo{}, err) {
+                return errStopIteration
+            }
+            return nil
+        })
+        if err != nil && !errors.Is(err, errStopIteration) {
+            yield(FunctionInfo{}, err)
+        }
+    }
+}
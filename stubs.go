@@ -0,0 +1,344 @@
+package main
+
+import (
+    "bytes"
+    "fmt"
+    "go/format"
+    "go/token"
+    "go/types"
+    "os"
+    "path"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// StubFile is a generated package of test doubles for the exported
+// interfaces of one package of a repository
+type StubFile struct {
+    // Package is the import path of the package whose interfaces are stubbed
+    Package string `json:"package"`
+    // Path is the file's location in the stubs export directory
+    Path string `json:"path"`
+    // Interfaces lists the stubbed interfaces
+    Interfaces []string `json:"interfaces"`
+    // Skipped explains, by interface, why no stub was generated
+    Skipped map[string]string `json:"skipped,omitempty"`
+    // Source is the generated Go file
+    Source string `json:"-"`
+}
+
+// stubImports assigns the names a stub file imports packages under
+type stubImports struct {
+    self    string
+    aliases map[string]string
+    names   map[string]string
+    used    map[string]bool
+}
+
+// qualifier implements types.Qualifier, importing every package a stub
+// refers to
+func (s *stubImports) qualifier(pkg *types.Package) string {
+    if alias, ok := s.aliases[pkg.Path()]; ok {
+        return alias
+    }
+    alias := pkg.Name()
+    for i := 2; s.used[alias] || alias == s.self || token.Lookup(alias).IsKeyword(); i++ {
+        alias = fmt.Sprintf("%s%d", pkg.Name(), i)
+    }
+    s.aliases[pkg.Path()] = alias
+    s.names[pkg.Path()] = pkg.Name()
+    s.used[alias] = true
+    return alias
+}
+
+// generateStubs writes stubs for the exported interfaces of the module's
+// packages, using the method sets the schema checker resolved
+func (g *GitHubFunctionExtractor) generateStubs(result *ProcessingResult) {
+    if g.schemas == nil || result.ModulePath == "" {
+        return
+    }
+    for _, info := range result.Packages {
+        if info.Name == "main" || info.Unsupported != "" {
+            continue
+        }
+        pkg, _ := g.schemas.Import(info.ImportPath)
+        if pkg == nil || pkg.Scope() == nil {
+            continue
+        }
+        stub, err := generateStubFile(pkg, info.Dir)
+        if err != nil {
+            result.Errors = append(result.Errors, fmt.Sprintf("Failed to generate stubs for %s: %v", info.ImportPath, err))
+            continue
+        }
+        if stub == nil {
+            continue
+        }
+        skipped := make([]string, 0, len(stub.Skipped))
+        for name := range stub.Skipped {
+            skipped = append(skipped, name)
+        }
+        sort.Strings(skipped)
+        for _, name := range skipped {
+            g.logger.Printf("Not stubbing %s.%s: %s", info.ImportPath, name, stub.Skipped[name])
+        }
+        if len(stub.Interfaces) > 0 {
+            result.Stubs = append(result.Stubs, *stub)
+        }
+    }
+    sort.Slice(result.Stubs, func(i, j int) bool { return result.Stubs[i].Path < result.Stubs[j].Path })
+}
+
+// generateStubFile generates the stubs of a package's exported interfaces,
+// or returns nil if it has none
+func generateStubFile(pkg *types.Package, dir string) (*StubFile, error) {
+    stubPackage := pkg.Name() + "stub"
+    imports := &stubImports{self: stubPackage, aliases: make(map[string]string), names: make(map[string]string), used: make(map[string]bool)}
+    stub := &StubFile{
+        Package: pkg.Path(),
+        Path:    path.Join(dir, stubPackage, stubPackage+".go"),
+        Skipped: make(map[string]string),
+    }
+
+    var body bytes.Buffer
+    scope := pkg.Scope()
+    for _, name := range scope.Names() {
+        typeName, ok := scope.Lookup(name).(*types.TypeName)
+        if !ok || !typeName.Exported() || typeName.IsAlias() {
+            continue
+        }
+        named, ok := typeName.Type().(*types.Named)
+        if !ok {
+            continue
+        }
+        iface, ok := named.Underlying().(*types.Interface)
+        if !ok {
+            continue
+        }
+        if reason := unstubbable(named, iface); reason != "" {
+            stub.Skipped[name] = reason
+            continue
+        }
+        writeStub(&body, named, iface, imports.qualifier)
+        stub.Interfaces = append(stub.Interfaces, name)
+    }
+    if len(stub.Interfaces) == 0 && len(stub.Skipped) == 0 {
+        return nil, nil
+    }
+    if len(stub.Skipped) == 0 {
+        stub.Skipped = nil
+    }
+    if len(stub.Interfaces) == 0 {
+        return stub, nil
+    }
+
+    var file bytes.Buffer
+    fmt.Fprintf(&file, "// Code generated by floq from %s. DO NOT EDIT.\n\n", pkg.Path())
+    fmt.Fprintf(&file, "// Package %s holds stub implementations of the interfaces of %s.\n", stubPackage, pkg.Path())
+    fmt.Fprintf(&file, "package %s\n\nimport (\n", stubPackage)
+    paths := make([]string, 0, len(imports.aliases))
+    for importPath := range imports.aliases {
+        paths = append(paths, importPath)
+    }
+    sort.Strings(paths)
+    for _, importPath := range paths {
+        if alias := imports.aliases[importPath]; alias != imports.names[importPath] {
+            fmt.Fprintf(&file, "\t%s %q\n", alias, importPath)
+        } else {
+            fmt.Fprintf(&file, "\t%q\n", importPath)
+        }
+    }
+    file.WriteString(")\n")
+    file.Write(body.Bytes())
+
+    source, err := format.Source(file.Bytes())
+    if err != nil {
+        return nil, fmt.Errorf("failed to format stubs: %w", err)
+    }
+    stub.Source = string(source)
+    return stub, nil
+}
+
+// unstubbable explains why an interface cannot be implemented by a stub in
+// another package, or returns "" if it can
+func unstubbable(named *types.Named, iface *types.Interface) string {
+    if named.TypeParams().Len() > 0 {
+        return "generic interfaces are not stubbed"
+    }
+    if !iface.IsMethodSet() {
+        return "constraint interfaces have no implementations"
+    }
+    if iface.NumMethods() == 0 {
+        return "the interface has no methods"
+    }
+    for i := 0; i < iface.NumMethods(); i++ {
+        method := iface.Method(i)
+        if !method.Exported() {
+            return fmt.Sprintf("method %s is unexported", method.Name())
+        }
+        // Fields are named after the methods with a Func suffix
+        if obj, _, _ := types.LookupFieldOrMethod(named, true, named.Obj().Pkg(), method.Name()+"Func"); obj != nil {
+            return fmt.Sprintf("method %sFunc clashes with the stub field of %s", method.Name(), method.Name())
+        }
+        if reason := unreferenceable(method.Type()); reason != "" {
+            return fmt.Sprintf("method %s %s", method.Name(), reason)
+        }
+    }
+    return ""
+}
+
+// unreferenceable explains why a type cannot be written in another
+// package: it is unknown, as it comes from a dependency the checker does
+// not load, or it names an unexported type
+func unreferenceable(t types.Type) string {
+    switch t := t.(type) {
+    case *types.Basic:
+        if t.Kind() == types.Invalid {
+            return "refers to a type from an unresolved dependency"
+        }
+    case *types.Named:
+        if !t.Obj().Exported() && t.Obj().Pkg() != nil {
+            return fmt.Sprintf("refers to unexported type %s", t.Obj().Name())
+        }
+        args := t.TypeArgs()
+        for i := 0; i < args.Len(); i++ {
+            if reason := unreferenceable(args.At(i)); reason != "" {
+                return reason
+            }
+        }
+    case *types.Alias:
+        if !t.Obj().Exported() && t.Obj().Pkg() != nil {
+            return fmt.Sprintf("refers to unexported type %s", t.Obj().Name())
+        }
+        return unreferenceable(types.Unalias(t))
+    case *types.Pointer:
+        return unreferenceable(t.Elem())
+    case *types.Slice:
+        return unreferenceable(t.Elem())
+    case *types.Array:
+        return unreferenceable(t.Elem())
+    case *types.Chan:
+        return unreferenceable(t.Elem())
+    case *types.Map:
+        if reason := unreferenceable(t.Key()); reason != "" {
+            return reason
+        }
+        return unreferenceable(t.Elem())
+    case *types.Signature:
+        for _, tuple := range []*types.Tuple{t.Params(), t.Results()} {
+            for i := 0; i < tuple.Len(); i++ {
+                if reason := unreferenceable(tuple.At(i).Type()); reason != "" {
+                    return reason
+                }
+            }
+        }
+    case *types.Struct:
+        for i := 0; i < t.NumFields(); i++ {
+            if !t.Field(i).Exported() {
+                return "refers to a struct with unexported fields"
+            }
+            if reason := unreferenceable(t.Field(i).Type()); reason != "" {
+                return reason
+            }
+        }
+    case *types.Interface:
+        for i := 0; i < t.NumMethods(); i++ {
+            if !t.Method(i).Exported() {
+                return "refers to an interface with unexported methods"
+            }
+            if reason := unreferenceable(t.Method(i).Type()); reason != "" {
+                return reason
+            }
+        }
+    }
+    return ""
+}
+
+// writeStub writes a struct implementing an interface: every method calls
+// the function in the field named after it, or returns zero values when
+// the field is nil
+func writeStub(w *bytes.Buffer, named *types.Named, iface *types.Interface, qualifier types.Qualifier) {
+    name := named.Obj().Name()
+    ifaceName := types.TypeString(named, qualifier)
+
+    fmt.Fprintf(w, "\n// %s is a stub implementation of %s.\n", name, ifaceName)
+    fmt.Fprintf(w, "// Each method calls the function in the field named after it with a\n// Func suffix, or returns zero values when the field is nil.\n")
+    fmt.Fprintf(w, "type %s struct {\n", name)
+    for i := 0; i < iface.NumMethods(); i++ {
+        method := iface.Method(i)
+        fmt.Fprintf(w, "\t%sFunc %s\n", method.Name(), funcType(method.Type().(*types.Signature), qualifier))
+    }
+    fmt.Fprintf(w, "}\n\nvar _ %s = (*%s)(nil)\n", ifaceName, name)
+
+    for i := 0; i < iface.NumMethods(); i++ {
+        method := iface.Method(i)
+        signature := method.Type().(*types.Signature)
+        params, args := stubParams(signature, qualifier)
+        results := stubResults(signature, qualifier)
+
+        fmt.Fprintf(w, "\n// %s calls %sFunc\n", method.Name(), method.Name())
+        fmt.Fprintf(w, "func (s *%s) %s(%s) %s {\n", name, method.Name(), params, results)
+        fmt.Fprintf(w, "\tif s.%sFunc != nil {\n", method.Name())
+        call := fmt.Sprintf("s.%sFunc(%s)", method.Name(), args)
+        if signature.Results().Len() == 0 {
+            fmt.Fprintf(w, "\t\t%s\n\t}\n}\n", call)
+            continue
+        }
+        fmt.Fprintf(w, "\t\treturn %s\n\t}\n\treturn\n}\n", call)
+    }
+}
+
+// funcType renders a method's signature as a function type
+func funcType(signature *types.Signature, qualifier types.Qualifier) string {
+    return "func" + strings.TrimPrefix(types.TypeString(signature, qualifier), "func")
+}
+
+// stubParams renders a method's parameters as p0, p1, ..., and the
+// arguments passing them on
+func stubParams(signature *types.Signature, qualifier types.Qualifier) (string, string) {
+    tuple := signature.Params()
+    params := make([]string, tuple.Len())
+    args := make([]string, tuple.Len())
+    for i := 0; i < tuple.Len(); i++ {
+        typ := types.TypeString(tuple.At(i).Type(), qualifier)
+        args[i] = fmt.Sprintf("p%d", i)
+        if signature.Variadic() && i == tuple.Len()-1 {
+            typ = "..." + strings.TrimPrefix(typ, "[]")
+            args[i] += "..."
+        }
+        params[i] = fmt.Sprintf("p%d %s", i, typ)
+    }
+    return strings.Join(params, ", "), strings.Join(args, ", ")
+}
+
+// stubResults renders a method's results as named results r0, r1, ..., so
+// a bare return yields zero values
+func stubResults(signature *types.Signature, qualifier types.Qualifier) string {
+    tuple := signature.Results()
+    if tuple.Len() == 0 {
+        return ""
+    }
+    results := make([]string, tuple.Len())
+    for i := 0; i < tuple.Len(); i++ {
+        results[i] = fmt.Sprintf("r%d %s", i, types.TypeString(tuple.At(i).Type(), qualifier))
+    }
+    return "(" + strings.Join(results, ", ") + ")"
+}
+
+// SaveStubs writes a repository's generated stubs under dir, one package
+// directory per stubbed package
+func SaveStubs(dir string, result *ProcessingResult) error {
+    if result == nil || len(result.Stubs) == 0 {
+        return nil
+    }
+    for _, stub := range result.Stubs {
+        filename := filepath.Join(dir, filepath.FromSlash(stub.Path))
+        if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+            return fmt.Errorf("failed to create stubs directory: %w", err)
+        }
+        if err := os.WriteFile(filename, []byte(stub.Source), 0644); err != nil {
+            return fmt.Errorf("failed to write stubs: %w", err)
+        }
+    }
+    return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+    "fmt"
+    "path"
+    "sync"
+)
+
+// TableCollision records a function whose table name was already taken by
+// another function earlier in the run, and the name its output got instead
+type TableCollision struct {
+    Table         string `json:"table"`
+    Function      string `json:"function"`
+    Package       string `json:"package"`
+    ConflictsWith string `json:"conflicts_with"`
+    RenamedTo     string `json:"renamed_to"`
+}
+
+// String formats the collision for logs and warnings
+func (c TableCollision) String() string {
+    return fmt.Sprintf("table %s of %s.%s already holds the output of %s, stored in %s instead",
+        c.Table, c.Package, c.Function, c.ConflictsWith, c.RenamedTo)
+}
+
+// tableRegistry remembers which function each table of a run was created
+// for, so a function sharing another's name cannot drop its table
+type tableRegistry struct {
+    mu     sync.Mutex
+    owners map[string]string
+}
+
+// newTableRegistry returns a registry holding only the tables floq keeps
+// for itself
+func newTableRegistry() *tableRegistry {
+    return &tableRegistry{owners: map[string]string{
+        vulnerabilitiesTable: "the vulnerability scan",
+        signaturesTable:      "the function signatures",
+    }}
+}
+
+// claim reserves table for owner and returns it. If another owner already
+// holds it, the table is qualified with qualifier, then numbered until it
+// is free, and the previous owner is returned too.
+func (r *tableRegistry) claim(table, owner, qualifier string) (string, string) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    previous, taken := r.owners[table]
+    if !taken || previous == owner {
+        r.owners[table] = owner
+        return table, ""
+    }
+
+    base := safeIdentifier(qualifier + "_" + table)
+    candidate := base
+    for i := 2; ; i++ {
+        if holder, ok := r.owners[candidate]; !ok || holder == owner {
+            break
+        }
+        candidate = safeIdentifier(fmt.Sprintf("%s_%d", base, i))
+    }
+    r.owners[candidate] = owner
+    return candidate, previous
+}
+
+// SetTableRegistry shares the table names claimed in a run with other
+// extractors of the same run
+func (g *GitHubFunctionExtractor) SetTableRegistry(registry *tableRegistry) {
+    g.tables = registry
+}
+
+// claimTable returns the table a function's output is stored in: table,
+// unless another function of the run already stored its output there, in
+// which case a disambiguated name is returned and the collision recorded
+func (g *GitHubFunctionExtractor) claimTable(function FunctionInfo, table string, result *ProcessingResult) string {
+    if g.tables == nil {
+        g.tables = newTableRegistry()
+    }
+
+    pkg := path.Dir(function.RelativePath)
+    owner := fmt.Sprintf("%s.%s in %s", pkg, function.Name, g.repoURL)
+    claimed, previous := g.tables.claim(table, owner, function.PackageName)
+    if previous == "" {
+        return claimed
+    }
+
+    collision := TableCollision{
+        Table:         table,
+        Function:      function.Name,
+        Package:       pkg,
+        ConflictsWith: previous,
+        RenamedTo:     claimed,
+    }
+    g.logger.Printf("Warning: %s", collision)
+    result.TableCollisions = append(result.TableCollisions, collision)
+    return claimed
+}
@@ -0,0 +1,12 @@
+// Package broken contains a syntax error. The declarations before it are
+// still extracted (but not executed); the broken one is skipped.
+package broken
+
+// Recovered precedes the syntax error and is extracted.
+func Recovered() string {
+	return "recovered"
+}
+
+// Unterminated is missing its closing brace.
+func Unterminated() int {
+	return 1
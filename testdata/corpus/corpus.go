@@ -0,0 +1,61 @@
+// Package corpus is the root package of the fixture corpus.
+package corpus
+
+import (
+	"strings"
+
+	"example.com/corpus/shapes"
+)
+
+// Greeting returns a single string value.
+func Greeting() string {
+	return "hello, " + strings.ToLower("CORPUS")
+}
+
+// Inventory calls into another package of the module, producing a
+// cross-package CALLS edge in graph exports.
+func Inventory() []shapes.Item {
+	return shapes.Items()
+}
+
+// Sum takes parameters, so it only runs when argument fuzzing is enabled.
+func Sum(a, b int) int {
+	return a + b
+}
+
+// helper is unexported and must not be extracted.
+func helper() int {
+	return 1
+}
+
+// Counter has a method; methods are skipped by the extractor.
+type Counter struct{ n int }
+
+// Inc increments the counter.
+func (c *Counter) Inc() { c.n += helper() }
+
+// Version is a func-typed variable, extracted with extraction.func_variables.
+var Version = func() string {
+	return "v1.0.0"
+}
+
+// Words splits with a local closure, extracted as Words.split with
+// extraction.closures.
+func Words() []string {
+	split := func(s string) []string { return strings.Fields(s) }
+	return split("alpha beta gamma")
+}
+
+// Repeat takes parameters but runs with the arguments of its directive.
+//
+//floq:execute 3, "ab"
+func Repeat(n int, s string) string {
+	return strings.Repeat(s, n)
+}
+
+// Shutdown would run without parameters, but its directive skips it.
+//
+//floq:skip stands in for a function with side effects
+func Shutdown() string {
+	return "stopped"
+}
@@ -0,0 +1,26 @@
+// Package effects holds functions the safety classification flags. None of
+// them is harmful when run: they only look risky to a static check.
+package effects
+
+import (
+	"os"
+	"os/exec"
+)
+
+// LookPath runs no command but references os/exec: classified high.
+func LookPath() string {
+	path, _ := exec.LookPath("go")
+	return path
+}
+
+// TempDir changes nothing but calls into os: classified low.
+func TempDir() string {
+	return os.TempDir()
+}
+
+// Panics fails at runtime and is reported as an execution error.
+func Panics() int {
+	var m map[string]int
+	m["boom"] = 1
+	return 0
+}
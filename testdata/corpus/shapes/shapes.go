@@ -0,0 +1,67 @@
+// Package shapes returns values of every shape the table builder handles.
+package shapes
+
+import (
+	"fmt"
+	"io"
+)
+
+// Item is a record with keys that need column normalization.
+type Item struct {
+	Name     string  `json:"name"`
+	Price    float64 `json:"Unit Price"`
+	InStock  bool    `json:"in-stock"`
+	Order    int     `json:"order"`
+	Metadata map[string]string
+}
+
+// Items returns an array of objects: one column per key.
+func Items() []Item {
+	return []Item{
+		{Name: "apple", Price: 1.25, InStock: true, Order: 1, Metadata: map[string]string{"color": "red"}},
+		{Name: "pear", Price: 0.5, Order: 2},
+	}
+}
+
+// Config returns a single object.
+func Config() map[string]interface{} {
+	return map[string]interface{}{"debug": false, "retries": 3, "select": "reserved word"}
+}
+
+// Primes returns an array of primitives: one value column.
+func Primes() []int {
+	return []int{2, 3, 5, 7, 11}
+}
+
+// Empty returns an empty array, stored as a single JSONB value.
+func Empty() []string {
+	return []string{}
+}
+
+// Secret has only unexported fields, so JSON loses them and the runner
+// falls back to a reflection-based representation.
+func Secret() struct{ token string } {
+	return struct{ token string }{token: "hidden"}
+}
+
+// Callback returns a func, which has no data representation.
+func Callback() func() int {
+	return func() int { return 1 }
+}
+
+// Report writes its output instead of returning it.
+func Report(w io.Writer) {
+	fmt.Fprintln(w, "report line 1")
+	fmt.Fprintln(w, "report line 2")
+}
+
+// AVeryLongFunctionNameThatExceedsThePostgresIdentifierLimitOfSixtyThreeBytes
+// produces a table name that must be shortened.
+func AVeryLongFunctionNameThatExceedsThePostgresIdentifierLimitOfSixtyThreeBytes() int {
+	return 63
+}
+
+// Select collides with an SQL reserved word once lowercased.
+func Select() string {
+	return "quoted"
+}
@@ -0,0 +1,161 @@
+// Command plugin is a floq enricher plugin used by the plugin tests. It
+// drops functions named Dropped and vetoes the execution of functions
+// named Vetoed, speaking the protocol given by -protocol.
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "log"
+    "net"
+    "net/rpc"
+    "net/rpc/jsonrpc"
+    "os"
+    "path/filepath"
+
+    "google.golang.org/grpc"
+    "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Function holds the fields of a function the plugin looks at
+type Function struct {
+    Name string `json:"name"`
+}
+
+// Call is the argument of every method
+type Call struct {
+    Function  *Function         `json:"function,omitempty"`
+    Functions []json.RawMessage `json:"functions,omitempty"`
+}
+
+// Manifest answers Describe
+type Manifest struct {
+    Name  string   `json:"name"`
+    Hooks []string `json:"hooks"`
+}
+
+// Reply answers the hooks
+type Reply struct {
+    Functions []json.RawMessage `json:"functions"`
+}
+
+// Enricher implements the plugin's methods
+type Enricher struct{}
+
+func (Enricher) Describe(call Call, manifest *Manifest) error {
+    *manifest = Manifest{Name: "test", Hooks: []string{"post_extract", "pre_execute"}}
+    return nil
+}
+
+func (Enricher) PostExtract(call Call, reply *Reply) error {
+    reply.Functions = []json.RawMessage{}
+    for _, raw := range call.Functions {
+        var function Function
+        if err := json.Unmarshal(raw, &function); err != nil {
+            return err
+        }
+        if function.Name != "Dropped" {
+            reply.Functions = append(reply.Functions, raw)
+        }
+    }
+    return nil
+}
+
+func (Enricher) PreExecute(call Call, reply *Reply) error {
+    if call.Function != nil && call.Function.Name == "Vetoed" {
+        return errors.New("vetoed by the test plugin")
+    }
+    return nil
+}
+
+// stdio joins stdin and stdout into the connection JSON-RPC runs over
+type stdio struct {
+    io.Reader
+    io.Writer
+}
+
+func (stdio) Close() error { return nil }
+
+func main() {
+    protocol := flag.String("protocol", "jsonrpc", "jsonrpc or grpc")
+    flag.Parse()
+    if os.Getenv("FLOQ_PLUGIN_MAGIC_COOKIE") == "" {
+        log.Fatal("this binary is a floq plugin and is started by floq")
+    }
+
+    switch *protocol {
+    case "jsonrpc":
+        rpc.RegisterName("Enricher", Enricher{})
+        fmt.Println("1|jsonrpc")
+        jsonrpc.ServeConn(stdio{os.Stdin, os.Stdout})
+    case "grpc":
+        dir, err := os.MkdirTemp("", "plugin")
+        if err != nil {
+            log.Fatal(err)
+        }
+        defer os.RemoveAll(dir)
+        socket := filepath.Join(dir, "plugin.sock")
+        listener, err := net.Listen("unix", socket)
+        if err != nil {
+            log.Fatal(err)
+        }
+        server := grpc.NewServer()
+        server.RegisterService(&enricherService, Enricher{})
+        go server.Serve(listener)
+        fmt.Printf("1|grpc|unix|%s\n", socket)
+        // floq closes stdin to stop the plugin
+        io.Copy(io.Discard, os.Stdin)
+        server.Stop()
+    default:
+        log.Fatalf("unknown protocol %s", *protocol)
+    }
+}
+
+// enricherService serves the Enricher methods over gRPC, each taking and
+// returning JSON in a google.protobuf.BytesValue
+var enricherService = grpc.ServiceDesc{
+    ServiceName: "floq.plugin.v1.Enricher",
+    HandlerType: (*interface{})(nil),
+    Methods: []grpc.MethodDesc{
+        {MethodName: "Describe", Handler: handler(func(call Call) (interface{}, error) {
+            var manifest Manifest
+            err := Enricher{}.Describe(call, &manifest)
+            return manifest, err
+        })},
+        {MethodName: "PostExtract", Handler: handler(func(call Call) (interface{}, error) {
+            var reply Reply
+            err := Enricher{}.PostExtract(call, &reply)
+            return reply, err
+        })},
+        {MethodName: "PreExecute", Handler: handler(func(call Call) (interface{}, error) {
+            return Reply{}, Enricher{}.PreExecute(call, &Reply{})
+        })},
+    },
+}
+
+// handler adapts a method to a gRPC handler
+func handler(method func(Call) (interface{}, error)) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+    return func(_ interface{}, _ context.Context, decode func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+        request := &wrapperspb.BytesValue{}
+        if err := decode(request); err != nil {
+            return nil, err
+        }
+        var call Call
+        if err := json.Unmarshal(request.Value, &call); err != nil {
+            return nil, err
+        }
+        reply, err := method(call)
+        if err != nil {
+            return nil, err
+        }
+        data, err := json.Marshal(reply)
+        if err != nil {
+            return nil, err
+        }
+        return wrapperspb.Bytes(data), nil
+    }
+}
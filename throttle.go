@@ -0,0 +1,217 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Default autoscaling bounds and limits
+const (
+    defaultAutoscaleMinWorkers        = 1
+    defaultAutoscaleMaxWorkers        = 8
+    defaultAutoscaleMaxLoadPercent    = 100
+    defaultAutoscaleMinFreeMemoryMB   = 512
+    defaultAutoscaleMaxWriteLatencyMS = 250
+    defaultAutoscaleInterval          = 30
+)
+
+// latencySmoothing is the weight of a new sample in the write latency
+// moving average
+const latencySmoothing = 0.2
+
+// AutoscaleConfig lets service mode scale its workers with the host's
+// headroom instead of running a fixed number. A limit of zero disables
+// that signal.
+type AutoscaleConfig struct {
+    Enabled bool `json:"enabled"`
+    // MinWorkers and MaxWorkers bound the worker count; Workers is where
+    // scaling starts
+    MinWorkers int `json:"min_workers"`
+    MaxWorkers int `json:"max_workers"`
+    // MaxLoadPercent is the highest 1-minute load average per CPU, in
+    // percent, before workers are removed
+    MaxLoadPercent int `json:"max_load_percent"`
+    // MinFreeMemoryMB is the least available memory before workers are
+    // removed
+    MinFreeMemoryMB int `json:"min_free_memory_mb"`
+    // MaxWriteLatencyMS is the highest average latency of job queue writes
+    // before workers are removed
+    MaxWriteLatencyMS int `json:"max_write_latency_ms"`
+    // Interval is the number of seconds between scaling decisions
+    Interval int `json:"interval"`
+}
+
+// validate checks the autoscaling bounds and limits
+func (c AutoscaleConfig) validate() error {
+    if !c.Enabled {
+        return nil
+    }
+    if c.MinWorkers < 1 || c.MaxWorkers < c.MinWorkers {
+        return fmt.Errorf("autoscale needs 1 <= min_workers <= max_workers")
+    }
+    if c.MaxLoadPercent < 0 || c.MinFreeMemoryMB < 0 || c.MaxWriteLatencyMS < 0 {
+        return fmt.Errorf("autoscale limits must not be negative")
+    }
+    if c.Interval < 1 {
+        return fmt.Errorf("autoscale interval must be at least 1 second")
+    }
+    return nil
+}
+
+// clamp keeps a worker count within the bounds
+func (c AutoscaleConfig) clamp(workers int) int {
+    return max(c.MinWorkers, min(workers, c.MaxWorkers))
+}
+
+// HostLoad is a sample of the signals autoscaling reacts to
+type HostLoad struct {
+    // HostKnown is false where the platform does not expose the load
+    // average and available memory; only the write latency is used then
+    HostKnown    bool
+    LoadPercent  int
+    FreeMemoryMB int
+    WriteLatency time.Duration
+}
+
+// String formats the sample for logs
+func (l HostLoad) String() string {
+    var parts []string
+    if l.HostKnown {
+        parts = append(parts, fmt.Sprintf("load %d%%", l.LoadPercent), fmt.Sprintf("%d MiB free", l.FreeMemoryMB))
+    }
+    parts = append(parts, fmt.Sprintf("write latency %s", l.WriteLatency.Round(time.Millisecond)))
+    return strings.Join(parts, ", ")
+}
+
+// pressure returns why the host is overloaded, or "" if it is not
+func (l HostLoad) pressure(cfg AutoscaleConfig) string {
+    if l.HostKnown && cfg.MaxLoadPercent > 0 && l.LoadPercent > cfg.MaxLoadPercent {
+        return fmt.Sprintf("load %d%% above %d%%", l.LoadPercent, cfg.MaxLoadPercent)
+    }
+    if l.HostKnown && cfg.MinFreeMemoryMB > 0 && l.FreeMemoryMB < cfg.MinFreeMemoryMB {
+        return fmt.Sprintf("%d MiB free below %d MiB", l.FreeMemoryMB, cfg.MinFreeMemoryMB)
+    }
+    if cfg.MaxWriteLatencyMS > 0 && l.WriteLatency > time.Duration(cfg.MaxWriteLatencyMS)*time.Millisecond {
+        return fmt.Sprintf("write latency %s above %dms", l.WriteLatency.Round(time.Millisecond), cfg.MaxWriteLatencyMS)
+    }
+    return ""
+}
+
+// headroom reports whether every signal is comfortably within its limit,
+// so another worker is unlikely to tip the host over
+func (l HostLoad) headroom(cfg AutoscaleConfig) bool {
+    if l.HostKnown && cfg.MaxLoadPercent > 0 && l.LoadPercent*4 > cfg.MaxLoadPercent*3 {
+        return false
+    }
+    if l.HostKnown && cfg.MinFreeMemoryMB > 0 && l.FreeMemoryMB < cfg.MinFreeMemoryMB*2 {
+        return false
+    }
+    if cfg.MaxWriteLatencyMS > 0 && l.WriteLatency*2 > time.Duration(cfg.MaxWriteLatencyMS)*time.Millisecond {
+        return false
+    }
+    return true
+}
+
+// nextWorkerTarget decides the worker count for the next interval: one
+// fewer under pressure, one more when every worker is busy and the host
+// has headroom, otherwise unchanged. It returns the reason for a change.
+func nextWorkerTarget(cfg AutoscaleConfig, current, busy int, load HostLoad) (int, string) {
+    if reason := load.pressure(cfg); reason != "" {
+        if current > cfg.MinWorkers {
+            return current - 1, reason
+        }
+        return current, ""
+    }
+    if busy >= current && current < cfg.MaxWorkers && load.headroom(cfg) {
+        return current + 1, "all workers busy with headroom"
+    }
+    return current, ""
+}
+
+// latencyMeter keeps a moving average of database write latencies
+type latencyMeter struct {
+    mu      sync.Mutex
+    average time.Duration
+}
+
+// Observe adds the duration of a write started at start
+func (m *latencyMeter) Observe(start time.Time) {
+    elapsed := time.Since(start)
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if m.average == 0 {
+        m.average = elapsed
+        return
+    }
+    m.average += time.Duration(latencySmoothing * float64(elapsed-m.average))
+}
+
+// Average returns the moving average
+func (m *latencyMeter) Average() time.Duration {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return m.average
+}
+
+// workerTarget returns the number of workers to run: the configured count,
+// or the autoscaled one within its bounds
+func (s *Service) workerTarget() int {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    cfg := s.config.Service
+    if !cfg.Autoscale.Enabled {
+        return cfg.Workers
+    }
+    if s.target == 0 {
+        s.target = cfg.Workers
+    }
+    s.target = cfg.Autoscale.clamp(s.target)
+    return s.target
+}
+
+// sampleLoad reads the host's load, free memory and the job queue's write
+// latency
+func (s *Service) sampleLoad() HostLoad {
+    load, err := readHostLoad()
+    if err != nil {
+        load = HostLoad{}
+    }
+    load.WriteLatency = s.writeLatency.Average()
+    return load
+}
+
+// autoscale periodically moves the worker target by one within its bounds
+// as the host's load, free memory and database write latency allow, until
+// ctx is cancelled
+func (s *Service) autoscale(ctx context.Context) {
+    for {
+        cfg := s.currentConfig().Service.Autoscale
+        interval := time.Duration(max(cfg.Interval, 1)) * time.Second
+        select {
+        case <-ctx.Done():
+            return
+        case <-time.After(interval):
+        }
+        if !cfg.Enabled {
+            continue
+        }
+
+        current := s.workerTarget()
+        load := s.sampleLoad()
+        next, reason := nextWorkerTarget(cfg, current, int(s.busy.Load()), load)
+        if next == current {
+            continue
+        }
+        s.logger.Printf("Autoscale: scaling workers from %d to %d: %s (%s)", current, next, reason, load)
+        s.mu.Lock()
+        s.target = next
+        s.mu.Unlock()
+        select {
+        case s.resize <- struct{}{}:
+        default:
+        }
+    }
+}
@@ -0,0 +1,56 @@
+//go:build linux
+
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "os"
+    "runtime"
+    "strconv"
+    "strings"
+)
+
+// readHostLoad reads the 1-minute load average per CPU and the available
+// memory from /proc
+func readHostLoad() (HostLoad, error) {
+    data, err := os.ReadFile("/proc/loadavg")
+    if err != nil {
+        return HostLoad{}, err
+    }
+    fields := strings.Fields(string(data))
+    if len(fields) == 0 {
+        return HostLoad{}, fmt.Errorf("unexpected /proc/loadavg contents")
+    }
+    loadavg, err := strconv.ParseFloat(fields[0], 64)
+    if err != nil {
+        return HostLoad{}, fmt.Errorf("failed to parse load average: %w", err)
+    }
+
+    file, err := os.Open("/proc/meminfo")
+    if err != nil {
+        return HostLoad{}, err
+    }
+    defer file.Close()
+    freeKB := -1
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        fields := strings.Fields(scanner.Text())
+        if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+            freeKB, err = strconv.Atoi(fields[1])
+            if err != nil {
+                return HostLoad{}, fmt.Errorf("failed to parse available memory: %w", err)
+            }
+            break
+        }
+    }
+    if freeKB < 0 {
+        return HostLoad{}, fmt.Errorf("no MemAvailable in /proc/meminfo")
+    }
+
+    return HostLoad{
+        HostKnown:    true,
+        LoadPercent:  int(loadavg / float64(runtime.NumCPU()) * 100),
+        FreeMemoryMB: freeKB / 1024,
+    }, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// readHostLoad is not implemented on this platform
+func readHostLoad() (HostLoad, error) {
+    return HostLoad{}, errors.New("host load is not available on this platform")
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/go-git/go-git/v5"
+    "github.com/go-git/go-git/v5/plumbing"
+    "github.com/go-git/go-git/v5/plumbing/object"
+    "golang.org/x/mod/semver"
+)
+
+// TimeTravelConfig selects historical refs at which every repository is
+// processed, instead of only its default branch
+type TimeTravelConfig struct {
+    // Refs lists explicit refs: tags, branches, or commit hashes
+    Refs []string `json:"refs,omitempty"`
+    // ReleaseTags adds every tag that is a semantic version without a
+    // prerelease suffix, e.g. v1.2.0
+    ReleaseTags bool `json:"release_tags"`
+    // Commits adds this many evenly spaced commits from the history of
+    // HEAD, always including the first and the latest commit
+    Commits int `json:"commits"`
+}
+
+// Enabled reports whether any historical refs are selected
+func (c TimeTravelConfig) Enabled() bool {
+    return len(c.Refs) > 0 || c.ReleaseTags || c.Commits > 0
+}
+
+// HistoricalRef is a commit processed in time-travel mode
+type HistoricalRef struct {
+    Name   string    `json:"name"`
+    Commit string    `json:"commit"`
+    When   time.Time `json:"when"`
+}
+
+// resolveRef returns the commit a ref names in the clone. Full ref names
+// that are not fetched by default, such as refs/pull/1/head, are fetched
+// when they do not resolve; the repository is then reopened, as go-git
+// does not see objects fetched through another handle.
+func (g *GitHubFunctionExtractor) resolveRef(ctx context.Context, name string) (string, error) {
+    hash, err := g.cloner.ResolveRef(ctx, g.repoPath, name)
+    if err == nil || !strings.HasPrefix(name, "refs/") {
+        return hash, err
+    }
+    g.logger.Printf("Fetching %s", name)
+    if fetchErr := g.cloner.Fetch(ctx, g.repoPath, name); fetchErr != nil {
+        return "", fmt.Errorf("%w (fetching it failed: %v)", err, fetchErr)
+    }
+    if g.repo != nil {
+        repo, err := git.PlainOpen(g.repoPath)
+        if err != nil {
+            return "", fmt.Errorf("failed to reopen repository: %w", err)
+        }
+        g.repo = repo
+    }
+    return g.cloner.ResolveRef(ctx, g.repoPath, name)
+}
+
+// resolveHistoricalRefs resolves the refs selected by config, oldest first
+func (g *GitHubFunctionExtractor) resolveHistoricalRefs(ctx context.Context, config TimeTravelConfig) ([]HistoricalRef, error) {
+    var refs []HistoricalRef
+    seen := make(map[string]bool)
+    add := func(name string, commit *object.Commit) {
+        if seen[name] {
+            return
+        }
+        seen[name] = true
+        refs = append(refs, HistoricalRef{
+            Name:   name,
+            Commit: commit.Hash.String(),
+            When:   commit.Committer.When,
+        })
+    }
+
+    for _, name := range config.Refs {
+        hash, err := g.resolveRef(ctx, name)
+        if err != nil {
+            return nil, fmt.Errorf("failed to resolve ref %s: %w", name, err)
+        }
+        commit, err := g.repo.CommitObject(plumbing.NewHash(hash))
+        if err != nil {
+            return nil, fmt.Errorf("failed to read commit of ref %s: %w", name, err)
+        }
+        add(name, commit)
+    }
+
+    if config.ReleaseTags {
+        tags, err := g.repo.Tags()
+        if err != nil {
+            return nil, fmt.Errorf("failed to list tags: %w", err)
+        }
+        err = tags.ForEach(func(tag *plumbing.Reference) error {
+            name := tag.Name().Short()
+            if !semver.IsValid(name) || semver.Prerelease(name) != "" {
+                return nil
+            }
+            commit, err := tagCommit(g.repo, tag)
+            if err != nil {
+                return fmt.Errorf("failed to read commit of tag %s: %w", name, err)
+            }
+            add(name, commit)
+            return nil
+        })
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    if config.Commits > 0 {
+        commits, err := sampleCommits(g.repo, config.Commits)
+        if err != nil {
+            return nil, err
+        }
+        for _, commit := range commits {
+            add(commit.Hash.String()[:12], commit)
+        }
+    }
+
+    sort.SliceStable(refs, func(i, j int) bool {
+        return refs[i].When.Before(refs[j].When)
+    })
+    return refs, nil
+}
+
+// refSuffix turns a ref name into a table name suffix, replacing every run
+// of characters other than letters and digits with an underscore
+func refSuffix(name string) string {
+    var b strings.Builder
+    for _, r := range strings.ToLower(name) {
+        if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+            b.WriteRune(r)
+        } else if !strings.HasSuffix(b.String(), "_") {
+            b.WriteRune('_')
+        }
+    }
+    return strings.Trim(b.String(), "_")
+}
+
+// tagCommit returns the commit a lightweight or annotated tag points to
+func tagCommit(repo *git.Repository, tag *plumbing.Reference) (*object.Commit, error) {
+    if annotated, err := repo.TagObject(tag.Hash()); err == nil {
+        return annotated.Commit()
+    }
+    return repo.CommitObject(tag.Hash())
+}
+
+// sampleCommits returns n commits evenly spaced over the history of HEAD,
+// oldest first
+func sampleCommits(repo *git.Repository, n int) ([]*object.Commit, error) {
+    iter, err := repo.Log(&git.LogOptions{Order: git.LogOrderCommitterTime})
+    if err != nil {
+        return nil, fmt.Errorf("failed to read git log: %w", err)
+    }
+    defer iter.Close()
+
+    var history []*object.Commit
+    err = iter.ForEach(func(commit *object.Commit) error {
+        history = append(history, commit)
+        return nil
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to read git log: %w", err)
+    }
+
+    // The log is newest first
+    for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+        history[i], history[j] = history[j], history[i]
+    }
+    if n >= len(history) {
+        return history, nil
+    }
+    if n == 1 {
+        return history[len(history)-1:], nil
+    }
+
+    sampled := make([]*object.Commit, 0, n)
+    for i := 0; i < n; i++ {
+        sampled = append(sampled, history[i*(len(history)-1)/(n-1)])
+    }
+    return sampled, nil
+}
+
+// checkoutRef checks out a historical commit, discarding files left behind
+// by processing the previous one such as a synthetic go.mod
+func (g *GitHubFunctionExtractor) checkoutRef(ctx context.Context, ref HistoricalRef) error {
+    if err := g.cloner.Checkout(ctx, g.repoPath, ref.Commit, g.extractConfig.Paths); err != nil {
+        return fmt.Errorf("failed to check out %s: %w", ref.Name, err)
+    }
+
+    g.ref = &ref
+    g.historyCache = nil
+    // Cached outputs are keyed on the checked out sources
+    g.packageHashes = nil
+    if g.state != nil {
+        g.depsHash = dependencyHash(g.repoPath)
+    }
+    g.cacheHits = 0
+    g.cacheMisses = 0
+    g.extractionHits = 0
+    g.extractionMisses = 0
+    return nil
+}
+
+// ProcessRepositoryHistory clones a repository once and processes it at
+// every historical ref selected by config. record is called with the
+// result of each ref, oldest first.
+func (g *GitHubFunctionExtractor) ProcessRepositoryHistory(ctx context.Context, repoURL string, config TimeTravelConfig, record func(ref HistoricalRef, result *ProcessingResult, err error)) error {
+    g.repoURL = repoURL
+
+    if g.selection != nil && !g.selection.MatchesRepository(repoURL) {
+        g.logger.Printf("Skipping %s: it does not match the selection", repoURL)
+        return nil
+    }
+    if name, err := g.runPreClone(); err != nil {
+        g.logger.Printf("Skipping %s: %s: %v", repoURL, describeHooks(name), err)
+        return nil
+    }
+
+    g.reportProgress("cloning %s", repoURL)
+    if err := g.CloneRepository(ctx, repoURL); err != nil {
+        return fmt.Errorf("failed to clone repository: %w", err)
+    }
+    defer g.Cleanup()
+
+    if g.repo == nil {
+        return fmt.Errorf("time travel requires a git repository, %s has no history", repoURL)
+    }
+    refs, err := g.resolveHistoricalRefs(ctx, config)
+    if err != nil {
+        return err
+    }
+    if len(refs) == 0 {
+        return fmt.Errorf("no historical refs selected in %s", repoURL)
+    }
+
+    for i, ref := range refs {
+        if ctx.Err() != nil {
+            return errInterrupted
+        }
+        g.logger.Printf("Processing %s at %s (%d/%d)", repoURL, ref.Name, i+1, len(refs))
+        g.reportProgress("processing ref %d/%d: %s", i+1, len(refs), ref.Name)
+
+        started := time.Now()
+        g.phases = newPhaseTimer()
+        result := newProcessingResult()
+        result.Ref = ref.Name
+        result.Commit = ref.Commit
+        if err := g.checkoutRef(ctx, ref); err != nil {
+            g.stampTiming(result, started)
+            record(ref, result, err)
+            continue
+        }
+        result, err := g.processCheckout(ctx, result)
+        g.stampTiming(result, started)
+        record(ref, result, err)
+    }
+    return nil
+}
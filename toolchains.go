@@ -0,0 +1,104 @@
+package main
+
+import (
+    "context"
+    "os"
+    "os/exec"
+    "reflect"
+    "strings"
+)
+
+// ToolchainRun records the output of a function executed under one of the
+// toolchains of the comparison matrix
+type ToolchainRun struct {
+    Function       string      `json:"function"`
+    Toolchain      string      `json:"toolchain"`
+    Output         interface{} `json:"output,omitempty"`
+    Representation string      `json:"representation,omitempty"`
+    Error          string      `json:"error,omitempty"`
+    // Matches reports whether the output equals that of the first toolchain
+    Matches bool `json:"matches"`
+}
+
+// toolchainCommand prepares a go command run from the repository root
+// under a toolchain. An empty toolchain uses the go on PATH, a path runs
+// that go binary, and anything else (e.g. go1.22.5) is selected through
+// GOTOOLCHAIN, which downloads it on first use.
+func (g *GitHubFunctionExtractor) toolchainCommand(ctx context.Context, toolchain string, args ...string) *exec.Cmd {
+    name := "go"
+    var env []string
+    switch {
+    case toolchain == "":
+    case strings.ContainsRune(toolchain, os.PathSeparator) || strings.Contains(toolchain, "/"):
+        name = toolchain
+    default:
+        env = append(env, "GOTOOLCHAIN="+toolchain)
+    }
+    if g.execConfig.GoProxy != "" {
+        env = append(env, "GOPROXY="+g.execConfig.GoProxy)
+    }
+    env = append(env, g.workspaceEnv()...)
+
+    // Builds and downloads are killed when processing is interrupted
+    cmd := exec.CommandContext(ctx, name, args...)
+    cmd.Dir = g.repoPath
+    if len(env) > 0 {
+        cmd.Env = append(os.Environ(), env...)
+    }
+    return cmd
+}
+
+// compareToolchains executes a function under every configured toolchain,
+// records each output in the result, and queues them for storage in a
+// table with one row per toolchain. It returns false if the outputs
+// diverge.
+func (g *GitHubFunctionExtractor) compareToolchains(ctx context.Context, function FunctionInfo, result *ProcessingResult) bool {
+    var runs []ToolchainRun
+    for _, toolchain := range g.execConfig.Toolchains {
+        run := ToolchainRun{Function: function.Name, Toolchain: toolchain}
+        output, err := g.runFunction(ctx, function, nil, toolchain)
+        if err != nil {
+            run.Error = err.Error()
+        } else {
+            run.Output = output.Value
+            run.Representation = output.Representation
+        }
+        run.Matches = len(runs) == 0 || (run.Error == "" && runs[0].Error == "" &&
+            reflect.DeepEqual(run.Output, runs[0].Output))
+        runs = append(runs, run)
+    }
+    result.ToolchainRuns = append(result.ToolchainRuns, runs...)
+
+    consistent := true
+    rows := make([]map[string]interface{}, 0, len(runs))
+    for _, run := range runs {
+        consistent = consistent && run.Matches
+        rows = append(rows, map[string]interface{}{
+            "toolchain": run.Toolchain,
+            "output":    run.Output,
+            "error":     run.Error,
+            "matches":   run.Matches,
+        })
+    }
+    if !consistent {
+        g.logger.Printf("Function %s behaves differently across toolchains", function.Name)
+        result.DivergentFunctions = append(result.DivergentFunctions, function.Name)
+    }
+
+    g.enqueueStore(result, func(stored *ProcessingResult) {
+        g.storeToolchainRuns(ctx, function, rows, stored)
+    })
+    return consistent
+}
+
+// storeToolchainRuns stores the outputs of a function under every
+// toolchain in a table of their own
+func (g *GitHubFunctionExtractor) storeToolchainRuns(ctx context.Context, function FunctionInfo, rows []map[string]interface{}, result *ProcessingResult) {
+    tableName := g.claimTable(function, g.tableNameFor(function.Name+"_toolchains"), result)
+    if _, err := g.StoreTableFromData(ctx, tableName, rows); err != nil {
+        result.Errors = append(result.Errors,
+            g.functionError(function, "Failed to store toolchain outputs for %s: %v", function.Name, err))
+        return
+    }
+    result.CreatedTables = append(result.CreatedTables, tableName)
+}
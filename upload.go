@@ -0,0 +1,185 @@
+package main
+
+import (
+    "bytes"
+    "compress/gzip"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Upload defaults
+const (
+    defaultUploadChunkSize = 500
+    defaultUploadAttempts  = 3
+)
+
+// UploadConfig configures the http exporter, which POSTs a run's results
+// as gzip-compressed NDJSON chunks to an ingestion endpoint
+type UploadConfig struct {
+    URL string `json:"url,omitempty"`
+    // Token is sent as a bearer token; Headers are added to every request
+    Token   string            `json:"token,omitempty"`
+    Headers map[string]string `json:"headers,omitempty"`
+    // ChunkSize is the most records per request (default 500)
+    ChunkSize int `json:"chunk_size,omitempty"`
+    // Attempts is how often a chunk is sent before the upload fails
+    // (default 3)
+    Attempts int `json:"attempts,omitempty"`
+}
+
+// UploadRecord is one NDJSON line of an upload. The first record of a run
+// has type "run" and the summary, followed for every repository by a
+// "repository" record with its result, without the functions, and one
+// "function" record per catalogued function.
+type UploadRecord struct {
+    Type       string            `json:"type"`
+    RunID      string            `json:"run_id"`
+    Repository string            `json:"repository,omitempty"`
+    Summary    *ProcessingStats  `json:"summary,omitempty"`
+    Result     *ProcessingResult `json:"result,omitempty"`
+    Function   *FunctionInfo     `json:"function,omitempty"`
+    // Executed and Table are set on function records
+    Executed bool   `json:"executed,omitempty"`
+    Table    string `json:"table,omitempty"`
+}
+
+// uploadRecords flattens a run into upload records
+func uploadRecords(run *Run) []UploadRecord {
+    stats := run.Stats()
+    records := []UploadRecord{{Type: "run", RunID: run.ID, Summary: &stats}}
+
+    results := run.Results()
+    for _, repoURL := range run.Repositories() {
+        result := *results[repoURL]
+        functions := result.ProcessedFunctions
+        result.ProcessedFunctions = nil
+        records = append(records, UploadRecord{Type: "repository", RunID: run.ID, Repository: repoURL, Result: &result})
+
+        executed := make(map[string]bool, len(result.ExecutedFunctions))
+        for _, name := range result.ExecutedFunctions {
+            executed[name] = true
+        }
+        for i := range functions {
+            record := UploadRecord{
+                Type:       "function",
+                RunID:      run.ID,
+                Repository: repoURL,
+                Function:   &functions[i],
+                Executed:   executed[functions[i].Name],
+            }
+            if record.Executed {
+                record.Table = tableNameFor(functions[i].Name)
+            }
+            records = append(records, record)
+        }
+    }
+    return records
+}
+
+// UploadRun POSTs a run's records to the configured endpoint in chunks.
+// Every chunk is a gzip-compressed NDJSON body carrying its position in
+// X-Floq-Chunk ("3/12") and an Idempotency-Key, so receivers can
+// deduplicate chunks that were retried after a lost response.
+func UploadRun(run *Run, config UploadConfig) error {
+    if config.URL == "" {
+        return fmt.Errorf("no upload URL configured")
+    }
+    chunkSize := config.ChunkSize
+    if chunkSize <= 0 {
+        chunkSize = defaultUploadChunkSize
+    }
+    logger := log.New(logOutput, "[UPLOAD] ", log.LstdFlags|log.Lshortfile)
+    client := &http.Client{Timeout: 2 * time.Minute}
+
+    records := uploadRecords(run)
+    chunks := (len(records) + chunkSize - 1) / chunkSize
+    for chunk := 0; chunk < chunks; chunk++ {
+        end := min((chunk+1)*chunkSize, len(records))
+        body, err := encodeChunk(records[chunk*chunkSize : end])
+        if err != nil {
+            return err
+        }
+        position := fmt.Sprintf("%d/%d", chunk+1, chunks)
+        if err := sendChunk(client, config, body, run.ID, position); err != nil {
+            return fmt.Errorf("failed to upload chunk %s: %w", position, err)
+        }
+    }
+    logger.Printf("Uploaded %d records in %d chunks to %s", len(records), chunks, config.URL)
+    return nil
+}
+
+// encodeChunk renders records as gzip-compressed NDJSON
+func encodeChunk(records []UploadRecord) ([]byte, error) {
+    var buf bytes.Buffer
+    zw := gzip.NewWriter(&buf)
+    encoder := json.NewEncoder(zw)
+    for _, record := range records {
+        if err := encoder.Encode(record); err != nil {
+            return nil, fmt.Errorf("failed to encode upload record: %w", err)
+        }
+    }
+    if err := zw.Close(); err != nil {
+        return nil, fmt.Errorf("failed to compress upload chunk: %w", err)
+    }
+    return buf.Bytes(), nil
+}
+
+// sendChunk POSTs one chunk, retrying network errors, 429 and 5xx
+// responses with backoff, or the delay the endpoint asks for in
+// Retry-After
+func sendChunk(client *http.Client, config UploadConfig, body []byte, runID, position string) error {
+    attempts := config.Attempts
+    if attempts <= 0 {
+        attempts = defaultUploadAttempts
+    }
+
+    var lastErr error
+    var delay time.Duration
+    for attempt := 1; attempt <= attempts; attempt++ {
+        if attempt > 1 {
+            time.Sleep(delay)
+        }
+        delay = time.Duration(attempt*attempt) * time.Second
+
+        req, err := http.NewRequest(http.MethodPost, config.URL, bytes.NewReader(body))
+        if err != nil {
+            return fmt.Errorf("failed to create upload request: %w", err)
+        }
+        req.Header.Set("Content-Type", "application/x-ndjson")
+        req.Header.Set("Content-Encoding", "gzip")
+        req.Header.Set("X-Floq-Run-ID", runID)
+        req.Header.Set("X-Floq-Chunk", position)
+        req.Header.Set("Idempotency-Key", runID+"-"+strings.ReplaceAll(position, "/", "-of-"))
+        if config.Token != "" {
+            req.Header.Set("Authorization", "Bearer "+config.Token)
+        }
+        for name, value := range config.Headers {
+            req.Header.Set(name, value)
+        }
+
+        resp, err := client.Do(req)
+        if err != nil {
+            lastErr = err
+            continue
+        }
+        detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+        resp.Body.Close()
+        if resp.StatusCode/100 == 2 {
+            return nil
+        }
+        lastErr = fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+        if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+            return lastErr
+        }
+        if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+            delay = time.Duration(seconds) * time.Second
+        }
+    }
+    return fmt.Errorf("giving up after %d attempts: %w", attempts, lastErr)
+}
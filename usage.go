@@ -0,0 +1,141 @@
+package main
+
+import (
+    "go/ast"
+    "go/parser"
+    "go/token"
+    "os"
+    "path"
+    "sort"
+    "strings"
+)
+
+// maxUsageExamples is the number of test call sites kept per function
+const maxUsageExamples = 3
+
+// maxExampleLines caps the length of a usage example snippet
+const maxExampleLines = 8
+
+// UsageExample is a call of a function found in the repository's tests
+type UsageExample struct {
+    File    string `json:"file"`
+    Line    int    `json:"line"`
+    Snippet string `json:"snippet"`
+}
+
+// functionKey identifies a function by its package import path and name
+func functionKey(importPath, name string) string {
+    return importPath + "." + name
+}
+
+// attachUsageExamples scans the repository's _test.go files for calls of
+// the extracted functions and stores the most representative ones, the
+// shortest distinct calls, on each function
+func (g *GitHubFunctionExtractor) attachUsageExamples(functions []FunctionInfo) {
+    wanted := make(map[string]bool)
+    for _, function := range functions {
+        if function.Kind != FunctionKindClosure {
+            wanted[functionKey(packageImportPath(g.modulePath, path.Dir(function.RelativePath)), function.Name)] = true
+        }
+    }
+    if len(wanted) == 0 {
+        return
+    }
+
+    examples := make(map[string][]UsageExample)
+    err := g.walkTestFiles(func(filePath string) error {
+        for key, found := range g.testCallSites(filePath, wanted) {
+            examples[key] = append(examples[key], found...)
+        }
+        return nil
+    })
+    if err != nil {
+        g.logger.Printf("Failed to scan test files for usage examples: %v", err)
+    }
+
+    for i := range functions {
+        key := functionKey(packageImportPath(g.modulePath, path.Dir(functions[i].RelativePath)), functions[i].Name)
+        functions[i].Examples = representativeExamples(examples[key])
+    }
+}
+
+// testCallSites returns the calls of wanted functions in a test file, by
+// function key. Internal tests call their package's functions directly;
+// external _test packages call them through an import.
+func (g *GitHubFunctionExtractor) testCallSites(filePath string, wanted map[string]bool) map[string][]UsageExample {
+    src, err := os.ReadFile(filePath)
+    if err != nil {
+        return nil
+    }
+    fset := token.NewFileSet()
+    node, err := parser.ParseFile(fset, filePath, src, 0)
+    if err != nil {
+        return nil
+    }
+
+    relPath := g.relativePath(filePath)
+    ownPackage := packageImportPath(g.modulePath, path.Dir(relPath))
+    imports := fileImports(node)
+    internal := !strings.HasSuffix(node.Name.Name, "_test")
+
+    found := make(map[string][]UsageExample)
+    ast.Inspect(node, func(n ast.Node) bool {
+        call, ok := n.(*ast.CallExpr)
+        if !ok {
+            return true
+        }
+        var key string
+        switch fun := call.Fun.(type) {
+        case *ast.Ident:
+            if internal {
+                key = functionKey(ownPackage, fun.Name)
+            }
+        case *ast.SelectorExpr:
+            if pkg, ok := fun.X.(*ast.Ident); ok && imports[pkg.Name] != "" {
+                key = functionKey(imports[pkg.Name], fun.Sel.Name)
+            }
+        }
+        if key == "" || !wanted[key] {
+            return true
+        }
+        found[key] = append(found[key], UsageExample{
+            File:    relPath,
+            Line:    fset.Position(call.Pos()).Line,
+            Snippet: string(src[fset.Position(call.Pos()).Offset:fset.Position(call.End()).Offset]),
+        })
+        return true
+    })
+    return found
+}
+
+// representativeExamples keeps the shortest distinct snippets, in file
+// order, truncating long multi-line calls
+func representativeExamples(examples []UsageExample) []UsageExample {
+    if len(examples) == 0 {
+        return nil
+    }
+    seen := make(map[string]bool)
+    var distinct []UsageExample
+    for _, example := range examples {
+        if lines := strings.Split(example.Snippet, "\n"); len(lines) > maxExampleLines {
+            example.Snippet = strings.Join(lines[:maxExampleLines], "\n") + "\n..."
+        }
+        if !seen[example.Snippet] {
+            seen[example.Snippet] = true
+            distinct = append(distinct, example)
+        }
+    }
+    sort.SliceStable(distinct, func(i, j int) bool {
+        return len(distinct[i].Snippet) < len(distinct[j].Snippet)
+    })
+    if len(distinct) > maxUsageExamples {
+        distinct = distinct[:maxUsageExamples]
+    }
+    sort.SliceStable(distinct, func(i, j int) bool {
+        if distinct[i].File != distinct[j].File {
+            return distinct[i].File < distinct[j].File
+        }
+        return distinct[i].Line < distinct[j].Line
+    })
+    return distinct
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+)
+
+// defaultOSVURL is the OSV API queried for known vulnerabilities
+const defaultOSVURL = "https://api.osv.dev"
+
+// vulnerabilitiesSchema creates the vulnerabilities table
+const vulnerabilitiesSchema = `CREATE TABLE IF NOT EXISTS vulnerabilities (
+    id         BIGSERIAL PRIMARY KEY,
+    repository TEXT NOT NULL,
+    ref        TEXT,
+    run_id     TEXT,
+    module     TEXT NOT NULL,
+    version    TEXT NOT NULL,
+    vuln_id    TEXT NOT NULL,
+    aliases    TEXT,
+    summary    TEXT,
+    severity   TEXT NOT NULL,
+    fixed      TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+// osvBatchSize is the most queries OSV accepts in one batch request
+const osvBatchSize = 1000
+
+// severityRanks orders the severities OSV databases report; UNKNOWN is
+// used for advisories without one
+var severityRanks = map[string]int{
+    "UNKNOWN":  0,
+    "LOW":      1,
+    "MODERATE": 2,
+    "MEDIUM":   2,
+    "HIGH":     3,
+    "CRITICAL": 4,
+}
+
+// VulnerabilityConfig configures the dependency vulnerability scan
+type VulnerabilityConfig struct {
+    // Scan looks up every module in go.sum in the OSV database before
+    // functions are executed
+    Scan bool `json:"scan"`
+    // SkipSeverity skips executing a repository's functions when one of
+    // its dependencies has a vulnerability of at least this severity
+    // (low, moderate, high, or critical); empty never skips
+    SkipSeverity string `json:"skip_severity,omitempty"`
+    // OSVURL is the base URL of the OSV API
+    OSVURL string `json:"osv_url,omitempty"`
+}
+
+// ModuleVersion is a dependency listed in go.sum
+type ModuleVersion struct {
+    Path    string
+    Version string
+}
+
+// readGoSum returns the module versions whose content go.sum records,
+// leaving out entries only for go.mod files
+func readGoSum(repoPath string) ([]ModuleVersion, error) {
+    file, err := os.Open(filepath.Join(repoPath, "go.sum"))
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+
+    var modules []ModuleVersion
+    seen := make(map[string]bool)
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        fields := strings.Fields(scanner.Text())
+        if len(fields) != 3 || strings.HasSuffix(fields[1], "/go.mod") {
+            continue
+        }
+        key := fields[0] + "@" + fields[1]
+        if !seen[key] {
+            seen[key] = true
+            modules = append(modules, ModuleVersion{Path: fields[0], Version: fields[1]})
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("failed to read go.sum: %w", err)
+    }
+    return modules, nil
+}
+
+// OSVClient queries the OSV vulnerability database
+type OSVClient struct {
+    baseURL string
+    client  *http.Client
+}
+
+// NewOSVClient creates a client for the OSV API at baseURL
+func NewOSVClient(baseURL string) *OSVClient {
+    if baseURL == "" {
+        baseURL = defaultOSVURL
+    }
+    return &OSVClient{
+        baseURL: strings.TrimRight(baseURL, "/"),
+        client:  &http.Client{Timeout: 30 * time.Second},
+    }
+}
+
+// osvQuery is one query of an OSV batch request
+type osvQuery struct {
+    Package struct {
+        Name      string `json:"name"`
+        Ecosystem string `json:"ecosystem"`
+    } `json:"package"`
+    Version string `json:"version"`
+}
+
+// osvVuln is the part of an OSV record the scan uses
+type osvVuln struct {
+    ID       string   `json:"id"`
+    Summary  string   `json:"summary"`
+    Aliases  []string `json:"aliases"`
+    Affected []struct {
+        Package struct {
+            Name string `json:"name"`
+        } `json:"package"`
+        Ranges []struct {
+            Events []map[string]string `json:"events"`
+        } `json:"ranges"`
+    } `json:"affected"`
+    DatabaseSpecific struct {
+        Severity string `json:"severity"`
+    } `json:"database_specific"`
+}
+
+// Lookup returns the known vulnerabilities of the given module versions
+func (c *OSVClient) Lookup(ctx context.Context, modules []ModuleVersion) ([]Vulnerability, error) {
+    var findings []Vulnerability
+    details := make(map[string]*osvVuln)
+    for start := 0; start < len(modules); start += osvBatchSize {
+        batch := modules[start:min(start+osvBatchSize, len(modules))]
+        queries := make([]osvQuery, len(batch))
+        for i, module := range batch {
+            queries[i].Package.Name = module.Path
+            queries[i].Package.Ecosystem = "Go"
+            // OSV compares Go versions without the v prefix
+            queries[i].Version = strings.TrimPrefix(module.Version, "v")
+        }
+
+        var response struct {
+            Results []struct {
+                Vulns []struct {
+                    ID string `json:"id"`
+                } `json:"vulns"`
+            } `json:"results"`
+        }
+        if err := c.post(ctx, "/v1/querybatch", map[string]interface{}{"queries": queries}, &response); err != nil {
+            return nil, err
+        }
+
+        for i, result := range response.Results {
+            if i >= len(batch) {
+                break
+            }
+            for _, vuln := range result.Vulns {
+                detail, ok := details[vuln.ID]
+                if !ok {
+                    detail = &osvVuln{}
+                    if err := c.get(ctx, "/v1/vulns/"+vuln.ID, detail); err != nil {
+                        return nil, err
+                    }
+                    details[vuln.ID] = detail
+                }
+                findings = append(findings, detail.finding(batch[i]))
+            }
+        }
+    }
+
+    sort.Slice(findings, func(i, j int) bool {
+        if findings[i].Module != findings[j].Module {
+            return findings[i].Module < findings[j].Module
+        }
+        return findings[i].ID < findings[j].ID
+    })
+    return findings, nil
+}
+
+// finding describes the vulnerability as it affects one module version
+func (v *osvVuln) finding(module ModuleVersion) Vulnerability {
+    finding := Vulnerability{
+        Module:   module.Path,
+        Version:  module.Version,
+        ID:       v.ID,
+        Aliases:  v.Aliases,
+        Summary:  v.Summary,
+        Severity: strings.ToUpper(v.DatabaseSpecific.Severity),
+    }
+    if _, ok := severityRanks[finding.Severity]; !ok {
+        finding.Severity = "UNKNOWN"
+    }
+    for _, affected := range v.Affected {
+        if affected.Package.Name != module.Path {
+            continue
+        }
+        for _, r := range affected.Ranges {
+            for _, event := range r.Events {
+                if fixed, ok := event["fixed"]; ok && finding.Fixed == "" {
+                    finding.Fixed = "v" + strings.TrimPrefix(fixed, "v")
+                }
+            }
+        }
+    }
+    return finding
+}
+
+// post sends a JSON request to the OSV API and decodes the response
+func (c *OSVClient) post(ctx context.Context, endpoint string, body, out interface{}) error {
+    data, err := json.Marshal(body)
+    if err != nil {
+        return fmt.Errorf("failed to marshal OSV request: %w", err)
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+endpoint, bytes.NewReader(data))
+    if err != nil {
+        return fmt.Errorf("failed to create OSV request: %w", err)
+    }
+    req.Header.Set("Content-Type", "application/json")
+    resp, err := c.client.Do(req)
+    if err != nil {
+        return fmt.Errorf("failed to query OSV: %w", err)
+    }
+    defer resp.Body.Close()
+    return decodeOSVResponse(resp, out)
+}
+
+// get fetches a JSON document from the OSV API
+func (c *OSVClient) get(ctx context.Context, endpoint string, out interface{}) error {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+endpoint, nil)
+    if err != nil {
+        return fmt.Errorf("failed to create OSV request: %w", err)
+    }
+    resp, err := c.client.Do(req)
+    if err != nil {
+        return fmt.Errorf("failed to query OSV: %w", err)
+    }
+    defer resp.Body.Close()
+    return decodeOSVResponse(resp, out)
+}
+
+// decodeOSVResponse checks an OSV response's status and decodes its body
+func decodeOSVResponse(resp *http.Response, out interface{}) error {
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("failed to query OSV: unexpected status %s", resp.Status)
+    }
+    if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+        return fmt.Errorf("failed to decode OSV response: %w", err)
+    }
+    return nil
+}
+
+// severityAtLeast reports whether severity reaches threshold
+func severityAtLeast(severity, threshold string) bool {
+    return severityRanks[strings.ToUpper(severity)] >= severityRanks[strings.ToUpper(threshold)]
+}
+
+// scanVulnerabilities looks up the repository's dependencies, stores the
+// findings, and returns why execution should be skipped, or "" to go on
+func (g *GitHubFunctionExtractor) scanVulnerabilities(ctx context.Context, result *ProcessingResult) string {
+    modules, err := readGoSum(g.repoPath)
+    if err != nil {
+        if !os.IsNotExist(err) {
+            result.Errors = append(result.Errors, fmt.Sprintf("Failed to scan dependencies: %v", err))
+        }
+        return ""
+    }
+    if len(modules) == 0 {
+        return ""
+    }
+
+    g.reportProgress("scanning %d dependencies for vulnerabilities", len(modules))
+    findings, err := NewOSVClient(g.vulnConfig.OSVURL).Lookup(ctx, modules)
+    if err != nil {
+        result.Errors = append(result.Errors, fmt.Sprintf("Failed to scan dependencies: %v", err))
+        return ""
+    }
+    g.logger.Printf("Found %d known vulnerabilities in %d dependencies", len(findings), len(modules))
+    result.Vulnerabilities = findings
+
+    ref := ""
+    if g.ref != nil {
+        ref = g.ref.Name
+    }
+    if err := g.storage.StoreVulnerabilities(ctx, g.repoURL, ref, g.runID, findings); err != nil {
+        result.Errors = append(result.Errors, fmt.Sprintf("Failed to store vulnerabilities: %v", err))
+    }
+
+    if g.vulnConfig.SkipSeverity == "" {
+        return ""
+    }
+    var blocking []string
+    for _, finding := range findings {
+        if severityAtLeast(finding.Severity, g.vulnConfig.SkipSeverity) {
+            blocking = append(blocking, fmt.Sprintf("%s in %s@%s", finding.ID, finding.Module, finding.Version))
+        }
+    }
+    if len(blocking) == 0 {
+        return ""
+    }
+    return fmt.Sprintf("%d dependencies with %s or worse vulnerabilities: %s",
+        len(blocking), strings.ToLower(g.vulnConfig.SkipSeverity), strings.Join(blocking, ", "))
+}
+
+// StoreVulnerabilities appends a repository's findings to the
+// vulnerabilities table
+func (p *PostgresStorage) StoreVulnerabilities(ctx context.Context, repository, ref, runID string, findings []Vulnerability) error {
+    if err := p.ensureTable(ctx, "vulnerabilities", vulnerabilitiesSchema); err != nil {
+        return fmt.Errorf("failed to create vulnerabilities table: %w", err)
+    }
+    return p.inTransaction(ctx, func(exec sqlExecer) error {
+        for _, finding := range findings {
+            _, err := exec.ExecContext(ctx,
+                "INSERT INTO vulnerabilities (repository, ref, run_id, module, version, vuln_id, aliases, summary, severity, fixed) "+
+                    "VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), $9, NULLIF($10, ''))",
+                repository, ref, runID, finding.Module, finding.Version, finding.ID,
+                strings.Join(finding.Aliases, ","), finding.Summary, finding.Severity, finding.Fixed)
+            if err != nil {
+                return fmt.Errorf("failed to store vulnerability %s: %w", finding.ID, err)
+            }
+        }
+        return nil
+    })
+}
+
+// StoreVulnerabilities appends a repository's findings to the
+// vulnerabilities table
+func (m *MemoryStorage) StoreVulnerabilities(ctx context.Context, repository, ref, runID string, findings []Vulnerability) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    table, ok := m.tables[vulnerabilitiesTable]
+    if !ok {
+        table = &MemoryTable{Columns: []string{"repository", "ref", "run_id", "module", "version", "vuln_id", "aliases", "summary", "severity", "fixed"}}
+        m.tables[vulnerabilitiesTable] = table
+    }
+    for _, finding := range findings {
+        table.Rows = append(table.Rows, map[string]interface{}{
+            "repository": repository,
+            "ref":        ref,
+            "run_id":     runID,
+            "module":     finding.Module,
+            "version":    finding.Version,
+            "vuln_id":    finding.ID,
+            "aliases":    strings.Join(finding.Aliases, ","),
+            "summary":    finding.Summary,
+            "severity":   finding.Severity,
+            "fixed":      finding.Fixed,
+        })
+    }
+    return nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "strings"
+    "syscall"
+
+    "github.com/go-git/go-git/v5"
+)
+
+// Kinds of paths the repository walker refuses to follow
+const (
+    WalkSymlinkLoop   = "symlink loop"
+    WalkSymlinkEscape = "symlink escapes repository"
+    WalkSymlinkBroken = "broken symlink"
+    WalkSymlinkedDir  = "symlinked directory"
+    WalkCaseCollision = "case collision"
+)
+
+// WalkDiagnostic reports a path skipped while walking a repository
+type WalkDiagnostic struct {
+    Path   string `json:"path"`
+    Kind   string `json:"kind"`
+    Detail string `json:"detail,omitempty"`
+}
+
+// String formats the diagnostic for logs and errors
+func (d WalkDiagnostic) String() string {
+    if d.Detail == "" {
+        return fmt.Sprintf("%s: %s", d.Path, d.Kind)
+    }
+    return fmt.Sprintf("%s: %s (%s)", d.Path, d.Kind, d.Detail)
+}
+
+// repoWalker walks a repository without trusting its layout. Symlinked
+// files are followed only when they resolve inside the repository, and
+// symlinked directories are never descended into, like the go command,
+// so loops cannot recur. Names within a directory that differ only in case
+// are skipped after the first, as they cannot coexist on case-insensitive
+// filesystems and the go command rejects them.
+type repoWalker struct {
+    root        string
+    realRoot    string
+    skip        func(path string, entry fs.DirEntry) bool
+    visit       func(path string) error
+    diagnostics []WalkDiagnostic
+}
+
+// walkRepository calls visit for every regular file under root, in lexical
+// order, that skip does not exclude; skip also prunes directories. It
+// returns the paths it refused to follow.
+func walkRepository(root string, skip func(path string, entry fs.DirEntry) bool, visit func(path string) error) ([]WalkDiagnostic, error) {
+    realRoot, err := filepath.EvalSymlinks(root)
+    if err != nil {
+        return nil, fmt.Errorf("failed to resolve repository root: %w", err)
+    }
+    w := &repoWalker{root: root, realRoot: realRoot, skip: skip, visit: visit}
+    err = w.walkDir(root)
+    return w.diagnostics, err
+}
+
+// walkDir walks one directory
+func (w *repoWalker) walkDir(dir string) error {
+    entries, err := os.ReadDir(dir)
+    if err != nil {
+        return err
+    }
+
+    seen := make(map[string]string)
+    for _, entry := range entries {
+        path := filepath.Join(dir, entry.Name())
+        if w.skip(path, entry) {
+            continue
+        }
+
+        folded := strings.ToLower(entry.Name())
+        if first, ok := seen[folded]; ok {
+            w.report(path, WalkCaseCollision, "differs from "+first+" only in case")
+            continue
+        }
+        seen[folded] = entry.Name()
+
+        switch {
+        case entry.Type()&fs.ModeSymlink != 0:
+            if err := w.followLink(path); err != nil {
+                return err
+            }
+        case entry.IsDir():
+            if err := w.walkDir(path); err != nil {
+                return err
+            }
+        case entry.Type().IsRegular():
+            if err := w.visit(path); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// followLink visits a symlinked file that stays inside the repository and
+// reports every other link
+func (w *repoWalker) followLink(path string) error {
+    target, err := filepath.EvalSymlinks(path)
+    if err != nil {
+        if errors.Is(err, syscall.ELOOP) || strings.Contains(err.Error(), "too many links") {
+            w.report(path, WalkSymlinkLoop, "")
+        } else {
+            w.report(path, WalkSymlinkBroken, err.Error())
+        }
+        return nil
+    }
+
+    rel, err := filepath.Rel(w.realRoot, target)
+    if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+        w.report(path, WalkSymlinkEscape, "points to "+target)
+        return nil
+    }
+
+    info, err := os.Stat(target)
+    if err != nil {
+        w.report(path, WalkSymlinkBroken, err.Error())
+        return nil
+    }
+    if info.IsDir() {
+        // A link to the directory holding it, or to any ancestor, would
+        // recur forever if followed
+        realDir, err := filepath.EvalSymlinks(filepath.Dir(path))
+        if err == nil && (realDir == target || strings.HasPrefix(realDir, target+string(filepath.Separator))) {
+            w.report(path, WalkSymlinkLoop, "points to ancestor "+w.relative(target))
+        } else {
+            w.report(path, WalkSymlinkedDir, "not followed, like the go command")
+        }
+        return nil
+    }
+    if !info.Mode().IsRegular() {
+        return nil
+    }
+    return w.visit(path)
+}
+
+// report records a skipped path relative to the repository root
+func (w *repoWalker) report(path, kind, detail string) {
+    w.diagnostics = append(w.diagnostics, WalkDiagnostic{Path: w.relative(path), Kind: kind, Detail: detail})
+}
+
+// relative returns path relative to the repository root, resolving real
+// paths against the real root
+func (w *repoWalker) relative(path string) string {
+    base := w.root
+    if strings.HasPrefix(path, w.realRoot) {
+        base = w.realRoot
+    }
+    if rel, err := filepath.Rel(base, path); err == nil {
+        return filepath.ToSlash(rel)
+    }
+    return path
+}
+
+// indexCaseCollisions reports paths in the repository's index that differ
+// from another path only in case. On case-insensitive filesystems the
+// checkout silently keeps just one of them, so the walk cannot see them.
+func indexCaseCollisions(repo *git.Repository, reported []WalkDiagnostic) []WalkDiagnostic {
+    if repo == nil {
+        return nil
+    }
+    index, err := repo.Storer.Index()
+    if err != nil {
+        return nil
+    }
+
+    known := make(map[string]bool)
+    for _, diagnostic := range reported {
+        known[diagnostic.Path] = true
+    }
+
+    var diagnostics []WalkDiagnostic
+    seen := make(map[string]string)
+    for _, entry := range index.Entries {
+        parts := strings.Split(entry.Name, "/")
+        for i := range parts {
+            prefix := strings.Join(parts[:i+1], "/")
+            folded := strings.ToLower(prefix)
+            first, ok := seen[folded]
+            if !ok {
+                seen[folded] = prefix
+                continue
+            }
+            if first != prefix && !known[prefix] {
+                known[prefix] = true
+                diagnostics = append(diagnostics, WalkDiagnostic{
+                    Path:   prefix,
+                    Kind:   WalkCaseCollision,
+                    Detail: "differs from " + first + " only in case",
+                })
+            }
+        }
+    }
+    return diagnostics
+}
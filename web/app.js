@@ -0,0 +1,211 @@
+// floq dashboard: a hash-routed view over the service's read-only API
+
+const view = document.getElementById("view");
+
+function escape(value) {
+  return String(value ?? "").replace(/[&<>"']/g, (c) => `&#${c.charCodeAt(0)};`);
+}
+
+// The service token is asked for once per tab, the first time the service
+// answers 401
+function authHeaders() {
+  const token = sessionStorage.getItem("floq-token");
+  return token ? { Authorization: `Bearer ${token}` } : {};
+}
+
+function askToken() {
+  const token = prompt("Service token");
+  if (!token) {
+    return false;
+  }
+  sessionStorage.setItem("floq-token", token);
+  return true;
+}
+
+async function api(path) {
+  let response = await fetch(path, { headers: authHeaders() });
+  if (response.status === 401 && askToken()) {
+    response = await fetch(path, { headers: authHeaders() });
+  }
+  if (!response.ok) {
+    throw new Error(`${path}: ${response.status} ${await response.text()}`);
+  }
+  return response.json();
+}
+
+function table(headers, rows) {
+  if (rows.length === 0) {
+    return `<p class="muted">Nothing here yet.</p>`;
+  }
+  const head = headers.map((h) => `<th>${h}</th>`).join("");
+  const body = rows.map((cells) => `<tr>${cells.map((c) => `<td>${c}</td>`).join("")}</tr>`).join("");
+  return `<table><thead><tr>${head}</tr></thead><tbody>${body}</tbody></table>`;
+}
+
+function status(value) {
+  return `<span class="status-${escape(value)}">${escape(value)}</span>`;
+}
+
+function time(value) {
+  return value ? new Date(value).toLocaleString() : "";
+}
+
+async function showJobs() {
+  const jobs = await api("/jobs");
+  view.innerHTML = "<h2>Runs</h2>" + table(
+    ["Job", "Repository", "Status", "Attempts", "Progress", "Created"],
+    jobs.map((job) => [
+      `<a href="#/jobs/${job.id}">${job.id}</a>`,
+      escape(job.repo_url),
+      status(job.status),
+      job.attempts,
+      escape(job.last_error || job.progress),
+      time(job.created_at),
+    ]),
+  );
+}
+
+async function showJob(id) {
+  const job = await api(`/jobs/${id}`);
+  const result = job.result || {};
+  const count = (list) => (list || []).length;
+  let html = `<h2>Job ${job.id}: ${escape(job.repo_url)}</h2>
+    <p>${status(job.status)} · attempt ${job.attempts} · started ${time(job.started_at)} · finished ${time(job.finished_at)}</p>`;
+  if (job.last_error) {
+    html += `<p class="status-failed">${escape(job.last_error)}</p>`;
+  }
+  if (job.result) {
+    html += `<div class="stats">
+      <div><strong>${count(result.processed_functions)}</strong>functions</div>
+      <div><strong>${count(result.executed_functions)}</strong>executed</div>
+      <div><strong>${count(result.skipped_functions)}</strong>skipped</div>
+      <div><strong>${count(result.created_tables)}</strong>tables</div>
+      <div><strong>${count(result.errors)}</strong>errors</div>
+    </div>`;
+    const executed = new Set(result.executed_functions || []);
+    html += "<h3>Functions</h3>" + table(
+      ["Function", "File", "Class", "Executed"],
+      (result.processed_functions || []).map((f) => [
+        escape(f.name),
+        `<code>${escape(f.relative_path)}:${f.line_number}</code>`,
+        escape(f.class),
+        executed.has(f.name) ? "yes" : "",
+      ]),
+    );
+    html += "<h3>Errors</h3>" + table(["Message"], (result.errors || []).map((e) => [`<pre>${escape(e)}</pre>`]));
+  }
+  view.innerHTML = html;
+}
+
+async function showErrors() {
+  const groups = await api("/errors");
+  view.innerHTML = `<h2>Errors</h2><p class="muted">Latest successful run of every repository, by kind.</p>` + table(
+    ["Kind", "Count", "Repositories", "Examples"],
+    groups.map((g) => [
+      escape(g.kind),
+      g.count,
+      g.repositories.map(escape).join("<br>"),
+      g.examples.map((e) => `<pre>${escape(e)}</pre>`).join(""),
+    ]),
+  );
+}
+
+async function showCatalog(params) {
+  const q = params.get("q") || "";
+  const repo = params.get("repo") || "";
+  view.innerHTML = `<h2>Function Catalog</h2>
+    <form id="search">
+      <input name="q" placeholder="Function name (regexp)" value="${escape(q)}">
+      <input name="repo" placeholder="Repository (regexp)" value="${escape(repo)}">
+      <button>Search</button>
+    </form>
+    <div id="results"></div>`;
+  document.getElementById("search").addEventListener("submit", (event) => {
+    event.preventDefault();
+    const form = new URLSearchParams(new FormData(event.target));
+    location.hash = `#/catalog?${form}`;
+  });
+
+  const entries = await api(`/catalog?${new URLSearchParams({ q, repo })}`);
+  document.getElementById("results").innerHTML = table(
+    ["Repository", "Signature", "File", "Class", "Executed", "Doc"],
+    entries.map((e) => [
+      escape(e.repository),
+      `<code>${escape(e.signature)}</code>`,
+      `<code>${escape(e.file)}:${e.line}</code>`,
+      escape(e.class),
+      e.executed ? "yes" : "",
+      escape(e.comment),
+    ]),
+  );
+}
+
+async function render() {
+  const [path, query] = (location.hash.slice(1) || "/jobs").split("?");
+  const params = new URLSearchParams(query);
+  const parts = path.split("/").filter(Boolean);
+  document.querySelectorAll("header nav a").forEach((a) => {
+    a.classList.toggle("active", a.getAttribute("href") === `#/${parts[0]}`);
+  });
+  try {
+    if (parts[0] === "jobs" && parts[1]) {
+      await showJob(parts[1]);
+    } else if (parts[0] === "errors") {
+      await showErrors();
+    } else if (parts[0] === "catalog") {
+      await showCatalog(params);
+    } else {
+      await showJobs();
+    }
+  } catch (err) {
+    view.innerHTML = `<p class="status-failed">${escape(err.message)}</p>`;
+  }
+}
+
+// Refresh the runs and the open job as events arrive, at most once a second.
+// The stream is read with fetch because EventSource cannot send the token.
+async function follow() {
+  const live = document.getElementById("live");
+  let pending = false;
+  const refresh = () => {
+    const path = location.hash.slice(1) || "/jobs";
+    if (pending || !path.startsWith("/jobs")) {
+      return;
+    }
+    pending = true;
+    setTimeout(() => {
+      pending = false;
+      render();
+    }, 1000);
+  };
+  const types = /^event: (repository\.started|repository\.finished|function\.executed|error)$/m;
+  for (;;) {
+    try {
+      const response = await fetch("/events", { headers: authHeaders() });
+      if (response.ok) {
+        live.classList.add("connected");
+        const reader = response.body.pipeThrough(new TextDecoderStream()).getReader();
+        let buffer = "";
+        for (;;) {
+          const { value, done } = await reader.read();
+          if (done) {
+            break;
+          }
+          const messages = (buffer + value).split("\n\n");
+          buffer = messages.pop();
+          if (messages.some((message) => types.test(message))) {
+            refresh();
+          }
+        }
+      }
+    } catch (err) {
+      // Reconnect below
+    }
+    live.classList.remove("connected");
+    await new Promise((resolve) => setTimeout(resolve, 5000));
+  }
+}
+
+window.addEventListener("hashchange", render);
+render();
+follow();
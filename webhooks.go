@@ -0,0 +1,250 @@
+package main
+
+import (
+    "bytes"
+    "crypto/hmac"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "log"
+    "net"
+    "net/http"
+    "net/url"
+    "strconv"
+    "syscall"
+    "time"
+)
+
+// webhookSignatureHeader carries the HMAC-SHA256 of the timestamp and the
+// request body
+const webhookSignatureHeader = "X-Floq-Signature"
+
+// webhookTimestampHeader carries the Unix time a delivery was signed at, so
+// receivers can reject replayed deliveries
+const webhookTimestampHeader = "X-Floq-Timestamp"
+
+// webhookAttempts is the number of delivery attempts per webhook and event
+const webhookAttempts = 3
+
+// webhooksSchema creates the table of registered callback URLs
+const webhooksSchema = `CREATE TABLE IF NOT EXISTS floq_webhooks (
+    id         BIGSERIAL PRIMARY KEY,
+    url        TEXT NOT NULL UNIQUE,
+    secret     TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+// Webhook is a registered callback URL notified when repositories finish
+type Webhook struct {
+    ID        int64     `json:"id"`
+    URL       string    `json:"url"`
+    Secret    string    `json:"secret,omitempty"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookEvent is the payload POSTed to webhooks when a job finishes
+type WebhookEvent struct {
+    Event      string            `json:"event"`
+    JobID      int64             `json:"job_id"`
+    RepoURL    string            `json:"repo_url"`
+    Status     string            `json:"status"`
+    Error      string            `json:"error,omitempty"`
+    Result     *ProcessingResult `json:"result,omitempty"`
+    FinishedAt time.Time         `json:"finished_at"`
+}
+
+// WebhookStore persists webhook registrations and delivers events to them
+type WebhookStore struct {
+    db     *sql.DB
+    client *http.Client
+    logger *log.Logger
+}
+
+// NewWebhookStore creates a webhook store and ensures its table exists
+func NewWebhookStore(db *sql.DB, logger *log.Logger) (*WebhookStore, error) {
+    if err := ensureTable(db, "floq_webhooks", webhooksSchema); err != nil {
+        return nil, fmt.Errorf("failed to create webhooks table: %w", err)
+    }
+    // Deliveries only connect to public addresses, checked when dialing so
+    // a host that resolves differently after registration is refused too
+    dialer := &net.Dialer{Timeout: 10 * time.Second, Control: dialPublicOnly}
+    return &WebhookStore{
+        db: db,
+        client: &http.Client{
+            Timeout:   10 * time.Second,
+            Transport: &http.Transport{DialContext: dialer.DialContext},
+        },
+        logger: logger,
+    }, nil
+}
+
+// Register adds a callback URL, updating its secret if already registered.
+// The URL must be http or https and resolve to public addresses, and every
+// webhook has its own secret.
+func (s *WebhookStore) Register(url, secret string) (*Webhook, error) {
+    if secret == "" {
+        return nil, fmt.Errorf("webhook secret is required")
+    }
+    if err := validateWebhookURL(url); err != nil {
+        return nil, err
+    }
+    hook := &Webhook{URL: url}
+    err := s.db.QueryRow(`
+        INSERT INTO floq_webhooks (url, secret) VALUES ($1, $2)
+        ON CONFLICT (url) DO UPDATE SET secret = EXCLUDED.secret
+        RETURNING id, created_at`, url, secret).Scan(&hook.ID, &hook.CreatedAt)
+    if err != nil {
+        return nil, fmt.Errorf("failed to register webhook: %w", err)
+    }
+    return hook, nil
+}
+
+// Unregister removes a webhook by id
+func (s *WebhookStore) Unregister(id int64) error {
+    if _, err := s.db.Exec("DELETE FROM floq_webhooks WHERE id = $1", id); err != nil {
+        return fmt.Errorf("failed to unregister webhook: %w", err)
+    }
+    return nil
+}
+
+// List returns all registered webhooks. Secrets are included so they can be
+// used for signing; callers exposing the list must redact them.
+func (s *WebhookStore) List() ([]Webhook, error) {
+    rows, err := s.db.Query("SELECT id, url, secret, created_at FROM floq_webhooks ORDER BY id")
+    if err != nil {
+        return nil, fmt.Errorf("failed to list webhooks: %w", err)
+    }
+    defer rows.Close()
+
+    var hooks []Webhook
+    for rows.Next() {
+        var hook Webhook
+        if err := rows.Scan(&hook.ID, &hook.URL, &hook.Secret, &hook.CreatedAt); err != nil {
+            return nil, fmt.Errorf("failed to scan webhook: %w", err)
+        }
+        hooks = append(hooks, hook)
+    }
+    return hooks, rows.Err()
+}
+
+// Notify delivers an event to every registered webhook in the background
+func (s *WebhookStore) Notify(event WebhookEvent) {
+    hooks, err := s.List()
+    if err != nil {
+        s.logger.Printf("Webhooks: %v", err)
+        return
+    }
+    if len(hooks) == 0 {
+        return
+    }
+
+    body, err := json.Marshal(event)
+    if err != nil {
+        s.logger.Printf("Webhooks: failed to marshal event: %v", err)
+        return
+    }
+
+    for _, hook := range hooks {
+        go s.deliver(hook, body)
+    }
+}
+
+// deliver POSTs a signed event body to one webhook, retrying with backoff
+func (s *WebhookStore) deliver(hook Webhook, body []byte) {
+    // Webhooks registered before secrets were required are never sent
+    // unsigned
+    if hook.Secret == "" {
+        s.logger.Printf("Webhook %s: skipped as it has no secret; register it again with one", hook.URL)
+        return
+    }
+
+    var lastErr error
+    for attempt := 1; attempt <= webhookAttempts; attempt++ {
+        if attempt > 1 {
+            time.Sleep(time.Duration(attempt*attempt) * time.Second)
+        }
+
+        req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+        if err != nil {
+            s.logger.Printf("Webhook %s: %v", hook.URL, err)
+            return
+        }
+        req.Header.Set("Content-Type", "application/json")
+        // Every attempt is signed afresh, so retries stay within the
+        // receivers' tolerance
+        timestamp := time.Now().Unix()
+        req.Header.Set(webhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+        req.Header.Set(webhookSignatureHeader, SignWebhookPayload(hook.Secret, timestamp, body))
+
+        resp, err := s.client.Do(req)
+        if err == nil {
+            resp.Body.Close()
+            if resp.StatusCode < 300 {
+                return
+            }
+            err = fmt.Errorf("unexpected status %s", resp.Status)
+        }
+        lastErr = err
+    }
+    s.logger.Printf("Webhook %s: giving up after %d attempts: %v", hook.URL, webhookAttempts, lastErr)
+}
+
+// SignWebhookPayload returns the signature header value for a payload sent
+// at timestamp, in the form "sha256=<hex hmac>" over "<timestamp>.<body>".
+// Receivers recompute it with the shared secret to verify the request came
+// from floq, and reject timestamps too far from their clock to stop replays.
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+    mac.Write(body)
+    return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// validateWebhookURL checks that a webhook URL is http or https and that its
+// host resolves only to public addresses, so webhooks cannot reach the
+// service's own host or network
+func validateWebhookURL(raw string) error {
+    u, err := url.Parse(raw)
+    if err != nil {
+        return fmt.Errorf("invalid webhook URL: %w", err)
+    }
+    if u.Scheme != "http" && u.Scheme != "https" {
+        return fmt.Errorf("webhook URL must be http or https, not %q", u.Scheme)
+    }
+    host := u.Hostname()
+    if host == "" {
+        return fmt.Errorf("webhook URL has no host")
+    }
+    ips, err := net.LookupIP(host)
+    if err != nil {
+        return fmt.Errorf("failed to resolve webhook host %s: %w", host, err)
+    }
+    for _, ip := range ips {
+        if !isPublicIP(ip) {
+            return fmt.Errorf("webhook host %s resolves to non-public address %s", host, ip)
+        }
+    }
+    return nil
+}
+
+// dialPublicOnly refuses connections to non-public addresses
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+    host, _, err := net.SplitHostPort(address)
+    if err != nil {
+        return err
+    }
+    if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+        return fmt.Errorf("refusing to connect to non-public address %s", host)
+    }
+    return nil
+}
+
+// isPublicIP reports whether an address is neither loopback, private,
+// link-local, multicast nor unspecified
+func isPublicIP(ip net.IP) bool {
+    return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() &&
+        !ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() &&
+        !ip.IsMulticast() && !ip.IsUnspecified()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+    body := []byte(`{"event":"job.completed","job_id":7}`)
+    // Computed independently with Python's hmac module
+    want := "sha256=39e8382041550d79b6d08b325cc50c33642ce7cf2fd5386fc44fe352c680d2d0"
+    if got := SignWebhookPayload("topsecret", 1700000000, body); got != want {
+        t.Errorf("SignWebhookPayload = %s, want %s", got, want)
+    }
+
+    // A receiver recomputes it over "<timestamp>.<body>"
+    mac := hmac.New(sha256.New, []byte("topsecret"))
+    mac.Write([]byte("1700000000." + string(body)))
+    if got := SignWebhookPayload("topsecret", 1700000000, body); got != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+        t.Errorf("SignWebhookPayload does not sign the timestamp and body")
+    }
+
+    for _, other := range []string{
+        SignWebhookPayload("othersecret", 1700000000, body),
+        SignWebhookPayload("topsecret", 1700000001, body),
+        SignWebhookPayload("topsecret", 1700000000, []byte(`{"event":"job.completed","job_id":8}`)),
+    } {
+        if other == want {
+            t.Errorf("changing the secret, timestamp or body kept the signature %s", want)
+        }
+    }
+}
+
+func TestIsPublicIP(t *testing.T) {
+    tests := []struct {
+        ip     string
+        public bool
+    }{
+        {"93.184.216.34", true},
+        {"8.8.8.8", true},
+        {"2606:4700:4700::1111", true},
+        {"127.0.0.1", false},
+        {"127.8.9.10", false},
+        {"10.1.2.3", false},
+        {"172.16.0.1", false},
+        {"172.31.255.254", false},
+        {"192.168.1.1", false},
+        {"169.254.169.254", false},
+        {"0.0.0.0", false},
+        {"224.0.0.1", false},
+        {"::1", false},
+        {"::", false},
+        {"fc00::1", false},
+        {"fd12:3456:789a::1", false},
+        {"fe80::1", false},
+        {"ff02::1", false},
+        {"::ffff:127.0.0.1", false},
+        {"::ffff:10.0.0.1", false},
+    }
+    for _, tt := range tests {
+        if got := isPublicIP(net.ParseIP(tt.ip)); got != tt.public {
+            t.Errorf("isPublicIP(%s) = %v, want %v", tt.ip, got, tt.public)
+        }
+    }
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+    tests := []struct {
+        url string
+        err string
+    }{
+        {"https://93.184.216.34/hook", ""},
+        {"http://[2606:4700:4700::1111]:8080/hook", ""},
+        {"ftp://93.184.216.34/hook", "must be http or https"},
+        {"file:///etc/passwd", "must be http or https"},
+        {"gopher://93.184.216.34/", "must be http or https"},
+        {"93.184.216.34/hook", "must be http or https"},
+        {"https:///hook", "has no host"},
+        {"https://127.0.0.1/hook", "non-public address"},
+        {"http://localhost:8080/hook", "non-public address"},
+        {"https://10.0.0.5/hook", "non-public address"},
+        {"https://172.20.1.1/hook", "non-public address"},
+        {"https://192.168.0.10/hook", "non-public address"},
+        {"http://169.254.169.254/latest/meta-data", "non-public address"},
+        {"https://[::1]/hook", "non-public address"},
+        {"https://[fd00::1]/hook", "non-public address"},
+        {"https://[fe80::1]/hook", "non-public address"},
+        {"https://0.0.0.0/hook", "non-public address"},
+        {"http://%zz/hook", "invalid webhook URL"},
+    }
+    for _, tt := range tests {
+        err := validateWebhookURL(tt.url)
+        if tt.err == "" && err != nil {
+            t.Errorf("validateWebhookURL(%s) = %v, want nil", tt.url, err)
+        }
+        if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+            t.Errorf("validateWebhookURL(%s) = %v, want an error containing %q", tt.url, err, tt.err)
+        }
+    }
+}
+
+// TestDialPublicOnly checks deliveries cannot reach a loopback server,
+// whatever name or address the webhook was registered with
+func TestDialPublicOnly(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        t.Errorf("a delivery reached the loopback server")
+    }))
+    defer server.Close()
+
+    dialer := &net.Dialer{Control: dialPublicOnly}
+    client := &http.Client{Transport: &http.Transport{DialContext: dialer.DialContext}}
+    _, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+    for _, target := range []string{server.URL, "http://localhost:" + port} {
+        resp, err := client.Post(target, "application/json", strings.NewReader("{}"))
+        if err == nil {
+            resp.Body.Close()
+            t.Errorf("posting to %s succeeded, want it refused", target)
+            continue
+        }
+        if !strings.Contains(err.Error(), "refusing to connect to non-public address") {
+            t.Errorf("posting to %s failed with %v, want it refused", target, err)
+        }
+    }
+
+    for _, address := range []string{"93.184.216.34:443", "[2606:4700:4700::1111]:443"} {
+        if err := dialPublicOnly("tcp", address, nil); err != nil {
+            t.Errorf("dialPublicOnly(%s) = %v, want nil", address, err)
+        }
+    }
+    for _, address := range []string{"10.0.0.1:80", "[fd00::1]:80", "[::1]:80", "example.com:80", "127.0.0.1"} {
+        if err := dialPublicOnly("tcp", address, nil); err == nil {
+            t.Errorf("dialPublicOnly(%s) = nil, want an error", address)
+        }
+    }
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "io/fs"
+    "os"
+    "path/filepath"
+)
+
+// maxWorkspaceLeftovers caps the leftover paths listed in a report
+const maxWorkspaceLeftovers = 20
+
+// wipeBlock is the size of the zero blocks files are overwritten with
+const wipeBlock = 64 << 10
+
+// WorkspaceConfig controls where repositories are cloned and how their
+// clones are removed, for confidential code that must not linger on shared
+// runners
+type WorkspaceConfig struct {
+    // Dir is the directory clones are created in (default: the system
+    // temporary directory), e.g. an encrypted volume or a tmpfs mount
+    Dir string `json:"dir,omitempty"`
+    // RequireTmpfs refuses to clone unless Dir is memory-backed, so clones
+    // never reach a disk; it is only supported on Linux
+    RequireTmpfs bool `json:"require_tmpfs,omitempty"`
+    // SecureWipe overwrites every file of a clone with zeros before it is
+    // removed, and keeps the go command's build, module and temporary
+    // caches in the clone's workspace so compiled code is wiped as well
+    SecureWipe bool `json:"secure_wipe,omitempty"`
+}
+
+// WorkspaceReport describes how a repository's workspace was cleaned up
+type WorkspaceReport struct {
+    Dir string `json:"dir"`
+    // Wiped is set when the files were overwritten before removal; Files
+    // and Bytes count what was overwritten
+    Wiped bool  `json:"wiped,omitempty"`
+    Files int   `json:"files,omitempty"`
+    Bytes int64 `json:"bytes,omitempty"`
+    // Leftovers are paths still present once the workspace was removed
+    Leftovers []string `json:"leftovers,omitempty"`
+    Error     string   `json:"error,omitempty"`
+}
+
+// Clean reports whether nothing of the workspace was left behind
+func (r *WorkspaceReport) Clean() bool {
+    return len(r.Leftovers) == 0 && r.Error == ""
+}
+
+// add counts a directory removed along with the workspace, such as a
+// kept runner
+func (r *WorkspaceReport) add(other *WorkspaceReport) {
+    r.Files += other.Files
+    r.Bytes += other.Bytes
+    r.Leftovers = append(r.Leftovers, other.Leftovers...)
+    if r.Error == "" {
+        r.Error = other.Error
+    }
+}
+
+// createWorkspace creates the directory a repository is cloned into,
+// checking it is memory-backed when required
+func (g *GitHubFunctionExtractor) createWorkspace() (string, error) {
+    if g.workspaceConfig.RequireTmpfs {
+        parent := orDefault(g.workspaceConfig.Dir, os.TempDir())
+        memory, err := memoryBacked(parent)
+        if err != nil {
+            return "", fmt.Errorf("failed to check workspace %s: %w", parent, err)
+        }
+        if !memory {
+            return "", fmt.Errorf("workspace %s is not memory-backed", parent)
+        }
+    }
+    dir, err := os.MkdirTemp(g.workspaceConfig.Dir, "repo_*")
+    if err != nil {
+        return "", fmt.Errorf("failed to create temp directory: %w", err)
+    }
+    return dir, nil
+}
+
+// workspaceEnv returns the environment keeping the go command's caches in
+// the workspace when it is securely wiped
+func (g *GitHubFunctionExtractor) workspaceEnv() []string {
+    if !g.workspaceConfig.SecureWipe || g.tempDir == "" {
+        return nil
+    }
+    gotmp := filepath.Join(g.tempDir, "gotmp")
+    if err := os.MkdirAll(gotmp, 0700); err != nil {
+        g.logger.Printf("Failed to create go temporary directory: %v", err)
+        return nil
+    }
+    return []string{
+        "GOCACHE=" + filepath.Join(g.tempDir, "gocache"),
+        "GOMODCACHE=" + filepath.Join(g.tempDir, "gomodcache"),
+        "GOTMPDIR=" + gotmp,
+    }
+}
+
+// removeWorkspace removes a workspace, overwriting its files first when
+// wipe is set, and verifies nothing is left of it
+func removeWorkspace(dir string, wipe bool) *WorkspaceReport {
+    report := &WorkspaceReport{Dir: dir, Wiped: wipe}
+    if wipe {
+        files, bytes, err := wipeFiles(dir)
+        report.Files, report.Bytes = files, bytes
+        if err != nil {
+            report.Error = err.Error()
+        }
+    }
+    if err := os.RemoveAll(dir); err != nil && report.Error == "" {
+        report.Error = fmt.Sprintf("failed to remove workspace: %v", err)
+    }
+    report.Leftovers = workspaceLeftovers(dir)
+    return report
+}
+
+// wipeFiles overwrites every regular file under dir with zeros, syncing
+// each to the disk. Read-only files and directories, such as those of the
+// module cache, are made writable first. Symbolic links are not followed.
+// A file that cannot be overwritten does not stop the others from being
+// wiped; the first such error is returned.
+func wipeFiles(dir string) (int, int64, error) {
+    var files int
+    var bytes int64
+    var firstErr error
+    block := make([]byte, wipeBlock)
+    filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+        if err == nil && entry.IsDir() {
+            err = os.Chmod(path, 0700)
+        } else if err == nil && entry.Type().IsRegular() {
+            var size int64
+            if size, err = wipeFile(path, block); err == nil {
+                files++
+                bytes += size
+            }
+        }
+        if err != nil && firstErr == nil {
+            firstErr = fmt.Errorf("failed to wipe workspace: %w", err)
+        }
+        return nil
+    })
+    return files, bytes, firstErr
+}
+
+// wipeFile overwrites a file with zeros from block and syncs it, returning
+// its size
+func wipeFile(path string, block []byte) (int64, error) {
+    if err := os.Chmod(path, 0600); err != nil {
+        return 0, err
+    }
+    file, err := os.OpenFile(path, os.O_WRONLY, 0)
+    if err != nil {
+        return 0, err
+    }
+    defer file.Close()
+    info, err := file.Stat()
+    if err != nil {
+        return 0, err
+    }
+    for written := int64(0); written < info.Size(); {
+        n, err := file.Write(block[:min(int64(len(block)), info.Size()-written)])
+        written += int64(n)
+        if err != nil {
+            return written, fmt.Errorf("failed to overwrite %s: %w", path, err)
+        }
+    }
+    if err := file.Sync(); err != nil {
+        return info.Size(), fmt.Errorf("failed to sync %s: %w", path, err)
+    }
+    return info.Size(), file.Close()
+}
+
+// workspaceLeftovers lists what is left of a removed workspace
+func workspaceLeftovers(dir string) []string {
+    if _, err := os.Lstat(dir); errors.Is(err, fs.ErrNotExist) {
+        return nil
+    }
+    var leftovers []string
+    filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+        if len(leftovers) == maxWorkspaceLeftovers {
+            return filepath.SkipAll
+        }
+        leftovers = append(leftovers, path)
+        return nil
+    })
+    return leftovers
+}
+
+// writeWorkspaceSummary writes how the run's workspaces were cleaned up,
+// when any was wiped or left behind
+func writeWorkspaceSummary(w io.Writer, results map[string]*ProcessingResult) {
+    var wiped, unclean int
+    for _, result := range results {
+        if result == nil || result.Workspace == nil {
+            continue
+        }
+        if result.Workspace.Wiped {
+            wiped++
+        }
+        if !result.Workspace.Clean() {
+            unclean++
+        }
+    }
+    if wiped == 0 && unclean == 0 {
+        return
+    }
+    if unclean == 0 {
+        fmt.Fprintf(w, "🧹 Workspaces: %d wiped, all verified removed\n", wiped)
+        return
+    }
+    fmt.Fprintf(w, "⚠️  Workspaces: %d wiped, %d not removed cleanly\n", wiped, unclean)
+}
@@ -0,0 +1,21 @@
+//go:build linux
+
+package main
+
+import "syscall"
+
+// Filesystem magic numbers of memory-backed filesystems, see statfs(2)
+const (
+    tmpfsMagic = 0x01021994
+    ramfsMagic = 0x858458f6
+)
+
+// memoryBacked reports whether dir is on a tmpfs or ramfs filesystem
+func memoryBacked(dir string) (bool, error) {
+    var stat syscall.Statfs_t
+    if err := syscall.Statfs(dir, &stat); err != nil {
+        return false, err
+    }
+    fsType := uint32(stat.Type)
+    return fsType == tmpfsMagic || fsType == ramfsMagic, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// memoryBacked is not implemented on this platform
+func memoryBacked(dir string) (bool, error) {
+    return false, errors.New("memory-backed workspaces can only be checked on Linux")
+}
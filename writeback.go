@@ -0,0 +1,411 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "path"
+    "path/filepath"
+    "slices"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/go-git/go-git/v5"
+    gitconfig "github.com/go-git/go-git/v5/config"
+    "github.com/go-git/go-git/v5/plumbing"
+    "github.com/go-git/go-git/v5/plumbing/filemode"
+    "github.com/go-git/go-git/v5/plumbing/object"
+    githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// Catalog formats that can be written back into repositories
+const (
+    WriteBackMarkdown = "markdown"
+    WriteBackJSON     = "json"
+)
+
+// Write-back defaults
+const (
+    defaultWriteBackBranch = "floq/catalog-{run}"
+    defaultWriteBackAuthor = "floq"
+    defaultWriteBackEmail  = "floq@localhost"
+)
+
+// WriteBackConfig configures committing the function catalog into every
+// processed repository, for teams that version the catalog with the code
+type WriteBackConfig struct {
+    // Format of the committed catalog: "markdown" or "json"; empty
+    // disables write-back
+    Format string `json:"format,omitempty"`
+    // Path of the catalog in the repository (default: FUNCTIONS.md or
+    // floq-catalog.json)
+    Path string `json:"path,omitempty"`
+    // Branch is the branch the catalog is committed on, with a {run}
+    // placeholder for the run id (default: floq/catalog-{run})
+    Branch string `json:"branch,omitempty"`
+    // PullRequest opens a pull request of the branch through the
+    // provider's API
+    PullRequest bool `json:"pull_request,omitempty"`
+    // Base is the branch the pull request targets (default: the branch
+    // that was processed)
+    Base string `json:"base,omitempty"`
+}
+
+// Enabled reports whether catalogs are written back
+func (c WriteBackConfig) Enabled() bool {
+    return c.Format != ""
+}
+
+// path returns the catalog's path in the repository
+func (c WriteBackConfig) path() string {
+    if c.Path != "" {
+        return path.Clean(filepath.ToSlash(c.Path))
+    }
+    if c.Format == WriteBackJSON {
+        return "floq-catalog.json"
+    }
+    return "FUNCTIONS.md"
+}
+
+// branch returns the branch the catalog of a run is committed on
+func (c WriteBackConfig) branch(runID string) string {
+    branch := c.Branch
+    if branch == "" {
+        branch = defaultWriteBackBranch
+    }
+    if runID == "" {
+        runID = time.Now().UTC().Format("20060102-150405")
+    }
+    return strings.ReplaceAll(branch, "{run}", runID)
+}
+
+// WriteBackRecord describes the catalog committed into a repository
+type WriteBackRecord struct {
+    Branch string `json:"branch"`
+    Path   string `json:"path"`
+    Commit string `json:"commit,omitempty"`
+    // Unchanged is set when the repository already held the same catalog,
+    // so nothing was committed
+    Unchanged   bool   `json:"unchanged,omitempty"`
+    PullRequest string `json:"pull_request,omitempty"`
+}
+
+// catalogDocument is the JSON catalog written back into repositories. It
+// leaves out run ids, times and commits, so it only changes when the
+// functions do.
+type catalogDocument struct {
+    Repository        string            `json:"repository"`
+    ModulePath        string            `json:"module_path,omitempty"`
+    Functions         []FunctionInfo    `json:"functions"`
+    ExecutedFunctions []string          `json:"executed_functions"`
+    OutputSamples     map[string]string `json:"output_samples,omitempty"`
+}
+
+// validateWriteBack checks the catalog format, path and branch
+func validateWriteBack(config WriteBackConfig) error {
+    if !config.Enabled() {
+        return nil
+    }
+    if config.Format != WriteBackMarkdown && config.Format != WriteBackJSON {
+        return fmt.Errorf("write-back format must be %s or %s, got %q", WriteBackMarkdown, WriteBackJSON, config.Format)
+    }
+    catalog := config.path()
+    if path.IsAbs(catalog) || catalog == "." || catalog == ".." || strings.HasPrefix(catalog, "../") {
+        return fmt.Errorf("write-back path %q must be inside the repository", config.Path)
+    }
+    if strings.HasSuffix(filepath.ToSlash(config.Path), "/") {
+        return fmt.Errorf("write-back path %q names a directory, not a file", config.Path)
+    }
+    if slices.Contains(strings.Split(catalog, "/"), ".git") {
+        return fmt.Errorf("write-back path %q must not be inside .git", config.Path)
+    }
+    if branch := config.branch("run"); !validBranchName(branch) {
+        return fmt.Errorf("write-back branch %q is not a valid branch name", config.Branch)
+    }
+    return nil
+}
+
+// validBranchName rejects the branch names git refuses that a template is
+// likely to produce
+func validBranchName(branch string) bool {
+    if branch == "" || strings.HasPrefix(branch, "/") || strings.HasSuffix(branch, "/") ||
+        strings.HasSuffix(branch, ".lock") || strings.Contains(branch, "..") || strings.Contains(branch, "//") {
+        return false
+    }
+    return !strings.ContainsAny(branch, " ~^:?*[\\")
+}
+
+// renderCatalog renders the catalog of a repository in the configured
+// format
+func (g *GitHubFunctionExtractor) renderCatalog(result *ProcessingResult) ([]byte, error) {
+    var buf bytes.Buffer
+    if g.writeBackConfig.Format == WriteBackMarkdown {
+        w := bufio.NewWriter(&buf)
+        writeMarkdownCatalog(w, g.repoURL, result)
+        if err := w.Flush(); err != nil {
+            return nil, err
+        }
+        return buf.Bytes(), nil
+    }
+
+    document := catalogDocument{
+        Repository:        g.repoURL,
+        ModulePath:        result.ModulePath,
+        Functions:         make([]FunctionInfo, len(result.ProcessedFunctions)),
+        ExecutedFunctions: append([]string{}, result.ExecutedFunctions...),
+        OutputSamples:     result.OutputSamples,
+    }
+    // Absolute paths point into the temporary clone
+    for i, function := range result.ProcessedFunctions {
+        function.FilePath = ""
+        document.Functions[i] = function
+    }
+    sort.Strings(document.ExecutedFunctions)
+    data, err := json.MarshalIndent(document, "", "  ")
+    if err != nil {
+        return nil, err
+    }
+    return append(data, '\n'), nil
+}
+
+// writeBackCatalog commits the repository's catalog onto a new branch,
+// pushes it to the repository and, when configured, opens a pull request.
+// The commit is built from the objects of the processed commit rather than
+// the working tree, which holds sparse checkouts and generated files.
+func (g *GitHubFunctionExtractor) writeBackCatalog(ctx context.Context, result *ProcessingResult) {
+    fail := func(format string, args ...interface{}) {
+        message := fmt.Sprintf(format, args...)
+        g.logger.Printf("Failed to write back catalog of %s: %s", g.repoURL, message)
+        result.Errors = append(result.Errors, "Failed to write back catalog: "+message)
+    }
+    if g.repo == nil {
+        g.logger.Printf("Not writing back catalog of %s: it has no git history", g.repoURL)
+        return
+    }
+    if g.dbConfig.Driver == DriverMemory {
+        g.logger.Printf("Not writing back catalog of %s in a dry run", g.repoURL)
+        return
+    }
+
+    head, err := g.repo.Head()
+    if err != nil {
+        fail("failed to resolve HEAD: %v", err)
+        return
+    }
+    parent, err := g.repo.CommitObject(head.Hash())
+    if err != nil {
+        fail("failed to read HEAD: %v", err)
+        return
+    }
+    catalog, err := g.renderCatalog(result)
+    if err != nil {
+        fail("failed to render catalog: %v", err)
+        return
+    }
+
+    record := &WriteBackRecord{Branch: g.writeBackConfig.branch(g.runID), Path: g.writeBackConfig.path()}
+    result.WriteBack = record
+    blob, err := storeObject(g.repo, plumbing.BlobObject, catalog)
+    if err != nil {
+        fail("failed to store catalog: %v", err)
+        return
+    }
+    if file, err := parent.File(record.Path); err == nil && file.Hash == blob {
+        g.logger.Printf("Catalog of %s is up to date in %s", g.repoURL, record.Path)
+        record.Unchanged = true
+        return
+    }
+
+    tree, err := parent.Tree()
+    if err != nil {
+        fail("failed to read tree: %v", err)
+        return
+    }
+    treeHash, err := replaceTreeEntry(g.repo, tree, strings.Split(record.Path, "/"), blob)
+    if err != nil {
+        fail("failed to write catalog to %s: %v", record.Path, err)
+        return
+    }
+    signature := object.Signature{Name: defaultWriteBackAuthor, Email: defaultWriteBackEmail, When: time.Now()}
+    commit := &object.Commit{
+        Author:       signature,
+        Committer:    signature,
+        Message:      fmt.Sprintf("Update function catalog %s\n\nGenerated by floq run %s.\n", record.Path, g.runID),
+        TreeHash:     treeHash,
+        ParentHashes: []plumbing.Hash{parent.Hash},
+    }
+    commitObject := g.repo.Storer.NewEncodedObject()
+    if err := commit.Encode(commitObject); err != nil {
+        fail("failed to encode commit: %v", err)
+        return
+    }
+    commitHash, err := g.repo.Storer.SetEncodedObject(commitObject)
+    if err != nil {
+        fail("failed to store commit: %v", err)
+        return
+    }
+    record.Commit = commitHash.String()
+
+    branch := plumbing.NewBranchReferenceName(record.Branch)
+    if err := g.repo.Storer.SetReference(plumbing.NewHashReference(branch, commitHash)); err != nil {
+        fail("failed to create branch %s: %v", record.Branch, err)
+        return
+    }
+    options := &git.PushOptions{
+        RemoteName: git.DefaultRemoteName,
+        RefSpecs:   []gitconfig.RefSpec{gitconfig.RefSpec(fmt.Sprintf("%s:%s", branch, branch))},
+    }
+    if token := providerToken(providerHost(g.repoURL)); token != "" && strings.HasPrefix(g.repoURL, "http") {
+        options.Auth = &githttp.BasicAuth{Username: defaultWriteBackAuthor, Password: token}
+    }
+    if err := g.repo.PushContext(ctx, options); err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+        fail("failed to push %s: %v", record.Branch, err)
+        return
+    }
+    g.logger.Printf("Pushed catalog of %s to branch %s", g.repoURL, record.Branch)
+
+    if !g.writeBackConfig.PullRequest {
+        return
+    }
+    base := g.writeBackConfig.Base
+    if base == "" {
+        if !head.Name().IsBranch() {
+            fail("cannot open a pull request from a detached checkout without write_back.base")
+            return
+        }
+        base = head.Name().Short()
+    }
+    pullRequest, err := openPullRequest(ctx, g.repoURL, record.Branch, base, record.Path, g.runID)
+    if err != nil {
+        fail("failed to open pull request: %v", err)
+        return
+    }
+    record.PullRequest = pullRequest
+    g.logger.Printf("Opened pull request %s", pullRequest)
+}
+
+// storeObject writes an object into the repository and returns its hash
+func storeObject(repo *git.Repository, kind plumbing.ObjectType, content []byte) (plumbing.Hash, error) {
+    encoded := repo.Storer.NewEncodedObject()
+    encoded.SetType(kind)
+    encoded.SetSize(int64(len(content)))
+    w, err := encoded.Writer()
+    if err != nil {
+        return plumbing.ZeroHash, err
+    }
+    if _, err := w.Write(content); err != nil {
+        return plumbing.ZeroHash, err
+    }
+    if err := w.Close(); err != nil {
+        return plumbing.ZeroHash, err
+    }
+    return repo.Storer.SetEncodedObject(encoded)
+}
+
+// replaceTreeEntry stores a copy of tree, which may be nil for a new
+// directory, with the file at the path given by parts pointing to blob,
+// and returns the copy's hash. A directory is never replaced by the file,
+// nor a file or submodule by a directory of the path.
+func replaceTreeEntry(repo *git.Repository, tree *object.Tree, parts []string, blob plumbing.Hash) (plumbing.Hash, error) {
+    var entries []object.TreeEntry
+    var subtree *object.Tree
+    if tree != nil {
+        for _, entry := range tree.Entries {
+            if entry.Name != parts[0] {
+                entries = append(entries, entry)
+                continue
+            }
+            if len(parts) == 1 && (entry.Mode == filemode.Dir || entry.Mode == filemode.Submodule) {
+                return plumbing.ZeroHash, fmt.Errorf("%s is a directory", entry.Name)
+            }
+            if len(parts) > 1 && entry.Mode != filemode.Dir {
+                return plumbing.ZeroHash, fmt.Errorf("%s is not a directory", entry.Name)
+            }
+            if len(parts) > 1 {
+                var err error
+                if subtree, err = repo.TreeObject(entry.Hash); err != nil {
+                    return plumbing.ZeroHash, err
+                }
+            }
+        }
+    }
+
+    entry := object.TreeEntry{Name: parts[0], Mode: filemode.Regular, Hash: blob}
+    if len(parts) > 1 {
+        hash, err := replaceTreeEntry(repo, subtree, parts[1:], blob)
+        if err != nil {
+            return plumbing.ZeroHash, err
+        }
+        entry = object.TreeEntry{Name: parts[0], Mode: filemode.Dir, Hash: hash}
+    }
+    entries = append(entries, entry)
+
+    // Git orders entries by name, comparing directories as if their name
+    // ended with a slash
+    sortKey := func(entry object.TreeEntry) string {
+        if entry.Mode == filemode.Dir {
+            return entry.Name + "/"
+        }
+        return entry.Name
+    }
+    sort.Slice(entries, func(i, j int) bool { return sortKey(entries[i]) < sortKey(entries[j]) })
+
+    encoded := repo.Storer.NewEncodedObject()
+    if err := (&object.Tree{Entries: entries}).Encode(encoded); err != nil {
+        return plumbing.ZeroHash, err
+    }
+    return repo.Storer.SetEncodedObject(encoded)
+}
+
+// openPullRequest opens a pull request of branch into base through the
+// GitHub API of the repository's provider and returns its URL
+func openPullRequest(ctx context.Context, repoURL, branch, base, catalog, runID string) (string, error) {
+    host := providerHost(repoURL)
+    apiURL := providerAPIURL(host)
+    slug := repositorySlug(repoURL)
+    if apiURL == "" || strings.Count(slug, "/") != 1 {
+        return "", fmt.Errorf("no provider API is configured for %s", repoURL)
+    }
+
+    body, err := json.Marshal(map[string]string{
+        "title": "Update function catalog " + catalog,
+        "head":  branch,
+        "base":  base,
+        "body":  fmt.Sprintf("Function catalog generated by floq run %s.", runID),
+    })
+    if err != nil {
+        return "", err
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL+"/repos/"+slug+"/pulls", bytes.NewReader(body))
+    if err != nil {
+        return "", err
+    }
+    req.Header.Set("Accept", "application/vnd.github+json")
+    req.Header.Set("Content-Type", "application/json")
+    if token := providerToken(host); token != "" {
+        req.Header.Set("Authorization", "Bearer "+token)
+    }
+
+    resp, err := providerHTTPClient(30 * time.Second).Do(req)
+    if err != nil {
+        return "", err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusCreated {
+        message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+        return "", fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(message)))
+    }
+    var pullRequest struct {
+        HTMLURL string `json:"html_url"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&pullRequest); err != nil {
+        return "", fmt.Errorf("failed to decode pull request: %w", err)
+    }
+    return pullRequest.HTMLURL, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+    "strings"
+    "testing"
+
+    "github.com/go-git/go-git/v5"
+    "github.com/go-git/go-git/v5/plumbing"
+    "github.com/go-git/go-git/v5/plumbing/filemode"
+    "github.com/go-git/go-git/v5/plumbing/object"
+    "github.com/go-git/go-git/v5/storage/memory"
+)
+
+func TestValidateWriteBackPath(t *testing.T) {
+    tests := []struct {
+        path string
+        err  string
+    }{
+        {"", ""},
+        {"docs/FUNCTIONS.md", ""},
+        {"./docs/../FUNCTIONS.md", ""},
+        {"docs/", "names a directory"},
+        {"/etc/FUNCTIONS.md", "inside the repository"},
+        {"../FUNCTIONS.md", "inside the repository"},
+        {".", "inside the repository"},
+        {".git/FUNCTIONS.md", "inside .git"},
+        {"sub/.git/config", "inside .git"},
+    }
+    for _, tt := range tests {
+        err := validateWriteBack(WriteBackConfig{Format: WriteBackMarkdown, Path: tt.path})
+        if tt.err == "" && err != nil {
+            t.Errorf("validateWriteBack(%q) = %v, want nil", tt.path, err)
+        }
+        if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+            t.Errorf("validateWriteBack(%q) = %v, want an error containing %q", tt.path, err, tt.err)
+        }
+    }
+}
+
+func TestReplaceTreeEntry(t *testing.T) {
+    repo, err := git.Init(memory.NewStorage(), nil)
+    if err != nil {
+        t.Fatalf("failed to create repository: %v", err)
+    }
+    blob := func(content string) plumbing.Hash {
+        hash, err := storeObject(repo, plumbing.BlobObject, []byte(content))
+        if err != nil {
+            t.Fatalf("failed to store blob: %v", err)
+        }
+        return hash
+    }
+    // docs/guide.md and README.md
+    docs, err := replaceTreeEntry(repo, nil, []string{"guide.md"}, blob("guide"))
+    if err != nil {
+        t.Fatalf("failed to build docs tree: %v", err)
+    }
+    rootHash, err := replaceTreeEntry(repo, &object.Tree{Entries: []object.TreeEntry{
+        {Name: "docs", Mode: filemode.Dir, Hash: docs},
+    }}, []string{"README.md"}, blob("readme"))
+    if err != nil {
+        t.Fatalf("failed to build root tree: %v", err)
+    }
+    root, err := repo.TreeObject(rootHash)
+    if err != nil {
+        t.Fatalf("failed to read root tree: %v", err)
+    }
+
+    catalog := blob("catalog")
+    tests := []struct {
+        path string
+        err  string
+    }{
+        {"docs/FUNCTIONS.md", ""},
+        {"docs/guide.md", ""},
+        {"FUNCTIONS.md", ""},
+        {"docs", "docs is a directory"},
+        {"README.md/FUNCTIONS.md", "README.md is not a directory"},
+    }
+    for _, tt := range tests {
+        hash, err := replaceTreeEntry(repo, root, strings.Split(tt.path, "/"), catalog)
+        if tt.err != "" {
+            if err == nil || !strings.Contains(err.Error(), tt.err) {
+                t.Errorf("replaceTreeEntry(%s) = %v, want an error containing %q", tt.path, err, tt.err)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("replaceTreeEntry(%s) = %v", tt.path, err)
+            continue
+        }
+        tree, err := repo.TreeObject(hash)
+        if err != nil {
+            t.Fatalf("failed to read tree: %v", err)
+        }
+        for _, name := range []string{tt.path, "README.md", "docs/guide.md"} {
+            file, err := tree.File(name)
+            if err != nil {
+                t.Errorf("after writing %s, %s is missing: %v", tt.path, name, err)
+            } else if name == tt.path && file.Hash != catalog {
+                t.Errorf("%s does not hold the catalog", tt.path)
+            }
+        }
+    }
+}